@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -38,6 +40,7 @@ var (
 	metricsPort    = flag.String("metrics-port", "9090", "Prometheus metrics port")
 	otlpEndpoint   = flag.String("otlp-endpoint", "localhost:4318", "OpenTelemetry OTLP HTTP endpoint")
 	tracingEnabled = flag.Bool("tracing-enabled", true, "Enable distributed tracing")
+	diagnoser      = flag.Bool("diagnoser", false, "Publish flushed windows for the diagnoser service instead of diagnosing them inline")
 )
 
 // Prometheus metrics
@@ -90,6 +93,37 @@ var (
 		},
 		[]string{"status"},
 	)
+
+	pathTracesProcessedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "path_traces_processed_total",
+			Help: "Total number of path traces processed",
+		},
+		[]string{"status"}, // success, duplicate, error
+	)
+
+	pathChangesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "path_changes_total",
+			Help: "Total number of path traces that differed from the previous trace of the same target",
+		},
+	)
+
+	heartbeatsProcessedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "heartbeats_processed_total",
+			Help: "Total number of probe heartbeats processed",
+		},
+		[]string{"status"}, // success, error
+	)
+
+	windowNotificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "window_notifications_total",
+			Help: "Total number of flushed-window notifications published for the diagnoser",
+		},
+		[]string{"status"}, // success, late, error
+	)
 )
 
 func init() {
@@ -98,6 +132,10 @@ func init() {
 	prometheus.MustRegister(dedupRate)
 	prometheus.MustRegister(lateEventsTotal)
 	prometheus.MustRegister(windowFlushDuration)
+	prometheus.MustRegister(pathTracesProcessedTotal)
+	prometheus.MustRegister(pathChangesTotal)
+	prometheus.MustRegister(heartbeatsProcessedTotal)
+	prometheus.MustRegister(windowNotificationsTotal)
 }
 
 // Aggregator consumes events from NATS and produces windowed aggregates
@@ -105,6 +143,9 @@ type Aggregator struct {
 	processor      models.EventProcessor
 	eventsSeenRepo *database.EventsSeenRepository
 	aggregatesRepo *database.AggregatesRepository
+	pathTracesRepo *database.PathTracesRepository
+	clockSkewRepo  *database.ClockSkewRepository
+	heartbeatsRepo *database.HeartbeatsRepository
 	repository     *database.Repository // For fetching historical data
 
 	mu               sync.RWMutex
@@ -115,6 +156,10 @@ type Aggregator struct {
 	flushDelay    time.Duration
 	lateTolerance time.Duration // Tolerance for late events
 
+	// windowNotifier, when set, receives flushed windows for the diagnoser
+	// service, which replaces inline diagnosis
+	windowNotifier models.DiagnosisProcessor
+
 	// Dedup tracking for metrics
 	totalProcessed int64
 	duplicateCount int64
@@ -127,6 +172,9 @@ func NewAggregator(
 	processor models.EventProcessor,
 	eventsSeenRepo *database.EventsSeenRepository,
 	aggregatesRepo *database.AggregatesRepository,
+	pathTracesRepo *database.PathTracesRepository,
+	clockSkewRepo *database.ClockSkewRepository,
+	heartbeatsRepo *database.HeartbeatsRepository,
 	repository *database.Repository,
 	windowSize, flushDelay, lateTolerance time.Duration,
 ) *Aggregator {
@@ -136,6 +184,9 @@ func NewAggregator(
 		processor:        processor,
 		eventsSeenRepo:   eventsSeenRepo,
 		aggregatesRepo:   aggregatesRepo,
+		pathTracesRepo:   pathTracesRepo,
+		clockSkewRepo:    clockSkewRepo,
+		heartbeatsRepo:   heartbeatsRepo,
 		repository:       repository,
 		aggregators:      make(map[string]*models.InMemoryAggregator),
 		windowStartTimes: make(map[int64]bool),
@@ -152,6 +203,20 @@ func (a *Aggregator) Start() error {
 
 	go a.periodicWindowFlusher()
 
+	// Path traces are stored as they arrive rather than aggregated
+	if pathProcessor, ok := a.processor.(models.PathTraceProcessor); ok && a.pathTracesRepo != nil {
+		if err := pathProcessor.ConsumePathTraces(a.handlePathTrace); err != nil {
+			return fmt.Errorf("failed to consume path traces: %w", err)
+		}
+	}
+
+	// Heartbeats only update each probe's latest liveness record
+	if heartbeatProcessor, ok := a.processor.(models.HeartbeatProcessor); ok && a.heartbeatsRepo != nil {
+		if err := heartbeatProcessor.ConsumeHeartbeats(a.handleHeartbeat); err != nil {
+			return fmt.Errorf("failed to consume heartbeats: %w", err)
+		}
+	}
+
 	return a.processor.ConsumeEvents(a.handleEvent)
 }
 
@@ -197,6 +262,127 @@ func (a *Aggregator) handleEvent(event *models.TelemetryEvent) error {
 	return nil
 }
 
+// handleHeartbeat records a probe heartbeat as the probe's latest liveness
+// state
+func (a *Aggregator) handleHeartbeat(hb *models.Heartbeat) error {
+	tracer := tracing.GetTracer("aggregator")
+	ctx, span := tracer.Start(a.ctx, "aggregator.processHeartbeat")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("event.client_id", hb.ClientID),
+		attribute.String("probe.version", hb.ProbeVersion),
+	)
+
+	record := &database.ProbeHeartbeat{
+		ClientID:        hb.ClientID,
+		ProbeVersion:    hb.ProbeVersion,
+		ConfigVersion:   hb.ConfigVersion,
+		UptimeSeconds:   hb.UptimeSeconds,
+		IntervalSeconds: hb.IntervalSeconds,
+		Targets:         hb.Targets,
+		QueueDepth:      hb.QueueDepth,
+		DroppedEvents:   hb.DroppedEvents,
+		Hostname:        hb.Host.Hostname,
+		OS:              hb.Host.OS,
+		Arch:            hb.Host.Arch,
+		NumCPU:          hb.Host.NumCPU,
+		GoVersion:       hb.Host.GoVersion,
+		LastSeenAt:      hb.GetTimestamp(),
+	}
+	if err := a.heartbeatsRepo.UpsertHeartbeat(ctx, record); err != nil {
+		heartbeatsProcessedTotal.WithLabelValues("error").Inc()
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	heartbeatsProcessedTotal.WithLabelValues("success").Inc()
+	return nil
+}
+
+// handlePathTrace stores a path trace, flagging it when the path differs
+// from the previous comparable trace of the same client and target
+func (a *Aggregator) handlePathTrace(trace *models.PathTraceEvent) error {
+	tracer := tracing.GetTracer("aggregator")
+	ctx, span := tracer.Start(a.ctx, "aggregator.processPathTrace")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("event.id", trace.EventID),
+		attribute.String("event.client_id", trace.ClientID),
+		attribute.String("event.target", trace.Target),
+		attribute.Int("path.hops", len(trace.Hops)),
+	)
+
+	hops, err := json.Marshal(trace.Hops)
+	if err != nil {
+		pathTracesProcessedTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to marshal hops: %w", err)
+	}
+
+	previous, err := a.pathTracesRepo.GetLatestPathTrace(ctx, trace.ClientID, trace.Target,
+		trace.AddressFamily, trace.Protocol, trace.Method, trace.GetTimestamp())
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		pathTracesProcessedTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	changed := false
+	if previous != nil {
+		prevTrace := &models.PathTraceEvent{Reached: previous.Reached}
+		if err := json.Unmarshal(previous.Hops, &prevTrace.Hops); err != nil {
+			log.Printf("Warning: failed to decode hops of path trace %s: %v", previous.EventID, err)
+		} else {
+			changed = models.PathChanged(prevTrace, trace)
+		}
+	}
+
+	record := &database.PathTrace{
+		EventID:       trace.EventID,
+		ClientID:      trace.ClientID,
+		Target:        trace.Target,
+		AddressFamily: trace.AddressFamily,
+		Protocol:      trace.Protocol,
+		Port:          trace.Port,
+		Method:        trace.Method,
+		Trigger:       trace.Trigger,
+		Reached:       trace.Reached,
+		HopCount:      len(trace.Hops),
+		Hops:          hops,
+		PathSignature: models.PathSignature(trace.Hops),
+		PathChanged:   changed,
+		DurationMs:    trace.DurationMs,
+		Ts:            trace.GetTimestamp(),
+	}
+	if trace.DestinationIP != "" {
+		record.DestinationIP = &trace.DestinationIP
+	}
+
+	inserted, err := a.pathTracesRepo.InsertPathTrace(ctx, record)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		pathTracesProcessedTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	if !inserted {
+		pathTracesProcessedTotal.WithLabelValues("duplicate").Inc()
+		return nil
+	}
+
+	pathTracesProcessedTotal.WithLabelValues("success").Inc()
+	if changed {
+		pathChangesTotal.Inc()
+		tracing.AddSpanEvent(ctx, "path.changed")
+		log.Printf("Path change detected for %s (client: %s): %s -> %s",
+			trace.Target, trace.ClientID, previous.PathSignature, record.PathSignature)
+	}
+
+	log.Printf("Stored path trace %s (client: %s, target: %s, hops: %d, trigger: %s)",
+		trace.EventID, trace.ClientID, trace.Target, len(trace.Hops), trace.Trigger)
+	return nil
+}
+
 func (a *Aggregator) processEventWithDedup(ctx context.Context, event *models.TelemetryEvent) error {
 	// Track processing delay if recv_ts_ms is available
 	if event.RecvTimestampMs != nil && *event.RecvTimestampMs > 0 {
@@ -246,7 +432,7 @@ func (a *Aggregator) processEventWithDedup(ctx context.Context, event *models.Te
 
 		windowStartMs := event.GetWindowStartMs()
 		windowStartTime := time.UnixMilli(windowStartMs)
-		aggregatorKey := getAggregatorKey(event.ClientID, event.Target, windowStartMs)
+		aggregatorKey := getAggregatorKey(event.ClientID, event.Target, event.NetworkContext.AddressFamily, event.GetCheckType(), windowStartMs)
 
 		// Add window attributes to span
 		tracing.AddSpanAttributes(ctx,
@@ -260,6 +446,8 @@ func (a *Aggregator) processEventWithDedup(ctx context.Context, event *models.Te
 			key := models.AggregateKey{
 				ClientID:      event.ClientID,
 				Target:        event.Target,
+				AddressFamily: event.NetworkContext.AddressFamily,
+				CheckType:     event.GetCheckType(),
 				WindowStartTs: windowStartTime,
 			}
 			aggregator = models.NewInMemoryAggregator(key)
@@ -297,11 +485,29 @@ func (a *Aggregator) processEventWithDedup(ctx context.Context, event *models.Te
 		}
 	} else {
 		eventsProcessedTotal.WithLabelValues("success").Inc()
+		a.recordClockSkew(ctx, event)
 	}
 
 	return nil
 }
 
+// recordClockSkew adds the skew ingest attributed to an event to the
+// client's statistics. Failures are logged rather than returned so the event
+// is not redelivered and counted twice.
+func (a *Aggregator) recordClockSkew(ctx context.Context, event *models.TelemetryEvent) {
+	if a.clockSkewRepo == nil || event.ClockSkewMs == nil {
+		return
+	}
+	seenAt := time.Now()
+	if event.RecvTimestampMs != nil {
+		seenAt = time.UnixMilli(*event.RecvTimestampMs)
+	}
+	corrected := event.OriginalTimestampMs != nil
+	if err := a.clockSkewRepo.RecordClockSkew(ctx, event.ClientID, *event.ClockSkewMs, event.ClockSkewed, corrected, seenAt); err != nil {
+		log.Printf("Failed to record clock skew for client %s: %v", event.ClientID, err)
+	}
+}
+
 func (a *Aggregator) periodicWindowFlusher() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -374,14 +580,25 @@ func (a *Aggregator) flushWindow(windowStartMs int64) {
 	for _, aggregator := range aggregatorsToFlush {
 		windowedAgg := aggregator.ToWindowedAggregate()
 
-		// Run diagnosis engine to determine issue type
+		// Run diagnosis engine to determine issue type, unless the diagnoser
+		// service does it
 		// Requirements: 5.1, 5.2, 5.3, 5.4, 5.5
-		diagnosisLabel := a.runDiagnosis(ctx, windowedAgg)
+		var diagnosisLabel string
+		var result *diagnosis.Result
+		if a.windowNotifier == nil {
+			result = a.runDiagnosis(ctx, windowedAgg)
+		}
 
 		dbAgg := convertToDBAggregate(windowedAgg)
 		// Convert string to *string for diagnosis_label
-		if diagnosisLabel != "" {
+		if result != nil && result.Label != diagnosis.DiagnosisNone {
+			diagnosisLabel = string(result.Label)
 			dbAgg.DiagnosisLabel = &diagnosisLabel
+			details, err := json.Marshal(result)
+			if err != nil {
+				log.Printf("Warning: Failed to marshal diagnosis details: %v", err)
+			}
+			dbAgg.DiagnosisDetails = details
 		}
 
 		if err := a.aggregatesRepo.UpsertAggregate(ctx, dbAgg); err != nil {
@@ -391,12 +608,57 @@ func (a *Aggregator) flushWindow(windowStartMs int64) {
 			continue
 		}
 
-		log.Printf("Flushed aggregate: client=%s, target=%s, window=%s, total=%d, success=%d, error=%d, diagnosis=%s",
-			windowedAgg.ClientID, windowedAgg.Target, windowedAgg.WindowStartTs.Format(time.RFC3339),
+		if customMetrics := convertToDBCustomMetrics(windowedAgg); len(customMetrics) > 0 {
+			if err := a.aggregatesRepo.UpsertCustomMetrics(ctx, customMetrics); err != nil {
+				status = "error"
+				log.Printf("Failed to upsert custom metrics for client %s, target %s, window %s: %v",
+					windowedAgg.ClientID, windowedAgg.Target, windowedAgg.WindowStartTs.Format(time.RFC3339), err)
+			}
+		}
+
+		a.notifyWindowFlushed(windowedAgg)
+
+		log.Printf("Flushed aggregate: client=%s, target=%s, family=%s, check=%s, window=%s, total=%d, success=%d, error=%d, diagnosis=%s",
+			windowedAgg.ClientID, windowedAgg.Target, windowedAgg.AddressFamily, windowedAgg.CheckType, windowedAgg.WindowStartTs.Format(time.RFC3339),
 			windowedAgg.CountTotal, windowedAgg.CountSuccess, windowedAgg.CountError, diagnosisLabel)
 	}
 }
 
+// lateFlushSlack is how long after its normal flush time a window may be
+// flushed before the flush is attributed to late events
+const lateFlushSlack = 30 * time.Second
+
+// notifyWindowFlushed tells the diagnoser service about a written window.
+// Failures are logged; the window is diagnosed again if it is flushed again.
+func (a *Aggregator) notifyWindowFlushed(agg *models.WindowedAggregate) {
+	if a.windowNotifier == nil {
+		return
+	}
+
+	now := time.Now()
+	normalFlush := agg.WindowStartTs.Add(a.windowSize + a.flushDelay)
+	notification := &models.WindowFlushed{
+		ClientID:      agg.ClientID,
+		Target:        agg.Target,
+		AddressFamily: agg.AddressFamily,
+		CheckType:     agg.CheckType,
+		WindowStartTs: agg.WindowStartTs,
+		FlushedAt:     now,
+		Late:          now.Sub(normalFlush) > lateFlushSlack,
+	}
+	if err := a.windowNotifier.PublishWindowFlushed(notification); err != nil {
+		windowNotificationsTotal.WithLabelValues("error").Inc()
+		log.Printf("Failed to publish flushed window for client %s, target %s, window %s: %v",
+			agg.ClientID, agg.Target, agg.WindowStartTs.Format(time.RFC3339), err)
+		return
+	}
+	if notification.Late {
+		windowNotificationsTotal.WithLabelValues("late").Inc()
+	} else {
+		windowNotificationsTotal.WithLabelValues("success").Inc()
+	}
+}
+
 func (a *Aggregator) flushAllWindows() {
 	a.mu.RLock()
 	var allWindowStarts []int64
@@ -412,20 +674,21 @@ func (a *Aggregator) flushAllWindows() {
 }
 
 // runDiagnosis performs automated diagnosis on the current window metrics
-// Returns a diagnosis label based on explicit thresholds and historical baseline
+// Returns the diagnosis result based on explicit thresholds and historical
+// baseline, or nil if there is not enough history
 //
 // Requirements: 5.1, 5.2, 5.3, 5.4, 5.5
-func (a *Aggregator) runDiagnosis(ctx context.Context, agg *models.WindowedAggregate) string {
+func (a *Aggregator) runDiagnosis(ctx context.Context, agg *models.WindowedAggregate) *diagnosis.Result {
 	// Fetch last 10 windows for baseline calculation
-	historicalAggs, err := a.repository.GetHistoricalAggregates(ctx, agg.ClientID, agg.Target, 10)
+	historicalAggs, err := a.repository.GetHistoricalAggregates(ctx, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType, 10)
 	if err != nil {
 		log.Printf("Warning: Failed to fetch historical aggregates for diagnosis: %v", err)
-		return ""
+		return nil
 	}
 
 	// Need at least 3 historical windows for meaningful baseline
 	if len(historicalAggs) < 3 {
-		return ""
+		return nil
 	}
 
 	// Convert historical aggregates to diagnosis.WindowMetrics
@@ -445,6 +708,11 @@ func (a *Aggregator) runDiagnosis(ctx context.Context, agg *models.WindowedAggre
 			TotalLatencyP95: getFloatValue(h.DNSP95) + getFloatValue(h.TCPP95) + getFloatValue(h.TLSP95) + getFloatValue(h.TTFBP95),
 			ThroughputP50:   getFloatValue(h.ThroughputP50),
 			CountSuccess:    int(h.CountSuccess),
+			CountTotal:      int(h.CountTotal),
+			DNSErrors:       int(h.DNSErrorCount),
+			TCPErrors:       int(h.TCPErrorCount),
+			TLSErrors:       int(h.TLSErrorCount),
+			HTTPErrors:      int(h.HTTPErrorCount),
 		}
 		historicalWindows = append(historicalWindows, window)
 	}
@@ -462,11 +730,15 @@ func (a *Aggregator) runDiagnosis(ctx context.Context, agg *models.WindowedAggre
 		TotalLatencyP95: agg.DNSP95 + agg.TCPP95 + agg.TLSP95 + agg.TTFBP95,
 		ThroughputP50:   agg.ThroughputP50,
 		CountSuccess:    int(agg.CountSuccess),
+		CountTotal:      int(agg.CountTotal),
+		DNSErrors:       int(agg.ErrorStageCounts[models.ErrorStageDNS]),
+		TCPErrors:       int(agg.ErrorStageCounts[models.ErrorStageTCP]),
+		TLSErrors:       int(agg.ErrorStageCounts[models.ErrorStageTLS]),
+		HTTPErrors:      int(agg.ErrorStageCounts[models.ErrorStageHTTP]),
 	}
 
 	// Run diagnosis
-	label := diagnosis.Diagnose(currentWindow, baseline)
-	return string(label)
+	return diagnosis.Evaluate(currentWindow, baseline)
 }
 
 // Helper function to safely extract float value from *float64
@@ -477,8 +749,8 @@ func getFloatValue(ptr *float64) float64 {
 	return *ptr
 }
 
-func getAggregatorKey(clientID, target string, windowStartMs int64) string {
-	return fmt.Sprintf("%s:%s:%d", clientID, target, windowStartMs)
+func getAggregatorKey(clientID, target, addressFamily, checkType string, windowStartMs int64) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%d", clientID, target, addressFamily, checkType, windowStartMs)
 }
 
 func convertToDBAggregate(agg *models.WindowedAggregate) *database.WindowedAggregate {
@@ -489,18 +761,22 @@ func convertToDBAggregate(agg *models.WindowedAggregate) *database.WindowedAggre
 		return &f
 	}
 
-	return &database.WindowedAggregate{
+	dbAgg := &database.WindowedAggregate{
 		ClientID:             agg.ClientID,
 		Target:               agg.Target,
+		AddressFamily:        agg.AddressFamily,
+		CheckType:            agg.CheckType,
 		WindowStartTs:        agg.WindowStartTs,
 		CountTotal:           agg.CountTotal,
 		CountSuccess:         agg.CountSuccess,
 		CountError:           agg.CountError,
-		DNSErrorCount:        agg.ErrorStageCounts["DNS"],
-		TCPErrorCount:        agg.ErrorStageCounts["TCP"],
-		TLSErrorCount:        agg.ErrorStageCounts["TLS"],
-		HTTPErrorCount:       agg.ErrorStageCounts["HTTP"],
-		ThroughputErrorCount: agg.ErrorStageCounts["throughput"],
+		DNSErrorCount:        agg.ErrorStageCounts[models.ErrorStageDNS],
+		TCPErrorCount:        agg.ErrorStageCounts[models.ErrorStageTCP],
+		TLSErrorCount:        agg.ErrorStageCounts[models.ErrorStageTLS],
+		HTTPErrorCount:       agg.ErrorStageCounts[models.ErrorStageHTTP],
+		ThroughputErrorCount: agg.ErrorStageCounts[models.ErrorStageThroughput],
+		AssertionErrorCount:  agg.ErrorStageCounts[models.ErrorStageAssertion],
+		UDPErrorCount:        agg.ErrorStageCounts[models.ErrorStageUDP],
 		DNSP50:               floatPtr(agg.DNSP50),
 		DNSP95:               floatPtr(agg.DNSP95),
 		TCPP50:               floatPtr(agg.TCPP50),
@@ -511,9 +787,71 @@ func convertToDBAggregate(agg *models.WindowedAggregate) *database.WindowedAggre
 		TTFBP95:              floatPtr(agg.TTFBP95),
 		ThroughputP50:        floatPtr(agg.ThroughputP50),
 		ThroughputP95:        floatPtr(agg.ThroughputP95),
+		UploadP50:            floatPtr(agg.UploadP50),
+		UploadP95:            floatPtr(agg.UploadP95),
+		ProxyConnectP50:      floatPtr(agg.ProxyConnectP50),
+		ProxyConnectP95:      floatPtr(agg.ProxyConnectP95),
+		ProxyErrorCount:      agg.ErrorStageCounts[models.ErrorStageProxy],
+		TimeoutErrorCount:    agg.CountTimeout,
+		PacketsSent:          agg.PacketsSent,
+		PacketsLost:          agg.PacketsLost,
+		ReorderedCount:       agg.ReorderedCount,
+		RTTP50:               floatPtr(agg.RTTP50),
+		RTTP95:               floatPtr(agg.RTTP95),
+		JitterP50:            floatPtr(agg.JitterP50),
+		JitterP95:            floatPtr(agg.JitterP95),
+		ASN:                  agg.ASN,
+		ASOrg:                agg.ASOrg,
+		UserLabel:            agg.UserLabel,
 		DiagnosisLabel:       nil,
 		UpdatedAt:            time.Now(),
 	}
+
+	if len(agg.TimeoutStageCounts) > 0 {
+		if counts, err := json.Marshal(agg.TimeoutStageCounts); err == nil {
+			dbAgg.TimeoutStageCounts = counts
+		}
+	}
+
+	// Zero loss is a real measurement whenever echo packets were sent
+	if agg.PacketsSent > 0 {
+		lossRate := agg.LossRate
+		dbAgg.LossRate = &lossRate
+	}
+
+	return dbAgg
+}
+
+// convertToDBCustomMetrics converts the custom metric statistics of an
+// aggregate to database rows, ordered by metric name
+func convertToDBCustomMetrics(agg *models.WindowedAggregate) []*database.CustomMetricAggregate {
+	names := make([]string, 0, len(agg.CustomMetrics))
+	for name := range agg.CustomMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	rows := make([]*database.CustomMetricAggregate, 0, len(names))
+	for _, name := range names {
+		stats := agg.CustomMetrics[name]
+		rows = append(rows, &database.CustomMetricAggregate{
+			ClientID:      agg.ClientID,
+			Target:        agg.Target,
+			AddressFamily: agg.AddressFamily,
+			CheckType:     agg.CheckType,
+			WindowStartTs: agg.WindowStartTs,
+			Metric:        name,
+			SampleCount:   stats.Count,
+			MinValue:      stats.Min,
+			MaxValue:      stats.Max,
+			MeanValue:     stats.Mean,
+			P50:           stats.P50,
+			P95:           stats.P95,
+			UpdatedAt:     now,
+		})
+	}
+	return rows
 }
 
 func main() {
@@ -557,6 +895,9 @@ func main() {
 
 	eventsSeenRepo := database.NewEventsSeenRepository(dbConn)
 	aggregatesRepo := database.NewAggregatesRepository(dbConn)
+	pathTracesRepo := database.NewPathTracesRepository(dbConn)
+	clockSkewRepo := database.NewClockSkewRepository(dbConn)
+	heartbeatsRepo := database.NewHeartbeatsRepository(dbConn)
 
 	natsConfig := queue.DefaultNATSConfig()
 	natsConfig.URL = *natsURL
@@ -576,12 +917,20 @@ func main() {
 		processor,
 		eventsSeenRepo,
 		aggregatesRepo,
+		pathTracesRepo,
+		clockSkewRepo,
+		heartbeatsRepo,
 		repo,
 		*windowSize,
 		*flushDelay,
 		*lateTolerance,
 	)
 
+	if *diagnoser {
+		aggregator.windowNotifier = processor
+		log.Printf("Publishing flushed windows for the diagnoser service")
+	}
+
 	// Start metrics server
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
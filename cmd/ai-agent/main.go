@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +16,7 @@ import (
 	"github.com/rahulgh33/wirescope/internal/admin"
 	"github.com/rahulgh33/wirescope/internal/ai"
 	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/metrics"
 	"github.com/rahulgh33/wirescope/internal/websocket"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
@@ -101,6 +103,15 @@ func (s *AIAgentServer) Start() error {
 	adminService := admin.NewService(adminConfig, s.repo)
 	adminService.RegisterRoutes(router)
 
+	// Probe online/offline transitions go to dashboard WebSocket subscribers
+	// through the broadcast endpoint below
+	broadcaster := metrics.NewWebSocketBroadcaster(s.config.BroadcastURL)
+	adminService.SetBroadcaster(broadcaster)
+	livenessCtx, stopLiveness := context.WithCancel(context.Background())
+	defer stopLiveness()
+	defer broadcaster.Close()
+	adminService.StartLivenessMonitor(livenessCtx, s.config.ProbeLivenessInterval)
+
 	// WebSocket endpoint for real-time metrics
 	wsHandler := websocket.NewHandler(s.wsHub)
 	router.HandleFunc("/api/v1/ws/metrics", wsHandler.ServeHTTP)
@@ -311,11 +322,22 @@ type Config struct {
 	Database      *database.ConnectionConfig
 	AIAgent       ai.AgentConfig
 	SessionMaxAge time.Duration
+
+	// BroadcastURL is the WebSocket broadcast base URL; ProbeLivenessInterval
+	// is how often probe heartbeats are checked
+	BroadcastURL          string
+	ProbeLivenessInterval time.Duration
 }
 
 func loadConfig() Config {
+	serverAddr := getEnv("SERVER_ADDR", ":8080")
+	livenessInterval, err := time.ParseDuration(getEnv("PROBE_LIVENESS_INTERVAL", "30s"))
+	if err != nil || livenessInterval <= 0 {
+		log.Fatalf("Invalid PROBE_LIVENESS_INTERVAL: %q", os.Getenv("PROBE_LIVENESS_INTERVAL"))
+	}
+
 	return Config{
-		ServerAddr: getEnv("SERVER_ADDR", ":8080"),
+		ServerAddr: serverAddr,
 		Database: &database.ConnectionConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     5432,
@@ -333,8 +355,22 @@ func loadConfig() Config {
 			MaxContextTokens: 8000,
 			EnableCaching:    true,
 		},
-		SessionMaxAge: 24 * time.Hour,
+		SessionMaxAge:         24 * time.Hour,
+		BroadcastURL:          getEnv("BROADCAST_URL", localBroadcastURL(serverAddr)),
+		ProbeLivenessInterval: livenessInterval,
+	}
+}
+
+// localBroadcastURL is this server's own WebSocket broadcast base URL
+func localBroadcastURL(serverAddr string) string {
+	host, port, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		return "http://localhost:8080/api/v1/ws"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
 	}
+	return "http://" + net.JoinHostPort(host, port) + "/api/v1/ws"
 }
 
 func getEnv(key, defaultValue string) string {
@@ -198,11 +198,85 @@ func cleanupAggregates(db *sql.DB, cfg *Config) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
+	// Custom metric statistics share the agg_1m windows and retention
+	customResult, err := tx.ExecContext(ctx, "DELETE FROM agg_1m_custom_metrics WHERE window_start_ts < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom metric records: %w", err)
+	}
+	customRows, err := customResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// Diagnosis results and correlated incidents are kept as long as the
+	// windows they describe
+	diagnosisResult, err := tx.ExecContext(ctx, "DELETE FROM diagnosis_history WHERE window_start_ts < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete diagnosis history records: %w", err)
+	}
+	diagnosisRows, err := diagnosisResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// Baselines of series that stopped reporting are no longer updated
+	baselineResult, err := tx.ExecContext(ctx, "DELETE FROM diagnosis_baselines WHERE updated_at < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete diagnosis baselines: %w", err)
+	}
+	baselineRows, err := baselineResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// Change-point states are kept like baselines, level shifts like windows
+	if _, err := tx.ExecContext(ctx, "DELETE FROM change_point_states WHERE updated_at < $1", cutoffDate); err != nil {
+		return fmt.Errorf("failed to delete change-point states: %w", err)
+	}
+	shiftResult, err := tx.ExecContext(ctx, "DELETE FROM level_shifts WHERE detected_at < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete level shifts: %w", err)
+	}
+	shiftRows, err := shiftResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	incidentResult, err := tx.ExecContext(ctx, "DELETE FROM correlated_incidents WHERE window_start_ts < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete correlated incidents: %w", err)
+	}
+	incidentRows, err := incidentResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// Open incidents are kept however old they are
+	alertResult, err := tx.ExecContext(ctx, "DELETE FROM alerts WHERE resolved_at < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete resolved alerts: %w", err)
+	}
+	alertRows, err := alertResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// Recurring silences without an end are kept
+	silenceResult, err := tx.ExecContext(ctx, "DELETE FROM silences WHERE ends_at < $1", cutoffDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete ended silences: %w", err)
+	}
+	silenceRows, err := silenceResult.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	log.Printf("Successfully deleted %d records from agg_1m", rowsAffected)
+	log.Printf("Successfully deleted %d records from agg_1m, %d from agg_1m_custom_metrics, %d from diagnosis_history, %d from diagnosis_baselines, %d from level_shifts, %d from correlated_incidents, %d resolved alerts and %d ended silences",
+		rowsAffected, customRows, diagnosisRows, baselineRows, shiftRows, incidentRows, alertRows, silenceRows)
 
 	// Update table statistics
 	if _, err := db.Exec("ANALYZE agg_1m"); err != nil {
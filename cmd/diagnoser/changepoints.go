@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+)
+
+// levelShiftRuleWindow is how long after its detection a level shift is
+// available to the alert rules as <metric>_shift
+const levelShiftRuleWindow = 24 * time.Hour
+
+var levelShiftsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "diagnoser_level_shifts_total",
+		Help: "Total number of level shifts detected, by metric and direction",
+	},
+	[]string{"metric", "direction"}, // direction: up, down
+)
+
+func init() {
+	prometheus.MustRegister(levelShiftsTotal)
+}
+
+// loadChangePoints loads a series' change-point detection state. A state
+// that does not exist yet is seeded from the stored windows preceding agg,
+// except those inside maintenance windows.
+func (d *Diagnoser) loadChangePoints(ctx context.Context, agg *database.WindowedAggregate) (*diagnosis.ChangePointState, error) {
+	rec, err := d.repo.GetChangePointState(ctx, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		state := diagnosis.NewChangePointState()
+		if err := json.Unmarshal(rec.State, state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal change-point state: %w", err)
+		}
+		return state, nil
+	}
+
+	state := diagnosis.NewChangePointState()
+	history, err := d.repo.GetAggregatesBefore(ctx, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType, agg.WindowStartTs, d.changePoints.Warmup)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Maintenance {
+			continue
+		}
+		state.Update(toWindowMetrics(&history[i]), *d.changePoints)
+	}
+	return state, nil
+}
+
+// changePointRecord encodes a change-point detection state for persisting
+func changePointRecord(agg *database.WindowedAggregate, state *diagnosis.ChangePointState) (*database.ChangePointStateRecord, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal change-point state: %w", err)
+	}
+	return &database.ChangePointStateRecord{
+		ClientID:      agg.ClientID,
+		Target:        agg.Target,
+		AddressFamily: agg.AddressFamily,
+		CheckType:     agg.CheckType,
+		State:         data,
+		LastWindowTs:  state.LastWindowTs,
+		UpdatedAt:     time.Now(),
+	}, nil
+}
+
+// levelShiftRecord converts a detected level shift of a series for storing
+func levelShiftRecord(agg *database.WindowedAggregate, shift diagnosis.LevelShift) database.LevelShiftRecord {
+	return database.LevelShiftRecord{
+		ClientID:      agg.ClientID,
+		Target:        agg.Target,
+		AddressFamily: agg.AddressFamily,
+		CheckType:     agg.CheckType,
+		Metric:        shift.Metric,
+		Direction:     shift.Direction,
+		Before:        shift.Before,
+		After:         shift.After,
+		Change:        shift.Change,
+		StartedAt:     shift.StartedAt,
+		DetectedAt:    shift.DetectedAt,
+		Windows:       shift.Windows,
+	}
+}
+
+// publishLevelShifts counts, logs and broadcasts the level shifts recorded
+// for a window. Shifts another instance recorded first are skipped.
+func (d *Diagnoser) publishLevelShifts(ctx context.Context, shifts []database.LevelShiftRecord) {
+	for i := range shifts {
+		shift := &shifts[i]
+		if shift.ID == 0 {
+			continue
+		}
+		levelShiftsTotal.WithLabelValues(shift.Metric, shift.Direction).Inc()
+		log.Printf("Level shift: client=%s, target=%s, metric=%s, %.1f -> %.1f (%+.0f%%) since %s",
+			shift.ClientID, shift.Target, shift.Metric, shift.Before, shift.After, shift.Change*100,
+			shift.StartedAt.Format(time.RFC3339))
+		if d.broadcaster != nil {
+			d.broadcaster.Broadcast(diagnosticsChannel, levelShiftBroadcast(shift))
+		}
+	}
+}
+
+// levelShiftBroadcast is the WebSocket message for a level shift
+func levelShiftBroadcast(shift *database.LevelShiftRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"type":           "level_shift",
+		"id":             shift.ID,
+		"client_id":      shift.ClientID,
+		"target":         shift.Target,
+		"address_family": shift.AddressFamily,
+		"check_type":     shift.CheckType,
+		"metric":         shift.Metric,
+		"direction":      shift.Direction,
+		"before":         shift.Before,
+		"after":          shift.After,
+		"change":         shift.Change,
+		"started_at":     shift.StartedAt.UTC().Format(time.RFC3339),
+		"detected_at":    shift.DetectedAt.UTC().Format(time.RFC3339),
+		"windows":        shift.Windows,
+		"severity":       "warning",
+		"message": fmt.Sprintf("%s of %s on %s shifted %s by %.0f%% (%.1f -> %.1f)",
+			shift.Metric, shift.ClientID, shift.Target, shift.Direction, math.Abs(shift.Change)*100, shift.Before, shift.After),
+	}
+}
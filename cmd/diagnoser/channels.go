@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rahulgh33/wirescope/internal/notify"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// fileChannel is a notification channel in the -notification-channels-file
+type fileChannel struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Settings notify.Settings `json:"settings"`
+}
+
+// loadChannelRegistry registers the notification channels of the JSON file
+// at path, an array of channels, in a plugin registry. It returns nil when
+// path is empty. File channels use the default templates, and a channel
+// managed through the admin API takes precedence over one of the same name.
+func loadChannelRegistry(path string) (*plugin.Registry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification channels file: %w", err)
+	}
+
+	// Templates and other unknown fields are rejected rather than ignored
+	var channels []fileChannel
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&channels); err != nil {
+		return nil, fmt.Errorf("failed to parse notification channels file: %w", err)
+	}
+
+	registry := plugin.NewRegistry()
+	for i, c := range channels {
+		cfg := notify.ChannelConfig{Name: c.Name, Type: c.Type, Settings: c.Settings}
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("notification channel %d: %w", i, err)
+		}
+		if _, exists := registry.GetChannel(cfg.Name); exists {
+			return nil, fmt.Errorf("duplicate notification channel name: %s", cfg.Name)
+		}
+		channel, err := notify.NewChannel(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s: %w", cfg.Name, err)
+		}
+		registry.RegisterChannel(channel)
+	}
+	return registry, nil
+}
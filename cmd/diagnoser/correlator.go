@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/tracing"
+)
+
+// correlationInterval is how often the correlator checks for windows due
+var correlationInterval = 5 * time.Second
+
+// Prometheus metrics
+var (
+	correlatedWindowsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_correlated_windows_total",
+			Help: "Total number of windows correlated across clients, by status",
+		},
+		[]string{"status"}, // correlated, error
+	)
+
+	correlatedIncidentsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_correlated_incidents_total",
+			Help: "Total number of new or changed correlated incidents, by scope",
+		},
+		[]string{"scope"}, // target-wide, client-wide, localized
+	)
+)
+
+func init() {
+	prometheus.MustRegister(correlatedWindowsTotal)
+	prometheus.MustRegister(correlatedIncidentsTotal)
+}
+
+// Correlator groups the diagnoses of each window across clients into
+// target-wide, client-wide and localized incidents. A window is correlated
+// a delay after its first series was diagnosed, so that the other series of
+// the window, possibly diagnosed by other instances, are included. A window
+// re-diagnosed after late events is correlated again; only new or changed
+// incidents are published, so instances correlating the same window do not
+// publish it twice.
+type Correlator struct {
+	repo        *database.DiagnosisRepository
+	publisher   models.DiagnosisProcessor
+	broadcaster metrics.Broadcaster
+	config      diagnosis.CorrelationConfig
+	delay       time.Duration
+
+	// tracker manages incidents from the correlated windows; nil disables
+	// incidents
+	tracker *IncidentTracker
+
+	// pending maps window starts to when they are due for correlation
+	mu      sync.Mutex
+	pending map[time.Time]time.Time
+}
+
+// NewCorrelator creates a correlator
+func NewCorrelator(repo *database.DiagnosisRepository, publisher models.DiagnosisProcessor, broadcaster metrics.Broadcaster, config diagnosis.CorrelationConfig, delay time.Duration, tracker *IncidentTracker) *Correlator {
+	return &Correlator{
+		repo:        repo,
+		publisher:   publisher,
+		broadcaster: broadcaster,
+		config:      config,
+		delay:       delay,
+		tracker:     tracker,
+		pending:     make(map[time.Time]time.Time),
+	}
+}
+
+// Schedule marks a window for correlation after the delay. A window already
+// pending keeps its due time, so series diagnosed together are correlated
+// together.
+func (c *Correlator) Schedule(windowStart time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[windowStart]; !ok {
+		c.pending[windowStart] = time.Now().Add(c.delay)
+	}
+}
+
+// Run correlates windows as they become due until ctx is cancelled
+func (c *Correlator) Run(ctx context.Context) {
+	ticker := time.NewTicker(correlationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, windowStart := range c.due(now) {
+				if err := c.correlateWindow(ctx, windowStart); err != nil {
+					correlatedWindowsTotal.WithLabelValues("error").Inc()
+					log.Printf("Failed to correlate window %s, retrying: %v", windowStart.Format(time.RFC3339), err)
+					c.Schedule(windowStart)
+					continue
+				}
+				correlatedWindowsTotal.WithLabelValues("correlated").Inc()
+			}
+		}
+	}
+}
+
+// due removes and returns the windows due at now, oldest first
+func (c *Correlator) due(now time.Time) []time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var windows []time.Time
+	for windowStart, at := range c.pending {
+		if !at.After(now) {
+			windows = append(windows, windowStart)
+			delete(c.pending, windowStart)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Before(windows[j]) })
+	return windows
+}
+
+// correlateWindow correlates the stored diagnoses of a window, saves the
+// incidents, publishes those that are new or changed and applies the window
+// to the incident lifecycle
+func (c *Correlator) correlateWindow(ctx context.Context, windowStart time.Time) error {
+	tracer := tracing.GetTracer("diagnoser")
+	ctx, span := tracer.Start(ctx, "diagnoser.correlateWindow")
+	defer span.End()
+	span.SetAttributes(attribute.String("window.start_time", windowStart.Format(time.RFC3339)))
+
+	rows, err := c.repo.GetWindowSeries(ctx, windowStart)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	series := make([]diagnosis.SeriesDiagnosis, 0, len(rows))
+	for _, row := range rows {
+		series = append(series, diagnosis.SeriesDiagnosis{
+			ClientID:      row.ClientID,
+			Target:        row.Target,
+			AddressFamily: row.AddressFamily,
+			CheckType:     row.CheckType,
+			Label:         diagnosis.DiagnosisLabel(stringValue(row.DiagnosisLabel)),
+			ASN:           row.ASN,
+			UserLabel:     row.UserLabel,
+		})
+	}
+	incidents := diagnosis.Correlate(series, c.config)
+
+	records := make([]database.CorrelatedIncidentRecord, 0, len(incidents))
+	for _, inc := range incidents {
+		rec, err := incidentRecord(windowStart, inc)
+		if err != nil {
+			return err
+		}
+		records = append(records, *rec)
+	}
+
+	changed, err := c.repo.SaveCorrelatedIncidents(ctx, windowStart, records)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+	span.SetAttributes(
+		attribute.Int("series", len(series)),
+		attribute.Int("incidents", len(incidents)),
+		attribute.Int("incidents.changed", len(changed)),
+	)
+
+	byKey := make(map[string]diagnosis.Incident, len(incidents))
+	for _, inc := range incidents {
+		byKey[string(inc.Scope)+"|"+inc.Key] = inc
+	}
+	for _, rec := range changed {
+		inc := byKey[rec.Scope+"|"+rec.Key]
+		event := &models.CorrelatedIncident{
+			ID:            rec.ID,
+			WindowStartTs: rec.WindowStartTs,
+			Scope:         rec.Scope,
+			Key:           rec.Key,
+			Label:         rec.Label,
+			Labels:        make(map[string]int, len(inc.Labels)),
+			Clients:       inc.Clients,
+			Targets:       inc.Targets,
+			Affected:      rec.Affected,
+			Observed:      rec.Observed,
+			Revision:      rec.Revision,
+			CorrelatedAt:  rec.UpdatedAt,
+		}
+		for label, count := range inc.Labels {
+			event.Labels[string(label)] = count
+		}
+
+		correlatedIncidentsTotal.WithLabelValues(event.Scope).Inc()
+		log.Printf("Correlated incident: window=%s, scope=%s, key=%s, diagnosis=%s, affected=%d/%d, clients=%d, targets=%d, revision=%d",
+			event.WindowStartTs.Format(time.RFC3339), event.Scope, event.Key, event.Label,
+			event.Affected, event.Observed, len(event.Clients), len(event.Targets), event.Revision)
+		c.publish(ctx, event)
+	}
+
+	if c.tracker != nil {
+		if err := c.tracker.ObserveWindow(ctx, windowStart, incidents); err != nil {
+			tracing.RecordError(ctx, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// incidentRecord encodes an incident for persisting
+func incidentRecord(windowStart time.Time, inc diagnosis.Incident) (*database.CorrelatedIncidentRecord, error) {
+	labels, err := json.Marshal(inc.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal incident labels: %w", err)
+	}
+	clients, err := json.Marshal(inc.Clients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal incident clients: %w", err)
+	}
+	targets, err := json.Marshal(inc.Targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal incident targets: %w", err)
+	}
+	return &database.CorrelatedIncidentRecord{
+		WindowStartTs: windowStart,
+		Scope:         string(inc.Scope),
+		Key:           inc.Key,
+		Label:         string(inc.Label),
+		Labels:        labels,
+		Clients:       clients,
+		Targets:       targets,
+		Affected:      inc.Affected,
+		Observed:      inc.Observed,
+	}, nil
+}
+
+// publish sends a correlated incident to external subscribers on the queue
+// and to WebSocket subscribers. Failures are counted and logged but
+// do not fail the window, whose incidents are already stored.
+func (c *Correlator) publish(ctx context.Context, event *models.CorrelatedIncident) {
+	if c.publisher != nil {
+		if err := c.publisher.PublishCorrelatedIncident(event); err != nil {
+			diagnosisPublishTotal.WithLabelValues("queue", "error").Inc()
+			tracing.RecordError(ctx, err)
+			log.Printf("Failed to publish correlated incident %s %s: %v", event.Scope, event.Key, err)
+		} else {
+			diagnosisPublishTotal.WithLabelValues("queue", "success").Inc()
+		}
+	}
+
+	if c.broadcaster != nil {
+		c.broadcaster.Broadcast(diagnosticsChannel, incidentBroadcast(event))
+	}
+}
+
+// incidentBroadcast is the WebSocket message for a correlated incident
+func incidentBroadcast(event *models.CorrelatedIncident) map[string]interface{} {
+	severity := "warning"
+	if diagnosis.IsErrorDriven(diagnosis.DiagnosisLabel(event.Label)) {
+		severity = "error"
+	}
+
+	return map[string]interface{}{
+		"type":            "correlated_incident",
+		"id":              event.ID,
+		"window_start_ts": event.WindowStartTs.UTC().Format(time.RFC3339),
+		"scope":           event.Scope,
+		"key":             event.Key,
+		"diagnosis":       event.Label,
+		"labels":          event.Labels,
+		"clients":         event.Clients,
+		"targets":         event.Targets,
+		"affected":        event.Affected,
+		"observed":        event.Observed,
+		"revision":        event.Revision,
+		"message":         incidentMessage(event.Scope, event.Label, event.Clients, event.Targets),
+		"severity":        severity,
+		"timestamp":       event.CorrelatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// incidentMessage describes an incident in one line
+func incidentMessage(scope, label string, clients, targets []string) string {
+	switch diagnosis.Scope(scope) {
+	case diagnosis.ScopeTarget:
+		return fmt.Sprintf("%s on %s for %d clients", label, strings.Join(targets, ", "), len(clients))
+	case diagnosis.ScopeClient:
+		return fmt.Sprintf("%s for %s on %d targets", label, strings.Join(clients, ", "), len(targets))
+	default:
+		return fmt.Sprintf("%s for %s on %s", label, strings.Join(clients, ", "), strings.Join(targets, ", "))
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/tracing"
+)
+
+// WebSocket channels diagnoses and incidents are broadcast on
+const (
+	diagnosticsChannel = "diagnostics"
+	incidentsChannel   = "incidents"
+	dashboardChannel   = "dashboard"
+)
+
+// strategyRefreshInterval is how often per-target baseline strategies are
+// reloaded from the database
+const strategyRefreshInterval = time.Minute
+
+// Prometheus metrics
+var (
+	windowsDiagnosedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_windows_total",
+			Help: "Total number of flushed windows handled by the diagnoser",
+		},
+		[]string{"status"}, // diagnosed, rediagnosed, missing, error
+	)
+
+	diagnosesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_diagnoses_total",
+			Help: "Total number of windows diagnosed, by label",
+		},
+		[]string{"label"}, // none for healthy windows
+	)
+
+	diagnosisDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "diagnoser_duration_seconds",
+			Help:    "Time taken to diagnose a window, including database writes",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		},
+	)
+
+	diagnosisPublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_publish_total",
+			Help: "Total number of diagnoses and correlated incidents published, by destination and status",
+		},
+		[]string{"destination", "status"}, // queue, success|error
+	)
+
+	baselineUpdatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnoser_baseline_updates_total",
+			Help: "Total number of baseline updates, by strategy and status",
+		},
+		[]string{"strategy", "status"}, // seeded, updated, skipped, maintenance
+	)
+)
+
+func init() {
+	prometheus.MustRegister(windowsDiagnosedTotal)
+	prometheus.MustRegister(diagnosesTotal)
+	prometheus.MustRegister(diagnosisDuration)
+	prometheus.MustRegister(diagnosisPublishTotal)
+	prometheus.MustRegister(baselineUpdatesTotal)
+}
+
+// Diagnoser diagnoses aggregate windows as the aggregator flushes them
+type Diagnoser struct {
+	repo      *database.DiagnosisRepository
+	publisher models.DiagnosisProcessor
+
+	// baselineConfig parameterizes all baselines; defaultStrategy is used
+	// for targets without a strategy of their own
+	baselineConfig  diagnosis.BaselineConfig
+	defaultStrategy diagnosis.BaselineStrategy
+
+	// strategies caches the per-target baseline strategies
+	strategiesMu     sync.Mutex
+	strategies       map[string]diagnosis.BaselineStrategy
+	strategiesLoaded time.Time
+
+	// broadcaster sends diagnoses to WebSocket subscribers; nil disables
+	// broadcasting
+	broadcaster metrics.Broadcaster
+
+	// correlator correlates the windows diagnosed; nil disables correlation
+	correlator *Correlator
+
+	// rules evaluates the alert rules on the windows diagnosed; nil
+	// disables alert rules
+	rules *RuleEvaluator
+
+	// silences matches windows against the silences; nil disables them
+	silences *SilenceMatcher
+
+	// changePoints parameterizes level shift detection; nil disables it
+	changePoints *diagnosis.ChangePointConfig
+}
+
+// NewDiagnoser creates a diagnoser
+func NewDiagnoser(repo *database.DiagnosisRepository, publisher models.DiagnosisProcessor, baselineConfig diagnosis.BaselineConfig, defaultStrategy diagnosis.BaselineStrategy, broadcaster metrics.Broadcaster, correlator *Correlator, rules *RuleEvaluator, silences *SilenceMatcher, changePoints *diagnosis.ChangePointConfig) *Diagnoser {
+	return &Diagnoser{
+		repo:            repo,
+		publisher:       publisher,
+		baselineConfig:  baselineConfig,
+		defaultStrategy: defaultStrategy,
+		broadcaster:     broadcaster,
+		correlator:      correlator,
+		rules:           rules,
+		silences:        silences,
+		changePoints:    changePoints,
+	}
+}
+
+// HandleWindowFlushed diagnoses a flushed window against the target's
+// baseline, updates the baseline with the window, and records and publishes
+// the result. A window that was diagnosed before is diagnosed again, since
+// late events may have changed it, but is not folded into the baseline
+// again. The window is also folded into the series' level shift detectors.
+// Windows inside a maintenance window are diagnosed and recorded but not
+// folded into the baseline or the detectors.
+func (d *Diagnoser) HandleWindowFlushed(n *models.WindowFlushed) error {
+	start := time.Now()
+	defer func() {
+		diagnosisDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	tracer := tracing.GetTracer("diagnoser")
+	ctx, span := tracer.Start(context.Background(), "diagnoser.diagnoseWindow")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("client.id", n.ClientID),
+		attribute.String("target", n.Target),
+		attribute.String("window.start_time", n.WindowStartTs.Format(time.RFC3339)),
+		attribute.Bool("window.late", n.Late),
+	)
+
+	agg, err := d.repo.GetAggregate(ctx, n.ClientID, n.Target, n.AddressFamily, n.CheckType, n.WindowStartTs)
+	if err != nil {
+		windowsDiagnosedTotal.WithLabelValues("error").Inc()
+		tracing.RecordError(ctx, err)
+		return err
+	}
+	if agg == nil {
+		// Already removed by retention cleanup; nothing to diagnose
+		windowsDiagnosedTotal.WithLabelValues("missing").Inc()
+		return nil
+	}
+
+	previous, err := d.repo.GetAggregatesBefore(ctx, n.ClientID, n.Target, n.AddressFamily, n.CheckType, n.WindowStartTs, 1)
+	if err != nil {
+		windowsDiagnosedTotal.WithLabelValues("error").Inc()
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	baselines, err := d.loadBaselines(ctx, agg, d.strategyFor(ctx, agg.Target))
+	if err != nil {
+		windowsDiagnosedTotal.WithLabelValues("error").Inc()
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	silences := d.silences.Match(ctx, agg)
+	maintenance := silences.Maintenance()
+	span.SetAttributes(attribute.Bool("window.maintenance", maintenance))
+
+	// The first baseline with enough history is used; later ones are
+	// fallbacks
+	current := toWindowMetrics(agg)
+	var baseline *diagnosis.Baseline
+	for _, b := range baselines {
+		if baseline = b.state.Baseline(d.baselineConfig, agg.WindowStartTs); baseline != nil {
+			break
+		}
+	}
+	result := diagnosis.Evaluate(current, baseline)
+	label := result.Label
+
+	rec := &database.DiagnosisRecord{
+		ClientID:      agg.ClientID,
+		Target:        agg.Target,
+		AddressFamily: agg.AddressFamily,
+		CheckType:     agg.CheckType,
+		WindowStartTs: agg.WindowStartTs,
+		Late:          n.Late,
+		CountSuccess:  agg.CountSuccess,
+		DNSP95:        agg.DNSP95,
+		TCPP95:        agg.TCPP95,
+		TLSP95:        agg.TLSP95,
+		TTFBP95:       agg.TTFBP95,
+		ThroughputP50: agg.ThroughputP50,
+		Maintenance:   maintenance,
+		UpdatedAt:     time.Now(),
+	}
+	if len(silences) > 0 {
+		if rec.Silences, err = json.Marshal(silences.IDs()); err != nil {
+			return fmt.Errorf("failed to marshal silences: %w", err)
+		}
+	}
+	if label != diagnosis.DiagnosisNone {
+		l := string(label)
+		rec.DiagnosisLabel = &l
+	}
+	// The previous window's label; replaced by the window's own earlier
+	// label if it is being re-diagnosed
+	if len(previous) > 0 {
+		rec.PreviousLabel = previous[0].DiagnosisLabel
+	}
+	if rec.Details, err = json.Marshal(result); err != nil {
+		return fmt.Errorf("failed to marshal diagnosis: %w", err)
+	}
+	if baseline != nil {
+		rec.BaselineWindows = baseline.WindowCount
+		span.SetAttributes(attribute.String("baseline.strategy", string(baseline.Strategy)))
+		if rec.Baseline, err = json.Marshal(baseline); err != nil {
+			return fmt.Errorf("failed to marshal baseline: %w", err)
+		}
+	}
+
+	anomalous := label != diagnosis.DiagnosisNone
+	for _, b := range baselines {
+		if maintenance {
+			baselineUpdatesTotal.WithLabelValues(string(b.state.Strategy), "maintenance").Inc()
+			continue
+		}
+		if !b.state.Update(current, anomalous, d.baselineConfig) {
+			baselineUpdatesTotal.WithLabelValues(string(b.state.Strategy), "skipped").Inc()
+			continue
+		}
+		state, err := d.baselineRecord(agg, b)
+		if err != nil {
+			return err
+		}
+		rec.BaselineStates = append(rec.BaselineStates, *state)
+	}
+
+	// Shifts detected recently are available to the alert rules
+	var recentShifts []diagnosis.LevelShift
+	if d.changePoints != nil {
+		state, err := d.loadChangePoints(ctx, agg)
+		if err != nil {
+			windowsDiagnosedTotal.WithLabelValues("error").Inc()
+			tracing.RecordError(ctx, err)
+			return err
+		}
+		if !maintenance {
+			for _, shift := range state.Update(current, *d.changePoints) {
+				rec.LevelShifts = append(rec.LevelShifts, levelShiftRecord(agg, shift))
+			}
+			if state.LastWindowTs.Equal(agg.WindowStartTs) {
+				if rec.ChangePointState, err = changePointRecord(agg, state); err != nil {
+					return err
+				}
+			}
+		}
+		recentShifts = state.RecentShifts(agg.WindowStartTs, levelShiftRuleWindow)
+		span.SetAttributes(attribute.Int("window.level_shifts", len(rec.LevelShifts)))
+	}
+
+	if err := d.repo.SaveDiagnosis(ctx, rec); err != nil {
+		windowsDiagnosedTotal.WithLabelValues("error").Inc()
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	if rec.Revision > 1 {
+		windowsDiagnosedTotal.WithLabelValues("rediagnosed").Inc()
+	} else {
+		windowsDiagnosedTotal.WithLabelValues("diagnosed").Inc()
+	}
+	for _, state := range rec.BaselineStates {
+		baselineUpdatesTotal.WithLabelValues(state.Strategy, "updated").Inc()
+	}
+	d.publishLevelShifts(ctx, rec.LevelShifts)
+	if d.correlator != nil {
+		d.correlator.Schedule(rec.WindowStartTs)
+	}
+	// Rule failures do not fail the window, whose diagnosis is stored
+	if d.rules != nil {
+		if err := d.rules.Evaluate(ctx, agg, string(label), silences, recentShifts); err != nil {
+			log.Printf("Failed to evaluate alert rules for client %s, target %s: %v", agg.ClientID, agg.Target, err)
+		}
+	}
+	if label == diagnosis.DiagnosisNone {
+		diagnosesTotal.WithLabelValues("none").Inc()
+	} else {
+		diagnosesTotal.WithLabelValues(string(label)).Inc()
+	}
+
+	event := &models.DiagnosisEvent{
+		ClientID:              rec.ClientID,
+		Target:                rec.Target,
+		AddressFamily:         rec.AddressFamily,
+		CheckType:             rec.CheckType,
+		WindowStartTs:         rec.WindowStartTs,
+		Label:                 string(label),
+		Confidence:            result.Confidence(),
+		Details:               rec.Details,
+		PreviousLabel:         stringValue(rec.PreviousLabel),
+		Revision:              rec.Revision,
+		TargetClients:         rec.TargetClients,
+		TargetAffectedClients: rec.TargetAffectedClients,
+		Maintenance:           maintenance,
+		DiagnosedAt:           rec.UpdatedAt,
+	}
+	if len(silences) > 0 {
+		event.SilenceIDs = silences.IDs()
+	}
+	for _, l := range result.Labels() {
+		event.Labels = append(event.Labels, string(l))
+	}
+	span.SetAttributes(
+		attribute.String("diagnosis.label", event.Label),
+		attribute.StringSlice("diagnosis.labels", event.Labels),
+		attribute.Int("diagnosis.revision", event.Revision),
+	)
+
+	if event.Revision > 1 {
+		log.Printf("Re-diagnosed window: client=%s, target=%s, window=%s, revision=%d, diagnosis=%q (was %q)",
+			event.ClientID, event.Target, event.WindowStartTs.Format(time.RFC3339), event.Revision, event.Label, event.PreviousLabel)
+	} else if event.Label != "" {
+		log.Printf("Diagnosed window: client=%s, target=%s, window=%s, diagnosis=%v, confidence=%.2f, target clients affected=%d/%d",
+			event.ClientID, event.Target, event.WindowStartTs.Format(time.RFC3339), event.Labels, event.Confidence,
+			event.TargetAffectedClients, event.TargetClients)
+	}
+
+	// Healthy windows are only published when they end an issue
+	if event.Label != "" || event.Changed() {
+		d.publish(ctx, event)
+	}
+	return nil
+}
+
+// trackedBaseline is a baseline state with the row it is persisted in
+type trackedBaseline struct {
+	bucket int
+	state  *diagnosis.BaselineState
+}
+
+// loadBaselines loads the baselines a window is diagnosed against, in order
+// of preference. The hour-of-week baseline falls back to an EWMA baseline
+// until the same hour of a previous week has been seen.
+func (d *Diagnoser) loadBaselines(ctx context.Context, agg *database.WindowedAggregate, strategy diagnosis.BaselineStrategy) ([]trackedBaseline, error) {
+	bucket := 0
+	if strategy == diagnosis.BaselineHourOfWeek {
+		bucket = diagnosis.HourOfWeek(agg.WindowStartTs)
+	}
+	primary, err := d.loadBaseline(ctx, agg, strategy, bucket)
+	if err != nil {
+		return nil, err
+	}
+	baselines := []trackedBaseline{{bucket: bucket, state: primary}}
+
+	if strategy == diagnosis.BaselineHourOfWeek {
+		fallback, err := d.loadBaseline(ctx, agg, diagnosis.BaselineEWMA, 0)
+		if err != nil {
+			return nil, err
+		}
+		baselines = append(baselines, trackedBaseline{bucket: 0, state: fallback})
+	}
+	return baselines, nil
+}
+
+// loadBaseline loads a persisted baseline state. A baseline that does not
+// exist yet, e.g. after a target's strategy changed, is seeded from the
+// stored windows preceding agg, except those inside maintenance windows;
+// hour-of-week baselines start empty.
+func (d *Diagnoser) loadBaseline(ctx context.Context, agg *database.WindowedAggregate, strategy diagnosis.BaselineStrategy, bucket int) (*diagnosis.BaselineState, error) {
+	rec, err := d.repo.GetBaselineState(ctx, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType, string(strategy), bucket)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		var state diagnosis.BaselineState
+		if err := json.Unmarshal(rec.State, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s baseline: %w", strategy, err)
+		}
+		state.Strategy = strategy
+		return &state, nil
+	}
+
+	state := diagnosis.NewBaselineState(strategy)
+	if strategy == diagnosis.BaselineHourOfWeek {
+		return state, nil
+	}
+
+	history, err := d.repo.GetAggregatesBefore(ctx, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType, agg.WindowStartTs, d.baselineConfig.Windows)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Maintenance {
+			continue
+		}
+		state.Update(toWindowMetrics(&history[i]), history[i].DiagnosisLabel != nil, d.baselineConfig)
+	}
+	baselineUpdatesTotal.WithLabelValues(string(strategy), "seeded").Inc()
+	return state, nil
+}
+
+// baselineRecord encodes a baseline state for persisting
+func (d *Diagnoser) baselineRecord(agg *database.WindowedAggregate, b trackedBaseline) (*database.BaselineStateRecord, error) {
+	data, err := json.Marshal(b.state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s baseline: %w", b.state.Strategy, err)
+	}
+	return &database.BaselineStateRecord{
+		ClientID:      agg.ClientID,
+		Target:        agg.Target,
+		AddressFamily: agg.AddressFamily,
+		CheckType:     agg.CheckType,
+		Strategy:      string(b.state.Strategy),
+		Bucket:        b.bucket,
+		State:         data,
+		WindowCount:   b.state.Windows,
+		LastWindowTs:  b.state.LastWindowTs,
+		UpdatedAt:     time.Now(),
+	}, nil
+}
+
+// strategyFor returns a target's baseline strategy. Strategies are reloaded
+// every strategyRefreshInterval; if reloading fails the cached ones are kept.
+func (d *Diagnoser) strategyFor(ctx context.Context, target string) diagnosis.BaselineStrategy {
+	d.strategiesMu.Lock()
+	defer d.strategiesMu.Unlock()
+
+	if time.Since(d.strategiesLoaded) >= strategyRefreshInterval {
+		// Retry after the interval rather than on every window
+		d.strategiesLoaded = time.Now()
+		settings, err := d.repo.ListTargetBaselineStrategies(ctx)
+		if err != nil {
+			log.Printf("Failed to load target baseline strategies: %v", err)
+		} else {
+			d.strategies = make(map[string]diagnosis.BaselineStrategy, len(settings))
+			for _, s := range settings {
+				if !diagnosis.ValidBaselineStrategy(s.Strategy) {
+					log.Printf("Ignoring unknown baseline strategy %q for target %s", s.Strategy, s.Target)
+					continue
+				}
+				d.strategies[s.Target] = diagnosis.BaselineStrategy(s.Strategy)
+			}
+		}
+	}
+
+	if strategy, ok := d.strategies[target]; ok {
+		return strategy
+	}
+	return d.defaultStrategy
+}
+
+// publish sends a diagnosis to the alerting consumers on the queue and to
+// WebSocket subscribers. Failures are counted and logged but do not fail the
+// window, whose diagnosis is already stored.
+func (d *Diagnoser) publish(ctx context.Context, event *models.DiagnosisEvent) {
+	if d.publisher != nil {
+		if err := d.publisher.PublishDiagnosis(event); err != nil {
+			diagnosisPublishTotal.WithLabelValues("queue", "error").Inc()
+			tracing.RecordError(ctx, err)
+			log.Printf("Failed to publish diagnosis for client %s, target %s: %v", event.ClientID, event.Target, err)
+		} else {
+			diagnosisPublishTotal.WithLabelValues("queue", "success").Inc()
+		}
+	}
+
+	if d.broadcaster != nil {
+		d.broadcaster.Broadcast(diagnosticsChannel, diagnosisBroadcast(event))
+	}
+}
+
+// diagnosisBroadcast is the WebSocket message for a diagnosis
+func diagnosisBroadcast(event *models.DiagnosisEvent) map[string]interface{} {
+	severity := "warning"
+	if event.Label == "" {
+		severity = "info"
+	} else if diagnosis.IsErrorDriven(diagnosis.DiagnosisLabel(event.Label)) {
+		severity = "error"
+	}
+
+	return map[string]interface{}{
+		"client_id":               event.ClientID,
+		"target":                  event.Target,
+		"address_family":          event.AddressFamily,
+		"check_type":              event.CheckType,
+		"window_start_ts":         event.WindowStartTs.UTC().Format(time.RFC3339),
+		"diagnosis":               event.Label,
+		"labels":                  event.Labels,
+		"confidence":              event.Confidence,
+		"details":                 event.Details,
+		"previous_diagnosis":      event.PreviousLabel,
+		"resolved":                event.Resolved(),
+		"revision":                event.Revision,
+		"target_clients":          event.TargetClients,
+		"target_affected_clients": event.TargetAffectedClients,
+		"severity":                severity,
+		"timestamp":               event.DiagnosedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// toWindowMetrics converts a stored aggregate to the diagnosis engine's input
+func toWindowMetrics(agg *database.WindowedAggregate) diagnosis.WindowMetrics {
+	dns := floatValue(agg.DNSP95)
+	tcp := floatValue(agg.TCPP95)
+	tls := floatValue(agg.TLSP95)
+	ttfb := floatValue(agg.TTFBP95)
+	return diagnosis.WindowMetrics{
+		WindowStartTs:   agg.WindowStartTs,
+		DNSP95:          dns,
+		TCPP95:          tcp,
+		TLSP95:          tls,
+		TTFBP95:         ttfb,
+		TotalLatencyP95: dns + tcp + tls + ttfb,
+		ThroughputP50:   floatValue(agg.ThroughputP50),
+		CountSuccess:    int(agg.CountSuccess),
+		CountTotal:      int(agg.CountTotal),
+		DNSErrors:       int(agg.DNSErrorCount),
+		TCPErrors:       int(agg.TCPErrorCount),
+		TLSErrors:       int(agg.TLSErrorCount),
+		HTTPErrors:      int(agg.HTTPErrorCount),
+	}
+}
+
+func floatValue(ptr *float64) float64 {
+	if ptr == nil {
+		return 0
+	}
+	return *ptr
+}
+
+func stringValue(ptr *string) string {
+	if ptr == nil {
+		return ""
+	}
+	return *ptr
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/notify"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// Incident events broadcast on the incidents channel
+const (
+	incidentOpened   = "opened"
+	incidentUpdated  = "updated"
+	incidentResolved = "resolved"
+)
+
+var incidentEventsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "diagnoser_incident_events_total",
+		Help: "Total number of incident lifecycle events, by event",
+	},
+	[]string{"event"}, // opened, updated, resolved
+)
+
+func init() {
+	prometheus.MustRegister(incidentEventsTotal)
+}
+
+// IncidentTracker opens, updates and resolves incidents from the correlated
+// anomalies of each window. An anomaly correlated in OpenAfter consecutive
+// windows opens an incident; the incident follows the anomaly while it
+// continues, gathering affected clients and targets, and resolves after
+// ResolveAfter windows without it. Incidents are stored in the alerts
+// table, so every diagnoser instance sees the same ones.
+type IncidentTracker struct {
+	repo        *database.IncidentRepository
+	broadcaster metrics.Broadcaster
+	config      diagnosis.LifecycleConfig
+
+	// dispatcher sends incident events to channels, if not nil
+	dispatcher *notify.Dispatcher
+	channels   []string
+}
+
+// NewIncidentTracker creates an incident tracker. Incident events are sent
+// to the notification channels given.
+func NewIncidentTracker(repo *database.IncidentRepository, broadcaster metrics.Broadcaster, config diagnosis.LifecycleConfig,
+	dispatcher *notify.Dispatcher, channels []string) *IncidentTracker {
+	return &IncidentTracker{
+		repo:        repo,
+		broadcaster: broadcaster,
+		config:      config,
+		dispatcher:  dispatcher,
+		channels:    channels,
+	}
+}
+
+// ObserveWindow applies a window's correlated anomalies to the incidents.
+// Applying a window again, e.g. when it is correlated again or by another
+// instance, has no effect.
+func (t *IncidentTracker) ObserveWindow(ctx context.Context, windowStart time.Time, anomalies []diagnosis.Incident) error {
+	open, err := t.repo.ListOpenIncidents(ctx)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]*diagnosis.Incident, len(anomalies))
+	for i := range anomalies {
+		present[string(anomalies[i].Scope)+"|"+anomalies[i].Key] = &anomalies[i]
+	}
+
+	for i := range open {
+		inc := &open[i]
+		key := inc.Scope + "|" + inc.Key
+		anomaly := present[key]
+		delete(present, key)
+
+		if err := t.advance(ctx, inc, windowStart, anomaly); err != nil {
+			return err
+		}
+	}
+
+	for i := range anomalies {
+		anomaly := &anomalies[i]
+		if present[string(anomaly.Scope)+"|"+anomaly.Key] == nil {
+			continue
+		}
+		if err := t.open(ctx, windowStart, anomaly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance applies a window to an open incident
+func (t *IncidentTracker) advance(ctx context.Context, inc *database.IncidentRecord, windowStart time.Time, anomaly *diagnosis.Incident) error {
+	progress := diagnosis.IncidentProgress{
+		Label:            diagnosis.DiagnosisLabel(inc.Diagnosis),
+		LastWindowTs:     inc.LastWindowTs,
+		LastAnomalousTs:  inc.LastAnomalousTs,
+		AnomalousWindows: inc.AnomalousWindows,
+		HealthyWindows:   inc.HealthyWindows,
+	}
+	if err := json.Unmarshal(inc.Clients, &progress.Clients); err != nil {
+		return fmt.Errorf("failed to unmarshal clients of incident %d: %w", inc.ID, err)
+	}
+	if err := json.Unmarshal(inc.Targets, &progress.Targets); err != nil {
+		return fmt.Errorf("failed to unmarshal targets of incident %d: %w", inc.ID, err)
+	}
+
+	previousWindowTs := inc.LastWindowTs
+	transition, applied := progress.Advance(windowStart, anomaly, t.config)
+	if !applied {
+		return nil
+	}
+	if err := t.setProgress(inc, &progress); err != nil {
+		return err
+	}
+	if transition == diagnosis.TransitionResolved {
+		now := time.Now()
+		inc.ResolvedAt = &now
+	}
+
+	updated, err := t.repo.AdvanceIncident(ctx, inc, previousWindowTs)
+	if err != nil || !updated {
+		// Not updated: another instance applied a window first
+		return err
+	}
+
+	switch transition {
+	case diagnosis.TransitionUpdated:
+		t.notify(ctx, incidentUpdated, inc)
+	case diagnosis.TransitionResolved:
+		t.notify(ctx, incidentResolved, inc)
+	}
+	return nil
+}
+
+// open opens an incident for an anomaly without one, if it was correlated
+// in the preceding windows too
+func (t *IncidentTracker) open(ctx context.Context, windowStart time.Time, anomaly *diagnosis.Incident) error {
+	preceding := t.config.OpenAfter - 1
+	if preceding > 0 {
+		count, err := t.repo.CountCorrelatedWindows(ctx, string(anomaly.Scope), anomaly.Key, windowStart, preceding, t.config.Window)
+		if err != nil {
+			return err
+		}
+		if count < preceding {
+			return nil
+		}
+	}
+
+	inc := &database.IncidentRecord{
+		Scope:     string(anomaly.Scope),
+		Key:       anomaly.Key,
+		StartedAt: windowStart.Add(-time.Duration(preceding) * t.config.Window),
+	}
+	progress := &diagnosis.IncidentProgress{
+		Label:            anomaly.Label,
+		Clients:          anomaly.Clients,
+		Targets:          anomaly.Targets,
+		LastWindowTs:     windowStart,
+		LastAnomalousTs:  windowStart,
+		AnomalousWindows: t.config.OpenAfter,
+	}
+	if err := t.setProgress(inc, progress); err != nil {
+		return err
+	}
+	// An incident whose anomalies are all silenced is recorded with the
+	// silence and not notified
+	silenceID, err := t.repo.AnomalySilence(ctx, windowStart, anomaly.Clients, anomaly.Targets)
+	if err != nil {
+		return err
+	}
+	inc.SilenceID = silenceID
+
+	opened, err := t.repo.OpenIncident(ctx, inc)
+	if err != nil || !opened {
+		// Not opened: another instance opened it first
+		return err
+	}
+	t.notify(ctx, incidentOpened, inc)
+	return nil
+}
+
+// setProgress copies an incident's lifecycle state to its record
+func (t *IncidentTracker) setProgress(inc *database.IncidentRecord, progress *diagnosis.IncidentProgress) error {
+	clients, err := json.Marshal(progress.Clients)
+	if err != nil {
+		return fmt.Errorf("failed to marshal incident clients: %w", err)
+	}
+	targets, err := json.Marshal(progress.Targets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal incident targets: %w", err)
+	}
+
+	inc.Diagnosis = string(progress.Label)
+	inc.Severity = incidentSeverity(diagnosis.Scope(inc.Scope), progress.Label)
+	inc.Message = incidentMessage(inc.Scope, inc.Diagnosis, progress.Clients, progress.Targets)
+	inc.Clients = clients
+	inc.Targets = targets
+	inc.LastWindowTs = progress.LastWindowTs
+	inc.LastAnomalousTs = progress.LastAnomalousTs
+	inc.AnomalousWindows = progress.AnomalousWindows
+	inc.HealthyWindows = progress.HealthyWindows
+	return nil
+}
+
+// notify logs and broadcasts an incident lifecycle event, and sends it to the
+// incident channels unless the incident is silenced
+func (t *IncidentTracker) notify(ctx context.Context, event string, inc *database.IncidentRecord) {
+	incidentEventsTotal.WithLabelValues(event).Inc()
+	log.Printf("Incident %s: id=%d, scope=%s, key=%s, diagnosis=%s, severity=%s, started=%s, windows=%d",
+		event, inc.ID, inc.Scope, inc.Key, inc.Diagnosis, inc.Severity,
+		inc.StartedAt.Format(time.RFC3339), inc.AnomalousWindows)
+
+	if inc.SilenceID != nil {
+		silencedTotal.WithLabelValues("incident").Inc()
+	} else if t.dispatcher != nil && len(t.channels) > 0 {
+		t.dispatcher.Dispatch(ctx, &plugin.Notification{
+			AlertID:   inc.ID,
+			AlertType: database.IncidentAlertType,
+			Event:     event,
+			Severity:  inc.Severity,
+			Summary:   inc.Message,
+			Labels: map[string]string{
+				"scope":     inc.Scope,
+				"key":       inc.Key,
+				"diagnosis": inc.Diagnosis,
+			},
+			StartedAt: inc.StartedAt,
+			Timestamp: time.Now(),
+		}, t.channels)
+	}
+
+	if t.broadcaster == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"type":     "incident",
+		"event":    event,
+		"incident": inc,
+		"severity": inc.Severity,
+		"message":  inc.Message,
+	}
+	t.broadcaster.Broadcast(incidentsChannel, data)
+	t.broadcaster.Broadcast(dashboardChannel, data)
+}
+
+// incidentSeverity is error for error-driven diagnoses and warning for
+// latency ones, one level higher for incidents affecting several clients
+// or targets
+func incidentSeverity(scope diagnosis.Scope, label diagnosis.DiagnosisLabel) string {
+	errorDriven := diagnosis.IsErrorDriven(label)
+	switch {
+	case scope != diagnosis.ScopeLocalized && errorDriven:
+		return "critical"
+	case scope != diagnosis.ScopeLocalized || errorDriven:
+		return "error"
+	default:
+		return "warning"
+	}
+}
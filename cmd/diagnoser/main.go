@@ -1,12 +1,245 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/notify"
+	"github.com/rahulgh33/wirescope/internal/queue"
+	"github.com/rahulgh33/wirescope/internal/tracing"
+)
+
+var (
+	natsURL            = flag.String("nats-url", "nats://localhost:4222", "NATS server URL")
+	dbHost             = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort             = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbName             = flag.String("db-name", "telemetry", "PostgreSQL database name")
+	dbUser             = flag.String("db-user", "telemetry", "PostgreSQL user")
+	dbPassword         = flag.String("db-password", "telemetry", "PostgreSQL password")
+	baselineStrategy   = flag.String("baseline-strategy", "mean", "Default baseline strategy for targets without one: mean, ewma, hour_of_week or robust")
+	baselineWindows    = flag.Int("baseline-windows", 30, "Number of recent windows kept by the mean and robust baselines")
+	minBaselineWindows = flag.Int("min-baseline-windows", 3, "Minimum number of usable windows a baseline needs before it is used")
+	ewmaAlpha          = flag.Float64("ewma-alpha", 0.1, "Smoothing factor of the ewma baseline (0 < alpha <= 1)")
+	baselineWeeks      = flag.Int("baseline-weeks", 4, "Number of previous weeks kept by the hour_of_week baseline")
+	windowSize         = flag.Duration("window-size", 60*time.Second, "Aggregation window size, as -window-size of the aggregator")
+	correlationDelay   = flag.Duration("correlation-delay", 30*time.Second, "Delay after a window's first diagnosis before it is correlated across clients (0 disables correlation)")
+	minAffected        = flag.Int("correlation-min-affected", 2, "Minimum clients (for a target or network) or targets (for a client) affected for a target-wide or client-wide incident")
+	minAffectedShare   = flag.Float64("correlation-min-share", 0.5, "Minimum share of a target's clients, a client's targets or a network's clients affected for a wide incident")
+	incidentOpenAfter  = flag.Int("incident-open-after", 2, "Consecutive correlated windows of an anomaly that open an incident")
+	incidentResolve    = flag.Int("incident-resolve-after", 5, "Healthy windows in a row that resolve an incident")
+	alertRules         = flag.Bool("alert-rules", true, "Evaluate the alert rules managed through /api/v1/admin/alert-rules on every diagnosed window")
+	silences           = flag.Bool("silences", true, "Apply the silences and maintenance windows managed through /api/v1/admin/silences")
+	changePoints       = flag.Bool("change-points", true, "Detect level shifts per client, target and metric with CUSUM change-point detection")
+	changePointWarmup  = flag.Int("change-point-warmup", 30, "Windows establishing a metric's reference level before level shifts are detected")
+	changePointLimit   = flag.Float64("change-point-threshold", 10, "Cumulative deviation, in standard deviations, that signals a level shift")
+	changePointMin     = flag.Float64("change-point-min-shift", 0.2, "Smallest relative change between levels reported as a level shift")
+	notifications      = flag.Bool("notifications", true, "Send alert rule and incident notifications to the channels managed through /api/v1/admin/notification-channels")
+	incidentChannels   = flag.String("incident-channels", "", "Comma-separated notification channels incidents are sent to")
+	channelsFile       = flag.String("notification-channels-file", "", "JSON file of notification channels to register alongside those managed through the admin API")
+	notifyWorkers      = flag.Int("notification-workers", 4, "Number of concurrent notification deliveries")
+	notifyAttempts     = flag.Int("notification-max-attempts", 5, "Attempts per notification delivery before it is marked failed")
+	broadcastURL       = flag.String("broadcast-url", "http://localhost:9000/api/v1/ws", "Admin server WebSocket broadcast base URL for diagnoses, as BROADCAST_URL of the ai-agent (empty disables)")
+	metricsPort        = flag.String("metrics-port", "9092", "Prometheus metrics port")
+	otlpEndpoint       = flag.String("otlp-endpoint", "localhost:4318", "OpenTelemetry OTLP HTTP endpoint")
+	tracingEnabled     = flag.Bool("tracing-enabled", true, "Enable distributed tracing")
 )
 
 func main() {
-	fmt.Println("WireScope Diagnoser")
-	// TODO: Implement diagnoser functionality
-	os.Exit(0)
+	flag.Parse()
+
+	log.Printf("Starting WireScope Diagnoser")
+	log.Printf("NATS URL: %s", *natsURL)
+	log.Printf("Database: %s@%s:%d/%s", *dbUser, *dbHost, *dbPort, *dbName)
+	log.Printf("Baseline: default strategy %s, up to %d windows, at least %d, ewma alpha %.2f, %d weeks",
+		*baselineStrategy, *baselineWindows, *minBaselineWindows, *ewmaAlpha, *baselineWeeks)
+	if !diagnosis.ValidBaselineStrategy(*baselineStrategy) {
+		log.Fatalf("Invalid -baseline-strategy %q", *baselineStrategy)
+	}
+	if *baselineWindows < 1 || *minBaselineWindows < 1 || *minBaselineWindows > *baselineWindows {
+		log.Fatalf("Invalid baseline settings: need 1 <= -min-baseline-windows <= -baseline-windows")
+	}
+	if *ewmaAlpha <= 0 || *ewmaAlpha > 1 {
+		log.Fatalf("Invalid -ewma-alpha: need 0 < alpha <= 1")
+	}
+	if *baselineWeeks < 1 {
+		log.Fatalf("Invalid -baseline-weeks: need at least 1")
+	}
+	if *windowSize <= 0 {
+		log.Fatalf("Invalid -window-size: need a positive duration")
+	}
+	if *minAffected < 1 || *minAffectedShare <= 0 || *minAffectedShare > 1 {
+		log.Fatalf("Invalid correlation settings: need -correlation-min-affected >= 1 and 0 < -correlation-min-share <= 1")
+	}
+	if *incidentOpenAfter < 1 || *incidentResolve < 1 {
+		log.Fatalf("Invalid incident settings: need -incident-open-after >= 1 and -incident-resolve-after >= 1")
+	}
+	if *changePointWarmup < 1 || *changePointLimit <= 0 || *changePointMin < 0 {
+		log.Fatalf("Invalid change-point settings: need -change-point-warmup >= 1, -change-point-threshold > 0 and -change-point-min-shift >= 0")
+	}
+
+	tracingConfig := tracing.DefaultConfig("diagnoser")
+	tracingConfig.OTLPEndpoint = *otlpEndpoint
+	tracingConfig.Enabled = *tracingEnabled
+
+	shutdownTracing, err := tracing.InitTracer(tracingConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("Error shutting down tracing: %v", err)
+		}
+	}()
+
+	dbConfig := database.DefaultConnectionConfig()
+	dbConfig.Host = *dbHost
+	dbConfig.Port = *dbPort
+	dbConfig.Database = *dbName
+	dbConfig.User = *dbUser
+	dbConfig.Password = *dbPassword
+
+	dbConn, err := database.NewConnection(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer dbConn.Close()
+
+	log.Printf("Connected to database")
+
+	natsConfig := queue.DefaultNATSConfig()
+	natsConfig.URL = *natsURL
+
+	processor, err := queue.NewNATSEventProcessor(natsConfig)
+	if err != nil {
+		log.Fatalf("Failed to create NATS processor: %v", err)
+	}
+	defer processor.Close()
+
+	log.Printf("Connected to NATS")
+
+	var bc metrics.Broadcaster
+	if *broadcastURL != "" {
+		log.Printf("Broadcasting diagnoses to %s", *broadcastURL)
+		broadcaster := metrics.NewWebSocketBroadcaster(*broadcastURL)
+		defer broadcaster.Close()
+		bc = broadcaster
+	}
+	baselineConfig := diagnosis.BaselineConfig{
+		Windows:    *baselineWindows,
+		MinWindows: *minBaselineWindows,
+		Alpha:      *ewmaAlpha,
+		Weeks:      *baselineWeeks,
+	}
+	repo := database.NewDiagnosisRepository(dbConn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var dispatcher *notify.Dispatcher
+	if *notifications {
+		retry := notify.DefaultRetryConfig()
+		retry.MaxAttempts = *notifyAttempts
+		registry, err := loadChannelRegistry(*channelsFile)
+		if err != nil {
+			log.Fatalf("Failed to load notification channels: %v", err)
+		}
+		dispatcher = notify.NewDispatcher(database.NewNotificationRepository(dbConn), retry, registry)
+		dispatcher.Start(ctx, *notifyWorkers)
+	}
+
+	var correlator *Correlator
+	if *correlationDelay > 0 {
+		log.Printf("Correlating windows %s after their first diagnosis (at least %d affected, share %.2f)",
+			*correlationDelay, *minAffected, *minAffectedShare)
+		log.Printf("Opening incidents after %d correlated windows, resolving after %d healthy windows",
+			*incidentOpenAfter, *incidentResolve)
+		tracker := NewIncidentTracker(database.NewIncidentRepository(dbConn), bc, diagnosis.LifecycleConfig{
+			OpenAfter:    *incidentOpenAfter,
+			ResolveAfter: *incidentResolve,
+			Window:       *windowSize,
+		}, dispatcher, splitList(*incidentChannels))
+		correlator = NewCorrelator(repo, processor, bc, diagnosis.CorrelationConfig{
+			MinAffected: *minAffected,
+			MinShare:    *minAffectedShare,
+		}, *correlationDelay, tracker)
+		go correlator.Run(ctx)
+	}
+
+	var rules *RuleEvaluator
+	if *alertRules {
+		rules = NewRuleEvaluator(database.NewAlertRuleRepository(dbConn), bc, dispatcher, *windowSize)
+	}
+
+	var silenceMatcher *SilenceMatcher
+	if *silences {
+		silenceMatcher = NewSilenceMatcher(database.NewSilenceRepository(dbConn))
+	}
+
+	var changePointConfig *diagnosis.ChangePointConfig
+	if *changePoints {
+		cfg := diagnosis.DefaultChangePointConfig()
+		cfg.Warmup = *changePointWarmup
+		cfg.Threshold = *changePointLimit
+		cfg.MinShift = *changePointMin
+		log.Printf("Detecting level shifts after %d windows (threshold %.1f, min shift %.2f)",
+			cfg.Warmup, cfg.Threshold, cfg.MinShift)
+		changePointConfig = &cfg
+	}
+
+	diagnoser := NewDiagnoser(repo, processor, baselineConfig,
+		diagnosis.BaselineStrategy(*baselineStrategy), bc, correlator, rules, silenceMatcher, changePointConfig)
+
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+		})
+		addr := ":" + *metricsPort
+		log.Printf("Metrics server listening on %s", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+
+	if err := processor.ConsumeWindowsFlushed(diagnoser.HandleWindowFlushed); err != nil {
+		log.Fatalf("Failed to consume flushed windows: %v", err)
+	}
+
+	log.Printf("Diagnoser started successfully")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+
+	// Stop retrying deliveries; pending ones stay recorded as pending
+	cancel()
+	if dispatcher != nil {
+		dispatcher.Wait()
+	}
+
+	log.Printf("Diagnoser stopped")
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
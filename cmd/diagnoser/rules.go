@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rahulgh33/wirescope/internal/alerting"
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/notify"
+	"github.com/rahulgh33/wirescope/internal/tracing"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// ruleRefreshInterval is how often alert rules are reloaded
+const ruleRefreshInterval = time.Minute
+
+var ruleEvaluationsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "diagnoser_rule_evaluations_total",
+		Help: "Total number of alert rule evaluations, by result",
+	},
+	[]string{"result"}, // held, not_held, firing, resolved, error
+)
+
+func init() {
+	prometheus.MustRegister(ruleEvaluationsTotal)
+}
+
+// loadedRule is an enabled alert rule with its stored definition
+type loadedRule struct {
+	id   int64
+	rule *alerting.Rule
+}
+
+// RuleEvaluator evaluates the user-defined alert rules on every diagnosed
+// window. A rule's state per series is stored, so a rule's for duration
+// spans windows handled by different instances.
+type RuleEvaluator struct {
+	repo        *database.AlertRuleRepository
+	broadcaster metrics.Broadcaster
+
+	// dispatcher sends rule alerts to the rules' channels, if not nil
+	dispatcher *notify.Dispatcher
+
+	// window is the length of an aggregate window
+	window time.Duration
+
+	// rules caches the enabled rules
+	mu     sync.Mutex
+	rules  []loadedRule
+	loaded time.Time
+}
+
+// NewRuleEvaluator creates a rule evaluator
+func NewRuleEvaluator(repo *database.AlertRuleRepository, broadcaster metrics.Broadcaster, dispatcher *notify.Dispatcher, window time.Duration) *RuleEvaluator {
+	return &RuleEvaluator{
+		repo:        repo,
+		broadcaster: broadcaster,
+		dispatcher:  dispatcher,
+		window:      window,
+	}
+}
+
+// Evaluate applies a window to the rules selecting its series. label is the
+// window's diagnosis label, shifts the series' recent level shifts and
+// silences the silences active for the window; alerts fired while silenced
+// are recorded with the silence but not sent to the rules' channels.
+func (e *RuleEvaluator) Evaluate(ctx context.Context, agg *database.WindowedAggregate, label string, silences alerting.Silences, shifts []diagnosis.LevelShift) error {
+	tracer := tracing.GetTracer("diagnoser")
+	ctx, span := tracer.Start(ctx, "diagnoser.evaluateRules")
+	defer span.End()
+
+	fields := ruleFields(agg, label, shifts)
+	evaluated := 0
+	for _, r := range e.enabledRules(ctx) {
+		if !r.rule.Selector.Matches(agg.ClientID, agg.Target, agg.UserLabel) {
+			continue
+		}
+		evaluated++
+		if err := e.apply(ctx, r, agg, r.rule.Condition.Eval(fields), silences); err != nil {
+			ruleEvaluationsTotal.WithLabelValues("error").Inc()
+			tracing.RecordError(ctx, err)
+			return fmt.Errorf("failed to evaluate alert rule %s: %w", r.rule.Name, err)
+		}
+	}
+	span.SetAttributes(attribute.Int("rules.evaluated", evaluated))
+	return nil
+}
+
+// apply advances a rule's state for the window's series and fires or
+// resolves its alert
+func (e *RuleEvaluator) apply(ctx context.Context, r loadedRule, agg *database.WindowedAggregate, holds bool, silences alerting.Silences) error {
+	if holds {
+		ruleEvaluationsTotal.WithLabelValues("held").Inc()
+	} else {
+		ruleEvaluationsTotal.WithLabelValues("not_held").Inc()
+	}
+
+	rec, err := e.repo.GetRuleState(ctx, r.id, agg.ClientID, agg.Target, agg.AddressFamily, agg.CheckType)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		if !holds {
+			// Nothing to record for a rule that never held
+			return nil
+		}
+		rec = &database.RuleStateRecord{
+			RuleID:        r.id,
+			ClientID:      agg.ClientID,
+			Target:        agg.Target,
+			AddressFamily: agg.AddressFamily,
+			CheckType:     agg.CheckType,
+		}
+	}
+
+	var previousWindowTs *time.Time
+	state := alerting.State{Firing: rec.Firing}
+	if !rec.LastWindowTs.IsZero() {
+		previous := rec.LastWindowTs
+		previousWindowTs = &previous
+		state.LastWindowTs = rec.LastWindowTs
+	}
+	if rec.ActiveSince != nil {
+		state.ActiveSince = *rec.ActiveSince
+	}
+
+	startedAt := state.ActiveSince
+	transition, applied := state.Advance(agg.WindowStartTs, holds, r.rule.For, e.window)
+	if !applied {
+		return nil
+	}
+	rec.LastWindowTs = state.LastWindowTs
+	rec.Firing = state.Firing
+	rec.ActiveSince = nil
+	if !state.ActiveSince.IsZero() {
+		activeSince := state.ActiveSince
+		rec.ActiveSince = &activeSince
+	}
+
+	var fire *database.RuleAlertRecord
+	if transition == alerting.TransitionFiring {
+		fire = &database.RuleAlertRecord{
+			RuleID:    r.id,
+			RuleName:  r.rule.Name,
+			ClientID:  agg.ClientID,
+			Target:    agg.Target,
+			Severity:  r.rule.Severity,
+			Message:   fmt.Sprintf("%s: %s for %s on %s", r.rule.Name, r.rule.Condition, agg.ClientID, agg.Target),
+			StartedAt: state.ActiveSince,
+		}
+		if len(silences) > 0 {
+			silenceID := silences[0].ID
+			fire.SilenceID = &silenceID
+		}
+	}
+	resolvedAlertID, resolvedSilenceID := rec.AlertID, rec.AlertSilenceID
+
+	saved, err := e.repo.SaveRuleState(ctx, rec, previousWindowTs, fire, transition == alerting.TransitionResolved)
+	if err != nil || !saved {
+		// Not saved: another instance applied a window of the series first
+		return err
+	}
+
+	switch transition {
+	case alerting.TransitionFiring:
+		ruleEvaluationsTotal.WithLabelValues("firing").Inc()
+		log.Printf("Alert rule firing: rule=%s, client=%s, target=%s, severity=%s, since=%s",
+			r.rule.Name, agg.ClientID, agg.Target, r.rule.Severity, state.ActiveSince.Format(time.RFC3339))
+		e.notify(ctx, "firing", fire, r.rule, agg)
+	case alerting.TransitionResolved:
+		ruleEvaluationsTotal.WithLabelValues("resolved").Inc()
+		log.Printf("Alert rule resolved: rule=%s, client=%s, target=%s", r.rule.Name, agg.ClientID, agg.Target)
+		resolved := &database.RuleAlertRecord{
+			RuleID:    r.id,
+			RuleName:  r.rule.Name,
+			ClientID:  agg.ClientID,
+			Target:    agg.Target,
+			Severity:  r.rule.Severity,
+			Message:   fmt.Sprintf("%s resolved for %s on %s", r.rule.Name, agg.ClientID, agg.Target),
+			StartedAt: startedAt,
+			SilenceID: resolvedSilenceID,
+		}
+		if resolvedAlertID != nil {
+			resolved.ID = *resolvedAlertID
+		}
+		e.notify(ctx, "resolved", resolved, r.rule, agg)
+	}
+	return nil
+}
+
+// notify broadcasts a rule alert event and sends it to the rule's channels
+// unless the alert is silenced
+func (e *RuleEvaluator) notify(ctx context.Context, event string, alert *database.RuleAlertRecord, rule *alerting.Rule, agg *database.WindowedAggregate) {
+	if alert.SilenceID != nil {
+		silencedTotal.WithLabelValues("rule_alert").Inc()
+	} else if e.dispatcher != nil && len(rule.Channels) > 0 {
+		e.dispatcher.Dispatch(ctx, &plugin.Notification{
+			AlertID:   alert.ID,
+			AlertType: database.RuleAlertType,
+			Event:     event,
+			Severity:  alert.Severity,
+			Summary:   alert.Message,
+			Labels: map[string]string{
+				"rule":           rule.Name,
+				"condition":      rule.Condition.String(),
+				"client_id":      agg.ClientID,
+				"target":         agg.Target,
+				"address_family": agg.AddressFamily,
+				"check_type":     agg.CheckType,
+			},
+			StartedAt: alert.StartedAt,
+			Timestamp: time.Now(),
+		}, rule.Channels)
+	}
+
+	if e.broadcaster == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"type":     "rule_alert",
+		"event":    event,
+		"alert":    alert,
+		"severity": alert.Severity,
+		"message":  alert.Message,
+	}
+	e.broadcaster.Broadcast(diagnosticsChannel, data)
+	e.broadcaster.Broadcast(dashboardChannel, data)
+}
+
+// enabledRules returns the enabled rules. Rules are reloaded every
+// ruleRefreshInterval; if reloading fails the cached ones are kept. Rules
+// that no longer compile are skipped.
+func (e *RuleEvaluator) enabledRules(ctx context.Context) []loadedRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if time.Since(e.loaded) >= ruleRefreshInterval {
+		// Retry after the interval rather than on every window
+		e.loaded = time.Now()
+		records, err := e.repo.ListAlertRules(ctx, true)
+		if err != nil {
+			log.Printf("Failed to load alert rules: %v", err)
+			return e.rules
+		}
+
+		e.rules = e.rules[:0:0]
+		for _, rec := range records {
+			rule, err := compileRule(&rec)
+			if err != nil {
+				log.Printf("Ignoring alert rule %s: %v", rec.Name, err)
+				continue
+			}
+			e.rules = append(e.rules, loadedRule{id: rec.ID, rule: rule})
+		}
+	}
+	return e.rules
+}
+
+// compileRule compiles a stored alert rule
+func compileRule(rec *database.AlertRuleRecord) (*alerting.Rule, error) {
+	var selector alerting.Selector
+	if err := json.Unmarshal(rec.Selector, &selector); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal selector: %w", err)
+	}
+	var channels []string
+	if err := json.Unmarshal(rec.Channels, &channels); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal channels: %w", err)
+	}
+	return alerting.NewRule(rec.Name, rec.Expression, selector,
+		time.Duration(rec.ForSeconds)*time.Second, rec.Severity, channels)
+}
+
+// ruleFields returns the fields of a window that rule expressions use.
+// Percentiles absent from the window, and shift fields of metrics without a
+// recent level shift, are left out.
+func ruleFields(agg *database.WindowedAggregate, label string, shifts []diagnosis.LevelShift) alerting.Fields {
+	numbers := map[string]float64{
+		"count_total":         float64(agg.CountTotal),
+		"count_success":       float64(agg.CountSuccess),
+		"count_error":         float64(agg.CountError),
+		"dns_error_count":     float64(agg.DNSErrorCount),
+		"tcp_error_count":     float64(agg.TCPErrorCount),
+		"tls_error_count":     float64(agg.TLSErrorCount),
+		"http_error_count":    float64(agg.HTTPErrorCount),
+		"timeout_error_count": float64(agg.TimeoutErrorCount),
+		"asn":                 float64(agg.ASN),
+	}
+	var timeouts map[string]int64
+	if len(agg.TimeoutStageCounts) > 0 {
+		if err := json.Unmarshal(agg.TimeoutStageCounts, &timeouts); err != nil {
+			log.Printf("Invalid timeout stage counts for %s/%s: %v", agg.ClientID, agg.Target, err)
+		}
+	}
+	for name, stage := range map[string]string{
+		"dns_timeout_count":  models.ErrorStageDNS,
+		"tcp_timeout_count":  models.ErrorStageTCP,
+		"tls_timeout_count":  models.ErrorStageTLS,
+		"http_timeout_count": models.ErrorStageHTTP,
+	} {
+		numbers[name] = float64(timeouts[stage])
+	}
+	if agg.CountTotal > 0 {
+		numbers["error_rate"] = float64(agg.CountError) / float64(agg.CountTotal)
+	}
+	for name, value := range map[string]*float64{
+		"dns_p50":        agg.DNSP50,
+		"dns_p95":        agg.DNSP95,
+		"tcp_p50":        agg.TCPP50,
+		"tcp_p95":        agg.TCPP95,
+		"tls_p50":        agg.TLSP50,
+		"tls_p95":        agg.TLSP95,
+		"ttfb_p50":       agg.TTFBP50,
+		"ttfb_p95":       agg.TTFBP95,
+		"throughput_p50": agg.ThroughputP50,
+		"throughput_p95": agg.ThroughputP95,
+		"upload_p50":     agg.UploadP50,
+		"upload_p95":     agg.UploadP95,
+		"loss_rate":      agg.LossRate,
+		"rtt_p50":        agg.RTTP50,
+		"rtt_p95":        agg.RTTP95,
+		"jitter_p50":     agg.JitterP50,
+		"jitter_p95":     agg.JitterP95,
+	} {
+		if value != nil {
+			numbers[name] = *value
+		}
+	}
+	if agg.TTFBP95 != nil {
+		numbers["latency_p95"] = floatValue(agg.DNSP95) + floatValue(agg.TCPP95) + floatValue(agg.TLSP95) + *agg.TTFBP95
+	}
+	for _, shift := range shifts {
+		numbers[shift.Metric+"_shift"] = shift.Change
+	}
+
+	return alerting.Fields{
+		Numbers: numbers,
+		Strings: map[string]string{
+			"client_id":      agg.ClientID,
+			"target":         agg.Target,
+			"address_family": agg.AddressFamily,
+			"check_type":     agg.CheckType,
+			"user_label":     agg.UserLabel,
+			"as_org":         agg.ASOrg,
+			"diagnosis":      label,
+		},
+	}
+}
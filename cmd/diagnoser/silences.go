@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahulgh33/wirescope/internal/alerting"
+	"github.com/rahulgh33/wirescope/internal/database"
+)
+
+// silenceRefreshInterval is how often silences are reloaded
+const silenceRefreshInterval = time.Minute
+
+var silencedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "diagnoser_silenced_total",
+		Help: "Total number of windows and rule alert and incident events silenced, by type",
+	},
+	[]string{"type"}, // window, maintenance_window, rule_alert, incident
+)
+
+func init() {
+	prometheus.MustRegister(silencedTotal)
+}
+
+// SilenceMatcher matches windows against the silences and maintenance
+// windows managed through the admin API
+type SilenceMatcher struct {
+	repo *database.SilenceRepository
+
+	// silences caches the unexpired silences
+	mu       sync.Mutex
+	silences alerting.Silences
+	loaded   time.Time
+}
+
+// NewSilenceMatcher creates a silence matcher
+func NewSilenceMatcher(repo *database.SilenceRepository) *SilenceMatcher {
+	return &SilenceMatcher{repo: repo}
+}
+
+// Match returns the silences active for a window's series at the window's
+// start. A nil matcher matches nothing.
+func (m *SilenceMatcher) Match(ctx context.Context, agg *database.WindowedAggregate) alerting.Silences {
+	if m == nil {
+		return nil
+	}
+	matched := m.unexpired(ctx).Match(agg.WindowStartTs, agg.ClientID, agg.Target, agg.UserLabel, agg.ASOrg)
+	if len(matched) > 0 {
+		silencedTotal.WithLabelValues("window").Inc()
+		if matched.Maintenance() {
+			silencedTotal.WithLabelValues("maintenance_window").Inc()
+		}
+	}
+	return matched
+}
+
+// unexpired returns the unexpired silences. Silences are reloaded every
+// silenceRefreshInterval; if reloading fails the cached ones are kept.
+// Silences that no longer compile are skipped.
+func (m *SilenceMatcher) unexpired(ctx context.Context) alerting.Silences {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.loaded) >= silenceRefreshInterval {
+		// Retry after the interval rather than on every window
+		m.loaded = time.Now()
+		records, err := m.repo.ListSilences(ctx, true)
+		if err != nil {
+			log.Printf("Failed to load silences: %v", err)
+			return m.silences
+		}
+
+		m.silences = m.silences[:0:0]
+		for i := range records {
+			silence, err := compileSilence(&records[i])
+			if err != nil {
+				log.Printf("Ignoring silence %d: %v", records[i].ID, err)
+				continue
+			}
+			m.silences = append(m.silences, silence)
+		}
+	}
+	return m.silences
+}
+
+// compileSilence compiles a stored silence
+func compileSilence(rec *database.SilenceRecord) (*alerting.Silence, error) {
+	var matchers alerting.Matchers
+	if err := json.Unmarshal(rec.Matchers, &matchers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal matchers: %w", err)
+	}
+	var schedule *alerting.Schedule
+	if len(rec.Schedule) > 0 {
+		if err := json.Unmarshal(rec.Schedule, &schedule); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+		}
+	}
+	var endsAt time.Time
+	if rec.EndsAt != nil {
+		endsAt = *rec.EndsAt
+	}
+	return alerting.NewSilence(rec.ID, rec.Name, rec.Kind, matchers, rec.StartsAt, endsAt, schedule)
+}
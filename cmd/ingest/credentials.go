@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// credentialCacheTTL bounds how long a looked-up probe credential is trusted,
+// and so how long a revoked credential keeps working
+const credentialCacheTTL = 30 * time.Second
+
+// credentialCacheSize bounds the number of cached lookups
+const credentialCacheSize = 10000
+
+// ProbeCredentials verifies ingest tokens issued through probe enrollment
+type ProbeCredentials struct {
+	repo *database.EnrollmentRepository
+
+	mu    sync.Mutex
+	cache map[string]credentialCacheEntry
+}
+
+type credentialCacheEntry struct {
+	clientID string // empty if the token is unknown or revoked
+	expires  time.Time
+}
+
+// NewProbeCredentials creates a probe credential verifier
+func NewProbeCredentials(repo *database.EnrollmentRepository) *ProbeCredentials {
+	return &ProbeCredentials{
+		repo:  repo,
+		cache: make(map[string]credentialCacheEntry),
+	}
+}
+
+// Lookup returns the client ID an active token was issued to, or "" if the
+// token is unknown or revoked. Results, including misses, are cached briefly.
+func (c *ProbeCredentials) Lookup(ctx context.Context, token string) (string, error) {
+	hash := models.HashCredential(token)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.cache[hash]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.clientID, nil
+	}
+
+	cred, err := c.repo.GetActiveProbeCredential(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	entry = credentialCacheEntry{expires: now.Add(credentialCacheTTL)}
+	if cred != nil {
+		entry.clientID = cred.ClientID
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= credentialCacheSize {
+		for k, e := range c.cache {
+			if !now.Before(e.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= credentialCacheSize {
+			c.cache = make(map[string]credentialCacheEntry)
+		}
+	}
+	c.cache[hash] = entry
+	c.mu.Unlock()
+
+	return entry.clientID, nil
+}
+
+type boundClientIDKey struct{}
+
+// withBoundClientID records the client ID an enrolled token was issued to
+func withBoundClientID(r *http.Request, clientID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), boundClientIDKey{}, clientID))
+}
+
+// clientIDAllowed reports whether a request may submit data for clientID.
+// Requests authenticated with an enrolled probe's token may only submit
+// data for that probe.
+func clientIDAllowed(r *http.Request, clientID string) bool {
+	bound, ok := r.Context().Value(boundClientIDKey{}).(string)
+	return !ok || bound == clientID
+}
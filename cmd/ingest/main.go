@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -19,6 +20,7 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/rahulgh33/wirescope/internal/database"
 	"github.com/rahulgh33/wirescope/internal/metrics"
 	"github.com/rahulgh33/wirescope/internal/models"
 	"github.com/rahulgh33/wirescope/internal/queue"
@@ -33,6 +35,16 @@ var (
 	rateLimitBurst = flag.Int("rate-limit-burst", 20, "Maximum burst size for rate limiting")
 	otlpEndpoint   = flag.String("otlp-endpoint", "localhost:4318", "OpenTelemetry OTLP HTTP endpoint")
 	tracingEnabled = flag.Bool("tracing-enabled", true, "Enable distributed tracing")
+	maxClockSkew   = flag.Duration("max-clock-skew", 5*time.Second, "Clock skew beyond which events are corrected or flagged")
+	clockSkewMode  = flag.String("clock-skew-mode", models.ClockSkewModeCorrect, "What to do with events beyond -max-clock-skew: correct (shift ts_ms by the reported or estimated skew) or flag")
+
+	// Enrolled probe credentials
+	probeCredentials = flag.Bool("probe-credentials", false, "Also accept ingest tokens issued through probe enrollment (requires PostgreSQL)")
+	dbHost           = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort           = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbName           = flag.String("db-name", "telemetry", "PostgreSQL database name")
+	dbUser           = flag.String("db-user", "telemetry", "PostgreSQL user")
+	dbPassword       = flag.String("db-password", "telemetry", "PostgreSQL password")
 )
 
 // Prometheus metrics
@@ -69,7 +81,7 @@ var (
 			Name: "ingest_auth_failures_total",
 			Help: "Total number of authentication failures",
 		},
-		[]string{"reason"}, // missing_token, invalid_token
+		[]string{"reason"}, // missing_token, invalid_format, invalid_token, lookup_error, client_mismatch
 	)
 
 	ingestRateLimitHits = prometheus.NewCounterVec(
@@ -94,6 +106,38 @@ var (
 		},
 		[]string{"client_id_hash"},
 	)
+
+	ingestHeartbeatsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_heartbeats_total",
+			Help: "Total number of probe heartbeat requests",
+		},
+		[]string{"status"}, // success, validation_error, publish_error
+	)
+
+	ingestClockSkew = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ingest_clock_skew_seconds",
+			Help:    "Absolute clock skew of ingested events (server minus probe)",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 30, 60, 300, 3600},
+		},
+	)
+
+	ingestClockSkewedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_clock_skewed_events_total",
+			Help: "Total events whose clock skew exceeded the threshold",
+		},
+		[]string{"action"}, // corrected, flagged
+	)
+
+	ingestPathTracesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_path_traces_total",
+			Help: "Total number of path trace ingest requests",
+		},
+		[]string{"status"}, // success, validation_error, rate_limited, publish_error
+	)
 )
 
 func init() {
@@ -104,6 +148,10 @@ func init() {
 	prometheus.MustRegister(ingestRateLimitHits)
 	prometheus.MustRegister(ingestActiveConnections)
 	prometheus.MustRegister(ingestEventsPerClient)
+	prometheus.MustRegister(ingestPathTracesTotal)
+	prometheus.MustRegister(ingestHeartbeatsTotal)
+	prometheus.MustRegister(ingestClockSkew)
+	prometheus.MustRegister(ingestClockSkewedEvents)
 }
 
 // TokenBucket implements a simple token bucket rate limiter
@@ -156,6 +204,14 @@ type IngestAPI struct {
 	limiterMu    sync.RWMutex
 	rateLimit    int
 	rateBurst    int
+
+	// Clock skew handling, see models.ApplyClockSkew
+	maxClockSkew  time.Duration
+	clockSkewMode string
+
+	// credentials verifies enrolled probe tokens; nil accepts only the
+	// static tokens
+	credentials *ProbeCredentials
 }
 
 // NewIngestAPI creates a new ingest API server
@@ -168,11 +224,13 @@ func NewIngestAPI(processor models.EventProcessor, tokens []string, rateLimit, r
 	}
 
 	return &IngestAPI{
-		processor:    processor,
-		validTokens:  validTokens,
-		rateLimiters: make(map[string]*TokenBucket),
-		rateLimit:    rateLimit,
-		rateBurst:    rateBurst,
+		processor:     processor,
+		validTokens:   validTokens,
+		rateLimiters:  make(map[string]*TokenBucket),
+		rateLimit:     rateLimit,
+		rateBurst:     rateBurst,
+		maxClockSkew:  5 * time.Second,
+		clockSkewMode: models.ClockSkewModeCorrect,
 	}
 }
 
@@ -209,7 +267,7 @@ func (api *IngestAPI) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		defer ingestActiveConnections.Dec()
 
 		// If no tokens are configured, skip authentication
-		if len(api.validTokens) == 0 {
+		if len(api.validTokens) == 0 && api.credentials == nil {
 			next(w, r)
 			return
 		}
@@ -236,10 +294,29 @@ func (api *IngestAPI) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Validate token
 		if !api.validTokens[token] {
-			ingestRequestsTotal.WithLabelValues("auth_error").Inc()
-			ingestAuthFailures.WithLabelValues("invalid_token").Inc()
-			http.Error(w, "Invalid API token", http.StatusUnauthorized)
-			return
+			if api.credentials == nil {
+				ingestRequestsTotal.WithLabelValues("auth_error").Inc()
+				ingestAuthFailures.WithLabelValues("invalid_token").Inc()
+				http.Error(w, "Invalid API token", http.StatusUnauthorized)
+				return
+			}
+
+			// Enrolled probe tokens are bound to the probe's client ID
+			clientID, err := api.credentials.Lookup(r.Context(), token)
+			if err != nil {
+				ingestRequestsTotal.WithLabelValues("auth_error").Inc()
+				ingestAuthFailures.WithLabelValues("lookup_error").Inc()
+				log.Printf("Failed to look up probe credential: %v", err)
+				http.Error(w, "Failed to verify API token", http.StatusServiceUnavailable)
+				return
+			}
+			if clientID == "" {
+				ingestRequestsTotal.WithLabelValues("auth_error").Inc()
+				ingestAuthFailures.WithLabelValues("invalid_token").Inc()
+				http.Error(w, "Invalid API token", http.StatusUnauthorized)
+				return
+			}
+			r = withBoundClientID(r, clientID)
 		}
 
 		// Token valid, proceed to next handler
@@ -295,6 +372,13 @@ func (api *IngestAPI) handleIngestEvent(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !clientIDAllowed(r, event.ClientID) {
+		status = "auth_error"
+		ingestAuthFailures.WithLabelValues("client_mismatch").Inc()
+		http.Error(w, "Token is not valid for this client_id", http.StatusForbidden)
+		return
+	}
+
 	// Add event attributes to span for debugging
 	// Requirement: 6.5 - Span attributes for debugging
 	span.SetAttributes(
@@ -312,6 +396,27 @@ func (api *IngestAPI) handleIngestEvent(w http.ResponseWriter, r *http.Request)
 	recvTs := time.Now().UnixMilli()
 	event.RecvTimestampMs = &recvTs
 
+	// Correct or flag misclocked probes before validating ts_ms so they
+	// land in the right aggregation windows
+	corrected := models.ApplyClockSkew(&event, recvTs, api.maxClockSkew.Milliseconds(), api.clockSkewMode)
+	if event.ClockSkewMs != nil {
+		skew := *event.ClockSkewMs
+		if skew < 0 {
+			skew = -skew
+		}
+		ingestClockSkew.Observe(float64(skew) / 1000.0)
+		span.SetAttributes(attribute.Int64("event.clock_skew_ms", *event.ClockSkewMs))
+	}
+	if event.ClockSkewed {
+		action := "flagged"
+		if corrected {
+			action = "corrected"
+		}
+		ingestClockSkewedEvents.WithLabelValues(action).Inc()
+		log.Printf("Clock skew of %dms on event %s from client %s (%s)",
+			*event.ClockSkewMs, event.EventID, event.ClientID, action)
+	}
+
 	// Validate schema version
 	// Requirement: 10.2 - Request validation with schema version checking
 	if event.SchemaVersion == "" {
@@ -333,8 +438,14 @@ func (api *IngestAPI) handleIngestEvent(w http.ResponseWriter, r *http.Request)
 		tracing.AddSpanEvent(ctx, "schema_version.unknown", attribute.String("version", event.SchemaVersion))
 	}
 
-	// Validate event structure
-	if err := event.Validate(); err != nil {
+	// Validate event structure. A flagged event is validated at its
+	// estimated true time, so a probe clock far ahead does not get its
+	// events rejected as coming from the future.
+	validated := event
+	if event.ClockSkewed && !corrected {
+		validated.TimestampMs += *event.ClockSkewMs
+	}
+	if err := validated.Validate(); err != nil {
 		status = "validation_error"
 		tracing.RecordError(ctx, err)
 		log.Printf("Event validation failed: %v", err)
@@ -384,6 +495,185 @@ func (api *IngestAPI) handleIngestEvent(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// handlePathTrace handles POST /path-traces for hop-by-hop path traces,
+// which are published under their own subject rather than as telemetry events
+func (api *IngestAPI) handlePathTrace(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := tracing.GetTracer("ingest-api")
+	ctx, span := tracer.Start(ctx, "ingest.handlePathTrace")
+	defer span.End()
+
+	status := "success"
+	defer func() {
+		ingestPathTracesTotal.WithLabelValues(status).Inc()
+		span.SetAttributes(attribute.String("http.status", status))
+	}()
+
+	if r.Method != http.MethodPost {
+		status = "method_not_allowed"
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	publisher, ok := api.processor.(models.PathTraceProcessor)
+	if !ok {
+		status = "publish_error"
+		http.Error(w, "Path traces are not supported by this queue", http.StatusNotImplemented)
+		return
+	}
+
+	var trace models.PathTraceEvent
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&trace); err != nil {
+		status = "validation_error"
+		tracing.RecordError(ctx, err)
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !clientIDAllowed(r, trace.ClientID) {
+		status = "auth_error"
+		ingestAuthFailures.WithLabelValues("client_mismatch").Inc()
+		http.Error(w, "Token is not valid for this client_id", http.StatusForbidden)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("event.id", trace.EventID),
+		attribute.String("event.client_id", trace.ClientID),
+		attribute.String("event.target", trace.Target),
+		attribute.Int("path.hops", len(trace.Hops)),
+	)
+
+	recvTs := time.Now().UnixMilli()
+	trace.RecvTimestampMs = &recvTs
+
+	if err := trace.Validate(); err != nil {
+		status = "validation_error"
+		tracing.RecordError(ctx, err)
+		log.Printf("Path trace validation failed: %v", err)
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Path traces share the per-client rate limit with events
+	if !api.getRateLimiter(trace.ClientID).Allow() {
+		status = "rate_limited"
+		ingestRateLimitHits.WithLabelValues(metrics.HashClientID(trace.ClientID)).Inc()
+		http.Error(w, "Rate limit exceeded. Please slow down your requests.", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := publisher.PublishPathTrace(&trace); err != nil {
+		status = "publish_error"
+		tracing.RecordError(ctx, err)
+		log.Printf("Failed to publish path trace %s: %v", trace.EventID, err)
+		http.Error(w, "Failed to publish path trace", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Successfully ingested path trace %s from client %s (%d hops)", trace.EventID, trace.ClientID, len(trace.Hops))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":   "accepted",
+		"event_id": trace.EventID,
+	})
+}
+
+// handleHeartbeat handles POST /heartbeats for probe liveness. Heartbeats
+// are small and infrequent, so they bypass the per-client rate limit; a
+// probe flooding events must not look offline.
+func (api *IngestAPI) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := tracing.GetTracer("ingest-api")
+	ctx, span := tracer.Start(ctx, "ingest.handleHeartbeat")
+	defer span.End()
+
+	status := "success"
+	defer func() {
+		ingestHeartbeatsTotal.WithLabelValues(status).Inc()
+		span.SetAttributes(attribute.String("http.status", status))
+	}()
+
+	if r.Method != http.MethodPost {
+		status = "method_not_allowed"
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	publisher, ok := api.processor.(models.HeartbeatProcessor)
+	if !ok {
+		status = "publish_error"
+		http.Error(w, "Heartbeats are not supported by this queue", http.StatusNotImplemented)
+		return
+	}
+
+	var heartbeat models.Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&heartbeat); err != nil {
+		status = "validation_error"
+		tracing.RecordError(ctx, err)
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	recvTs := time.Now().UnixMilli()
+	heartbeat.RecvTimestampMs = &recvTs
+
+	if err := heartbeat.Validate(); err != nil {
+		status = "validation_error"
+		tracing.RecordError(ctx, err)
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !clientIDAllowed(r, heartbeat.ClientID) {
+		status = "auth_error"
+		ingestAuthFailures.WithLabelValues("client_mismatch").Inc()
+		http.Error(w, "Token is not valid for this client_id", http.StatusForbidden)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("event.client_id", heartbeat.ClientID),
+		attribute.String("probe.version", heartbeat.ProbeVersion),
+	)
+
+	if err := publisher.PublishHeartbeat(&heartbeat); err != nil {
+		status = "publish_error"
+		tracing.RecordError(ctx, err)
+		log.Printf("Failed to publish heartbeat from %s: %v", heartbeat.ClientID, err)
+		http.Error(w, "Failed to publish heartbeat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "accepted",
+	})
+}
+
+// handleTime handles GET /time, the server half of the probe's NTP-style
+// clock offset estimation. The probe passes its send time as ?t0=.
+func (api *IngestAPI) handleTime(w http.ResponseWriter, r *http.Request) {
+	recv := time.Now()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := models.ClockSyncResponse{ServerRecvMs: models.UnixMillis(recv)}
+	if t0, err := strconv.ParseFloat(r.URL.Query().Get("t0"), 64); err == nil {
+		resp.ClientSendMs = t0
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	resp.ServerSendMs = models.UnixMillis(time.Now())
+	json.NewEncoder(w).Encode(resp)
+}
+
 // handleHealth handles GET /health for health checks
 func (api *IngestAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -401,6 +691,10 @@ func main() {
 	log.Printf("Port: %s", *port)
 	log.Printf("NATS URL: %s", *natsURL)
 	log.Printf("Rate limit: %d req/s per client (burst: %d)", *rateLimit, *rateLimitBurst)
+	if !models.ValidClockSkewMode(*clockSkewMode) {
+		log.Fatalf("Invalid -clock-skew-mode %q (want correct or flag)", *clockSkewMode)
+	}
+	log.Printf("Max clock skew: %v (%s)", *maxClockSkew, *clockSkewMode)
 
 	// Initialize OpenTelemetry tracing
 	// Requirement: 6.4 - Distributed tracing setup
@@ -423,7 +717,7 @@ func main() {
 	if *apiTokens != "" {
 		tokens = strings.Split(*apiTokens, ",")
 		log.Printf("Loaded %d API token(s)", len(tokens))
-	} else {
+	} else if !*probeCredentials {
 		log.Printf("WARNING: No API tokens configured, authentication is disabled")
 	}
 
@@ -448,11 +742,34 @@ func main() {
 
 	// Create ingest API with rate limiting
 	api := NewIngestAPI(processor, tokens, *rateLimit, *rateLimitBurst)
+	api.maxClockSkew = *maxClockSkew
+	api.clockSkewMode = *clockSkewMode
+
+	if *probeCredentials {
+		dbConfig := database.DefaultConnectionConfig()
+		dbConfig.Host = *dbHost
+		dbConfig.Port = *dbPort
+		dbConfig.Database = *dbName
+		dbConfig.User = *dbUser
+		dbConfig.Password = *dbPassword
+
+		dbConn, err := database.NewConnection(dbConfig)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer dbConn.Close()
+
+		api.credentials = NewProbeCredentials(database.NewEnrollmentRepository(dbConn))
+		log.Printf("Accepting enrolled probe credentials from %s:%d/%s", *dbHost, *dbPort, *dbName)
+	}
 
 	// Set up HTTP routes with OpenTelemetry instrumentation
 	// Requirement: 6.4 - HTTP request tracing with context propagation
 	http.Handle("/health", otelhttp.NewHandler(http.HandlerFunc(api.handleHealth), "health"))
+	http.Handle("/heartbeats", otelhttp.NewHandler(http.HandlerFunc(api.authMiddleware(api.handleHeartbeat)), "ingest.heartbeats"))
+	http.Handle("/time", otelhttp.NewHandler(http.HandlerFunc(api.handleTime), "ingest.time"))
 	http.Handle("/events", otelhttp.NewHandler(http.HandlerFunc(api.authMiddleware(api.handleIngestEvent)), "ingest.events"))
+	http.Handle("/path-traces", otelhttp.NewHandler(http.HandlerFunc(api.authMiddleware(api.handlePathTrace)), "ingest.path_traces"))
 	http.Handle("/metrics", promhttp.Handler())
 
 	// Start HTTP server
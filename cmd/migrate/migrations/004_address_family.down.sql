@@ -0,0 +1,10 @@
+-- Rollback address family dimension
+
+DROP INDEX IF EXISTS idx_agg_1m_target_family_window;
+
+DELETE FROM agg_1m WHERE address_family <> '';
+
+ALTER TABLE agg_1m DROP CONSTRAINT IF EXISTS agg_1m_pkey;
+ALTER TABLE agg_1m ADD PRIMARY KEY (client_id, target, window_start_ts);
+
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS address_family;
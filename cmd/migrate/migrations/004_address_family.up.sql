@@ -0,0 +1,14 @@
+-- Add address family dimension to aggregates so IPv4 and IPv6 measurements
+-- of the same target are aggregated and baselined separately
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS address_family VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE agg_1m DROP CONSTRAINT IF EXISTS agg_1m_pkey;
+ALTER TABLE agg_1m ADD PRIMARY KEY (client_id, target, address_family, window_start_ts);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_agg_1m_target_family_window') THEN
+        CREATE INDEX idx_agg_1m_target_family_window ON agg_1m(target, address_family, window_start_ts DESC);
+    END IF;
+END $$;
@@ -0,0 +1 @@
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS assertion_error_count;
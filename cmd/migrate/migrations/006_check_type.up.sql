@@ -0,0 +1,15 @@
+-- Add check type dimension (http, tcp, udp) to aggregates so non-HTTP
+-- reachability checks flow through the same pipeline as HTTP measurements
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS check_type VARCHAR(16) NOT NULL DEFAULT 'http';
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS udp_error_count BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE agg_1m DROP CONSTRAINT IF EXISTS agg_1m_pkey;
+ALTER TABLE agg_1m ADD PRIMARY KEY (client_id, target, address_family, check_type, window_start_ts);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_agg_1m_check_type_window') THEN
+        CREATE INDEX idx_agg_1m_check_type_window ON agg_1m(check_type, window_start_ts DESC);
+    END IF;
+END $$;
@@ -0,0 +1,11 @@
+-- Packet loss, reordering, RTT and jitter from udp-echo checks, aggregated
+-- per window
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS packets_sent BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS packets_lost BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS reordered_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS loss_rate DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS rtt_p50 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS rtt_p95 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS jitter_p50 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS jitter_p95 DOUBLE PRECISION;
@@ -0,0 +1,2 @@
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS upload_p95;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS upload_p50;
@@ -0,0 +1,21 @@
+-- Per-client clock skew statistics, updated by the aggregator from the skew
+-- ingest attributes to each event (server clock minus probe clock). Bucket
+-- counters hold the distribution of absolute skew.
+
+CREATE TABLE IF NOT EXISTS client_clock_skew (
+    client_id VARCHAR(255) PRIMARY KEY,
+    samples BIGINT NOT NULL DEFAULT 0,
+    skewed_events BIGINT NOT NULL DEFAULT 0,
+    corrected_events BIGINT NOT NULL DEFAULT 0,
+    last_skew_ms BIGINT NOT NULL DEFAULT 0,
+    min_skew_ms BIGINT NOT NULL DEFAULT 0,
+    max_skew_ms BIGINT NOT NULL DEFAULT 0,
+    sum_abs_skew_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    skew_lt_100ms BIGINT NOT NULL DEFAULT 0,
+    skew_lt_1s BIGINT NOT NULL DEFAULT 0,
+    skew_lt_10s BIGINT NOT NULL DEFAULT 0,
+    skew_lt_60s BIGINT NOT NULL DEFAULT 0,
+    skew_ge_60s BIGINT NOT NULL DEFAULT 0,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,23 @@
+-- Latest heartbeat per probe, used for liveness tracking independent of
+-- measurement results
+
+CREATE TABLE IF NOT EXISTS probe_heartbeats (
+    client_id VARCHAR(255) PRIMARY KEY,
+    probe_version VARCHAR(64) NOT NULL DEFAULT '',
+    config_version VARCHAR(64) NOT NULL DEFAULT '',
+    uptime_seconds BIGINT NOT NULL DEFAULT 0,
+    interval_seconds INTEGER NOT NULL,
+    targets INTEGER NOT NULL DEFAULT 0,
+    queue_depth INTEGER NOT NULL DEFAULT 0,
+    dropped_events BIGINT NOT NULL DEFAULT 0,
+    hostname VARCHAR(255) NOT NULL DEFAULT '',
+    os VARCHAR(32) NOT NULL DEFAULT '',
+    arch VARCHAR(32) NOT NULL DEFAULT '',
+    num_cpu INTEGER NOT NULL DEFAULT 0,
+    go_version VARCHAR(32) NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_probe_heartbeats_last_seen ON probe_heartbeats(last_seen_at);
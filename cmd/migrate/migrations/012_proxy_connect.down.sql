@@ -0,0 +1,3 @@
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS proxy_error_count;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS proxy_connect_p95;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS proxy_connect_p50;
@@ -0,0 +1,6 @@
+-- Proxy connect time and proxy handshake failures from measurements routed
+-- through an HTTP CONNECT or SOCKS5 proxy
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS proxy_connect_p50 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS proxy_connect_p95 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS proxy_error_count BIGINT NOT NULL DEFAULT 0;
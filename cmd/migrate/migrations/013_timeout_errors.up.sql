@@ -0,0 +1,4 @@
+-- Errors where the failing stage ran out of time (a per-stage or overall
+-- measurement timeout); the stage itself is still counted in its error column
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS timeout_error_count BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+-- Per-window statistics of custom metrics reported by probe collectors
+-- (Wi-Fi signal, CPU load, gateway ping, exec plugins), one row per metric
+-- keyed like agg_1m
+
+CREATE TABLE IF NOT EXISTS agg_1m_custom_metrics (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    window_start_ts TIMESTAMP NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    sample_count BIGINT NOT NULL DEFAULT 0,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    mean_value DOUBLE PRECISION NOT NULL,
+    p50 DOUBLE PRECISION NOT NULL,
+    p95 DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type, window_start_ts, metric)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agg_1m_custom_metrics_window ON agg_1m_custom_metrics(window_start_ts);
+CREATE INDEX IF NOT EXISTS idx_agg_1m_custom_metrics_metric_window ON agg_1m_custom_metrics(metric, window_start_ts DESC);
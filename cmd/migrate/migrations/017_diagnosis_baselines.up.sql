@@ -0,0 +1,29 @@
+-- Baselines maintained incrementally by the diagnoser, one row per series
+-- (client, target, address family, check type), strategy and bucket. The
+-- hour_of_week strategy keeps one row per hour of the week (bucket 0-167);
+-- the other strategies use bucket 0.
+
+CREATE TABLE IF NOT EXISTS diagnosis_baselines (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    strategy VARCHAR(16) NOT NULL,
+    bucket SMALLINT NOT NULL DEFAULT 0,
+    state JSONB NOT NULL,
+    window_count INT NOT NULL DEFAULT 0,
+    last_window_ts TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type, strategy, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_diagnosis_baselines_updated ON diagnosis_baselines(updated_at);
+
+-- Per-target baseline strategy; targets without a row use the diagnoser's
+-- default strategy
+CREATE TABLE IF NOT EXISTS target_baseline_strategies (
+    target VARCHAR(255) PRIMARY KEY,
+    strategy VARCHAR(16) NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
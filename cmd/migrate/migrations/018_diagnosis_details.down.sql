@@ -0,0 +1,2 @@
+ALTER TABLE diagnosis_history DROP COLUMN IF EXISTS details;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS diagnosis_details;
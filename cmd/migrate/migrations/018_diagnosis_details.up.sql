@@ -0,0 +1,5 @@
+-- Full diagnosis result: every issue found in the window with its
+-- confidence and the metric values, baselines and thresholds that fired
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS diagnosis_details JSONB;
+ALTER TABLE diagnosis_history ADD COLUMN IF NOT EXISTS details JSONB;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS correlated_incidents;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS user_label;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS as_org;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS asn;
@@ -0,0 +1,28 @@
+-- Network attributes of the probe in each window, for grouping clients that
+-- share an ASN or label
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS asn INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS as_org VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS user_label VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Incidents correlated by the diagnoser across the series of a window: one
+-- row per target-wide, client-wide (client, ASN or label) or localized
+-- (client and target) group of anomalies
+
+CREATE TABLE IF NOT EXISTS correlated_incidents (
+    id BIGSERIAL PRIMARY KEY,
+    window_start_ts TIMESTAMP NOT NULL,
+    scope VARCHAR(16) NOT NULL,
+    incident_key VARCHAR(600) NOT NULL,
+    label VARCHAR(50) NOT NULL,
+    labels JSONB NOT NULL,
+    clients JSONB NOT NULL,
+    targets JSONB NOT NULL,
+    affected INT NOT NULL DEFAULT 0,
+    observed INT NOT NULL DEFAULT 0,
+    revision INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (window_start_ts, scope, incident_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_correlated_incidents_window ON correlated_incidents(window_start_ts DESC);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_alerts_open_incident;
+ALTER TABLE alerts DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE alerts DROP COLUMN IF EXISTS assigned_to;
+ALTER TABLE alerts DROP COLUMN IF EXISTS acknowledged_by;
+ALTER TABLE alerts DROP COLUMN IF EXISTS acknowledged_at;
+ALTER TABLE alerts DROP COLUMN IF EXISTS healthy_windows;
+ALTER TABLE alerts DROP COLUMN IF EXISTS anomalous_windows;
+ALTER TABLE alerts DROP COLUMN IF EXISTS last_window_ts;
+ALTER TABLE alerts DROP COLUMN IF EXISTS last_anomalous_ts;
+ALTER TABLE alerts DROP COLUMN IF EXISTS targets;
+ALTER TABLE alerts DROP COLUMN IF EXISTS clients;
+ALTER TABLE alerts DROP COLUMN IF EXISTS diagnosis;
+ALTER TABLE alerts DROP COLUMN IF EXISTS incident_key;
+ALTER TABLE alerts DROP COLUMN IF EXISTS scope;
@@ -0,0 +1,22 @@
+-- Incidents opened by the diagnoser when an anomaly is correlated in
+-- consecutive windows. An incident is an alerts row with alert_type
+-- 'incident'; client_id and target hold the single client or target
+-- involved, or '*' for several.
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS scope VARCHAR(16);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS incident_key VARCHAR(600);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS diagnosis VARCHAR(50);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS clients JSONB;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS targets JSONB;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS last_anomalous_ts TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS last_window_ts TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS anomalous_windows INT NOT NULL DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS healthy_windows INT NOT NULL DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS acknowledged_by VARCHAR(255);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS assigned_to VARCHAR(255);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
+
+-- At most one unresolved incident per scope and key
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_incident ON alerts(scope, incident_key)
+    WHERE alert_type = 'incident' AND resolved_at IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE alerts DROP COLUMN IF EXISTS silence_id;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS maintenance;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS silences;
+DROP TABLE IF EXISTS silences;
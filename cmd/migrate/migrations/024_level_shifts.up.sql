@@ -0,0 +1,34 @@
+-- Change-point detection. The diagnoser keeps a CUSUM detector per series
+-- and metric and records the level shifts it detects.
+CREATE TABLE IF NOT EXISTS change_point_states (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    state JSONB NOT NULL,
+    last_window_ts TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_point_states_updated ON change_point_states(updated_at);
+
+CREATE TABLE IF NOT EXISTS level_shifts (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    metric VARCHAR(32) NOT NULL,
+    direction VARCHAR(8) NOT NULL,
+    before_level DOUBLE PRECISION NOT NULL,
+    after_level DOUBLE PRECISION NOT NULL,
+    change DOUBLE PRECISION NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    detected_at TIMESTAMP NOT NULL,
+    windows INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (client_id, target, address_family, check_type, metric, detected_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_level_shifts_detected ON level_shifts(detected_at);
@@ -0,0 +1,4 @@
+-- Timed out errors by the stage that ran out of time, e.g. {"TLS": 3};
+-- their total is timeout_error_count
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS timeout_stage_counts JSONB;
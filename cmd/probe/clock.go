@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+// clockSyncSamples is the number of exchanges per clock sync
+const clockSyncSamples = 5
+
+// clockSync is nil when clock sync is disabled
+var clockSync *ClockSync
+
+// ClockSync keeps an up-to-date estimate of the probe's clock offset against
+// the ingest server, which is reported with every event so ingest can correct
+// misclocked probes
+type ClockSync struct {
+	timeURL  string
+	interval time.Duration
+
+	mu       sync.RWMutex
+	estimate *probe.ClockEstimate
+}
+
+// NewClockSync creates a clock sync against the ingest time endpoint
+func NewClockSync(timeURL string, interval time.Duration) *ClockSync {
+	return &ClockSync{timeURL: timeURL, interval: interval}
+}
+
+// Start syncs in the background, once right away and then every interval,
+// until ctx is cancelled. Events carry no offset until the first sync
+// succeeds.
+func (cs *ClockSync) Start(ctx context.Context) {
+	go func() {
+		cs.sync(ctx)
+		ticker := time.NewTicker(cs.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cs.sync(ctx)
+			}
+		}
+	}()
+}
+
+// sync runs one clock offset estimation, keeping the previous estimate if it
+// fails
+func (cs *ClockSync) sync(ctx context.Context) {
+	estimate, err := probe.EstimateClockOffset(ctx, cs.timeURL, clockSyncSamples)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("Clock sync failed: %v", err)
+		return
+	}
+
+	cs.mu.Lock()
+	cs.estimate = estimate
+	cs.mu.Unlock()
+	log.Printf("Clock offset: %+.1fms (±%.1fms, %d samples)", estimate.OffsetMs, estimate.RTTMs/2, estimate.Samples)
+}
+
+// OffsetMs returns the latest offset estimate, or nil if there is none or
+// it is older than three sync intervals
+func (cs *ClockSync) OffsetMs() *float64 {
+	if cs == nil {
+		return nil
+	}
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cs.estimate == nil || time.Since(cs.estimate.MeasuredAt) > 3*cs.interval {
+		return nil
+	}
+	offset := cs.estimate.OffsetMs
+	return &offset
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// collectionTimeout bounds a collection pass in case a collector ignores its
+// own timeout
+const collectionTimeout = 30 * time.Second
+
+// CollectorRunner runs the configured metric collectors once per cycle and
+// merges their results into the custom metrics attached to that cycle's events
+type CollectorRunner struct {
+	collectors []plugin.MetricCollector
+
+	// lastErr is the last error logged per collector, so a persistently
+	// failing collector is reported once rather than every cycle
+	mu      sync.Mutex
+	lastErr map[string]string
+}
+
+// NewCollectorRunner loads collectors from the -collectors list and the
+// -collectors-file, returning nil when none are configured
+func NewCollectorRunner(list, path string) (*CollectorRunner, error) {
+	configs, err := probe.ParseCollectorList(list)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		fileConfigs, err := probe.LoadCollectors(path)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, fileConfigs...)
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	registry, err := probe.NewCollectorRegistry(configs)
+	if err != nil {
+		return nil, err
+	}
+	return &CollectorRunner{
+		collectors: registry.Collectors(),
+		lastErr:    make(map[string]string),
+	}, nil
+}
+
+// Names returns the names of the configured collectors
+func (r *CollectorRunner) Names() []string {
+	names := make([]string, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// Collect runs all collectors in parallel and returns their metrics keyed by
+// "<collector>.<metric>", or nil if there are none. Failing collectors are
+// left out.
+func (r *CollectorRunner) Collect(ctx context.Context) map[string]float64 {
+	if r == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, collectionTimeout)
+	defer cancel()
+
+	results := make([]map[string]float64, len(r.collectors))
+	var wg sync.WaitGroup
+	for i, c := range r.collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics, err := c.Collect(ctx)
+			if ctx.Err() != nil && err != nil {
+				// Shutting down or the pass timed out; not the collector's fault
+				return
+			}
+			r.record(c.Name(), err)
+			if err == nil {
+				results[i] = metrics
+			}
+		}()
+	}
+	wg.Wait()
+
+	merged := make(map[string]float64)
+	for i, metrics := range results {
+		name := r.collectors[i].Name()
+		for metric, value := range metrics {
+			key := name + "." + metric
+			if !models.ValidCustomMetricName(key) {
+				r.record(name, fmt.Errorf("invalid metric name %q", metric))
+				continue
+			}
+			if len(merged) >= models.MaxCustomMetrics {
+				r.record(name, fmt.Errorf("more than %d custom metrics, dropping the rest", models.MaxCustomMetrics))
+				break
+			}
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// record counts a collector run and logs changes in its error state
+func (r *CollectorRunner) record(name string, err error) {
+	status := "success"
+	msg := ""
+	if err != nil {
+		status = "error"
+		msg = err.Error()
+	}
+	probeCollectorRunsTotal.WithLabelValues(name, status).Inc()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastErr[name] == msg {
+		return
+	}
+	r.lastErr[name] = msg
+	if err != nil {
+		log.Printf("Collector %s failed: %v", name, err)
+	} else {
+		log.Printf("Collector %s recovered", name)
+	}
+}
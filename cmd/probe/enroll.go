@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+// runEnroll implements "probe enroll --code X --server URL": it exchanges an
+// enrollment code for the probe's client ID, ingest token and initial config
+// and stores them for later runs
+func runEnroll(args []string) {
+	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
+	code := fs.String("code", "", "Enrollment code created in the admin API")
+	server := fs.String("server", "", "Admin API base URL (e.g. http://server:9000)")
+	fs.Parse(args)
+
+	if *code == "" || *server == "" {
+		fmt.Fprintln(os.Stderr, "usage: probe enroll --code CODE --server URL")
+		os.Exit(2)
+	}
+
+	req := &models.EnrollRequest{
+		Code:         *code,
+		ProbeVersion: version,
+	}
+	// Offer the existing client ID so history is kept across re-enrollment
+	if id, err := probe.GetOrCreateClientID(); err == nil {
+		req.ClientID = id
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		req.Hostname = hostname
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	enrollment, err := probe.Enroll(ctx, *server, req)
+	if err != nil {
+		log.Fatalf("Enrollment failed: %v", err)
+	}
+	if err := probe.SaveEnrollment(enrollment); err != nil {
+		log.Fatalf("Failed to save enrollment: %v", err)
+	}
+
+	log.Printf("Enrolled as %s (enrollment %s)", enrollment.ClientID, enrollment.EnrollmentID)
+	log.Printf("Ingest URL: %s", enrollment.IngestURL)
+	log.Printf("Run ./probe to start measuring with the enrolled configuration")
+}
+
+// applyEnrollment uses the stored enrollment, if any, for the client ID,
+// ingest URL, API token, targets and interval unless they were set with
+// flags. It returns the enrolled targets, or nil to use the target flags.
+func applyEnrollment() ([]probe.TargetConfig, error) {
+	enrollment, err := probe.LoadEnrollment()
+	if err != nil || enrollment == nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if !set["client-id"] && os.Getenv("TELEMETRY_CLIENT_ID") == "" {
+		*clientID = enrollment.ClientID
+	}
+	if !set["ingest-url"] && enrollment.IngestURL != "" {
+		*ingestURL = enrollment.IngestURL
+	}
+	if !set["api-token"] {
+		*apiToken = enrollment.APIToken
+	}
+	if !set["interval"] && enrollment.IntervalSeconds > 0 {
+		*interval = time.Duration(enrollment.IntervalSeconds) * time.Second
+	}
+	log.Printf("Using enrollment %s from %s", enrollment.EnrollmentID, enrollment.Server)
+
+	if set["target"] || set["targets-file"] || len(enrollment.Targets) == 0 {
+		return nil, nil
+	}
+	return probe.ParseTargets(enrollment.Targets, "enrolled targets")
+}
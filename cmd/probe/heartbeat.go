@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// version is the probe build version, set with -ldflags "-X main.version=..."
+var version = "dev"
+
+// heartbeatSender periodically reports the probe's liveness and health to
+// ingest. Heartbeats are not queued or retried: the next one supersedes a
+// lost one.
+func heartbeatSender(status *ProbeStatus, heartbeatURL, apiToken string, every time.Duration) {
+	host := models.HostInfo{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		host.Hostname = hostname
+	}
+
+	intervalSeconds := int(every.Round(time.Second).Seconds())
+	if intervalSeconds < 1 {
+		intervalSeconds = 1
+	}
+
+	send := func() {
+		heartbeat := status.Heartbeat(intervalSeconds, host)
+		err := postToIngest(heartbeat, heartbeatURL, apiToken)
+		status.RecordSend("heartbeat", err)
+		if err != nil {
+			log.Printf("Failed to send heartbeat: %v", err)
+		}
+	}
+
+	send()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		send()
+	}
+}
+
+// Heartbeat builds a heartbeat from the probe's current state
+func (ps *ProbeStatus) Heartbeat(intervalSeconds int, host models.HostInfo) *models.Heartbeat {
+	return &models.Heartbeat{
+		ClientID:        ps.clientID,
+		TimestampMs:     time.Now().UnixMilli(),
+		ProbeVersion:    version,
+		UptimeSeconds:   int64(time.Since(ps.startedAt).Seconds()),
+		ConfigVersion:   ps.configVersion,
+		IntervalSeconds: intervalSeconds,
+		Targets:         len(ps.targets),
+		QueueDepth:      ps.queue.Depth(),
+		DroppedEvents:   int64(ps.queue.DroppedCount()),
+		Host:            host,
+	}
+}
@@ -8,6 +8,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,26 +29,38 @@ import (
 var (
 	target         = flag.String("target", "https://example.com", "Target URL to measure")
 	throughputURL  = flag.String("throughput-url", "", "URL for throughput testing (defaults to target/fixed/1mb.bin)")
+	targetsFile    = flag.String("targets-file", "", "JSON file listing targets with per-target request and assertion settings (overrides -target)")
 	interval       = flag.Duration("interval", 60*time.Second, "Measurement interval")
 	ingestURL      = flag.String("ingest-url", "http://localhost:8080/events", "Ingest API URL")
+	timeURL        = flag.String("time-url", "", "Ingest time endpoint for clock offset estimation (defaults to -ingest-url with the last path element replaced by time)")
+	clockSyncEvery = flag.Duration("clock-sync-interval", 10*time.Minute, "How often to re-estimate the clock offset against the ingest server (0 disables)")
+	pathTraceURL   = flag.String("path-trace-url", "", "Ingest URL for path traces (defaults to -ingest-url with the last path element replaced by path-traces)")
+	heartbeatURL   = flag.String("heartbeat-url", "", "Ingest URL for heartbeats (defaults to -ingest-url with the last path element replaced by heartbeats)")
+	heartbeatEvery = flag.Duration("heartbeat-interval", 30*time.Second, "How often to send a heartbeat to ingest (0 disables)")
 	apiToken       = flag.String("api-token", "", "API token for authentication")
 	clientID       = flag.String("client-id", "", "Client ID (auto-generated if not provided)")
 	once           = flag.Bool("once", false, "Run once and exit")
-	interfaceType  = flag.String("interface", "ethernet", "Network interface type (wifi, ethernet, cellular)")
-	vpnEnabled     = flag.Bool("vpn", false, "Whether VPN is enabled")
+	interfaceType  = flag.String("interface", interfaceAuto, "Network interface type (wifi, ethernet, cellular); auto detects it per measurement")
+	vpnEnabled     = flag.Bool("vpn", false, "Whether VPN is enabled (detected per measurement unless set)")
+	publicIPURL    = flag.String("public-ip-url", "", "JSON endpoint echoing the caller's public IP and ASN (e.g. https://ipinfo.io/json); empty disables the lookup")
 	userLabel      = flag.String("label", "", "Optional user-defined label")
+	addressFamily  = flag.String("address-family", "", "Comma-separated address families to measure separately (ipv4, ipv6, happy-eyeballs); empty uses the system default")
 	schemaVersion  = flag.String("schema", "1.0", "Event schema version")
 	queueSize      = flag.Int("queue-size", 100, "Maximum number of events to buffer")
 	maxBackoff     = flag.Duration("max-backoff", 60*time.Second, "Maximum backoff duration for retries")
 	otlpEndpoint   = flag.String("otlp-endpoint", "localhost:4318", "OpenTelemetry OTLP HTTP endpoint")
 	tracingEnabled = flag.Bool("tracing-enabled", true, "Enable distributed tracing")
+	collectorsList = flag.String("collectors", "", "Comma-separated built-in metric collectors (wifi, cpu, gateway_ping) whose readings are attached to events as custom_metrics")
+	collectorsFile = flag.String("collectors-file", "", "JSON file configuring built-in and exec metric collectors (combined with -collectors)")
+	statusAddr     = flag.String("status-addr", "", "Address for the local status server with /healthz, /status and /metrics (e.g. 127.0.0.1:9102); empty disables it")
 )
 
 // EventQueue implements a bounded queue with exponential backoff
 // Requirement: 8.2 - Backpressure with bounded local queue
 type EventQueue struct {
 	queue      chan *models.TelemetryEvent
-	droppedCnt int
+	droppedCnt atomic.Int64
+	pending    sync.WaitGroup
 }
 
 func NewEventQueue(size int) *EventQueue {
@@ -50,12 +70,15 @@ func NewEventQueue(size int) *EventQueue {
 }
 
 func (q *EventQueue) Enqueue(event *models.TelemetryEvent) bool {
+	q.pending.Add(1)
 	select {
 	case q.queue <- event:
 		return true
 	default:
-		q.droppedCnt++
-		log.Printf("Event queue full, dropping event %s (total dropped: %d)", event.EventID, q.droppedCnt)
+		q.pending.Done()
+		dropped := q.droppedCnt.Add(1)
+		probeEventsDroppedTotal.Inc()
+		log.Printf("Event queue full, dropping event %s (total dropped: %d)", event.EventID, dropped)
 		return false
 	}
 }
@@ -65,12 +88,51 @@ func (q *EventQueue) Dequeue() *models.TelemetryEvent {
 }
 
 func (q *EventQueue) DroppedCount() int {
-	return q.droppedCnt
+	return int(q.droppedCnt.Load())
+}
+
+// Done marks a dequeued event as sent
+func (q *EventQueue) Done() {
+	q.pending.Done()
+}
+
+// Wait blocks until every queued event has been sent or the timeout expires,
+// and reports whether the queue was drained
+func (q *EventQueue) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Depth returns the number of events waiting to be sent
+func (q *EventQueue) Depth() int {
+	return len(q.queue)
+}
+
+// Capacity returns the maximum number of queued events
+func (q *EventQueue) Capacity() int {
+	return cap(q.queue)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "enroll" {
+		runEnroll(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
+	// Cancel in-flight measurements and stop the loop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize OpenTelemetry tracing
 	// Requirement: 6.4 - Distributed tracing setup for probe
 	tracingConfig := tracing.DefaultConfig("probe")
@@ -87,6 +149,12 @@ func main() {
 		}
 	}()
 
+	// Settings from a previous "probe enroll" fill in unset flags
+	enrolledTargets, err := applyEnrollment()
+	if err != nil {
+		log.Fatalf("Failed to load enrollment: %v", err)
+	}
+
 	// Get or create stable client ID
 	var resolvedClientID string
 	if *clientID != "" {
@@ -99,55 +167,213 @@ func main() {
 		resolvedClientID = generatedID
 	}
 
-	log.Printf("WireScope Probe Agent")
+	log.Printf("WireScope Probe Agent %s", version)
 	log.Printf("Client ID: %s", resolvedClientID)
-	log.Printf("Target: %s", *target)
 	log.Printf("Interval: %v", *interval)
 	log.Printf("Queue size: %d", *queueSize)
 
-	// Set throughput URL if not specified
-	throughputEndpoint := *throughputURL
-	if throughputEndpoint == "" {
-		throughputEndpoint = *target + "/fixed/1mb.bin"
+	initNetworkContext()
+
+	families, err := parseAddressFamilies(*addressFamily)
+	if err != nil {
+		log.Fatalf("Invalid -address-family: %v", err)
+	}
+	if len(families) > 1 || families[0] != probe.AddressFamilyAny {
+		log.Printf("Address families: %s", strings.Join(families, ", "))
+	}
+
+	targets := enrolledTargets
+	if targets == nil {
+		targets, err = loadTargets()
+		if err != nil {
+			log.Fatalf("Failed to load targets: %v", err)
+		}
+	}
+	for _, t := range targets {
+		if t.Transaction != nil {
+			log.Printf("Transaction: %s (%d steps)", t.Transaction.Name, len(t.Transaction.Steps))
+		} else {
+			log.Printf("Target: %s", t.URL)
+		}
+	}
+
+	collectors, err := NewCollectorRunner(*collectorsList, *collectorsFile)
+	if err != nil {
+		log.Fatalf("Failed to load collectors: %v", err)
+	}
+	if collectors != nil {
+		log.Printf("Collectors: %s", strings.Join(collectors.Names(), ", "))
 	}
 
 	// Create event queue
 	eventQueue := NewEventQueue(*queueSize)
 
+	// Track progress for the local status server and self-metrics
+	status := NewProbeStatus(resolvedClientID, targets, *interval, eventQueue)
+	if *statusAddr != "" {
+		go status.Serve(*statusAddr)
+	}
+
 	// Start worker goroutine to send events with exponential backoff
 	// api-token is optional when server authentication is disabled
 	if *ingestURL != "" {
-		go eventSender(eventQueue, *ingestURL, *apiToken, *maxBackoff)
+		go eventSender(eventQueue, status, *ingestURL, *apiToken, *maxBackoff)
 	}
 
-	// Run measurement loop
-	for {
-		event := performMeasurement(resolvedClientID, *target, throughputEndpoint)
+	// Estimate the clock offset against ingest so it can correct our ts_ms
+	if *clockSyncEvery > 0 && (*ingestURL != "" || *timeURL != "") {
+		syncURL := *timeURL
+		if syncURL == "" {
+			syncURL, err = ingestSiblingURL(*ingestURL, "time")
+			if err != nil {
+				log.Fatalf("Failed to derive time URL: %v", err)
+			}
+		}
+		clockSync = NewClockSync(syncURL, *clockSyncEvery)
+		clockSync.Start(ctx)
+	}
 
-		// Enqueue event for sending (api-token is optional when auth is disabled)
-		if *ingestURL != "" {
-			queued := eventQueue.Enqueue(event)
-			if queued {
-				log.Printf("Queued event %s for sending", event.EventID)
+	// Heartbeats let the fleet view tell a stopped probe from a quiet one
+	if *heartbeatEvery > 0 && !*once && (*ingestURL != "" || *heartbeatURL != "") {
+		hbURL := *heartbeatURL
+		if hbURL == "" {
+			hbURL, err = ingestSiblingURL(*ingestURL, "heartbeats")
+			if err != nil {
+				log.Fatalf("Failed to derive heartbeat URL: %v", err)
 			}
 		}
+		go heartbeatSender(status, hbURL, *apiToken, *heartbeatEvery)
+	}
+
+	// Path traces are only run for targets with a path_trace block
+	pathTracer := NewPathTracer(resolvedClientID, *queueSize)
+	if *ingestURL != "" || *pathTraceURL != "" {
+		traceURL := *pathTraceURL
+		if traceURL == "" {
+			traceURL, err = ingestSiblingURL(*ingestURL, "path-traces")
+			if err != nil {
+				log.Fatalf("Failed to derive path trace URL: %v", err)
+			}
+		}
+		go pathTraceSender(pathTracer, status, traceURL, *apiToken, *maxBackoff)
+	}
+
+	// Run measurement loop
+	for ctx.Err() == nil {
+		// Host metrics are read once per cycle and shared by its events
+		customMetrics := collectors.Collect(ctx)
+	cycle:
+		for i := range targets {
+			for _, family := range targets[i].GetAddressFamilies(families) {
+				var events []*models.TelemetryEvent
+				checkType := targets[i].GetCheckType()
+				start := time.Now()
+				if targets[i].Transaction != nil {
+					checkType = "transaction"
+					events = performTransaction(ctx, resolvedClientID, &targets[i], family)
+				} else if event := performMeasurement(ctx, resolvedClientID, &targets[i], family); event != nil {
+					pathTracer.MaybeTrace(ctx, &targets[i], family, event)
+					events = []*models.TelemetryEvent{event}
+				}
+				if ctx.Err() != nil {
+					break cycle
+				}
+				for _, event := range events {
+					event.CustomMetrics = customMetrics
+				}
+				status.RecordMeasurement(checkType, time.Since(start), events)
+
+				// Enqueue events for sending (api-token is optional when auth is disabled)
+				if *ingestURL != "" {
+					for _, event := range events {
+						if eventQueue.Enqueue(event) {
+							log.Printf("Queued event %s for sending", event.EventID)
+						}
+					}
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		status.RecordCycle()
 
 		if *once {
-			// Wait a bit for the event to be sent before exiting
-			time.Sleep(2 * time.Second)
-			log.Printf("Total dropped events: %d", eventQueue.DroppedCount())
 			break
 		}
 
-		time.Sleep(*interval)
+		select {
+		case <-ctx.Done():
+		case <-time.After(*interval):
+		}
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Shutting down, abandoning in-flight measurements")
 	}
+	// A second signal now exits immediately
+	stop()
+
+	// Wait for path traces to finish and for queued events to be sent
+	// before exiting
+	pathTracer.Wait()
+	if *ingestURL != "" && !eventQueue.Wait(shutdownGrace) {
+		log.Printf("Exiting before all events were sent (%d still queued)", eventQueue.Depth())
+	}
+	log.Printf("Total dropped events: %d", eventQueue.DroppedCount())
 }
 
-func performMeasurement(clientID, targetURL, throughputURL string) *models.TelemetryEvent {
+// shutdownGrace bounds how long the probe waits for queued events on exit
+const shutdownGrace = 5 * time.Second
+
+// parseAddressFamilies parses the -address-family flag into the list of
+// address family modes to measure each interval
+func parseAddressFamilies(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return []string{probe.AddressFamilyAny}, nil
+	}
+
+	var families []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		family := strings.TrimSpace(part)
+		if family == "" || seen[family] {
+			continue
+		}
+		if !probe.ValidAddressFamily(family) {
+			return nil, fmt.Errorf("unsupported address family %q", family)
+		}
+		seen[family] = true
+		families = append(families, family)
+	}
+	return families, nil
+}
+
+// loadTargets returns the targets to measure: those listed in -targets-file,
+// or the single -target/-throughput-url pair when no file is given
+func loadTargets() ([]probe.TargetConfig, error) {
+	if *targetsFile != "" {
+		return probe.LoadTargets(*targetsFile)
+	}
+
+	t := probe.TargetConfig{URL: *target, ThroughputURL: *throughputURL}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return []probe.TargetConfig{t}, nil
+}
+
+// performMeasurement measures a target and returns its event, or nil if ctx
+// was cancelled before the measurement finished
+func performMeasurement(ctx context.Context, clientID string, targetCfg *probe.TargetConfig, family string) *models.TelemetryEvent {
+	targetURL := targetCfg.URL
+	throughputURL := targetCfg.GetThroughputURL()
+
 	// Create trace span for measurement
 	// Requirement: 6.4 - Probe measurement tracing
 	tracer := tracing.GetTracer("probe")
-	ctx, span := tracer.Start(context.Background(), "probe.measure")
+	ctx, span := tracer.Start(ctx, "probe.measure")
 	defer span.End()
 
 	// Add measurement attributes to span
@@ -156,30 +382,81 @@ func performMeasurement(clientID, targetURL, throughputURL string) *models.Telem
 		attribute.String("client.id", clientID),
 		attribute.String("target.url", targetURL),
 		attribute.String("throughput.url", throughputURL),
+		attribute.String("check.type", targetCfg.GetCheckType()),
+		attribute.String("net.address_family", family),
 	)
 
-	log.Printf("Performing measurement for %s", targetURL)
+	if family != probe.AddressFamilyAny {
+		log.Printf("Performing measurement for %s (%s)", targetURL, family)
+	} else {
+		log.Printf("Performing measurement for %s", targetURL)
+	}
+
+	// Capture the network context right before measuring so changes between
+	// measurements are attributed correctly
+	networkContext := detectNetworkContext(family)
+	networkContext.Proxy = targetCfg.ProxyDisplay()
 
 	// Perform the measurement
 	tracing.AddSpanEvent(ctx, "measurement.start")
-	measurement, err := probe.MeasureTargetWithThroughput(targetURL, throughputURL)
+	measurement, err := probe.MeasureTargetConfigWithThroughput(ctx, targetCfg, family)
+	if ctx.Err() != nil {
+		// Cancelled on shutdown; the partial result is not a real failure
+		tracing.AddSpanEvent(ctx, "measurement.cancelled")
+		return nil
+	}
 
 	// Create telemetry event
 	event := &models.TelemetryEvent{
-		EventID:       uuid.New().String(),
-		ClientID:      clientID,
-		TimestampMs:   time.Now().UnixMilli(),
-		SchemaVersion: *schemaVersion,
-		Target:        targetURL,
-		NetworkContext: models.NetworkContext{
-			InterfaceType: *interfaceType,
-			VPNEnabled:    *vpnEnabled,
-		},
+		EventID:        uuid.New().String(),
+		ClientID:       clientID,
+		TimestampMs:    time.Now().UnixMilli(),
+		SchemaVersion:  *schemaVersion,
+		Target:         targetURL,
+		CheckType:      targetCfg.GetCheckType(),
+		NetworkContext: networkContext,
+		ClockOffsetMs:  clockSync.OffsetMs(),
 	}
 
-	// Set user label if provided
-	if *userLabel != "" {
-		event.NetworkContext.UserLabel = userLabel
+	if measurement != nil && measurement.Echo != nil {
+		echo := measurement.Echo
+		event.Echo = &models.EchoMeasurements{
+			PacketsSent:     echo.PacketsSent,
+			PacketsReceived: echo.PacketsReceived,
+			LossRate:        echo.LossRate,
+			ReorderedCount:  echo.ReorderedCount,
+			DuplicateCount:  echo.DuplicateCount,
+			RTTP50Ms:        echo.RTTP50Ms,
+			RTTP95Ms:        echo.RTTP95Ms,
+			RTTMaxMs:        echo.RTTMaxMs,
+			JitterMs:        echo.JitterMs,
+		}
+		span.SetAttributes(
+			attribute.Float64("echo.loss_rate", echo.LossRate),
+			attribute.Float64("echo.jitter_ms", echo.JitterMs),
+		)
+	}
+
+	if measurement != nil && measurement.HTTPStatusCode != 0 {
+		event.HTTPStatusCode = measurement.HTTPStatusCode
+		span.SetAttributes(attribute.Int("http.status_code", measurement.HTTPStatusCode))
+	}
+
+	if measurement != nil && measurement.RemoteAddr != "" {
+		remoteAddr := measurement.RemoteAddr
+		event.RemoteAddr = &remoteAddr
+		span.SetAttributes(attribute.String("net.peer.addr", remoteAddr))
+	}
+
+	if measurement != nil && measurement.ConnectedFamily != "" {
+		event.NetworkContext.ConnectedFamily = measurement.ConnectedFamily
+		span.SetAttributes(attribute.String("net.connected_family", measurement.ConnectedFamily))
+	}
+
+	// A measurement bound to a source interface or address reports the
+	// uplink it actually used rather than the default route's
+	if measurement != nil && (targetCfg.SourceInterface != "" || targetCfg.SourceAddress != "") {
+		applyEgress(&event.NetworkContext, measurement.LocalIP, measurement.EgressInterface)
 	}
 
 	if err != nil {
@@ -187,15 +464,22 @@ func performMeasurement(clientID, targetURL, throughputURL string) *models.Telem
 		tracing.RecordError(ctx, err)
 		if measurement != nil && measurement.ErrorStage != nil {
 			event.ErrorStage = measurement.ErrorStage
-			tracing.AddSpanAttributes(ctx, attribute.String("error.stage", *measurement.ErrorStage))
+			event.TimedOut = measurement.TimedOut
+			tracing.AddSpanAttributes(ctx,
+				attribute.String("error.stage", *measurement.ErrorStage),
+				attribute.Bool("error.timeout", measurement.TimedOut),
+			)
 			// Still include partial timing data
 			event.Timings = models.TimingMeasurements{
-				DNSMs:      measurement.DNSMs,
-				TCPMs:      measurement.TCPMs,
-				TLSMs:      measurement.TLSMs,
-				HTTPTTFBMs: measurement.HTTPTTFBMs,
+				DNSMs:          measurement.DNSMs,
+				TCPMs:          measurement.TCPMs,
+				TLSMs:          measurement.TLSMs,
+				HTTPTTFBMs:     measurement.HTTPTTFBMs,
+				ProxyConnectMs: measurement.ProxyConnectMs,
 			}
 			event.ThroughputKbps = measurement.ThroughputKbps
+			event.UploadKbps = measurement.UploadKbps
+			event.ThroughputStreams = measurement.Streams
 		} else {
 			// Complete failure - set generic error
 			errorStage := "unknown"
@@ -207,12 +491,15 @@ func performMeasurement(clientID, targetURL, throughputURL string) *models.Telem
 		// Successful measurement
 		tracing.AddSpanEvent(ctx, "measurement.success")
 		event.Timings = models.TimingMeasurements{
-			DNSMs:      measurement.DNSMs,
-			TCPMs:      measurement.TCPMs,
-			TLSMs:      measurement.TLSMs,
-			HTTPTTFBMs: measurement.HTTPTTFBMs,
+			DNSMs:          measurement.DNSMs,
+			TCPMs:          measurement.TCPMs,
+			TLSMs:          measurement.TLSMs,
+			HTTPTTFBMs:     measurement.HTTPTTFBMs,
+			ProxyConnectMs: measurement.ProxyConnectMs,
 		}
 		event.ThroughputKbps = measurement.ThroughputKbps
+		event.UploadKbps = measurement.UploadKbps
+		event.ThroughputStreams = measurement.Streams
 
 		// Add timing attributes to span
 		// Requirement: 6.5 - Network operation details in spans
@@ -221,18 +508,128 @@ func performMeasurement(clientID, targetURL, throughputURL string) *models.Telem
 			attribute.Float64("timing.tcp_ms", measurement.TCPMs),
 			attribute.Float64("timing.tls_ms", measurement.TLSMs),
 			attribute.Float64("timing.ttfb_ms", measurement.HTTPTTFBMs),
+			attribute.Float64("timing.proxy_connect_ms", measurement.ProxyConnectMs),
 			attribute.Float64("throughput.kbps", measurement.ThroughputKbps),
+			attribute.Float64("throughput.upload_kbps", measurement.UploadKbps),
 		)
 	}
 
 	return event
 }
 
+// performTransaction runs a scripted transaction and returns one event per
+// executed step, reported under the step sub-target, followed by an overall
+// event for the transaction target. Overall timings are the per-stage sums
+// across steps; the error stage is that of the failing step. Nothing is
+// returned if ctx was cancelled before the transaction finished.
+func performTransaction(ctx context.Context, clientID string, targetCfg *probe.TargetConfig, family string) []*models.TelemetryEvent {
+	txn := targetCfg.Transaction
+	tracer := tracing.GetTracer("probe")
+	ctx, span := tracer.Start(ctx, "probe.transaction")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("client.id", clientID),
+		attribute.String("transaction.name", txn.Name),
+		attribute.Int("transaction.steps", len(txn.Steps)),
+		attribute.String("net.address_family", family),
+	)
+	log.Printf("Running transaction %s (%d steps)", txn.Name, len(txn.Steps))
+
+	networkContext := detectNetworkContext(family)
+	networkContext.Proxy = targetCfg.ProxyDisplay()
+	result, err := probe.RunTransaction(ctx, txn, family, &targetCfg.EgressConfig, targetCfg.Timeouts)
+	if ctx.Err() != nil {
+		tracing.AddSpanEvent(ctx, "transaction.cancelled")
+		return nil
+	}
+	if len(result.Steps) > 0 && (targetCfg.SourceInterface != "" || targetCfg.SourceAddress != "") {
+		first := result.Steps[0].Measurement
+		applyEgress(&networkContext, first.LocalIP, first.EgressInterface)
+	}
+
+	newEvent := func(target string, info *models.TransactionInfo) *models.TelemetryEvent {
+		event := &models.TelemetryEvent{
+			EventID:        uuid.New().String(),
+			ClientID:       clientID,
+			TimestampMs:    time.Now().UnixMilli(),
+			SchemaVersion:  *schemaVersion,
+			Target:         target,
+			NetworkContext: networkContext,
+			ClockOffsetMs:  clockSync.OffsetMs(),
+			Transaction:    info,
+		}
+		return event
+	}
+
+	var events []*models.TelemetryEvent
+	var total models.TimingMeasurements
+	for _, step := range result.Steps {
+		m := step.Measurement
+		event := newEvent(models.TransactionStepTarget(txn.Name, step.Name), &models.TransactionInfo{
+			Name:       txn.Name,
+			Step:       step.Name,
+			StepIndex:  step.Index,
+			StepCount:  result.StepCount,
+			DurationMs: float64(step.Duration.Microseconds()) / 1000.0,
+		})
+		event.Timings = models.TimingMeasurements{
+			DNSMs:          m.DNSMs,
+			TCPMs:          m.TCPMs,
+			TLSMs:          m.TLSMs,
+			HTTPTTFBMs:     m.HTTPTTFBMs,
+			ProxyConnectMs: m.ProxyConnectMs,
+		}
+		event.HTTPStatusCode = m.HTTPStatusCode
+		event.ErrorStage = m.ErrorStage
+		event.TimedOut = m.TimedOut
+		if m.RemoteAddr != "" {
+			remoteAddr := m.RemoteAddr
+			event.RemoteAddr = &remoteAddr
+		}
+		events = append(events, event)
+
+		total.DNSMs += m.DNSMs
+		total.TCPMs += m.TCPMs
+		total.TLSMs += m.TLSMs
+		total.HTTPTTFBMs += m.HTTPTTFBMs
+		total.ProxyConnectMs += m.ProxyConnectMs
+	}
+
+	overall := newEvent(models.TransactionTarget(txn.Name), &models.TransactionInfo{
+		Name:       txn.Name,
+		StepCount:  result.StepCount,
+		DurationMs: float64(result.Duration.Microseconds()) / 1000.0,
+	})
+	overall.Timings = total
+	overall.ErrorStage = result.ErrorStage
+	overall.TimedOut = result.TimedOut
+	events = append(events, overall)
+
+	span.SetAttributes(attribute.Float64("transaction.duration_ms", overall.Transaction.DurationMs))
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		tracing.AddSpanAttributes(ctx,
+			attribute.String("error.stage", *result.ErrorStage),
+			attribute.Bool("error.timeout", result.TimedOut),
+			attribute.String("transaction.failed_step", result.FailedStep),
+		)
+		log.Printf("Transaction %s failed at step %q: %v", txn.Name, result.FailedStep, err)
+	} else {
+		tracing.AddSpanEvent(ctx, "transaction.success")
+	}
+
+	return events
+}
+
 func printMeasurement(event *models.TelemetryEvent) {
 	fmt.Println("─────────────────────────────────────────────")
 	fmt.Printf("Measurement at %s\n", time.UnixMilli(event.TimestampMs).Format(time.RFC3339))
 	fmt.Printf("Event ID: %s\n", event.EventID)
 	fmt.Printf("Target: %s\n", event.Target)
+	if nc := event.NetworkContext; nc.InterfaceName != "" {
+		fmt.Printf("Network: %s (%s), VPN: %v\n", nc.InterfaceName, nc.InterfaceType, nc.VPNEnabled)
+	}
 
 	if event.ErrorStage != nil {
 		fmt.Printf("❌ Error Stage: %s\n", *event.ErrorStage)
@@ -255,15 +652,17 @@ func printMeasurement(event *models.TelemetryEvent) {
 
 // eventSender processes events from the queue with exponential backoff
 // Requirement: 8.2 - Exponential backoff for retry
-func eventSender(queue *EventQueue, ingestURL, apiToken string, maxBackoff time.Duration) {
+func eventSender(queue *EventQueue, status *ProbeStatus, ingestURL, apiToken string, maxBackoff time.Duration) {
 	for {
 		event := queue.Dequeue()
 
 		backoff := 1 * time.Second
 		for {
 			err := sendEventToIngest(event, ingestURL, apiToken)
+			status.RecordSend("event", err)
 			if err == nil {
 				log.Printf("Successfully sent event %s to ingest API", event.EventID)
+				queue.Done()
 				break // Success, move to next event
 			}
 
@@ -280,10 +679,15 @@ func eventSender(queue *EventQueue, ingestURL, apiToken string, maxBackoff time.
 }
 
 func sendEventToIngest(event *models.TelemetryEvent, ingestURL, apiToken string) error {
-	// Serialize event to JSON
-	jsonData, err := json.Marshal(event)
+	return postToIngest(event, ingestURL, apiToken)
+}
+
+// postToIngest sends a JSON payload to an ingest API endpoint
+func postToIngest(payload interface{}, ingestURL, apiToken string) error {
+	// Serialize payload to JSON
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Create HTTP request
@@ -316,3 +720,14 @@ func sendEventToIngest(event *models.TelemetryEvent, ingestURL, apiToken string)
 
 	return nil
 }
+
+// ingestSiblingURL derives another ingest endpoint from the ingest URL by
+// replacing its last path element, e.g. /events becomes /path-traces
+func ingestSiblingURL(ingestURL, name string) (string, error) {
+	parsed, err := url.Parse(ingestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ingest URL: %w", err)
+	}
+	parsed.Path = path.Join(path.Dir(parsed.Path), name)
+	return parsed.String(), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+// interfaceAuto makes the probe detect the interface type itself
+const interfaceAuto = "auto"
+
+var (
+	// netDetector detects the network context before each measurement
+	netDetector *probe.NetworkDetector
+
+	// vpnOverride is set when -vpn was given explicitly
+	vpnOverride bool
+)
+
+// initNetworkContext sets up network context detection from the flags
+func initNetworkContext() {
+	netDetector = probe.NewNetworkDetector(*publicIPURL)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "vpn" {
+			vpnOverride = true
+		}
+	})
+
+	if *interfaceType != interfaceAuto {
+		log.Printf("Interface type: %s (from -interface)", *interfaceType)
+	}
+	if info, err := netDetector.Detect(probe.AddressFamilyAny); err != nil {
+		log.Printf("Network context detection failed: %v", err)
+	} else {
+		log.Printf("Network: %s (%s) local %s gateway %s vpn=%v",
+			info.InterfaceName, info.InterfaceType, info.LocalIP, info.Gateway, info.VPN)
+	}
+}
+
+// applyEgress records the local address and interface a bound measurement
+// used. Detected VPN details describe the default route, not the bound
+// uplink, so they are cleared.
+func applyEgress(nc *models.NetworkContext, localIP, iface string) {
+	nc.SourceBound = true
+	if localIP != "" {
+		nc.LocalIP = localIP
+	}
+	if iface == "" {
+		return
+	}
+	nc.InterfaceName = iface
+	if *interfaceType == interfaceAuto {
+		nc.InterfaceType = probe.InterfaceTypeOf(iface)
+	}
+	if !vpnOverride {
+		nc.VPNEnabled = false
+		nc.VPNInterface = ""
+	}
+	nc.Gateway = ""
+}
+
+// detectNetworkContext returns the network context for a measurement. Detected
+// values are used unless -interface or -vpn were given explicitly.
+func detectNetworkContext(family string) models.NetworkContext {
+	nc := models.NetworkContext{
+		InterfaceType: *interfaceType,
+		VPNEnabled:    *vpnEnabled,
+		AddressFamily: family,
+	}
+	if *userLabel != "" {
+		nc.UserLabel = userLabel
+	}
+
+	info, err := netDetector.Detect(family)
+	if err != nil {
+		log.Printf("Network context detection failed: %v", err)
+	}
+	if info == nil {
+		info = &probe.NetworkInfo{InterfaceType: probe.InterfaceTypeUnknown}
+	}
+
+	if *interfaceType == interfaceAuto {
+		nc.InterfaceType = info.InterfaceType
+	}
+	if !vpnOverride {
+		nc.VPNEnabled = info.VPN
+	}
+	nc.InterfaceName = info.InterfaceName
+	nc.LocalIP = info.LocalIP
+	nc.Gateway = info.Gateway
+	nc.VPNInterface = info.VPNInterface
+	nc.PublicIP = info.PublicIP
+	nc.ASN = info.ASN
+	nc.ASOrg = info.ASOrg
+
+	return nc
+}
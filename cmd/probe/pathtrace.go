@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+	"github.com/rahulgh33/wirescope/internal/tracing"
+)
+
+// PathTracer runs path traces for targets with a path_trace block, on their
+// schedule or when a measurement degrades, and queues the results
+type PathTracer struct {
+	clientID string
+	queue    chan *models.PathTraceEvent
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// NewPathTracer creates a path tracer with a bounded result queue
+func NewPathTracer(clientID string, queueSize int) *PathTracer {
+	return &PathTracer{
+		clientID: clientID,
+		queue:    make(chan *models.PathTraceEvent, queueSize),
+		lastRun:  make(map[string]time.Time),
+		running:  make(map[string]bool),
+	}
+}
+
+// pathTraceTrigger returns why a target should be traced after a
+// measurement, or "" if it should not be traced now. Triggered traces respect
+// the cooldown; scheduled traces run once the interval has passed.
+func pathTraceTrigger(cfg *probe.PathTraceConfig, event *models.TelemetryEvent, sinceLast time.Duration, neverRun bool) string {
+	cooledDown := neverRun || sinceLast >= cfg.Cooldown()
+
+	if cfg.OnError && event.ErrorStage != nil && cooledDown {
+		switch *event.ErrorStage {
+		case models.ErrorStageDNS, models.ErrorStageTCP, models.ErrorStageTLS:
+			return models.PathTraceTriggerError
+		}
+	}
+
+	if cfg.LatencyThresholdMs > 0 && cooledDown &&
+		event.Timings.TCPMs+event.Timings.TLSMs >= cfg.LatencyThresholdMs {
+		return models.PathTraceTriggerLatency
+	}
+
+	if cfg.IntervalMs > 0 && (neverRun || sinceLast >= cfg.Interval()) {
+		return models.PathTraceTriggerSchedule
+	}
+
+	return ""
+}
+
+// MaybeTrace starts a background trace of the target if one is due after
+// this measurement. Only one trace per target and family runs at a time, and
+// cancelling ctx abandons it.
+func (pt *PathTracer) MaybeTrace(ctx context.Context, targetCfg *probe.TargetConfig, family string, event *models.TelemetryEvent) {
+	if targetCfg.PathTrace == nil {
+		return
+	}
+
+	key := targetCfg.URL + "|" + family
+	pt.mu.Lock()
+	if pt.running[key] {
+		pt.mu.Unlock()
+		return
+	}
+	last, ran := pt.lastRun[key]
+	trigger := pathTraceTrigger(targetCfg.PathTrace, event, time.Since(last), !ran)
+	if trigger == "" {
+		pt.mu.Unlock()
+		return
+	}
+	pt.running[key] = true
+	pt.lastRun[key] = time.Now()
+	pt.mu.Unlock()
+
+	pt.wg.Add(1)
+	go func() {
+		defer pt.wg.Done()
+		defer func() {
+			pt.mu.Lock()
+			delete(pt.running, key)
+			pt.mu.Unlock()
+		}()
+
+		trace := pt.trace(ctx, targetCfg, family, trigger)
+		if trace == nil {
+			return
+		}
+		select {
+		case pt.queue <- trace:
+		default:
+			log.Printf("Path trace queue full, dropping trace %s", trace.EventID)
+		}
+	}()
+}
+
+// Wait blocks until running traces have finished
+func (pt *PathTracer) Wait() {
+	pt.wg.Wait()
+}
+
+// trace runs a path trace and converts it to an event
+func (pt *PathTracer) trace(ctx context.Context, targetCfg *probe.TargetConfig, family, trigger string) *models.PathTraceEvent {
+	tracer := tracing.GetTracer("probe")
+	ctx, span := tracer.Start(ctx, "probe.path_trace")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("client.id", pt.clientID),
+		attribute.String("target.url", targetCfg.URL),
+		attribute.String("net.address_family", family),
+		attribute.String("path.trigger", trigger),
+	)
+	log.Printf("Running path trace for %s (trigger: %s)", targetCfg.URL, trigger)
+
+	startMs := time.Now().UnixMilli()
+	result, err := probe.TracePath(ctx, targetCfg, family)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		log.Printf("Path trace for %s failed: %v", targetCfg.URL, err)
+		return nil
+	}
+
+	event := &models.PathTraceEvent{
+		EventID:       uuid.New().String(),
+		ClientID:      pt.clientID,
+		TimestampMs:   startMs,
+		SchemaVersion: *schemaVersion,
+		Target:        targetCfg.URL,
+		AddressFamily: family,
+		Protocol:      result.Protocol,
+		Port:          result.Port,
+		Method:        result.Method,
+		Trigger:       trigger,
+		DestinationIP: result.DestinationIP,
+		Reached:       result.Reached,
+		Hops:          make([]models.PathHop, 0, len(result.Hops)),
+		DurationMs:    float64(result.Duration.Microseconds()) / 1000.0,
+	}
+	for _, hop := range result.Hops {
+		event.Hops = append(event.Hops, models.PathHop{
+			TTL:   hop.TTL,
+			Addr:  hop.Addr,
+			RTTMs: hop.RTTMs,
+			Sent:  hop.Sent,
+			Lost:  hop.Lost,
+		})
+	}
+
+	span.SetAttributes(
+		attribute.String("path.method", result.Method),
+		attribute.Int("path.hops", len(event.Hops)),
+		attribute.Bool("path.reached", result.Reached),
+	)
+	if result.Method == probe.PathTraceMethodConnect {
+		log.Printf("Path trace for %s used connect fallback (raw sockets unavailable; run with CAP_NET_RAW for hop detail)", targetCfg.URL)
+	}
+	log.Printf("Path trace for %s: %d hops, reached=%v, path=%s",
+		targetCfg.URL, len(event.Hops), result.Reached, models.PathSignature(event.Hops))
+
+	return event
+}
+
+// pathTraceSender ships queued path traces with exponential backoff
+func pathTraceSender(pt *PathTracer, status *ProbeStatus, pathTraceURL, apiToken string, maxBackoff time.Duration) {
+	for trace := range pt.queue {
+		backoff := 1 * time.Second
+		for {
+			err := postToIngest(trace, pathTraceURL, apiToken)
+			status.RecordSend("path_trace", err)
+			if err == nil {
+				log.Printf("Successfully sent path trace %s to ingest API", trace.EventID)
+				break
+			}
+
+			log.Printf("Failed to send path trace %s: %v, retrying in %v", trace.EventID, err, backoff)
+			time.Sleep(backoff)
+
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
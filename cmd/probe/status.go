@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+// Probe self-metrics, served on the local status server
+var (
+	probeMeasurementDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "probe_measurement_duration_seconds",
+			Help:    "Duration of a measurement or transaction run, including throughput tests",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"check_type", "status"}, // status: success, error
+	)
+
+	probeMeasurementsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "probe_measurements_total",
+			Help: "Total events produced by measurements",
+		},
+		[]string{"check_type", "status"}, // status: success, error, timeout
+	)
+
+	probeSendsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "probe_sends_total",
+			Help: "Total attempts to send payloads to the ingest API",
+		},
+		[]string{"kind", "status"}, // kind: event, path_trace, heartbeat; status: success, error
+	)
+
+	probeEventsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "probe_events_dropped_total",
+			Help: "Total events dropped because the send queue was full",
+		},
+	)
+
+	probeCollectorRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "probe_collector_runs_total",
+			Help: "Total custom metric collector runs",
+		},
+		[]string{"collector", "status"}, // status: success, error
+	)
+)
+
+func init() {
+	prometheus.MustRegister(probeMeasurementDuration)
+	prometheus.MustRegister(probeMeasurementsTotal)
+	prometheus.MustRegister(probeSendsTotal)
+	prometheus.MustRegister(probeEventsDroppedTotal)
+	prometheus.MustRegister(probeCollectorRunsTotal)
+}
+
+// targetStatus is the last result for a target and address family
+type targetStatus struct {
+	Target        string                    `json:"target"`
+	AddressFamily string                    `json:"address_family,omitempty"`
+	CheckType     string                    `json:"check_type"`
+	EventID       string                    `json:"event_id"`
+	Timestamp     time.Time                 `json:"timestamp"`
+	Success       bool                      `json:"success"`
+	ErrorStage    string                    `json:"error_stage,omitempty"`
+	TimedOut      bool                      `json:"timed_out,omitempty"`
+	Timings       models.TimingMeasurements `json:"timings"`
+	Throughput    float64                   `json:"throughput_kbps,omitempty"`
+	Transaction   *models.TransactionInfo   `json:"transaction,omitempty"`
+	Network       models.NetworkContext     `json:"network_context"`
+}
+
+// ProbeStatus tracks what the probe is doing for the local status server
+type ProbeStatus struct {
+	clientID      string
+	configVersion string
+	targets       []string
+	interval      time.Duration
+	startedAt     time.Time
+	queue         *EventQueue
+
+	mu              sync.RWMutex
+	lastResults     map[string]*targetStatus
+	lastCycleAt     time.Time
+	eventsSent      int64
+	lastSendAt      time.Time
+	lastSendError   string
+	lastSendErrorAt time.Time
+}
+
+// NewProbeStatus creates the status tracker for a set of targets
+func NewProbeStatus(clientID string, targets []probe.TargetConfig, interval time.Duration, queue *EventQueue) *ProbeStatus {
+	names := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if t.Transaction != nil {
+			names = append(names, "transaction:"+t.Transaction.Name)
+		} else {
+			names = append(names, t.URL)
+		}
+	}
+
+	return &ProbeStatus{
+		clientID:      clientID,
+		configVersion: configVersion(targets),
+		targets:       names,
+		interval:      interval,
+		startedAt:     time.Now(),
+		queue:         queue,
+		lastResults:   make(map[string]*targetStatus),
+	}
+}
+
+// configVersion identifies the loaded target configuration by a short hash,
+// so fleet monitoring can tell which probes run an outdated targets file
+func configVersion(targets []probe.TargetConfig) string {
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// RecordMeasurement records the events of one measurement or transaction run
+func (ps *ProbeStatus) RecordMeasurement(checkType string, duration time.Duration, events []*models.TelemetryEvent) {
+	status := "success"
+	for _, event := range events {
+		if event.ErrorStage != nil {
+			status = "error"
+		}
+	}
+	probeMeasurementDuration.WithLabelValues(checkType, status).Observe(duration.Seconds())
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, event := range events {
+		eventStatus := "success"
+		result := &targetStatus{
+			Target:        event.Target,
+			AddressFamily: event.NetworkContext.AddressFamily,
+			CheckType:     event.GetCheckType(),
+			EventID:       event.EventID,
+			Timestamp:     time.UnixMilli(event.TimestampMs),
+			Success:       event.ErrorStage == nil,
+			Timings:       event.Timings,
+			Throughput:    event.ThroughputKbps,
+			Transaction:   event.Transaction,
+			Network:       event.NetworkContext,
+		}
+		if event.ErrorStage != nil {
+			eventStatus = "error"
+			result.ErrorStage = *event.ErrorStage
+		}
+		if event.TimedOut {
+			eventStatus = "timeout"
+			result.TimedOut = true
+		}
+		probeMeasurementsTotal.WithLabelValues(result.CheckType, eventStatus).Inc()
+		ps.lastResults[event.Target+"|"+result.AddressFamily] = result
+	}
+}
+
+// RecordCycle marks the end of a pass over all targets
+func (ps *ProbeStatus) RecordCycle() {
+	ps.mu.Lock()
+	ps.lastCycleAt = time.Now()
+	ps.mu.Unlock()
+}
+
+// RecordSend records the outcome of sending a payload to ingest
+func (ps *ProbeStatus) RecordSend(kind string, err error) {
+	if err != nil {
+		probeSendsTotal.WithLabelValues(kind, "error").Inc()
+	} else {
+		probeSendsTotal.WithLabelValues(kind, "success").Inc()
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err != nil {
+		ps.lastSendError = err.Error()
+		ps.lastSendErrorAt = time.Now()
+		return
+	}
+	if kind == "event" {
+		ps.eventsSent++
+	}
+	ps.lastSendAt = time.Now()
+}
+
+// healthy reports whether the measurement loop is making progress: a cycle
+// has completed within three intervals, or the probe only just started
+func (ps *ProbeStatus) healthy() bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return time.Since(ps.lastCycleOrStart()) < 3*ps.interval+time.Minute
+}
+
+// handleHealthz serves the liveness check
+func (ps *ProbeStatus) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status, code := "healthy", http.StatusOK
+	if !ps.healthy() {
+		status, code = "stalled", http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  status,
+		"service": "probe",
+	})
+}
+
+// handleStatus serves the probe's configuration and last results as JSON
+func (ps *ProbeStatus) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ps.mu.RLock()
+	results := make([]*targetStatus, 0, len(ps.lastResults))
+	for _, result := range ps.lastResults {
+		results = append(results, result)
+	}
+	response := map[string]interface{}{
+		"client_id":      ps.clientID,
+		"config_version": ps.configVersion,
+		"schema_version": *schemaVersion,
+		"started_at":     ps.startedAt.Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(ps.startedAt).Seconds()),
+		"interval":       ps.interval.String(),
+		"targets":        ps.targets,
+		"queue": map[string]interface{}{
+			"depth":    ps.queue.Depth(),
+			"capacity": ps.queue.Capacity(),
+			"dropped":  ps.queue.DroppedCount(),
+		},
+		"events_sent": ps.eventsSent,
+	}
+	if !ps.lastCycleAt.IsZero() {
+		response["last_cycle_at"] = ps.lastCycleAt.Format(time.RFC3339)
+	}
+	if !ps.lastSendAt.IsZero() {
+		response["last_send_at"] = ps.lastSendAt.Format(time.RFC3339)
+	}
+	if ps.lastSendError != "" {
+		response["last_send_error"] = ps.lastSendError
+		response["last_send_error_at"] = ps.lastSendErrorAt.Format(time.RFC3339)
+	}
+	ps.mu.RUnlock()
+	response["healthy"] = ps.healthy()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Target != results[j].Target {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].AddressFamily < results[j].AddressFamily
+	})
+	response["last_results"] = results
+	if offset := clockSync.OffsetMs(); offset != nil {
+		response["clock_offset_ms"] = *offset
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// lastCycleOrStart returns when the last cycle finished, or the start time.
+// The caller must hold ps.mu.
+func (ps *ProbeStatus) lastCycleOrStart() time.Time {
+	if ps.lastCycleAt.IsZero() {
+		return ps.startedAt
+	}
+	return ps.lastCycleAt
+}
+
+// Serve runs the local status server on addr
+func (ps *ProbeStatus) Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", ps.handleHealthz)
+	mux.HandleFunc("/status", ps.handleStatus)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Printf("Status server listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Status server failed: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	port            = flag.String("port", "8090", "HTTP server port")
+	maxDownloadSize = flag.Int64("max-download-bytes", 1<<30, "Largest payload served by /download")
+	maxUploadSize   = flag.Int64("max-upload-bytes", 1<<30, "Largest request body accepted by /upload")
+)
+
+// Sizes of the generated payloads
+const (
+	fixedObjectSize     = 1 << 20
+	defaultDownloadSize = 10 << 20
+	payloadChunkSize    = 64 << 10
+)
+
+// Prometheus metrics
+var (
+	testServerBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "test_server_bytes_total",
+			Help: "Total payload bytes served or sunk by the throughput test server",
+		},
+		[]string{"direction"}, // download, upload
+	)
+
+	testServerRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "test_server_requests_total",
+			Help: "Total number of throughput test requests",
+		},
+		[]string{"endpoint", "status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(testServerBytesTotal)
+	prometheus.MustRegister(testServerRequestsTotal)
+}
+
+// payloadChunk is the block repeated to build download payloads
+var payloadChunk = func() []byte {
+	chunk := make([]byte, payloadChunkSize)
+	for i := range chunk {
+		chunk[i] = byte(i*31 + 7)
+	}
+	return chunk
+}()
+
+// Throughput test server for probe download and upload tests. It serves the
+// same /fixed/1mb.bin object as the nginx test target, plus sized downloads
+// and an upload sink so multi-stream tests do not depend on static files.
+func main() {
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/fixed/1mb.bin", handleFixed)
+	mux.HandleFunc("/download", handleDownload)
+	mux.HandleFunc("/upload", handleUpload)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{
+		Addr:    ":" + *port,
+		Handler: mux,
+	}
+
+	log.Printf("Throughput test server listening on %s", server.Addr)
+
+	// Handle graceful shutdown
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	<-sigCh
+	log.Printf("Shutting down test server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	log.Printf("Test server stopped")
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+}
+
+// handleFixed serves the fixed 1MB object used by the default throughput test
+func handleFixed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writePayload(w, r, "fixed", fixedObjectSize)
+}
+
+// handleDownload serves ?bytes=N of generated payload (default 10MB)
+func handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size := int64(defaultDownloadSize)
+	if value := r.URL.Query().Get("bytes"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			testServerRequestsTotal.WithLabelValues("download", "invalid").Inc()
+			http.Error(w, "bytes must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+	if size > *maxDownloadSize {
+		testServerRequestsTotal.WithLabelValues("download", "too_large").Inc()
+		http.Error(w, "requested payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	writePayload(w, r, "download", size)
+}
+
+// writePayload streams size bytes of generated payload with no caching
+func writePayload(w http.ResponseWriter, r *http.Request, endpoint string, size int64) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		testServerRequestsTotal.WithLabelValues(endpoint, "ok").Inc()
+		return
+	}
+
+	var written int64
+	for written < size {
+		chunk := payloadChunk
+		if remaining := size - written; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			break
+		}
+	}
+
+	testServerBytesTotal.WithLabelValues("download").Add(float64(written))
+	status := "ok"
+	if written < size {
+		status = "aborted"
+	}
+	testServerRequestsTotal.WithLabelValues(endpoint, status).Inc()
+}
+
+// handleUpload sinks the request body and reports how much was received
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	received, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, *maxUploadSize))
+	duration := time.Since(start)
+	testServerBytesTotal.WithLabelValues("upload").Add(float64(received))
+
+	if err != nil {
+		testServerRequestsTotal.WithLabelValues("upload", "error").Inc()
+		http.Error(w, "failed to read upload", http.StatusBadRequest)
+		return
+	}
+	testServerRequestsTotal.WithLabelValues("upload", "ok").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bytes":       received,
+		"duration_ms": float64(duration.Microseconds()) / 1000.0,
+	})
+}
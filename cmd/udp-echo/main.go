@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+var (
+	listenAddr  = flag.String("listen", ":7001", "UDP address to echo packets on")
+	metricsAddr = flag.String("metrics-addr", "", "Optional HTTP address for Prometheus metrics (e.g. :9107)")
+)
+
+// Prometheus metrics
+var (
+	echoPacketsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "udp_echo_packets_total",
+			Help: "Total number of UDP packets received by the echo responder",
+		},
+		[]string{"result"}, // echoed, ignored, error
+	)
+
+	echoBytesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "udp_echo_bytes_total",
+			Help: "Total number of bytes echoed back to probes",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(echoPacketsTotal)
+	prometheus.MustRegister(echoBytesTotal)
+}
+
+// UDP echo responder for probe loss/jitter checks. Only well-formed
+// WireScope echo packets are returned, and never larger than received, so
+// the responder cannot be used to amplify traffic.
+func main() {
+	flag.Parse()
+
+	conn, err := net.ListenPacket("udp", *listenAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *listenAddr, err)
+	}
+	defer conn.Close()
+
+	log.Printf("UDP echo responder listening on %s", conn.LocalAddr())
+
+	if *metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			log.Printf("Metrics available at http://localhost%s/metrics", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				log.Printf("Metrics server failed: %v", err)
+			}
+		}()
+	}
+
+	// Handle graceful shutdown
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Printf("Shutting down UDP echo responder...")
+		conn.Close()
+	}()
+
+	buf := make([]byte, probe.EchoMaxPacketSize+1)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			echoPacketsTotal.WithLabelValues("error").Inc()
+			continue
+		}
+
+		if !probe.IsEchoPacket(buf[:n]) {
+			echoPacketsTotal.WithLabelValues("ignored").Inc()
+			continue
+		}
+
+		if _, err := conn.WriteTo(buf[:n], addr); err != nil {
+			echoPacketsTotal.WithLabelValues("error").Inc()
+			continue
+		}
+		echoPacketsTotal.WithLabelValues("echoed").Inc()
+		echoBytesTotal.Add(float64(n))
+	}
+
+	log.Printf("UDP echo responder stopped")
+}
@@ -28,6 +28,8 @@ CREATE TABLE IF NOT EXISTS agg_1m (
     tls_error_count BIGINT NOT NULL DEFAULT 0,
     http_error_count BIGINT NOT NULL DEFAULT 0,
     throughput_error_count BIGINT NOT NULL DEFAULT 0,
+    assertion_error_count BIGINT NOT NULL DEFAULT 0,
+    udp_error_count BIGINT NOT NULL DEFAULT 0,
     dns_p50 DOUBLE PRECISION,
     dns_p95 DOUBLE PRECISION,
     tcp_p50 DOUBLE PRECISION,
@@ -38,17 +40,359 @@ CREATE TABLE IF NOT EXISTS agg_1m (
     ttfb_p95 DOUBLE PRECISION,
     throughput_p50 DOUBLE PRECISION,
     throughput_p95 DOUBLE PRECISION,
+    upload_p50 DOUBLE PRECISION,
+    upload_p95 DOUBLE PRECISION,
+    proxy_connect_p50 DOUBLE PRECISION,
+    proxy_connect_p95 DOUBLE PRECISION,
+    proxy_error_count BIGINT NOT NULL DEFAULT 0,
+    timeout_error_count BIGINT NOT NULL DEFAULT 0,
+    timeout_stage_counts JSONB,
+    packets_sent BIGINT NOT NULL DEFAULT 0,
+    packets_lost BIGINT NOT NULL DEFAULT 0,
+    reordered_count BIGINT NOT NULL DEFAULT 0,
+    loss_rate DOUBLE PRECISION,
+    rtt_p50 DOUBLE PRECISION,
+    rtt_p95 DOUBLE PRECISION,
+    jitter_p50 DOUBLE PRECISION,
+    jitter_p95 DOUBLE PRECISION,
+    asn INTEGER NOT NULL DEFAULT 0,
+    as_org VARCHAR(255) NOT NULL DEFAULT '',
+    user_label VARCHAR(255) NOT NULL DEFAULT '',
     diagnosis_label VARCHAR(50),
+    diagnosis_details JSONB,
+    silences JSONB,
+    maintenance BOOLEAN NOT NULL DEFAULT FALSE,
     updated_at TIMESTAMP DEFAULT NOW(),
-    PRIMARY KEY (client_id, target, window_start_ts)
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    PRIMARY KEY (client_id, target, address_family, check_type, window_start_ts)
 );
 
 -- Indexes for efficient queries
 CREATE INDEX IF NOT EXISTS idx_agg_1m_window ON agg_1m(window_start_ts);
 CREATE INDEX IF NOT EXISTS idx_agg_1m_diagnosis ON agg_1m(diagnosis_label) WHERE diagnosis_label IS NOT NULL;
 CREATE INDEX IF NOT EXISTS idx_agg_1m_client_target_window ON agg_1m(client_id, target, window_start_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_agg_1m_target_family_window ON agg_1m(target, address_family, window_start_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_agg_1m_check_type_window ON agg_1m(check_type, window_start_ts DESC);
 
--- Optional alerts table for future use
+-- Path traces (hop lists) shipped by probes, for path-change detection
+CREATE TABLE IF NOT EXISTS path_traces (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(20) NOT NULL DEFAULT '',
+    protocol VARCHAR(10) NOT NULL,
+    port INTEGER NOT NULL,
+    method VARCHAR(20) NOT NULL,
+    trigger VARCHAR(20) NOT NULL,
+    destination_ip VARCHAR(64),
+    reached BOOLEAN NOT NULL DEFAULT FALSE,
+    hop_count INTEGER NOT NULL DEFAULT 0,
+    hops JSONB NOT NULL DEFAULT '[]',
+    path_signature TEXT NOT NULL DEFAULT '',
+    path_changed BOOLEAN NOT NULL DEFAULT FALSE,
+    duration_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ts TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_path_traces_client_target_ts ON path_traces(client_id, target, ts DESC);
+CREATE INDEX IF NOT EXISTS idx_path_traces_changed ON path_traces(ts DESC) WHERE path_changed;
+
+-- Per-client clock skew statistics (server clock minus probe clock)
+CREATE TABLE IF NOT EXISTS client_clock_skew (
+    client_id VARCHAR(255) PRIMARY KEY,
+    samples BIGINT NOT NULL DEFAULT 0,
+    skewed_events BIGINT NOT NULL DEFAULT 0,
+    corrected_events BIGINT NOT NULL DEFAULT 0,
+    last_skew_ms BIGINT NOT NULL DEFAULT 0,
+    min_skew_ms BIGINT NOT NULL DEFAULT 0,
+    max_skew_ms BIGINT NOT NULL DEFAULT 0,
+    sum_abs_skew_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    skew_lt_100ms BIGINT NOT NULL DEFAULT 0,
+    skew_lt_1s BIGINT NOT NULL DEFAULT 0,
+    skew_lt_10s BIGINT NOT NULL DEFAULT 0,
+    skew_lt_60s BIGINT NOT NULL DEFAULT 0,
+    skew_ge_60s BIGINT NOT NULL DEFAULT 0,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Latest heartbeat per probe, for liveness tracking
+CREATE TABLE IF NOT EXISTS probe_heartbeats (
+    client_id VARCHAR(255) PRIMARY KEY,
+    probe_version VARCHAR(64) NOT NULL DEFAULT '',
+    config_version VARCHAR(64) NOT NULL DEFAULT '',
+    uptime_seconds BIGINT NOT NULL DEFAULT 0,
+    interval_seconds INTEGER NOT NULL,
+    targets INTEGER NOT NULL DEFAULT 0,
+    queue_depth INTEGER NOT NULL DEFAULT 0,
+    dropped_events BIGINT NOT NULL DEFAULT 0,
+    hostname VARCHAR(255) NOT NULL DEFAULT '',
+    os VARCHAR(32) NOT NULL DEFAULT '',
+    arch VARCHAR(32) NOT NULL DEFAULT '',
+    num_cpu INTEGER NOT NULL DEFAULT 0,
+    go_version VARCHAR(32) NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_probe_heartbeats_last_seen ON probe_heartbeats(last_seen_at);
+
+-- Per-window statistics of custom metrics reported by probe collectors
+-- (Wi-Fi signal, CPU load, gateway ping, exec plugins), one row per metric
+-- keyed like agg_1m
+CREATE TABLE IF NOT EXISTS agg_1m_custom_metrics (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    window_start_ts TIMESTAMP NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    sample_count BIGINT NOT NULL DEFAULT 0,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    mean_value DOUBLE PRECISION NOT NULL,
+    p50 DOUBLE PRECISION NOT NULL,
+    p95 DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type, window_start_ts, metric)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agg_1m_custom_metrics_window ON agg_1m_custom_metrics(window_start_ts);
+CREATE INDEX IF NOT EXISTS idx_agg_1m_custom_metrics_metric_window ON agg_1m_custom_metrics(metric, window_start_ts DESC);
+
+-- Probe enrollment: short-lived, single-use codes created by admins, the
+-- per-probe ingest credentials they are exchanged for, and an audit log of
+-- enrollment activity. Only SHA-256 hashes of codes and tokens are stored.
+CREATE TABLE IF NOT EXISTS enrollment_codes (
+    id UUID PRIMARY KEY,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    code_prefix VARCHAR(16) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    config JSONB NOT NULL DEFAULT '{}',
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    redeemed_at TIMESTAMP,
+    redeemed_client_id VARCHAR(255),
+    redeemed_from VARCHAR(255),
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_codes_created ON enrollment_codes(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS probe_credentials (
+    id UUID PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    enrollment_id UUID REFERENCES enrollment_codes(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_probe_credentials_client ON probe_credentials(client_id);
+CREATE INDEX IF NOT EXISTS idx_probe_credentials_enrollment ON probe_credentials(enrollment_id);
+
+CREATE TABLE IF NOT EXISTS enrollment_audit (
+    id BIGSERIAL PRIMARY KEY,
+    enrollment_id UUID,
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    remote_addr VARCHAR(255) NOT NULL DEFAULT '',
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_audit_created ON enrollment_audit(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_enrollment_audit_enrollment ON enrollment_audit(enrollment_id);
+
+-- Diagnosis results written by the diagnoser service, one row per aggregate
+-- window keyed like agg_1m. Windows that are updated late are re-diagnosed
+-- in place and their revision incremented. Healthy windows are recorded
+-- with a NULL label so the history shows when an issue ended.
+CREATE TABLE IF NOT EXISTS diagnosis_history (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    window_start_ts TIMESTAMP NOT NULL,
+    diagnosis_label VARCHAR(50),
+    previous_label VARCHAR(50),
+    revision INT NOT NULL DEFAULT 1,
+    late BOOLEAN NOT NULL DEFAULT FALSE,
+    count_success BIGINT NOT NULL DEFAULT 0,
+    dns_p95 DOUBLE PRECISION,
+    tcp_p95 DOUBLE PRECISION,
+    tls_p95 DOUBLE PRECISION,
+    ttfb_p95 DOUBLE PRECISION,
+    throughput_p50 DOUBLE PRECISION,
+    baseline_windows INT NOT NULL DEFAULT 0,
+    baseline JSONB,
+    details JSONB,
+    target_clients INT NOT NULL DEFAULT 0,
+    target_affected_clients INT NOT NULL DEFAULT 0,
+    org_id VARCHAR(64) DEFAULT 'default',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (client_id, target, address_family, check_type, window_start_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_window ON diagnosis_history(window_start_ts);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_target_window ON diagnosis_history(target, window_start_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_label ON diagnosis_history(diagnosis_label, window_start_ts DESC) WHERE diagnosis_label IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_diagnosis_org ON diagnosis_history(org_id, created_at);
+
+-- Baselines maintained incrementally by the diagnoser, one row per series
+-- (client, target, address family, check type), strategy and bucket. The
+-- hour_of_week strategy keeps one row per hour of the week (bucket 0-167);
+-- the other strategies use bucket 0.
+CREATE TABLE IF NOT EXISTS diagnosis_baselines (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    strategy VARCHAR(16) NOT NULL,
+    bucket SMALLINT NOT NULL DEFAULT 0,
+    state JSONB NOT NULL,
+    window_count INT NOT NULL DEFAULT 0,
+    last_window_ts TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type, strategy, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_diagnosis_baselines_updated ON diagnosis_baselines(updated_at);
+
+-- Change-point detection state per series, with a CUSUM detector per
+-- metric, and the level shifts detected
+CREATE TABLE IF NOT EXISTS change_point_states (
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    state JSONB NOT NULL,
+    last_window_ts TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (client_id, target, address_family, check_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_point_states_updated ON change_point_states(updated_at);
+
+CREATE TABLE IF NOT EXISTS level_shifts (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    metric VARCHAR(32) NOT NULL,
+    direction VARCHAR(8) NOT NULL,
+    before_level DOUBLE PRECISION NOT NULL,
+    after_level DOUBLE PRECISION NOT NULL,
+    change DOUBLE PRECISION NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    detected_at TIMESTAMP NOT NULL,
+    windows INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (client_id, target, address_family, check_type, metric, detected_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_level_shifts_detected ON level_shifts(detected_at);
+
+-- Per-target baseline strategy; targets without a row use the diagnoser's
+-- default strategy
+CREATE TABLE IF NOT EXISTS target_baseline_strategies (
+    target VARCHAR(255) PRIMARY KEY,
+    strategy VARCHAR(16) NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Incidents correlated by the diagnoser across the series of a window: one
+-- row per target-wide, client-wide (client, ASN or label) or localized
+-- (client and target) group of anomalies
+CREATE TABLE IF NOT EXISTS correlated_incidents (
+    id BIGSERIAL PRIMARY KEY,
+    window_start_ts TIMESTAMP NOT NULL,
+    scope VARCHAR(16) NOT NULL,
+    incident_key VARCHAR(600) NOT NULL,
+    label VARCHAR(50) NOT NULL,
+    labels JSONB NOT NULL,
+    clients JSONB NOT NULL,
+    targets JSONB NOT NULL,
+    affected INT NOT NULL DEFAULT 0,
+    observed INT NOT NULL DEFAULT 0,
+    revision INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (window_start_ts, scope, incident_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_correlated_incidents_window ON correlated_incidents(window_start_ts DESC);
+
+-- User-defined alert rules, evaluated by the diagnoser on every flushed
+-- window. A rule fires for a series once its expression has held for
+-- for_seconds; firing rules are alerts of type 'rule'.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    expression TEXT NOT NULL,
+    selector JSONB NOT NULL DEFAULT '{}',
+    for_seconds INT NOT NULL DEFAULT 0,
+    severity VARCHAR(20) NOT NULL,
+    channels JSONB NOT NULL DEFAULT '[]',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Rule state per series, kept only while the rule holds or fires
+CREATE TABLE IF NOT EXISTS alert_rule_states (
+    rule_id INT NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    active_since TIMESTAMP,
+    last_window_ts TIMESTAMP NOT NULL,
+    firing BOOLEAN NOT NULL DEFAULT FALSE,
+    alert_id INT,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rule_id, client_id, target, address_family, check_type)
+);
+
+-- Silences and maintenance windows. Alerts and incidents of the series a
+-- silence matches while it is active are recorded with the silence and not
+-- notified; windows inside a maintenance window are annotated and kept out
+-- of the baselines.
+CREATE TABLE IF NOT EXISTS silences (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL DEFAULT 'maintenance',
+    matchers JSONB NOT NULL DEFAULT '{}',
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    schedule JSONB,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_silences_ends ON silences(ends_at);
+
+-- Alerts. Incidents opened by the diagnoser are alerts of type 'incident';
+-- client_id and target hold the single client or target involved, or '*'
+-- for several. Firing alert rules are alerts of type 'rule'.
 CREATE TABLE IF NOT EXISTS alerts (
     id SERIAL PRIMARY KEY,
     client_id VARCHAR(255) NOT NULL,
@@ -59,11 +403,67 @@ CREATE TABLE IF NOT EXISTS alerts (
     threshold_value DOUBLE PRECISION,
     actual_value DOUBLE PRECISION,
     window_start_ts TIMESTAMP NOT NULL,
+    scope VARCHAR(16),
+    incident_key VARCHAR(600),
+    diagnosis VARCHAR(50),
+    clients JSONB,
+    targets JSONB,
+    last_anomalous_ts TIMESTAMP,
+    last_window_ts TIMESTAMP,
+    anomalous_windows INT NOT NULL DEFAULT 0,
+    healthy_windows INT NOT NULL DEFAULT 0,
+    acknowledged_at TIMESTAMP,
+    acknowledged_by VARCHAR(255),
+    assigned_to VARCHAR(255),
+    rule_id INT REFERENCES alert_rules(id) ON DELETE SET NULL,
+    silence_id INT REFERENCES silences(id) ON DELETE SET NULL,
     created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
     resolved_at TIMESTAMP
 );
 
 -- Indexes for alerts
 CREATE INDEX IF NOT EXISTS idx_alerts_client_target ON alerts(client_id, target);
 CREATE INDEX IF NOT EXISTS idx_alerts_created ON alerts(created_at);
-CREATE INDEX IF NOT EXISTS idx_alerts_unresolved ON alerts(created_at) WHERE resolved_at IS NULL;
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_alerts_unresolved ON alerts(created_at) WHERE resolved_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_incident ON alerts(scope, incident_key)
+    WHERE alert_type = 'incident' AND resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_alerts_rule ON alerts(rule_id, created_at DESC) WHERE rule_id IS NOT NULL;
+
+-- Notification channels alert rules and incidents are sent to, and the
+-- delivery status of each alert event per channel
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    channel_type VARCHAR(16) NOT NULL,
+    config JSONB NOT NULL DEFAULT '{}',
+    title_template TEXT NOT NULL DEFAULT '',
+    body_template TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    alert_id INT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    channel VARCHAR(255) NOT NULL,
+    event VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_deliveries_alert ON alert_deliveries(alert_id, created_at);
+
+-- Rules for the latency, error rate and throughput thresholds of the
+-- system settings
+INSERT INTO alert_rules (name, description, expression, for_seconds, severity, created_by) VALUES
+    ('latency-threshold', 'Total p95 latency above the latency threshold', 'latency_p95 > 500 and count_success >= 5', 300, 'warning', 'system'),
+    ('error-rate-threshold', 'Error rate above the error rate threshold', 'error_rate > 0.05 and count_total >= 5', 300, 'error', 'system'),
+    ('throughput-threshold', 'Median throughput below the throughput threshold', 'throughput_p50 < 10000', 300, 'warning', 'system')
+ON CONFLICT (name) DO NOTHING;
\ No newline at end of file
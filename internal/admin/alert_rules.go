@@ -0,0 +1,478 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/alerting"
+	"github.com/rahulgh33/wirescope/internal/database"
+)
+
+// AlertRule is an alert rule as exposed by the API. For is a duration such
+// as "5m".
+type AlertRule struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Expression  string            `json:"expression"`
+	Selector    alerting.Selector `json:"selector"`
+	For         string            `json:"for"`
+	Severity    string            `json:"severity"`
+	Channels    []string          `json:"channels"`
+	Enabled     bool              `json:"enabled"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// AlertRuleRequest creates or replaces an alert rule
+type AlertRuleRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Expression  string            `json:"expression"`
+	Selector    alerting.Selector `json:"selector"`
+	For         string            `json:"for"`
+	Severity    string            `json:"severity"`
+	Channels    []string          `json:"channels"`
+	Enabled     *bool             `json:"enabled,omitempty"`
+}
+
+// RegisterAlertRuleRoutes registers the alert rule routes and the routes
+// listing the alerts rules fired and their notification deliveries. The diagnoser picks up rule changes
+// within a minute.
+func (s *Service) RegisterAlertRuleRoutes(router *mux.Router) {
+	ruleRouter := router.PathPrefix("/api/v1/admin/alert-rules").Subrouter()
+	ruleRouter.Use(s.requireAuth)
+	ruleRouter.HandleFunc("", s.listAlertRules).Methods("GET")
+	ruleRouter.HandleFunc("", s.createAlertRule).Methods("POST")
+	ruleRouter.HandleFunc("/{id}", s.getAlertRule).Methods("GET")
+	ruleRouter.HandleFunc("/{id}", s.updateAlertRule).Methods("PUT")
+	ruleRouter.HandleFunc("/{id}", s.deleteAlertRule).Methods("DELETE")
+
+	alertRouter := router.PathPrefix("/api/v1/alerts").Subrouter()
+	alertRouter.Use(s.requireAuth)
+	alertRouter.HandleFunc("", s.listRuleAlerts).Methods("GET")
+	alertRouter.HandleFunc("/{id}/deliveries", s.listAlertDeliveries).Methods("GET")
+}
+
+func (s *Service) alertRuleRepo() *database.AlertRuleRepository {
+	return database.NewAlertRuleRepository(s.repo.Connection())
+}
+
+// alertRuleID parses the alert rule ID of a request, or returns false
+func alertRuleID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	return id, err == nil && id > 0
+}
+
+// toAlertRule converts a stored alert rule for the API
+func toAlertRule(rec *database.AlertRuleRecord) (*AlertRule, error) {
+	rule := &AlertRule{
+		ID:          rec.ID,
+		Name:        rec.Name,
+		Description: rec.Description,
+		Expression:  rec.Expression,
+		For:         (time.Duration(rec.ForSeconds) * time.Second).String(),
+		Severity:    rec.Severity,
+		Enabled:     rec.Enabled,
+		CreatedBy:   rec.CreatedBy,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+	if err := json.Unmarshal(rec.Selector, &rule.Selector); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal selector of alert rule %d: %w", rec.ID, err)
+	}
+	if err := json.Unmarshal(rec.Channels, &rule.Channels); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal channels of alert rule %d: %w", rec.ID, err)
+	}
+	if rule.Channels == nil {
+		rule.Channels = []string{}
+	}
+	return rule, nil
+}
+
+// alertRuleRecord validates a request and converts it for storing
+func alertRuleRecord(req *AlertRuleRequest) (*database.AlertRuleRecord, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	var forDuration time.Duration
+	if req.For != "" {
+		var err error
+		if forDuration, err = time.ParseDuration(req.For); err != nil {
+			return nil, fmt.Errorf("for must be a duration such as 5m")
+		}
+	}
+	for _, channel := range req.Channels {
+		if strings.TrimSpace(channel) == "" {
+			return nil, fmt.Errorf("channels must not be empty")
+		}
+	}
+	if _, err := alerting.NewRule(req.Name, req.Expression, req.Selector, forDuration, req.Severity, req.Channels); err != nil {
+		return nil, err
+	}
+
+	selector, err := json.Marshal(req.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal selector: %w", err)
+	}
+	channels := req.Channels
+	if channels == nil {
+		channels = []string{}
+	}
+	channelsJSON, err := json.Marshal(channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal channels: %w", err)
+	}
+	rec := &database.AlertRuleRecord{
+		Name:        req.Name,
+		Description: req.Description,
+		Expression:  req.Expression,
+		Selector:    selector,
+		ForSeconds:  int(forDuration / time.Second),
+		Severity:    req.Severity,
+		Channels:    channelsJSON,
+		Enabled:     true,
+	}
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+	return rec, nil
+}
+
+func (s *Service) listAlertRules(w http.ResponseWriter, r *http.Request) {
+	records, err := s.alertRuleRepo().ListAlertRules(r.Context(), false)
+	if err != nil {
+		log.Printf("Failed to list alert rules: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list alert rules")
+		return
+	}
+
+	rules := []*AlertRule{}
+	for i := range records {
+		rule, err := toAlertRule(&records[i])
+		if err != nil {
+			log.Printf("Failed to list alert rules: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to list alert rules")
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rules":  rules,
+		"fields": alertRuleFields(),
+	})
+}
+
+// alertRuleFields lists the fields rule expressions can use
+func alertRuleFields() map[string][]string {
+	fields := map[string][]string{"number": {}, "string": {}}
+	for name := range alerting.NumberFields {
+		fields["number"] = append(fields["number"], name)
+	}
+	for name := range alerting.StringFields {
+		fields["string"] = append(fields["string"], name)
+	}
+	sort.Strings(fields["number"])
+	sort.Strings(fields["string"])
+	return fields
+}
+
+func (s *Service) getAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := alertRuleID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+	rec, err := s.alertRuleRepo().GetAlertRule(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get alert rule %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get alert rule")
+		return
+	}
+	if rec == nil {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+	rule, err := toAlertRule(rec)
+	if err != nil {
+		log.Printf("Failed to get alert rule %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get alert rule")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (s *Service) createAlertRule(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rec, err := alertRuleRecord(&req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec.CreatedBy = s.getCurrentUser(r).Username
+
+	if err := s.alertRuleRepo().CreateAlertRule(r.Context(), rec); err != nil {
+		if errors.Is(err, database.ErrAlertRuleExists) {
+			respondError(w, http.StatusConflict, "Alert rule already exists")
+			return
+		}
+		log.Printf("Failed to create alert rule %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to create alert rule")
+		return
+	}
+	rule, err := toAlertRule(rec)
+	if err != nil {
+		log.Printf("Failed to create alert rule %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to create alert rule")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Service) updateAlertRule(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	id, ok := alertRuleID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rec, err := alertRuleRecord(&req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec.ID = id
+
+	updated, err := s.alertRuleRepo().UpdateAlertRule(r.Context(), rec)
+	if err != nil {
+		if errors.Is(err, database.ErrAlertRuleExists) {
+			respondError(w, http.StatusConflict, "Alert rule already exists")
+			return
+		}
+		log.Printf("Failed to update alert rule %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to update alert rule")
+		return
+	}
+	if !updated {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+	rule, err := toAlertRule(rec)
+	if err != nil {
+		log.Printf("Failed to update alert rule %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to update alert rule")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func (s *Service) deleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	id, ok := alertRuleID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+
+	deleted, err := s.alertRuleRepo().DeleteAlertRule(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to delete alert rule %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to delete alert rule")
+		return
+	}
+	if !deleted {
+		respondError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) listRuleAlerts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var ruleID int64
+	if value := params.Get("rule_id"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			respondError(w, http.StatusBadRequest, "rule_id must be a rule ID")
+			return
+		}
+		ruleID = parsed
+	}
+	status := params.Get("status")
+	if status != "" && status != "firing" {
+		respondError(w, http.StatusBadRequest, "status must be firing")
+		return
+	}
+	hours := 24
+	if value := params.Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 720 {
+			respondError(w, http.StatusBadRequest, "hours must be between 1 and 720")
+			return
+		}
+		hours = parsed
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	alerts, err := s.alertRuleRepo().ListRuleAlerts(r.Context(), ruleID, status == "firing", since, limit)
+	if err != nil {
+		log.Printf("Failed to list rule alerts: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list alerts")
+		return
+	}
+	if alerts == nil {
+		alerts = []database.RuleAlertRecord{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts": alerts,
+		"total":  len(alerts),
+	})
+}
+
+// thresholdRule is a built-in alert rule evaluating a threshold of the
+// system settings. The threshold is the number following prefix in the
+// rule's expression, in the setting's unit times scale.
+type thresholdRule struct {
+	name   string
+	prefix string
+	suffix string
+	scale  float64
+}
+
+var (
+	latencyThresholdRule   = thresholdRule{name: "latency-threshold", prefix: "latency_p95 > ", suffix: " and count_success >= 5", scale: 1}
+	errorRateThresholdRule = thresholdRule{name: "error-rate-threshold", prefix: "error_rate > ", suffix: " and count_total >= 5", scale: 1}
+	// Thresholds are in Mbps, throughput in kbps
+	throughputThresholdRule = thresholdRule{name: "throughput-threshold", prefix: "throughput_p50 < ", scale: 1000}
+)
+
+// expression returns the rule's expression for a threshold
+func (t thresholdRule) expression(threshold float64) string {
+	return t.prefix + formatThreshold(threshold*t.scale) + t.suffix
+}
+
+// threshold parses the threshold of the rule's expression, or returns false
+// if the expression was edited into another form
+func (t thresholdRule) threshold(expression string) (float64, bool) {
+	rest, ok := strings.CutPrefix(expression, t.prefix)
+	if !ok {
+		return 0, false
+	}
+	literal, rest, _ := strings.Cut(rest, " ")
+	if rest != strings.TrimPrefix(t.suffix, " ") {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v / t.scale, true
+}
+
+// loadThresholds sets the thresholds of settings to those of the built-in
+// threshold rules, which the diagnoser evaluates. A rule that was deleted
+// or whose expression was edited leaves its threshold unchanged.
+func (s *Service) loadThresholds(ctx context.Context, settings *SystemSettings) error {
+	records, err := s.alertRuleRepo().ListAlertRules(ctx, false)
+	if err != nil {
+		return err
+	}
+	thresholds := map[thresholdRule]*float64{
+		latencyThresholdRule:    &settings.LatencyThresholdMs,
+		errorRateThresholdRule:  &settings.ErrorRateThreshold,
+		throughputThresholdRule: &settings.ThroughputThresholdMb,
+	}
+	for _, rec := range records {
+		for rule, threshold := range thresholds {
+			if rec.Name != rule.name {
+				continue
+			}
+			if v, ok := rule.threshold(rec.Expression); ok {
+				*threshold = v
+			}
+		}
+	}
+	return nil
+}
+
+// syncThresholdRules updates the built-in threshold rules to the thresholds
+// of a settings update. It fails if a rule no longer exists.
+func (s *Service) syncThresholdRules(ctx context.Context, req *UpdateSettingsRequest) error {
+	expressions := map[string]string{}
+	if req.LatencyThresholdMs != nil {
+		expressions[latencyThresholdRule.name] = latencyThresholdRule.expression(*req.LatencyThresholdMs)
+	}
+	if req.ErrorRateThreshold != nil {
+		expressions[errorRateThresholdRule.name] = errorRateThresholdRule.expression(*req.ErrorRateThreshold)
+	}
+	if req.ThroughputThresholdMb != nil {
+		expressions[throughputThresholdRule.name] = throughputThresholdRule.expression(*req.ThroughputThresholdMb)
+	}
+
+	repo := s.alertRuleRepo()
+	for name, expression := range expressions {
+		updated, err := repo.SetAlertRuleExpression(ctx, name, expression)
+		if err != nil {
+			return fmt.Errorf("failed to update alert rule %s: %w", name, err)
+		}
+		if !updated {
+			return fmt.Errorf("%w: %s", errThresholdRuleMissing, name)
+		}
+	}
+	return nil
+}
+
+// errThresholdRuleMissing is returned when a built-in threshold rule was
+// deleted
+var errThresholdRuleMissing = errors.New("built-in alert rule not found")
+
+// formatThreshold formats a threshold as an expression literal
+func formatThreshold(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
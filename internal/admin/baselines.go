@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+)
+
+// SetBaselineStrategyRequest sets the baseline strategy of a target
+type SetBaselineStrategyRequest struct {
+	Target   string `json:"target"`
+	Strategy string `json:"strategy"`
+}
+
+// RegisterBaselineRoutes registers the per-target baseline strategy routes.
+// The diagnoser picks up changes within a minute.
+func (s *Service) RegisterBaselineRoutes(router *mux.Router) {
+	baselineRouter := router.PathPrefix("/api/v1/admin/baseline-strategies").Subrouter()
+	baselineRouter.Use(s.requireAuth)
+	baselineRouter.HandleFunc("", s.listBaselineStrategies).Methods("GET")
+	baselineRouter.HandleFunc("", s.setBaselineStrategy).Methods("PUT")
+	baselineRouter.HandleFunc("", s.deleteBaselineStrategy).Methods("DELETE")
+}
+
+func (s *Service) diagnosisRepo() *database.DiagnosisRepository {
+	return database.NewDiagnosisRepository(s.repo.Connection())
+}
+
+func (s *Service) listBaselineStrategies(w http.ResponseWriter, r *http.Request) {
+	targets, err := s.diagnosisRepo().ListTargetBaselineStrategies(r.Context())
+	if err != nil {
+		log.Printf("Failed to list baseline strategies: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list baseline strategies")
+		return
+	}
+	if targets == nil {
+		targets = []database.TargetBaselineStrategy{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"strategies": diagnosis.BaselineStrategies,
+		"targets":    targets,
+	})
+}
+
+func (s *Service) setBaselineStrategy(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req SetBaselineStrategyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Target = strings.TrimSpace(req.Target)
+	if req.Target == "" {
+		respondError(w, http.StatusBadRequest, "target is required")
+		return
+	}
+	if !diagnosis.ValidBaselineStrategy(req.Strategy) {
+		respondError(w, http.StatusBadRequest, "strategy must be one of mean, ewma, hour_of_week, robust")
+		return
+	}
+
+	setting := &database.TargetBaselineStrategy{
+		Target:    req.Target,
+		Strategy:  req.Strategy,
+		UpdatedBy: s.getCurrentUser(r).Username,
+	}
+	if err := s.diagnosisRepo().SetTargetBaselineStrategy(r.Context(), setting); err != nil {
+		log.Printf("Failed to set baseline strategy for %s: %v", req.Target, err)
+		respondError(w, http.StatusInternalServerError, "Failed to set baseline strategy")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, setting)
+}
+
+func (s *Service) deleteBaselineStrategy(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		respondError(w, http.StatusBadRequest, "target is required")
+		return
+	}
+	deleted, err := s.diagnosisRepo().DeleteTargetBaselineStrategy(r.Context(), target)
+	if err != nil {
+		log.Printf("Failed to delete baseline strategy for %s: %v", target, err)
+		respondError(w, http.StatusInternalServerError, "Failed to delete baseline strategy")
+		return
+	}
+	if !deleted {
+		respondError(w, http.StatusNotFound, "Target has no baseline strategy")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,11 +1,18 @@
 package admin
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/diagnosis"
+	"github.com/rahulgh33/wirescope/internal/models"
 )
 
 // RegisterDashboardRoutes registers dashboard and data API routes
@@ -25,10 +32,21 @@ func (s *Service) RegisterDashboardRoutes(router *mux.Router) {
 	// Targets
 	api.HandleFunc("/targets", s.getTargets).Methods("GET")
 	api.HandleFunc("/targets/{target}", s.getTargetDetail).Methods("GET")
+	api.HandleFunc("/targets/{target}/address-families", s.getTargetAddressFamilies).Methods("GET")
+
+	// Transactions
+	api.HandleFunc("/transactions/{name}/steps", s.getTransactionSteps).Methods("GET")
+
+	// Path traces
+	api.HandleFunc("/path-traces", s.getPathTraces).Methods("GET")
+
+	// Probe clock skew
+	api.HandleFunc("/clock-skew", s.getClockSkew).Methods("GET")
 
 	// Diagnostics
 	api.HandleFunc("/diagnostics", s.getDiagnostics).Methods("GET")
 	api.HandleFunc("/diagnostics/trends", s.getDiagnosticsTrends).Methods("GET")
+	api.HandleFunc("/diagnostics/correlated", s.getCorrelatedIncidents).Methods("GET")
 }
 
 // Dashboard handlers
@@ -193,8 +211,18 @@ func (s *Service) getClients(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		// Heartbeats are authoritative for liveness; without them fall back
+		// to how recently the client produced aggregates
 		status := "inactive"
-		if time.Since(lastSeen) < 5*time.Minute {
+		if liveness, ok := s.probeLivenessOf(clientID); ok {
+			if liveness.status == models.ProbeStatusOnline {
+				status = "active"
+				activeCount++
+			}
+			if liveness.lastSeen.After(lastSeen) {
+				lastSeen = liveness.lastSeen
+			}
+		} else if time.Since(lastSeen) < 5*time.Minute {
 			status = "active"
 			activeCount++
 		} else if time.Since(lastSeen) < 30*time.Minute {
@@ -343,9 +371,12 @@ func (s *Service) getClientPerformance(w http.ResponseWriter, r *http.Request) {
 func (s *Service) getTargets(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	checkType := r.URL.Query().Get("check_type")
+
 	query := `
 		SELECT 
 			target,
+			check_type,
 			COUNT(DISTINCT client_id) as active_clients,
 			MAX(window_start_ts) as last_checked,
 			SUM(count_total) as request_count,
@@ -353,11 +384,16 @@ func (s *Service) getTargets(w http.ResponseWriter, r *http.Request) {
 			COALESCE(AVG(CASE WHEN ttfb_p50 > 0 THEN ttfb_p50 END), 0) as avg_latency_ms
 		FROM agg_1m
 		WHERE window_start_ts >= NOW() - INTERVAL '24 hours'
-		GROUP BY target
-		ORDER BY last_checked DESC
 	`
 
-	rows, err := s.repo.Connection().DB().QueryContext(ctx, query)
+	args := []interface{}{}
+	if checkType != "" {
+		query += ` AND check_type = $1`
+		args = append(args, checkType)
+	}
+	query += ` GROUP BY target, check_type ORDER BY last_checked DESC`
+
+	rows, err := s.repo.Connection().DB().QueryContext(ctx, query, args...)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
 		return
@@ -367,12 +403,12 @@ func (s *Service) getTargets(w http.ResponseWriter, r *http.Request) {
 	targets := []map[string]interface{}{}
 
 	for rows.Next() {
-		var target string
+		var target, targetCheckType string
 		var activeClients, requestCount, errorCount int
 		var lastChecked time.Time
 		var avgLatencyMs float64
 
-		if err := rows.Scan(&target, &activeClients, &lastChecked, &requestCount, &errorCount, &avgLatencyMs); err != nil {
+		if err := rows.Scan(&target, &targetCheckType, &activeClients, &lastChecked, &requestCount, &errorCount, &avgLatencyMs); err != nil {
 			continue
 		}
 
@@ -391,6 +427,7 @@ func (s *Service) getTargets(w http.ResponseWriter, r *http.Request) {
 
 		targets = append(targets, map[string]interface{}{
 			"target":         target,
+			"check_type":     targetCheckType,
 			"status":         status,
 			"avg_latency_ms": avgLatencyMs,
 			"request_count":  requestCount,
@@ -486,11 +523,354 @@ func (s *Service) getTargetDetail(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, detail)
 }
 
+// getTargetAddressFamilies compares a target's performance per address family
+// over the last 24 hours so broken IPv6 on dual-stack sites stands out
+func (s *Service) getTargetAddressFamilies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	target := vars["target"]
+	ctx := r.Context()
+
+	query := `
+		SELECT 
+			address_family,
+			COUNT(DISTINCT client_id) as active_clients,
+			MAX(window_start_ts) as last_checked,
+			SUM(count_total) as request_count,
+			SUM(count_error) as error_count,
+			SUM(dns_error_count) as dns_error_count,
+			SUM(tcp_error_count) as tcp_error_count,
+			SUM(tls_error_count) as tls_error_count,
+			COALESCE(AVG(CASE WHEN tcp_p95 > 0 THEN tcp_p95 END), 0) as tcp_p95_ms,
+			COALESCE(AVG(CASE WHEN ttfb_p95 > 0 THEN ttfb_p95 END), 0) as ttfb_p95_ms,
+			COALESCE(AVG(CASE WHEN throughput_p50 > 0 THEN throughput_p50 END), 0) as throughput_p50_kbps
+		FROM agg_1m
+		WHERE target = $1
+		  AND address_family <> ''
+		  AND window_start_ts >= NOW() - INTERVAL '24 hours'
+		GROUP BY address_family
+		ORDER BY address_family
+	`
+
+	rows, err := s.repo.Connection().DB().QueryContext(ctx, query, target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	families := []map[string]interface{}{}
+
+	for rows.Next() {
+		var family string
+		var activeClients, requestCount, errorCount, dnsErrors, tcpErrors, tlsErrors int
+		var lastChecked time.Time
+		var tcpP95, ttfbP95, throughputP50 float64
+
+		if err := rows.Scan(&family, &activeClients, &lastChecked, &requestCount, &errorCount,
+			&dnsErrors, &tcpErrors, &tlsErrors, &tcpP95, &ttfbP95, &throughputP50); err != nil {
+			continue
+		}
+
+		errorRate := float64(0)
+		if requestCount > 0 {
+			errorRate = float64(errorCount) / float64(requestCount)
+		}
+
+		status := "healthy"
+		if errorRate > 0.05 {
+			status = "degraded"
+		}
+		if errorRate > 0.2 || time.Since(lastChecked) > 10*time.Minute {
+			status = "unhealthy"
+		}
+
+		families = append(families, map[string]interface{}{
+			"address_family":      family,
+			"status":              status,
+			"active_clients":      activeClients,
+			"request_count":       requestCount,
+			"error_count":         errorCount,
+			"error_rate":          errorRate,
+			"dns_error_count":     dnsErrors,
+			"tcp_error_count":     tcpErrors,
+			"tls_error_count":     tlsErrors,
+			"tcp_p95_ms":          tcpP95,
+			"ttfb_p95_ms":         ttfbP95,
+			"throughput_p50_kbps": throughputP50,
+			"last_checked":        lastChecked.Format(time.RFC3339),
+		})
+	}
+
+	response := map[string]interface{}{
+		"target":           target,
+		"address_families": families,
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// getTransactionSteps breaks a scripted transaction down into its steps over
+// the last 24 hours. Steps are stored as sub-targets of the transaction target.
+func (s *Service) getTransactionSteps(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+	ctx := r.Context()
+
+	transactionTarget := models.TransactionTarget(name)
+
+	query := `
+		SELECT 
+			target,
+			COUNT(DISTINCT client_id) as active_clients,
+			MAX(window_start_ts) as last_checked,
+			SUM(count_total) as request_count,
+			SUM(count_error) as error_count,
+			SUM(assertion_error_count) as assertion_error_count,
+			COALESCE(AVG(CASE WHEN dns_p95 > 0 THEN dns_p95 END), 0) as dns_p95_ms,
+			COALESCE(AVG(CASE WHEN tcp_p95 > 0 THEN tcp_p95 END), 0) as tcp_p95_ms,
+			COALESCE(AVG(CASE WHEN tls_p95 > 0 THEN tls_p95 END), 0) as tls_p95_ms,
+			COALESCE(AVG(CASE WHEN ttfb_p95 > 0 THEN ttfb_p95 END), 0) as ttfb_p95_ms
+		FROM agg_1m
+		WHERE (target = $1 OR target LIKE $2)
+		  AND window_start_ts >= NOW() - INTERVAL '24 hours'
+		GROUP BY target
+		ORDER BY target
+	`
+
+	rows, err := s.repo.Connection().DB().QueryContext(ctx, query,
+		transactionTarget, transactionTarget+models.TransactionStepSeparator+"%")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var overall map[string]interface{}
+	steps := []map[string]interface{}{}
+
+	for rows.Next() {
+		var target string
+		var activeClients, requestCount, errorCount, assertionErrors int
+		var lastChecked time.Time
+		var dnsP95, tcpP95, tlsP95, ttfbP95 float64
+
+		if err := rows.Scan(&target, &activeClients, &lastChecked, &requestCount, &errorCount,
+			&assertionErrors, &dnsP95, &tcpP95, &tlsP95, &ttfbP95); err != nil {
+			continue
+		}
+
+		errorRate := float64(0)
+		if requestCount > 0 {
+			errorRate = float64(errorCount) / float64(requestCount)
+		}
+
+		entry := map[string]interface{}{
+			"target":                target,
+			"active_clients":        activeClients,
+			"request_count":         requestCount,
+			"error_count":           errorCount,
+			"error_rate":            errorRate,
+			"assertion_error_count": assertionErrors,
+			"dns_p95_ms":            dnsP95,
+			"tcp_p95_ms":            tcpP95,
+			"tls_p95_ms":            tlsP95,
+			"ttfb_p95_ms":           ttfbP95,
+			"last_checked":          lastChecked.Format(time.RFC3339),
+		}
+
+		_, step, _ := models.ParseTransactionTarget(target)
+		if step == "" {
+			overall = entry
+			continue
+		}
+		entry["step"] = step
+		steps = append(steps, entry)
+	}
+
+	response := map[string]interface{}{
+		"transaction": name,
+		"target":      transactionTarget,
+		"overall":     overall,
+		"steps":       steps,
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// getPathTraces lists recent path traces with their hop lists, optionally
+// filtered by client_id and target, or only those that changed path
+func (s *Service) getPathTraces(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	limit := 50
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	query := `
+		SELECT
+			event_id, client_id, target, address_family, protocol, port,
+			method, trigger, COALESCE(destination_ip, ''), reached, hops,
+			path_signature, path_changed, duration_ms, ts
+		FROM path_traces
+		WHERE ts >= NOW() - INTERVAL '7 days'
+	`
+
+	args := []interface{}{}
+	if clientID := params.Get("client_id"); clientID != "" {
+		args = append(args, clientID)
+		query += fmt.Sprintf(" AND client_id = $%d", len(args))
+	}
+	if target := params.Get("target"); target != "" {
+		args = append(args, target)
+		query += fmt.Sprintf(" AND target = $%d", len(args))
+	}
+	if params.Get("changed") == "true" {
+		query += " AND path_changed"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY ts DESC LIMIT $%d", len(args))
+
+	rows, err := s.repo.Connection().DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	traces := []map[string]interface{}{}
+
+	for rows.Next() {
+		var eventID, clientID, target, addressFamily, protocol, method, trigger, destinationIP, signature string
+		var port int
+		var reached, changed bool
+		var hops []byte
+		var durationMs float64
+		var ts time.Time
+
+		if err := rows.Scan(&eventID, &clientID, &target, &addressFamily, &protocol, &port,
+			&method, &trigger, &destinationIP, &reached, &hops, &signature, &changed, &durationMs, &ts); err != nil {
+			continue
+		}
+
+		traces = append(traces, map[string]interface{}{
+			"event_id":       eventID,
+			"client_id":      clientID,
+			"target":         target,
+			"address_family": addressFamily,
+			"protocol":       protocol,
+			"port":           port,
+			"method":         method,
+			"trigger":        trigger,
+			"destination_ip": destinationIP,
+			"reached":        reached,
+			"hops":           json.RawMessage(hops),
+			"path_signature": signature,
+			"path_changed":   changed,
+			"duration_ms":    durationMs,
+			"timestamp":      ts.Format(time.RFC3339),
+		})
+	}
+
+	response := map[string]interface{}{
+		"path_traces": traces,
+		"total":       len(traces),
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// getClockSkew lists per-client clock skew statistics (server clock minus
+// probe clock) with the distribution of absolute skew, worst clients first.
+// skewed=true limits the list to clients with events beyond the threshold.
+func (s *Service) getClockSkew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	query := `
+		SELECT
+			client_id, samples, skewed_events, corrected_events, last_skew_ms,
+			min_skew_ms, max_skew_ms, sum_abs_skew_ms,
+			skew_lt_100ms, skew_lt_1s, skew_lt_10s, skew_lt_60s, skew_ge_60s,
+			last_seen_at
+		FROM client_clock_skew
+		WHERE samples > 0
+	`
+
+	args := []interface{}{}
+	if clientID := params.Get("client_id"); clientID != "" {
+		args = append(args, clientID)
+		query += fmt.Sprintf(" AND client_id = $%d", len(args))
+	}
+	if params.Get("skewed") == "true" {
+		query += " AND skewed_events > 0"
+	}
+	query += " ORDER BY ABS(last_skew_ms) DESC, client_id"
+
+	rows, err := s.repo.Connection().DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	clients := []map[string]interface{}{}
+
+	for rows.Next() {
+		var clientID string
+		var samples, skewed, corrected, lastSkew, minSkew, maxSkew int64
+		var sumAbsSkew float64
+		var lt100ms, lt1s, lt10s, lt60s, ge60s int64
+		var lastSeen time.Time
+
+		if err := rows.Scan(&clientID, &samples, &skewed, &corrected, &lastSkew,
+			&minSkew, &maxSkew, &sumAbsSkew,
+			&lt100ms, &lt1s, &lt10s, &lt60s, &ge60s, &lastSeen); err != nil {
+			continue
+		}
+
+		clients = append(clients, map[string]interface{}{
+			"client_id":        clientID,
+			"samples":          samples,
+			"skewed_events":    skewed,
+			"corrected_events": corrected,
+			"last_skew_ms":     lastSkew,
+			"min_skew_ms":      minSkew,
+			"max_skew_ms":      maxSkew,
+			"mean_abs_skew_ms": sumAbsSkew / float64(samples),
+			"distribution": map[string]int64{
+				"lt_100ms": lt100ms,
+				"lt_1s":    lt1s,
+				"lt_10s":   lt10s,
+				"lt_60s":   lt60s,
+				"ge_60s":   ge60s,
+			},
+			"last_seen": lastSeen.Format(time.RFC3339),
+		})
+	}
+
+	response := map[string]interface{}{
+		"clients": clients,
+		"total":   len(clients),
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
 // Diagnostics handlers
 func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Query for issues: high error rates, high latencies, etc.
+	// Windows inside maintenance periods are annotated, or left out with
+	// maintenance=exclude
+	maintenanceFilter := ""
+	if r.URL.Query().Get("maintenance") == "exclude" {
+		maintenanceFilter = "AND NOT COALESCE(maintenance, FALSE)"
+	}
+
+	// Query for issues: diagnosed windows, high error rates, high latencies, etc.
 	query := `
 		SELECT 
 			client_id,
@@ -499,10 +879,14 @@ func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 			count_total,
 			count_error,
 			COALESCE(ttfb_p95, 0) as ttfb_p95,
-			COALESCE(dns_p95, 0) as dns_p95
+			COALESCE(dns_p95, 0) as dns_p95,
+			diagnosis_details,
+			COALESCE(maintenance, FALSE) as maintenance,
+			silences
 		FROM agg_1m
 		WHERE window_start_ts >= NOW() - INTERVAL '24 hours'
-		  AND (count_error > 0 OR ttfb_p95 > 1000 OR dns_p95 > 500)
+		  AND (diagnosis_label IS NOT NULL OR count_error > 0 OR ttfb_p95 > 1000 OR dns_p95 > 500)
+		  ` + maintenanceFilter + `
 		ORDER BY window_start_ts DESC
 		LIMIT 50
 	`
@@ -522,11 +906,22 @@ func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 		var timestamp time.Time
 		var countTotal, countError int
 		var ttfbP95, dnsP95 float64
+		var details, silences []byte
+		var maintenance bool
 
-		if err := rows.Scan(&clientID, &target, &timestamp, &countTotal, &countError, &ttfbP95, &dnsP95); err != nil {
+		if err := rows.Scan(&clientID, &target, &timestamp, &countTotal, &countError, &ttfbP95, &dnsP95, &details, &maintenance, &silences); err != nil {
 			continue
 		}
 
+		// Diagnosis engine result, if the window was diagnosed with an issue
+		var result *diagnosis.Result
+		if len(details) > 0 {
+			result = &diagnosis.Result{}
+			if err := json.Unmarshal(details, result); err != nil || result.Label == diagnosis.DiagnosisNone {
+				result = nil
+			}
+		}
+
 		errorRate := float64(0)
 		if countTotal > 0 {
 			errorRate = float64(countError) / float64(countTotal)
@@ -536,7 +931,19 @@ func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 		var label, description, severity string
 		metrics := map[string]interface{}{}
 
-		if errorRate > 0.5 {
+		if result != nil {
+			label = string(result.Label)
+			description = describeFindings(result.Findings)
+			severity = "warning"
+			if diagnosis.IsErrorDriven(result.Label) {
+				severity = "error"
+			}
+			for _, f := range result.Findings {
+				for _, e := range f.Evidence {
+					metrics[e.Metric] = e.Value
+				}
+			}
+		} else if errorRate > 0.5 {
 			label = "High Error Rate"
 			description = fmt.Sprintf("Error rate: %.1f%%", errorRate*100)
 			severity = "error"
@@ -571,6 +978,18 @@ func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 			"description": description,
 			"metrics":     metrics,
 		}
+		if result != nil {
+			diag["labels"] = result.Labels()
+			diag["confidence"] = result.Confidence()
+			diag["findings"] = result.Findings
+		}
+		diag["maintenance"] = maintenance
+		if len(silences) > 0 {
+			var silenceIDs []int64
+			if err := json.Unmarshal(silences, &silenceIDs); err == nil && len(silenceIDs) > 0 {
+				diag["silence_ids"] = silenceIDs
+			}
+		}
 		diagnostics = append(diagnostics, diag)
 		diagID++
 	}
@@ -582,6 +1001,28 @@ func (s *Service) getDiagnostics(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, response)
 }
 
+// describeFindings summarizes diagnosis findings, e.g. "dns-bound (85%
+// confidence): dns_p95 412.0 vs baseline 40.0, threshold 60.0"
+func describeFindings(findings []diagnosis.Finding) string {
+	parts := make([]string, 0, len(findings))
+	for _, f := range findings {
+		part := fmt.Sprintf("%s (%.0f%% confidence)", f.Label, f.Confidence*100)
+		var evidence []string
+		for _, e := range f.Evidence {
+			if e.Baseline != 0 {
+				evidence = append(evidence, fmt.Sprintf("%s %.1f vs baseline %.1f, threshold %.1f", e.Metric, e.Value, e.Baseline, e.Threshold))
+			} else {
+				evidence = append(evidence, fmt.Sprintf("%s %.2f, threshold %.2f", e.Metric, e.Value, e.Threshold))
+			}
+		}
+		if len(evidence) > 0 {
+			part += ": " + strings.Join(evidence, "; ")
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " | ")
+}
+
 func (s *Service) getDiagnosticsTrends(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -649,8 +1090,86 @@ func (s *Service) getDiagnosticsTrends(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Level shifts detected over the same period, optionally for one client
+	// or target
+	params := r.URL.Query()
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	shifts, err := s.diagnosisRepo().ListLevelShifts(ctx, since, params.Get("client_id"), params.Get("target"), 200)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if shifts == nil {
+		shifts = []database.LevelShiftRecord{}
+	}
+
+	response := map[string]interface{}{
+		"trends":       trends,
+		"level_shifts": shifts,
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// getCorrelatedIncidents lists the incidents the diagnoser correlated across
+// clients over the last hours (default 24), most recent window first,
+// optionally limited to one scope
+func (s *Service) getCorrelatedIncidents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	hours := 24
+	if value := params.Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 168 {
+			http.Error(w, "hours must be between 1 and 168", http.StatusBadRequest)
+			return
+		}
+		hours = parsed
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	scope := params.Get("scope")
+	switch diagnosis.Scope(scope) {
+	case "", diagnosis.ScopeTarget, diagnosis.ScopeClient, diagnosis.ScopeLocalized:
+	default:
+		http.Error(w, "scope must be target-wide, client-wide or localized", http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	records, err := s.diagnosisRepo().ListCorrelatedIncidents(r.Context(), since, scope, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	incidents := []map[string]interface{}{}
+	for _, rec := range records {
+		incidents = append(incidents, map[string]interface{}{
+			"id":              rec.ID,
+			"window_start_ts": rec.WindowStartTs.Format(time.RFC3339),
+			"scope":           rec.Scope,
+			"key":             rec.Key,
+			"diagnosis":       rec.Label,
+			"labels":          json.RawMessage(rec.Labels),
+			"clients":         json.RawMessage(rec.Clients),
+			"targets":         json.RawMessage(rec.Targets),
+			"affected":        rec.Affected,
+			"observed":        rec.Observed,
+			"revision":        rec.Revision,
+			"updated_at":      rec.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
 	response := map[string]interface{}{
-		"trends": trends,
+		"incidents": incidents,
+		"total":     len(incidents),
 	}
 	respondJSON(w, http.StatusOK, response)
 }
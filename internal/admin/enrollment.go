@@ -0,0 +1,474 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/models"
+	"github.com/rahulgh33/wirescope/internal/probe"
+)
+
+// Enrollment code lifetime bounds
+const (
+	defaultEnrollmentTTL = time.Hour
+	maxEnrollmentTTL     = 7 * 24 * time.Hour
+)
+
+// probeTokenPrefix marks ingest tokens issued through enrollment
+const probeTokenPrefix = "wsp_"
+
+// maxEnrollBody bounds the size of enrollment requests from probes
+const maxEnrollBody = 64 << 10
+
+// Enrollment code states reported by the admin API
+const (
+	EnrollmentStatusPending  = "pending"
+	EnrollmentStatusEnrolled = "enrolled"
+	EnrollmentStatusExpired  = "expired"
+	EnrollmentStatusRevoked  = "revoked"
+)
+
+// CreateEnrollmentRequest represents a request to create an enrollment code
+type CreateEnrollmentRequest struct {
+	Name string `json:"name"`
+
+	// ClientID pins the enrolling probe's client ID; empty keeps the probe's
+	// own ID or assigns a new one
+	ClientID string `json:"client_id,omitempty"`
+
+	// TTLSeconds is how long the code can be redeemed (default 3600, at
+	// most 7 days)
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+
+	Config models.EnrollmentConfig `json:"config"`
+}
+
+// EnrollmentResponse describes an enrollment code. Code is only returned
+// when the code is created.
+type EnrollmentResponse struct {
+	ID               string                  `json:"id"`
+	Code             string                  `json:"code,omitempty"`
+	CodePrefix       string                  `json:"code_prefix"`
+	Name             string                  `json:"name"`
+	ClientID         string                  `json:"client_id,omitempty"`
+	Config           models.EnrollmentConfig `json:"config"`
+	Status           string                  `json:"status"`
+	CreatedBy        string                  `json:"created_by"`
+	CreatedAt        time.Time               `json:"created_at"`
+	ExpiresAt        time.Time               `json:"expires_at"`
+	RedeemedAt       *time.Time              `json:"redeemed_at,omitempty"`
+	RedeemedClientID *string                 `json:"redeemed_client_id,omitempty"`
+	RedeemedFrom     *string                 `json:"redeemed_from,omitempty"`
+	RevokedAt        *time.Time              `json:"revoked_at,omitempty"`
+	RevokedBy        *string                 `json:"revoked_by,omitempty"`
+}
+
+// EnrollmentAuditResponse is one entry of the enrollment audit log
+type EnrollmentAuditResponse struct {
+	ID           int64     `json:"id"`
+	EnrollmentID *string   `json:"enrollment_id,omitempty"`
+	ClientID     string    `json:"client_id,omitempty"`
+	Action       string    `json:"action"`
+	Actor        string    `json:"actor,omitempty"`
+	RemoteAddr   string    `json:"remote_addr,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RegisterEnrollmentRoutes registers probe enrollment routes
+func (s *Service) RegisterEnrollmentRoutes(router *mux.Router) {
+	enrollRouter := router.PathPrefix("/api/v1/admin/enrollments").Subrouter()
+	enrollRouter.Use(s.requireAuth)
+	enrollRouter.HandleFunc("", s.listEnrollments).Methods("GET")
+	enrollRouter.HandleFunc("", s.createEnrollment).Methods("POST")
+	enrollRouter.HandleFunc("/audit", s.listEnrollmentAudit).Methods("GET")
+	enrollRouter.HandleFunc("/{id}", s.getEnrollment).Methods("GET")
+	enrollRouter.HandleFunc("/{id}", s.revokeEnrollment).Methods("DELETE")
+
+	// Probes authenticate with the enrollment code itself
+	router.HandleFunc("/api/v1/enroll", s.handleEnroll).Methods("POST")
+}
+
+func (s *Service) enrollmentRepo() *database.EnrollmentRepository {
+	return database.NewEnrollmentRepository(s.repo.Connection())
+}
+
+func (s *Service) createEnrollment(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req CreateEnrollmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateEnrollmentRequest(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ttl := defaultEnrollmentTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	config, err := json.Marshal(req.Config)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid config")
+		return
+	}
+	code, err := generateEnrollmentCode()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate enrollment code")
+		return
+	}
+
+	now := time.Now()
+	record := &database.EnrollmentCode{
+		ID:         uuid.New().String(),
+		CodeHash:   models.HashCredential(code),
+		CodePrefix: code[:4],
+		Name:       req.Name,
+		ClientID:   req.ClientID,
+		Config:     config,
+		CreatedBy:  s.getCurrentUser(r).Username,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := s.enrollmentRepo().CreateEnrollmentCode(r.Context(), record, remoteHost(r)); err != nil {
+		log.Printf("Failed to create enrollment code: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create enrollment code")
+		return
+	}
+
+	// The code itself is only shown once
+	response := toEnrollmentResponse(record, now)
+	response.Code = models.FormatEnrollmentCode(code)
+	respondJSON(w, http.StatusCreated, response)
+}
+
+// validateEnrollmentRequest checks a create request, including that its
+// targets would load on the probe
+func validateEnrollmentRequest(req *CreateEnrollmentRequest) error {
+	if req.TTLSeconds < 0 || time.Duration(req.TTLSeconds)*time.Second > maxEnrollmentTTL {
+		return fmt.Errorf("ttl_seconds must be between 0 and %d", int(maxEnrollmentTTL.Seconds()))
+	}
+	if len(req.ClientID) > 255 {
+		return fmt.Errorf("client_id is too long")
+	}
+	if err := req.Config.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if len(req.Config.Targets) > 0 {
+		var targets []probe.TargetConfig
+		if err := json.Unmarshal(req.Config.Targets, &targets); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		for i := range targets {
+			if err := targets[i].Validate(); err != nil {
+				return fmt.Errorf("invalid config: target %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) listEnrollments(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	codes, err := s.enrollmentRepo().ListEnrollmentCodes(r.Context())
+	if err != nil {
+		log.Printf("Failed to list enrollment codes: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list enrollments")
+		return
+	}
+
+	now := time.Now()
+	enrollments := make([]*EnrollmentResponse, 0, len(codes))
+	for _, code := range codes {
+		enrollments = append(enrollments, toEnrollmentResponse(code, now))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"enrollments": enrollments})
+}
+
+func (s *Service) getEnrollment(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		respondError(w, http.StatusNotFound, "Enrollment not found")
+		return
+	}
+	code, err := s.enrollmentRepo().GetEnrollmentCode(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get enrollment code %s: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get enrollment")
+		return
+	}
+	if code == nil {
+		respondError(w, http.StatusNotFound, "Enrollment not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, toEnrollmentResponse(code, time.Now()))
+}
+
+// revokeEnrollment revokes an enrollment code and the ingest credentials
+// issued for it
+func (s *Service) revokeEnrollment(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		respondError(w, http.StatusNotFound, "Enrollment not found")
+		return
+	}
+	revoked, err := s.enrollmentRepo().RevokeEnrollment(r.Context(), id, s.getCurrentUser(r).Username, remoteHost(r), time.Now())
+	switch {
+	case errors.Is(err, database.ErrEnrollmentNotFound):
+		respondError(w, http.StatusNotFound, "Enrollment not found")
+		return
+	case errors.Is(err, database.ErrEnrollmentRevoked):
+		respondError(w, http.StatusConflict, "Enrollment already revoked")
+		return
+	case err != nil:
+		log.Printf("Failed to revoke enrollment %s: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to revoke enrollment")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":                  id,
+		"revoked_credentials": revoked,
+	})
+}
+
+func (s *Service) listEnrollmentAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	enrollmentID := r.URL.Query().Get("enrollment_id")
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := s.enrollmentRepo().ListEnrollmentAudit(r.Context(), enrollmentID, limit)
+	if err != nil {
+		log.Printf("Failed to list enrollment audit: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list enrollment audit")
+		return
+	}
+
+	audit := make([]*EnrollmentAuditResponse, 0, len(entries))
+	for _, e := range entries {
+		audit = append(audit, &EnrollmentAuditResponse{
+			ID:           e.ID,
+			EnrollmentID: e.EnrollmentID,
+			ClientID:     e.ClientID,
+			Action:       e.Action,
+			Actor:        e.Actor,
+			RemoteAddr:   e.RemoteAddr,
+			Detail:       e.Detail,
+			CreatedAt:    e.CreatedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"audit": audit})
+}
+
+// handleEnroll exchanges an enrollment code for the probe's client ID, an
+// ingest token and its initial configuration. Failed attempts are audited.
+func (s *Service) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	var req models.EnrollRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnrollBody)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.ClientID) > 255 {
+		respondError(w, http.StatusBadRequest, "client_id is too long")
+		return
+	}
+
+	repo := s.enrollmentRepo()
+	remote := remoteHost(r)
+	detail := fmt.Sprintf("hostname=%q version=%q", req.Hostname, req.ProbeVersion)
+	fail := func(enrollmentID *string, reason string) {
+		err := repo.RecordEnrollmentAudit(r.Context(), &database.EnrollmentAuditEntry{
+			EnrollmentID: enrollmentID,
+			ClientID:     req.ClientID,
+			Action:       database.EnrollmentActionEnrollFailed,
+			RemoteAddr:   remote,
+			Detail:       reason + " " + detail,
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			log.Printf("Failed to audit enrollment attempt: %v", err)
+		}
+	}
+
+	code := models.NormalizeEnrollmentCode(req.Code)
+	if code == "" {
+		fail(nil, "malformed code")
+		respondError(w, http.StatusForbidden, "Invalid enrollment code")
+		return
+	}
+
+	token, err := generateProbeToken()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate credentials")
+		return
+	}
+	fallbackClientID, err := generateClientID()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate client ID")
+		return
+	}
+	cred := &database.ProbeCredential{
+		ID:          uuid.New().String(),
+		TokenHash:   models.HashCredential(token),
+		TokenPrefix: token[:12],
+		CreatedAt:   time.Now(),
+	}
+
+	record, err := repo.RedeemEnrollmentCode(r.Context(), models.HashCredential(code), req.ClientID, fallbackClientID, remote, detail, cred)
+	switch {
+	case errors.Is(err, database.ErrEnrollmentNotFound):
+		fail(nil, "unknown code")
+		respondError(w, http.StatusForbidden, "Invalid enrollment code")
+		return
+	case errors.Is(err, database.ErrEnrollmentExpired):
+		fail(&record.ID, "expired code")
+		respondError(w, http.StatusForbidden, "Enrollment code expired")
+		return
+	case errors.Is(err, database.ErrEnrollmentRevoked):
+		fail(&record.ID, "revoked code")
+		respondError(w, http.StatusForbidden, "Enrollment code revoked")
+		return
+	case errors.Is(err, database.ErrEnrollmentUsed):
+		fail(&record.ID, "code already used")
+		respondError(w, http.StatusForbidden, "Enrollment code already used")
+		return
+	case errors.Is(err, database.ErrEnrollmentClientTaken):
+		fail(&record.ID, "client ID has active credentials")
+		respondError(w, http.StatusConflict, "Client ID already has active credentials; revoke them or use a code pinned to it")
+		return
+	case err != nil:
+		log.Printf("Failed to redeem enrollment code: %v", err)
+		respondError(w, http.StatusInternalServerError, "Enrollment failed")
+		return
+	}
+
+	var config models.EnrollmentConfig
+	if err := json.Unmarshal(record.Config, &config); err != nil {
+		log.Printf("Enrollment %s has an unreadable config: %v", record.ID, err)
+	}
+	log.Printf("Probe %s enrolled with enrollment %s from %s", cred.ClientID, record.ID, remote)
+
+	respondJSON(w, http.StatusOK, &models.EnrollResponse{
+		EnrollmentID: record.ID,
+		ClientID:     cred.ClientID,
+		APIToken:     token,
+		Config:       config,
+	})
+}
+
+// toEnrollmentResponse converts a stored enrollment code, deriving its status
+func toEnrollmentResponse(code *database.EnrollmentCode, now time.Time) *EnrollmentResponse {
+	status := EnrollmentStatusPending
+	switch {
+	case code.RevokedAt != nil:
+		status = EnrollmentStatusRevoked
+	case code.RedeemedAt != nil:
+		status = EnrollmentStatusEnrolled
+	case !now.Before(code.ExpiresAt):
+		status = EnrollmentStatusExpired
+	}
+
+	response := &EnrollmentResponse{
+		ID:               code.ID,
+		CodePrefix:       code.CodePrefix + "-****",
+		Name:             code.Name,
+		ClientID:         code.ClientID,
+		Status:           status,
+		CreatedBy:        code.CreatedBy,
+		CreatedAt:        code.CreatedAt,
+		ExpiresAt:        code.ExpiresAt,
+		RedeemedAt:       code.RedeemedAt,
+		RedeemedClientID: code.RedeemedClientID,
+		RedeemedFrom:     code.RedeemedFrom,
+		RevokedAt:        code.RevokedAt,
+		RevokedBy:        code.RevokedBy,
+	}
+	json.Unmarshal(code.Config, &response.Config)
+	return response
+}
+
+// generateEnrollmentCode creates a random, normalized enrollment code
+func generateEnrollmentCode() (string, error) {
+	b := make([]byte, models.EnrollmentCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// The alphabet has 32 symbols, so masking keeps the choice uniform
+	for i := range b {
+		b[i] = models.EnrollmentCodeAlphabet[b[i]&31]
+	}
+	return string(b), nil
+}
+
+// generateProbeToken creates a random ingest token for an enrolled probe
+func generateProbeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return probeTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// generateClientID creates a client ID in the format probes generate
+// themselves
+func generateClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "probe-" + hex.EncodeToString(b), nil
+}
+
+// remoteHost returns the host part of the request's remote address
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
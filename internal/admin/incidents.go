@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+)
+
+// AssignIncidentRequest assigns an incident; an empty assignee unassigns it
+type AssignIncidentRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+// RegisterIncidentRoutes registers the incident routes. Incidents are
+// opened, updated and resolved by the diagnoser; users acknowledge and
+// assign them.
+func (s *Service) RegisterIncidentRoutes(router *mux.Router) {
+	incidentRouter := router.PathPrefix("/api/v1/incidents").Subrouter()
+	incidentRouter.Use(s.requireAuth)
+	incidentRouter.HandleFunc("", s.listIncidents).Methods("GET")
+	incidentRouter.HandleFunc("/{id}", s.getIncident).Methods("GET")
+	incidentRouter.HandleFunc("/{id}/acknowledge", s.acknowledgeIncident).Methods("POST")
+	incidentRouter.HandleFunc("/{id}/assignment", s.assignIncident).Methods("PUT")
+}
+
+func (s *Service) incidentRepo() *database.IncidentRepository {
+	return database.NewIncidentRepository(s.repo.Connection())
+}
+
+// incidentID parses the incident ID of a request, or returns false
+func incidentID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	return id, err == nil && id > 0
+}
+
+func (s *Service) listIncidents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	status := params.Get("status")
+	switch status {
+	case "", database.IncidentOpen, database.IncidentAcknowledged, database.IncidentResolved:
+	default:
+		respondError(w, http.StatusBadRequest, "status must be open, acknowledged or resolved")
+		return
+	}
+	hours := 168
+	if value := params.Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 720 {
+			respondError(w, http.StatusBadRequest, "hours must be between 1 and 720")
+			return
+		}
+		hours = parsed
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	incidents, err := s.incidentRepo().ListIncidents(r.Context(), status, since, limit)
+	if err != nil {
+		log.Printf("Failed to list incidents: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list incidents")
+		return
+	}
+	if incidents == nil {
+		incidents = []database.IncidentRecord{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"incidents": incidents,
+		"total":     len(incidents),
+	})
+}
+
+func (s *Service) getIncident(w http.ResponseWriter, r *http.Request) {
+	id, ok := incidentID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+	incident, err := s.incidentRepo().GetIncident(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get incident %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get incident")
+		return
+	}
+	if incident == nil {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, incident)
+}
+
+func (s *Service) acknowledgeIncident(w http.ResponseWriter, r *http.Request) {
+	id, ok := incidentID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+	incident, err := s.incidentRepo().AcknowledgeIncident(r.Context(), id, s.getCurrentUser(r).Username)
+	if err != nil {
+		log.Printf("Failed to acknowledge incident %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to acknowledge incident")
+		return
+	}
+	if incident == nil {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+
+	s.broadcastIncident("acknowledged", incident)
+	respondJSON(w, http.StatusOK, incident)
+}
+
+func (s *Service) assignIncident(w http.ResponseWriter, r *http.Request) {
+	id, ok := incidentID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+
+	var req AssignIncidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Assignee = strings.TrimSpace(req.Assignee)
+
+	incident, err := s.incidentRepo().AssignIncident(r.Context(), id, req.Assignee)
+	if err != nil {
+		log.Printf("Failed to assign incident %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to assign incident")
+		return
+	}
+	if incident == nil {
+		respondError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+
+	s.broadcastIncident("assigned", incident)
+	respondJSON(w, http.StatusOK, incident)
+}
+
+// broadcastIncident broadcasts an incident event to WebSocket subscribers
+func (s *Service) broadcastIncident(event string, incident *database.IncidentRecord) {
+	s.mu.RLock()
+	broadcaster := s.broadcaster
+	s.mu.RUnlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastIncident(event, incident, incident.Severity, incident.Message)
+	}
+}
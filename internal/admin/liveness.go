@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/metrics"
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// probeLiveness is the last known liveness of a probe
+type probeLiveness struct {
+	status   string
+	lastSeen time.Time
+}
+
+// livenessTransition is a probe going online or offline
+type livenessTransition struct {
+	clientID string
+	status   string
+	lastSeen time.Time
+}
+
+// SetBroadcaster sets where probe online/offline transitions are broadcast
+func (s *Service) SetBroadcaster(broadcaster metrics.Broadcaster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcaster = broadcaster
+}
+
+// StartLivenessMonitor checks probe heartbeats every interval until ctx is
+// done, keeping LastSeen and Status of configured probes current and
+// broadcasting online/offline transitions
+func (s *Service) StartLivenessMonitor(ctx context.Context, interval time.Duration) {
+	heartbeatsRepo := database.NewHeartbeatsRepository(s.repo.Connection())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.checkLiveness(ctx, heartbeatsRepo, time.Now()); err != nil {
+				log.Printf("Probe liveness check failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkLiveness updates probe liveness from the latest heartbeats. The first
+// state seen for a probe is recorded without a broadcast, so a restart of the
+// admin service does not announce every probe again.
+func (s *Service) checkLiveness(ctx context.Context, heartbeatsRepo *database.HeartbeatsRepository, now time.Time) error {
+	heartbeats, err := heartbeatsRepo.ListHeartbeats(ctx)
+	if err != nil {
+		return err
+	}
+
+	var transitions []livenessTransition
+	s.mu.Lock()
+	probesByClient := make(map[string][]*ProbeConfig)
+	for _, probe := range s.probes {
+		probesByClient[probe.ClientID] = append(probesByClient[probe.ClientID], probe)
+	}
+
+	for _, hb := range heartbeats {
+		// A per-probe threshold applies to every probe config of the client;
+		// the strictest one wins
+		var configured time.Duration
+		for _, probe := range probesByClient[hb.ClientID] {
+			threshold := time.Duration(probe.OfflineAfterSeconds) * time.Second
+			if threshold > 0 && (configured == 0 || threshold < configured) {
+				configured = threshold
+			}
+		}
+		offlineAfter := models.ProbeOfflineAfter(configured, time.Duration(hb.IntervalSeconds)*time.Second)
+		status := models.ProbeLiveness(hb.LastSeenAt, now, offlineAfter)
+
+		lastSeen := hb.LastSeenAt
+		for _, probe := range probesByClient[hb.ClientID] {
+			probe.LastSeen = &lastSeen
+			probe.Status = status
+		}
+
+		previous, known := s.liveness[hb.ClientID]
+		s.liveness[hb.ClientID] = probeLiveness{status: status, lastSeen: lastSeen}
+		if known && previous.status != status {
+			transitions = append(transitions, livenessTransition{
+				clientID: hb.ClientID,
+				status:   status,
+				lastSeen: lastSeen,
+			})
+		}
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	for _, t := range transitions {
+		log.Printf("Probe %s is now %s (last seen %s)", t.clientID, t.status, t.lastSeen.Format(time.RFC3339))
+		if broadcaster != nil {
+			broadcaster.BroadcastProbeStatus(t.clientID, t.status, t.lastSeen)
+		}
+	}
+	return nil
+}
+
+// probeLivenessOf returns the last known liveness of a client, if any
+func (s *Service) probeLivenessOf(clientID string) (probeLiveness, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	liveness, ok := s.liveness[clientID]
+	return liveness, ok
+}
@@ -0,0 +1,366 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/notify"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// NotificationChannel is a notification channel as exposed by the API.
+// Secrets in Settings are redacted.
+type NotificationChannel struct {
+	ID            int64           `json:"id"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	Settings      notify.Settings `json:"settings"`
+	TitleTemplate string          `json:"title_template"`
+	BodyTemplate  string          `json:"body_template"`
+	Enabled       bool            `json:"enabled"`
+	CreatedBy     string          `json:"created_by,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// NotificationChannelRequest creates or replaces a notification channel.
+// When replacing one, secrets left redacted keep their stored value.
+type NotificationChannelRequest struct {
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	Settings      notify.Settings `json:"settings"`
+	TitleTemplate string          `json:"title_template"`
+	BodyTemplate  string          `json:"body_template"`
+	Enabled       *bool           `json:"enabled,omitempty"`
+}
+
+// RegisterNotificationRoutes registers the notification channel routes.
+// Channels are referred to by name from alert rules and the diagnoser's
+// -incident-channels flag, which picks up changes within a minute.
+func (s *Service) RegisterNotificationRoutes(router *mux.Router) {
+	channelRouter := router.PathPrefix("/api/v1/admin/notification-channels").Subrouter()
+	channelRouter.Use(s.requireAuth)
+	channelRouter.HandleFunc("", s.listNotificationChannels).Methods("GET")
+	channelRouter.HandleFunc("", s.createNotificationChannel).Methods("POST")
+	channelRouter.HandleFunc("/{name}", s.getNotificationChannel).Methods("GET")
+	channelRouter.HandleFunc("/{name}", s.updateNotificationChannel).Methods("PUT")
+	channelRouter.HandleFunc("/{name}", s.deleteNotificationChannel).Methods("DELETE")
+	channelRouter.HandleFunc("/{name}/test", s.testNotificationChannel).Methods("POST")
+}
+
+func (s *Service) notificationRepo() *database.NotificationRepository {
+	return database.NewNotificationRepository(s.repo.Connection())
+}
+
+// toNotificationChannel converts a stored channel for the API
+func toNotificationChannel(rec *database.NotificationChannelRecord) (*NotificationChannel, error) {
+	cfg, err := notify.ConfigFromRecord(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert notification channel %s: %w", rec.Name, err)
+	}
+	return &NotificationChannel{
+		ID:            rec.ID,
+		Name:          rec.Name,
+		Type:          rec.Type,
+		Settings:      cfg.Settings.Redacted(),
+		TitleTemplate: rec.TitleTemplate,
+		BodyTemplate:  rec.BodyTemplate,
+		Enabled:       rec.Enabled,
+		CreatedBy:     rec.CreatedBy,
+		CreatedAt:     rec.CreatedAt,
+		UpdatedAt:     rec.UpdatedAt,
+	}, nil
+}
+
+// notificationChannelRecord validates a request and converts it for
+// storing. previous is the stored channel being replaced, if any.
+func notificationChannelRecord(req *NotificationChannelRequest, previous *database.NotificationChannelRecord) (*database.NotificationChannelRecord, error) {
+	if previous != nil {
+		stored, err := notify.ConfigFromRecord(previous)
+		if err != nil {
+			return nil, err
+		}
+		req.Settings.KeepSecrets(stored.Settings)
+	}
+
+	cfg := notify.ChannelConfig{
+		Name:          strings.TrimSpace(req.Name),
+		Type:          req.Type,
+		Settings:      req.Settings,
+		TitleTemplate: req.TitleTemplate,
+		BodyTemplate:  req.BodyTemplate,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := json.Marshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	rec := &database.NotificationChannelRecord{
+		Name:          cfg.Name,
+		Type:          cfg.Type,
+		Config:        settings,
+		TitleTemplate: cfg.TitleTemplate,
+		BodyTemplate:  cfg.BodyTemplate,
+		Enabled:       true,
+	}
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+	return rec, nil
+}
+
+// getStoredChannel fetches the channel named in the request, responding with
+// an error and returning nil if it cannot
+func (s *Service) getStoredChannel(w http.ResponseWriter, r *http.Request) *database.NotificationChannelRecord {
+	name := mux.Vars(r)["name"]
+	rec, err := s.notificationRepo().GetNotificationChannel(r.Context(), name)
+	if err != nil {
+		log.Printf("Failed to get notification channel %s: %v", name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get notification channel")
+		return nil
+	}
+	if rec == nil {
+		respondError(w, http.StatusNotFound, "Notification channel not found")
+		return nil
+	}
+	return rec
+}
+
+func (s *Service) listNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	records, err := s.notificationRepo().ListNotificationChannels(r.Context(), false)
+	if err != nil {
+		log.Printf("Failed to list notification channels: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list notification channels")
+		return
+	}
+
+	channels := []*NotificationChannel{}
+	for i := range records {
+		channel, err := toNotificationChannel(&records[i])
+		if err != nil {
+			log.Printf("Failed to list notification channels: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to list notification channels")
+			return
+		}
+		channels = append(channels, channel)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"channels": channels,
+		"templates": map[string]string{
+			"title": notify.DefaultTitleTemplate,
+			"body":  notify.DefaultBodyTemplate,
+		},
+	})
+}
+
+func (s *Service) getNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	rec := s.getStoredChannel(w, r)
+	if rec == nil {
+		return
+	}
+	channel, err := toNotificationChannel(rec)
+	if err != nil {
+		log.Printf("Failed to get notification channel: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get notification channel")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, channel)
+}
+
+func (s *Service) createNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rec, err := notificationChannelRecord(&req, nil)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec.CreatedBy = s.getCurrentUser(r).Username
+
+	if err := s.notificationRepo().CreateNotificationChannel(r.Context(), rec); err != nil {
+		if errors.Is(err, database.ErrNotificationChannelExists) {
+			respondError(w, http.StatusConflict, "Notification channel already exists")
+			return
+		}
+		log.Printf("Failed to create notification channel %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to create notification channel")
+		return
+	}
+	channel, err := toNotificationChannel(rec)
+	if err != nil {
+		log.Printf("Failed to create notification channel: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create notification channel")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, channel)
+}
+
+func (s *Service) updateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if req.Name != "" && req.Name != name {
+		// Alert rules refer to channels by name
+		respondError(w, http.StatusBadRequest, "Notification channels cannot be renamed")
+		return
+	}
+	req.Name = name
+
+	previous := s.getStoredChannel(w, r)
+	if previous == nil {
+		return
+	}
+	rec, err := notificationChannelRecord(&req, previous)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := s.notificationRepo().UpdateNotificationChannel(r.Context(), rec)
+	if err != nil {
+		log.Printf("Failed to update notification channel %s: %v", name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to update notification channel")
+		return
+	}
+	if !updated {
+		respondError(w, http.StatusNotFound, "Notification channel not found")
+		return
+	}
+	channel, err := toNotificationChannel(rec)
+	if err != nil {
+		log.Printf("Failed to update notification channel: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to update notification channel")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, channel)
+}
+
+func (s *Service) deleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	deleted, err := s.notificationRepo().DeleteNotificationChannel(r.Context(), name)
+	if err != nil {
+		log.Printf("Failed to delete notification channel %s: %v", name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to delete notification channel")
+		return
+	}
+	if !deleted {
+		respondError(w, http.StatusNotFound, "Notification channel not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testNotificationChannel sends a test notification through a stored
+// channel, once and without retries, and reports the result
+func (s *Service) testNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	rec := s.getStoredChannel(w, r)
+	if rec == nil {
+		return
+	}
+	cfg, err := notify.ConfigFromRecord(rec)
+	if err != nil {
+		log.Printf("Failed to test notification channel %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to test notification channel")
+		return
+	}
+
+	now := time.Now()
+	n := &plugin.Notification{
+		AlertType: "test",
+		Event:     "test",
+		Severity:  "info",
+		Summary:   fmt.Sprintf("Test notification for channel %s", rec.Name),
+		Labels: map[string]string{
+			"channel":      rec.Name,
+			"requested_by": s.getCurrentUser(r).Username,
+		},
+		StartedAt: now,
+		Timestamp: now,
+	}
+	if err := notify.SendOnce(r.Context(), cfg, n); err != nil {
+		log.Printf("Test notification to %s failed: %v", rec.Name, err)
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("Test notification failed: %v", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "sent",
+		"channel": rec.Name,
+		"title":   n.Title,
+		"text":    n.Text,
+	})
+}
+
+func (s *Service) listAlertDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusNotFound, "Alert not found")
+		return
+	}
+
+	deliveries, err := s.notificationRepo().ListDeliveries(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to list deliveries of alert %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to list deliveries")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []database.DeliveryRecord{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"alert_id":   id,
+		"deliveries": deliveries,
+	})
+}
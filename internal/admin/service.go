@@ -2,25 +2,33 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/rahulgh33/wirescope/internal/auth"
 	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/metrics"
 )
 
 // Service provides admin operations
 type Service struct {
 	repo      *database.Repository
+	mu        sync.RWMutex // guards probes, liveness and broadcaster
 	probes    map[string]*ProbeConfig
 	tokens    map[string]*APIToken
 	users     map[string]*User
 	settings  *SystemSettings
 	userStore auth.UserStore
 	config    *Config
+
+	liveness    map[string]probeLiveness // by client ID
+	broadcaster metrics.Broadcaster
 }
 
 // NewService creates a new admin service
@@ -35,6 +43,7 @@ func NewService(config *Config, repo *database.Repository) *Service {
 	return &Service{
 		repo:      repo,
 		probes:    make(map[string]*ProbeConfig),
+		liveness:  make(map[string]probeLiveness),
 		tokens:    make(map[string]*APIToken),
 		users:     make(map[string]*User),
 		userStore: userStore,
@@ -70,6 +79,24 @@ func (s *Service) RegisterRoutes(router *mux.Router) {
 	// Register user management routes
 	s.RegisterUserManagementRoutes(router)
 
+	// Register probe enrollment routes
+	s.RegisterEnrollmentRoutes(router)
+
+	// Register baseline strategy routes
+	s.RegisterBaselineRoutes(router)
+
+	// Register incident routes
+	s.RegisterIncidentRoutes(router)
+
+	// Register alert rule routes
+	s.RegisterAlertRuleRoutes(router)
+
+	// Register notification channel routes
+	s.RegisterNotificationRoutes(router)
+
+	// Register silence and maintenance window routes
+	s.RegisterSilenceRoutes(router)
+
 	adminRouter := router.PathPrefix("/api/v1/admin").Subrouter()
 
 	// Probe Management
@@ -107,6 +134,8 @@ func (s *Service) RegisterRoutes(router *mux.Router) {
 
 // Probe handlers
 func (s *Service) listProbes(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	probes := make([]*ProbeConfig, 0, len(s.probes))
 	for _, probe := range s.probes {
 		// Mask API token
@@ -125,6 +154,10 @@ func (s *Service) createProbe(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.OfflineAfterSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "offline_after_seconds must be non-negative")
+		return
+	}
 
 	// Generate API token for probe
 	token := "tok_" + uuid.New().String()
@@ -141,9 +174,18 @@ func (s *Service) createProbe(w http.ResponseWriter, r *http.Request) {
 		APIToken:    token,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+
+		OfflineAfterSeconds: req.OfflineAfterSeconds,
 	}
 
+	s.mu.Lock()
+	if liveness, ok := s.liveness[probe.ClientID]; ok {
+		lastSeen := liveness.lastSeen
+		probe.LastSeen = &lastSeen
+		probe.Status = liveness.status
+	}
 	s.probes[probe.ID] = probe
+	s.mu.Unlock()
 	respondJSON(w, http.StatusCreated, probe)
 }
 
@@ -151,6 +193,8 @@ func (s *Service) getProbe(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	probe, ok := s.probes[id]
 	if !ok {
 		respondError(w, http.StatusNotFound, "Probe not found")
@@ -164,17 +208,23 @@ func (s *Service) updateProbe(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	probe, ok := s.probes[id]
-	if !ok {
-		respondError(w, http.StatusNotFound, "Probe not found")
-		return
-	}
-
 	var req UpdateProbeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.OfflineAfterSeconds != nil && *req.OfflineAfterSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "offline_after_seconds must be non-negative")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	probe, ok := s.probes[id]
+	if !ok {
+		respondError(w, http.StatusNotFound, "Probe not found")
+		return
+	}
 
 	if req.Name != nil {
 		probe.Name = *req.Name
@@ -191,6 +241,9 @@ func (s *Service) updateProbe(w http.ResponseWriter, r *http.Request) {
 	if req.Enabled != nil {
 		probe.Enabled = *req.Enabled
 	}
+	if req.OfflineAfterSeconds != nil {
+		probe.OfflineAfterSeconds = *req.OfflineAfterSeconds
+	}
 	probe.UpdatedAt = time.Now()
 
 	respondJSON(w, http.StatusOK, probe)
@@ -200,6 +253,8 @@ func (s *Service) deleteProbe(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, ok := s.probes[id]; !ok {
 		respondError(w, http.StatusNotFound, "Probe not found")
 		return
@@ -367,6 +422,13 @@ func (s *Service) deleteUser(w http.ResponseWriter, r *http.Request) {
 
 // Settings handlers
 func (s *Service) getSettings(w http.ResponseWriter, r *http.Request) {
+	// The thresholds are those of the built-in alert rules
+	if err := s.loadThresholds(r.Context(), s.settings); err != nil {
+		log.Printf("Failed to load alert rule thresholds: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to get settings")
+		return
+	}
+
 	respondJSON(w, http.StatusOK, s.settings)
 }
 
@@ -377,6 +439,18 @@ func (s *Service) updateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The thresholds are evaluated by the built-in alert rules, so they are
+	// only applied once the rules are updated
+	if err := s.syncThresholdRules(r.Context(), &req); err != nil {
+		log.Printf("Failed to update settings: %v", err)
+		if errors.Is(err, errThresholdRuleMissing) {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update settings")
+		return
+	}
+
 	if req.EventsRetentionDays != nil {
 		s.settings.EventsRetentionDays = *req.EventsRetentionDays
 	}
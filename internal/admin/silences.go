@@ -0,0 +1,303 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahulgh33/wirescope/internal/alerting"
+	"github.com/rahulgh33/wirescope/internal/database"
+)
+
+// Silence is a silence or maintenance window as exposed by the API. Active
+// reports whether it is active now.
+type Silence struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Comment   string             `json:"comment"`
+	Kind      string             `json:"kind"`
+	Matchers  alerting.Matchers  `json:"matchers"`
+	StartsAt  time.Time          `json:"starts_at"`
+	EndsAt    *time.Time         `json:"ends_at,omitempty"`
+	Schedule  *alerting.Schedule `json:"schedule,omitempty"`
+	Active    bool               `json:"active"`
+	CreatedBy string             `json:"created_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// SilenceRequest creates or replaces a silence. Kind defaults to
+// maintenance and StartsAt to now.
+type SilenceRequest struct {
+	Name     string             `json:"name"`
+	Comment  string             `json:"comment"`
+	Kind     string             `json:"kind"`
+	Matchers alerting.Matchers  `json:"matchers"`
+	StartsAt *time.Time         `json:"starts_at,omitempty"`
+	EndsAt   *time.Time         `json:"ends_at,omitempty"`
+	Schedule *alerting.Schedule `json:"schedule,omitempty"`
+}
+
+// RegisterSilenceRoutes registers the silence and maintenance window routes.
+// The diagnoser picks up changes within a minute.
+func (s *Service) RegisterSilenceRoutes(router *mux.Router) {
+	silenceRouter := router.PathPrefix("/api/v1/admin/silences").Subrouter()
+	silenceRouter.Use(s.requireAuth)
+	silenceRouter.HandleFunc("", s.listSilences).Methods("GET")
+	silenceRouter.HandleFunc("", s.createSilence).Methods("POST")
+	silenceRouter.HandleFunc("/{id}", s.getSilence).Methods("GET")
+	silenceRouter.HandleFunc("/{id}", s.updateSilence).Methods("PUT")
+	silenceRouter.HandleFunc("/{id}", s.deleteSilence).Methods("DELETE")
+}
+
+func (s *Service) silenceRepo() *database.SilenceRepository {
+	return database.NewSilenceRepository(s.repo.Connection())
+}
+
+// silenceID parses the silence ID of a request, or returns false
+func silenceID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	return id, err == nil && id > 0
+}
+
+// toSilence converts a stored silence for the API
+func toSilence(rec *database.SilenceRecord, now time.Time) (*Silence, error) {
+	silence := &Silence{
+		ID:        rec.ID,
+		Name:      rec.Name,
+		Comment:   rec.Comment,
+		Kind:      rec.Kind,
+		StartsAt:  rec.StartsAt,
+		EndsAt:    rec.EndsAt,
+		CreatedBy: rec.CreatedBy,
+		CreatedAt: rec.CreatedAt,
+		UpdatedAt: rec.UpdatedAt,
+	}
+	if err := json.Unmarshal(rec.Matchers, &silence.Matchers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal matchers of silence %d: %w", rec.ID, err)
+	}
+	if len(rec.Schedule) > 0 {
+		if err := json.Unmarshal(rec.Schedule, &silence.Schedule); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schedule of silence %d: %w", rec.ID, err)
+		}
+	}
+
+	var endsAt time.Time
+	if rec.EndsAt != nil {
+		endsAt = *rec.EndsAt
+	}
+	compiled, err := alerting.NewSilence(rec.ID, rec.Name, rec.Kind, silence.Matchers, rec.StartsAt, endsAt, silence.Schedule)
+	if err == nil {
+		silence.Active = compiled.ActiveAt(now)
+	}
+	return silence, nil
+}
+
+// silenceRecord validates a request and converts it for storing. Times are
+// stored in UTC.
+func silenceRecord(req *SilenceRequest) (*database.SilenceRecord, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Kind == "" {
+		req.Kind = alerting.KindMaintenance
+	}
+	startsAt := time.Now().UTC().Truncate(time.Second)
+	if req.StartsAt != nil {
+		startsAt = req.StartsAt.UTC()
+	}
+	var endsAt time.Time
+	if req.EndsAt != nil {
+		endsAt = req.EndsAt.UTC()
+	}
+	if _, err := alerting.NewSilence(0, req.Name, req.Kind, req.Matchers, startsAt, endsAt, req.Schedule); err != nil {
+		return nil, err
+	}
+
+	matchers, err := json.Marshal(req.Matchers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal matchers: %w", err)
+	}
+	rec := &database.SilenceRecord{
+		Name:     req.Name,
+		Comment:  req.Comment,
+		Kind:     req.Kind,
+		Matchers: matchers,
+		StartsAt: startsAt,
+	}
+	if req.EndsAt != nil {
+		rec.EndsAt = &endsAt
+	}
+	if req.Schedule != nil {
+		if rec.Schedule, err = json.Marshal(req.Schedule); err != nil {
+			return nil, fmt.Errorf("failed to marshal schedule: %w", err)
+		}
+	}
+	return rec, nil
+}
+
+// listSilences lists the silences, without those that ended unless
+// expired=true, or only those active now with active=true
+func (s *Service) listSilences(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	activeOnly := params.Get("active") == "true"
+	includeExpired := params.Get("expired") == "true"
+
+	records, err := s.silenceRepo().ListSilences(r.Context(), !includeExpired)
+	if err != nil {
+		log.Printf("Failed to list silences: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list silences")
+		return
+	}
+
+	now := time.Now().UTC()
+	silences := []*Silence{}
+	for i := range records {
+		silence, err := toSilence(&records[i], now)
+		if err != nil {
+			log.Printf("Failed to list silences: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to list silences")
+			return
+		}
+		if activeOnly && !silence.Active {
+			continue
+		}
+		silences = append(silences, silence)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"silences": silences,
+		"total":    len(silences),
+	})
+}
+
+func (s *Service) getSilence(w http.ResponseWriter, r *http.Request) {
+	id, ok := silenceID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+	rec, err := s.silenceRepo().GetSilence(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get silence %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get silence")
+		return
+	}
+	if rec == nil {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+	silence, err := toSilence(rec, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to get silence %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to get silence")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, silence)
+}
+
+func (s *Service) createSilence(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req SilenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rec, err := silenceRecord(&req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec.CreatedBy = s.getCurrentUser(r).Username
+
+	if err := s.silenceRepo().CreateSilence(r.Context(), rec); err != nil {
+		log.Printf("Failed to create silence %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to create silence")
+		return
+	}
+	silence, err := toSilence(rec, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to create silence %s: %v", rec.Name, err)
+		respondError(w, http.StatusInternalServerError, "Failed to create silence")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, silence)
+}
+
+func (s *Service) updateSilence(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	id, ok := silenceID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+
+	var req SilenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rec, err := silenceRecord(&req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec.ID = id
+
+	updated, err := s.silenceRepo().UpdateSilence(r.Context(), rec)
+	if err != nil {
+		log.Printf("Failed to update silence %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to update silence")
+		return
+	}
+	if !updated {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+	silence, err := toSilence(rec, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to update silence %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to update silence")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, silence)
+}
+
+func (s *Service) deleteSilence(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+	id, ok := silenceID(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+
+	deleted, err := s.silenceRepo().DeleteSilence(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to delete silence %d: %v", id, err)
+		respondError(w, http.StatusInternalServerError, "Failed to delete silence")
+		return
+	}
+	if !deleted {
+		respondError(w, http.StatusNotFound, "Silence not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -16,6 +16,11 @@ type ProbeConfig struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	Status      string     `json:"status,omitempty"` // online, offline; empty until a heartbeat is seen
+
+	// OfflineAfterSeconds overrides how long the probe may go without a
+	// heartbeat before it is offline (default: three heartbeat intervals)
+	OfflineAfterSeconds int `json:"offline_after_seconds,omitempty"`
 }
 
 // APIToken represents an ingest API token
@@ -130,6 +135,8 @@ type CreateProbeRequest struct {
 	Targets     []string `json:"targets"`
 	Interval    int      `json:"interval"`
 	Enabled     bool     `json:"enabled"`
+
+	OfflineAfterSeconds int `json:"offline_after_seconds,omitempty"`
 }
 
 type UpdateProbeRequest struct {
@@ -138,6 +145,8 @@ type UpdateProbeRequest struct {
 	Targets     *[]string `json:"targets,omitempty"`
 	Interval    *int      `json:"interval,omitempty"`
 	Enabled     *bool     `json:"enabled,omitempty"`
+
+	OfflineAfterSeconds *int `json:"offline_after_seconds,omitempty"`
 }
 
 type CreateAPITokenRequest struct {
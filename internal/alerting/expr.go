@@ -0,0 +1,503 @@
+package alerting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled rule expression, a boolean condition over the fields
+// of an aggregate window, e.g. `ttfb_p95 > 800 and count_success >= 5`.
+//
+// Expressions combine comparisons (<, <=, >, >=, ==, !=) with and, or and
+// not (also &&, || and !) and parentheses. Numeric fields and literals
+// support +, -, * and /; string fields such as diagnosis are compared with
+// == and != against double-quoted literals.
+//
+// A comparison involving a field without a value in the window, such as
+// ttfb_p95 of a window without successful requests, is false, as is one
+// dividing by zero.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression and checks its fields and types
+func Compile(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("expression must be a condition, not a %s", root.typ())
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String returns the expression's source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression over a window's fields
+func (e *Expr) Eval(fields Fields) bool {
+	return e.root.eval(fields).b
+}
+
+// valueType is the static type of an expression node
+type valueType int
+
+const (
+	typeNumber valueType = iota
+	typeString
+	typeBool
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	default:
+		return "condition"
+	}
+}
+
+// value is the result of evaluating a node. missing is set for numbers
+// without a value.
+type value struct {
+	num     float64
+	str     string
+	b       bool
+	missing bool
+}
+
+type node interface {
+	typ() valueType
+	eval(fields Fields) value
+}
+
+type numberLit float64
+
+func (n numberLit) typ() valueType    { return typeNumber }
+func (n numberLit) eval(Fields) value { return value{num: float64(n)} }
+
+type stringLit string
+
+func (s stringLit) typ() valueType    { return typeString }
+func (s stringLit) eval(Fields) value { return value{str: string(s)} }
+
+type boolLit bool
+
+func (b boolLit) typ() valueType    { return typeBool }
+func (b boolLit) eval(Fields) value { return value{b: bool(b)} }
+
+type numberField string
+
+func (f numberField) typ() valueType { return typeNumber }
+func (f numberField) eval(fields Fields) value {
+	v, ok := fields.Numbers[string(f)]
+	return value{num: v, missing: !ok}
+}
+
+type stringField string
+
+func (f stringField) typ() valueType { return typeString }
+func (f stringField) eval(fields Fields) value {
+	return value{str: fields.Strings[string(f)]}
+}
+
+type negate struct{ operand node }
+
+func (n negate) typ() valueType { return typeNumber }
+func (n negate) eval(fields Fields) value {
+	v := n.operand.eval(fields)
+	v.num = -v.num
+	return v
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+}
+
+func (a arithmetic) typ() valueType { return typeNumber }
+func (a arithmetic) eval(fields Fields) value {
+	l, r := a.left.eval(fields), a.right.eval(fields)
+	if l.missing || r.missing {
+		return value{missing: true}
+	}
+	switch a.op {
+	case "+":
+		return value{num: l.num + r.num}
+	case "-":
+		return value{num: l.num - r.num}
+	case "*":
+		return value{num: l.num * r.num}
+	default:
+		if r.num == 0 {
+			return value{missing: true}
+		}
+		return value{num: l.num / r.num}
+	}
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (c comparison) typ() valueType { return typeBool }
+func (c comparison) eval(fields Fields) value {
+	l, r := c.left.eval(fields), c.right.eval(fields)
+	if c.left.typ() == typeString {
+		if c.op == "==" {
+			return value{b: l.str == r.str}
+		}
+		return value{b: l.str != r.str}
+	}
+	if c.left.typ() == typeBool {
+		if c.op == "==" {
+			return value{b: l.b == r.b}
+		}
+		return value{b: l.b != r.b}
+	}
+
+	if l.missing || r.missing {
+		return value{b: false}
+	}
+	switch c.op {
+	case "<":
+		return value{b: l.num < r.num}
+	case "<=":
+		return value{b: l.num <= r.num}
+	case ">":
+		return value{b: l.num > r.num}
+	case ">=":
+		return value{b: l.num >= r.num}
+	case "==":
+		return value{b: l.num == r.num}
+	default:
+		return value{b: l.num != r.num}
+	}
+}
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (l logical) typ() valueType { return typeBool }
+func (l logical) eval(fields Fields) value {
+	left := l.left.eval(fields).b
+	if l.and {
+		return value{b: left && l.right.eval(fields).b}
+	}
+	return value{b: left || l.right.eval(fields).b}
+}
+
+type not struct{ operand node }
+
+func (n not) typ() valueType           { return typeBool }
+func (n not) eval(fields Fields) value { return value{b: !n.operand.eval(fields).b} }
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{tokenString, source[i+1 : i+1+end], i})
+			i += end + 2
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, source[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, source[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range []string{"<=", ">=", "==", "!=", "&&", "||", "<", ">", "!", "+", "-", "*", "/"} {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(source)}), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOp && tok.kind != tokenIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.next()
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if _, ok := p.accept("or", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeBool || right.typ() != typeBool {
+			return nil, fmt.Errorf("%s at position %d needs conditions on both sides", tok, tok.pos)
+		}
+		left = logical{and: false, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if _, ok := p.accept("and", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeBool || right.typ() != typeBool {
+			return nil, fmt.Errorf("%s at position %d needs conditions on both sides", tok, tok.pos)
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	tok := p.peek()
+	if _, ok := p.accept("not", "!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if operand.typ() != typeBool {
+			return nil, fmt.Errorf("%s at position %d needs a condition", tok, tok.pos)
+		}
+		return not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	op, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if left.typ() != right.typ() {
+		return nil, fmt.Errorf("%s at position %d compares a %s with a %s", tok, tok.pos, left.typ(), right.typ())
+	}
+	if left.typ() != typeNumber && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("%s at position %d needs numbers; use == or != for a %s", tok, tok.pos, left.typ())
+	}
+	return comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeNumber || right.typ() != typeNumber {
+			return nil, fmt.Errorf("%s at position %d needs numbers on both sides", tok, tok.pos)
+		}
+		left = arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != typeNumber || right.typ() != typeNumber {
+			return nil, fmt.Errorf("%s at position %d needs numbers on both sides", tok, tok.pos)
+		}
+		left = arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if operand.typ() != typeNumber {
+			return nil, fmt.Errorf("%s at position %d needs a number", tok, tok.pos)
+		}
+		return negate{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return numberLit(v), nil
+	case tokenString:
+		return stringLit(tok.text), nil
+	case tokenIdent:
+		switch {
+		case tok.text == "true" || tok.text == "false":
+			return boolLit(tok.text == "true"), nil
+		case NumberFields[tok.text]:
+			return numberField(tok.text), nil
+		case StringFields[tok.text]:
+			return stringField(tok.text), nil
+		default:
+			return nil, fmt.Errorf("unknown field %q at position %d", tok.text, tok.pos)
+		}
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected \")\" at position %d, found %s", closing.pos, closing)
+		}
+		return inner, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+}
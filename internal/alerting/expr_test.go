@@ -0,0 +1,88 @@
+package alerting
+
+import "testing"
+
+func TestExprEval(t *testing.T) {
+	fields := Fields{
+		Numbers: map[string]float64{
+			"ttfb_p95":      950,
+			"count_success": 8,
+			"count_total":   10,
+			"count_error":   2,
+			"error_rate":    0.2,
+
+			"latency_p95_shift": 0.3,
+		},
+		Strings: map[string]string{
+			"diagnosis": "server_bound",
+			"target":    "https://example.com",
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`ttfb_p95 > 800 and count_success >= 5`, true},
+		{`ttfb_p95 > 800 and count_success >= 10`, false},
+		{`ttfb_p95 > 1000 or error_rate >= 0.2`, true},
+		{`ttfb_p95 > 1000 || error_rate > 0.5`, false},
+		{`not (ttfb_p95 > 800)`, false},
+		{`!(ttfb_p95 > 1000) && count_total == 10`, true},
+		{`count_error / count_total > 0.1`, true},
+		{`count_total - count_success * 2 < -5`, true},
+		{`diagnosis == "server_bound"`, true},
+		{`diagnosis != "server_bound"`, false},
+		{`target == "https://example.com" and ttfb_p95 > 900`, true},
+		{`(ttfb_p95 > 800) == true`, true},
+		{`latency_p95_shift > 0.25`, true},
+		// Missing fields and division by zero make comparisons false
+		{`dns_p95 > 0`, false},
+		{`dns_p95 <= 0`, false},
+		{`not (dns_p95 > 100)`, true},
+		{`count_success / (count_total - 10) > 0`, false},
+		{`dns_p95 + ttfb_p95 > 0`, false},
+		{`ttfb_p95_shift < 0 or ttfb_p95_shift > 0`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if got := expr.Eval(fields); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`ttfb_p95`,
+		`ttfb_p95 > `,
+		`ttfb_p95 > 800 and`,
+		`latency > 800`,
+		`ttfb_p95 > "800"`,
+		`diagnosis > "dns_bound"`,
+		`diagnosis == "dns_bound`,
+		`(ttfb_p95 > 800`,
+		`ttfb_p95 > 800)`,
+		`ttfb_p95 + 1`,
+		`ttfb_p95 and count_success > 0`,
+		`not ttfb_p95`,
+		`-diagnosis == "x"`,
+		`ttfb_p95 > 1.2.3`,
+		`ttfb_p95 > 800 # comment`,
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Compile(expr); err == nil {
+				t.Errorf("Compile(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Package alerting evaluates user-defined alert rules over aggregate windows
+// and the silences and maintenance windows that suppress their alerts
+package alerting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NumberFields are the numeric fields rule expressions can use. Latencies
+// are in milliseconds, throughput in kbps and error_rate and loss_rate are
+// fractions. Percentiles and rates are missing from windows without the
+// samples to compute them. The _shift fields are the relative change of the
+// series' latest level shift of a metric, e.g. 0.3 for 30% higher, and are
+// missing unless one was detected in the last day. The _timeout_count fields
+// count the errors of a stage that timed out; they are part of both the
+// stage's error count and timeout_error_count.
+var NumberFields = map[string]bool{
+	"count_total":         true,
+	"count_success":       true,
+	"count_error":         true,
+	"error_rate":          true,
+	"dns_error_count":     true,
+	"tcp_error_count":     true,
+	"tls_error_count":     true,
+	"http_error_count":    true,
+	"timeout_error_count": true,
+	"dns_p50":             true,
+	"dns_p95":             true,
+	"tcp_p50":             true,
+	"tcp_p95":             true,
+	"tls_p50":             true,
+	"tls_p95":             true,
+	"ttfb_p50":            true,
+	"ttfb_p95":            true,
+	"latency_p95":         true,
+	"throughput_p50":      true,
+	"throughput_p95":      true,
+	"upload_p50":          true,
+	"upload_p95":          true,
+	"loss_rate":           true,
+	"rtt_p50":             true,
+	"rtt_p95":             true,
+	"jitter_p50":          true,
+	"jitter_p95":          true,
+	"asn":                 true,
+
+	"dns_timeout_count":  true,
+	"tcp_timeout_count":  true,
+	"tls_timeout_count":  true,
+	"http_timeout_count": true,
+
+	"dns_p95_shift":        true,
+	"tcp_p95_shift":        true,
+	"tls_p95_shift":        true,
+	"ttfb_p95_shift":       true,
+	"latency_p95_shift":    true,
+	"throughput_p50_shift": true,
+}
+
+// StringFields are the string fields rule expressions can use. diagnosis is
+// the window's diagnosis label, empty for a healthy window.
+var StringFields = map[string]bool{
+	"client_id":      true,
+	"target":         true,
+	"address_family": true,
+	"check_type":     true,
+	"user_label":     true,
+	"as_org":         true,
+	"diagnosis":      true,
+}
+
+// Fields holds the field values of a window. A numeric field absent from
+// Numbers has no value in the window.
+type Fields struct {
+	Numbers map[string]float64
+	Strings map[string]string
+}
+
+// Severities are the severities a rule can have
+var Severities = []string{"info", "warning", "error", "critical"}
+
+// Selector selects the series a rule applies to. Each list holds patterns
+// in which * matches any sequence of characters, including /, and ? any
+// single character; an empty list matches everything.
+type Selector struct {
+	Clients []string `json:"clients,omitempty"`
+	Targets []string `json:"targets,omitempty"`
+
+	// Labels match the probe's user label
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Validate checks the selector's patterns
+func (s Selector) Validate() error {
+	for _, patterns := range [][]string{s.Clients, s.Targets, s.Labels} {
+		for _, pattern := range patterns {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("patterns must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the selector selects a series
+func (s Selector) Matches(clientID, target, userLabel string) bool {
+	return matchAny(s.Clients, clientID) && matchAny(s.Targets, target) && matchAny(s.Labels, userLabel)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches value against a pattern with * and ? wildcards
+func wildcardMatch(pattern, value string) bool {
+	p, v := 0, 0
+	// star and match record the last * seen and the value position it
+	// was tried at, to backtrack to
+	star, match := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			match++
+			v = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Rule is a compiled alert rule. It fires for a series once its condition
+// has held for For, and resolves when the condition no longer holds.
+type Rule struct {
+	Name      string
+	Condition *Expr
+	Selector  Selector
+	For       time.Duration
+	Severity  string
+	Channels  []string
+}
+
+// NewRule compiles and validates a rule
+func NewRule(name, expression string, selector Selector, forDuration time.Duration, severity string, channels []string) (*Rule, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	condition, err := Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	if err := selector.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	if forDuration < 0 || forDuration%time.Minute != 0 {
+		return nil, fmt.Errorf("for must be a non-negative number of minutes")
+	}
+	if !ValidSeverity(severity) {
+		return nil, fmt.Errorf("severity must be one of %s", strings.Join(Severities, ", "))
+	}
+	return &Rule{
+		Name:      name,
+		Condition: condition,
+		Selector:  selector,
+		For:       forDuration,
+		Severity:  severity,
+		Channels:  channels,
+	}, nil
+}
+
+// ValidSeverity reports whether s is a known severity
+func ValidSeverity(s string) bool {
+	for _, severity := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition is the effect of a window on a rule's state for a series
+type Transition string
+
+const (
+	// TransitionNone leaves the rule firing or not firing
+	TransitionNone Transition = ""
+
+	// TransitionFiring started firing the rule
+	TransitionFiring Transition = "firing"
+
+	// TransitionResolved stopped firing the rule
+	TransitionResolved Transition = "resolved"
+)
+
+// State is a rule's state for one series
+type State struct {
+	// ActiveSince is the first window of the current run of consecutive
+	// windows in which the condition held; zero if it does not hold
+	ActiveSince time.Time
+
+	// LastWindowTs is the last window applied
+	LastWindowTs time.Time
+
+	Firing bool
+}
+
+// Active reports whether the state differs from that of a series the rule
+// never held for
+func (s *State) Active() bool {
+	return !s.ActiveSince.IsZero() || s.Firing
+}
+
+// Advance applies a window in which the rule's condition held or not.
+// window is the length of an aggregate window. Windows not after
+// LastWindowTs were already applied and are ignored; Advance reports whether
+// the window was applied. A missing window breaks the run of windows the
+// condition must hold for, but does not resolve a firing rule.
+func (s *State) Advance(windowStart time.Time, holds bool, forDuration, window time.Duration) (Transition, bool) {
+	if !s.LastWindowTs.IsZero() && !windowStart.After(s.LastWindowTs) {
+		return TransitionNone, false
+	}
+	consecutive := !s.LastWindowTs.IsZero() && windowStart.Sub(s.LastWindowTs) <= window
+	s.LastWindowTs = windowStart
+
+	if !holds {
+		s.ActiveSince = time.Time{}
+		if s.Firing {
+			s.Firing = false
+			return TransitionResolved, true
+		}
+		return TransitionNone, true
+	}
+
+	if s.ActiveSince.IsZero() || (!consecutive && !s.Firing) {
+		s.ActiveSince = windowStart
+	}
+	if !s.Firing && windowStart.Add(window).Sub(s.ActiveSince) >= forDuration {
+		s.Firing = true
+		return TransitionFiring, true
+	}
+	return TransitionNone, true
+}
@@ -0,0 +1,116 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		ruleName   string
+		expression string
+		selector   Selector
+		forDur     time.Duration
+		severity   string
+		wantErr    bool
+	}{
+		{"valid", "slow", "ttfb_p95 > 800", Selector{Targets: []string{"https://*"}}, 5 * time.Minute, "warning", false},
+		{"no name", " ", "ttfb_p95 > 800", Selector{}, 0, "warning", true},
+		{"bad expression", "slow", "ttfb_p95 >", Selector{}, 0, "warning", true},
+		{"empty pattern", "slow", "ttfb_p95 > 800", Selector{Clients: []string{""}}, 0, "warning", true},
+		{"negative for", "slow", "ttfb_p95 > 800", Selector{}, -time.Minute, "warning", true},
+		{"partial minute", "slow", "ttfb_p95 > 800", Selector{}, 90 * time.Second, "warning", true},
+		{"bad severity", "slow", "ttfb_p95 > 800", Selector{}, 0, "high", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRule(tt.ruleName, tt.expression, tt.selector, tt.forDur, tt.severity, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	selector := Selector{
+		Clients: []string{"office-*", "lab"},
+		Targets: []string{"https://api.example.com*"},
+	}
+
+	tests := []struct {
+		client, target, label string
+		want                  bool
+	}{
+		{"office-1", "https://api.example.com/health", "", true},
+		{"lab", "https://api.example.com", "any", true},
+		{"home-1", "https://api.example.com", "", false},
+		{"office-1", "https://www.example.com", "", false},
+		{"office-", "https://api.example.com", "", true},
+		{"office", "https://api.example.com", "", false},
+	}
+	for _, tt := range tests {
+		if got := selector.Matches(tt.client, tt.target, tt.label); got != tt.want {
+			t.Errorf("Matches(%q, %q, %q) = %v, want %v", tt.client, tt.target, tt.label, got, tt.want)
+		}
+	}
+
+	if !(Selector{}).Matches("any", "any", "") {
+		t.Error("empty selector should match everything")
+	}
+	if (Selector{Labels: []string{"office"}}).Matches("c1", "t1", "") {
+		t.Error("label selector should not match a probe without a label")
+	}
+}
+
+func TestStateAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+	forDuration := 3 * time.Minute
+
+	s := &State{}
+	steps := []struct {
+		name       string
+		window     time.Time
+		holds      bool
+		transition Transition
+		applied    bool
+	}{
+		{"holds once", window(0), true, TransitionNone, true},
+		{"holds twice", window(1), true, TransitionNone, true},
+		{"window already applied", window(1), false, TransitionNone, false},
+		{"run broken by a gap", window(3), true, TransitionNone, true},
+		{"holds twice after gap", window(4), true, TransitionNone, true},
+		{"held for 3 minutes", window(5), true, TransitionFiring, true},
+		{"gap while firing", window(7), true, TransitionNone, true},
+		{"stops holding", window(8), false, TransitionResolved, true},
+		{"still not holding", window(9), false, TransitionNone, true},
+	}
+
+	for _, step := range steps {
+		transition, applied := s.Advance(step.window, step.holds, forDuration, time.Minute)
+		if transition != step.transition || applied != step.applied {
+			t.Fatalf("%s: Advance() = %q, %v, want %q, %v", step.name, transition, applied, step.transition, step.applied)
+		}
+	}
+	if s.Active() {
+		t.Errorf("state should be inactive after resolving: %+v", s)
+	}
+
+	// A rule without a for duration fires on the first window it holds for
+	s = &State{}
+	if transition, _ := s.Advance(window(0), true, 0, time.Minute); transition != TransitionFiring {
+		t.Errorf("Advance() with for 0 = %q, want %q", transition, TransitionFiring)
+	}
+
+	// With 5-minute windows, adjacent windows are consecutive and the second
+	// one completes a 10-minute for duration
+	s = &State{}
+	for i, want := range []Transition{TransitionNone, TransitionFiring} {
+		if transition, _ := s.Advance(window(5*i), true, 10*time.Minute, 5*time.Minute); transition != want {
+			t.Errorf("5-minute window %d: Advance() = %q, want %q", i, transition, want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package alerting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Silence kinds
+const (
+	// KindMaintenance silences alerts and incidents and keeps the windows
+	// it covers out of the baselines
+	KindMaintenance = "maintenance"
+
+	// KindSilence only silences alerts and incidents
+	KindSilence = "silence"
+)
+
+// maxOccurrence bounds the duration of one occurrence of a recurring
+// silence
+const maxOccurrence = 7 * 24 * time.Hour
+
+// weekdays maps schedule weekday names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Matchers select the series a silence applies to, like a rule's Selector,
+// and additionally by the AS organization of the probe's network
+type Matchers struct {
+	Selector
+	Orgs []string `json:"orgs,omitempty"`
+}
+
+// Validate checks the matchers' patterns. At least one pattern is required,
+// so that a silence cannot cover everything by mistake.
+func (m Matchers) Validate() error {
+	if err := m.Selector.Validate(); err != nil {
+		return err
+	}
+	for _, pattern := range m.Orgs {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("patterns must not be empty")
+		}
+	}
+	if len(m.Clients)+len(m.Targets)+len(m.Labels)+len(m.Orgs) == 0 {
+		return fmt.Errorf("at least one client, target, label or org pattern is required")
+	}
+	return nil
+}
+
+// Matches reports whether the matchers select a series
+func (m Matchers) Matches(clientID, target, userLabel, asOrg string) bool {
+	return m.Selector.Matches(clientID, target, userLabel) && matchAny(m.Orgs, asOrg)
+}
+
+// Schedule makes a silence recur: it is active for Duration from Start (a
+// time of day such as "02:00" in Timezone) on each of Weekdays
+type Schedule struct {
+	// Weekdays are "mon" to "sun"; empty means every day
+	Weekdays []string `json:"weekdays,omitempty"`
+	Start    string   `json:"start"`
+	Duration string   `json:"duration"`
+
+	// Timezone is an IANA time zone name; empty means UTC
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Silence suppresses the alerts and incidents of the series it matches while
+// it is active. A silence without a schedule is active from StartsAt until
+// EndsAt; a recurring one is active during the occurrences of its schedule
+// between StartsAt and EndsAt, which is optional.
+type Silence struct {
+	ID       int64
+	Name     string
+	Kind     string
+	Matchers Matchers
+	StartsAt time.Time
+	EndsAt   time.Time
+	Schedule *Schedule
+
+	// Compiled schedule
+	location    *time.Location
+	days        [7]bool
+	startHour   int
+	startMinute int
+	duration    time.Duration
+}
+
+// NewSilence validates and compiles a silence. endsAt may be zero for
+// recurring silences.
+func NewSilence(id int64, name, kind string, matchers Matchers, startsAt, endsAt time.Time, schedule *Schedule) (*Silence, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if kind != KindMaintenance && kind != KindSilence {
+		return nil, fmt.Errorf("kind must be %s or %s", KindMaintenance, KindSilence)
+	}
+	if err := matchers.Validate(); err != nil {
+		return nil, err
+	}
+	if startsAt.IsZero() {
+		return nil, fmt.Errorf("starts_at is required")
+	}
+	if schedule == nil && endsAt.IsZero() {
+		return nil, fmt.Errorf("ends_at is required for silences without a schedule")
+	}
+	if !endsAt.IsZero() && !endsAt.After(startsAt) {
+		return nil, fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	s := &Silence{
+		ID:       id,
+		Name:     name,
+		Kind:     kind,
+		Matchers: matchers,
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+		Schedule: schedule,
+	}
+	if schedule != nil {
+		if err := s.compileSchedule(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// compileSchedule parses the silence's schedule
+func (s *Silence) compileSchedule() error {
+	sched := s.Schedule
+	var err error
+	if s.location, err = time.LoadLocation(sched.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone: %s", sched.Timezone)
+	}
+
+	start, err := time.Parse("15:04", sched.Start)
+	if err != nil {
+		return fmt.Errorf("schedule start must be a time of day such as 02:00")
+	}
+	s.startHour, s.startMinute = start.Hour(), start.Minute()
+
+	if s.duration, err = time.ParseDuration(sched.Duration); err != nil || s.duration < time.Minute || s.duration > maxOccurrence {
+		return fmt.Errorf("schedule duration must be between 1m and %s", maxOccurrence)
+	}
+
+	if len(sched.Weekdays) == 0 {
+		for i := range s.days {
+			s.days[i] = true
+		}
+	}
+	for _, name := range sched.Weekdays {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q: use mon, tue, wed, thu, fri, sat or sun", name)
+		}
+		s.days[day] = true
+	}
+	return nil
+}
+
+// Maintenance reports whether the silence is a maintenance window
+func (s *Silence) Maintenance() bool {
+	return s.Kind == KindMaintenance
+}
+
+// ActiveAt reports whether the silence is active at t
+func (s *Silence) ActiveAt(t time.Time) bool {
+	if t.Before(s.StartsAt) || (!s.EndsAt.IsZero() && !t.Before(s.EndsAt)) {
+		return false
+	}
+	if s.Schedule == nil {
+		return true
+	}
+
+	// Check the occurrences that started on the days an occurrence
+	// covering t may have started on
+	local := t.In(s.location)
+	for back := 0; back <= int(s.duration/(24*time.Hour))+1; back++ {
+		day := local.AddDate(0, 0, -back)
+		if !s.days[day.Weekday()] {
+			continue
+		}
+		// The wall-clock start, which is not a fixed offset from midnight
+		// on days the clocks change
+		begin := time.Date(day.Year(), day.Month(), day.Day(), s.startHour, s.startMinute, 0, 0, s.location)
+		if !t.Before(begin) && t.Before(begin.Add(s.duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the silence can no longer become active after t
+func (s *Silence) Expired(t time.Time) bool {
+	return !s.EndsAt.IsZero() && !t.Before(s.EndsAt)
+}
+
+// Silences is a set of silences
+type Silences []*Silence
+
+// Match returns the silences active at t that match a series
+func (ss Silences) Match(t time.Time, clientID, target, userLabel, asOrg string) Silences {
+	var matched Silences
+	for _, s := range ss {
+		if s.ActiveAt(t) && s.Matchers.Matches(clientID, target, userLabel, asOrg) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// Maintenance reports whether one of the silences is a maintenance window
+func (ss Silences) Maintenance() bool {
+	for _, s := range ss {
+		if s.Maintenance() {
+			return true
+		}
+	}
+	return false
+}
+
+// IDs returns the IDs of the silences
+func (ss Silences) IDs() []int64 {
+	ids := make([]int64, 0, len(ss))
+	for _, s := range ss {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
@@ -0,0 +1,119 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSilence(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	byTarget := Matchers{Selector: Selector{Targets: []string{"https://api.example.com*"}}}
+
+	tests := []struct {
+		name     string
+		kind     string
+		matchers Matchers
+		endsAt   time.Time
+		schedule *Schedule
+		wantErr  bool
+	}{
+		{"one-off", KindMaintenance, byTarget, start.Add(time.Hour), nil, false},
+		{"recurring", KindSilence, Matchers{Orgs: []string{"Example ISP*"}}, time.Time{}, &Schedule{Weekdays: []string{"sun"}, Start: "02:00", Duration: "2h", Timezone: "Europe/Berlin"}, false},
+		{"no matchers", KindSilence, Matchers{}, start.Add(time.Hour), nil, true},
+		{"bad kind", "mute", byTarget, start.Add(time.Hour), nil, true},
+		{"no end", KindSilence, byTarget, time.Time{}, nil, true},
+		{"ends before start", KindSilence, byTarget, start.Add(-time.Hour), nil, true},
+		{"bad weekday", KindSilence, byTarget, time.Time{}, &Schedule{Weekdays: []string{"sunday"}, Start: "02:00", Duration: "2h"}, true},
+		{"bad start", KindSilence, byTarget, time.Time{}, &Schedule{Start: "2am", Duration: "2h"}, true},
+		{"long occurrence", KindSilence, byTarget, time.Time{}, &Schedule{Start: "02:00", Duration: "200h"}, true},
+		{"bad timezone", KindSilence, byTarget, time.Time{}, &Schedule{Start: "02:00", Duration: "2h", Timezone: "Mars/Olympus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSilence(1, "deploy", tt.kind, tt.matchers, start, tt.endsAt, tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSilence() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSilenceActiveAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC) // a Wednesday
+	matchers := Matchers{Selector: Selector{Clients: []string{"*"}}}
+
+	oneOff, err := NewSilence(1, "deploy", KindMaintenance, matchers, start, start.Add(time.Hour), nil)
+	if err != nil {
+		t.Fatalf("NewSilence() error = %v", err)
+	}
+	// Saturdays 23:00 to Sunday 01:00 in New York (UTC-4 in May)
+	weekly, err := NewSilence(2, "isp", KindMaintenance, matchers, start, time.Time{}, &Schedule{
+		Weekdays: []string{"sat"}, Start: "23:00", Duration: "2h", Timezone: "America/New_York",
+	})
+	if err != nil {
+		t.Fatalf("NewSilence() error = %v", err)
+	}
+	// Sundays 04:00 to 05:00 in New York, including the DST change days
+	dst, err := NewSilence(3, "dst", KindSilence, matchers, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}, &Schedule{
+		Weekdays: []string{"sun"}, Start: "04:00", Duration: "1h", Timezone: "America/New_York",
+	})
+	if err != nil {
+		t.Fatalf("NewSilence() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		silence *Silence
+		at      time.Time
+		want    bool
+	}{
+		{"one-off before", oneOff, start.Add(-time.Minute), false},
+		{"one-off start", oneOff, start, true},
+		{"one-off end", oneOff, start.Add(time.Hour), false},
+		{"weekly before", weekly, time.Date(2024, 5, 5, 2, 59, 0, 0, time.UTC), false},
+		{"weekly start", weekly, time.Date(2024, 5, 5, 3, 0, 0, 0, time.UTC), true},
+		{"weekly after midnight", weekly, time.Date(2024, 5, 5, 4, 30, 0, 0, time.UTC), true},
+		{"weekly end", weekly, time.Date(2024, 5, 5, 5, 0, 0, 0, time.UTC), false},
+		{"weekly other day", weekly, time.Date(2024, 5, 6, 3, 30, 0, 0, time.UTC), false},
+		{"weekly before starts_at", weekly, time.Date(2024, 4, 28, 3, 30, 0, 0, time.UTC), false},
+		// 04:00 on the days the clocks change is 08:00 UTC in March (EDT)
+		// and 09:00 UTC in November (EST), not four hours after midnight
+		{"spring forward start", dst, time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC), true},
+		{"spring forward end", dst, time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), false},
+		{"fall back before", dst, time.Date(2024, 11, 3, 8, 30, 0, 0, time.UTC), false},
+		{"fall back start", dst, time.Date(2024, 11, 3, 9, 0, 0, 0, time.UTC), true},
+		{"fall back end", dst, time.Date(2024, 11, 3, 10, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.ActiveAt(tt.at); got != tt.want {
+				t.Errorf("ActiveAt(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilencesMatch(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	deploy, _ := NewSilence(1, "deploy", KindSilence, Matchers{Selector: Selector{Targets: []string{"https://api.example.com/*"}}}, start, end, nil)
+	isp, _ := NewSilence(2, "isp", KindMaintenance, Matchers{Orgs: []string{"Example ISP*"}}, start, end, nil)
+	silences := Silences{deploy, isp}
+
+	at := start.Add(time.Minute)
+	matched := silences.Match(at, "probe-1", "https://api.example.com/health", "office", "Example ISP Inc")
+	if ids := matched.IDs(); len(ids) != 2 || !matched.Maintenance() {
+		t.Errorf("Match() = %v (maintenance %v), want both silences", ids, matched.Maintenance())
+	}
+
+	matched = silences.Match(at, "probe-1", "https://api.example.com/health", "office", "Other Net")
+	if ids := matched.IDs(); len(ids) != 1 || ids[0] != 1 || matched.Maintenance() {
+		t.Errorf("Match() = %v (maintenance %v), want the deploy silence", ids, matched.Maintenance())
+	}
+
+	if matched := silences.Match(end, "probe-1", "https://api.example.com/health", "office", "Example ISP Inc"); len(matched) != 0 {
+		t.Errorf("Match() after the end = %v, want none", matched.IDs())
+	}
+}
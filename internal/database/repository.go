@@ -3,9 +3,12 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/rahulgh33/wirescope/internal/tracing"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -231,6 +234,8 @@ func NewAggregatesRepository(conn *Connection) *AggregatesRepository {
 type WindowedAggregate struct {
 	ClientID             string
 	Target               string
+	AddressFamily        string
+	CheckType            string
 	WindowStartTs        time.Time
 	CountTotal           int64
 	CountSuccess         int64
@@ -240,6 +245,8 @@ type WindowedAggregate struct {
 	TLSErrorCount        int64
 	HTTPErrorCount       int64
 	ThroughputErrorCount int64
+	AssertionErrorCount  int64
+	UDPErrorCount        int64
 	DNSP50               *float64
 	DNSP95               *float64
 	TCPP50               *float64
@@ -250,7 +257,27 @@ type WindowedAggregate struct {
 	TTFBP95              *float64
 	ThroughputP50        *float64
 	ThroughputP95        *float64
+	UploadP50            *float64
+	UploadP95            *float64
+	ProxyConnectP50      *float64
+	ProxyConnectP95      *float64
+	ProxyErrorCount      int64
+	TimeoutErrorCount    int64
+	TimeoutStageCounts   []byte
+	PacketsSent          int64
+	PacketsLost          int64
+	ReorderedCount       int64
+	LossRate             *float64
+	RTTP50               *float64
+	RTTP95               *float64
+	JitterP50            *float64
+	JitterP95            *float64
+	ASN                  int
+	ASOrg                string
+	UserLabel            string
 	DiagnosisLabel       *string
+	DiagnosisDetails     []byte
+	Maintenance          bool
 	UpdatedAt            time.Time
 }
 
@@ -262,6 +289,8 @@ func (r *AggregatesRepository) UpsertAggregate(ctx context.Context, agg *Windowe
 		attribute.String("db.table", "agg_1m"),
 		attribute.String("client.id", agg.ClientID),
 		attribute.String("target", agg.Target),
+		attribute.String("address_family", agg.AddressFamily),
+		attribute.String("check_type", agg.CheckType),
 		attribute.String("window_start", agg.WindowStartTs.Format(time.RFC3339)),
 	)
 	query := `
@@ -269,10 +298,16 @@ func (r *AggregatesRepository) UpsertAggregate(ctx context.Context, agg *Windowe
 			client_id, target, window_start_ts, count_total, count_success, count_error,
 			dns_error_count, tcp_error_count, tls_error_count, http_error_count, throughput_error_count,
 			dns_p50, dns_p95, tcp_p50, tcp_p95, tls_p50, tls_p95, 
-			ttfb_p50, ttfb_p95, throughput_p50, throughput_p95, diagnosis_label, updated_at
+			ttfb_p50, ttfb_p95, throughput_p50, throughput_p95, diagnosis_label, updated_at,
+			address_family, assertion_error_count, check_type, udp_error_count,
+			packets_sent, packets_lost, reordered_count, loss_rate,
+			rtt_p50, rtt_p95, jitter_p50, jitter_p95, upload_p50, upload_p95,
+			proxy_connect_p50, proxy_connect_p95, proxy_error_count, timeout_error_count, diagnosis_details,
+			asn, as_org, user_label, timeout_stage_counts
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23
-		) ON CONFLICT (client_id, target, window_start_ts) 
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27,
+			$28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, $46
+		) ON CONFLICT (client_id, target, address_family, check_type, window_start_ts) 
 		DO UPDATE SET 
 			count_total = $4,
 			count_success = $5,
@@ -293,7 +328,28 @@ func (r *AggregatesRepository) UpsertAggregate(ctx context.Context, agg *Windowe
 			throughput_p50 = $20,
 			throughput_p95 = $21,
 			diagnosis_label = $22,
-			updated_at = $23`
+			updated_at = $23,
+			assertion_error_count = $25,
+			udp_error_count = $27,
+			packets_sent = $28,
+			packets_lost = $29,
+			reordered_count = $30,
+			loss_rate = $31,
+			rtt_p50 = $32,
+			rtt_p95 = $33,
+			jitter_p50 = $34,
+			jitter_p95 = $35,
+			upload_p50 = $36,
+			upload_p95 = $37,
+			proxy_connect_p50 = $38,
+			proxy_connect_p95 = $39,
+			proxy_error_count = $40,
+			timeout_error_count = $41,
+			diagnosis_details = $42,
+			asn = $43,
+			as_org = $44,
+			user_label = $45,
+			timeout_stage_counts = $46`
 
 	_, err := r.conn.ExecContext(ctx, query,
 		agg.ClientID, agg.Target, agg.WindowStartTs,
@@ -303,7 +359,14 @@ func (r *AggregatesRepository) UpsertAggregate(ctx context.Context, agg *Windowe
 		agg.DNSP50, agg.DNSP95, agg.TCPP50, agg.TCPP95,
 		agg.TLSP50, agg.TLSP95, agg.TTFBP50, agg.TTFBP95,
 		agg.ThroughputP50, agg.ThroughputP95, agg.DiagnosisLabel,
-		agg.UpdatedAt,
+		agg.UpdatedAt, agg.AddressFamily, agg.AssertionErrorCount,
+		agg.CheckType, agg.UDPErrorCount,
+		agg.PacketsSent, agg.PacketsLost, agg.ReorderedCount, agg.LossRate,
+		agg.RTTP50, agg.RTTP95, agg.JitterP50, agg.JitterP95,
+		agg.UploadP50, agg.UploadP95,
+		agg.ProxyConnectP50, agg.ProxyConnectP95, agg.ProxyErrorCount, agg.TimeoutErrorCount,
+		agg.DiagnosisDetails,
+		agg.ASN, agg.ASOrg, agg.UserLabel, agg.TimeoutStageCounts,
 	)
 
 	if err != nil {
@@ -316,6 +379,78 @@ func (r *AggregatesRepository) UpsertAggregate(ctx context.Context, agg *Windowe
 	return nil
 }
 
+// CustomMetricAggregate represents the per-window statistics of one probe
+// collector metric, stored in agg_1m_custom_metrics alongside the agg_1m row
+// with the same key
+type CustomMetricAggregate struct {
+	ClientID      string
+	Target        string
+	AddressFamily string
+	CheckType     string
+	WindowStartTs time.Time
+	Metric        string
+	SampleCount   int64
+	MinValue      float64
+	MaxValue      float64
+	MeanValue     float64
+	P50           float64
+	P95           float64
+	UpdatedAt     time.Time
+}
+
+// UpsertCustomMetrics inserts or updates the custom metric statistics of
+// aggregate windows in a single transaction
+func (r *AggregatesRepository) UpsertCustomMetrics(ctx context.Context, metrics []*CustomMetricAggregate) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.upsert_custom_metrics")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "agg_1m_custom_metrics"),
+		attribute.Int("metrics.count", len(metrics)),
+	)
+
+	query := `
+		INSERT INTO agg_1m_custom_metrics (
+			client_id, target, address_family, check_type, window_start_ts, metric,
+			sample_count, min_value, max_value, mean_value, p50, p95, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (client_id, target, address_family, check_type, window_start_ts, metric)
+		DO UPDATE SET
+			sample_count = EXCLUDED.sample_count,
+			min_value = EXCLUDED.min_value,
+			max_value = EXCLUDED.max_value,
+			mean_value = EXCLUDED.mean_value,
+			p50 = EXCLUDED.p50,
+			p95 = EXCLUDED.p95,
+			updated_at = EXCLUDED.updated_at`
+
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare custom metrics upsert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, m := range metrics {
+			if _, err := stmt.ExecContext(ctx,
+				m.ClientID, m.Target, m.AddressFamily, m.CheckType, m.WindowStartTs, m.Metric,
+				m.SampleCount, m.MinValue, m.MaxValue, m.MeanValue, m.P50, m.P95, m.UpdatedAt,
+			); err != nil {
+				return fmt.Errorf("failed to upsert custom metric %s: %w", m.Metric, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+	return nil
+}
+
 // GetAggregatesByWindow retrieves aggregates for a specific time window
 func (r *AggregatesRepository) GetAggregatesByWindow(ctx context.Context, windowStart time.Time) ([]*WindowedAggregate, error) {
 	tracer := tracing.GetTracer("database")
@@ -328,10 +463,14 @@ func (r *AggregatesRepository) GetAggregatesByWindow(ctx context.Context, window
 		SELECT client_id, target, window_start_ts, count_total, count_success, count_error,
 			   dns_error_count, tcp_error_count, tls_error_count, http_error_count, throughput_error_count,
 			   dns_p50, dns_p95, tcp_p50, tcp_p95, tls_p50, tls_p95,
-			   ttfb_p50, ttfb_p95, throughput_p50, throughput_p95, diagnosis_label, updated_at
+			   ttfb_p50, ttfb_p95, throughput_p50, throughput_p95, diagnosis_label, updated_at,
+			   address_family, assertion_error_count, check_type, udp_error_count,
+			   packets_sent, packets_lost, reordered_count, loss_rate,
+			   rtt_p50, rtt_p95, jitter_p50, jitter_p95, upload_p50, upload_p95,
+			   proxy_connect_p50, proxy_connect_p95, proxy_error_count, timeout_error_count
 		FROM agg_1m 
 		WHERE window_start_ts = $1
-		ORDER BY client_id, target`
+		ORDER BY client_id, target, address_family, check_type`
 
 	rows, err := r.conn.QueryContext(ctx, query, windowStart)
 	if err != nil {
@@ -352,7 +491,12 @@ func (r *AggregatesRepository) GetAggregatesByWindow(ctx context.Context, window
 			&agg.DNSP50, &agg.DNSP95, &agg.TCPP50, &agg.TCPP95,
 			&agg.TLSP50, &agg.TLSP95, &agg.TTFBP50, &agg.TTFBP95,
 			&agg.ThroughputP50, &agg.ThroughputP95, &agg.DiagnosisLabel,
-			&agg.UpdatedAt,
+			&agg.UpdatedAt, &agg.AddressFamily, &agg.AssertionErrorCount,
+			&agg.CheckType, &agg.UDPErrorCount,
+			&agg.PacketsSent, &agg.PacketsLost, &agg.ReorderedCount, &agg.LossRate,
+			&agg.RTTP50, &agg.RTTP95, &agg.JitterP50, &agg.JitterP95,
+			&agg.UploadP50, &agg.UploadP95,
+			&agg.ProxyConnectP50, &agg.ProxyConnectP95, &agg.ProxyErrorCount, &agg.TimeoutErrorCount,
 		)
 		if err != nil {
 			tracing.RecordError(ctx, err)
@@ -374,14 +518,18 @@ func (r *AggregatesRepository) GetAggregatesByWindow(ctx context.Context, window
 }
 
 // GetHistoricalAggregates fetches the most recent N windows for baseline calculation
-// Used by the diagnosis engine to establish baseline metrics
-func (r *Repository) GetHistoricalAggregates(ctx context.Context, clientID, target string, limit int) ([]WindowedAggregate, error) {
+// Used by the diagnosis engine to establish baseline metrics. Windows are
+// restricted to a single address family and check type so IPv4 and IPv6 (or
+// TCP and UDP checks of the same host) get separate baselines.
+func (r *Repository) GetHistoricalAggregates(ctx context.Context, clientID, target, addressFamily, checkType string, limit int) ([]WindowedAggregate, error) {
 	tracer := tracing.GetTracer("database")
 	ctx, span := tracer.Start(ctx, "db.query_historical_aggregates")
 	tracing.AddSpanAttributes(ctx,
 		attribute.String("db.table", "agg_1m"),
 		attribute.String("client.id", clientID),
 		attribute.String("target", target),
+		attribute.String("address_family", addressFamily),
+		attribute.String("check_type", checkType),
 		attribute.Int("limit", limit),
 	)
 	query := `
@@ -393,14 +541,18 @@ func (r *Repository) GetHistoricalAggregates(ctx context.Context, clientID, targ
 			dns_p50, dns_p95, tcp_p50, tcp_p95,
 			tls_p50, tls_p95, ttfb_p50, ttfb_p95,
 			throughput_p50, throughput_p95, diagnosis_label,
-			updated_at
+			updated_at, address_family, assertion_error_count,
+			check_type, udp_error_count,
+			packets_sent, packets_lost, reordered_count, loss_rate,
+			rtt_p50, rtt_p95, jitter_p50, jitter_p95, upload_p50, upload_p95,
+			proxy_connect_p50, proxy_connect_p95, proxy_error_count, timeout_error_count
 		FROM agg_1m
-		WHERE client_id = $1 AND target = $2
+		WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4
 		ORDER BY window_start_ts DESC
-		LIMIT $3
+		LIMIT $5
 	`
 
-	rows, err := r.conn.QueryContext(ctx, query, clientID, target, limit)
+	rows, err := r.conn.QueryContext(ctx, query, clientID, target, addressFamily, checkType, limit)
 	if err != nil {
 		tracing.RecordError(ctx, err)
 		span.End()
@@ -419,7 +571,12 @@ func (r *Repository) GetHistoricalAggregates(ctx context.Context, clientID, targ
 			&agg.DNSP50, &agg.DNSP95, &agg.TCPP50, &agg.TCPP95,
 			&agg.TLSP50, &agg.TLSP95, &agg.TTFBP50, &agg.TTFBP95,
 			&agg.ThroughputP50, &agg.ThroughputP95, &agg.DiagnosisLabel,
-			&agg.UpdatedAt,
+			&agg.UpdatedAt, &agg.AddressFamily, &agg.AssertionErrorCount,
+			&agg.CheckType, &agg.UDPErrorCount,
+			&agg.PacketsSent, &agg.PacketsLost, &agg.ReorderedCount, &agg.LossRate,
+			&agg.RTTP50, &agg.RTTP95, &agg.JitterP50, &agg.JitterP95,
+			&agg.UploadP50, &agg.UploadP95,
+			&agg.ProxyConnectP50, &agg.ProxyConnectP95, &agg.ProxyErrorCount, &agg.TimeoutErrorCount,
 		)
 		if err != nil {
 			tracing.RecordError(ctx, err)
@@ -439,3 +596,2939 @@ func (r *Repository) GetHistoricalAggregates(ctx context.Context, clientID, targ
 
 	return aggregates, nil
 }
+
+// PathTracesRepository provides operations for the path_traces table
+type PathTracesRepository struct {
+	*Repository
+}
+
+// NewPathTracesRepository creates a new path traces repository
+func NewPathTracesRepository(conn *Connection) *PathTracesRepository {
+	return &PathTracesRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// PathTrace represents a stored path trace. Hops holds the JSON-encoded hop
+// list as shipped by the probe.
+type PathTrace struct {
+	ID            int64
+	EventID       string
+	ClientID      string
+	Target        string
+	AddressFamily string
+	Protocol      string
+	Port          int
+	Method        string
+	Trigger       string
+	DestinationIP *string
+	Reached       bool
+	HopCount      int
+	Hops          []byte
+	PathSignature string
+	PathChanged   bool
+	DurationMs    float64
+	Ts            time.Time
+	CreatedAt     time.Time
+}
+
+// InsertPathTrace stores a path trace
+// Returns true if the trace was newly inserted, false if it already existed
+func (r *PathTracesRepository) InsertPathTrace(ctx context.Context, trace *PathTrace) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.insert_path_trace")
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "path_traces"),
+		attribute.String("event.id", trace.EventID),
+		attribute.String("client.id", trace.ClientID),
+		attribute.String("target", trace.Target),
+		attribute.Bool("path.changed", trace.PathChanged),
+	)
+	query := `
+		INSERT INTO path_traces (
+			event_id, client_id, target, address_family, protocol, port,
+			method, trigger, destination_ip, reached, hop_count, hops,
+			path_signature, path_changed, duration_ms, ts
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (event_id) DO NOTHING`
+
+	result, err := r.conn.ExecContext(ctx, query,
+		trace.EventID, trace.ClientID, trace.Target, trace.AddressFamily, trace.Protocol, trace.Port,
+		trace.Method, trace.Trigger, trace.DestinationIP, trace.Reached, trace.HopCount, trace.Hops,
+		trace.PathSignature, trace.PathChanged, trace.DurationMs, trace.Ts,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		span.End()
+		return false, fmt.Errorf("failed to insert path trace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		span.End()
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	span.End()
+	return rowsAffected > 0, nil
+}
+
+// GetLatestPathTrace returns the most recent trace of a target taken before
+// the given time with the same family, protocol and method, or nil if there
+// is none. Traces taken differently are not comparable hop by hop.
+func (r *PathTracesRepository) GetLatestPathTrace(ctx context.Context, clientID, target, addressFamily, protocol, method string, before time.Time) (*PathTrace, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.query_latest_path_trace")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "path_traces"),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+	)
+	query := `
+		SELECT
+			id, event_id, client_id, target, address_family, protocol, port,
+			method, trigger, destination_ip, reached, hop_count, hops,
+			path_signature, path_changed, duration_ms, ts, created_at
+		FROM path_traces
+		WHERE client_id = $1 AND target = $2 AND address_family = $3
+		  AND protocol = $4 AND method = $5 AND ts < $6
+		ORDER BY ts DESC
+		LIMIT 1
+	`
+
+	var trace PathTrace
+	err := r.conn.QueryRowContext(ctx, query, clientID, target, addressFamily, protocol, method, before).Scan(
+		&trace.ID, &trace.EventID, &trace.ClientID, &trace.Target, &trace.AddressFamily, &trace.Protocol, &trace.Port,
+		&trace.Method, &trace.Trigger, &trace.DestinationIP, &trace.Reached, &trace.HopCount, &trace.Hops,
+		&trace.PathSignature, &trace.PathChanged, &trace.DurationMs, &trace.Ts, &trace.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query latest path trace: %w", err)
+	}
+	return &trace, nil
+}
+
+// ClockSkewRepository provides operations for the client_clock_skew table
+type ClockSkewRepository struct {
+	*Repository
+}
+
+// NewClockSkewRepository creates a new clock skew repository
+func NewClockSkewRepository(conn *Connection) *ClockSkewRepository {
+	return &ClockSkewRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// RecordClockSkew adds one event's clock skew (server minus probe, in ms) to
+// the client's statistics
+func (r *ClockSkewRepository) RecordClockSkew(ctx context.Context, clientID string, skewMs int64, skewed, corrected bool, seenAt time.Time) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.record_clock_skew")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "client_clock_skew"),
+		attribute.String("client.id", clientID),
+		attribute.Int64("clock.skew_ms", skewMs),
+	)
+
+	absSkew := skewMs
+	if absSkew < 0 {
+		absSkew = -absSkew
+	}
+	var buckets [5]int64
+	switch {
+	case absSkew < 100:
+		buckets[0] = 1
+	case absSkew < 1000:
+		buckets[1] = 1
+	case absSkew < 10000:
+		buckets[2] = 1
+	case absSkew < 60000:
+		buckets[3] = 1
+	default:
+		buckets[4] = 1
+	}
+	var skewedCount, correctedCount int64
+	if skewed {
+		skewedCount = 1
+	}
+	if corrected {
+		correctedCount = 1
+	}
+
+	query := `
+		INSERT INTO client_clock_skew (
+			client_id, samples, skewed_events, corrected_events, last_skew_ms,
+			min_skew_ms, max_skew_ms, sum_abs_skew_ms,
+			skew_lt_100ms, skew_lt_1s, skew_lt_10s, skew_lt_60s, skew_ge_60s,
+			last_seen_at, updated_at
+		) VALUES ($1, 1, $2, $3, $4, $4, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		ON CONFLICT (client_id) DO UPDATE SET
+			samples = client_clock_skew.samples + 1,
+			skewed_events = client_clock_skew.skewed_events + EXCLUDED.skewed_events,
+			corrected_events = client_clock_skew.corrected_events + EXCLUDED.corrected_events,
+			last_skew_ms = EXCLUDED.last_skew_ms,
+			min_skew_ms = LEAST(client_clock_skew.min_skew_ms, EXCLUDED.min_skew_ms),
+			max_skew_ms = GREATEST(client_clock_skew.max_skew_ms, EXCLUDED.max_skew_ms),
+			sum_abs_skew_ms = client_clock_skew.sum_abs_skew_ms + EXCLUDED.sum_abs_skew_ms,
+			skew_lt_100ms = client_clock_skew.skew_lt_100ms + EXCLUDED.skew_lt_100ms,
+			skew_lt_1s = client_clock_skew.skew_lt_1s + EXCLUDED.skew_lt_1s,
+			skew_lt_10s = client_clock_skew.skew_lt_10s + EXCLUDED.skew_lt_10s,
+			skew_lt_60s = client_clock_skew.skew_lt_60s + EXCLUDED.skew_lt_60s,
+			skew_ge_60s = client_clock_skew.skew_ge_60s + EXCLUDED.skew_ge_60s,
+			last_seen_at = GREATEST(client_clock_skew.last_seen_at, EXCLUDED.last_seen_at),
+			updated_at = NOW()`
+
+	_, err := r.conn.ExecContext(ctx, query,
+		clientID, skewedCount, correctedCount, skewMs, float64(absSkew),
+		buckets[0], buckets[1], buckets[2], buckets[3], buckets[4], seenAt,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to record clock skew: %w", err)
+	}
+	return nil
+}
+
+// HeartbeatsRepository provides operations for the probe_heartbeats table
+type HeartbeatsRepository struct {
+	*Repository
+}
+
+// NewHeartbeatsRepository creates a new heartbeats repository
+func NewHeartbeatsRepository(conn *Connection) *HeartbeatsRepository {
+	return &HeartbeatsRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// ProbeHeartbeat represents the latest heartbeat of a probe
+type ProbeHeartbeat struct {
+	ClientID        string
+	ProbeVersion    string
+	ConfigVersion   string
+	UptimeSeconds   int64
+	IntervalSeconds int
+	Targets         int
+	QueueDepth      int
+	DroppedEvents   int64
+	Hostname        string
+	OS              string
+	Arch            string
+	NumCPU          int
+	GoVersion       string
+	FirstSeenAt     time.Time
+	LastSeenAt      time.Time
+}
+
+// UpsertHeartbeat stores a probe's heartbeat, keeping the newest one if
+// heartbeats arrive out of order
+func (r *HeartbeatsRepository) UpsertHeartbeat(ctx context.Context, hb *ProbeHeartbeat) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.upsert_heartbeat")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "probe_heartbeats"),
+		attribute.String("client.id", hb.ClientID),
+	)
+
+	query := `
+		INSERT INTO probe_heartbeats (
+			client_id, probe_version, config_version, uptime_seconds, interval_seconds,
+			targets, queue_depth, dropped_events, hostname, os, arch, num_cpu,
+			go_version, first_seen_at, last_seen_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14, NOW())
+		ON CONFLICT (client_id) DO UPDATE SET
+			probe_version = EXCLUDED.probe_version,
+			config_version = EXCLUDED.config_version,
+			uptime_seconds = EXCLUDED.uptime_seconds,
+			interval_seconds = EXCLUDED.interval_seconds,
+			targets = EXCLUDED.targets,
+			queue_depth = EXCLUDED.queue_depth,
+			dropped_events = EXCLUDED.dropped_events,
+			hostname = EXCLUDED.hostname,
+			os = EXCLUDED.os,
+			arch = EXCLUDED.arch,
+			num_cpu = EXCLUDED.num_cpu,
+			go_version = EXCLUDED.go_version,
+			last_seen_at = EXCLUDED.last_seen_at,
+			updated_at = NOW()
+		WHERE probe_heartbeats.last_seen_at <= EXCLUDED.last_seen_at`
+
+	_, err := r.conn.ExecContext(ctx, query,
+		hb.ClientID, hb.ProbeVersion, hb.ConfigVersion, hb.UptimeSeconds, hb.IntervalSeconds,
+		hb.Targets, hb.QueueDepth, hb.DroppedEvents, hb.Hostname, hb.OS, hb.Arch, hb.NumCPU,
+		hb.GoVersion, hb.LastSeenAt,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to upsert heartbeat: %w", err)
+	}
+	return nil
+}
+
+// ListHeartbeats returns the latest heartbeat of every probe
+func (r *HeartbeatsRepository) ListHeartbeats(ctx context.Context) ([]*ProbeHeartbeat, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_heartbeats")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "probe_heartbeats"))
+
+	query := `
+		SELECT
+			client_id, probe_version, config_version, uptime_seconds, interval_seconds,
+			targets, queue_depth, dropped_events, hostname, os, arch, num_cpu,
+			go_version, first_seen_at, last_seen_at
+		FROM probe_heartbeats
+		ORDER BY client_id
+	`
+
+	rows, err := r.conn.QueryContext(ctx, query)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query heartbeats: %w", err)
+	}
+	defer rows.Close()
+
+	var heartbeats []*ProbeHeartbeat
+	for rows.Next() {
+		var hb ProbeHeartbeat
+		if err := rows.Scan(
+			&hb.ClientID, &hb.ProbeVersion, &hb.ConfigVersion, &hb.UptimeSeconds, &hb.IntervalSeconds,
+			&hb.Targets, &hb.QueueDepth, &hb.DroppedEvents, &hb.Hostname, &hb.OS, &hb.Arch, &hb.NumCPU,
+			&hb.GoVersion, &hb.FirstSeenAt, &hb.LastSeenAt,
+		); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan heartbeat: %w", err)
+		}
+		heartbeats = append(heartbeats, &hb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate heartbeats: %w", err)
+	}
+	return heartbeats, nil
+}
+
+// Enrollment errors returned when an enrollment code cannot be redeemed or
+// revoked
+var (
+	ErrEnrollmentNotFound = errors.New("enrollment code not found")
+	ErrEnrollmentExpired  = errors.New("enrollment code expired")
+	ErrEnrollmentRevoked  = errors.New("enrollment code revoked")
+	ErrEnrollmentUsed     = errors.New("enrollment code already used")
+
+	// ErrEnrollmentClientTaken is returned when a code that does not pin a
+	// client ID is redeemed for one that already has active credentials
+	ErrEnrollmentClientTaken = errors.New("client ID already has active credentials")
+)
+
+// Enrollment audit actions
+const (
+	EnrollmentActionCreated      = "code_created"
+	EnrollmentActionEnrolled     = "enrolled"
+	EnrollmentActionEnrollFailed = "enroll_failed"
+	EnrollmentActionRevoked      = "revoked"
+)
+
+// EnrollmentRepository provides operations for the enrollment_codes,
+// probe_credentials and enrollment_audit tables
+type EnrollmentRepository struct {
+	*Repository
+}
+
+// NewEnrollmentRepository creates a new enrollment repository
+func NewEnrollmentRepository(conn *Connection) *EnrollmentRepository {
+	return &EnrollmentRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// EnrollmentCode represents a stored enrollment code. Config holds the
+// JSON-encoded initial probe configuration.
+type EnrollmentCode struct {
+	ID               string
+	CodeHash         string
+	CodePrefix       string
+	Name             string
+	ClientID         string
+	Config           []byte
+	CreatedBy        string
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	RedeemedAt       *time.Time
+	RedeemedClientID *string
+	RedeemedFrom     *string
+	RevokedAt        *time.Time
+	RevokedBy        *string
+}
+
+// ProbeCredential represents an ingest token issued to an enrolled probe
+type ProbeCredential struct {
+	ID           string
+	ClientID     string
+	TokenHash    string
+	TokenPrefix  string
+	EnrollmentID string
+	CreatedAt    time.Time
+	RevokedAt    *time.Time
+}
+
+// EnrollmentAuditEntry represents one entry of the enrollment audit log
+type EnrollmentAuditEntry struct {
+	ID           int64
+	EnrollmentID *string
+	ClientID     string
+	Action       string
+	Actor        string
+	RemoteAddr   string
+	Detail       string
+	CreatedAt    time.Time
+}
+
+// enrollmentCodeColumns is the column list scanned by scanEnrollmentCode
+const enrollmentCodeColumns = `
+	id, code_hash, code_prefix, name, client_id, config, created_by, created_at,
+	expires_at, redeemed_at, redeemed_client_id, redeemed_from, revoked_at, revoked_by`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEnrollmentCode(row rowScanner) (*EnrollmentCode, error) {
+	var code EnrollmentCode
+	err := row.Scan(
+		&code.ID, &code.CodeHash, &code.CodePrefix, &code.Name, &code.ClientID, &code.Config,
+		&code.CreatedBy, &code.CreatedAt, &code.ExpiresAt, &code.RedeemedAt, &code.RedeemedClientID,
+		&code.RedeemedFrom, &code.RevokedAt, &code.RevokedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// insertEnrollmentAudit adds an audit entry within a transaction
+func insertEnrollmentAudit(ctx context.Context, tx *sql.Tx, entry *EnrollmentAuditEntry) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO enrollment_audit (enrollment_id, client_id, action, actor, remote_addr, detail, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.EnrollmentID, entry.ClientID, entry.Action, entry.Actor, entry.RemoteAddr, entry.Detail, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record enrollment audit: %w", err)
+	}
+	return nil
+}
+
+// CreateEnrollmentCode stores a new enrollment code and audits its creation
+func (r *EnrollmentRepository) CreateEnrollmentCode(ctx context.Context, code *EnrollmentCode, remoteAddr string) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.create_enrollment_code")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "enrollment_codes"),
+		attribute.String("enrollment.id", code.ID),
+	)
+
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO enrollment_codes (
+				id, code_hash, code_prefix, name, client_id, config, created_by, created_at, expires_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			code.ID, code.CodeHash, code.CodePrefix, code.Name, code.ClientID, code.Config,
+			code.CreatedBy, code.CreatedAt, code.ExpiresAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert enrollment code: %w", err)
+		}
+		return insertEnrollmentAudit(ctx, tx, &EnrollmentAuditEntry{
+			EnrollmentID: &code.ID,
+			ClientID:     code.ClientID,
+			Action:       EnrollmentActionCreated,
+			Actor:        code.CreatedBy,
+			RemoteAddr:   remoteAddr,
+			Detail:       fmt.Sprintf("expires %s", code.ExpiresAt.UTC().Format(time.RFC3339)),
+			CreatedAt:    code.CreatedAt,
+		})
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// ListEnrollmentCodes returns all enrollment codes, newest first
+func (r *EnrollmentRepository) ListEnrollmentCodes(ctx context.Context) ([]*EnrollmentCode, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_enrollment_codes")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "enrollment_codes"))
+
+	rows, err := r.conn.QueryContext(ctx, `SELECT`+enrollmentCodeColumns+` FROM enrollment_codes ORDER BY created_at DESC`)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query enrollment codes: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []*EnrollmentCode
+	for rows.Next() {
+		code, err := scanEnrollmentCode(rows)
+		if err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan enrollment code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate enrollment codes: %w", err)
+	}
+	return codes, nil
+}
+
+// GetEnrollmentCode returns an enrollment code by ID, or nil if there is none
+func (r *EnrollmentRepository) GetEnrollmentCode(ctx context.Context, id string) (*EnrollmentCode, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_enrollment_code")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "enrollment_codes"),
+		attribute.String("enrollment.id", id),
+	)
+
+	code, err := scanEnrollmentCode(r.conn.QueryRowContext(ctx,
+		`SELECT`+enrollmentCodeColumns+` FROM enrollment_codes WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get enrollment code: %w", err)
+	}
+	return code, nil
+}
+
+// RedeemEnrollmentCode exchanges an unused, unexpired code for cred. The
+// probe's client ID is the one pinned by the code, else requestedClientID
+// unless it has active credentials, else fallbackClientID; cred.ClientID is
+// set accordingly. The redemption is audited in the same transaction.
+// Returns ErrEnrollmentNotFound, ErrEnrollmentExpired, ErrEnrollmentRevoked,
+// ErrEnrollmentUsed or ErrEnrollmentClientTaken if the code cannot be
+// redeemed; with all but the first the code is returned as well, so the
+// failure can be audited against it.
+func (r *EnrollmentRepository) RedeemEnrollmentCode(ctx context.Context, codeHash, requestedClientID, fallbackClientID, remoteAddr, detail string, cred *ProbeCredential) (*EnrollmentCode, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.redeem_enrollment_code")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "enrollment_codes"))
+
+	var code *EnrollmentCode
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		code, err = scanEnrollmentCode(tx.QueryRowContext(ctx,
+			`SELECT`+enrollmentCodeColumns+` FROM enrollment_codes WHERE code_hash = $1 FOR UPDATE`, codeHash))
+		if err == sql.ErrNoRows {
+			return ErrEnrollmentNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get enrollment code: %w", err)
+		}
+
+		switch {
+		case code.RevokedAt != nil:
+			return ErrEnrollmentRevoked
+		case code.RedeemedAt != nil:
+			return ErrEnrollmentUsed
+		case !cred.CreatedAt.Before(code.ExpiresAt):
+			return ErrEnrollmentExpired
+		}
+
+		// Only a pinned code may issue credentials for a probe that already
+		// has some, so a code cannot be used to impersonate another probe
+		clientID := code.ClientID
+		if clientID == "" && requestedClientID != "" {
+			var taken bool
+			if err := tx.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM probe_credentials WHERE client_id = $1 AND revoked_at IS NULL)`,
+				requestedClientID,
+			).Scan(&taken); err != nil {
+				return fmt.Errorf("failed to check probe credentials: %w", err)
+			}
+			if taken {
+				return ErrEnrollmentClientTaken
+			}
+			clientID = requestedClientID
+		}
+		if clientID == "" {
+			clientID = fallbackClientID
+		}
+		cred.ClientID = clientID
+		cred.EnrollmentID = code.ID
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE enrollment_codes
+			SET redeemed_at = $2, redeemed_client_id = $3, redeemed_from = $4
+			WHERE id = $1`,
+			code.ID, cred.CreatedAt, clientID, remoteAddr,
+		); err != nil {
+			return fmt.Errorf("failed to redeem enrollment code: %w", err)
+		}
+		code.RedeemedAt = &cred.CreatedAt
+		code.RedeemedClientID = &clientID
+		code.RedeemedFrom = &remoteAddr
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO probe_credentials (id, client_id, token_hash, token_prefix, enrollment_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			cred.ID, cred.ClientID, cred.TokenHash, cred.TokenPrefix, cred.EnrollmentID, cred.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to insert probe credential: %w", err)
+		}
+
+		return insertEnrollmentAudit(ctx, tx, &EnrollmentAuditEntry{
+			EnrollmentID: &code.ID,
+			ClientID:     clientID,
+			Action:       EnrollmentActionEnrolled,
+			Actor:        clientID,
+			RemoteAddr:   remoteAddr,
+			Detail:       detail,
+			CreatedAt:    cred.CreatedAt,
+		})
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		if errors.Is(err, ErrEnrollmentExpired) || errors.Is(err, ErrEnrollmentRevoked) ||
+			errors.Is(err, ErrEnrollmentUsed) || errors.Is(err, ErrEnrollmentClientTaken) {
+			return code, err
+		}
+		return nil, err
+	}
+	return code, nil
+}
+
+// RevokeEnrollment revokes an enrollment code and every credential issued
+// for it, returning the number of credentials revoked. Returns
+// ErrEnrollmentNotFound or ErrEnrollmentRevoked if there is nothing to revoke.
+func (r *EnrollmentRepository) RevokeEnrollment(ctx context.Context, id, actor, remoteAddr string, now time.Time) (int64, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.revoke_enrollment")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "enrollment_codes"),
+		attribute.String("enrollment.id", id),
+	)
+
+	var revoked int64
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var revokedAt *time.Time
+		var clientID sql.NullString
+		err := tx.QueryRowContext(ctx,
+			`SELECT revoked_at, redeemed_client_id FROM enrollment_codes WHERE id = $1 FOR UPDATE`, id,
+		).Scan(&revokedAt, &clientID)
+		if err == sql.ErrNoRows {
+			return ErrEnrollmentNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get enrollment code: %w", err)
+		}
+		if revokedAt != nil {
+			return ErrEnrollmentRevoked
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE enrollment_codes SET revoked_at = $2, revoked_by = $3 WHERE id = $1`, id, now, actor,
+		); err != nil {
+			return fmt.Errorf("failed to revoke enrollment code: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, `
+			UPDATE probe_credentials SET revoked_at = $2, revoked_by = $3
+			WHERE enrollment_id = $1 AND revoked_at IS NULL`, id, now, actor,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to revoke probe credentials: %w", err)
+		}
+		if revoked, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		return insertEnrollmentAudit(ctx, tx, &EnrollmentAuditEntry{
+			EnrollmentID: &id,
+			ClientID:     clientID.String,
+			Action:       EnrollmentActionRevoked,
+			Actor:        actor,
+			RemoteAddr:   remoteAddr,
+			Detail:       fmt.Sprintf("%d credential(s) revoked", revoked),
+			CreatedAt:    now,
+		})
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// RecordEnrollmentAudit adds an entry to the enrollment audit log
+func (r *EnrollmentRepository) RecordEnrollmentAudit(ctx context.Context, entry *EnrollmentAuditEntry) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.record_enrollment_audit")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "enrollment_audit"),
+		attribute.String("enrollment.action", entry.Action),
+	)
+
+	_, err := r.conn.ExecContext(ctx, `
+		INSERT INTO enrollment_audit (enrollment_id, client_id, action, actor, remote_addr, detail, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.EnrollmentID, entry.ClientID, entry.Action, entry.Actor, entry.RemoteAddr, entry.Detail, entry.CreatedAt,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to record enrollment audit: %w", err)
+	}
+	return nil
+}
+
+// ListEnrollmentAudit returns the newest audit entries, optionally limited
+// to one enrollment
+func (r *EnrollmentRepository) ListEnrollmentAudit(ctx context.Context, enrollmentID string, limit int) ([]*EnrollmentAuditEntry, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_enrollment_audit")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "enrollment_audit"))
+
+	query := `
+		SELECT id, enrollment_id, client_id, action, actor, remote_addr, detail, created_at
+		FROM enrollment_audit
+		WHERE ($1 = '' OR enrollment_id::text = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.conn.QueryContext(ctx, query, enrollmentID, limit)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query enrollment audit: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*EnrollmentAuditEntry
+	for rows.Next() {
+		var e EnrollmentAuditEntry
+		if err := rows.Scan(
+			&e.ID, &e.EnrollmentID, &e.ClientID, &e.Action, &e.Actor, &e.RemoteAddr, &e.Detail, &e.CreatedAt,
+		); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan enrollment audit: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate enrollment audit: %w", err)
+	}
+	return entries, nil
+}
+
+// GetActiveProbeCredential returns the unrevoked credential with the given
+// token hash, or nil if there is none
+func (r *EnrollmentRepository) GetActiveProbeCredential(ctx context.Context, tokenHash string) (*ProbeCredential, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_probe_credential")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "probe_credentials"))
+
+	var cred ProbeCredential
+	var enrollmentID sql.NullString
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT id, client_id, token_hash, token_prefix, enrollment_id, created_at, revoked_at
+		FROM probe_credentials
+		WHERE token_hash = $1 AND revoked_at IS NULL`, tokenHash,
+	).Scan(&cred.ID, &cred.ClientID, &cred.TokenHash, &cred.TokenPrefix, &enrollmentID, &cred.CreatedAt, &cred.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get probe credential: %w", err)
+	}
+	cred.EnrollmentID = enrollmentID.String
+	return &cred, nil
+}
+
+// DiagnosisRepository provides operations for the diagnoser: reading
+// aggregate windows and recording results in diagnosis_history
+type DiagnosisRepository struct {
+	*Repository
+}
+
+// NewDiagnosisRepository creates a new diagnosis repository
+func NewDiagnosisRepository(conn *Connection) *DiagnosisRepository {
+	return &DiagnosisRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// DiagnosisRecord represents a diagnosis_history row. Baseline holds the
+// JSON-encoded baseline the window was compared against, Details the
+// JSON-encoded diagnosis result with all findings and their evidence.
+type DiagnosisRecord struct {
+	ID                    int64
+	ClientID              string
+	Target                string
+	AddressFamily         string
+	CheckType             string
+	WindowStartTs         time.Time
+	DiagnosisLabel        *string
+	PreviousLabel         *string
+	Revision              int
+	Late                  bool
+	CountSuccess          int64
+	DNSP95                *float64
+	TCPP95                *float64
+	TLSP95                *float64
+	TTFBP95               *float64
+	ThroughputP50         *float64
+	BaselineWindows       int
+	Baseline              []byte
+	Details               []byte
+	TargetClients         int
+	TargetAffectedClients int
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+
+	// Silences holds the JSON-encoded IDs of the silences active for the
+	// window's series, or nil; Maintenance is set if one of them is a
+	// maintenance window. Both are stored on the aggregate.
+	Silences    []byte
+	Maintenance bool
+
+	// BaselineStates are the baselines updated with this window; they are
+	// saved in the same transaction as the diagnosis
+	BaselineStates []BaselineStateRecord
+
+	// ChangePointState is the series' change-point detection state if this
+	// window updated it, and LevelShifts the shifts the window completed;
+	// both are saved in the same transaction as the diagnosis
+	ChangePointState *ChangePointStateRecord
+	LevelShifts      []LevelShiftRecord
+}
+
+// BaselineStateRecord represents a diagnosis_baselines row. State holds the
+// JSON-encoded baseline state.
+type BaselineStateRecord struct {
+	ClientID      string
+	Target        string
+	AddressFamily string
+	CheckType     string
+	Strategy      string
+	Bucket        int
+	State         []byte
+	WindowCount   int
+	LastWindowTs  time.Time
+	UpdatedAt     time.Time
+}
+
+// ChangePointStateRecord represents a change_point_states row. State holds
+// the JSON-encoded detection state.
+type ChangePointStateRecord struct {
+	ClientID      string
+	Target        string
+	AddressFamily string
+	CheckType     string
+	State         []byte
+	LastWindowTs  time.Time
+	UpdatedAt     time.Time
+}
+
+// LevelShiftRecord represents a level_shifts row
+type LevelShiftRecord struct {
+	ID            int64     `json:"id"`
+	ClientID      string    `json:"client_id"`
+	Target        string    `json:"target"`
+	AddressFamily string    `json:"address_family"`
+	CheckType     string    `json:"check_type"`
+	Metric        string    `json:"metric"`
+	Direction     string    `json:"direction"`
+	Before        float64   `json:"before"`
+	After         float64   `json:"after"`
+	Change        float64   `json:"change"`
+	StartedAt     time.Time `json:"started_at"`
+	DetectedAt    time.Time `json:"detected_at"`
+	Windows       int       `json:"windows"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TargetBaselineStrategy represents a target_baseline_strategies row
+type TargetBaselineStrategy struct {
+	Target    string    `json:"target"`
+	Strategy  string    `json:"strategy"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// aggregateColumns lists the agg_1m columns read by scanAggregate
+const aggregateColumns = `
+	client_id, target, window_start_ts, count_total, count_success, count_error,
+	dns_error_count, tcp_error_count, tls_error_count, http_error_count, throughput_error_count,
+	dns_p50, dns_p95, tcp_p50, tcp_p95, tls_p50, tls_p95,
+	ttfb_p50, ttfb_p95, throughput_p50, throughput_p95, diagnosis_label, updated_at,
+	address_family, assertion_error_count, check_type, udp_error_count,
+	packets_sent, packets_lost, reordered_count, loss_rate,
+	rtt_p50, rtt_p95, jitter_p50, jitter_p95, upload_p50, upload_p95,
+	proxy_connect_p50, proxy_connect_p95, proxy_error_count, timeout_error_count,
+	diagnosis_details, asn, as_org, user_label, maintenance, timeout_stage_counts`
+
+func scanAggregate(row rowScanner, agg *WindowedAggregate) error {
+	return row.Scan(
+		&agg.ClientID, &agg.Target, &agg.WindowStartTs,
+		&agg.CountTotal, &agg.CountSuccess, &agg.CountError,
+		&agg.DNSErrorCount, &agg.TCPErrorCount, &agg.TLSErrorCount,
+		&agg.HTTPErrorCount, &agg.ThroughputErrorCount,
+		&agg.DNSP50, &agg.DNSP95, &agg.TCPP50, &agg.TCPP95,
+		&agg.TLSP50, &agg.TLSP95, &agg.TTFBP50, &agg.TTFBP95,
+		&agg.ThroughputP50, &agg.ThroughputP95, &agg.DiagnosisLabel,
+		&agg.UpdatedAt, &agg.AddressFamily, &agg.AssertionErrorCount,
+		&agg.CheckType, &agg.UDPErrorCount,
+		&agg.PacketsSent, &agg.PacketsLost, &agg.ReorderedCount, &agg.LossRate,
+		&agg.RTTP50, &agg.RTTP95, &agg.JitterP50, &agg.JitterP95,
+		&agg.UploadP50, &agg.UploadP95,
+		&agg.ProxyConnectP50, &agg.ProxyConnectP95, &agg.ProxyErrorCount, &agg.TimeoutErrorCount,
+		&agg.DiagnosisDetails, &agg.ASN, &agg.ASOrg, &agg.UserLabel, &agg.Maintenance, &agg.TimeoutStageCounts,
+	)
+}
+
+// GetAggregate fetches a single aggregate window, or nil if it does not exist
+func (r *DiagnosisRepository) GetAggregate(ctx context.Context, clientID, target, addressFamily, checkType string, windowStart time.Time) (*WindowedAggregate, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_aggregate")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "agg_1m"),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+	)
+
+	query := `SELECT ` + aggregateColumns + `
+		FROM agg_1m
+		WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4
+			AND window_start_ts = $5`
+
+	agg := &WindowedAggregate{}
+	err := scanAggregate(r.conn.QueryRowContext(ctx, query, clientID, target, addressFamily, checkType, windowStart), agg)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get aggregate: %w", err)
+	}
+	return agg, nil
+}
+
+// GetAggregatesBefore fetches up to limit windows preceding windowStart,
+// most recent first. Unlike GetHistoricalAggregates it never includes the
+// window being diagnosed.
+func (r *DiagnosisRepository) GetAggregatesBefore(ctx context.Context, clientID, target, addressFamily, checkType string, windowStart time.Time, limit int) ([]WindowedAggregate, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.query_aggregates_before")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "agg_1m"),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+		attribute.Int("limit", limit),
+	)
+
+	query := `SELECT ` + aggregateColumns + `
+		FROM agg_1m
+		WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4
+			AND window_start_ts < $5
+		ORDER BY window_start_ts DESC
+		LIMIT $6`
+
+	rows, err := r.conn.QueryContext(ctx, query, clientID, target, addressFamily, checkType, windowStart, limit)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query aggregates before window: %w", err)
+	}
+	defer rows.Close()
+
+	var aggregates []WindowedAggregate
+	for rows.Next() {
+		var agg WindowedAggregate
+		if err := scanAggregate(rows, &agg); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan aggregate row: %w", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating aggregate rows: %w", err)
+	}
+	tracing.AddSpanAttributes(ctx, attribute.Int("rows", len(aggregates)))
+	return aggregates, nil
+}
+
+// SaveDiagnosis records a window's diagnosis. In one transaction it sets
+// the label on the agg_1m row, counts the clients measuring the same target
+// in the window and how many of them have an issue, and upserts the
+// diagnosis_history row. A window that was diagnosed before keeps its row:
+// its revision is incremented and PreviousLabel becomes the earlier label.
+// The record's Revision, PreviousLabel, Late and target counts are updated.
+func (r *DiagnosisRepository) SaveDiagnosis(ctx context.Context, rec *DiagnosisRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.save_diagnosis")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "diagnosis_history"),
+		attribute.String("client.id", rec.ClientID),
+		attribute.String("target", rec.Target),
+		attribute.String("window_start", rec.WindowStartTs.Format(time.RFC3339)),
+	)
+
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE agg_1m SET diagnosis_label = $6, diagnosis_details = $7, silences = $8, maintenance = $9
+			WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4
+				AND window_start_ts = $5`,
+			rec.ClientID, rec.Target, rec.AddressFamily, rec.CheckType, rec.WindowStartTs, rec.DiagnosisLabel,
+			rec.Details, rec.Silences, rec.Maintenance,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update aggregate diagnosis: %w", err)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*), COUNT(diagnosis_label)
+			FROM agg_1m
+			WHERE target = $1 AND address_family = $2 AND check_type = $3 AND window_start_ts = $4`,
+			rec.Target, rec.AddressFamily, rec.CheckType, rec.WindowStartTs,
+		).Scan(&rec.TargetClients, &rec.TargetAffectedClients)
+		if err != nil {
+			return fmt.Errorf("failed to count target diagnoses: %w", err)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO diagnosis_history (
+				client_id, target, address_family, check_type, window_start_ts,
+				diagnosis_label, previous_label, late, count_success,
+				dns_p95, tcp_p95, tls_p95, ttfb_p95, throughput_p50,
+				baseline_windows, baseline, target_clients, target_affected_clients,
+				created_at, updated_at, details
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $19, $20)
+			ON CONFLICT (client_id, target, address_family, check_type, window_start_ts)
+			DO UPDATE SET
+				diagnosis_label = EXCLUDED.diagnosis_label,
+				previous_label = diagnosis_history.diagnosis_label,
+				revision = diagnosis_history.revision + 1,
+				late = TRUE,
+				count_success = EXCLUDED.count_success,
+				dns_p95 = EXCLUDED.dns_p95,
+				tcp_p95 = EXCLUDED.tcp_p95,
+				tls_p95 = EXCLUDED.tls_p95,
+				ttfb_p95 = EXCLUDED.ttfb_p95,
+				throughput_p50 = EXCLUDED.throughput_p50,
+				baseline_windows = EXCLUDED.baseline_windows,
+				baseline = EXCLUDED.baseline,
+				details = EXCLUDED.details,
+				target_clients = EXCLUDED.target_clients,
+				target_affected_clients = EXCLUDED.target_affected_clients,
+				updated_at = EXCLUDED.updated_at
+			RETURNING id, revision, previous_label, late, created_at`,
+			rec.ClientID, rec.Target, rec.AddressFamily, rec.CheckType, rec.WindowStartTs,
+			rec.DiagnosisLabel, rec.PreviousLabel, rec.Late, rec.CountSuccess,
+			rec.DNSP95, rec.TCPP95, rec.TLSP95, rec.TTFBP95, rec.ThroughputP50,
+			rec.BaselineWindows, rec.Baseline, rec.TargetClients, rec.TargetAffectedClients,
+			rec.UpdatedAt, rec.Details,
+		).Scan(&rec.ID, &rec.Revision, &rec.PreviousLabel, &rec.Late, &rec.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to upsert diagnosis: %w", err)
+		}
+
+		for i := range rec.BaselineStates {
+			if err := saveBaselineState(ctx, tx, &rec.BaselineStates[i]); err != nil {
+				return err
+			}
+		}
+		if rec.ChangePointState != nil {
+			if err := saveChangePointState(ctx, tx, rec.ChangePointState); err != nil {
+				return err
+			}
+		}
+		for i := range rec.LevelShifts {
+			if err := saveLevelShift(ctx, tx, &rec.LevelShifts[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+	return nil
+}
+
+func saveBaselineState(ctx context.Context, tx *sql.Tx, state *BaselineStateRecord) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO diagnosis_baselines (
+			client_id, target, address_family, check_type, strategy, bucket,
+			state, window_count, last_window_ts, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (client_id, target, address_family, check_type, strategy, bucket)
+		DO UPDATE SET
+			state = EXCLUDED.state,
+			window_count = EXCLUDED.window_count,
+			last_window_ts = EXCLUDED.last_window_ts,
+			updated_at = EXCLUDED.updated_at`,
+		state.ClientID, state.Target, state.AddressFamily, state.CheckType, state.Strategy, state.Bucket,
+		state.State, state.WindowCount, state.LastWindowTs, state.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save baseline state: %w", err)
+	}
+	return nil
+}
+
+// GetBaselineState returns a series' baseline state for a strategy and
+// bucket, or nil if none has been saved yet
+func (r *DiagnosisRepository) GetBaselineState(ctx context.Context, clientID, target, addressFamily, checkType, strategy string, bucket int) (*BaselineStateRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_baseline_state")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "diagnosis_baselines"),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+		attribute.String("baseline.strategy", strategy),
+	)
+
+	state := BaselineStateRecord{
+		ClientID:      clientID,
+		Target:        target,
+		AddressFamily: addressFamily,
+		CheckType:     checkType,
+		Strategy:      strategy,
+		Bucket:        bucket,
+	}
+	var lastWindowTs sql.NullTime
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT state, window_count, last_window_ts, updated_at
+		FROM diagnosis_baselines
+		WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4
+			AND strategy = $5 AND bucket = $6`,
+		clientID, target, addressFamily, checkType, strategy, bucket,
+	).Scan(&state.State, &state.WindowCount, &lastWindowTs, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get baseline state: %w", err)
+	}
+	state.LastWindowTs = lastWindowTs.Time
+	return &state, nil
+}
+
+func saveChangePointState(ctx context.Context, tx *sql.Tx, state *ChangePointStateRecord) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO change_point_states (
+			client_id, target, address_family, check_type, state, last_window_ts, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (client_id, target, address_family, check_type)
+		DO UPDATE SET
+			state = EXCLUDED.state,
+			last_window_ts = EXCLUDED.last_window_ts,
+			updated_at = EXCLUDED.updated_at`,
+		state.ClientID, state.Target, state.AddressFamily, state.CheckType,
+		state.State, state.LastWindowTs, state.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save change-point state: %w", err)
+	}
+	return nil
+}
+
+// saveLevelShift inserts a level shift and sets its ID and CreatedAt. A
+// shift that was already recorded is left as is.
+func saveLevelShift(ctx context.Context, tx *sql.Tx, shift *LevelShiftRecord) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO level_shifts (
+			client_id, target, address_family, check_type, metric, direction,
+			before_level, after_level, change, started_at, detected_at, windows
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (client_id, target, address_family, check_type, metric, detected_at) DO NOTHING
+		RETURNING id, created_at`,
+		shift.ClientID, shift.Target, shift.AddressFamily, shift.CheckType, shift.Metric, shift.Direction,
+		shift.Before, shift.After, shift.Change, shift.StartedAt, shift.DetectedAt, shift.Windows,
+	).Scan(&shift.ID, &shift.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to save level shift: %w", err)
+	}
+	return nil
+}
+
+// GetChangePointState returns a series' change-point detection state, or
+// nil if none has been saved yet
+func (r *DiagnosisRepository) GetChangePointState(ctx context.Context, clientID, target, addressFamily, checkType string) (*ChangePointStateRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_change_point_state")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "change_point_states"),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+	)
+
+	state := ChangePointStateRecord{
+		ClientID:      clientID,
+		Target:        target,
+		AddressFamily: addressFamily,
+		CheckType:     checkType,
+	}
+	var lastWindowTs sql.NullTime
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT state, last_window_ts, updated_at
+		FROM change_point_states
+		WHERE client_id = $1 AND target = $2 AND address_family = $3 AND check_type = $4`,
+		clientID, target, addressFamily, checkType,
+	).Scan(&state.State, &lastWindowTs, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get change-point state: %w", err)
+	}
+	state.LastWindowTs = lastWindowTs.Time
+	return &state, nil
+}
+
+// ListLevelShifts fetches the level shifts detected at or after since, most
+// recent first. Empty clientID and target match every client and target.
+func (r *DiagnosisRepository) ListLevelShifts(ctx context.Context, since time.Time, clientID, target string, limit int) ([]LevelShiftRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_level_shifts")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "level_shifts"),
+		attribute.String("since", since.Format(time.RFC3339)),
+		attribute.Int("limit", limit),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT id, client_id, target, address_family, check_type, metric, direction,
+			before_level, after_level, change, started_at, detected_at, windows, created_at
+		FROM level_shifts
+		WHERE detected_at >= $1 AND ($2 = '' OR client_id = $2) AND ($3 = '' OR target = $3)
+		ORDER BY detected_at DESC, id DESC
+		LIMIT $4`,
+		since, clientID, target, limit,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query level shifts: %w", err)
+	}
+	defer rows.Close()
+
+	var shifts []LevelShiftRecord
+	for rows.Next() {
+		var shift LevelShiftRecord
+		if err := rows.Scan(&shift.ID, &shift.ClientID, &shift.Target, &shift.AddressFamily, &shift.CheckType,
+			&shift.Metric, &shift.Direction, &shift.Before, &shift.After, &shift.Change,
+			&shift.StartedAt, &shift.DetectedAt, &shift.Windows, &shift.CreatedAt); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan level shift: %w", err)
+		}
+		shifts = append(shifts, shift)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating level shifts: %w", err)
+	}
+	return shifts, nil
+}
+
+// ListTargetBaselineStrategies returns the per-target baseline strategies
+func (r *DiagnosisRepository) ListTargetBaselineStrategies(ctx context.Context) ([]TargetBaselineStrategy, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_target_baseline_strategies")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "target_baseline_strategies"))
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT target, strategy, COALESCE(updated_by, ''), updated_at
+		FROM target_baseline_strategies
+		ORDER BY target`)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list target baseline strategies: %w", err)
+	}
+	defer rows.Close()
+
+	var strategies []TargetBaselineStrategy
+	for rows.Next() {
+		var s TargetBaselineStrategy
+		if err := rows.Scan(&s.Target, &s.Strategy, &s.UpdatedBy, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan target baseline strategy: %w", err)
+		}
+		strategies = append(strategies, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate target baseline strategies: %w", err)
+	}
+	return strategies, nil
+}
+
+// SetTargetBaselineStrategy sets the baseline strategy of a target
+func (r *DiagnosisRepository) SetTargetBaselineStrategy(ctx context.Context, s *TargetBaselineStrategy) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.set_target_baseline_strategy")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "target_baseline_strategies"),
+		attribute.String("target", s.Target),
+		attribute.String("baseline.strategy", s.Strategy),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO target_baseline_strategies (target, strategy, updated_by, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NOW())
+		ON CONFLICT (target)
+		DO UPDATE SET
+			strategy = EXCLUDED.strategy,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at`,
+		s.Target, s.Strategy, s.UpdatedBy,
+	).Scan(&s.UpdatedAt)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to set target baseline strategy: %w", err)
+	}
+	return nil
+}
+
+// DeleteTargetBaselineStrategy removes a target's baseline strategy so it
+// uses the default again. It reports whether the target had one.
+func (r *DiagnosisRepository) DeleteTargetBaselineStrategy(ctx context.Context, target string) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.delete_target_baseline_strategy")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "target_baseline_strategies"),
+		attribute.String("target", target),
+	)
+
+	result, err := r.conn.ExecContext(ctx, "DELETE FROM target_baseline_strategies WHERE target = $1", target)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to delete target baseline strategy: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// WindowSeries is one agg_1m series of a window with its diagnosis and the
+// probe's network attributes, as read for correlation
+type WindowSeries struct {
+	ClientID       string
+	Target         string
+	AddressFamily  string
+	CheckType      string
+	ASN            int
+	UserLabel      string
+	DiagnosisLabel *string
+}
+
+// GetWindowSeries fetches every series measured in a window
+func (r *DiagnosisRepository) GetWindowSeries(ctx context.Context, windowStart time.Time) ([]WindowSeries, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.query_window_series")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "agg_1m"),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT client_id, target, address_family, check_type, asn, user_label, diagnosis_label
+		FROM agg_1m
+		WHERE window_start_ts = $1`,
+		windowStart,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query window series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []WindowSeries
+	for rows.Next() {
+		var s WindowSeries
+		if err := rows.Scan(&s.ClientID, &s.Target, &s.AddressFamily, &s.CheckType, &s.ASN, &s.UserLabel, &s.DiagnosisLabel); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan window series: %w", err)
+		}
+		series = append(series, s)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating window series: %w", err)
+	}
+	tracing.AddSpanAttributes(ctx, attribute.Int("rows", len(series)))
+	return series, nil
+}
+
+// CorrelatedIncidentRecord represents a correlated_incidents row. Labels
+// holds the JSON-encoded count of each diagnosis, Clients and Targets the
+// JSON-encoded lists of affected clients and targets.
+type CorrelatedIncidentRecord struct {
+	ID            int64
+	WindowStartTs time.Time
+	Scope         string
+	Key           string
+	Label         string
+	Labels        []byte
+	Clients       []byte
+	Targets       []byte
+	Affected      int
+	Observed      int
+	Revision      int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SaveCorrelatedIncidents replaces a window's correlated incidents and
+// returns those that are new or changed, with their ID, Revision and
+// timestamps set. A changed incident keeps its row and its revision is
+// incremented; incidents no longer found in the window are deleted.
+func (r *DiagnosisRepository) SaveCorrelatedIncidents(ctx context.Context, windowStart time.Time, incidents []CorrelatedIncidentRecord) ([]CorrelatedIncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.save_correlated_incidents")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "correlated_incidents"),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+		attribute.Int("incidents", len(incidents)),
+	)
+
+	var changed []CorrelatedIncidentRecord
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		changed = nil
+		current := make(map[string]bool, len(incidents))
+		for _, inc := range incidents {
+			current[inc.Scope+"|"+inc.Key] = true
+
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO correlated_incidents (
+					window_start_ts, scope, incident_key, label, labels, clients, targets,
+					affected, observed, revision, created_at, updated_at
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 1, NOW(), NOW())
+				ON CONFLICT (window_start_ts, scope, incident_key)
+				DO UPDATE SET
+					label = EXCLUDED.label,
+					labels = EXCLUDED.labels,
+					clients = EXCLUDED.clients,
+					targets = EXCLUDED.targets,
+					affected = EXCLUDED.affected,
+					observed = EXCLUDED.observed,
+					revision = correlated_incidents.revision + 1,
+					updated_at = NOW()
+				WHERE (correlated_incidents.label, correlated_incidents.labels, correlated_incidents.clients,
+						correlated_incidents.targets, correlated_incidents.affected, correlated_incidents.observed)
+					IS DISTINCT FROM (EXCLUDED.label, EXCLUDED.labels, EXCLUDED.clients,
+						EXCLUDED.targets, EXCLUDED.affected, EXCLUDED.observed)
+				RETURNING id, revision, created_at, updated_at`,
+				windowStart, inc.Scope, inc.Key, inc.Label, inc.Labels, inc.Clients, inc.Targets,
+				inc.Affected, inc.Observed,
+			).Scan(&inc.ID, &inc.Revision, &inc.CreatedAt, &inc.UpdatedAt)
+			if err == sql.ErrNoRows {
+				// Unchanged since the window was last correlated
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to upsert correlated incident: %w", err)
+			}
+			inc.WindowStartTs = windowStart
+			changed = append(changed, inc)
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, scope, incident_key FROM correlated_incidents WHERE window_start_ts = $1`,
+			windowStart,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to query correlated incidents: %w", err)
+		}
+		var stale []int64
+		for rows.Next() {
+			var id int64
+			var scope, key string
+			if err := rows.Scan(&id, &scope, &key); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan correlated incident: %w", err)
+			}
+			if !current[scope+"|"+key] {
+				stale = append(stale, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating correlated incidents: %w", err)
+		}
+
+		for _, id := range stale {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM correlated_incidents WHERE id = $1", id); err != nil {
+				return fmt.Errorf("failed to delete stale correlated incident: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, err
+	}
+	tracing.AddSpanAttributes(ctx, attribute.Int("incidents.changed", len(changed)))
+	return changed, nil
+}
+
+// ListCorrelatedIncidents fetches the incidents of windows starting at or
+// after since, most recent first. An empty scope matches every scope.
+func (r *DiagnosisRepository) ListCorrelatedIncidents(ctx context.Context, since time.Time, scope string, limit int) ([]CorrelatedIncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_correlated_incidents")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "correlated_incidents"),
+		attribute.String("since", since.Format(time.RFC3339)),
+		attribute.String("scope", scope),
+		attribute.Int("limit", limit),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT id, window_start_ts, scope, incident_key, label, labels, clients, targets,
+			affected, observed, revision, created_at, updated_at
+		FROM correlated_incidents
+		WHERE window_start_ts >= $1 AND ($2 = '' OR scope = $2)
+		ORDER BY window_start_ts DESC, affected DESC
+		LIMIT $3`,
+		since, scope, limit,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query correlated incidents: %w", err)
+	}
+	defer rows.Close()
+
+	var incidents []CorrelatedIncidentRecord
+	for rows.Next() {
+		var inc CorrelatedIncidentRecord
+		if err := rows.Scan(&inc.ID, &inc.WindowStartTs, &inc.Scope, &inc.Key, &inc.Label, &inc.Labels,
+			&inc.Clients, &inc.Targets, &inc.Affected, &inc.Observed, &inc.Revision,
+			&inc.CreatedAt, &inc.UpdatedAt); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan correlated incident: %w", err)
+		}
+		incidents = append(incidents, inc)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating correlated incidents: %w", err)
+	}
+	return incidents, nil
+}
+
+// IncidentRepository provides operations for incidents, which are alerts
+// rows of type incident
+type IncidentRepository struct {
+	*Repository
+}
+
+// NewIncidentRepository creates a new incident repository
+func NewIncidentRepository(conn *Connection) *IncidentRepository {
+	return &IncidentRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// Incident statuses; Status is derived from the acknowledged and resolved
+// times
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+// IncidentAlertType is the alert_type of incidents in the alerts table
+const IncidentAlertType = "incident"
+
+// IncidentRecord represents an incident. Clients and Targets hold the
+// JSON-encoded lists of clients and targets affected over the incident's
+// life. StartedAt is the first anomalous window.
+type IncidentRecord struct {
+	ID               int64           `json:"id"`
+	Scope            string          `json:"scope"`
+	Key              string          `json:"key"`
+	Status           string          `json:"status"`
+	Severity         string          `json:"severity"`
+	Diagnosis        string          `json:"diagnosis"`
+	Message          string          `json:"message"`
+	Clients          json.RawMessage `json:"clients"`
+	Targets          json.RawMessage `json:"targets"`
+	StartedAt        time.Time       `json:"started_at"`
+	LastAnomalousTs  time.Time       `json:"last_anomalous_ts"`
+	LastWindowTs     time.Time       `json:"last_window_ts"`
+	AnomalousWindows int             `json:"anomalous_windows"`
+	HealthyWindows   int             `json:"healthy_windows"`
+	AcknowledgedAt   *time.Time      `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy   string          `json:"acknowledged_by,omitempty"`
+	AssignedTo       string          `json:"assigned_to,omitempty"`
+	SilenceID        *int64          `json:"silence_id,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	ResolvedAt       *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// incidentColumns is the column list scanned by scanIncident
+const incidentColumns = `
+	id, scope, incident_key, severity, diagnosis, message, clients, targets,
+	window_start_ts, last_anomalous_ts, last_window_ts, anomalous_windows, healthy_windows,
+	acknowledged_at, COALESCE(acknowledged_by, ''), COALESCE(assigned_to, ''), silence_id,
+	created_at, updated_at, resolved_at`
+
+func scanIncident(row rowScanner) (*IncidentRecord, error) {
+	var inc IncidentRecord
+	err := row.Scan(
+		&inc.ID, &inc.Scope, &inc.Key, &inc.Severity, &inc.Diagnosis, &inc.Message, &inc.Clients, &inc.Targets,
+		&inc.StartedAt, &inc.LastAnomalousTs, &inc.LastWindowTs, &inc.AnomalousWindows, &inc.HealthyWindows,
+		&inc.AcknowledgedAt, &inc.AcknowledgedBy, &inc.AssignedTo, &inc.SilenceID,
+		&inc.CreatedAt, &inc.UpdatedAt, &inc.ResolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case inc.ResolvedAt != nil:
+		inc.Status = IncidentResolved
+	case inc.AcknowledgedAt != nil:
+		inc.Status = IncidentAcknowledged
+	default:
+		inc.Status = IncidentOpen
+	}
+	return &inc, nil
+}
+
+// incidentSubject returns the client_id or target column value of an
+// incident: the single value involved, or '*' for several
+func incidentSubject(values json.RawMessage) string {
+	var list []string
+	if err := json.Unmarshal(values, &list); err == nil && len(list) == 1 {
+		return list[0]
+	}
+	return "*"
+}
+
+// queryIncidents runs a query selecting incidentColumns
+func (r *IncidentRepository) queryIncidents(ctx context.Context, query string, args ...interface{}) ([]IncidentRecord, error) {
+	rows, err := r.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer rows.Close()
+
+	var incidents []IncidentRecord
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		incidents = append(incidents, *inc)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating incidents: %w", err)
+	}
+	return incidents, nil
+}
+
+// ListOpenIncidents fetches every unresolved incident
+func (r *IncidentRepository) ListOpenIncidents(ctx context.Context) ([]IncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_open_incidents")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx, attribute.String("db.table", "alerts"))
+
+	return r.queryIncidents(ctx, `SELECT `+incidentColumns+`
+		FROM alerts
+		WHERE alert_type = $1 AND resolved_at IS NULL
+		ORDER BY id`,
+		IncidentAlertType,
+	)
+}
+
+// ListIncidents fetches incidents created since the given time, most recent
+// first. An empty status matches every status.
+func (r *IncidentRepository) ListIncidents(ctx context.Context, status string, since time.Time, limit int) ([]IncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_incidents")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.String("status", status),
+		attribute.Int("limit", limit),
+	)
+
+	return r.queryIncidents(ctx, `SELECT `+incidentColumns+`
+		FROM alerts
+		WHERE alert_type = $1 AND created_at >= $2
+			AND CASE $3
+				WHEN 'open' THEN resolved_at IS NULL AND acknowledged_at IS NULL
+				WHEN 'acknowledged' THEN resolved_at IS NULL AND acknowledged_at IS NOT NULL
+				WHEN 'resolved' THEN resolved_at IS NOT NULL
+				ELSE TRUE
+			END
+		ORDER BY created_at DESC
+		LIMIT $4`,
+		IncidentAlertType, since, status, limit,
+	)
+}
+
+// GetIncident fetches an incident by ID, or nil if it does not exist
+func (r *IncidentRepository) GetIncident(ctx context.Context, id int64) (*IncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_incident")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.Int64("incident.id", id),
+	)
+
+	inc, err := scanIncident(r.conn.QueryRowContext(ctx, `SELECT `+incidentColumns+`
+		FROM alerts
+		WHERE id = $1 AND alert_type = $2`,
+		id, IncidentAlertType,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get incident: %w", err)
+	}
+	return inc, nil
+}
+
+// CountCorrelatedWindows counts the windows, of length window, in the given
+// number of windows before windowStart in which an incident key was
+// correlated
+func (r *IncidentRepository) CountCorrelatedWindows(ctx context.Context, scope, key string, windowStart time.Time, windows int, window time.Duration) (int, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.count_correlated_windows")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "correlated_incidents"),
+		attribute.String("incident.key", key),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+	)
+
+	var count int
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM correlated_incidents
+		WHERE scope = $1 AND incident_key = $2
+			AND window_start_ts >= $3 AND window_start_ts < $4`,
+		scope, key, windowStart.Add(-time.Duration(windows)*window), windowStart,
+	).Scan(&count)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return 0, fmt.Errorf("failed to count correlated windows: %w", err)
+	}
+	return count, nil
+}
+
+// AnomalySilence returns the ID of a silence covering the anomalous windows
+// of the given clients and targets at windowStart, or nil if one of them was
+// not silenced
+func (r *IncidentRepository) AnomalySilence(ctx context.Context, windowStart time.Time, clients, targets []string) (*int64, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.anomaly_silence")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "agg_1m"),
+		attribute.String("window_start", windowStart.Format(time.RFC3339)),
+	)
+
+	var anomalous, unsilenced int
+	var silenceID sql.NullInt64
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE silences IS NULL OR jsonb_array_length(silences) = 0),
+			MIN((silences->>0)::int)
+		FROM agg_1m
+		WHERE window_start_ts = $1 AND client_id = ANY($2) AND target = ANY($3)
+			AND diagnosis_label IS NOT NULL`,
+		windowStart, pq.Array(clients), pq.Array(targets),
+	).Scan(&anomalous, &unsilenced, &silenceID)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get anomaly silence: %w", err)
+	}
+	if anomalous == 0 || unsilenced > 0 || !silenceID.Valid {
+		return nil, nil
+	}
+	return &silenceID.Int64, nil
+}
+
+// OpenIncident creates an incident and sets its ID and timestamps. It
+// reports false, without error, if an unresolved incident with the same
+// scope and key already exists.
+func (r *IncidentRepository) OpenIncident(ctx context.Context, inc *IncidentRecord) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.open_incident")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.String("incident.scope", inc.Scope),
+		attribute.String("incident.key", inc.Key),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO alerts (
+			client_id, target, alert_type, severity, message, window_start_ts,
+			scope, incident_key, diagnosis, clients, targets,
+			last_anomalous_ts, last_window_ts, anomalous_windows, healthy_windows, silence_id,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 0, $15, NOW(), NOW())
+		ON CONFLICT (scope, incident_key) WHERE alert_type = 'incident' AND resolved_at IS NULL
+		DO NOTHING
+		RETURNING id, created_at, updated_at`,
+		incidentSubject(inc.Clients), incidentSubject(inc.Targets), IncidentAlertType, inc.Severity, inc.Message,
+		inc.StartedAt, inc.Scope, inc.Key, inc.Diagnosis, []byte(inc.Clients), []byte(inc.Targets),
+		inc.LastAnomalousTs, inc.LastWindowTs, inc.AnomalousWindows, inc.SilenceID,
+	).Scan(&inc.ID, &inc.CreatedAt, &inc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to open incident: %w", err)
+	}
+	inc.Status = IncidentOpen
+	return true, nil
+}
+
+// AdvanceIncident saves an unresolved incident after a window was applied
+// to it, resolving it if ResolvedAt is set. The update only applies if the
+// incident's last window is still previousWindowTs, so a window applied
+// concurrently by another diagnoser is not applied twice; it reports
+// whether the update applied.
+func (r *IncidentRepository) AdvanceIncident(ctx context.Context, inc *IncidentRecord, previousWindowTs time.Time) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.advance_incident")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.Int64("incident.id", inc.ID),
+		attribute.Bool("incident.resolved", inc.ResolvedAt != nil),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		UPDATE alerts SET
+			client_id = $3,
+			target = $4,
+			severity = $5,
+			message = $6,
+			diagnosis = $7,
+			clients = $8,
+			targets = $9,
+			last_anomalous_ts = $10,
+			last_window_ts = $11,
+			anomalous_windows = $12,
+			healthy_windows = $13,
+			resolved_at = $14,
+			updated_at = NOW()
+		WHERE id = $1 AND last_window_ts = $2 AND resolved_at IS NULL
+		RETURNING updated_at`,
+		inc.ID, previousWindowTs, incidentSubject(inc.Clients), incidentSubject(inc.Targets),
+		inc.Severity, inc.Message, inc.Diagnosis, []byte(inc.Clients), []byte(inc.Targets),
+		inc.LastAnomalousTs, inc.LastWindowTs, inc.AnomalousWindows, inc.HealthyWindows, inc.ResolvedAt,
+	).Scan(&inc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to update incident: %w", err)
+	}
+	if inc.ResolvedAt != nil {
+		inc.Status = IncidentResolved
+	}
+	return true, nil
+}
+
+// AcknowledgeIncident acknowledges an incident and returns it, or nil if
+// it does not exist. Acknowledging it again keeps the first
+// acknowledgement.
+func (r *IncidentRepository) AcknowledgeIncident(ctx context.Context, id int64, username string) (*IncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.acknowledge_incident")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.Int64("incident.id", id),
+	)
+
+	inc, err := scanIncident(r.conn.QueryRowContext(ctx, `
+		UPDATE alerts SET
+			acknowledged_at = COALESCE(acknowledged_at, NOW()),
+			acknowledged_by = COALESCE(acknowledged_by, $3),
+			updated_at = NOW()
+		WHERE id = $1 AND alert_type = $2
+		RETURNING `+incidentColumns,
+		id, IncidentAlertType, username,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to acknowledge incident: %w", err)
+	}
+	return inc, nil
+}
+
+// AssignIncident assigns an incident to a user, or unassigns it if
+// assignee is empty, and returns it, or nil if it does not exist
+func (r *IncidentRepository) AssignIncident(ctx context.Context, id int64, assignee string) (*IncidentRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.assign_incident")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.Int64("incident.id", id),
+	)
+
+	inc, err := scanIncident(r.conn.QueryRowContext(ctx, `
+		UPDATE alerts SET
+			assigned_to = NULLIF($3, ''),
+			updated_at = NOW()
+		WHERE id = $1 AND alert_type = $2
+		RETURNING `+incidentColumns,
+		id, IncidentAlertType, assignee,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to assign incident: %w", err)
+	}
+	return inc, nil
+}
+
+// AlertRuleRepository provides operations for user-defined alert rules, their
+// per-series state and the alerts they fire
+type AlertRuleRepository struct {
+	*Repository
+}
+
+// NewAlertRuleRepository creates a new alert rule repository
+func NewAlertRuleRepository(conn *Connection) *AlertRuleRepository {
+	return &AlertRuleRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// RuleAlertType is the alert_type of alerts fired by alert rules
+const RuleAlertType = "rule"
+
+// ErrAlertRuleExists is returned when an alert rule's name is taken
+var ErrAlertRuleExists = errors.New("alert rule already exists")
+
+// AlertRuleRecord represents an alert_rules row. Selector and Channels hold
+// the JSON-encoded selector and list of notification channels.
+type AlertRuleRecord struct {
+	ID          int64
+	Name        string
+	Description string
+	Expression  string
+	Selector    json.RawMessage
+	ForSeconds  int
+	Severity    string
+	Channels    json.RawMessage
+	Enabled     bool
+	CreatedBy   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// alertRuleColumns is the column list scanned by scanAlertRule
+const alertRuleColumns = `
+	id, name, description, expression, selector, for_seconds, severity, channels,
+	enabled, COALESCE(created_by, ''), created_at, updated_at`
+
+func scanAlertRule(row rowScanner) (*AlertRuleRecord, error) {
+	var rule AlertRuleRecord
+	err := row.Scan(
+		&rule.ID, &rule.Name, &rule.Description, &rule.Expression, &rule.Selector, &rule.ForSeconds,
+		&rule.Severity, &rule.Channels, &rule.Enabled, &rule.CreatedBy, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// ListAlertRules returns the alert rules by name, or only the enabled ones
+func (r *AlertRuleRepository) ListAlertRules(ctx context.Context, enabledOnly bool) ([]AlertRuleRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_alert_rules")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.Bool("enabled_only", enabledOnly),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `SELECT `+alertRuleColumns+`
+		FROM alert_rules
+		WHERE enabled OR NOT $1
+		ORDER BY name`,
+		enabledOnly,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []AlertRuleRecord
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating alert rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetAlertRule fetches an alert rule by ID, or nil if it does not exist
+func (r *AlertRuleRepository) GetAlertRule(ctx context.Context, id int64) (*AlertRuleRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_alert_rule")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.Int64("rule.id", id),
+	)
+
+	rule, err := scanAlertRule(r.conn.QueryRowContext(ctx, `SELECT `+alertRuleColumns+`
+		FROM alert_rules
+		WHERE id = $1`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// CreateAlertRule inserts an alert rule and sets its ID and timestamps. It
+// returns ErrAlertRuleExists if the name is taken.
+func (r *AlertRuleRepository) CreateAlertRule(ctx context.Context, rule *AlertRuleRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.create_alert_rule")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.String("rule.name", rule.Name),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO alert_rules (
+			name, description, expression, selector, for_seconds, severity, channels, enabled, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		RETURNING id, created_at, updated_at`,
+		rule.Name, rule.Description, rule.Expression, rule.Selector, rule.ForSeconds,
+		rule.Severity, rule.Channels, rule.Enabled, rule.CreatedBy,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrAlertRuleExists
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return nil
+}
+
+// UpdateAlertRule replaces an alert rule's definition. It reports whether
+// the rule exists, and returns ErrAlertRuleExists if the new name is taken.
+func (r *AlertRuleRepository) UpdateAlertRule(ctx context.Context, rule *AlertRuleRecord) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.update_alert_rule")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.Int64("rule.id", rule.ID),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		UPDATE alert_rules SET
+			name = $2,
+			description = $3,
+			expression = $4,
+			selector = $5,
+			for_seconds = $6,
+			severity = $7,
+			channels = $8,
+			enabled = $9,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING COALESCE(created_by, ''), created_at, updated_at`,
+		rule.ID, rule.Name, rule.Description, rule.Expression, rule.Selector, rule.ForSeconds,
+		rule.Severity, rule.Channels, rule.Enabled,
+	).Scan(&rule.CreatedBy, &rule.CreatedAt, &rule.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if isUniqueViolation(err) {
+		return false, ErrAlertRuleExists
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return true, nil
+}
+
+// SetAlertRuleExpression changes the expression of the rule with the given
+// name. It reports whether the rule exists.
+func (r *AlertRuleRepository) SetAlertRuleExpression(ctx context.Context, name, expression string) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.set_alert_rule_expression")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.String("rule.name", name),
+	)
+
+	result, err := r.conn.ExecContext(ctx, `
+		UPDATE alert_rules SET expression = $2, updated_at = NOW()
+		WHERE name = $1`,
+		name, expression,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to set alert rule expression: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// DeleteAlertRule deletes an alert rule and its state and resolves the
+// alerts it fired. It reports whether the rule existed.
+func (r *AlertRuleRepository) DeleteAlertRule(ctx context.Context, id int64) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.delete_alert_rule")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rules"),
+		attribute.Int64("rule.id", id),
+	)
+
+	var deleted int64
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE alerts SET resolved_at = NOW(), updated_at = NOW()
+			WHERE rule_id = $1 AND resolved_at IS NULL`,
+			id,
+		); err != nil {
+			return fmt.Errorf("failed to resolve alerts: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM alert_rules WHERE id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete alert rule: %w", err)
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// RuleStateRecord represents an alert_rule_states row: an alert rule's
+// state for one series. AlertID is the firing alert.
+type RuleStateRecord struct {
+	RuleID        int64
+	ClientID      string
+	Target        string
+	AddressFamily string
+	CheckType     string
+	ActiveSince   *time.Time
+	LastWindowTs  time.Time
+	Firing        bool
+	AlertID       *int64
+
+	// AlertSilenceID is the silence of the firing alert, if it was silenced
+	AlertSilenceID *int64
+}
+
+// GetRuleState fetches a rule's state for a series, or nil if the rule
+// neither holds nor fires for it
+func (r *AlertRuleRepository) GetRuleState(ctx context.Context, ruleID int64, clientID, target, addressFamily, checkType string) (*RuleStateRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_rule_state")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rule_states"),
+		attribute.Int64("rule.id", ruleID),
+		attribute.String("client.id", clientID),
+		attribute.String("target", target),
+	)
+
+	state := RuleStateRecord{
+		RuleID:        ruleID,
+		ClientID:      clientID,
+		Target:        target,
+		AddressFamily: addressFamily,
+		CheckType:     checkType,
+	}
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT s.active_since, s.last_window_ts, s.firing, s.alert_id, a.silence_id
+		FROM alert_rule_states s
+		LEFT JOIN alerts a ON a.id = s.alert_id
+		WHERE s.rule_id = $1 AND s.client_id = $2 AND s.target = $3 AND s.address_family = $4 AND s.check_type = $5`,
+		ruleID, clientID, target, addressFamily, checkType,
+	).Scan(&state.ActiveSince, &state.LastWindowTs, &state.Firing, &state.AlertID, &state.AlertSilenceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get rule state: %w", err)
+	}
+	return &state, nil
+}
+
+// RuleAlertRecord represents an alert fired by an alert rule for a series.
+// StartedAt is the first window of the run the rule held for.
+type RuleAlertRecord struct {
+	ID         int64      `json:"id"`
+	RuleID     int64      `json:"rule_id"`
+	RuleName   string     `json:"rule_name"`
+	ClientID   string     `json:"client_id"`
+	Target     string     `json:"target"`
+	Severity   string     `json:"severity"`
+	Message    string     `json:"message"`
+	StartedAt  time.Time  `json:"started_at"`
+	SilenceID  *int64     `json:"silence_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// SaveRuleState stores a rule's state for a series in place of the state
+// loaded at previousWindowTs, or nil if there was none. An inactive state
+// (neither holding nor firing) is deleted. fire, if set, is inserted as the
+// state's alert; resolve resolves the alert the state fired before.
+//
+// SaveRuleState reports false, and saves nothing, if the stored state
+// changed since it was loaded, e.g. because another instance applied a
+// window of the series first.
+func (r *AlertRuleRepository) SaveRuleState(ctx context.Context, state *RuleStateRecord, previousWindowTs *time.Time, fire *RuleAlertRecord, resolve bool) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.save_rule_state")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_rule_states"),
+		attribute.Int64("rule.id", state.RuleID),
+		attribute.String("client.id", state.ClientID),
+		attribute.String("target", state.Target),
+		attribute.Bool("fire", fire != nil),
+		attribute.Bool("resolve", resolve),
+	)
+
+	errStale := errors.New("rule state changed")
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if resolve && state.AlertID != nil {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE alerts SET resolved_at = NOW(), updated_at = NOW()
+				WHERE id = $1 AND resolved_at IS NULL`,
+				*state.AlertID,
+			); err != nil {
+				return fmt.Errorf("failed to resolve alert: %w", err)
+			}
+			state.AlertID = nil
+		}
+		if fire != nil {
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO alerts (
+					client_id, target, alert_type, severity, message, window_start_ts, rule_id, silence_id
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id, created_at`,
+				fire.ClientID, fire.Target, RuleAlertType, fire.Severity, fire.Message, fire.StartedAt, fire.RuleID,
+				fire.SilenceID,
+			).Scan(&fire.ID, &fire.CreatedAt); err != nil {
+				return fmt.Errorf("failed to insert alert: %w", err)
+			}
+			state.AlertID = &fire.ID
+		}
+
+		var result sql.Result
+		var err error
+		key := []interface{}{state.RuleID, state.ClientID, state.Target, state.AddressFamily, state.CheckType}
+		switch {
+		case previousWindowTs == nil:
+			result, err = tx.ExecContext(ctx, `
+				INSERT INTO alert_rule_states (
+					rule_id, client_id, target, address_family, check_type,
+					active_since, last_window_ts, firing, alert_id, updated_at
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+				ON CONFLICT DO NOTHING`,
+				append(key, state.ActiveSince, state.LastWindowTs, state.Firing, state.AlertID)...,
+			)
+		case state.ActiveSince == nil && !state.Firing:
+			result, err = tx.ExecContext(ctx, `
+				DELETE FROM alert_rule_states
+				WHERE rule_id = $1 AND client_id = $2 AND target = $3 AND address_family = $4 AND check_type = $5
+					AND last_window_ts = $6`,
+				append(key, *previousWindowTs)...,
+			)
+		default:
+			result, err = tx.ExecContext(ctx, `
+				UPDATE alert_rule_states SET
+					active_since = $6,
+					last_window_ts = $7,
+					firing = $8,
+					alert_id = $9,
+					updated_at = NOW()
+				WHERE rule_id = $1 AND client_id = $2 AND target = $3 AND address_family = $4 AND check_type = $5
+					AND last_window_ts = $10`,
+				append(key, state.ActiveSince, state.LastWindowTs, state.Firing, state.AlertID, *previousWindowTs)...,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save rule state: %w", err)
+		}
+		saved, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if saved == 0 {
+			return errStale
+		}
+		return nil
+	})
+	if errors.Is(err, errStale) {
+		return false, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// ListRuleAlerts returns the alerts fired by alert rules since a time, newest
+// first, optionally only those of one rule (ruleID > 0) or only unresolved
+// ones
+func (r *AlertRuleRepository) ListRuleAlerts(ctx context.Context, ruleID int64, unresolvedOnly bool, since time.Time, limit int) ([]RuleAlertRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_rule_alerts")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alerts"),
+		attribute.Int64("rule.id", ruleID),
+		attribute.Int("limit", limit),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT a.id, COALESCE(a.rule_id, 0), COALESCE(ar.name, ''), a.client_id, a.target,
+			a.severity, a.message, a.window_start_ts, a.silence_id, a.created_at, a.resolved_at
+		FROM alerts a
+		LEFT JOIN alert_rules ar ON ar.id = a.rule_id
+		WHERE a.alert_type = $1 AND a.created_at >= $2
+			AND ($3 = 0 OR a.rule_id = $3)
+			AND (a.resolved_at IS NULL OR NOT $4)
+		ORDER BY a.created_at DESC
+		LIMIT $5`,
+		RuleAlertType, since, ruleID, unresolvedOnly, limit,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list rule alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []RuleAlertRecord
+	for rows.Next() {
+		var a RuleAlertRecord
+		if err := rows.Scan(&a.ID, &a.RuleID, &a.RuleName, &a.ClientID, &a.Target,
+			&a.Severity, &a.Message, &a.StartedAt, &a.SilenceID, &a.CreatedAt, &a.ResolvedAt); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan rule alert: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating rule alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// NotificationRepository provides operations for notification channels and
+// the delivery of alerts to them
+type NotificationRepository struct {
+	*Repository
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(conn *Connection) *NotificationRepository {
+	return &NotificationRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// ErrNotificationChannelExists is returned when a notification channel's name
+// is taken
+var ErrNotificationChannelExists = errors.New("notification channel already exists")
+
+// Alert delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// NotificationChannelRecord represents a notification_channels row. Config
+// holds the JSON-encoded configuration of the channel type.
+type NotificationChannelRecord struct {
+	ID            int64
+	Name          string
+	Type          string
+	Config        json.RawMessage
+	TitleTemplate string
+	BodyTemplate  string
+	Enabled       bool
+	CreatedBy     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// notificationChannelColumns is the column list scanned by
+// scanNotificationChannel
+const notificationChannelColumns = `
+	id, name, channel_type, config, title_template, body_template, enabled,
+	COALESCE(created_by, ''), created_at, updated_at`
+
+func scanNotificationChannel(row rowScanner) (*NotificationChannelRecord, error) {
+	var ch NotificationChannelRecord
+	err := row.Scan(
+		&ch.ID, &ch.Name, &ch.Type, &ch.Config, &ch.TitleTemplate, &ch.BodyTemplate, &ch.Enabled,
+		&ch.CreatedBy, &ch.CreatedAt, &ch.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// ListNotificationChannels returns the notification channels by name, or
+// only the enabled ones
+func (r *NotificationRepository) ListNotificationChannels(ctx context.Context, enabledOnly bool) ([]NotificationChannelRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_notification_channels")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "notification_channels"),
+		attribute.Bool("enabled_only", enabledOnly),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `SELECT `+notificationChannelColumns+`
+		FROM notification_channels
+		WHERE enabled OR NOT $1
+		ORDER BY name`,
+		enabledOnly,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []NotificationChannelRecord
+	for rows.Next() {
+		ch, err := scanNotificationChannel(rows)
+		if err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+		}
+		channels = append(channels, *ch)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating notification channels: %w", err)
+	}
+	return channels, nil
+}
+
+// GetNotificationChannel fetches a notification channel by name, or nil if
+// it does not exist
+func (r *NotificationRepository) GetNotificationChannel(ctx context.Context, name string) (*NotificationChannelRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_notification_channel")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "notification_channels"),
+		attribute.String("channel.name", name),
+	)
+
+	ch, err := scanNotificationChannel(r.conn.QueryRowContext(ctx, `SELECT `+notificationChannelColumns+`
+		FROM notification_channels
+		WHERE name = $1`,
+		name,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get notification channel: %w", err)
+	}
+	return ch, nil
+}
+
+// CreateNotificationChannel inserts a notification channel and sets its ID
+// and timestamps. It returns ErrNotificationChannelExists if the name is
+// taken.
+func (r *NotificationRepository) CreateNotificationChannel(ctx context.Context, ch *NotificationChannelRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.create_notification_channel")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "notification_channels"),
+		attribute.String("channel.name", ch.Name),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO notification_channels (
+			name, channel_type, config, title_template, body_template, enabled, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING id, created_at, updated_at`,
+		ch.Name, ch.Type, ch.Config, ch.TitleTemplate, ch.BodyTemplate, ch.Enabled, ch.CreatedBy,
+	).Scan(&ch.ID, &ch.CreatedAt, &ch.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrNotificationChannelExists
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to create notification channel: %w", err)
+	}
+	return nil
+}
+
+// UpdateNotificationChannel replaces the definition of the channel with
+// ch.Name. It reports whether the channel exists.
+func (r *NotificationRepository) UpdateNotificationChannel(ctx context.Context, ch *NotificationChannelRecord) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.update_notification_channel")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "notification_channels"),
+		attribute.String("channel.name", ch.Name),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		UPDATE notification_channels SET
+			channel_type = $2,
+			config = $3,
+			title_template = $4,
+			body_template = $5,
+			enabled = $6,
+			updated_at = NOW()
+		WHERE name = $1
+		RETURNING id, COALESCE(created_by, ''), created_at, updated_at`,
+		ch.Name, ch.Type, ch.Config, ch.TitleTemplate, ch.BodyTemplate, ch.Enabled,
+	).Scan(&ch.ID, &ch.CreatedBy, &ch.CreatedAt, &ch.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to update notification channel: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteNotificationChannel deletes a notification channel. It reports
+// whether the channel existed.
+func (r *NotificationRepository) DeleteNotificationChannel(ctx context.Context, name string) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.delete_notification_channel")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "notification_channels"),
+		attribute.String("channel.name", name),
+	)
+
+	result, err := r.conn.ExecContext(ctx, "DELETE FROM notification_channels WHERE name = $1", name)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to delete notification channel: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// DeliveryRecord represents an alert_deliveries row: the delivery of one
+// alert event to one channel
+type DeliveryRecord struct {
+	ID          int64      `json:"id"`
+	AlertID     int64      `json:"alert_id"`
+	Channel     string     `json:"channel"`
+	Event       string     `json:"event"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// CreateDelivery inserts a delivery and sets its ID and timestamps
+func (r *NotificationRepository) CreateDelivery(ctx context.Context, d *DeliveryRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.create_delivery")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_deliveries"),
+		attribute.Int64("alert.id", d.AlertID),
+		attribute.String("channel.name", d.Channel),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO alert_deliveries (alert_id, channel, event, status, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id, created_at, updated_at`,
+		d.AlertID, d.Channel, d.Event, d.Status, d.Attempts, d.LastError,
+	).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to create delivery: %w", err)
+	}
+	return nil
+}
+
+// UpdateDelivery stores a delivery's status, attempts and last error, and
+// sets delivered_at once it is sent
+func (r *NotificationRepository) UpdateDelivery(ctx context.Context, d *DeliveryRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.update_delivery")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_deliveries"),
+		attribute.Int64("delivery.id", d.ID),
+		attribute.String("delivery.status", d.Status),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		UPDATE alert_deliveries SET
+			status = $2,
+			attempts = $3,
+			last_error = NULLIF($4, ''),
+			delivered_at = CASE WHEN $2 = $5 THEN NOW() ELSE delivered_at END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at, delivered_at`,
+		d.ID, d.Status, d.Attempts, d.LastError, DeliverySent,
+	).Scan(&d.UpdatedAt, &d.DeliveredAt)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the deliveries of an alert, oldest first
+func (r *NotificationRepository) ListDeliveries(ctx context.Context, alertID int64) ([]DeliveryRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_deliveries")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "alert_deliveries"),
+		attribute.Int64("alert.id", alertID),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT id, alert_id, channel, event, status, attempts, COALESCE(last_error, ''),
+			created_at, updated_at, delivered_at
+		FROM alert_deliveries
+		WHERE alert_id = $1
+		ORDER BY created_at, id`,
+		alertID,
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []DeliveryRecord
+	for rows.Next() {
+		var d DeliveryRecord
+		if err := rows.Scan(&d.ID, &d.AlertID, &d.Channel, &d.Event, &d.Status, &d.Attempts, &d.LastError,
+			&d.CreatedAt, &d.UpdatedAt, &d.DeliveredAt); err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// SilenceRepository provides operations for silences and maintenance
+// windows
+type SilenceRepository struct {
+	*Repository
+}
+
+// NewSilenceRepository creates a new silence repository
+func NewSilenceRepository(conn *Connection) *SilenceRepository {
+	return &SilenceRepository{
+		Repository: NewRepository(conn),
+	}
+}
+
+// SilenceRecord represents a silences row. Matchers and Schedule hold the
+// JSON-encoded matchers and recurring schedule; Schedule and EndsAt are nil
+// for one-off and open-ended silences respectively.
+type SilenceRecord struct {
+	ID        int64
+	Name      string
+	Comment   string
+	Kind      string
+	Matchers  json.RawMessage
+	StartsAt  time.Time
+	EndsAt    *time.Time
+	Schedule  json.RawMessage
+	CreatedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// silenceColumns is the column list scanned by scanSilence
+const silenceColumns = `
+	id, name, comment, kind, matchers, starts_at, ends_at, schedule,
+	COALESCE(created_by, ''), created_at, updated_at`
+
+func scanSilence(row rowScanner) (*SilenceRecord, error) {
+	var s SilenceRecord
+	err := row.Scan(
+		&s.ID, &s.Name, &s.Comment, &s.Kind, &s.Matchers, &s.StartsAt, &s.EndsAt, &s.Schedule,
+		&s.CreatedBy, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListSilences returns the silences by start time, newest first. With
+// unexpiredOnly, silences that ended before now are left out.
+func (r *SilenceRepository) ListSilences(ctx context.Context, unexpiredOnly bool) ([]SilenceRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.list_silences")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "silences"),
+		attribute.Bool("unexpired_only", unexpiredOnly),
+	)
+
+	rows, err := r.conn.QueryContext(ctx, `SELECT `+silenceColumns+`
+		FROM silences
+		WHERE NOT $1 OR ends_at IS NULL OR ends_at > $2
+		ORDER BY starts_at DESC, id DESC`,
+		unexpiredOnly, time.Now().UTC(),
+	)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to list silences: %w", err)
+	}
+	defer rows.Close()
+
+	var silences []SilenceRecord
+	for rows.Next() {
+		s, err := scanSilence(rows)
+		if err != nil {
+			tracing.RecordError(ctx, err)
+			return nil, fmt.Errorf("failed to scan silence: %w", err)
+		}
+		silences = append(silences, *s)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("error iterating silences: %w", err)
+	}
+	return silences, nil
+}
+
+// GetSilence fetches a silence by ID, or nil if it does not exist
+func (r *SilenceRepository) GetSilence(ctx context.Context, id int64) (*SilenceRecord, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.get_silence")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "silences"),
+		attribute.Int64("silence.id", id),
+	)
+
+	s, err := scanSilence(r.conn.QueryRowContext(ctx, `SELECT `+silenceColumns+`
+		FROM silences
+		WHERE id = $1`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, fmt.Errorf("failed to get silence: %w", err)
+	}
+	return s, nil
+}
+
+// nullJSON returns nil for an empty JSON value, so it is stored as NULL
+func nullJSON(value json.RawMessage) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return []byte(value)
+}
+
+// CreateSilence inserts a silence and sets its ID and timestamps
+func (r *SilenceRepository) CreateSilence(ctx context.Context, s *SilenceRecord) error {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.create_silence")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "silences"),
+		attribute.String("silence.name", s.Name),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		INSERT INTO silences (
+			name, comment, kind, matchers, starts_at, ends_at, schedule, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+		RETURNING id, created_at, updated_at`,
+		s.Name, s.Comment, s.Kind, []byte(s.Matchers), s.StartsAt, s.EndsAt, nullJSON(s.Schedule), s.CreatedBy,
+	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return fmt.Errorf("failed to create silence: %w", err)
+	}
+	return nil
+}
+
+// UpdateSilence replaces a silence's definition. It reports whether the
+// silence exists.
+func (r *SilenceRepository) UpdateSilence(ctx context.Context, s *SilenceRecord) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.update_silence")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "silences"),
+		attribute.Int64("silence.id", s.ID),
+	)
+
+	err := r.conn.QueryRowContext(ctx, `
+		UPDATE silences SET
+			name = $2,
+			comment = $3,
+			kind = $4,
+			matchers = $5,
+			starts_at = $6,
+			ends_at = $7,
+			schedule = $8,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING COALESCE(created_by, ''), created_at, updated_at`,
+		s.ID, s.Name, s.Comment, s.Kind, []byte(s.Matchers), s.StartsAt, s.EndsAt, nullJSON(s.Schedule),
+	).Scan(&s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to update silence: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteSilence deletes a silence; alerts recorded with it are kept. It
+// reports whether the silence existed.
+func (r *SilenceRepository) DeleteSilence(ctx context.Context, id int64) (bool, error) {
+	tracer := tracing.GetTracer("database")
+	ctx, span := tracer.Start(ctx, "db.delete_silence")
+	defer span.End()
+	tracing.AddSpanAttributes(ctx,
+		attribute.String("db.table", "silences"),
+		attribute.Int64("silence.id", id),
+	)
+
+	result, err := r.conn.ExecContext(ctx, "DELETE FROM silences WHERE id = $1", id)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return false, fmt.Errorf("failed to delete silence: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted > 0, nil
+}
@@ -0,0 +1,439 @@
+package diagnosis
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// BaselineStrategy selects how a target's baseline is maintained
+type BaselineStrategy string
+
+const (
+	// BaselineMean averages the most recent windows (the default)
+	BaselineMean BaselineStrategy = "mean"
+
+	// BaselineEWMA keeps an exponentially weighted moving average and
+	// variance, so slow drift is followed gradually
+	BaselineEWMA BaselineStrategy = "ewma"
+
+	// BaselineHourOfWeek compares a window with the same hour of the week in
+	// previous weeks, so recurring peaks are not reported as anomalies
+	BaselineHourOfWeek BaselineStrategy = "hour_of_week"
+
+	// BaselineRobust uses the median and median absolute deviation of the
+	// most recent windows, which outliers barely move
+	BaselineRobust BaselineStrategy = "robust"
+)
+
+// BaselineStrategies lists the supported strategies
+var BaselineStrategies = []BaselineStrategy{BaselineMean, BaselineEWMA, BaselineHourOfWeek, BaselineRobust}
+
+// ValidBaselineStrategy reports whether s is a supported strategy
+func ValidBaselineStrategy(s string) bool {
+	for _, strategy := range BaselineStrategies {
+		if string(strategy) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HoursPerWeek is the number of hour-of-week buckets
+const HoursPerWeek = 7 * 24
+
+// HourOfWeek returns the hour-of-week bucket of t (0 is Monday 00:00 UTC)
+func HourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return ((int(t.Weekday())+6)%7)*24 + t.Hour()
+}
+
+// BaselineConfig holds the parameters shared by all baselines
+type BaselineConfig struct {
+	// Windows is how many recent windows the mean and robust strategies keep
+	Windows int
+
+	// MinWindows is how many windows a baseline needs before it is used
+	MinWindows int
+
+	// Alpha is the EWMA smoothing factor (0 < Alpha <= 1)
+	Alpha float64
+
+	// Weeks is how many previous weeks the hour-of-week strategy keeps
+	Weeks int
+}
+
+// DefaultBaselineConfig returns the default baseline parameters
+func DefaultBaselineConfig() BaselineConfig {
+	return BaselineConfig{
+		Windows:    30,
+		MinWindows: 3,
+		Alpha:      0.1,
+		Weeks:      4,
+	}
+}
+
+// maxSkippedWindows bounds how many consecutive anomalous windows are kept
+// out of a baseline. After that the change is accepted as the new normal.
+const maxSkippedWindows = 60
+
+// minSuccessForBaseline is the number of successful measurements a window
+// needs to be folded into a baseline, matching Diagnose
+const minSuccessForBaseline = 5
+
+// Metrics tracked by baselines, in BaselineState slices
+const (
+	metricDNS = iota
+	metricTCP
+	metricTLS
+	metricTTFB
+	metricTotal
+	metricThroughput
+	metricDNSErrorRate
+	metricTCPErrorRate
+	metricTLSErrorRate
+	metricHTTPErrorRate
+	numMetrics
+)
+
+// madScale converts a median absolute deviation to a standard deviation
+// estimate for normally distributed data
+const madScale = 1.4826
+
+// p90Sigmas is how many standard deviations the 90th percentile lies above
+// the median of a normal distribution
+const p90Sigmas = 1.2816
+
+// BaselineState is the persisted state of one baseline. It is updated with
+// each window rather than recomputed from stored aggregates. Which fields
+// are used depends on the strategy.
+type BaselineState struct {
+	Strategy BaselineStrategy `json:"strategy"`
+
+	// Windows is the number of windows folded in
+	Windows int `json:"windows"`
+
+	// LastWindowTs is the most recent window folded in; older windows (late
+	// or re-diagnosed ones) are not folded in again
+	LastWindowTs time.Time `json:"last_window_ts"`
+
+	// Skipped counts consecutive anomalous windows left out
+	Skipped int `json:"skipped,omitempty"`
+
+	// Recent holds the most recent values of each metric, oldest first
+	// (mean and robust)
+	Recent [][]float64 `json:"recent,omitempty"`
+
+	// Mean and Var are the exponentially weighted mean and variance of each
+	// metric (ewma)
+	Mean []float64 `json:"mean,omitempty"`
+	Var  []float64 `json:"var,omitempty"`
+
+	// Weeks summarizes this hour of the week in previous weeks, oldest
+	// first; Current collects the values of the hour in progress
+	// (hour_of_week)
+	Weeks        []HourSummary `json:"weeks,omitempty"`
+	CurrentStart time.Time     `json:"current_start,omitempty"`
+	Current      [][]float64   `json:"current,omitempty"`
+}
+
+// HourSummary is the median and 90th percentile of each metric over one
+// hour of one week
+type HourSummary struct {
+	Start   time.Time `json:"start"`
+	Windows int       `json:"windows"`
+	Median  []float64 `json:"median"`
+	P90     []float64 `json:"p90"`
+}
+
+// NewBaselineState creates an empty baseline for strategy
+func NewBaselineState(strategy BaselineStrategy) *BaselineState {
+	return &BaselineState{Strategy: strategy}
+}
+
+// Update folds a window into the baseline and reports whether it did.
+// Windows with too little data, and windows not newer than the last one
+// folded in, are ignored. Anomalous windows are left out so an ongoing issue
+// does not become the baseline, unless they persist for maxSkippedWindows.
+func (s *BaselineState) Update(w WindowMetrics, anomalous bool, cfg BaselineConfig) bool {
+	if w.CountSuccess < minSuccessForBaseline {
+		return false
+	}
+	if !s.LastWindowTs.IsZero() && !w.WindowStartTs.After(s.LastWindowTs) {
+		return false
+	}
+	if anomalous && s.Skipped < maxSkippedWindows {
+		s.Skipped++
+		return false
+	}
+	s.upgrade()
+
+	values := metricValues(w)
+	switch s.Strategy {
+	case BaselineEWMA:
+		s.updateEWMA(values, cfg.Alpha)
+	case BaselineHourOfWeek:
+		s.updateHourOfWeek(w.WindowStartTs, values, cfg.Weeks)
+	default:
+		s.updateRecent(values, cfg.Windows)
+	}
+
+	s.Windows++
+	s.LastWindowTs = w.WindowStartTs
+	s.Skipped = 0
+	return true
+}
+
+func (s *BaselineState) updateRecent(values [numMetrics]float64, limit int) {
+	if len(s.Recent) != numMetrics {
+		s.Recent = make([][]float64, numMetrics)
+	}
+	for m, v := range values {
+		s.Recent[m] = append(s.Recent[m], v)
+		if limit > 0 && len(s.Recent[m]) > limit {
+			s.Recent[m] = s.Recent[m][len(s.Recent[m])-limit:]
+		}
+	}
+}
+
+func (s *BaselineState) updateEWMA(values [numMetrics]float64, alpha float64) {
+	if len(s.Mean) != numMetrics || len(s.Var) != numMetrics {
+		s.Mean = values[:]
+		s.Var = make([]float64, numMetrics)
+		return
+	}
+	for m, v := range values {
+		diff := v - s.Mean[m]
+		s.Mean[m] += alpha * diff
+		s.Var[m] = (1 - alpha) * (s.Var[m] + alpha*diff*diff)
+	}
+}
+
+func (s *BaselineState) updateHourOfWeek(ts time.Time, values [numMetrics]float64, weeks int) {
+	hourStart := ts.UTC().Truncate(time.Hour)
+	if !s.CurrentStart.Equal(hourStart) {
+		s.closeHour(weeks)
+		s.CurrentStart = hourStart
+		s.Current = make([][]float64, numMetrics)
+	}
+	for m, v := range values {
+		s.Current[m] = append(s.Current[m], v)
+	}
+}
+
+// closeHour summarizes the hour in progress into Weeks
+func (s *BaselineState) closeHour(weeks int) {
+	if summary := s.currentSummary(); summary != nil {
+		s.Weeks = lastWeeks(append(s.Weeks, *summary), weeks)
+	}
+	s.Current = nil
+}
+
+// currentSummary summarizes the hour in progress, or returns nil if it has
+// no windows
+func (s *BaselineState) currentSummary() *HourSummary {
+	if len(s.Current) != numMetrics || len(s.Current[0]) == 0 {
+		return nil
+	}
+	summary := &HourSummary{
+		Start:   s.CurrentStart,
+		Windows: len(s.Current[0]),
+		Median:  make([]float64, numMetrics),
+		P90:     make([]float64, numMetrics),
+	}
+	for m := range s.Current {
+		summary.Median[m] = percentile(s.Current[m], 0.50)
+		summary.P90[m] = percentile(s.Current[m], 0.90)
+	}
+	return summary
+}
+
+// lastWeeks keeps the most recent weeks summaries, all of them if weeks is 0
+func lastWeeks(summaries []HourSummary, weeks int) []HourSummary {
+	if weeks > 0 && len(summaries) > weeks {
+		return summaries[len(summaries)-weeks:]
+	}
+	return summaries
+}
+
+// Baseline returns the baseline for a window starting at 'at', or nil if
+// there is not enough history yet
+func (s *BaselineState) Baseline(cfg BaselineConfig, at time.Time) *Baseline {
+	var avg, stddev [numMetrics]float64
+	var count int
+	s.upgrade()
+
+	switch s.Strategy {
+	case BaselineEWMA:
+		if s.Windows < cfg.MinWindows || len(s.Mean) != numMetrics || len(s.Var) != numMetrics {
+			return nil
+		}
+		for m := 0; m < numMetrics; m++ {
+			avg[m] = s.Mean[m]
+			stddev[m] = math.Sqrt(s.Var[m])
+		}
+		count = s.Windows
+
+	case BaselineHourOfWeek:
+		// Only completed hours of previous weeks count, and only those of
+		// the same hour of the week as 'at'. The hour last updated is only
+		// closed by the next update, which comes after this baseline is
+		// read, so it counts once 'at' is past it.
+		summaries := s.Weeks
+		if summary := s.currentSummary(); summary != nil && summary.Start.Before(at.UTC().Truncate(time.Hour)) {
+			summaries = lastWeeks(append(slices.Clip(s.Weeks), *summary), cfg.Weeks)
+		}
+		var weeks []HourSummary
+		for _, w := range summaries {
+			if HourOfWeek(w.Start) == HourOfWeek(at) && w.Start.Before(at.UTC().Truncate(time.Hour)) {
+				weeks = append(weeks, w)
+			}
+		}
+		if len(weeks) == 0 {
+			return nil
+		}
+		for m := 0; m < numMetrics; m++ {
+			medians := make([]float64, len(weeks))
+			spreads := make([]float64, len(weeks))
+			for i, w := range weeks {
+				medians[i] = w.Median[m]
+				spreads[i] = (w.P90[m] - w.Median[m]) / p90Sigmas
+			}
+			avg[m] = percentile(medians, 0.50)
+			stddev[m] = percentile(spreads, 0.50)
+		}
+		for _, w := range weeks {
+			count += w.Windows
+		}
+
+	case BaselineRobust:
+		if len(s.Recent) != numMetrics || len(s.Recent[0]) < cfg.MinWindows {
+			return nil
+		}
+		for m := 0; m < numMetrics; m++ {
+			median := percentile(s.Recent[m], 0.50)
+			deviations := make([]float64, len(s.Recent[m]))
+			for i, v := range s.Recent[m] {
+				deviations[i] = math.Abs(v - median)
+			}
+			avg[m] = median
+			stddev[m] = madScale * percentile(deviations, 0.50)
+		}
+		count = len(s.Recent[0])
+
+	default:
+		if len(s.Recent) != numMetrics || len(s.Recent[0]) < cfg.MinWindows {
+			return nil
+		}
+		for m := 0; m < numMetrics; m++ {
+			avg[m], stddev[m] = meanStdDev(s.Recent[m])
+		}
+		count = len(s.Recent[0])
+	}
+
+	return &Baseline{
+		DNSP95Avg:             avg[metricDNS],
+		TCPP95Avg:             avg[metricTCP],
+		TLSP95Avg:             avg[metricTLS],
+		TTFBP95Avg:            avg[metricTTFB],
+		TotalLatencyP95Avg:    avg[metricTotal],
+		ThroughputP50Avg:      avg[metricThroughput],
+		DNSP95StdDev:          stddev[metricDNS],
+		TCPP95StdDev:          stddev[metricTCP],
+		TLSP95StdDev:          stddev[metricTLS],
+		TTFBP95StdDev:         stddev[metricTTFB],
+		TotalLatencyP95StdDev: stddev[metricTotal],
+		ThroughputP50StdDev:   stddev[metricThroughput],
+		DNSErrorRateAvg:       avg[metricDNSErrorRate],
+		TCPErrorRateAvg:       avg[metricTCPErrorRate],
+		TLSErrorRateAvg:       avg[metricTLSErrorRate],
+		HTTPErrorRateAvg:      avg[metricHTTPErrorRate],
+		DNSErrorRateStdDev:    stddev[metricDNSErrorRate],
+		TCPErrorRateStdDev:    stddev[metricTCPErrorRate],
+		TLSErrorRateStdDev:    stddev[metricTLSErrorRate],
+		HTTPErrorRateStdDev:   stddev[metricHTTPErrorRate],
+		WindowCount:           count,
+		Strategy:              s.Strategy,
+	}
+}
+
+// upgrade extends a state saved with fewer metrics, e.g. before error rates
+// were tracked, with zeros for the missing ones
+func (s *BaselineState) upgrade() {
+	s.Recent = padSeries(s.Recent)
+	s.Current = padSeries(s.Current)
+	s.Mean = padValues(s.Mean)
+	s.Var = padValues(s.Var)
+	for i := range s.Weeks {
+		s.Weeks[i].Median = padValues(s.Weeks[i].Median)
+		s.Weeks[i].P90 = padValues(s.Weeks[i].P90)
+	}
+}
+
+func padSeries(series [][]float64) [][]float64 {
+	if len(series) == 0 || len(series) >= numMetrics {
+		return series
+	}
+	for len(series) < numMetrics {
+		series = append(series, make([]float64, len(series[0])))
+	}
+	return series
+}
+
+func padValues(values []float64) []float64 {
+	if len(values) == 0 || len(values) >= numMetrics {
+		return values
+	}
+	return append(values, make([]float64, numMetrics-len(values))...)
+}
+
+func metricValues(w WindowMetrics) [numMetrics]float64 {
+	return [numMetrics]float64{
+		metricDNS:        w.DNSP95,
+		metricTCP:        w.TCPP95,
+		metricTLS:        w.TLSP95,
+		metricTTFB:       w.TTFBP95,
+		metricTotal:      w.TotalLatencyP95,
+		metricThroughput: w.ThroughputP50,
+
+		metricDNSErrorRate:  w.errorRate(w.DNSErrors),
+		metricTCPErrorRate:  w.errorRate(w.TCPErrors),
+		metricTLSErrorRate:  w.errorRate(w.TLSErrors),
+		metricHTTPErrorRate: w.errorRate(w.HTTPErrors),
+	}
+}
+
+// percentile returns the p-th percentile of values using linear
+// interpolation between closest ranks
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
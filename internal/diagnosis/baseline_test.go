@@ -0,0 +1,365 @@
+package diagnosis
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func window(ts time.Time, ttfb float64) WindowMetrics {
+	return WindowMetrics{
+		WindowStartTs:   ts,
+		DNSP95:          10,
+		TCPP95:          20,
+		TLSP95:          30,
+		TTFBP95:         ttfb,
+		TotalLatencyP95: 60 + ttfb,
+		ThroughputP50:   1000,
+		CountSuccess:    10,
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestValidBaselineStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		valid    bool
+	}{
+		{"mean", true},
+		{"ewma", true},
+		{"hour_of_week", true},
+		{"robust", true},
+		{"", false},
+		{"median", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidBaselineStrategy(tt.strategy); got != tt.valid {
+			t.Errorf("ValidBaselineStrategy(%q) = %v, expected %v", tt.strategy, got, tt.valid)
+		}
+	}
+}
+
+func TestHourOfWeek(t *testing.T) {
+	tests := []struct {
+		name     string
+		ts       time.Time
+		expected int
+	}{
+		{"monday midnight", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{"monday 9am", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), 9},
+		{"sunday 11pm", time.Date(2024, 1, 7, 23, 59, 0, 0, time.UTC), 167},
+		{"non-UTC zone", time.Date(2024, 1, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600)), 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HourOfWeek(tt.ts); got != tt.expected {
+				t.Errorf("HourOfWeek() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBaselineStateMean(t *testing.T) {
+	cfg := BaselineConfig{Windows: 3, MinWindows: 2, Alpha: 0.1, Weeks: 4}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	state := NewBaselineState(BaselineMean)
+
+	state.Update(window(start, 100), false, cfg)
+	if b := state.Baseline(cfg, start.Add(time.Minute)); b != nil {
+		t.Fatalf("Expected nil baseline below MinWindows, got %+v", b)
+	}
+
+	for i, ttfb := range []float64{200, 300, 400} {
+		state.Update(window(start.Add(time.Duration(i+1)*time.Minute), ttfb), false, cfg)
+	}
+
+	b := state.Baseline(cfg, start.Add(5*time.Minute))
+	if b == nil {
+		t.Fatalf("Expected baseline, got nil")
+	}
+	// Only the last 3 windows are kept
+	if b.WindowCount != 3 || !approxEqual(b.TTFBP95Avg, 300) {
+		t.Errorf("Expected 3 windows averaging 300, got %d averaging %.2f", b.WindowCount, b.TTFBP95Avg)
+	}
+	if !approxEqual(b.TTFBP95StdDev, math.Sqrt(20000.0/3)) {
+		t.Errorf("TTFBP95StdDev: got %.4f", b.TTFBP95StdDev)
+	}
+	if b.Strategy != BaselineMean {
+		t.Errorf("Strategy: expected %s, got %s", BaselineMean, b.Strategy)
+	}
+}
+
+func TestBaselineStateUpdateSkips(t *testing.T) {
+	cfg := DefaultBaselineConfig()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		prepare   func(s *BaselineState)
+		window    WindowMetrics
+		anomalous bool
+		folded    bool
+	}{
+		{
+			name:   "healthy window",
+			window: window(start, 100),
+			folded: true,
+		},
+		{
+			name: "too few successes",
+			window: func() WindowMetrics {
+				w := window(start, 100)
+				w.CountSuccess = 2
+				return w
+			}(),
+			folded: false,
+		},
+		{
+			name: "window already folded in",
+			prepare: func(s *BaselineState) {
+				s.Update(window(start.Add(time.Minute), 100), false, cfg)
+			},
+			window: window(start, 100),
+			folded: false,
+		},
+		{
+			name:      "anomalous window",
+			window:    window(start, 1000),
+			anomalous: true,
+			folded:    false,
+		},
+		{
+			name: "persistent anomaly becomes the new normal",
+			prepare: func(s *BaselineState) {
+				s.Skipped = maxSkippedWindows
+			},
+			window:    window(start, 1000),
+			anomalous: true,
+			folded:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewBaselineState(BaselineMean)
+			if tt.prepare != nil {
+				tt.prepare(state)
+			}
+			if got := state.Update(tt.window, tt.anomalous, cfg); got != tt.folded {
+				t.Errorf("Update() = %v, expected %v", got, tt.folded)
+			}
+		})
+	}
+}
+
+func TestBaselineStateEWMA(t *testing.T) {
+	cfg := BaselineConfig{Windows: 30, MinWindows: 3, Alpha: 0.5, Weeks: 4}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	state := NewBaselineState(BaselineEWMA)
+
+	for i, ttfb := range []float64{100, 200, 100} {
+		state.Update(window(start.Add(time.Duration(i)*time.Minute), ttfb), false, cfg)
+	}
+
+	b := state.Baseline(cfg, start.Add(3*time.Minute))
+	if b == nil {
+		t.Fatalf("Expected baseline, got nil")
+	}
+	// mean: 100 -> 150 -> 125; var: 0 -> 2500 -> 1875
+	if !approxEqual(b.TTFBP95Avg, 125) {
+		t.Errorf("TTFBP95Avg: expected 125, got %.4f", b.TTFBP95Avg)
+	}
+	if !approxEqual(b.TTFBP95StdDev, math.Sqrt(1875)) {
+		t.Errorf("TTFBP95StdDev: expected %.4f, got %.4f", math.Sqrt(1875), b.TTFBP95StdDev)
+	}
+	if !approxEqual(b.DNSP95Avg, 10) || b.DNSP95StdDev != 0 {
+		t.Errorf("Constant DNS: got avg %.4f stddev %.4f", b.DNSP95Avg, b.DNSP95StdDev)
+	}
+
+	// A slow drift is followed gradually
+	for i := 0; i < 20; i++ {
+		state.Update(window(start.Add(time.Duration(i+3)*time.Minute), 150), false, cfg)
+	}
+	b = state.Baseline(cfg, start.Add(30*time.Minute))
+	if !approxEqual(math.Round(b.TTFBP95Avg), 150) {
+		t.Errorf("Expected EWMA to follow drift to 150, got %.4f", b.TTFBP95Avg)
+	}
+}
+
+func TestBaselineStateRobust(t *testing.T) {
+	cfg := BaselineConfig{Windows: 10, MinWindows: 3, Alpha: 0.1, Weeks: 4}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	state := NewBaselineState(BaselineRobust)
+
+	for i, ttfb := range []float64{100, 110, 90, 105, 95, 5000} {
+		state.Update(window(start.Add(time.Duration(i)*time.Minute), ttfb), false, cfg)
+	}
+
+	b := state.Baseline(cfg, start.Add(10*time.Minute))
+	if b == nil {
+		t.Fatalf("Expected baseline, got nil")
+	}
+	// The outlier barely moves the median: values sorted are
+	// 90 95 100 105 110 5000, median 102.5, deviations 12.5 7.5 2.5 2.5 7.5 4897.5
+	if !approxEqual(b.TTFBP95Avg, 102.5) {
+		t.Errorf("TTFBP95Avg: expected 102.5, got %.4f", b.TTFBP95Avg)
+	}
+	if !approxEqual(b.TTFBP95StdDev, madScale*7.5) {
+		t.Errorf("TTFBP95StdDev: expected %.4f, got %.4f", madScale*7.5, b.TTFBP95StdDev)
+	}
+}
+
+func TestBaselineStateHourOfWeek(t *testing.T) {
+	cfg := BaselineConfig{Windows: 30, MinWindows: 3, Alpha: 0.1, Weeks: 2}
+	monday9 := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	state := NewBaselineState(BaselineHourOfWeek)
+
+	// Three weeks of a slow 9 a.m. peak
+	for week := 0; week < 3; week++ {
+		hour := monday9.AddDate(0, 0, 7*week)
+		if b := state.Baseline(cfg, hour); week == 0 && b != nil {
+			t.Fatalf("Expected nil baseline without previous weeks, got %+v", b)
+		}
+		for minute, ttfb := range []float64{400, 500, 600, 500, 500} {
+			state.Update(window(hour.Add(time.Duration(minute)*time.Minute), ttfb+float64(week)*10), false, cfg)
+		}
+	}
+
+	// The hour in progress does not count towards its own baseline
+	thirdWeek := monday9.AddDate(0, 0, 14)
+	b := state.Baseline(cfg, thirdWeek.Add(10*time.Minute))
+	if b == nil {
+		t.Fatalf("Expected baseline, got nil")
+	}
+	// The first two weeks have medians 500 and 510
+	if !approxEqual(b.TTFBP95Avg, 505) || b.WindowCount != 10 {
+		t.Errorf("Expected 10 windows with median 505, got %d with %.4f", b.WindowCount, b.TTFBP95Avg)
+	}
+
+	// A week later the diagnoser reads the baseline before updating it, so
+	// the third week is still the hour in progress but complete; only the
+	// last 2 weeks count
+	b = state.Baseline(cfg, monday9.AddDate(0, 0, 21))
+	if b == nil || !approxEqual(b.TTFBP95Avg, 515) || b.WindowCount != 10 {
+		t.Fatalf("Expected 10 windows with median 515 before the update, got %+v", b)
+	}
+	if len(state.Weeks) != 2 || state.CurrentStart != thirdWeek {
+		t.Errorf("Baseline() changed the state: %d weeks, current hour %s", len(state.Weeks), state.CurrentStart)
+	}
+
+	// Once updated all three weeks are closed; only the last 2 are kept
+	state.Update(window(monday9.AddDate(0, 0, 21), 500), false, cfg)
+	b = state.Baseline(cfg, monday9.AddDate(0, 0, 21))
+	if b == nil || len(state.Weeks) != 2 {
+		t.Fatalf("Expected 2 weeks kept, got %d", len(state.Weeks))
+	}
+	// The last two weeks have medians 510 and 520; spread (p90-p50)/1.2816 is
+	// 60/1.2816 for each week
+	if !approxEqual(b.TTFBP95Avg, 515) {
+		t.Errorf("TTFBP95Avg: expected 515, got %.4f", b.TTFBP95Avg)
+	}
+	if !approxEqual(b.TTFBP95StdDev, 60/p90Sigmas) {
+		t.Errorf("TTFBP95StdDev: expected %.4f, got %.4f", 60/p90Sigmas, b.TTFBP95StdDev)
+	}
+
+	// A different hour of the week has no baseline
+	if b := state.Baseline(cfg, monday9.AddDate(0, 0, 21).Add(time.Hour)); b != nil {
+		t.Errorf("Expected nil baseline for another hour, got %+v", b)
+	}
+}
+
+func TestBaselineStateJSONRoundTrip(t *testing.T) {
+	cfg := DefaultBaselineConfig()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, strategy := range BaselineStrategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			state := NewBaselineState(strategy)
+			for i := 0; i < 5; i++ {
+				state.Update(window(start.AddDate(0, 0, 7*i).Add(time.Duration(i)*time.Minute), 100+float64(i)), false, cfg)
+			}
+
+			data, err := json.Marshal(state)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var restored BaselineState
+			if err := json.Unmarshal(data, &restored); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			at := start.AddDate(0, 0, 35)
+			want, got := state.Baseline(cfg, at), restored.Baseline(cfg, at)
+			if (want == nil) != (got == nil) {
+				t.Fatalf("Baseline mismatch: %+v vs %+v", want, got)
+			}
+			if want != nil && *want != *got {
+				t.Errorf("Baseline mismatch: %+v vs %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestBaselineStateErrorRates(t *testing.T) {
+	cfg := BaselineConfig{Windows: 10, MinWindows: 2, Alpha: 0.1, Weeks: 4}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	state := NewBaselineState(BaselineMean)
+
+	for i, tlsErrors := range []int{0, 2} {
+		w := window(start.Add(time.Duration(i)*time.Minute), 100)
+		w.CountTotal, w.TLSErrors = 20, tlsErrors
+		state.Update(w, false, cfg)
+	}
+
+	b := state.Baseline(cfg, start.Add(2*time.Minute))
+	if b == nil {
+		t.Fatalf("Expected baseline, got nil")
+	}
+	if !approxEqual(b.TLSErrorRateAvg, 0.05) || !approxEqual(b.TLSErrorRateStdDev, 0.05) {
+		t.Errorf("TLS error rate: expected 0.05 ± 0.05, got %.4f ± %.4f", b.TLSErrorRateAvg, b.TLSErrorRateStdDev)
+	}
+}
+
+func TestBaselineStateUpgrade(t *testing.T) {
+	cfg := BaselineConfig{Windows: 10, MinWindows: 2, Alpha: 0.1, Weeks: 4}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	// States saved before error rates were tracked have 6 metrics
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{"mean", `{"strategy":"mean","windows":2,"last_window_ts":"2024-01-01T09:01:00Z","recent":[[10,10],[20,20],[30,30],[100,100],[160,160],[1000,1000]]}`},
+		{"ewma", `{"strategy":"ewma","windows":2,"last_window_ts":"2024-01-01T09:01:00Z","mean":[10,20,30,100,160,1000],"var":[0,0,0,0,0,0]}`},
+		{"hour_of_week", `{"strategy":"hour_of_week","windows":2,"last_window_ts":"2023-12-25T09:01:00Z","weeks":[{"start":"2023-12-25T09:00:00Z","windows":2,"median":[10,20,30,100,160,1000],"p90":[10,20,30,100,160,1000]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state BaselineState
+			if err := json.Unmarshal([]byte(tt.state), &state); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			b := state.Baseline(cfg, start.Add(5*time.Minute))
+			if b == nil || !approxEqual(b.TTFBP95Avg, 100) || b.TLSErrorRateAvg != 0 {
+				t.Fatalf("Unexpected baseline after upgrade: %+v", b)
+			}
+
+			w := window(start.Add(5*time.Minute), 100)
+			w.CountTotal, w.TLSErrors = 20, 2
+			if !state.Update(w, false, cfg) {
+				t.Fatalf("Expected window to be folded in")
+			}
+			if b := state.Baseline(cfg, start.Add(6*time.Minute)); b == nil {
+				t.Fatalf("Expected baseline after update, got nil")
+			}
+		})
+	}
+}
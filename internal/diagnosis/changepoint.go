@@ -0,0 +1,265 @@
+package diagnosis
+
+import (
+	"math"
+	"time"
+)
+
+// Level shift directions
+const (
+	ShiftUp   = "up"
+	ShiftDown = "down"
+)
+
+// ShiftMetrics are the metrics change-point detection runs on, named like
+// the alert rule fields
+var ShiftMetrics = []string{"dns_p95", "tcp_p95", "tls_p95", "ttfb_p95", "latency_p95", "throughput_p50"}
+
+// shiftMetricIndex maps ShiftMetrics to their index in metricValues
+var shiftMetricIndex = map[string]int{
+	"dns_p95":        metricDNS,
+	"tcp_p95":        metricTCP,
+	"tls_p95":        metricTLS,
+	"ttfb_p95":       metricTTFB,
+	"latency_p95":    metricTotal,
+	"throughput_p50": metricThroughput,
+}
+
+const (
+	// cusumClip bounds the standardized deviation a window adds to the
+	// cumulative sums, so a single spike cannot signal a shift on its own
+	cusumClip = 3.0
+
+	// referenceAlpha is the smoothing factor with which the reference level
+	// follows slow drift while no shift is building up
+	referenceAlpha = 0.01
+
+	// minRelativeSigma and minSigma bound the standard deviation deviations
+	// are measured in, relative to the level and absolutely, so very stable
+	// series do not signal negligible shifts
+	minRelativeSigma = 0.05
+	minSigma         = 1.0
+)
+
+// ChangePointConfig parameterizes the CUSUM level shift detector
+type ChangePointConfig struct {
+	// Warmup is how many windows establish a metric's reference level
+	// before shifts are detected
+	Warmup int
+
+	// Drift is the allowance k subtracted from each window's deviation, and
+	// Threshold the cumulative sum h that signals a shift, both in standard
+	// deviations
+	Drift     float64
+	Threshold float64
+
+	// MinShift is the smallest relative change between the levels reported
+	// as a shift; smaller ones only move the reference level
+	MinShift float64
+}
+
+// DefaultChangePointConfig returns the default detector parameters. A
+// sustained step of 3 or more standard deviations is detected after five
+// windows.
+func DefaultChangePointConfig() ChangePointConfig {
+	return ChangePointConfig{
+		Warmup:    30,
+		Drift:     0.5,
+		Threshold: 10,
+		MinShift:  0.2,
+	}
+}
+
+// LevelShift is a persistent change in a metric's level, from Before (the
+// reference level) to After (the mean since the change started)
+type LevelShift struct {
+	Metric    string  `json:"metric"`
+	Direction string  `json:"direction"`
+	Before    float64 `json:"before"`
+	After     float64 `json:"after"`
+
+	// Change is the relative change, e.g. 0.3 for 30% higher
+	Change float64 `json:"change"`
+
+	// StartedAt is the first window at the new level and DetectedAt the
+	// window the shift was detected in; Windows are those in between
+	StartedAt  time.Time `json:"started_at"`
+	DetectedAt time.Time `json:"detected_at"`
+	Windows    int       `json:"windows"`
+}
+
+// ChangePointState is the persisted change-point detection state of one
+// series, with a CUSUM detector per metric
+type ChangePointState struct {
+	// LastWindowTs is the most recent window folded in; older windows are
+	// not folded in again
+	LastWindowTs time.Time         `json:"last_window_ts"`
+	Detectors    map[string]*CUSUM `json:"detectors"`
+}
+
+// NewChangePointState creates an empty change-point detection state
+func NewChangePointState() *ChangePointState {
+	return &ChangePointState{Detectors: make(map[string]*CUSUM)}
+}
+
+// Update folds a window into the detectors and returns the level shifts it
+// completes. Windows with too little data, and windows not newer than the
+// last one folded in, are ignored, as are metrics without a value.
+func (s *ChangePointState) Update(w WindowMetrics, cfg ChangePointConfig) []LevelShift {
+	if w.CountSuccess < minSuccessForBaseline {
+		return nil
+	}
+	if !s.LastWindowTs.IsZero() && !w.WindowStartTs.After(s.LastWindowTs) {
+		return nil
+	}
+	if s.Detectors == nil {
+		s.Detectors = make(map[string]*CUSUM)
+	}
+
+	values := metricValues(w)
+	var shifts []LevelShift
+	for _, metric := range ShiftMetrics {
+		v := values[shiftMetricIndex[metric]]
+		if v <= 0 {
+			continue
+		}
+		d, ok := s.Detectors[metric]
+		if !ok {
+			d = &CUSUM{}
+			s.Detectors[metric] = d
+		}
+		if shift := d.Update(w.WindowStartTs, v, cfg); shift != nil {
+			shift.Metric = metric
+			shifts = append(shifts, *shift)
+		}
+	}
+	s.LastWindowTs = w.WindowStartTs
+	return shifts
+}
+
+// RecentShifts returns the latest shift of each metric detected within the
+// given duration before at
+func (s *ChangePointState) RecentShifts(at time.Time, within time.Duration) []LevelShift {
+	var shifts []LevelShift
+	for _, metric := range ShiftMetrics {
+		d, ok := s.Detectors[metric]
+		if !ok || d.Last == nil {
+			continue
+		}
+		if !d.Last.DetectedAt.After(at) && at.Sub(d.Last.DetectedAt) < within {
+			shifts = append(shifts, *d.Last)
+		}
+	}
+	return shifts
+}
+
+// CUSUM is a two-sided cumulative sum detector of one metric. Deviations
+// from the reference level, in standard deviations and less the drift, are
+// summed separately upwards and downwards; a sum crossing the threshold
+// signals a shift. Unlike a moving baseline, the reference level stays put
+// while a sum builds up, so a permanent step is not absorbed.
+type CUSUM struct {
+	// Windows is the number of windows folded into the reference
+	Windows int `json:"windows"`
+
+	// Mean and Var are the reference level and variance
+	Mean float64 `json:"mean"`
+	Var  float64 `json:"var"`
+
+	// High and Low are the upward and downward cumulative sums; the runs
+	// collect the windows since each sum left zero
+	High    float64 `json:"high"`
+	Low     float64 `json:"low"`
+	HighRun Run     `json:"high_run"`
+	LowRun  Run     `json:"low_run"`
+
+	// Last is the most recent shift detected
+	Last *LevelShift `json:"last,omitempty"`
+}
+
+// Run collects the windows since a cumulative sum left zero
+type Run struct {
+	Start time.Time `json:"start,omitempty"`
+	Sum   float64   `json:"sum"`
+	Count int       `json:"count"`
+}
+
+func (r *Run) add(ts time.Time, v float64) {
+	if r.Count == 0 {
+		r.Start = ts
+	}
+	r.Sum += v
+	r.Count++
+}
+
+// Update folds a value into the detector and returns the shift it
+// completes, if any. After a shift the reference level moves to the new
+// level.
+func (c *CUSUM) Update(ts time.Time, v float64, cfg ChangePointConfig) *LevelShift {
+	if c.Windows < cfg.Warmup {
+		c.Windows++
+		diff := v - c.Mean
+		c.Mean += diff / float64(c.Windows)
+		c.Var += (diff*(v-c.Mean) - c.Var) / float64(c.Windows)
+		return nil
+	}
+
+	z := (v - c.Mean) / c.sigma()
+	z = math.Max(-cusumClip, math.Min(cusumClip, z))
+
+	c.High = math.Max(0, c.High+z-cfg.Drift)
+	if c.High > 0 {
+		c.HighRun.add(ts, v)
+	} else {
+		c.HighRun = Run{}
+	}
+	c.Low = math.Max(0, c.Low-z-cfg.Drift)
+	if c.Low > 0 {
+		c.LowRun.add(ts, v)
+	} else {
+		c.LowRun = Run{}
+	}
+
+	var run Run
+	direction := ShiftUp
+	switch {
+	case c.High > cfg.Threshold:
+		run = c.HighRun
+	case c.Low > cfg.Threshold:
+		run, direction = c.LowRun, ShiftDown
+	default:
+		if c.High == 0 && c.Low == 0 {
+			diff := v - c.Mean
+			c.Mean += referenceAlpha * diff
+			c.Var = (1 - referenceAlpha) * (c.Var + referenceAlpha*diff*diff)
+		}
+		c.Windows++
+		return nil
+	}
+
+	shift := &LevelShift{
+		Direction:  direction,
+		Before:     c.Mean,
+		After:      run.Sum / float64(run.Count),
+		StartedAt:  run.Start,
+		DetectedAt: ts,
+		Windows:    run.Count,
+	}
+	shift.Change = (shift.After - shift.Before) / shift.Before
+
+	// The new level becomes the reference either way
+	c.Mean = shift.After
+	c.High, c.Low = 0, 0
+	c.HighRun, c.LowRun = Run{}, Run{}
+	c.Windows++
+	if math.Abs(shift.Change) < cfg.MinShift {
+		return nil
+	}
+	c.Last = shift
+	return shift
+}
+
+// sigma returns the standard deviation deviations are measured in
+func (c *CUSUM) sigma() float64 {
+	return math.Max(math.Sqrt(c.Var), math.Max(minRelativeSigma*math.Abs(c.Mean), minSigma))
+}
@@ -0,0 +1,162 @@
+package diagnosis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// noisy returns a TTFB alternating around level by 5%
+func noisy(level float64, i int) float64 {
+	if i%2 == 0 {
+		return level * 1.05
+	}
+	return level * 0.95
+}
+
+func TestCUSUMDetectsStep(t *testing.T) {
+	cfg := DefaultChangePointConfig()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &CUSUM{}
+
+	var shift *LevelShift
+	i := 0
+	for ; i < 60; i++ {
+		if s := c.Update(start.Add(time.Duration(i)*time.Minute), noisy(200, i), cfg); s != nil {
+			t.Fatalf("Unexpected shift at window %d: %+v", i, s)
+		}
+	}
+	stepAt := start.Add(time.Duration(i) * time.Minute)
+	for ; i < 80 && shift == nil; i++ {
+		shift = c.Update(start.Add(time.Duration(i)*time.Minute), noisy(260, i), cfg)
+	}
+
+	if shift == nil {
+		t.Fatal("Expected a 30% step to be detected")
+	}
+	if shift.Direction != ShiftUp {
+		t.Errorf("Expected direction up, got %s", shift.Direction)
+	}
+	if !shift.StartedAt.Equal(stepAt) {
+		t.Errorf("Expected shift to start at %s, got %s", stepAt, shift.StartedAt)
+	}
+	if shift.Windows > 5 {
+		t.Errorf("Expected detection within 5 windows, took %d", shift.Windows)
+	}
+	if math.Abs(shift.Before-200) > 5 || math.Abs(shift.After-260) > 10 {
+		t.Errorf("Expected levels around 200 and 260, got %.1f and %.1f", shift.Before, shift.After)
+	}
+	if math.Abs(shift.Change-0.3) > 0.06 {
+		t.Errorf("Expected a change around 0.3, got %.3f", shift.Change)
+	}
+
+	// The new level is the reference: staying there is not another shift
+	for end := i + 60; i < end; i++ {
+		if s := c.Update(start.Add(time.Duration(i)*time.Minute), noisy(260, i), cfg); s != nil {
+			t.Fatalf("Unexpected shift at the new level at window %d: %+v", i, s)
+		}
+	}
+}
+
+func TestCUSUMDetectsDrop(t *testing.T) {
+	cfg := DefaultChangePointConfig()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &CUSUM{}
+
+	var shift *LevelShift
+	for i := 0; i < 100 && shift == nil; i++ {
+		level := 5000.0
+		if i >= 50 {
+			level = 2500
+		}
+		shift = c.Update(start.Add(time.Duration(i)*time.Minute), noisy(level, i), cfg)
+	}
+
+	if shift == nil {
+		t.Fatal("Expected a drop to be detected")
+	}
+	if shift.Direction != ShiftDown || shift.Change > -0.4 {
+		t.Errorf("Expected a drop of about 50%%, got %s %.3f", shift.Direction, shift.Change)
+	}
+}
+
+func TestCUSUMIgnoresSpikes(t *testing.T) {
+	cfg := DefaultChangePointConfig()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &CUSUM{}
+
+	for i := 0; i < 200; i++ {
+		v := noisy(200, i)
+		// Two-window spikes of 5x every 20 windows
+		if i > 30 && i%20 < 2 {
+			v = 1000
+		}
+		if s := c.Update(start.Add(time.Duration(i)*time.Minute), v, cfg); s != nil {
+			t.Fatalf("Unexpected shift at window %d: %+v", i, s)
+		}
+	}
+}
+
+func TestCUSUMSmallShiftMovesReference(t *testing.T) {
+	cfg := DefaultChangePointConfig()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &CUSUM{}
+
+	for i := 0; i < 200; i++ {
+		level := 200.0
+		if i >= 50 {
+			level = 230
+		}
+		if s := c.Update(start.Add(time.Duration(i)*time.Minute), noisy(level, i), cfg); s != nil {
+			t.Fatalf("Unexpected shift of %.3f below MinShift at window %d", s.Change, i)
+		}
+	}
+	if math.Abs(c.Mean-230) > 10 {
+		t.Errorf("Expected the reference to follow to about 230, got %.1f", c.Mean)
+	}
+}
+
+func TestChangePointStateUpdate(t *testing.T) {
+	cfg := DefaultChangePointConfig()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewChangePointState()
+
+	var shifts []LevelShift
+	for i := 0; i < 80; i++ {
+		ttfb := noisy(100, i)
+		if i >= 40 {
+			ttfb = noisy(150, i)
+		}
+		w := window(start.Add(time.Duration(i)*time.Minute), ttfb)
+		w.ThroughputP50 = 0
+		shifts = append(shifts, s.Update(w, cfg)...)
+	}
+
+	// TTFB and the total latency including it shift; DNS, TCP and TLS are
+	// flat and throughput has no value
+	metrics := map[string]bool{}
+	for _, shift := range shifts {
+		metrics[shift.Metric] = true
+	}
+	if len(shifts) != 2 || !metrics["ttfb_p95"] || !metrics["latency_p95"] {
+		t.Fatalf("Expected ttfb_p95 and latency_p95 shifts, got %+v", shifts)
+	}
+	if _, ok := s.Detectors["throughput_p50"]; ok {
+		t.Error("Expected no detector for a metric without values")
+	}
+
+	// Windows not newer than the last one are ignored
+	last := s.LastWindowTs
+	if got := s.Update(window(start, 1000), cfg); got != nil || !s.LastWindowTs.Equal(last) {
+		t.Errorf("Expected an old window to be ignored, got %+v", got)
+	}
+
+	// Shifts are recent for the given duration after their detection
+	detected := shifts[0].DetectedAt
+	if got := s.RecentShifts(detected.Add(time.Hour), 24*time.Hour); len(got) != 2 {
+		t.Errorf("Expected 2 recent shifts, got %d", len(got))
+	}
+	if got := s.RecentShifts(detected.Add(25*time.Hour), 24*time.Hour); len(got) != 0 {
+		t.Errorf("Expected no recent shifts after a day, got %d", len(got))
+	}
+}
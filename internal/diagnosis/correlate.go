@@ -0,0 +1,340 @@
+package diagnosis
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Scope classifies a correlated incident by what it affects
+type Scope string
+
+const (
+	// ScopeTarget is a target degraded for most clients measuring it
+	ScopeTarget Scope = "target-wide"
+
+	// ScopeClient is a client, or a group of clients sharing a network
+	// (ASN) or label, degraded on most targets
+	ScopeClient Scope = "client-wide"
+
+	// ScopeLocalized is a single client degraded on a single target
+	ScopeLocalized Scope = "localized"
+)
+
+// SeriesDiagnosis is the diagnosis of one series (client, target, address
+// family, check type) in a window, with the client's network attributes
+type SeriesDiagnosis struct {
+	ClientID      string
+	Target        string
+	AddressFamily string
+	CheckType     string
+
+	// Label is the series' diagnosis; empty means healthy
+	Label DiagnosisLabel
+
+	// ASN and UserLabel are the client's network attributes in the window;
+	// zero values are unknown
+	ASN       int
+	UserLabel string
+}
+
+// CorrelationConfig holds the thresholds of Correlate
+type CorrelationConfig struct {
+	// MinAffected is how many clients (for a target or network group) or
+	// targets (for a client) must be affected for a wide incident
+	MinAffected int
+
+	// MinShare is the share of a target's clients, a client's targets or a
+	// network group's clients that must be affected for a wide incident
+	MinShare float64
+}
+
+// DefaultCorrelationConfig returns the default correlation thresholds
+func DefaultCorrelationConfig() CorrelationConfig {
+	return CorrelationConfig{
+		MinAffected: 2,
+		MinShare:    0.5,
+	}
+}
+
+// Incident is a group of anomalous series explained by one cause
+type Incident struct {
+	Scope Scope `json:"scope"`
+
+	// Key identifies the incident within a window, e.g. "target:<url>",
+	// "client:<id>", "asn:<number>", "label:<label>" or
+	// "client:<id>|target:<url>"
+	Key string `json:"key"`
+
+	// Label is the most common diagnosis among the affected series, Labels
+	// counts each diagnosis
+	Label  DiagnosisLabel         `json:"label"`
+	Labels map[DiagnosisLabel]int `json:"labels"`
+
+	Clients []string `json:"clients"`
+	Targets []string `json:"targets"`
+
+	// Affected is the number of anomalous series, Observed the number of
+	// series measured within the incident's scope
+	Affected int `json:"affected"`
+	Observed int `json:"observed"`
+}
+
+// labelPriority orders labels like Evaluate, to break ties between labels
+var labelPriority = []DiagnosisLabel{
+	DiagnosisResolutionFailure,
+	DiagnosisConnectivityLoss,
+	DiagnosisTLSFailure,
+	DiagnosisHTTPErrorSurge,
+	DiagnosisDNSBound,
+	DiagnosisHandshake,
+	DiagnosisServerBound,
+	DiagnosisThroughput,
+}
+
+// Correlate groups the anomalous series of one window into incidents, so a
+// degraded target or client yields one incident instead of a label per
+// series. Each anomaly is attributed to its target or its client, whichever
+// has the larger share of affected series; anomalies of clients that share
+// an ASN or label are then merged; what remains is localized.
+func Correlate(series []SeriesDiagnosis, cfg CorrelationConfig) []Incident {
+	c := newCorrelation(series)
+	if len(c.anomalies) == 0 {
+		return nil
+	}
+
+	targetShare := func(target string) float64 {
+		return share(len(c.targetAffected[target]), len(c.targetClients[target]))
+	}
+	clientShare := func(client string) float64 {
+		return share(len(c.clientAffected[client]), len(c.clientTargets[client]))
+	}
+	targetWide := func(target string) bool {
+		return len(c.targetAffected[target]) >= cfg.MinAffected && targetShare(target) >= cfg.MinShare
+	}
+	clientWide := func(client string) bool {
+		return len(c.clientAffected[client]) >= cfg.MinAffected && clientShare(client) >= cfg.MinShare
+	}
+
+	// Attribute anomalies to their target where the target is more widely
+	// affected than the client
+	byTarget := map[string][]SeriesDiagnosis{}
+	var unclaimed []SeriesDiagnosis
+	for _, s := range c.anomalies {
+		if targetWide(s.Target) && (!clientWide(s.ClientID) || targetShare(s.Target) >= clientShare(s.ClientID)) {
+			byTarget[s.Target] = append(byTarget[s.Target], s)
+		} else {
+			unclaimed = append(unclaimed, s)
+		}
+	}
+
+	var incidents []Incident
+
+	// Targets left with too few clients after attribution are not wide
+	for _, target := range sortedKeys(byTarget) {
+		group := byTarget[target]
+		if len(distinct(group, func(s SeriesDiagnosis) string { return s.ClientID })) < cfg.MinAffected {
+			unclaimed = append(unclaimed, group...)
+			continue
+		}
+		incidents = append(incidents, newIncident(ScopeTarget, "target:"+target, group, c.targetSeries[target]))
+	}
+
+	// Clients still widely affected without the target-wide anomalies
+	unclaimedTargets := map[string]map[string]bool{}
+	for _, s := range unclaimed {
+		if unclaimedTargets[s.ClientID] == nil {
+			unclaimedTargets[s.ClientID] = map[string]bool{}
+		}
+		unclaimedTargets[s.ClientID][s.Target] = true
+	}
+	byClient := map[string][]SeriesDiagnosis{}
+	var rest []SeriesDiagnosis
+	for _, s := range unclaimed {
+		affected := len(unclaimedTargets[s.ClientID])
+		if affected >= cfg.MinAffected && share(affected, len(c.clientTargets[s.ClientID])) >= cfg.MinShare {
+			byClient[s.ClientID] = append(byClient[s.ClientID], s)
+		} else {
+			rest = append(rest, s)
+		}
+	}
+
+	// Clients sharing a network attribute, most of whose clients are
+	// affected, form one incident
+	remaining := rest
+	for _, client := range sortedKeys(byClient) {
+		remaining = append(remaining, byClient[client]...)
+	}
+	attributes := []struct {
+		prefix string
+		value  func(SeriesDiagnosis) string
+	}{
+		{"asn:", func(s SeriesDiagnosis) string {
+			if s.ASN == 0 {
+				return ""
+			}
+			return fmt.Sprint(s.ASN)
+		}},
+		{"label:", func(s SeriesDiagnosis) string { return s.UserLabel }},
+	}
+	merged := map[string]bool{}
+	for _, attr := range attributes {
+		groups := map[string][]SeriesDiagnosis{}
+		for _, s := range remaining {
+			if v := attr.value(s); v != "" && !merged[s.ClientID] {
+				groups[v] = append(groups[v], s)
+			}
+		}
+		for _, value := range sortedKeys(groups) {
+			group := groups[value]
+			affected := distinct(group, func(s SeriesDiagnosis) string { return s.ClientID })
+			observed, observedSeries := c.clientsWith(attr.value, value)
+			if len(affected) < cfg.MinAffected || share(len(affected), observed) < cfg.MinShare {
+				continue
+			}
+			incidents = append(incidents, newIncident(ScopeClient, attr.prefix+value, group, observedSeries))
+			for _, client := range affected {
+				merged[client] = true
+			}
+		}
+	}
+
+	for _, client := range sortedKeys(byClient) {
+		if merged[client] {
+			continue
+		}
+		incidents = append(incidents, newIncident(ScopeClient, "client:"+client, byClient[client], c.clientSeries[client]))
+	}
+
+	// One localized incident per client and target, across address
+	// families and check types
+	localized := map[string][]SeriesDiagnosis{}
+	for _, s := range rest {
+		if merged[s.ClientID] {
+			continue
+		}
+		key := "client:" + s.ClientID + "|target:" + s.Target
+		localized[key] = append(localized[key], s)
+	}
+	for _, key := range sortedKeys(localized) {
+		group := localized[key]
+		incidents = append(incidents, newIncident(ScopeLocalized, key, group, c.pairSeries[group[0].ClientID+"\x00"+group[0].Target]))
+	}
+
+	return incidents
+}
+
+// correlation indexes a window's series
+type correlation struct {
+	series    []SeriesDiagnosis
+	anomalies []SeriesDiagnosis
+
+	// Clients measuring each target and targets measured by each client,
+	// and the affected ones
+	targetClients  map[string]map[string]bool
+	targetAffected map[string]map[string]bool
+	clientTargets  map[string]map[string]bool
+	clientAffected map[string]map[string]bool
+
+	// Series counts per target, client and client/target pair
+	targetSeries map[string]int
+	clientSeries map[string]int
+	pairSeries   map[string]int
+}
+
+func newCorrelation(series []SeriesDiagnosis) *correlation {
+	c := &correlation{
+		series:         series,
+		targetClients:  map[string]map[string]bool{},
+		targetAffected: map[string]map[string]bool{},
+		clientTargets:  map[string]map[string]bool{},
+		clientAffected: map[string]map[string]bool{},
+		targetSeries:   map[string]int{},
+		clientSeries:   map[string]int{},
+		pairSeries:     map[string]int{},
+	}
+	add := func(m map[string]map[string]bool, key, value string) {
+		if m[key] == nil {
+			m[key] = map[string]bool{}
+		}
+		m[key][value] = true
+	}
+
+	for _, s := range series {
+		add(c.targetClients, s.Target, s.ClientID)
+		add(c.clientTargets, s.ClientID, s.Target)
+		c.targetSeries[s.Target]++
+		c.clientSeries[s.ClientID]++
+		c.pairSeries[s.ClientID+"\x00"+s.Target]++
+		if s.Label != DiagnosisNone {
+			add(c.targetAffected, s.Target, s.ClientID)
+			add(c.clientAffected, s.ClientID, s.Target)
+			c.anomalies = append(c.anomalies, s)
+		}
+	}
+	return c
+}
+
+// clientsWith returns how many clients have a network attribute value, and
+// how many series they measured
+func (c *correlation) clientsWith(attr func(SeriesDiagnosis) string, value string) (int, int) {
+	clients := map[string]bool{}
+	var series int
+	for _, s := range c.series {
+		if attr(s) == value {
+			clients[s.ClientID] = true
+			series++
+		}
+	}
+	return len(clients), series
+}
+
+func newIncident(scope Scope, key string, group []SeriesDiagnosis, observed int) Incident {
+	incident := Incident{
+		Scope:    scope,
+		Key:      key,
+		Labels:   map[DiagnosisLabel]int{},
+		Clients:  distinct(group, func(s SeriesDiagnosis) string { return s.ClientID }),
+		Targets:  distinct(group, func(s SeriesDiagnosis) string { return s.Target }),
+		Affected: len(group),
+		Observed: observed,
+	}
+	for _, s := range group {
+		incident.Labels[s.Label]++
+	}
+	for _, label := range labelPriority {
+		if incident.Labels[label] > incident.Labels[incident.Label] {
+			incident.Label = label
+		}
+	}
+	return incident
+}
+
+func share(affected, observed int) float64 {
+	if observed == 0 {
+		return 0
+	}
+	return float64(affected) / float64(observed)
+}
+
+// distinct returns the sorted distinct values of field in group
+func distinct(group []SeriesDiagnosis, field func(SeriesDiagnosis) string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, s := range group {
+		if v := field(s); !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func sortedKeys(m map[string][]SeriesDiagnosis) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
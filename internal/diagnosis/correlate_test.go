@@ -0,0 +1,187 @@
+package diagnosis
+
+import (
+	"reflect"
+	"testing"
+)
+
+// grid returns one series per client and target, anomalous where label
+// returns a label
+func grid(clients, targets []string, asn func(client string) int, label func(client, target string) DiagnosisLabel) []SeriesDiagnosis {
+	var series []SeriesDiagnosis
+	for _, c := range clients {
+		for _, t := range targets {
+			series = append(series, SeriesDiagnosis{
+				ClientID:      c,
+				Target:        t,
+				AddressFamily: "ipv4",
+				CheckType:     "http",
+				Label:         label(c, t),
+				ASN:           asn(c),
+			})
+		}
+	}
+	return series
+}
+
+func TestCorrelate(t *testing.T) {
+	clients := []string{"c1", "c2", "c3", "c4"}
+	targets := []string{"t1", "t2", "t3", "t4"}
+	noASN := func(string) int { return 0 }
+
+	tests := []struct {
+		name      string
+		series    []SeriesDiagnosis
+		incidents []Incident
+	}{
+		{
+			name: "healthy",
+			series: grid(clients, targets, noASN, func(c, t string) DiagnosisLabel {
+				return DiagnosisNone
+			}),
+			incidents: nil,
+		},
+		{
+			name: "target outage",
+			series: grid(clients, targets, noASN, func(c, t string) DiagnosisLabel {
+				if t == "t1" && c != "c4" {
+					return DiagnosisConnectivityLoss
+				}
+				return DiagnosisNone
+			}),
+			incidents: []Incident{{
+				Scope:    ScopeTarget,
+				Key:      "target:t1",
+				Label:    DiagnosisConnectivityLoss,
+				Labels:   map[DiagnosisLabel]int{DiagnosisConnectivityLoss: 3},
+				Clients:  []string{"c1", "c2", "c3"},
+				Targets:  []string{"t1"},
+				Affected: 3,
+				Observed: 4,
+			}},
+		},
+		{
+			name: "client problem",
+			series: grid(clients, targets, noASN, func(c, t string) DiagnosisLabel {
+				if c == "c2" {
+					return DiagnosisDNSBound
+				}
+				return DiagnosisNone
+			}),
+			incidents: []Incident{{
+				Scope:    ScopeClient,
+				Key:      "client:c2",
+				Label:    DiagnosisDNSBound,
+				Labels:   map[DiagnosisLabel]int{DiagnosisDNSBound: 4},
+				Clients:  []string{"c2"},
+				Targets:  targets,
+				Affected: 4,
+				Observed: 4,
+			}},
+		},
+		{
+			name: "network problem",
+			series: grid(clients, targets, func(c string) int {
+				if c == "c1" || c == "c2" || c == "c3" {
+					return 64500
+				}
+				return 64501
+			}, func(c, t string) DiagnosisLabel {
+				if c != "c4" {
+					return DiagnosisHandshake
+				}
+				return DiagnosisNone
+			}),
+			incidents: []Incident{{
+				Scope:    ScopeClient,
+				Key:      "asn:64500",
+				Label:    DiagnosisHandshake,
+				Labels:   map[DiagnosisLabel]int{DiagnosisHandshake: 12},
+				Clients:  []string{"c1", "c2", "c3"},
+				Targets:  targets,
+				Affected: 12,
+				Observed: 12,
+			}},
+		},
+		{
+			name: "localized",
+			series: grid(clients, targets, noASN, func(c, t string) DiagnosisLabel {
+				if c == "c1" && t == "t2" {
+					return DiagnosisServerBound
+				}
+				return DiagnosisNone
+			}),
+			incidents: []Incident{{
+				Scope:    ScopeLocalized,
+				Key:      "client:c1|target:t2",
+				Label:    DiagnosisServerBound,
+				Labels:   map[DiagnosisLabel]int{DiagnosisServerBound: 1},
+				Clients:  []string{"c1"},
+				Targets:  []string{"t2"},
+				Affected: 1,
+				Observed: 1,
+			}},
+		},
+		{
+			name: "target outage and localized",
+			series: grid(clients, targets, noASN, func(c, t string) DiagnosisLabel {
+				switch {
+				case t == "t3":
+					return DiagnosisTLSFailure
+				case c == "c4" && t == "t1":
+					return DiagnosisThroughput
+				}
+				return DiagnosisNone
+			}),
+			incidents: []Incident{
+				{
+					Scope:    ScopeTarget,
+					Key:      "target:t3",
+					Label:    DiagnosisTLSFailure,
+					Labels:   map[DiagnosisLabel]int{DiagnosisTLSFailure: 4},
+					Clients:  clients,
+					Targets:  []string{"t3"},
+					Affected: 4,
+					Observed: 4,
+				},
+				{
+					Scope:    ScopeLocalized,
+					Key:      "client:c4|target:t1",
+					Label:    DiagnosisThroughput,
+					Labels:   map[DiagnosisLabel]int{DiagnosisThroughput: 1},
+					Clients:  []string{"c4"},
+					Targets:  []string{"t1"},
+					Affected: 1,
+					Observed: 1,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Correlate(tt.series, DefaultCorrelationConfig())
+			if !reflect.DeepEqual(got, tt.incidents) {
+				t.Errorf("Correlate() = %+v, want %+v", got, tt.incidents)
+			}
+		})
+	}
+}
+
+func TestCorrelateDominantLabel(t *testing.T) {
+	series := []SeriesDiagnosis{
+		{ClientID: "c1", Target: "t1", Label: DiagnosisServerBound},
+		{ClientID: "c2", Target: "t1", Label: DiagnosisServerBound},
+		{ClientID: "c3", Target: "t1", Label: DiagnosisDNSBound},
+		{ClientID: "c4", Target: "t1", Label: DiagnosisDNSBound},
+	}
+
+	incidents := Correlate(series, DefaultCorrelationConfig())
+	if len(incidents) != 1 {
+		t.Fatalf("Correlate() returned %d incidents, want 1", len(incidents))
+	}
+	// Ties are broken by diagnosis priority
+	if incidents[0].Label != DiagnosisDNSBound {
+		t.Errorf("Label = %q, want %q", incidents[0].Label, DiagnosisDNSBound)
+	}
+}
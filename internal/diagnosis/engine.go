@@ -14,8 +14,24 @@ const (
 	DiagnosisHandshake   DiagnosisLabel = "handshake-bound"
 	DiagnosisServerBound DiagnosisLabel = "server-bound"
 	DiagnosisThroughput  DiagnosisLabel = "throughput-bound"
+
+	// Error-driven diagnoses, from the rate of failures at each stage
+	DiagnosisResolutionFailure DiagnosisLabel = "resolution-failure"
+	DiagnosisConnectivityLoss  DiagnosisLabel = "connectivity-loss"
+	DiagnosisTLSFailure        DiagnosisLabel = "tls-failure"
+	DiagnosisHTTPErrorSurge    DiagnosisLabel = "http-error-surge"
 )
 
+// IsErrorDriven reports whether a label comes from failing measurements
+// rather than slow ones
+func IsErrorDriven(label DiagnosisLabel) bool {
+	switch label {
+	case DiagnosisResolutionFailure, DiagnosisConnectivityLoss, DiagnosisTLSFailure, DiagnosisHTTPErrorSurge:
+		return true
+	}
+	return false
+}
+
 // WindowMetrics represents metrics for a single time window
 type WindowMetrics struct {
 	WindowStartTs   time.Time
@@ -26,26 +42,56 @@ type WindowMetrics struct {
 	TotalLatencyP95 float64 // Sum of DNS + TCP + TLS + TTFB
 	ThroughputP50   float64
 	CountSuccess    int
+
+	// Measurements and failures by stage, for error-driven diagnoses
+	CountTotal int
+	DNSErrors  int
+	TCPErrors  int
+	TLSErrors  int
+	HTTPErrors int
+}
+
+// errorRate returns the share of the window's measurements that failed with
+// the given count
+func (w WindowMetrics) errorRate(errors int) float64 {
+	if w.CountTotal == 0 {
+		return 0
+	}
+	return float64(errors) / float64(w.CountTotal)
 }
 
 // Baseline represents baseline metrics calculated from historical windows
 type Baseline struct {
-	DNSP95Avg          float64
-	TCPP95Avg          float64
-	TLSP95Avg          float64
-	TTFBP95Avg         float64
-	TotalLatencyP95Avg float64
-	ThroughputP50Avg   float64
+	DNSP95Avg          float64 `json:"dns_p95_avg"`
+	TCPP95Avg          float64 `json:"tcp_p95_avg"`
+	TLSP95Avg          float64 `json:"tls_p95_avg"`
+	TTFBP95Avg         float64 `json:"ttfb_p95_avg"`
+	TotalLatencyP95Avg float64 `json:"total_latency_p95_avg"`
+	ThroughputP50Avg   float64 `json:"throughput_p50_avg"`
 
 	// Standard deviations for statistical thresholds
-	DNSP95StdDev          float64
-	TCPP95StdDev          float64
-	TLSP95StdDev          float64
-	TTFBP95StdDev         float64
-	TotalLatencyP95StdDev float64
-	ThroughputP50StdDev   float64
-
-	WindowCount int
+	DNSP95StdDev          float64 `json:"dns_p95_stddev"`
+	TCPP95StdDev          float64 `json:"tcp_p95_stddev"`
+	TLSP95StdDev          float64 `json:"tls_p95_stddev"`
+	TTFBP95StdDev         float64 `json:"ttfb_p95_stddev"`
+	TotalLatencyP95StdDev float64 `json:"total_latency_p95_stddev"`
+	ThroughputP50StdDev   float64 `json:"throughput_p50_stddev"`
+
+	// Error rates by stage (failures / measurements)
+	DNSErrorRateAvg     float64 `json:"dns_error_rate_avg"`
+	TCPErrorRateAvg     float64 `json:"tcp_error_rate_avg"`
+	TLSErrorRateAvg     float64 `json:"tls_error_rate_avg"`
+	HTTPErrorRateAvg    float64 `json:"http_error_rate_avg"`
+	DNSErrorRateStdDev  float64 `json:"dns_error_rate_stddev"`
+	TCPErrorRateStdDev  float64 `json:"tcp_error_rate_stddev"`
+	TLSErrorRateStdDev  float64 `json:"tls_error_rate_stddev"`
+	HTTPErrorRateStdDev float64 `json:"http_error_rate_stddev"`
+
+	WindowCount int `json:"window_count"`
+
+	// Strategy is the baseline strategy that produced the baseline; empty
+	// for CalculateBaseline
+	Strategy BaselineStrategy `json:"strategy,omitempty"`
 }
 
 // CalculateBaseline computes baseline metrics from historical windows
@@ -69,6 +115,10 @@ func CalculateBaseline(windows []WindowMetrics) *Baseline {
 		baseline.TTFBP95Avg += w.TTFBP95
 		baseline.TotalLatencyP95Avg += w.TotalLatencyP95
 		baseline.ThroughputP50Avg += w.ThroughputP50
+		baseline.DNSErrorRateAvg += w.errorRate(w.DNSErrors)
+		baseline.TCPErrorRateAvg += w.errorRate(w.TCPErrors)
+		baseline.TLSErrorRateAvg += w.errorRate(w.TLSErrors)
+		baseline.HTTPErrorRateAvg += w.errorRate(w.HTTPErrors)
 	}
 
 	// Compute averages
@@ -79,6 +129,10 @@ func CalculateBaseline(windows []WindowMetrics) *Baseline {
 	baseline.TTFBP95Avg /= n
 	baseline.TotalLatencyP95Avg /= n
 	baseline.ThroughputP50Avg /= n
+	baseline.DNSErrorRateAvg /= n
+	baseline.TCPErrorRateAvg /= n
+	baseline.TLSErrorRateAvg /= n
+	baseline.HTTPErrorRateAvg /= n
 
 	// Calculate standard deviations (for 2σ thresholds)
 	for _, w := range windows {
@@ -88,6 +142,10 @@ func CalculateBaseline(windows []WindowMetrics) *Baseline {
 		baseline.TTFBP95StdDev += math.Pow(w.TTFBP95-baseline.TTFBP95Avg, 2)
 		baseline.TotalLatencyP95StdDev += math.Pow(w.TotalLatencyP95-baseline.TotalLatencyP95Avg, 2)
 		baseline.ThroughputP50StdDev += math.Pow(w.ThroughputP50-baseline.ThroughputP50Avg, 2)
+		baseline.DNSErrorRateStdDev += math.Pow(w.errorRate(w.DNSErrors)-baseline.DNSErrorRateAvg, 2)
+		baseline.TCPErrorRateStdDev += math.Pow(w.errorRate(w.TCPErrors)-baseline.TCPErrorRateAvg, 2)
+		baseline.TLSErrorRateStdDev += math.Pow(w.errorRate(w.TLSErrors)-baseline.TLSErrorRateAvg, 2)
+		baseline.HTTPErrorRateStdDev += math.Pow(w.errorRate(w.HTTPErrors)-baseline.HTTPErrorRateAvg, 2)
 	}
 
 	baseline.DNSP95StdDev = math.Sqrt(baseline.DNSP95StdDev / n)
@@ -96,6 +154,10 @@ func CalculateBaseline(windows []WindowMetrics) *Baseline {
 	baseline.TTFBP95StdDev = math.Sqrt(baseline.TTFBP95StdDev / n)
 	baseline.TotalLatencyP95StdDev = math.Sqrt(baseline.TotalLatencyP95StdDev / n)
 	baseline.ThroughputP50StdDev = math.Sqrt(baseline.ThroughputP50StdDev / n)
+	baseline.DNSErrorRateStdDev = math.Sqrt(baseline.DNSErrorRateStdDev / n)
+	baseline.TCPErrorRateStdDev = math.Sqrt(baseline.TCPErrorRateStdDev / n)
+	baseline.TLSErrorRateStdDev = math.Sqrt(baseline.TLSErrorRateStdDev / n)
+	baseline.HTTPErrorRateStdDev = math.Sqrt(baseline.HTTPErrorRateStdDev / n)
 
 	return baseline
 }
@@ -108,19 +170,47 @@ func CalculateBaseline(windows []WindowMetrics) *Baseline {
 //
 // Requirement: 5.2 - DNS-bound diagnosis
 func DiagnoseDNSBound(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateDNSBound(current, baseline) != nil
+}
+
+func evaluateDNSBound(current WindowMetrics, baseline *Baseline) *Finding {
 	if baseline == nil || current.TotalLatencyP95 == 0 || baseline.DNSP95Avg == 0 {
-		return false
+		return nil
 	}
 
 	// Check if DNS is ≥60% of total latency
 	dnsRatio := current.DNSP95 / current.TotalLatencyP95
 	if dnsRatio < 0.60 {
-		return false
+		return nil
 	}
 
 	// Check if DNS exceeds baseline by ≥50%
 	increase := (current.DNSP95 - baseline.DNSP95Avg) / baseline.DNSP95Avg
-	return increase >= 0.50
+	if increase < 0.50 {
+		return nil
+	}
+
+	return &Finding{
+		Label: DiagnosisDNSBound,
+		Confidence: confidence(baseline,
+			(exceedance(dnsRatio, 0.60, 0.90)+exceedance(increase, 0.50, 2.0))/2),
+		Evidence: []Evidence{
+			{
+				Metric:    "dns_share",
+				Value:     dnsRatio,
+				Threshold: 0.60,
+				Condition: "dns_p95 >= 60% of total latency p95",
+			},
+			{
+				Metric:    "dns_p95",
+				Value:     current.DNSP95,
+				Baseline:  baseline.DNSP95Avg,
+				StdDev:    baseline.DNSP95StdDev,
+				Threshold: baseline.DNSP95Avg * 1.5,
+				Condition: "dns_p95 >= 150% of baseline",
+			},
+		},
+	}
 }
 
 // DiagnoseHandshakeBound checks if TCP/TLS handshake is the bottleneck
@@ -130,8 +220,12 @@ func DiagnoseDNSBound(current WindowMetrics, baseline *Baseline) bool {
 //
 // Requirement: 5.3 - Handshake-bound diagnosis
 func DiagnoseHandshakeBound(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateHandshakeBound(current, baseline) != nil
+}
+
+func evaluateHandshakeBound(current WindowMetrics, baseline *Baseline) *Finding {
 	if baseline == nil || baseline.TCPP95Avg == 0 {
-		return false
+		return nil
 	}
 
 	handshakeP95 := current.TCPP95 + current.TLSP95
@@ -139,15 +233,42 @@ func DiagnoseHandshakeBound(current WindowMetrics, baseline *Baseline) bool {
 	baselineStdDev := math.Sqrt(baseline.TCPP95StdDev*baseline.TCPP95StdDev +
 		baseline.TLSP95StdDev*baseline.TLSP95StdDev)
 
+	finding := &Finding{Label: DiagnosisHandshake}
+	var score float64
+
 	// Check 2σ threshold
 	twoSigmaThreshold := baselineHandshake + 2*baselineStdDev
 	if handshakeP95 > twoSigmaThreshold {
-		return true
+		score = sigmaExceedance(handshakeP95, baselineHandshake, baselineStdDev)
+		finding.Evidence = append(finding.Evidence, Evidence{
+			Metric:    "handshake_p95",
+			Value:     handshakeP95,
+			Baseline:  baselineHandshake,
+			StdDev:    baselineStdDev,
+			Threshold: twoSigmaThreshold,
+			Condition: "tcp_p95 + tls_p95 > baseline + 2σ",
+		})
 	}
 
 	// Check 100% increase threshold
 	increase := (handshakeP95 - baselineHandshake) / baselineHandshake
-	return increase >= 1.0
+	if increase >= 1.0 {
+		score = math.Max(score, exceedance(increase, 1.0, 3.0))
+		finding.Evidence = append(finding.Evidence, Evidence{
+			Metric:    "handshake_p95",
+			Value:     handshakeP95,
+			Baseline:  baselineHandshake,
+			StdDev:    baselineStdDev,
+			Threshold: baselineHandshake * 2,
+			Condition: "tcp_p95 + tls_p95 >= 200% of baseline",
+		})
+	}
+
+	if len(finding.Evidence) == 0 {
+		return nil
+	}
+	finding.Confidence = confidence(baseline, score)
+	return finding
 }
 
 // DiagnoseServerBound checks if server processing (TTFB) is the bottleneck
@@ -158,14 +279,18 @@ func DiagnoseHandshakeBound(current WindowMetrics, baseline *Baseline) bool {
 //
 // Requirement: 5.4 - Server-bound diagnosis
 func DiagnoseServerBound(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateServerBound(current, baseline) != nil
+}
+
+func evaluateServerBound(current WindowMetrics, baseline *Baseline) *Finding {
 	if baseline == nil || baseline.TTFBP95Avg == 0 {
-		return false
+		return nil
 	}
 
 	// Check if TTFB exceeds baseline by 2σ
 	twoSigmaThreshold := baseline.TTFBP95Avg + 2*baseline.TTFBP95StdDev
 	if current.TTFBP95 <= twoSigmaThreshold {
-		return false
+		return nil
 	}
 
 	// Verify connections are normal (not also experiencing handshake issues)
@@ -176,7 +301,32 @@ func DiagnoseServerBound(current WindowMetrics, baseline *Baseline) bool {
 
 	// Connections are "normal" if within 1σ of baseline
 	connectionThreshold := baselineHandshake + baselineHandshakeStdDev
-	return handshakeP95 <= connectionThreshold
+	if handshakeP95 > connectionThreshold {
+		return nil
+	}
+
+	return &Finding{
+		Label:      DiagnosisServerBound,
+		Confidence: confidence(baseline, sigmaExceedance(current.TTFBP95, baseline.TTFBP95Avg, baseline.TTFBP95StdDev)),
+		Evidence: []Evidence{
+			{
+				Metric:    "ttfb_p95",
+				Value:     current.TTFBP95,
+				Baseline:  baseline.TTFBP95Avg,
+				StdDev:    baseline.TTFBP95StdDev,
+				Threshold: twoSigmaThreshold,
+				Condition: "ttfb_p95 > baseline + 2σ",
+			},
+			{
+				Metric:    "handshake_p95",
+				Value:     handshakeP95,
+				Baseline:  baselineHandshake,
+				StdDev:    baselineHandshakeStdDev,
+				Threshold: connectionThreshold,
+				Condition: "tcp_p95 + tls_p95 <= baseline + 1σ",
+			},
+		},
+	}
 }
 
 // DiagnoseThroughputBound checks if throughput is degraded
@@ -186,41 +336,185 @@ func DiagnoseServerBound(current WindowMetrics, baseline *Baseline) bool {
 //
 // Requirement: 5.5 - Throughput-bound diagnosis
 func DiagnoseThroughputBound(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateThroughputBound(current, baseline) != nil
+}
+
+func evaluateThroughputBound(current WindowMetrics, baseline *Baseline) *Finding {
 	if baseline == nil || baseline.ThroughputP50Avg == 0 {
-		return false
+		return nil
 	}
 
 	// Check if throughput dropped by ≥30%
 	decrease := (baseline.ThroughputP50Avg - current.ThroughputP50) / baseline.ThroughputP50Avg
-	return decrease >= 0.30
+	if decrease < 0.30 {
+		return nil
+	}
+
+	return &Finding{
+		Label:      DiagnosisThroughput,
+		Confidence: confidence(baseline, exceedance(decrease, 0.30, 0.70)),
+		Evidence: []Evidence{
+			{
+				Metric:    "throughput_p50",
+				Value:     current.ThroughputP50,
+				Baseline:  baseline.ThroughputP50Avg,
+				StdDev:    baseline.ThroughputP50StdDev,
+				Threshold: baseline.ThroughputP50Avg * 0.7,
+				Condition: "throughput_p50 <= 70% of baseline",
+			},
+		},
+	}
 }
 
-// Diagnose runs all diagnosis checks and returns the primary issue
-// Priority order: DNS > Handshake > Server > Throughput
+// Error-driven diagnosis thresholds
+const (
+	// minErrorWindowTotal is the number of measurements a window needs for
+	// its error rates to be diagnosed
+	minErrorWindowTotal = 5
+
+	// minErrorRateIncrease is how far, at least, an error rate must rise
+	// above its baseline; the threshold is baseline + max(3σ, this)
+	minErrorRateIncrease = 0.10
+
+	// errorRateSaturation is how far above the threshold an error rate is
+	// considered clearly anomalous
+	errorRateSaturation = 0.40
+)
+
+// DiagnoseResolutionFailure checks if DNS resolution failures surged
 //
-// Requirements: 5.1, 5.2, 5.3, 5.4, 5.5
-func Diagnose(current WindowMetrics, baseline *Baseline) DiagnosisLabel {
-	// Skip diagnosis if insufficient data
-	if baseline == nil || current.CountSuccess < 5 {
-		return DiagnosisNone
+// Criteria:
+// - DNS error rate ≥ baseline + max(3σ, 10 percentage points)
+func DiagnoseResolutionFailure(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateResolutionFailure(current, baseline) != nil
+}
+
+func evaluateResolutionFailure(current WindowMetrics, baseline *Baseline) *Finding {
+	if baseline == nil {
+		return nil
 	}
+	return evaluateErrorRate(DiagnosisResolutionFailure, "dns_error_rate", current, current.DNSErrors,
+		baseline, baseline.DNSErrorRateAvg, baseline.DNSErrorRateStdDev)
+}
+
+// DiagnoseConnectivityLoss checks if TCP connection failures surged
+//
+// Criteria:
+// - TCP error rate ≥ baseline + max(3σ, 10 percentage points)
+func DiagnoseConnectivityLoss(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateConnectivityLoss(current, baseline) != nil
+}
 
-	// Check in priority order
-	if DiagnoseDNSBound(current, baseline) {
-		return DiagnosisDNSBound
+func evaluateConnectivityLoss(current WindowMetrics, baseline *Baseline) *Finding {
+	if baseline == nil {
+		return nil
 	}
+	return evaluateErrorRate(DiagnosisConnectivityLoss, "tcp_error_rate", current, current.TCPErrors,
+		baseline, baseline.TCPErrorRateAvg, baseline.TCPErrorRateStdDev)
+}
+
+// DiagnoseTLSFailure checks if TLS handshake failures surged
+//
+// Criteria:
+// - TLS error rate ≥ baseline + max(3σ, 10 percentage points)
+func DiagnoseTLSFailure(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateTLSFailure(current, baseline) != nil
+}
 
-	if DiagnoseHandshakeBound(current, baseline) {
-		return DiagnosisHandshake
+func evaluateTLSFailure(current WindowMetrics, baseline *Baseline) *Finding {
+	if baseline == nil {
+		return nil
 	}
+	return evaluateErrorRate(DiagnosisTLSFailure, "tls_error_rate", current, current.TLSErrors,
+		baseline, baseline.TLSErrorRateAvg, baseline.TLSErrorRateStdDev)
+}
+
+// DiagnoseHTTPErrorSurge checks if HTTP errors surged
+//
+// Criteria:
+// - HTTP error rate ≥ baseline + max(3σ, 10 percentage points)
+func DiagnoseHTTPErrorSurge(current WindowMetrics, baseline *Baseline) bool {
+	return evaluateHTTPErrorSurge(current, baseline) != nil
+}
 
-	if DiagnoseServerBound(current, baseline) {
-		return DiagnosisServerBound
+func evaluateHTTPErrorSurge(current WindowMetrics, baseline *Baseline) *Finding {
+	if baseline == nil {
+		return nil
+	}
+	return evaluateErrorRate(DiagnosisHTTPErrorSurge, "http_error_rate", current, current.HTTPErrors,
+		baseline, baseline.HTTPErrorRateAvg, baseline.HTTPErrorRateStdDev)
+}
+
+// evaluateErrorRate checks a stage's error rate against its baseline
+func evaluateErrorRate(label DiagnosisLabel, metric string, current WindowMetrics, errors int, baseline *Baseline, avg, stddev float64) *Finding {
+	if current.CountTotal < minErrorWindowTotal || errors == 0 {
+		return nil
+	}
+
+	rate := current.errorRate(errors)
+	threshold := avg + math.Max(3*stddev, minErrorRateIncrease)
+	if rate < threshold {
+		return nil
 	}
 
-	if DiagnoseThroughputBound(current, baseline) {
-		return DiagnosisThroughput
+	return &Finding{
+		Label:      label,
+		Confidence: confidence(baseline, exceedance(rate, threshold, threshold+errorRateSaturation)),
+		Evidence: []Evidence{
+			{
+				Metric:    metric,
+				Value:     rate,
+				Baseline:  avg,
+				StdDev:    stddev,
+				Threshold: threshold,
+				Condition: metric + " >= baseline + max(3σ, 0.10)",
+			},
+		},
 	}
+}
 
-	return DiagnosisNone
+// Diagnose runs all diagnosis checks and returns the primary issue
+// Priority order: Resolution failure > Connectivity loss > TLS failure >
+// HTTP error surge > DNS > Handshake > Server > Throughput
+//
+// Requirements: 5.1, 5.2, 5.3, 5.4, 5.5
+func Diagnose(current WindowMetrics, baseline *Baseline) DiagnosisLabel {
+	return Evaluate(current, baseline).Label
+}
+
+// Evaluate runs all diagnosis checks and returns every issue found, with
+// the primary one chosen in the same priority order as Diagnose
+func Evaluate(current WindowMetrics, baseline *Baseline) *Result {
+	result := &Result{}
+
+	// Skip diagnosis if insufficient data
+	if baseline == nil {
+		return result
+	}
+
+	// Check in priority order. Failures are checked first; timings only
+	// when enough measurements succeeded.
+	checks := []func(WindowMetrics, *Baseline) *Finding{
+		evaluateResolutionFailure,
+		evaluateConnectivityLoss,
+		evaluateTLSFailure,
+		evaluateHTTPErrorSurge,
+	}
+	if current.CountSuccess >= 5 {
+		checks = append(checks,
+			evaluateDNSBound,
+			evaluateHandshakeBound,
+			evaluateServerBound,
+			evaluateThroughputBound,
+		)
+	}
+	for _, check := range checks {
+		if finding := check(current, baseline); finding != nil {
+			result.Findings = append(result.Findings, *finding)
+		}
+	}
+	if len(result.Findings) > 0 {
+		result.Label = result.Findings[0].Label
+	}
+	return result
 }
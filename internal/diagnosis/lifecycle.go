@@ -0,0 +1,115 @@
+package diagnosis
+
+import (
+	"sort"
+	"time"
+)
+
+// LifecycleConfig holds when correlated anomalies open and resolve incidents
+type LifecycleConfig struct {
+	// OpenAfter is how many consecutive windows an anomaly must be
+	// correlated in before an incident opens
+	OpenAfter int
+
+	// ResolveAfter is how many healthy windows in a row resolve an incident
+	ResolveAfter int
+
+	// Window is the length of an aggregate window, the aggregator's window
+	// size
+	Window time.Duration
+}
+
+// DefaultLifecycleConfig returns the default incident lifecycle settings
+func DefaultLifecycleConfig() LifecycleConfig {
+	return LifecycleConfig{
+		OpenAfter:    2,
+		ResolveAfter: 5,
+		Window:       time.Minute,
+	}
+}
+
+// Transition is the effect of a window on an open incident
+type Transition string
+
+const (
+	// TransitionNone leaves the incident as it was, apart from its counters
+	TransitionNone Transition = ""
+
+	// TransitionUpdated changed the incident's diagnosis or added affected
+	// clients or targets
+	TransitionUpdated Transition = "updated"
+
+	// TransitionResolved resolved the incident
+	TransitionResolved Transition = "resolved"
+)
+
+// IncidentProgress is the lifecycle state of an open incident
+type IncidentProgress struct {
+	Label   DiagnosisLabel
+	Clients []string
+	Targets []string
+
+	// LastWindowTs is the last window applied, LastAnomalousTs the last one
+	// in which the anomaly was present
+	LastWindowTs    time.Time
+	LastAnomalousTs time.Time
+
+	AnomalousWindows int
+	HealthyWindows   int
+}
+
+// Advance applies a window to an open incident. anomaly is the incident's
+// correlated anomaly in the window, or nil if the window was healthy for
+// it. Windows not after LastWindowTs were already applied and are ignored;
+// Advance reports whether the window was applied.
+func (p *IncidentProgress) Advance(windowStart time.Time, anomaly *Incident, cfg LifecycleConfig) (Transition, bool) {
+	if !windowStart.After(p.LastWindowTs) {
+		return TransitionNone, false
+	}
+	p.LastWindowTs = windowStart
+
+	if anomaly == nil {
+		p.HealthyWindows++
+		if p.HealthyWindows >= cfg.ResolveAfter {
+			return TransitionResolved, true
+		}
+		return TransitionNone, true
+	}
+
+	p.HealthyWindows = 0
+	p.AnomalousWindows++
+	p.LastAnomalousTs = windowStart
+
+	transition := TransitionNone
+	if anomaly.Label != p.Label {
+		p.Label = anomaly.Label
+		transition = TransitionUpdated
+	}
+	var added bool
+	if p.Clients, added = union(p.Clients, anomaly.Clients); added {
+		transition = TransitionUpdated
+	}
+	if p.Targets, added = union(p.Targets, anomaly.Targets); added {
+		transition = TransitionUpdated
+	}
+	return transition, true
+}
+
+// union returns the sorted union of a and b, and whether b added values
+func union(a, b []string) ([]string, bool) {
+	seen := make(map[string]bool, len(a))
+	for _, v := range a {
+		seen[v] = true
+	}
+	result := append([]string(nil), a...)
+	added := false
+	for _, v := range b {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+			added = true
+		}
+	}
+	sort.Strings(result)
+	return result, added
+}
@@ -0,0 +1,64 @@
+package diagnosis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIncidentProgressAdvance(t *testing.T) {
+	cfg := LifecycleConfig{OpenAfter: 2, ResolveAfter: 3}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+	anomaly := func(label DiagnosisLabel, clients ...string) *Incident {
+		return &Incident{Label: label, Clients: clients, Targets: []string{"t1"}}
+	}
+
+	p := &IncidentProgress{
+		Label:            DiagnosisServerBound,
+		Clients:          []string{"c1", "c2"},
+		Targets:          []string{"t1"},
+		LastWindowTs:     window(1),
+		LastAnomalousTs:  window(1),
+		AnomalousWindows: 2,
+	}
+
+	steps := []struct {
+		name       string
+		window     time.Time
+		anomaly    *Incident
+		transition Transition
+		applied    bool
+	}{
+		{"anomaly continues", window(2), anomaly(DiagnosisServerBound, "c1", "c2"), TransitionNone, true},
+		{"window already applied", window(2), anomaly(DiagnosisDNSBound, "c3"), TransitionNone, false},
+		{"client added", window(3), anomaly(DiagnosisServerBound, "c3"), TransitionUpdated, true},
+		{"diagnosis changed", window(4), anomaly(DiagnosisDNSBound, "c1"), TransitionUpdated, true},
+		{"healthy", window(5), nil, TransitionNone, true},
+		{"healthy again", window(6), nil, TransitionNone, true},
+		{"anomaly returns", window(7), anomaly(DiagnosisDNSBound, "c1"), TransitionNone, true},
+		{"healthy after return", window(8), nil, TransitionNone, true},
+		{"healthy twice after return", window(9), nil, TransitionNone, true},
+		{"resolved", window(10), nil, TransitionResolved, true},
+	}
+
+	for _, step := range steps {
+		transition, applied := p.Advance(step.window, step.anomaly, cfg)
+		if transition != step.transition || applied != step.applied {
+			t.Fatalf("%s: Advance() = %q, %v, want %q, %v", step.name, transition, applied, step.transition, step.applied)
+		}
+	}
+
+	if p.Label != DiagnosisDNSBound {
+		t.Errorf("Label = %q, want %q", p.Label, DiagnosisDNSBound)
+	}
+	if want := []string{"c1", "c2", "c3"}; !reflect.DeepEqual(p.Clients, want) {
+		t.Errorf("Clients = %v, want %v", p.Clients, want)
+	}
+	if p.AnomalousWindows != 6 || p.HealthyWindows != 3 {
+		t.Errorf("AnomalousWindows, HealthyWindows = %d, %d, want 6, 3", p.AnomalousWindows, p.HealthyWindows)
+	}
+	if !p.LastAnomalousTs.Equal(window(7)) || !p.LastWindowTs.Equal(window(10)) {
+		t.Errorf("LastAnomalousTs, LastWindowTs = %v, %v, want %v, %v", p.LastAnomalousTs, p.LastWindowTs, window(7), window(10))
+	}
+}
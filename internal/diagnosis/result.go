@@ -0,0 +1,86 @@
+package diagnosis
+
+import "math"
+
+// Result holds every issue found in a window, so that several simultaneous
+// issues (e.g. slow DNS and a slow server) are all reported
+type Result struct {
+	// Label is the primary issue, chosen by priority; empty if healthy
+	Label DiagnosisLabel `json:"label"`
+
+	// Findings lists every issue found, in priority order
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Finding is one issue with the evidence that triggered it
+type Finding struct {
+	Label DiagnosisLabel `json:"label"`
+
+	// Confidence ranges from 0.5 (thresholds barely crossed) to 1 (clearly
+	// anomalous); it is reduced when the baseline has few windows
+	Confidence float64 `json:"confidence"`
+
+	Evidence []Evidence `json:"evidence"`
+}
+
+// Evidence is a threshold that fired: the window's value, the baseline it
+// was compared against and the threshold it crossed
+type Evidence struct {
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Baseline  float64 `json:"baseline,omitempty"`
+	StdDev    float64 `json:"stddev,omitempty"`
+	Threshold float64 `json:"threshold"`
+	Condition string  `json:"condition"`
+}
+
+// Labels returns the labels of all findings in priority order
+func (r *Result) Labels() []DiagnosisLabel {
+	labels := make([]DiagnosisLabel, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		labels = append(labels, f.Label)
+	}
+	return labels
+}
+
+// Confidence returns the confidence of the primary issue, or 0 if healthy
+func (r *Result) Confidence() float64 {
+	if len(r.Findings) == 0 {
+		return 0
+	}
+	return r.Findings[0].Confidence
+}
+
+// fullBaselineWindows is the baseline size at which confidence is no longer
+// reduced for a short history
+const fullBaselineWindows = 10
+
+// confidence turns a score in [0, 1] of how far thresholds were exceeded
+// into a confidence in [0.5, 1], reduced when the baseline is short
+func confidence(baseline *Baseline, score float64) float64 {
+	c := 0.5 + 0.5*clamp01(score)
+	if baseline.WindowCount < fullBaselineWindows {
+		c *= 0.5 + 0.5*float64(baseline.WindowCount)/fullBaselineWindows
+	}
+	return math.Round(c*100) / 100
+}
+
+// exceedance scores how far value is past threshold, from 0 at the
+// threshold to 1 at saturation
+func exceedance(value, threshold, saturation float64) float64 {
+	if saturation <= threshold {
+		return 1
+	}
+	return clamp01((value - threshold) / (saturation - threshold))
+}
+
+// sigmaExceedance scores a value against a 2σ threshold, reaching 1 at 4σ.
+// With little variance in the baseline, 50% above it counts as 4σ.
+func sigmaExceedance(value, avg, stddev float64) float64 {
+	spread := math.Max(stddev, avg/4)
+	return exceedance(value, avg+2*stddev, avg+2*stddev+2*spread)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
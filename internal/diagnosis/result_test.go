@@ -0,0 +1,252 @@
+package diagnosis
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	baseline := &Baseline{
+		DNSP95Avg:           20,
+		TCPP95Avg:           20,
+		TLSP95Avg:           20,
+		TTFBP95Avg:          100,
+		TotalLatencyP95Avg:  160,
+		ThroughputP50Avg:    1000,
+		DNSP95StdDev:        5,
+		TCPP95StdDev:        5,
+		TLSP95StdDev:        5,
+		TTFBP95StdDev:       5,
+		ThroughputP50StdDev: 50,
+		WindowCount:         10,
+	}
+
+	tests := []struct {
+		name     string
+		current  WindowMetrics
+		baseline *Baseline
+		label    DiagnosisLabel
+		labels   []DiagnosisLabel
+	}{
+		{
+			name:     "healthy",
+			current:  WindowMetrics{DNSP95: 20, TCPP95: 20, TLSP95: 20, TTFBP95: 100, TotalLatencyP95: 160, ThroughputP50: 1000, CountSuccess: 10},
+			baseline: baseline,
+			label:    DiagnosisNone,
+			labels:   []DiagnosisLabel{},
+		},
+		{
+			name:     "no baseline",
+			current:  WindowMetrics{DNSP95: 400, TCPP95: 20, TLSP95: 20, TTFBP95: 200, TotalLatencyP95: 640, ThroughputP50: 1000, CountSuccess: 10},
+			baseline: nil,
+			label:    DiagnosisNone,
+			labels:   []DiagnosisLabel{},
+		},
+		{
+			name:     "slow DNS and slow server",
+			current:  WindowMetrics{DNSP95: 400, TCPP95: 20, TLSP95: 20, TTFBP95: 200, TotalLatencyP95: 640, ThroughputP50: 1000, CountSuccess: 10},
+			baseline: baseline,
+			label:    DiagnosisDNSBound,
+			labels:   []DiagnosisLabel{DiagnosisDNSBound, DiagnosisServerBound},
+		},
+		{
+			name:     "slow handshake and low throughput",
+			current:  WindowMetrics{DNSP95: 20, TCPP95: 60, TLSP95: 60, TTFBP95: 100, TotalLatencyP95: 240, ThroughputP50: 500, CountSuccess: 10},
+			baseline: baseline,
+			label:    DiagnosisHandshake,
+			labels:   []DiagnosisLabel{DiagnosisHandshake, DiagnosisThroughput},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Evaluate(tt.current, tt.baseline)
+
+			if result.Label != tt.label {
+				t.Errorf("Label: expected %q, got %q", tt.label, result.Label)
+			}
+			if got := Diagnose(tt.current, tt.baseline); got != result.Label {
+				t.Errorf("Diagnose returned %q, Evaluate %q", got, result.Label)
+			}
+
+			labels := result.Labels()
+			if len(labels) != len(tt.labels) {
+				t.Fatalf("Labels: expected %v, got %v", tt.labels, labels)
+			}
+			for i := range labels {
+				if labels[i] != tt.labels[i] {
+					t.Errorf("Labels: expected %v, got %v", tt.labels, labels)
+				}
+			}
+
+			for _, f := range result.Findings {
+				if f.Confidence < 0.5 || f.Confidence > 1 {
+					t.Errorf("%s: confidence %.2f out of range", f.Label, f.Confidence)
+				}
+				if len(f.Evidence) == 0 {
+					t.Errorf("%s: no evidence", f.Label)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateEvidence(t *testing.T) {
+	baseline := &Baseline{
+		TCPP95Avg:   20,
+		TLSP95Avg:   20,
+		TTFBP95Avg:  100,
+		WindowCount: 10,
+	}
+	current := WindowMetrics{TCPP95: 20, TLSP95: 20, TTFBP95: 150, TotalLatencyP95: 190, CountSuccess: 10}
+
+	result := Evaluate(current, baseline)
+	if result.Label != DiagnosisServerBound {
+		t.Fatalf("Expected %s, got %q", DiagnosisServerBound, result.Label)
+	}
+
+	ttfb := result.Findings[0].Evidence[0]
+	if ttfb.Metric != "ttfb_p95" || ttfb.Value != 150 || ttfb.Baseline != 100 || ttfb.Threshold != 100 {
+		t.Errorf("Unexpected TTFB evidence: %+v", ttfb)
+	}
+	// 50% above a baseline without variance is fully anomalous
+	if result.Confidence() != 1 {
+		t.Errorf("Confidence: expected 1, got %.2f", result.Confidence())
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var restored Result
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if restored.Label != result.Label || len(restored.Findings) != 1 || len(restored.Findings[0].Evidence) != 2 {
+		t.Errorf("Round trip mismatch: %s", data)
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		name     string
+		windows  int
+		score    float64
+		expected float64
+	}{
+		{"barely crossed", 10, 0, 0.5},
+		{"clearly anomalous", 10, 1, 1},
+		{"score above 1", 30, 2, 1},
+		{"short baseline", 5, 1, 0.75},
+		{"short baseline barely crossed", 4, 0, 0.35},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := confidence(&Baseline{WindowCount: tt.windows}, tt.score)
+			if got != tt.expected {
+				t.Errorf("confidence() = %.2f, expected %.2f", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrorDriven(t *testing.T) {
+	baseline := &Baseline{
+		DNSP95Avg:           20,
+		TCPP95Avg:           20,
+		TLSP95Avg:           20,
+		TTFBP95Avg:          100,
+		TotalLatencyP95Avg:  160,
+		ThroughputP50Avg:    1000,
+		HTTPErrorRateAvg:    0.05,
+		HTTPErrorRateStdDev: 0.05,
+		WindowCount:         10,
+	}
+	healthy := WindowMetrics{DNSP95: 20, TCPP95: 20, TLSP95: 20, TTFBP95: 100, TotalLatencyP95: 160, ThroughputP50: 1000}
+
+	tests := []struct {
+		name   string
+		modify func(w *WindowMetrics)
+		labels []DiagnosisLabel
+	}{
+		{
+			name:   "no errors",
+			modify: func(w *WindowMetrics) { w.CountTotal, w.CountSuccess = 10, 10 },
+			labels: []DiagnosisLabel{},
+		},
+		{
+			name: "40% TLS failures",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.TLSErrors = 10, 6, 4
+			},
+			labels: []DiagnosisLabel{DiagnosisTLSFailure},
+		},
+		{
+			name: "all resolutions fail",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.DNSErrors = 10, 0, 10
+			},
+			labels: []DiagnosisLabel{DiagnosisResolutionFailure},
+		},
+		{
+			name: "connectivity loss outranks slow server",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.TCPErrors = 20, 15, 5
+				w.TTFBP95 = 300
+			},
+			labels: []DiagnosisLabel{DiagnosisConnectivityLoss, DiagnosisServerBound},
+		},
+		{
+			name: "HTTP errors within baseline variation",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.HTTPErrors = 20, 17, 3
+			},
+			labels: []DiagnosisLabel{},
+		},
+		{
+			name: "HTTP error surge",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.HTTPErrors = 20, 14, 6
+			},
+			labels: []DiagnosisLabel{DiagnosisHTTPErrorSurge},
+		},
+		{
+			name: "too few measurements",
+			modify: func(w *WindowMetrics) {
+				w.CountTotal, w.CountSuccess, w.TLSErrors = 3, 0, 3
+			},
+			labels: []DiagnosisLabel{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := healthy
+			tt.modify(&current)
+			labels := Evaluate(current, baseline).Labels()
+
+			if len(labels) != len(tt.labels) {
+				t.Fatalf("Labels: expected %v, got %v", tt.labels, labels)
+			}
+			for i := range labels {
+				if labels[i] != tt.labels[i] {
+					t.Errorf("Labels: expected %v, got %v", tt.labels, labels)
+				}
+			}
+		})
+	}
+}
+
+func TestIsErrorDriven(t *testing.T) {
+	for _, label := range []DiagnosisLabel{DiagnosisResolutionFailure, DiagnosisConnectivityLoss, DiagnosisTLSFailure, DiagnosisHTTPErrorSurge} {
+		if !IsErrorDriven(label) {
+			t.Errorf("IsErrorDriven(%s) = false, expected true", label)
+		}
+	}
+	for _, label := range []DiagnosisLabel{DiagnosisNone, DiagnosisDNSBound, DiagnosisHandshake, DiagnosisServerBound, DiagnosisThroughput} {
+		if IsErrorDriven(label) {
+			t.Errorf("IsErrorDriven(%q) = true, expected false", label)
+		}
+	}
+}
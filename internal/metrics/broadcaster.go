@@ -19,6 +19,8 @@ type Broadcaster interface {
 	BroadcastDiagnosis(clientID string, target string, diagnosis string, severity string)
 	BroadcastProbeStatus(clientID string, status string, lastSeen time.Time)
 	BroadcastDashboardUpdate(summary map[string]interface{})
+	BroadcastIncident(event string, incident interface{}, severity string, message string)
+	Broadcast(channel string, data map[string]interface{})
 	Close()
 }
 
@@ -206,6 +208,36 @@ func (b *WebSocketBroadcaster) BroadcastDashboardUpdate(summary map[string]inter
 	})
 }
 
+// BroadcastIncident broadcasts an incident lifecycle event, such as an
+// acknowledgement or assignment
+func (b *WebSocketBroadcaster) BroadcastIncident(event string, incident interface{}, severity string, message string) {
+	data := map[string]interface{}{
+		"type":     "incident",
+		"event":    event,
+		"incident": incident,
+		"severity": severity,
+		"message":  message,
+	}
+
+	b.enqueue(&BroadcastMessage{
+		Channel: "incidents",
+		Data:    data,
+	})
+	b.enqueue(&BroadcastMessage{
+		Channel: "dashboard",
+		Data:    data,
+	})
+}
+
+// Broadcast broadcasts a message on a channel as is, for messages the
+// typed methods above do not cover
+func (b *WebSocketBroadcaster) Broadcast(channel string, data map[string]interface{}) {
+	b.enqueue(&BroadcastMessage{
+		Channel: channel,
+		Data:    data,
+	})
+}
+
 // enqueue adds a message to the broadcast buffer
 func (b *WebSocketBroadcaster) enqueue(msg *BroadcastMessage) {
 	select {
@@ -216,11 +248,11 @@ func (b *WebSocketBroadcaster) enqueue(msg *BroadcastMessage) {
 	}
 }
 
-// Close stops the broadcaster
+// Close stops the broadcaster. Messages broadcast afterwards are dropped once
+// the buffer is full; the buffer is left open so late senders cannot panic.
 func (b *WebSocketBroadcaster) Close() {
 	b.cancel()
 	b.wg.Wait()
-	close(b.buffer)
 }
 
 // calculateErrorRate calculates the error rate from an aggregate
@@ -242,4 +274,6 @@ func (n *NullBroadcaster) BroadcastAggregate(aggregate *models.WindowedAggregate
 func (n *NullBroadcaster) BroadcastDiagnosis(clientID, target, diagnosis, severity string)         {}
 func (n *NullBroadcaster) BroadcastProbeStatus(clientID string, status string, lastSeen time.Time) {}
 func (n *NullBroadcaster) BroadcastDashboardUpdate(summary map[string]interface{})                 {}
+func (n *NullBroadcaster) BroadcastIncident(event string, incident interface{}, sev, msg string)   {}
+func (n *NullBroadcaster) Broadcast(channel string, data map[string]interface{})                   {}
 func (n *NullBroadcaster) Close()                                                                  {}
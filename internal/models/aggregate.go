@@ -15,6 +15,12 @@ type WindowedAggregate struct {
 	// Target is the endpoint being measured
 	Target string
 
+	// AddressFamily is the address family dimension; empty for untagged events
+	AddressFamily string
+
+	// CheckType is the check type dimension (http, tcp, udp)
+	CheckType string
+
 	// WindowStartTs is the start of the 1-minute aggregation window
 	WindowStartTs time.Time
 
@@ -27,9 +33,16 @@ type WindowedAggregate struct {
 	// CountError is the number of failed measurements
 	CountError int64
 
-	// ErrorStageCounts tracks errors by stage (DNS, TCP, TLS, HTTP, throughput)
+	// ErrorStageCounts tracks errors by stage (DNS, TCP, TLS, HTTP, UDP, proxy, assertion, throughput)
 	ErrorStageCounts map[string]int64
 
+	// CountTimeout is the number of errors where the failing stage timed out
+	CountTimeout int64
+
+	// TimeoutStageCounts tracks timed out errors by the stage that ran out
+	// of time; they are also counted in ErrorStageCounts
+	TimeoutStageCounts map[string]int64
+
 	// DNS timing percentiles (milliseconds)
 	DNSP50 float64
 	DNSP95 float64
@@ -50,6 +63,37 @@ type WindowedAggregate struct {
 	ThroughputP50 float64
 	ThroughputP95 float64
 
+	// Upload throughput percentiles (kilobits per second)
+	UploadP50 float64
+	UploadP95 float64
+
+	// Proxy connect percentiles (milliseconds), from proxied measurements only
+	ProxyConnectP50 float64
+	ProxyConnectP95 float64
+
+	// UDP echo packet totals and loss rate across all trains in the window
+	PacketsSent    int64
+	PacketsLost    int64
+	ReorderedCount int64
+	LossRate       float64
+
+	// UDP echo RTT percentiles (of per-train P50/P95) and jitter percentiles
+	// across trains (milliseconds)
+	RTTP50    float64
+	RTTP95    float64
+	JitterP50 float64
+	JitterP95 float64
+
+	// CustomMetrics summarizes each probe collector metric seen in the
+	// window, keyed by metric name
+	CustomMetrics map[string]CustomMetricStats
+
+	// ASN, ASOrg and UserLabel are the probe's network attributes, from the
+	// latest event in the window that reported them
+	ASN       int
+	ASOrg     string
+	UserLabel string
+
 	// DiagnosisLabel indicates the identified performance bottleneck type
 	// Possible values: "DNS-bound", "Handshake-bound", "Server-bound", "Throughput-bound"
 	DiagnosisLabel *string
@@ -65,6 +109,27 @@ const (
 	ErrorStageTLS        = "TLS"
 	ErrorStageHTTP       = "HTTP"
 	ErrorStageThroughput = "throughput"
+
+	// ErrorStageUDP is a UDP check that got no (or an unreadable) reply
+	ErrorStageUDP = "UDP"
+
+	// ErrorStageProxy is a failed HTTP CONNECT or SOCKS5 handshake with the
+	// configured proxy
+	ErrorStageProxy = "proxy"
+
+	// ErrorStageAssertion is an HTTP-class failure where the response was
+	// received but did not satisfy the configured assertions
+	ErrorStageAssertion = "assertion"
+)
+
+// CheckType constants for the kind of check that produced an event
+const (
+	CheckTypeHTTP = "http"
+	CheckTypeTCP  = "tcp"
+	CheckTypeUDP  = "udp"
+
+	// CheckTypeUDPEcho is a loss/jitter packet train against a udp-echo responder
+	CheckTypeUDPEcho = "udp-echo"
 )
 
 // DiagnosisLabel constants for bottleneck classification
@@ -78,11 +143,12 @@ const (
 // NewWindowedAggregate creates a new WindowedAggregate with initialized fields.
 func NewWindowedAggregate(clientID, target string, windowStartTs time.Time) *WindowedAggregate {
 	return &WindowedAggregate{
-		ClientID:         clientID,
-		Target:           target,
-		WindowStartTs:    windowStartTs,
-		ErrorStageCounts: make(map[string]int64),
-		UpdatedAt:        time.Now(),
+		ClientID:           clientID,
+		Target:             target,
+		WindowStartTs:      windowStartTs,
+		ErrorStageCounts:   make(map[string]int64),
+		TimeoutStageCounts: make(map[string]int64),
+		UpdatedAt:          time.Now(),
 	}
 }
 
@@ -90,6 +156,8 @@ func NewWindowedAggregate(clientID, target string, windowStartTs time.Time) *Win
 type AggregateKey struct {
 	ClientID      string
 	Target        string
+	AddressFamily string
+	CheckType     string
 	WindowStartTs time.Time
 }
 
@@ -98,6 +166,8 @@ func (wa *WindowedAggregate) Key() AggregateKey {
 	return AggregateKey{
 		ClientID:      wa.ClientID,
 		Target:        wa.Target,
+		AddressFamily: wa.AddressFamily,
+		CheckType:     wa.CheckType,
 		WindowStartTs: wa.WindowStartTs,
 	}
 }
@@ -136,14 +206,34 @@ type InMemoryAggregator struct {
 	TLSSamples        []float64
 	TTFBSamples       []float64
 	ThroughputSamples []float64
+	UploadSamples     []float64
+	ProxySamples      []float64
+
+	// UDP echo samples, one per packet train
+	RTTP50Samples  []float64
+	RTTP95Samples  []float64
+	JitterSamples  []float64
+	PacketsSent    int64
+	PacketsLost    int64
+	ReorderedCount int64
+
+	// Custom metric samples from probe collectors, keyed by metric name
+	CustomSamples map[string][]float64
 
 	// Counters
 	CountTotal   int64
 	CountSuccess int64
 	CountError   int64
+	CountTimeout int64
 
 	// Error stage tracking
-	ErrorStageCounts map[string]int64
+	ErrorStageCounts   map[string]int64
+	TimeoutStageCounts map[string]int64
+
+	// Network attributes of the probe
+	ASN       int
+	ASOrg     string
+	UserLabel string
 
 	// Last update time
 	UpdatedAt time.Time
@@ -152,14 +242,15 @@ type InMemoryAggregator struct {
 // NewInMemoryAggregator creates a new in-memory aggregator for a window
 func NewInMemoryAggregator(key AggregateKey) *InMemoryAggregator {
 	return &InMemoryAggregator{
-		Key:               key,
-		DNSSamples:        make([]float64, 0, 100),
-		TCPSamples:        make([]float64, 0, 100),
-		TLSSamples:        make([]float64, 0, 100),
-		TTFBSamples:       make([]float64, 0, 100),
-		ThroughputSamples: make([]float64, 0, 100),
-		ErrorStageCounts:  make(map[string]int64),
-		UpdatedAt:         time.Now(),
+		Key:                key,
+		DNSSamples:         make([]float64, 0, 100),
+		TCPSamples:         make([]float64, 0, 100),
+		TLSSamples:         make([]float64, 0, 100),
+		TTFBSamples:        make([]float64, 0, 100),
+		ThroughputSamples:  make([]float64, 0, 100),
+		ErrorStageCounts:   make(map[string]int64),
+		TimeoutStageCounts: make(map[string]int64),
+		UpdatedAt:          time.Now(),
 	}
 }
 
@@ -167,10 +258,43 @@ func NewInMemoryAggregator(key AggregateKey) *InMemoryAggregator {
 func (ima *InMemoryAggregator) AddEvent(event *TelemetryEvent) {
 	ima.CountTotal++
 
+	// Packet loss is tracked even for failed trains, which are 100% loss
+	if echo := event.Echo; echo != nil {
+		ima.PacketsSent += int64(echo.PacketsSent)
+		ima.PacketsLost += int64(echo.PacketsSent - echo.PacketsReceived)
+		ima.ReorderedCount += int64(echo.ReorderedCount)
+		if echo.PacketsReceived > 0 {
+			ima.RTTP50Samples = append(ima.RTTP50Samples, echo.RTTP50Ms)
+			ima.RTTP95Samples = append(ima.RTTP95Samples, echo.RTTP95Ms)
+			ima.JitterSamples = append(ima.JitterSamples, echo.JitterMs)
+		}
+	}
+
+	// Collector metrics describe the host, not the measurement, so they are
+	// kept regardless of the outcome
+	for name, value := range event.CustomMetrics {
+		if ima.CustomSamples == nil {
+			ima.CustomSamples = make(map[string][]float64)
+		}
+		ima.CustomSamples[name] = append(ima.CustomSamples[name], value)
+	}
+
+	if nc := event.NetworkContext; nc.ASN > 0 {
+		ima.ASN = nc.ASN
+		ima.ASOrg = nc.ASOrg
+	}
+	if label := event.NetworkContext.UserLabel; label != nil && *label != "" {
+		ima.UserLabel = *label
+	}
+
 	if event.ErrorStage != nil && *event.ErrorStage != "" {
 		// Track error
 		ima.CountError++
 		ima.ErrorStageCounts[*event.ErrorStage]++
+		if event.TimedOut {
+			ima.CountTimeout++
+			ima.TimeoutStageCounts[*event.ErrorStage]++
+		}
 	} else {
 		// Track success and add samples
 		ima.CountSuccess++
@@ -178,7 +302,15 @@ func (ima *InMemoryAggregator) AddEvent(event *TelemetryEvent) {
 		ima.TCPSamples = append(ima.TCPSamples, event.Timings.TCPMs)
 		ima.TLSSamples = append(ima.TLSSamples, event.Timings.TLSMs)
 		ima.TTFBSamples = append(ima.TTFBSamples, event.Timings.HTTPTTFBMs)
-		ima.ThroughputSamples = append(ima.ThroughputSamples, event.ThroughputKbps)
+		if event.ThroughputKbps > 0 {
+			ima.ThroughputSamples = append(ima.ThroughputSamples, event.ThroughputKbps)
+		}
+		if event.UploadKbps > 0 {
+			ima.UploadSamples = append(ima.UploadSamples, event.UploadKbps)
+		}
+		if event.Timings.ProxyConnectMs > 0 {
+			ima.ProxySamples = append(ima.ProxySamples, event.Timings.ProxyConnectMs)
+		}
 	}
 
 	ima.UpdatedAt = time.Now()
@@ -188,14 +320,21 @@ func (ima *InMemoryAggregator) AddEvent(event *TelemetryEvent) {
 // by computing percentiles from the collected samples.
 func (ima *InMemoryAggregator) ToWindowedAggregate() *WindowedAggregate {
 	wa := &WindowedAggregate{
-		ClientID:         ima.Key.ClientID,
-		Target:           ima.Key.Target,
-		WindowStartTs:    ima.Key.WindowStartTs,
-		CountTotal:       ima.CountTotal,
-		CountSuccess:     ima.CountSuccess,
-		CountError:       ima.CountError,
-		ErrorStageCounts: ima.ErrorStageCounts,
-		UpdatedAt:        ima.UpdatedAt,
+		ClientID:           ima.Key.ClientID,
+		Target:             ima.Key.Target,
+		AddressFamily:      ima.Key.AddressFamily,
+		CheckType:          ima.Key.CheckType,
+		WindowStartTs:      ima.Key.WindowStartTs,
+		CountTotal:         ima.CountTotal,
+		CountSuccess:       ima.CountSuccess,
+		CountError:         ima.CountError,
+		CountTimeout:       ima.CountTimeout,
+		ErrorStageCounts:   ima.ErrorStageCounts,
+		TimeoutStageCounts: ima.TimeoutStageCounts,
+		ASN:                ima.ASN,
+		ASOrg:              ima.ASOrg,
+		UserLabel:          ima.UserLabel,
+		UpdatedAt:          ima.UpdatedAt,
 	}
 
 	// Compute percentiles if we have samples
@@ -224,5 +363,36 @@ func (ima *InMemoryAggregator) ToWindowedAggregate() *WindowedAggregate {
 		wa.ThroughputP95 = calculatePercentile(ima.ThroughputSamples, 95)
 	}
 
+	if len(ima.UploadSamples) > 0 {
+		wa.UploadP50 = calculatePercentile(ima.UploadSamples, 50)
+		wa.UploadP95 = calculatePercentile(ima.UploadSamples, 95)
+	}
+
+	if len(ima.ProxySamples) > 0 {
+		wa.ProxyConnectP50 = calculatePercentile(ima.ProxySamples, 50)
+		wa.ProxyConnectP95 = calculatePercentile(ima.ProxySamples, 95)
+	}
+
+	wa.PacketsSent = ima.PacketsSent
+	wa.PacketsLost = ima.PacketsLost
+	wa.ReorderedCount = ima.ReorderedCount
+	if ima.PacketsSent > 0 {
+		wa.LossRate = float64(ima.PacketsLost) / float64(ima.PacketsSent)
+	}
+
+	if len(ima.RTTP50Samples) > 0 {
+		wa.RTTP50 = calculatePercentile(ima.RTTP50Samples, 50)
+		wa.RTTP95 = calculatePercentile(ima.RTTP95Samples, 95)
+		wa.JitterP50 = calculatePercentile(ima.JitterSamples, 50)
+		wa.JitterP95 = calculatePercentile(ima.JitterSamples, 95)
+	}
+
+	if len(ima.CustomSamples) > 0 {
+		wa.CustomMetrics = make(map[string]CustomMetricStats, len(ima.CustomSamples))
+		for name, samples := range ima.CustomSamples {
+			wa.CustomMetrics[name] = computeCustomMetricStats(samples)
+		}
+	}
+
 	return wa
 }
@@ -172,6 +172,200 @@ func TestInMemoryAggregator(t *testing.T) {
 	if wa.DNSP50 != 10.0 {
 		t.Errorf("WindowedAggregate.DNSP50 = %v, want 10.0", wa.DNSP50)
 	}
+	if wa.CountTimeout != 0 {
+		t.Errorf("WindowedAggregate.CountTimeout = %v, want 0", wa.CountTimeout)
+	}
+
+	// Add timed out event, counted under its stage and as a timeout
+	tlsStage := "TLS"
+	agg.AddEvent(&TelemetryEvent{
+		EventID:     "event-3",
+		ClientID:    "test-client",
+		TimestampMs: 1704067220000,
+		Target:      "https://example.com",
+		ErrorStage:  &tlsStage,
+		TimedOut:    true,
+	})
+
+	wa = agg.ToWindowedAggregate()
+	if wa.ErrorStageCounts["TLS"] != 1 {
+		t.Errorf("ErrorStageCounts[TLS] = %v, want 1", wa.ErrorStageCounts["TLS"])
+	}
+	if wa.CountTimeout != 1 {
+		t.Errorf("WindowedAggregate.CountTimeout = %v, want 1", wa.CountTimeout)
+	}
+	if wa.TimeoutStageCounts["TLS"] != 1 || wa.TimeoutStageCounts["DNS"] != 0 {
+		t.Errorf("TimeoutStageCounts = %v, want only TLS", wa.TimeoutStageCounts)
+	}
+}
+
+func TestInMemoryAggregatorUploadOnly(t *testing.T) {
+	key := AggregateKey{
+		ClientID:      "test-client",
+		Target:        "https://example.com",
+		WindowStartTs: parseTime("2024-01-01T00:00:00Z"),
+	}
+	agg := NewInMemoryAggregator(key)
+
+	// An upload-only test has no download throughput, which must not be
+	// counted as a 0 kbps download sample
+	agg.AddEvent(&TelemetryEvent{
+		EventID:        "event-1",
+		ClientID:       "test-client",
+		TimestampMs:    1704067200000,
+		Target:         "https://example.com",
+		ThroughputKbps: 8000.0,
+	})
+	agg.AddEvent(&TelemetryEvent{
+		EventID:     "event-2",
+		ClientID:    "test-client",
+		TimestampMs: 1704067210000,
+		Target:      "https://example.com",
+		UploadKbps:  2000.0,
+	})
+
+	wa := agg.ToWindowedAggregate()
+	if wa.ThroughputP50 != 8000.0 {
+		t.Errorf("WindowedAggregate.ThroughputP50 = %v, want 8000.0", wa.ThroughputP50)
+	}
+	if len(agg.UploadSamples) != 1 {
+		t.Errorf("UploadSamples = %v, want 1 sample", agg.UploadSamples)
+	}
+}
+
+func TestInMemoryAggregatorEcho(t *testing.T) {
+	key := AggregateKey{
+		ClientID:      "test-client",
+		Target:        "udp://echo.example.com:7001",
+		CheckType:     CheckTypeUDPEcho,
+		WindowStartTs: parseTime("2024-01-01T00:00:00Z"),
+	}
+
+	agg := NewInMemoryAggregator(key)
+
+	agg.AddEvent(&TelemetryEvent{
+		EventID:     "event-1",
+		ClientID:    "test-client",
+		TimestampMs: 1704067200000,
+		Target:      key.Target,
+		CheckType:   CheckTypeUDPEcho,
+		Echo: &EchoMeasurements{
+			PacketsSent:     50,
+			PacketsReceived: 45,
+			ReorderedCount:  2,
+			RTTP50Ms:        20.0,
+			RTTP95Ms:        40.0,
+			JitterMs:        3.0,
+		},
+	})
+
+	// A train without any reply still counts towards packet loss
+	errorStage := ErrorStageUDP
+	agg.AddEvent(&TelemetryEvent{
+		EventID:     "event-2",
+		ClientID:    "test-client",
+		TimestampMs: 1704067210000,
+		Target:      key.Target,
+		CheckType:   CheckTypeUDPEcho,
+		ErrorStage:  &errorStage,
+		Echo:        &EchoMeasurements{PacketsSent: 50, LossRate: 1},
+	})
+
+	wa := agg.ToWindowedAggregate()
+	if wa.CheckType != CheckTypeUDPEcho {
+		t.Errorf("CheckType = %v, want %v", wa.CheckType, CheckTypeUDPEcho)
+	}
+	if wa.PacketsSent != 100 || wa.PacketsLost != 55 {
+		t.Errorf("PacketsSent/PacketsLost = %v/%v, want 100/55", wa.PacketsSent, wa.PacketsLost)
+	}
+	if wa.LossRate != 0.55 {
+		t.Errorf("LossRate = %v, want 0.55", wa.LossRate)
+	}
+	if wa.ReorderedCount != 2 {
+		t.Errorf("ReorderedCount = %v, want 2", wa.ReorderedCount)
+	}
+	if wa.RTTP50 != 20.0 || wa.JitterP50 != 3.0 {
+		t.Errorf("RTTP50/JitterP50 = %v/%v, want 20/3", wa.RTTP50, wa.JitterP50)
+	}
+}
+
+func TestInMemoryAggregatorCustomMetrics(t *testing.T) {
+	key := AggregateKey{
+		ClientID:      "test-client",
+		Target:        "https://example.com",
+		CheckType:     CheckTypeHTTP,
+		WindowStartTs: parseTime("2024-01-01T00:00:00Z"),
+	}
+
+	agg := NewInMemoryAggregator(key)
+	for i, signal := range []float64{-60, -70, -80} {
+		event := &TelemetryEvent{
+			EventID:       "event",
+			ClientID:      "test-client",
+			TimestampMs:   1704067200000 + int64(i)*10000,
+			Target:        key.Target,
+			CustomMetrics: map[string]float64{"wifi.signal_dbm": signal},
+		}
+		// Host metrics are kept for failed measurements too
+		if i == 2 {
+			errorStage := ErrorStageTCP
+			event.ErrorStage = &errorStage
+			event.CustomMetrics["cpu.load1"] = 1.5
+		}
+		agg.AddEvent(event)
+	}
+
+	wa := agg.ToWindowedAggregate()
+	if len(wa.CustomMetrics) != 2 {
+		t.Fatalf("CustomMetrics has %d entries, want 2", len(wa.CustomMetrics))
+	}
+	signal := wa.CustomMetrics["wifi.signal_dbm"]
+	want := CustomMetricStats{Count: 3, Min: -80, Max: -60, Mean: -70, P50: -70, P95: -61}
+	if signal != want {
+		t.Errorf("wifi.signal_dbm = %+v, want %+v", signal, want)
+	}
+	if load := wa.CustomMetrics["cpu.load1"]; load.Count != 1 || load.P95 != 1.5 {
+		t.Errorf("cpu.load1 = %+v, want one sample of 1.5", load)
+	}
+
+	// Windows without collector metrics have no custom metrics
+	if wa := NewInMemoryAggregator(key).ToWindowedAggregate(); wa.CustomMetrics != nil {
+		t.Errorf("CustomMetrics = %v, want nil", wa.CustomMetrics)
+	}
+}
+
+func TestInMemoryAggregatorNetworkAttributes(t *testing.T) {
+	key := AggregateKey{
+		ClientID:      "test-client",
+		Target:        "https://example.com",
+		CheckType:     CheckTypeHTTP,
+		WindowStartTs: parseTime("2024-01-01T00:00:00Z"),
+	}
+	label := "office"
+
+	agg := NewInMemoryAggregator(key)
+	for i, nc := range []NetworkContext{
+		{ASN: 64500, ASOrg: "Example ISP", UserLabel: &label},
+		{ASN: 64501, ASOrg: "Other ISP"},
+		// Events without a lookup keep the last known attributes
+		{},
+	} {
+		agg.AddEvent(&TelemetryEvent{
+			EventID:        "event",
+			ClientID:       "test-client",
+			TimestampMs:    1704067200000 + int64(i)*10000,
+			Target:         key.Target,
+			NetworkContext: nc,
+		})
+	}
+
+	wa := agg.ToWindowedAggregate()
+	if wa.ASN != 64501 || wa.ASOrg != "Other ISP" {
+		t.Errorf("ASN = %d %q, want 64501 \"Other ISP\"", wa.ASN, wa.ASOrg)
+	}
+	if wa.UserLabel != "office" {
+		t.Errorf("UserLabel = %q, want \"office\"", wa.UserLabel)
+	}
 }
 
 func TestWindowedAggregateRates(t *testing.T) {
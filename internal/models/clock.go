@@ -0,0 +1,90 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Clock skew handling modes for the ingest service
+const (
+	// ClockSkewModeCorrect shifts ts_ms by the skew when it exceeds the
+	// threshold
+	ClockSkewModeCorrect = "correct"
+
+	// ClockSkewModeFlag only marks skewed events
+	ClockSkewModeFlag = "flag"
+)
+
+// ValidClockSkewMode reports whether mode is a supported clock skew mode
+func ValidClockSkewMode(mode string) bool {
+	return mode == ClockSkewModeCorrect || mode == ClockSkewModeFlag
+}
+
+// ApplyClockSkew determines the clock skew of an event received at recvMs
+// and corrects or flags it when the skew exceeds thresholdMs. It returns
+// true if ts_ms was changed.
+//
+// The probe-reported clock offset is used when present. Otherwise the skew
+// is estimated on the server, which only works for timestamps ahead of the
+// receive time: an old timestamp may just be an event the probe buffered
+// during an outage, so it is never attributed to skew. A timestamp ahead is
+// corrected to the receive time.
+func ApplyClockSkew(e *TelemetryEvent, recvMs, thresholdMs int64, mode string) bool {
+	e.ClockSkewMs = nil
+	e.ClockSkewed = false
+	e.OriginalTimestampMs = nil
+
+	var skewMs int64
+	reported := e.ClockOffsetMs != nil && !math.IsNaN(*e.ClockOffsetMs) && !math.IsInf(*e.ClockOffsetMs, 0)
+	switch {
+	case reported:
+		skewMs = int64(math.Round(*e.ClockOffsetMs))
+	case e.TimestampMs > recvMs:
+		skewMs = recvMs - e.TimestampMs
+	default:
+		return false
+	}
+	e.ClockSkewMs = &skewMs
+
+	if skewMs <= thresholdMs && skewMs >= -thresholdMs {
+		return false
+	}
+	e.ClockSkewed = true
+
+	if mode != ClockSkewModeCorrect {
+		return false
+	}
+	original := e.TimestampMs
+	e.OriginalTimestampMs = &original
+	e.TimestampMs += skewMs
+	return true
+}
+
+// ClockSyncResponse is returned by the ingest time endpoint. Together with
+// the probe's own send and receive times it gives an NTP-style estimate of
+// the clock offset. Times are milliseconds since epoch with sub-millisecond
+// precision.
+type ClockSyncResponse struct {
+	// ClientSendMs echoes the probe's send time (t0), if it passed one
+	ClientSendMs float64 `json:"client_send_ms,omitempty"`
+
+	// ServerRecvMs is when the server received the request (t1)
+	ServerRecvMs float64 `json:"server_recv_ms"`
+
+	// ServerSendMs is when the server wrote the response (t2)
+	ServerSendMs float64 `json:"server_send_ms"`
+}
+
+// UnixMillis returns t in milliseconds since epoch with sub-millisecond
+// precision, as used by the clock sync exchange
+func UnixMillis(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1000.0
+}
+
+// ClockOffset computes the NTP clock offset (server minus client) and
+// round-trip delay from the four exchange timestamps in milliseconds
+func ClockOffset(t0, t1, t2, t3 float64) (offsetMs, rttMs float64) {
+	offsetMs = ((t1 - t0) + (t2 - t3)) / 2
+	rttMs = (t3 - t0) - (t2 - t1)
+	return offsetMs, rttMs
+}
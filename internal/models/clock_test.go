@@ -0,0 +1,107 @@
+package models
+
+import "testing"
+
+func TestApplyClockSkew(t *testing.T) {
+	const recvMs = int64(1_700_000_060_000)
+	offset := func(ms float64) *float64 { return &ms }
+
+	tests := []struct {
+		name          string
+		tsMs          int64
+		offsetMs      *float64
+		mode          string
+		wantCorrected bool
+		wantSkewed    bool
+		wantSkewMs    *int64
+		wantTsMs      int64
+	}{
+		{
+			name:       "small reported offset",
+			tsMs:       recvMs - 500,
+			offsetMs:   offset(120.4),
+			mode:       ClockSkewModeCorrect,
+			wantSkewMs: ptrInt64(120),
+			wantTsMs:   recvMs - 500,
+		},
+		{
+			name:          "probe clock behind is corrected",
+			tsMs:          recvMs - 300_000,
+			offsetMs:      offset(299_800),
+			mode:          ClockSkewModeCorrect,
+			wantCorrected: true,
+			wantSkewed:    true,
+			wantSkewMs:    ptrInt64(299_800),
+			wantTsMs:      recvMs - 200,
+		},
+		{
+			name:       "flag mode leaves timestamp",
+			tsMs:       recvMs + 600_000,
+			offsetMs:   offset(-600_000),
+			mode:       ClockSkewModeFlag,
+			wantSkewed: true,
+			wantSkewMs: ptrInt64(-600_000),
+			wantTsMs:   recvMs + 600_000,
+		},
+		{
+			name:          "future timestamp without offset is corrected",
+			tsMs:          recvMs + 90_000,
+			mode:          ClockSkewModeCorrect,
+			wantCorrected: true,
+			wantSkewed:    true,
+			wantSkewMs:    ptrInt64(-90_000),
+			wantTsMs:      recvMs,
+		},
+		{
+			name:       "future timestamp without offset in flag mode",
+			tsMs:       recvMs + 90_000,
+			mode:       ClockSkewModeFlag,
+			wantSkewed: true,
+			wantSkewMs: ptrInt64(-90_000),
+			wantTsMs:   recvMs + 90_000,
+		},
+		{
+			name:     "old timestamp without offset is not skew",
+			tsMs:     recvMs - 3_600_000,
+			mode:     ClockSkewModeCorrect,
+			wantTsMs: recvMs - 3_600_000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &TelemetryEvent{TimestampMs: tt.tsMs, ClockOffsetMs: tt.offsetMs}
+			corrected := ApplyClockSkew(e, recvMs, 5000, tt.mode)
+
+			if corrected != tt.wantCorrected {
+				t.Errorf("ApplyClockSkew() = %v, want %v", corrected, tt.wantCorrected)
+			}
+			if e.ClockSkewed != tt.wantSkewed {
+				t.Errorf("ClockSkewed = %v, want %v", e.ClockSkewed, tt.wantSkewed)
+			}
+			if (e.ClockSkewMs == nil) != (tt.wantSkewMs == nil) ||
+				(e.ClockSkewMs != nil && *e.ClockSkewMs != *tt.wantSkewMs) {
+				t.Errorf("ClockSkewMs = %v, want %v", e.ClockSkewMs, tt.wantSkewMs)
+			}
+			if e.TimestampMs != tt.wantTsMs {
+				t.Errorf("TimestampMs = %d, want %d", e.TimestampMs, tt.wantTsMs)
+			}
+			if corrected && (e.OriginalTimestampMs == nil || *e.OriginalTimestampMs != tt.tsMs) {
+				t.Errorf("OriginalTimestampMs = %v, want %d", e.OriginalTimestampMs, tt.tsMs)
+			}
+		})
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	// Server clock 100ms ahead, 20ms each way, 1ms server processing
+	offset, rtt := ClockOffset(1000, 1120, 1121, 1041)
+	if offset != 100 {
+		t.Errorf("offset = %v, want 100", offset)
+	}
+	if rtt != 40 {
+		t.Errorf("rtt = %v, want 40", rtt)
+	}
+}
+
+func ptrInt64(v int64) *int64 { return &v }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// MaxCustomMetrics caps the number of custom metrics attached to one event
+const MaxCustomMetrics = 64
+
+// maxCustomMetricNameLen caps the length of a custom metric name
+const maxCustomMetricNameLen = 64
+
+// customMetricNameRe matches lower-case dotted names such as "wifi.signal_dbm"
+var customMetricNameRe = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+
+// ValidCustomMetricName reports whether name is usable as a custom metric name
+func ValidCustomMetricName(name string) bool {
+	return len(name) <= maxCustomMetricNameLen && customMetricNameRe.MatchString(name)
+}
+
+// ValidateCustomMetrics checks the custom metrics reported by probe collectors
+func ValidateCustomMetrics(metrics map[string]float64) error {
+	if len(metrics) > MaxCustomMetrics {
+		return fmt.Errorf("at most %d custom metrics are allowed, got %d", MaxCustomMetrics, len(metrics))
+	}
+	for name, value := range metrics {
+		if !ValidCustomMetricName(name) {
+			return fmt.Errorf("invalid custom metric name: %q", name)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("custom metric %s must be finite", name)
+		}
+	}
+	return nil
+}
+
+// CustomMetricStats summarizes the samples of one custom metric in a window
+type CustomMetricStats struct {
+	Count int64
+	Min   float64
+	Max   float64
+	Mean  float64
+	P50   float64
+	P95   float64
+}
+
+// computeCustomMetricStats summarizes a non-empty sample set
+func computeCustomMetricStats(samples []float64) CustomMetricStats {
+	stats := CustomMetricStats{
+		Count: int64(len(samples)),
+		Min:   samples[0],
+		Max:   samples[0],
+	}
+	var sum float64
+	for _, v := range samples {
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+		sum += v
+	}
+	stats.Mean = sum / float64(len(samples))
+	stats.P50 = calculatePercentile(samples, 50)
+	stats.P95 = calculatePercentile(samples, 95)
+	return stats
+}
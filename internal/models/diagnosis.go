@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WindowFlushed tells the diagnoser that an aggregate window was written to
+// agg_1m. A window can be flushed more than once when late events arrive.
+type WindowFlushed struct {
+	ClientID      string    `json:"client_id"`
+	Target        string    `json:"target"`
+	AddressFamily string    `json:"address_family,omitempty"`
+	CheckType     string    `json:"check_type,omitempty"`
+	WindowStartTs time.Time `json:"window_start_ts"`
+
+	// FlushedAt is when the aggregator wrote the window
+	FlushedAt time.Time `json:"flushed_at"`
+
+	// Late is set when the window was flushed after its normal flush time,
+	// i.e. it was updated by late events
+	Late bool `json:"late,omitempty"`
+}
+
+// Validate checks if the WindowFlushed notification has valid data
+func (w *WindowFlushed) Validate() error {
+	if w.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if w.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	if w.WindowStartTs.IsZero() {
+		return fmt.Errorf("window_start_ts is required")
+	}
+	return nil
+}
+
+// DiagnosisEvent is published by the diagnoser for each window whose
+// diagnosis is an issue or differs from the window's previous diagnosis
+type DiagnosisEvent struct {
+	ClientID      string    `json:"client_id"`
+	Target        string    `json:"target"`
+	AddressFamily string    `json:"address_family,omitempty"`
+	CheckType     string    `json:"check_type,omitempty"`
+	WindowStartTs time.Time `json:"window_start_ts"`
+
+	// Label is the diagnosis; empty means the window is healthy
+	Label string `json:"label,omitempty"`
+
+	// Labels lists every issue found in priority order, Label first;
+	// Confidence is the confidence of Label between 0 and 1
+	Labels     []string `json:"labels,omitempty"`
+	Confidence float64  `json:"confidence,omitempty"`
+
+	// Details is the full diagnosis result with the evidence of each issue
+	Details json.RawMessage `json:"details,omitempty"`
+
+	// PreviousLabel is the label of the client's previous window for the
+	// target, or the window's own earlier label when it was re-diagnosed
+	PreviousLabel string `json:"previous_label,omitempty"`
+
+	// Revision counts how often the window was diagnosed; it is above 1 when
+	// a window was re-diagnosed after late events
+	Revision int `json:"revision"`
+
+	// TargetClients is the number of clients that measured the target in
+	// the window, TargetAffectedClients how many of them have an issue
+	TargetClients         int `json:"target_clients"`
+	TargetAffectedClients int `json:"target_affected_clients"`
+
+	// SilenceIDs are the silences active for the series in the window;
+	// Maintenance is set if one of them is a maintenance window, whose
+	// windows are kept out of the baselines
+	SilenceIDs  []int64 `json:"silence_ids,omitempty"`
+	Maintenance bool    `json:"maintenance,omitempty"`
+
+	DiagnosedAt time.Time `json:"diagnosed_at"`
+}
+
+// Changed reports whether the diagnosis differs from the previous one
+func (d *DiagnosisEvent) Changed() bool {
+	return d.Label != d.PreviousLabel
+}
+
+// Resolved reports whether the event ends an issue
+func (d *DiagnosisEvent) Resolved() bool {
+	return d.Label == "" && d.PreviousLabel != ""
+}
+
+// CorrelatedIncident is published by the diagnoser for each group of
+// anomalous series in a window explained by one cause: a target degraded
+// for most of its clients (target-wide), a client or a network (ASN or
+// label) degraded on most targets (client-wide), or a single client on a
+// single target (localized)
+type CorrelatedIncident struct {
+	ID            int64     `json:"id"`
+	WindowStartTs time.Time `json:"window_start_ts"`
+
+	// Scope is target-wide, client-wide or localized; Key identifies the
+	// incident within the window, e.g. "target:<url>" or "asn:<number>"
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+
+	// Label is the most common diagnosis among the affected series, Labels
+	// counts each diagnosis
+	Label  string         `json:"label"`
+	Labels map[string]int `json:"labels"`
+
+	Clients []string `json:"clients"`
+	Targets []string `json:"targets"`
+
+	// Affected is the number of anomalous series, Observed the number of
+	// series measured within the incident's scope
+	Affected int `json:"affected"`
+	Observed int `json:"observed"`
+
+	// Revision counts how often the incident changed as the window was
+	// correlated again after late diagnoses
+	Revision int `json:"revision"`
+
+	CorrelatedAt time.Time `json:"correlated_at"`
+}
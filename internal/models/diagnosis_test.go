@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowFlushedValidate(t *testing.T) {
+	valid := func() *WindowFlushed {
+		return &WindowFlushed{
+			ClientID:      "probe-1",
+			Target:        "https://example.com",
+			WindowStartTs: time.Unix(1700000040, 0),
+			FlushedAt:     time.Unix(1700000110, 0),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(w *WindowFlushed)
+		wantErr string
+	}{
+		{
+			name:   "valid notification",
+			mutate: func(w *WindowFlushed) {},
+		},
+		{
+			name:    "missing client id",
+			mutate:  func(w *WindowFlushed) { w.ClientID = "" },
+			wantErr: "client_id is required",
+		},
+		{
+			name:    "missing target",
+			mutate:  func(w *WindowFlushed) { w.Target = "" },
+			wantErr: "target is required",
+		},
+		{
+			name:    "missing window start",
+			mutate:  func(w *WindowFlushed) { w.WindowStartTs = time.Time{} },
+			wantErr: "window_start_ts is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := valid()
+			tt.mutate(w)
+			err := w.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiagnosisEventTransitions(t *testing.T) {
+	tests := []struct {
+		name         string
+		label        string
+		previous     string
+		wantChanged  bool
+		wantResolved bool
+	}{
+		{name: "still healthy"},
+		{name: "issue starts", label: "dns-bound", wantChanged: true},
+		{name: "issue continues", label: "dns-bound", previous: "dns-bound"},
+		{name: "issue changes", label: "server-bound", previous: "dns-bound", wantChanged: true},
+		{name: "issue resolves", previous: "dns-bound", wantChanged: true, wantResolved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &DiagnosisEvent{Label: tt.label, PreviousLabel: tt.previous}
+			if got := e.Changed(); got != tt.wantChanged {
+				t.Errorf("Changed() = %v, want %v", got, tt.wantChanged)
+			}
+			if got := e.Resolved(); got != tt.wantResolved {
+				t.Errorf("Resolved() = %v, want %v", got, tt.wantResolved)
+			}
+		})
+	}
+}
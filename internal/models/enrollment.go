@@ -0,0 +1,116 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EnrollmentCodeAlphabet is the Crockford base32 alphabet enrollment codes
+// are drawn from; it leaves out I, L, O and U so codes survive being read out
+const EnrollmentCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// EnrollmentCodeLength is the number of characters in an enrollment code,
+// not counting separators
+const EnrollmentCodeLength = 16
+
+// EnrollRequest is sent by a probe to exchange an enrollment code for its
+// identity and credentials
+type EnrollRequest struct {
+	// Code is the enrollment code created by an admin
+	Code string `json:"code"`
+
+	// ClientID is the probe's existing client ID, used unless the code pins one
+	ClientID string `json:"client_id,omitempty"`
+
+	// Hostname and ProbeVersion describe the enrolling probe for the audit log
+	Hostname     string `json:"hostname,omitempty"`
+	ProbeVersion string `json:"probe_version,omitempty"`
+}
+
+// EnrollResponse carries what an enrolled probe needs to start measuring
+type EnrollResponse struct {
+	EnrollmentID string `json:"enrollment_id"`
+	ClientID     string `json:"client_id"`
+
+	// APIToken authenticates the probe with the ingest API; it is only
+	// returned once
+	APIToken string `json:"api_token"`
+
+	Config EnrollmentConfig `json:"config"`
+}
+
+// EnrollmentConfig is the initial probe configuration attached to an
+// enrollment code
+type EnrollmentConfig struct {
+	// IngestURL is the ingest events endpoint the probe reports to
+	IngestURL string `json:"ingest_url"`
+
+	// IntervalSeconds is the measurement interval; zero keeps the probe default
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+
+	// Targets is a targets file (a JSON array of targets); empty keeps the
+	// probe's own targets
+	Targets json.RawMessage `json:"targets,omitempty"`
+}
+
+// Validate checks the enrollment configuration
+func (c *EnrollmentConfig) Validate() error {
+	if c.IngestURL == "" {
+		return fmt.Errorf("ingest_url is required")
+	}
+	if c.IntervalSeconds < 0 {
+		return fmt.Errorf("interval_seconds must be non-negative")
+	}
+	if len(c.Targets) > 0 {
+		var targets []json.RawMessage
+		if err := json.Unmarshal(c.Targets, &targets); err != nil {
+			return fmt.Errorf("targets must be a JSON array: %w", err)
+		}
+	}
+	return nil
+}
+
+// NormalizeEnrollmentCode upper-cases a code and strips the separators and
+// whitespace people add when copying it, mapping look-alike letters the way
+// Crockford base32 does. It returns "" if the result is not a valid code.
+func NormalizeEnrollmentCode(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		switch r {
+		case '-', ' ', '\t':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		if !strings.ContainsRune(EnrollmentCodeAlphabet, r) {
+			return ""
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() != EnrollmentCodeLength {
+		return ""
+	}
+	return b.String()
+}
+
+// FormatEnrollmentCode groups a normalized code in blocks of four for display
+func FormatEnrollmentCode(code string) string {
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+// HashCredential returns the hex SHA-256 of an enrollment code or probe
+// token; only hashes are stored
+func HashCredential(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeEnrollmentCode(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{
+			name: "formatted",
+			code: "ABCD-EFGH-JKMN-PQRS",
+			want: "ABCDEFGHJKMNPQRS",
+		},
+		{
+			name: "lower case with spaces",
+			code: " abcd efgh jkmn pqrs ",
+			want: "ABCDEFGHJKMNPQRS",
+		},
+		{
+			name: "look-alike letters",
+			code: "O0IL-0000-0000-0000",
+			want: "0011000000000000",
+		},
+		{
+			name: "too short",
+			code: "ABCD-EFGH",
+			want: "",
+		},
+		{
+			name: "invalid character",
+			code: "ABCD-EFGH-JKMN-PQRU",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeEnrollmentCode(tt.code); got != tt.want {
+				t.Errorf("NormalizeEnrollmentCode(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatEnrollmentCode(t *testing.T) {
+	got := FormatEnrollmentCode("ABCDEFGHJKMNPQRS")
+	if got != "ABCD-EFGH-JKMN-PQRS" {
+		t.Errorf("FormatEnrollmentCode() = %q, want ABCD-EFGH-JKMN-PQRS", got)
+	}
+	if NormalizeEnrollmentCode(got) != "ABCDEFGHJKMNPQRS" {
+		t.Errorf("formatted code does not normalize back")
+	}
+}
+
+func TestEnrollmentConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EnrollmentConfig
+		wantErr bool
+	}{
+		{
+			name:   "ingest url only",
+			config: EnrollmentConfig{IngestURL: "http://ingest:8081/events"},
+		},
+		{
+			name: "with targets",
+			config: EnrollmentConfig{
+				IngestURL:       "http://ingest:8081/events",
+				IntervalSeconds: 30,
+				Targets:         json.RawMessage(`[{"url": "https://example.com"}]`),
+			},
+		},
+		{
+			name:    "missing ingest url",
+			config:  EnrollmentConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "targets not an array",
+			config:  EnrollmentConfig{IngestURL: "http://ingest:8081/events", Targets: json.RawMessage(`{"url": "x"}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,24 +25,75 @@ type TelemetryEvent struct {
 	// RecvTimestampMs is set by the ingest service for clock skew debugging
 	RecvTimestampMs *int64 `json:"recv_ts_ms,omitempty"`
 
+	// ClockOffsetMs is the probe's estimate of the ingest server clock minus
+	// its own clock, from its last clock sync; nil if it has not synced
+	ClockOffsetMs *float64 `json:"clock_offset_ms,omitempty"`
+
+	// ClockSkewMs is the skew the ingest service attributed to the event
+	// (server minus probe), set by ingest
+	ClockSkewMs *int64 `json:"clock_skew_ms,omitempty"`
+
+	// ClockSkewed is set by ingest when the skew exceeded its threshold
+	ClockSkewed bool `json:"clock_skewed,omitempty"`
+
+	// OriginalTimestampMs is the probe-supplied ts_ms when ingest corrected
+	// the timestamp for clock skew
+	OriginalTimestampMs *int64 `json:"orig_ts_ms,omitempty"`
+
 	// SchemaVersion indicates the event structure version for backward compatibility
 	SchemaVersion string `json:"schema_version"`
 
 	// Target is the endpoint being measured (e.g., "https://example.com")
 	Target string `json:"target"`
 
+	// CheckType is the kind of check that produced the event: http, tcp or
+	// udp. Empty is treated as http for compatibility with older probes.
+	CheckType string `json:"check_type,omitempty"`
+
 	// NetworkContext provides additional context about the network environment
 	NetworkContext NetworkContext `json:"network_context"`
 
 	// Timings contains the detailed network timing measurements
 	Timings TimingMeasurements `json:"timings"`
 
-	// ThroughputKbps is the measured throughput in kilobits per second
+	// ThroughputKbps is the measured download throughput in kilobits per second,
+	// zero when no download test ran (e.g. upload-only throughput tests)
 	ThroughputKbps float64 `json:"throughput_kbps"`
 
-	// ErrorStage indicates which stage failed (if any): DNS, TCP, TLS, HTTP, or throughput
+	// UploadKbps is the measured upload throughput in kilobits per second,
+	// zero when no upload test was configured
+	UploadKbps float64 `json:"upload_kbps,omitempty"`
+
+	// ThroughputStreams is the number of parallel streams used by the
+	// throughput test (omitted for the default single-stream download)
+	ThroughputStreams int `json:"throughput_streams,omitempty"`
+
+	// RemoteAddr is the IP:port the probe actually connected to, if known
+	RemoteAddr *string `json:"remote_addr,omitempty"`
+
+	// HTTPStatusCode is the status code of the target response, if one was received
+	HTTPStatusCode int `json:"http_status_code,omitempty"`
+
+	// Echo holds packet train statistics for udp-echo loss/jitter checks
+	Echo *EchoMeasurements `json:"echo,omitempty"`
+
+	// Transaction identifies the transaction and step for scripted
+	// multi-step probes; nil for single-request targets
+	Transaction *TransactionInfo `json:"transaction,omitempty"`
+
+	// CustomMetrics holds the values reported by the probe's metric
+	// collectors in the cycle that produced this event, keyed by
+	// "<collector>.<metric>" (e.g. "wifi.signal_dbm")
+	CustomMetrics map[string]float64 `json:"custom_metrics,omitempty"`
+
+	// ErrorStage indicates which stage failed (if any): DNS, TCP, TLS, HTTP, UDP, proxy, assertion, or throughput
 	ErrorStage *string `json:"error_stage,omitempty"`
 
+	// TimedOut is set when the failing stage ran out of time (its own
+	// timeout or the overall measurement timeout) rather than failing
+	// outright; ErrorStage is the stage that timed out
+	TimedOut bool `json:"timed_out,omitempty"`
+
 	// TraceParent carries W3C traceparent for cross-service trace propagation
 	// Optional and populated by ingest before publishing to the queue
 	TraceParent *string `json:"traceparent,omitempty"`
@@ -63,8 +115,52 @@ type NetworkContext struct {
 
 	// UserLabel is an optional custom label for user-defined categorization
 	UserLabel *string `json:"user_label,omitempty"`
+
+	// AddressFamily is the address family the measurement was restricted to
+	// ("ipv4", "ipv6" or "happy-eyeballs"); empty means system default
+	AddressFamily string `json:"address_family,omitempty"`
+
+	// ConnectedFamily is the address family the probe actually connected
+	// over ("ipv4" or "ipv6"). With AddressFamily "happy-eyeballs" it is the
+	// family that won the race, so a broken IPv6 path hidden by the IPv4
+	// fallback shows up as "ipv4".
+	ConnectedFamily string `json:"connected_family,omitempty"`
+
+	// InterfaceName is the detected egress interface (e.g. "wlan0")
+	InterfaceName string `json:"interface_name,omitempty"`
+
+	// LocalIP is the source address used for the measurement
+	LocalIP string `json:"local_ip,omitempty"`
+
+	// Gateway is the next hop of the default route
+	Gateway string `json:"gateway,omitempty"`
+
+	// VPNInterface is the tunnel interface carrying the default route when
+	// VPNEnabled was detected
+	VPNInterface string `json:"vpn_interface,omitempty"`
+
+	// PublicIP, ASN and ASOrg describe the public address the probe was seen
+	// from, when a public IP echo endpoint is configured
+	PublicIP string `json:"public_ip,omitempty"`
+	ASN      int    `json:"asn,omitempty"`
+	ASOrg    string `json:"as_org,omitempty"`
+
+	// Proxy is the proxy the measurement went through, without credentials
+	Proxy string `json:"proxy,omitempty"`
+
+	// SourceBound reports whether the measurement was bound to a configured
+	// source interface or address; InterfaceName and LocalIP then describe
+	// the uplink it used
+	SourceBound bool `json:"source_bound,omitempty"`
 }
 
+// Address family values for NetworkContext.AddressFamily
+const (
+	AddressFamilyIPv4          = "ipv4"
+	AddressFamilyIPv6          = "ipv6"
+	AddressFamilyHappyEyeballs = "happy-eyeballs"
+)
+
 // TimingMeasurements contains detailed network timing measurements in milliseconds.
 //
 // Requirements: 1.1, 1.2, 1.3, 1.4
@@ -80,6 +176,10 @@ type TimingMeasurements struct {
 
 	// HTTPTTFBMs is HTTP time-to-first-byte in milliseconds
 	HTTPTTFBMs float64 `json:"http_ttfb_ms"`
+
+	// ProxyConnectMs is the HTTP CONNECT or SOCKS5 handshake time with the
+	// proxy in milliseconds; TCPMs is then the connect time to the proxy
+	ProxyConnectMs float64 `json:"proxy_connect_ms,omitempty"`
 }
 
 // Validate checks if the TelemetryEvent has valid data.
@@ -115,11 +215,32 @@ func (e *TelemetryEvent) Validate() error {
 		return fmt.Errorf("target is required")
 	}
 
+	switch e.CheckType {
+	case "", CheckTypeHTTP, CheckTypeTCP, CheckTypeUDP, CheckTypeUDPEcho:
+	default:
+		return fmt.Errorf("unsupported check_type: %s", e.CheckType)
+	}
+
 	// Validate NetworkContext
 	if err := e.NetworkContext.Validate(); err != nil {
 		return fmt.Errorf("invalid network_context: %w", err)
 	}
 
+	// Validate echo statistics (also reported for failed trains)
+	if e.Echo != nil {
+		if err := e.Echo.Validate(); err != nil {
+			return fmt.Errorf("invalid echo: %w", err)
+		}
+	}
+
+	if err := ValidateCustomMetrics(e.CustomMetrics); err != nil {
+		return fmt.Errorf("invalid custom_metrics: %w", err)
+	}
+
+	if e.TimedOut && e.ErrorStage == nil {
+		return fmt.Errorf("timed_out requires error_stage")
+	}
+
 	// Validate Timings (only if no error occurred)
 	if e.ErrorStage == nil {
 		if err := e.Timings.Validate(); err != nil {
@@ -130,8 +251,51 @@ func (e *TelemetryEvent) Validate() error {
 		if e.ThroughputKbps < 0 {
 			return fmt.Errorf("throughput_kbps must be non-negative")
 		}
+		if e.UploadKbps < 0 {
+			return fmt.Errorf("upload_kbps must be non-negative")
+		}
+	}
+
+	return nil
+}
+
+// GetCheckType returns the event check type, defaulting to http
+func (e *TelemetryEvent) GetCheckType() string {
+	if e.CheckType == "" {
+		return CheckTypeHTTP
 	}
+	return e.CheckType
+}
+
+// EchoMeasurements holds the results of a UDP echo packet train
+type EchoMeasurements struct {
+	PacketsSent     int     `json:"packets_sent"`
+	PacketsReceived int     `json:"packets_received"`
+	LossRate        float64 `json:"loss_rate"`
+	ReorderedCount  int     `json:"reordered_count"`
+	DuplicateCount  int     `json:"duplicate_count"`
+	RTTP50Ms        float64 `json:"rtt_p50_ms"`
+	RTTP95Ms        float64 `json:"rtt_p95_ms"`
+	RTTMaxMs        float64 `json:"rtt_max_ms"`
+
+	// JitterMs is the RFC 3550 interarrival jitter estimate
+	JitterMs float64 `json:"jitter_ms"`
+}
 
+// Validate checks if the EchoMeasurements have valid data.
+func (em *EchoMeasurements) Validate() error {
+	if em.PacketsSent < 0 || em.PacketsReceived < 0 || em.ReorderedCount < 0 || em.DuplicateCount < 0 {
+		return fmt.Errorf("packet counts must be non-negative")
+	}
+	if em.PacketsReceived > em.PacketsSent {
+		return fmt.Errorf("packets_received must not exceed packets_sent")
+	}
+	if em.LossRate < 0 || em.LossRate > 1 {
+		return fmt.Errorf("loss_rate must be between 0 and 1")
+	}
+	if em.RTTP50Ms < 0 || em.RTTP95Ms < 0 || em.RTTMaxMs < 0 || em.JitterMs < 0 {
+		return fmt.Errorf("rtt and jitter values must be non-negative")
+	}
 	return nil
 }
 
@@ -140,6 +304,28 @@ func (nc *NetworkContext) Validate() error {
 	if nc.InterfaceType == "" {
 		return fmt.Errorf("interface_type is required")
 	}
+	switch nc.AddressFamily {
+	case "", AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyHappyEyeballs:
+	default:
+		return fmt.Errorf("unsupported address_family: %s", nc.AddressFamily)
+	}
+	switch nc.ConnectedFamily {
+	case "", AddressFamilyIPv4, AddressFamilyIPv6:
+	default:
+		return fmt.Errorf("unsupported connected_family: %s", nc.ConnectedFamily)
+	}
+	for _, addr := range []struct{ field, value string }{
+		{"local_ip", nc.LocalIP},
+		{"gateway", nc.Gateway},
+		{"public_ip", nc.PublicIP},
+	} {
+		if addr.value != "" && net.ParseIP(addr.value) == nil {
+			return fmt.Errorf("%s is not a valid IP address: %s", addr.field, addr.value)
+		}
+	}
+	if nc.ASN < 0 {
+		return fmt.Errorf("asn must be non-negative")
+	}
 	return nil
 }
 
@@ -157,6 +343,9 @@ func (tm *TimingMeasurements) Validate() error {
 	if tm.HTTPTTFBMs < 0 {
 		return fmt.Errorf("http_ttfb_ms must be non-negative")
 	}
+	if tm.ProxyConnectMs < 0 {
+		return fmt.Errorf("proxy_connect_ms must be non-negative")
+	}
 	return nil
 }
 
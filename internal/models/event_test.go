@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -149,6 +150,214 @@ func TestTelemetryEventValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ipv6 address family",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+					AddressFamily: AddressFamilyIPv6,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported address family",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+					AddressFamily: "ipx",
+				},
+			},
+			wantErr: true,
+			errMsg:  "unsupported address_family",
+		},
+		{
+			name: "unsupported connected family",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType:   "ethernet",
+					AddressFamily:   AddressFamilyHappyEyeballs,
+					ConnectedFamily: AddressFamilyHappyEyeballs,
+				},
+			},
+			wantErr: true,
+			errMsg:  "unsupported connected_family",
+		},
+		{
+			name: "detected network context",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "wifi",
+					InterfaceName: "wlan0",
+					LocalIP:       "192.168.1.20",
+					Gateway:       "192.168.1.1",
+					PublicIP:      "2001:db8::20",
+					ASN:           64500,
+					ASOrg:         "Example ISP",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid gateway address",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+					Gateway:       "router.local",
+				},
+			},
+			wantErr: true,
+			errMsg:  "gateway is not a valid IP address",
+		},
+		{
+			name: "tcp check type",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "tcp://db.example.com:5432",
+				CheckType:     CheckTypeTCP,
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported check type",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "sctp://db.example.com:5432",
+				CheckType:     "sctp",
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+				},
+			},
+			wantErr: true,
+			errMsg:  "unsupported check_type",
+		},
+		{
+			name: "negative upload throughput",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "wifi",
+				},
+				UploadKbps: -1.0,
+			},
+			wantErr: true,
+			errMsg:  "upload_kbps must be non-negative",
+		},
+		{
+			name: "negative proxy connect time",
+			event: &TelemetryEvent{
+				EventID:       uuid.New().String(),
+				ClientID:      "test-client-123",
+				TimestampMs:   time.Now().UnixMilli(),
+				SchemaVersion: "1.0",
+				Target:        "https://example.com",
+				NetworkContext: NetworkContext{
+					InterfaceType: "ethernet",
+					Proxy:         "http://proxy.corp.example:3128",
+				},
+				Timings: TimingMeasurements{
+					DNSMs:          1.0,
+					TCPMs:          2.0,
+					ProxyConnectMs: -1.0,
+				},
+			},
+			wantErr: true,
+			errMsg:  "proxy_connect_ms must be non-negative",
+		},
+		{
+			name: "timed out without error stage",
+			event: &TelemetryEvent{
+				EventID:        uuid.New().String(),
+				ClientID:       "test-client-123",
+				TimestampMs:    time.Now().UnixMilli(),
+				SchemaVersion:  "1.0",
+				Target:         "https://example.com",
+				NetworkContext: NetworkContext{InterfaceType: "ethernet"},
+				TimedOut:       true,
+			},
+			wantErr: true,
+			errMsg:  "timed_out requires error_stage",
+		},
+		{
+			name: "custom metrics on failed event",
+			event: &TelemetryEvent{
+				EventID:        uuid.New().String(),
+				ClientID:       "test-client-123",
+				TimestampMs:    time.Now().UnixMilli(),
+				SchemaVersion:  "1.0",
+				Target:         "https://example.com",
+				NetworkContext: NetworkContext{InterfaceType: "wifi"},
+				ErrorStage:     stringPtr("DNS"),
+				CustomMetrics:  map[string]float64{"wifi.signal_dbm": -67, "cpu.load1": 0.4},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid custom metric name",
+			event: &TelemetryEvent{
+				EventID:        uuid.New().String(),
+				ClientID:       "test-client-123",
+				TimestampMs:    time.Now().UnixMilli(),
+				SchemaVersion:  "1.0",
+				Target:         "https://example.com",
+				NetworkContext: NetworkContext{InterfaceType: "wifi"},
+				CustomMetrics:  map[string]float64{"Wifi Signal": -67},
+			},
+			wantErr: true,
+			errMsg:  "invalid custom metric name",
+		},
+		{
+			name: "non-finite custom metric",
+			event: &TelemetryEvent{
+				EventID:        uuid.New().String(),
+				ClientID:       "test-client-123",
+				TimestampMs:    time.Now().UnixMilli(),
+				SchemaVersion:  "1.0",
+				Target:         "https://example.com",
+				NetworkContext: NetworkContext{InterfaceType: "wifi"},
+				CustomMetrics:  map[string]float64{"cpu.load1": math.Inf(1)},
+			},
+			wantErr: true,
+			errMsg:  "must be finite",
+		},
 	}
 
 	for _, tt := range tests {
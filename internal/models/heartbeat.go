@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Heartbeat is sent periodically by each probe so liveness can be tracked
+// independently of whether its measurements succeed
+type Heartbeat struct {
+	// ClientID is the stable identifier of the probe
+	ClientID string `json:"client_id"`
+
+	// TimestampMs is when the heartbeat was sent, in milliseconds since epoch
+	TimestampMs int64 `json:"ts_ms"`
+
+	// RecvTimestampMs is set by the ingest service
+	RecvTimestampMs *int64 `json:"recv_ts_ms,omitempty"`
+
+	// ProbeVersion is the probe build version
+	ProbeVersion string `json:"probe_version"`
+
+	// UptimeSeconds is how long the probe process has been running
+	UptimeSeconds int64 `json:"uptime_seconds"`
+
+	// ConfigVersion identifies the probe's loaded target configuration
+	ConfigVersion string `json:"config_version,omitempty"`
+
+	// IntervalSeconds is how often the probe sends heartbeats
+	IntervalSeconds int `json:"interval_seconds"`
+
+	// Targets is the number of configured targets
+	Targets int `json:"targets"`
+
+	// QueueDepth and DroppedEvents describe the probe's send queue
+	QueueDepth    int   `json:"queue_depth"`
+	DroppedEvents int64 `json:"dropped_events"`
+
+	// Host describes the machine the probe runs on
+	Host HostInfo `json:"host"`
+}
+
+// HostInfo describes the machine a probe runs on
+type HostInfo struct {
+	Hostname  string `json:"hostname,omitempty"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	NumCPU    int    `json:"num_cpu,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+}
+
+// Validate checks if the Heartbeat has valid data
+func (h *Heartbeat) Validate() error {
+	if h.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if h.TimestampMs <= 0 {
+		return fmt.Errorf("ts_ms must be positive")
+	}
+	if h.IntervalSeconds <= 0 {
+		return fmt.Errorf("interval_seconds must be positive")
+	}
+	if h.UptimeSeconds < 0 {
+		return fmt.Errorf("uptime_seconds must be non-negative")
+	}
+	if h.Targets < 0 {
+		return fmt.Errorf("targets must be non-negative")
+	}
+	if h.QueueDepth < 0 || h.DroppedEvents < 0 {
+		return fmt.Errorf("queue_depth and dropped_events must be non-negative")
+	}
+	return nil
+}
+
+// GetTimestamp returns the heartbeat time, preferring the ingest receive time
+// so misclocked probes are not marked offline
+func (h *Heartbeat) GetTimestamp() time.Time {
+	if h.RecvTimestampMs != nil && *h.RecvTimestampMs > 0 {
+		return time.UnixMilli(*h.RecvTimestampMs)
+	}
+	return time.UnixMilli(h.TimestampMs)
+}
+
+// Probe liveness states
+const (
+	ProbeStatusOnline  = "online"
+	ProbeStatusOffline = "offline"
+)
+
+// MinProbeOfflineAfter is the shortest default offline threshold, so a
+// single delayed heartbeat does not flap a probe offline
+const MinProbeOfflineAfter = 90 * time.Second
+
+// ProbeOfflineAfter returns how long a probe may go without a heartbeat
+// before it is considered offline. An explicit threshold wins; otherwise it
+// is three heartbeat intervals, but at least MinProbeOfflineAfter.
+func ProbeOfflineAfter(configured time.Duration, heartbeatInterval time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	threshold := 3 * heartbeatInterval
+	if threshold < MinProbeOfflineAfter {
+		threshold = MinProbeOfflineAfter
+	}
+	return threshold
+}
+
+// ProbeLiveness returns the liveness state of a probe last seen at lastSeen
+func ProbeLiveness(lastSeen, now time.Time, offlineAfter time.Duration) string {
+	if now.Sub(lastSeen) > offlineAfter {
+		return ProbeStatusOffline
+	}
+	return ProbeStatusOnline
+}
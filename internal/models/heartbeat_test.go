@@ -0,0 +1,91 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatValidate(t *testing.T) {
+	valid := func() *Heartbeat {
+		return &Heartbeat{
+			ClientID:        "probe-1",
+			TimestampMs:     time.Now().UnixMilli(),
+			ProbeVersion:    "1.2.0",
+			UptimeSeconds:   3600,
+			IntervalSeconds: 30,
+			Targets:         3,
+			Host:            HostInfo{OS: "linux", Arch: "amd64"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(h *Heartbeat)
+		wantErr string
+	}{
+		{
+			name:   "valid heartbeat",
+			mutate: func(h *Heartbeat) {},
+		},
+		{
+			name:    "missing client id",
+			mutate:  func(h *Heartbeat) { h.ClientID = "" },
+			wantErr: "client_id is required",
+		},
+		{
+			name:    "zero interval",
+			mutate:  func(h *Heartbeat) { h.IntervalSeconds = 0 },
+			wantErr: "interval_seconds must be positive",
+		},
+		{
+			name:    "negative queue depth",
+			mutate:  func(h *Heartbeat) { h.QueueDepth = -1 },
+			wantErr: "queue_depth",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := valid()
+			tt.mutate(h)
+			err := h.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbeLiveness(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		configured time.Duration
+		interval   time.Duration
+		lastSeen   time.Time
+		want       string
+	}{
+		{"recent heartbeat", 0, 30 * time.Second, now.Add(-40 * time.Second), ProbeStatusOnline},
+		{"short interval uses minimum threshold", 0, 10 * time.Second, now.Add(-60 * time.Second), ProbeStatusOnline},
+		{"missed three intervals", 0, 60 * time.Second, now.Add(-200 * time.Second), ProbeStatusOffline},
+		{"configured threshold wins", 10 * time.Minute, 60 * time.Second, now.Add(-5 * time.Minute), ProbeStatusOnline},
+		{"beyond configured threshold", 2 * time.Minute, 60 * time.Second, now.Add(-150 * time.Second), ProbeStatusOffline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ProbeLiveness(tt.lastSeen, now, ProbeOfflineAfter(tt.configured, tt.interval))
+			if got != tt.want {
+				t.Errorf("ProbeLiveness() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
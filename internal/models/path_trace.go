@@ -0,0 +1,237 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Path trace protocols
+const (
+	PathTraceProtocolTCP = "tcp"
+	PathTraceProtocolUDP = "udp"
+)
+
+// Path trace methods. TTL traces send TTL-limited probes and collect ICMP
+// replies from each hop, which needs raw socket privileges; without them the
+// probe falls back to a connect trace that only reports the destination.
+const (
+	PathTraceMethodTTL     = "ttl"
+	PathTraceMethodConnect = "connect"
+)
+
+// Path trace triggers
+const (
+	PathTraceTriggerSchedule = "schedule"
+	PathTraceTriggerLatency  = "latency"
+	PathTraceTriggerError    = "error"
+)
+
+// PathTraceEvent is a hop-by-hop path trace from a probe to a target. It is
+// shipped separately from TelemetryEvent since it is not aggregated into
+// windows; traces are stored individually for path-change detection.
+type PathTraceEvent struct {
+	// EventID uniquely identifies this trace (UUID format)
+	EventID string `json:"event_id"`
+
+	// ClientID is a stable identifier for the probe agent
+	ClientID string `json:"client_id"`
+
+	// TimestampMs is the trace start time in milliseconds since epoch
+	TimestampMs int64 `json:"ts_ms"`
+
+	// RecvTimestampMs is set by the ingest service for clock skew debugging
+	RecvTimestampMs *int64 `json:"recv_ts_ms,omitempty"`
+
+	// SchemaVersion indicates the event structure version
+	SchemaVersion string `json:"schema_version"`
+
+	// Target is the measured target the trace was run for
+	Target string `json:"target"`
+
+	// AddressFamily is the family the trace was run over, if pinned
+	AddressFamily string `json:"address_family,omitempty"`
+
+	// Protocol is the probe packet protocol: tcp or udp
+	Protocol string `json:"protocol"`
+
+	// Port is the destination port probed
+	Port int `json:"port"`
+
+	// Method is ttl or connect (unprivileged fallback)
+	Method string `json:"method"`
+
+	// Trigger is what started the trace: schedule, latency or error
+	Trigger string `json:"trigger"`
+
+	// DestinationIP is the resolved address of the target
+	DestinationIP string `json:"destination_ip,omitempty"`
+
+	// Reached reports whether the destination answered
+	Reached bool `json:"reached"`
+
+	// Hops lists the probed hops in TTL order
+	Hops []PathHop `json:"hops"`
+
+	// DurationMs is how long the trace took
+	DurationMs float64 `json:"duration_ms"`
+
+	// TraceParent carries W3C traceparent for cross-service trace propagation
+	TraceParent *string `json:"traceparent,omitempty"`
+
+	// TraceState carries W3C tracestate for vendor-specific context
+	TraceState *string `json:"tracestate,omitempty"`
+}
+
+// PathHop is a single hop of a path trace
+type PathHop struct {
+	// TTL is the hop distance from the probe (1-based), or 0 for connect
+	// traces where the distance is unknown
+	TTL int `json:"ttl"`
+
+	// Addr is the address that answered, empty if no probe was answered
+	Addr string `json:"addr,omitempty"`
+
+	// RTTMs holds the round-trip time of each answered probe
+	RTTMs []float64 `json:"rtt_ms,omitempty"`
+
+	// Sent and Lost count the probes sent to this hop and left unanswered
+	Sent int `json:"sent"`
+	Lost int `json:"lost"`
+}
+
+// Validate performs validation on the path trace event
+func (e *PathTraceEvent) Validate() error {
+	if _, err := uuid.Parse(e.EventID); err != nil {
+		return fmt.Errorf("invalid event_id: must be a valid UUID: %w", err)
+	}
+	if e.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if e.TimestampMs <= 0 {
+		return fmt.Errorf("ts_ms must be positive")
+	}
+	if e.SchemaVersion == "" {
+		return fmt.Errorf("schema_version is required")
+	}
+	if e.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	switch e.AddressFamily {
+	case "", AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyHappyEyeballs:
+	default:
+		return fmt.Errorf("unsupported address_family: %s", e.AddressFamily)
+	}
+
+	switch e.Protocol {
+	case PathTraceProtocolTCP, PathTraceProtocolUDP:
+	default:
+		return fmt.Errorf("unsupported protocol %q", e.Protocol)
+	}
+	switch e.Method {
+	case PathTraceMethodTTL, PathTraceMethodConnect:
+	default:
+		return fmt.Errorf("unsupported method %q", e.Method)
+	}
+	switch e.Trigger {
+	case PathTraceTriggerSchedule, PathTraceTriggerLatency, PathTraceTriggerError:
+	default:
+		return fmt.Errorf("unsupported trigger %q", e.Trigger)
+	}
+
+	if e.Port <= 0 || e.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if e.DurationMs < 0 {
+		return fmt.Errorf("duration_ms must be non-negative")
+	}
+
+	prevTTL := -1
+	for _, hop := range e.Hops {
+		if hop.TTL <= prevTTL {
+			return fmt.Errorf("hops must be in increasing ttl order")
+		}
+		prevTTL = hop.TTL
+		if hop.Sent < 0 || hop.Lost < 0 || hop.Lost > hop.Sent {
+			return fmt.Errorf("hop %d: invalid sent/lost counts", hop.TTL)
+		}
+		for _, rtt := range hop.RTTMs {
+			if rtt < 0 {
+				return fmt.Errorf("hop %d: rtt_ms must be non-negative", hop.TTL)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetTimestamp returns the event timestamp as a time.Time
+func (e *PathTraceEvent) GetTimestamp() time.Time {
+	return time.UnixMilli(e.TimestampMs)
+}
+
+// PathSignature returns a compact representation of the path, the answering
+// address of each hop joined by ">" with "*" for silent hops. Trailing silent
+// hops are dropped since they only reflect where the trace gave up.
+func PathSignature(hops []PathHop) string {
+	last := len(hops) - 1
+	for last >= 0 && hops[last].Addr == "" {
+		last--
+	}
+
+	parts := make([]string, 0, last+1)
+	for _, hop := range hops[:last+1] {
+		if hop.Addr == "" {
+			parts = append(parts, "*")
+		} else {
+			parts = append(parts, hop.Addr)
+		}
+	}
+	return strings.Join(parts, ">")
+}
+
+// PathChanged reports whether two traces of the same target took different
+// paths. Hops that were silent in either trace are not compared, so a router
+// that rate-limits ICMP does not register as a change. A change in path length
+// only counts when both traces reached the destination.
+func PathChanged(previous, current *PathTraceEvent) bool {
+	if previous == nil || current == nil {
+		return false
+	}
+
+	prevAddrs := hopAddrsByTTL(previous.Hops)
+	currAddrs := hopAddrsByTTL(current.Hops)
+	for ttl, addr := range currAddrs {
+		if prevAddr, ok := prevAddrs[ttl]; ok && prevAddr != addr {
+			return true
+		}
+	}
+
+	if previous.Reached && current.Reached {
+		return lastAnsweredTTL(previous.Hops) != lastAnsweredTTL(current.Hops)
+	}
+	return false
+}
+
+// hopAddrsByTTL maps the TTL of each answered hop to its address
+func hopAddrsByTTL(hops []PathHop) map[int]string {
+	addrs := make(map[int]string, len(hops))
+	for _, hop := range hops {
+		if hop.Addr != "" {
+			addrs[hop.TTL] = hop.Addr
+		}
+	}
+	return addrs
+}
+
+// lastAnsweredTTL returns the TTL of the last answered hop, or 0
+func lastAnsweredTTL(hops []PathHop) int {
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].Addr != "" {
+			return hops[i].TTL
+		}
+	}
+	return 0
+}
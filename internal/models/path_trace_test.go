@@ -0,0 +1,162 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPathTraceEventValidate(t *testing.T) {
+	valid := func() *PathTraceEvent {
+		return &PathTraceEvent{
+			EventID:       uuid.New().String(),
+			ClientID:      "test-client-123",
+			TimestampMs:   time.Now().UnixMilli(),
+			SchemaVersion: "1.0",
+			Target:        "https://example.com",
+			Protocol:      PathTraceProtocolTCP,
+			Port:          443,
+			Method:        PathTraceMethodTTL,
+			Trigger:       PathTraceTriggerLatency,
+			Reached:       true,
+			Hops: []PathHop{
+				{TTL: 1, Addr: "192.168.1.1", RTTMs: []float64{1.2, 1.4}, Sent: 3, Lost: 1},
+				{TTL: 2, Sent: 3, Lost: 3},
+				{TTL: 3, Addr: "93.184.216.34", RTTMs: []float64{20.1}, Sent: 1},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(e *PathTraceEvent)
+		wantErr string
+	}{
+		{
+			name:   "valid trace",
+			mutate: func(e *PathTraceEvent) {},
+		},
+		{
+			name:    "unsupported protocol",
+			mutate:  func(e *PathTraceEvent) { e.Protocol = "icmp" },
+			wantErr: "unsupported protocol",
+		},
+		{
+			name:    "unsupported trigger",
+			mutate:  func(e *PathTraceEvent) { e.Trigger = "manual" },
+			wantErr: "unsupported trigger",
+		},
+		{
+			name:    "hops out of order",
+			mutate:  func(e *PathTraceEvent) { e.Hops[2].TTL = 2 },
+			wantErr: "increasing ttl order",
+		},
+		{
+			name:    "more lost than sent",
+			mutate:  func(e *PathTraceEvent) { e.Hops[0].Lost = 4 },
+			wantErr: "invalid sent/lost counts",
+		},
+		{
+			name:    "invalid port",
+			mutate:  func(e *PathTraceEvent) { e.Port = 0 },
+			wantErr: "port must be between",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := valid()
+			tt.mutate(event)
+			err := event.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPathSignature(t *testing.T) {
+	hops := []PathHop{
+		{TTL: 1, Addr: "10.0.0.1"},
+		{TTL: 2},
+		{TTL: 3, Addr: "10.0.2.1"},
+		{TTL: 4},
+		{TTL: 5},
+	}
+	if got, want := PathSignature(hops), "10.0.0.1>*>10.0.2.1"; got != want {
+		t.Errorf("PathSignature() = %q, want %q", got, want)
+	}
+	if got := PathSignature(nil); got != "" {
+		t.Errorf("PathSignature(nil) = %q, want empty", got)
+	}
+}
+
+func TestPathChanged(t *testing.T) {
+	trace := func(reached bool, addrs ...string) *PathTraceEvent {
+		e := &PathTraceEvent{Reached: reached}
+		for i, addr := range addrs {
+			e.Hops = append(e.Hops, PathHop{TTL: i + 1, Addr: addr})
+		}
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		previous *PathTraceEvent
+		current  *PathTraceEvent
+		want     bool
+	}{
+		{
+			name:     "no previous trace",
+			previous: nil,
+			current:  trace(true, "10.0.0.1", "10.0.1.1"),
+			want:     false,
+		},
+		{
+			name:     "same path",
+			previous: trace(true, "10.0.0.1", "10.0.1.1", "1.1.1.1"),
+			current:  trace(true, "10.0.0.1", "10.0.1.1", "1.1.1.1"),
+			want:     false,
+		},
+		{
+			name:     "silent hop is not a change",
+			previous: trace(true, "10.0.0.1", "10.0.1.1", "1.1.1.1"),
+			current:  trace(true, "10.0.0.1", "", "1.1.1.1"),
+			want:     false,
+		},
+		{
+			name:     "different router",
+			previous: trace(true, "10.0.0.1", "10.0.1.1", "1.1.1.1"),
+			current:  trace(true, "10.0.0.1", "10.0.9.1", "1.1.1.1"),
+			want:     true,
+		},
+		{
+			name:     "longer path",
+			previous: trace(true, "10.0.0.1", "1.1.1.1"),
+			current:  trace(true, "10.0.0.1", "10.0.5.1", "1.1.1.1"),
+			want:     true,
+		},
+		{
+			name:     "unreached trace length is not compared",
+			previous: trace(true, "10.0.0.1", "10.0.1.1", "1.1.1.1"),
+			current:  trace(false, "10.0.0.1", "10.0.1.1"),
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PathChanged(tt.previous, tt.current); got != tt.want {
+				t.Errorf("PathChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -29,5 +29,48 @@ type EventProcessor interface {
 	Close() error
 }
 
+// PathTraceProcessor is implemented by event processors that also carry
+// path traces, which are shipped and stored separately from telemetry events
+type PathTraceProcessor interface {
+	// PublishPathTrace publishes a path trace to the message queue
+	PublishPathTrace(trace *PathTraceEvent) error
+
+	// ConsumePathTraces starts consuming path traces and processes them with
+	// the provided handler. A trace is acknowledged when the handler succeeds.
+	ConsumePathTraces(handler func(*PathTraceEvent) error) error
+}
+
+// HeartbeatProcessor is implemented by event processors that also carry
+// probe heartbeats
+type HeartbeatProcessor interface {
+	// PublishHeartbeat publishes a probe heartbeat to the message queue
+	PublishHeartbeat(heartbeat *Heartbeat) error
+
+	// ConsumeHeartbeats starts consuming heartbeats and processes them with
+	// the provided handler. A heartbeat is acknowledged when the handler
+	// succeeds; heartbeats that keep failing are dropped, since the next one
+	// supersedes them.
+	ConsumeHeartbeats(handler func(*Heartbeat) error) error
+}
+
+// DiagnosisProcessor is implemented by event processors that carry
+// flushed-window notifications from the aggregator to the diagnoser, and
+// publish the diagnoser's results for external subscribers
+type DiagnosisProcessor interface {
+	// PublishWindowFlushed publishes a flushed-window notification
+	PublishWindowFlushed(notification *WindowFlushed) error
+
+	// ConsumeWindowsFlushed starts consuming flushed-window notifications,
+	// shared between all diagnoser instances. A notification is
+	// acknowledged when the handler succeeds.
+	ConsumeWindowsFlushed(handler func(*WindowFlushed) error) error
+
+	// PublishDiagnosis publishes a diagnosis result
+	PublishDiagnosis(event *DiagnosisEvent) error
+
+	// PublishCorrelatedIncident publishes a correlated incident
+	PublishCorrelatedIncident(incident *CorrelatedIncident) error
+}
+
 // EventHandler is a function type for processing telemetry events
 type EventHandler func(*TelemetryEvent) error
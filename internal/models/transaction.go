@@ -0,0 +1,53 @@
+package models
+
+import "strings"
+
+// Transaction targets are named flows of several HTTP steps. The overall
+// transaction is reported under "transaction:<name>" and each step as the
+// sub-target "transaction:<name>#<step>", so aggregation and diagnosis treat
+// every step as its own target without a separate dimension.
+const (
+	TransactionTargetPrefix  = "transaction:"
+	TransactionStepSeparator = "#"
+)
+
+// TransactionInfo describes the transaction an event belongs to
+type TransactionInfo struct {
+	// Name is the transaction name
+	Name string `json:"name"`
+
+	// Step is the step name, empty for the overall transaction event
+	Step string `json:"step,omitempty"`
+
+	// StepIndex is the zero-based position of the step in the transaction
+	StepIndex int `json:"step_index,omitempty"`
+
+	// StepCount is the number of steps defined for the transaction
+	StepCount int `json:"step_count"`
+
+	// DurationMs is the wall-clock duration of the step or whole transaction
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// TransactionTarget returns the target identifier of a transaction
+func TransactionTarget(name string) string {
+	return TransactionTargetPrefix + name
+}
+
+// TransactionStepTarget returns the sub-target identifier of a transaction step
+func TransactionStepTarget(name, step string) string {
+	return TransactionTarget(name) + TransactionStepSeparator + step
+}
+
+// ParseTransactionTarget splits a transaction target into its transaction and
+// step names. ok is false for targets that are not transactions.
+func ParseTransactionTarget(target string) (name, step string, ok bool) {
+	if !strings.HasPrefix(target, TransactionTargetPrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(target, TransactionTargetPrefix)
+	if i := strings.Index(rest, TransactionStepSeparator); i >= 0 {
+		return rest[:i], rest[i+len(TransactionStepSeparator):], true
+	}
+	return rest, "", true
+}
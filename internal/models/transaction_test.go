@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestParseTransactionTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		wantName string
+		wantStep string
+		wantOK   bool
+	}{
+		{
+			name:     "overall transaction",
+			target:   TransactionTarget("checkout"),
+			wantName: "checkout",
+			wantOK:   true,
+		},
+		{
+			name:     "transaction step",
+			target:   TransactionStepTarget("checkout", "login"),
+			wantName: "checkout",
+			wantStep: "login",
+			wantOK:   true,
+		},
+		{
+			name:   "plain URL target",
+			target: "https://example.com",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, step, ok := ParseTransactionTarget(tt.target)
+			if ok != tt.wantOK || name != tt.wantName || step != tt.wantStep {
+				t.Errorf("ParseTransactionTarget(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.target, name, step, ok, tt.wantName, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+// Package notify delivers alert notifications through the built-in webhook,
+// Slack, Microsoft Teams and email channels and any registered plugin
+// channels, rendering each channel's message templates and retrying failed
+// deliveries with backoff
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/webhook"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// Channel types
+const (
+	// ChannelWebhook posts the notification as JSON, signed with
+	// HMAC-SHA256 when a secret is set
+	ChannelWebhook = "webhook"
+
+	// ChannelSlack posts to a Slack incoming webhook
+	ChannelSlack = "slack"
+
+	// ChannelTeams posts a MessageCard to a Microsoft Teams incoming webhook
+	ChannelTeams = "teams"
+
+	// ChannelEmail sends a plain-text email through an SMTP server
+	ChannelEmail = "email"
+)
+
+// RedactedValue replaces secrets in settings returned by the API. Settings
+// saved with it keep the stored secret.
+const RedactedValue = "********"
+
+// Defaults for channel settings left unset
+const (
+	defaultSMTPPort    = 587
+	defaultSendTimeout = 30 * time.Second
+)
+
+// channelNameRe matches channel names, which alert rules refer to
+var channelNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// Settings holds the type-specific settings of a channel
+type Settings struct {
+	// URL is the endpoint of webhook, slack and teams channels
+	URL string `json:"url,omitempty"`
+
+	// Secret signs webhook requests
+	Secret string `json:"secret,omitempty"`
+
+	// Headers are added to webhook requests
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Host and Port address the SMTP server of email channels (default port
+	// 587). STARTTLS is used when the server offers it.
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+
+	// Username and Password authenticate to the SMTP server
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// From and To are the sender and recipients of email channels
+	From string   `json:"from,omitempty"`
+	To   []string `json:"to,omitempty"`
+}
+
+// Redacted returns a copy of the settings with secrets replaced by
+// RedactedValue
+func (s Settings) Redacted() Settings {
+	if s.Secret != "" {
+		s.Secret = RedactedValue
+	}
+	if s.Password != "" {
+		s.Password = RedactedValue
+	}
+	if len(s.Headers) > 0 {
+		headers := make(map[string]string, len(s.Headers))
+		for name := range s.Headers {
+			headers[name] = RedactedValue
+		}
+		s.Headers = headers
+	}
+	return s
+}
+
+// KeepSecrets replaces secrets set to RedactedValue with those of the
+// previously stored settings
+func (s *Settings) KeepSecrets(previous Settings) {
+	if s.Secret == RedactedValue {
+		s.Secret = previous.Secret
+	}
+	if s.Password == RedactedValue {
+		s.Password = previous.Password
+	}
+	for name, value := range s.Headers {
+		if value == RedactedValue {
+			s.Headers[name] = previous.Headers[name]
+		}
+	}
+}
+
+// ChannelConfig configures one notification channel
+type ChannelConfig struct {
+	Name     string
+	Type     string
+	Settings Settings
+
+	// TitleTemplate and BodyTemplate render the message; empty uses the
+	// default templates
+	TitleTemplate string
+	BodyTemplate  string
+}
+
+// Validate checks the channel configuration
+func (c *ChannelConfig) Validate() error {
+	if !channelNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid channel name %q: use up to 64 letters, digits, dots, dashes or underscores", c.Name)
+	}
+
+	s := &c.Settings
+	switch c.Type {
+	case ChannelWebhook, ChannelSlack, ChannelTeams:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s channels require an http or https url", c.Type)
+		}
+		if c.Type != ChannelWebhook && (s.Secret != "" || len(s.Headers) > 0) {
+			return fmt.Errorf("secret and headers are only valid for webhook channels")
+		}
+	case ChannelEmail:
+		if s.Host == "" {
+			return fmt.Errorf("email channels require a host")
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			return fmt.Errorf("port must be between 1 and 65535")
+		}
+		if !validAddress(s.From) {
+			return fmt.Errorf("invalid from address: %q", s.From)
+		}
+		if len(s.To) == 0 {
+			return fmt.Errorf("email channels require at least one recipient")
+		}
+		for _, to := range s.To {
+			if !validAddress(to) {
+				return fmt.Errorf("invalid recipient address: %q", to)
+			}
+		}
+	case "":
+		return fmt.Errorf("channel type is required")
+	default:
+		return fmt.Errorf("unsupported channel type: %s", c.Type)
+	}
+
+	if _, err := NewTemplate(c.TitleTemplate, c.BodyTemplate); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validAddress reports whether address is a bare email address that is safe
+// to use in SMTP commands and headers
+func validAddress(address string) bool {
+	at := strings.LastIndex(address, "@")
+	return at > 0 && at < len(address)-1 && !strings.ContainsAny(address, " \t\r\n<>,")
+}
+
+// NewChannel creates a channel from a validated configuration
+func NewChannel(cfg ChannelConfig) (plugin.NotificationChannel, error) {
+	s := cfg.Settings
+	switch cfg.Type {
+	case ChannelWebhook:
+		return &webhookChannel{
+			name:    cfg.Name,
+			service: webhook.NewWebhookService([]string{s.URL}, s.Secret, s.Headers),
+		}, nil
+	case ChannelSlack:
+		return &slackChannel{name: cfg.Name, url: s.URL, client: &http.Client{Timeout: defaultSendTimeout}}, nil
+	case ChannelTeams:
+		return &teamsChannel{name: cfg.Name, url: s.URL, client: &http.Client{Timeout: defaultSendTimeout}}, nil
+	case ChannelEmail:
+		port := s.Port
+		if port == 0 {
+			port = defaultSMTPPort
+		}
+		return &emailChannel{
+			name:     cfg.Name,
+			addr:     net.JoinHostPort(s.Host, strconv.Itoa(port)),
+			host:     s.Host,
+			username: s.Username,
+			password: s.Password,
+			from:     s.From,
+			to:       s.To,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported channel type: %s", cfg.Type)
+	}
+}
+
+// permanentError marks an error that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Retryable() bool { return false }
+
+// retryable reports whether a failed delivery may succeed if retried. Errors
+// are retryable unless one in the chain has a Retryable method returning
+// false.
+func retryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return true
+}
+
+// severityColor returns the colour of a notification in chat messages
+func severityColor(n *plugin.Notification) string {
+	if n.Event == "resolved" {
+		return "#2e7d32"
+	}
+	switch n.Severity {
+	case "critical", "error":
+		return "#d32f2f"
+	case "warning":
+		return "#f9a825"
+	default:
+		return "#1976d2"
+	}
+}
+
+// sortedLabels returns the notification's label names in order
+func sortedLabels(n *plugin.Notification) []string {
+	names := make([]string, 0, len(n.Labels))
+	for name := range n.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// webhookChannel posts the notification as JSON
+type webhookChannel struct {
+	name    string
+	service *webhook.WebhookService
+}
+
+func (c *webhookChannel) Name() string {
+	return c.name
+}
+
+func (c *webhookChannel) Send(ctx context.Context, n *plugin.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to marshal notification: %w", err)}
+	}
+	return c.service.SendRaw(ctx, body)
+}
+
+// slackChannel posts to a Slack incoming webhook
+type slackChannel struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (c *slackChannel) Name() string {
+	return c.name
+}
+
+func (c *slackChannel) Send(ctx context.Context, n *plugin.Notification) error {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	var fields []field
+	for _, name := range sortedLabels(n) {
+		fields = append(fields, field{Title: name, Value: n.Labels[name], Short: true})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text": n.Title,
+		"attachments": []map[string]interface{}{{
+			"color":  severityColor(n),
+			"text":   n.Text,
+			"fields": fields,
+			"footer": "WireScope",
+			"ts":     n.Timestamp.Unix(),
+		}},
+	})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to marshal slack message: %w", err)}
+	}
+	return webhook.PostJSON(ctx, c.client, c.url, body, nil)
+}
+
+// teamsChannel posts a MessageCard to a Microsoft Teams incoming webhook
+type teamsChannel struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (c *teamsChannel) Name() string {
+	return c.name
+}
+
+func (c *teamsChannel) Send(ctx context.Context, n *plugin.Notification) error {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	var facts []fact
+	for _, name := range sortedLabels(n) {
+		facts = append(facts, fact{Name: name, Value: n.Labels[name]})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": strings.TrimPrefix(severityColor(n), "#"),
+		"summary":    n.Title,
+		"title":      n.Title,
+		"text":       n.Text,
+		"sections":   []map[string]interface{}{{"facts": facts}},
+	})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to marshal teams message: %w", err)}
+	}
+	return webhook.PostJSON(ctx, c.client, c.url, body, nil)
+}
+
+// emailChannel sends a plain-text email through an SMTP server
+type emailChannel struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (c *emailChannel) Name() string {
+	return c.name
+}
+
+func (c *emailChannel) Send(ctx context.Context, n *plugin.Notification) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.addr, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultSendTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return smtpError(err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return smtpError(err)
+		}
+	}
+	if c.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return smtpError(err)
+		}
+	}
+	if err := client.Mail(c.from); err != nil {
+		return smtpError(err)
+	}
+	for _, to := range c.to {
+		if err := client.Rcpt(to); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(c.message(n)); err != nil {
+		return smtpError(err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return client.Quit()
+}
+
+// message formats the email headers and body
+func (c *emailChannel) message(n *plugin.Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", c.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(c.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(n.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Timestamp.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(n.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// headerValue folds a value onto one header line
+func headerValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// smtpError marks permanent (5xx) SMTP replies as not retryable
+func smtpError(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return &permanentError{err}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/rahulgh33/wirescope/internal/webhook"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+func TestChannelConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ChannelConfig
+		wantErr bool
+	}{
+		{"webhook", ChannelConfig{Name: "ops", Type: ChannelWebhook, Settings: Settings{URL: "https://hooks.example/x", Secret: "s"}}, false},
+		{"slack", ChannelConfig{Name: "team-slack", Type: ChannelSlack, Settings: Settings{URL: "https://hooks.slack.com/services/x"}}, false},
+		{"email", ChannelConfig{Name: "oncall", Type: ChannelEmail, Settings: Settings{Host: "smtp.example.com", From: "ws@example.com", To: []string{"ops@example.com"}}}, false},
+		{"bad name", ChannelConfig{Name: "on call", Type: ChannelSlack, Settings: Settings{URL: "https://hooks.slack.com/x"}}, true},
+		{"missing url", ChannelConfig{Name: "teams", Type: ChannelTeams}, true},
+		{"slack secret", ChannelConfig{Name: "s", Type: ChannelSlack, Settings: Settings{URL: "https://hooks.slack.com/x", Secret: "s"}}, true},
+		{"no recipients", ChannelConfig{Name: "mail", Type: ChannelEmail, Settings: Settings{Host: "smtp.example.com", From: "ws@example.com"}}, true},
+		{"header injection", ChannelConfig{Name: "mail", Type: ChannelEmail, Settings: Settings{Host: "smtp.example.com", From: "ws@example.com", To: []string{"a@example.com\r\nBcc: x@example.com"}}}, true},
+		{"bad template", ChannelConfig{Name: "ops", Type: ChannelWebhook, Settings: Settings{URL: "https://hooks.example/x"}, BodyTemplate: "{{"}, true},
+		{"unknown type", ChannelConfig{Name: "pager", Type: "pager"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSettingsRedaction(t *testing.T) {
+	stored := Settings{URL: "https://hooks.example/x", Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer t"}}
+
+	redacted := stored.Redacted()
+	if redacted.Secret != RedactedValue || redacted.Headers["Authorization"] != RedactedValue {
+		t.Errorf("Redacted() = %+v", redacted)
+	}
+	if stored.Headers["Authorization"] != "Bearer t" {
+		t.Error("Redacted() modified the stored headers")
+	}
+
+	redacted.URL = "https://hooks.example/y"
+	redacted.KeepSecrets(stored)
+	if redacted.Secret != "s3cret" || redacted.Headers["Authorization"] != "Bearer t" || redacted.URL != "https://hooks.example/y" {
+		t.Errorf("KeepSecrets() = %+v", redacted)
+	}
+}
+
+func TestWebhookChannelSendsSignedNotification(t *testing.T) {
+	var got plugin.Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+		if !webhook.Verify("s3cret", timestamp, body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Error("signature did not verify")
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	cfg := ChannelConfig{Name: "ops", Type: ChannelWebhook, Settings: Settings{URL: server.URL, Secret: "s3cret"}, TitleTemplate: "{{.Summary}}!"}
+	if err := SendOnce(context.Background(), cfg, &plugin.Notification{AlertID: 3, Event: "test", Summary: "hello"}); err != nil {
+		t.Fatalf("SendOnce() error = %v", err)
+	}
+	if got.AlertID != 3 || got.Title != "hello!" || got.Text == "" {
+		t.Errorf("received %+v", got)
+	}
+}
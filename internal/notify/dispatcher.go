@@ -0,0 +1,343 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+const (
+	// channelRefreshInterval is how often channels are reloaded from the
+	// store
+	channelRefreshInterval = time.Minute
+
+	// queueSize bounds the deliveries waiting for a worker
+	queueSize = 256
+
+	// pluginChannelType labels the metrics of channels registered in code
+	pluginChannelType = "plugin"
+)
+
+var deliveriesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "notification_deliveries_total",
+		Help: "Total number of notification delivery attempts, by channel type and result",
+	},
+	[]string{"type", "result"}, // sent, retried, failed, dropped
+)
+
+func init() {
+	prometheus.MustRegister(deliveriesTotal)
+}
+
+// Store loads notification channels and records deliveries
+type Store interface {
+	ListNotificationChannels(ctx context.Context, enabledOnly bool) ([]database.NotificationChannelRecord, error)
+	CreateDelivery(ctx context.Context, d *database.DeliveryRecord) error
+	UpdateDelivery(ctx context.Context, d *database.DeliveryRecord) error
+}
+
+// RetryConfig controls how failed deliveries are retried. The delay doubles
+// after each attempt, from InitialBackoff up to MaxBackoff.
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryConfig returns the default retry settings: five attempts over
+// about half a minute
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    5,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+// backoff returns the delay after a failed attempt (1-based)
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 1; i < attempt && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay
+}
+
+// ConfigFromRecord returns the configuration of a stored channel
+func ConfigFromRecord(rec *database.NotificationChannelRecord) (ChannelConfig, error) {
+	cfg := ChannelConfig{
+		Name:          rec.Name,
+		Type:          rec.Type,
+		TitleTemplate: rec.TitleTemplate,
+		BodyTemplate:  rec.BodyTemplate,
+	}
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg.Settings); err != nil {
+			return cfg, fmt.Errorf("failed to unmarshal channel settings: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// SendOnce renders a notification with the channel's templates and sends it
+// once, without recording a delivery
+func SendOnce(ctx context.Context, cfg ChannelConfig, n *plugin.Notification) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	r, err := newRoute(cfg)
+	if err != nil {
+		return err
+	}
+	if err := r.template.Render(n); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultSendTimeout)
+	defer cancel()
+	return r.channel.Send(ctx, n)
+}
+
+// route is a channel notifications are delivered through
+type route struct {
+	kind     string
+	channel  plugin.NotificationChannel
+	template *Template
+}
+
+func newRoute(cfg ChannelConfig) (*route, error) {
+	tmpl, err := NewTemplate(cfg.TitleTemplate, cfg.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := NewChannel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &route{kind: cfg.Type, channel: channel, template: tmpl}, nil
+}
+
+// job is one notification to deliver through one channel
+type job struct {
+	route    *route
+	n        plugin.Notification
+	delivery *database.DeliveryRecord
+
+	// attempts counts the sends so far
+	attempts int
+}
+
+// Dispatcher delivers notifications to channels by name in the background.
+// Channels are those stored in the Store, which take precedence, and those
+// registered in the plugin registry, which use the default templates.
+// Deliveries of notifications with an AlertID are recorded in the Store.
+type Dispatcher struct {
+	store   Store
+	retry   RetryConfig
+	plugins map[string]*route
+	jobs    chan *job
+	wg      sync.WaitGroup
+
+	// channels caches the enabled stored channels
+	mu       sync.Mutex
+	channels map[string]*route
+	loaded   time.Time
+}
+
+// NewDispatcher creates a dispatcher. store and registry may be nil.
+func NewDispatcher(store Store, retry RetryConfig, registry *plugin.Registry) *Dispatcher {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	d := &Dispatcher{
+		store:    store,
+		retry:    retry,
+		plugins:  make(map[string]*route),
+		jobs:     make(chan *job, queueSize),
+		channels: make(map[string]*route),
+	}
+	if registry != nil {
+		tmpl, _ := NewTemplate("", "")
+		for _, channel := range registry.Channels() {
+			d.plugins[channel.Name()] = &route{kind: pluginChannelType, channel: channel, template: tmpl}
+		}
+	}
+	return d
+}
+
+// Start starts workers delivering notifications until ctx is done
+func (d *Dispatcher) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.jobs:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Wait waits for the workers to stop
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Dispatch queues a notification for delivery to the named channels.
+// Unknown channels are logged and skipped.
+func (d *Dispatcher) Dispatch(ctx context.Context, n *plugin.Notification, channels []string) {
+	for _, name := range channels {
+		r := d.route(ctx, name)
+		if r == nil {
+			log.Printf("Notification channel %s not found, skipping %s %s notification", name, n.AlertType, n.Event)
+			continue
+		}
+
+		j := &job{route: r, n: *n}
+		if d.store != nil && n.AlertID > 0 {
+			delivery := &database.DeliveryRecord{
+				AlertID: n.AlertID,
+				Channel: name,
+				Event:   n.Event,
+				Status:  database.DeliveryPending,
+			}
+			if err := d.store.CreateDelivery(ctx, delivery); err != nil {
+				log.Printf("Failed to record delivery to %s: %v", name, err)
+			} else {
+				j.delivery = delivery
+			}
+		}
+
+		d.enqueue(ctx, j)
+	}
+}
+
+// enqueue queues a job for the workers, failing it if the queue is full
+func (d *Dispatcher) enqueue(ctx context.Context, j *job) {
+	select {
+	case d.jobs <- j:
+	default:
+		deliveriesTotal.WithLabelValues(j.route.kind, "dropped").Inc()
+		d.record(ctx, j, database.DeliveryFailed, j.attempts, errors.New("delivery queue is full"))
+	}
+}
+
+// deliver makes one attempt to send a job's notification and records the
+// outcome. A retryable failure is queued again after the backoff, so the
+// worker is free for other deliveries in the meantime; retries still waiting
+// when ctx is done are dropped and stay recorded as pending.
+func (d *Dispatcher) deliver(ctx context.Context, j *job) {
+	name := j.route.channel.Name()
+	if j.attempts == 0 {
+		if err := j.route.template.Render(&j.n); err != nil {
+			deliveriesTotal.WithLabelValues(j.route.kind, "failed").Inc()
+			log.Printf("Failed to render notification for %s: %v", name, err)
+			d.record(ctx, j, database.DeliveryFailed, 0, err)
+			return
+		}
+	}
+
+	j.attempts++
+	sendCtx, cancel := context.WithTimeout(ctx, defaultSendTimeout)
+	err := j.route.channel.Send(sendCtx, &j.n)
+	cancel()
+	if err == nil {
+		deliveriesTotal.WithLabelValues(j.route.kind, "sent").Inc()
+		d.record(ctx, j, database.DeliverySent, j.attempts, nil)
+		return
+	}
+
+	if j.attempts >= d.retry.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+		deliveriesTotal.WithLabelValues(j.route.kind, "failed").Inc()
+		log.Printf("Failed to deliver %s %s notification to %s after %d attempt(s): %v",
+			j.n.AlertType, j.n.Event, name, j.attempts, err)
+		d.record(ctx, j, database.DeliveryFailed, j.attempts, err)
+		return
+	}
+
+	deliveriesTotal.WithLabelValues(j.route.kind, "retried").Inc()
+	d.record(ctx, j, database.DeliveryPending, j.attempts, err)
+	time.AfterFunc(d.retry.backoff(j.attempts), func() {
+		if ctx.Err() == nil {
+			d.enqueue(ctx, j)
+		}
+	})
+}
+
+// record stores the status of a job's delivery, if it is recorded
+func (d *Dispatcher) record(ctx context.Context, j *job, status string, attempts int, err error) {
+	if j.delivery == nil {
+		return
+	}
+	j.delivery.Status = status
+	j.delivery.Attempts = attempts
+	j.delivery.LastError = ""
+	if err != nil {
+		j.delivery.LastError = err.Error()
+	}
+	if err := d.store.UpdateDelivery(ctx, j.delivery); err != nil {
+		log.Printf("Failed to record delivery %d: %v", j.delivery.ID, err)
+	}
+}
+
+// route returns the channel with the given name, or nil. Stored channels are
+// reloaded every channelRefreshInterval; if reloading fails the cached ones
+// are kept. Channels that fail to load are skipped.
+func (d *Dispatcher) route(ctx context.Context, name string) *route {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.store != nil && time.Since(d.loaded) >= channelRefreshInterval {
+		// Retry after the interval rather than on every notification
+		d.loaded = time.Now()
+		records, err := d.store.ListNotificationChannels(ctx, true)
+		if err != nil {
+			log.Printf("Failed to load notification channels: %v", err)
+		} else {
+			channels := make(map[string]*route, len(records))
+			for i := range records {
+				r, err := loadRoute(&records[i])
+				if err != nil {
+					log.Printf("Ignoring notification channel %s: %v", records[i].Name, err)
+					continue
+				}
+				channels[records[i].Name] = r
+			}
+			d.channels = channels
+		}
+	}
+
+	if r, ok := d.channels[name]; ok {
+		return r
+	}
+	return d.plugins[name]
+}
+
+// loadRoute creates the route of a stored channel
+func loadRoute(rec *database.NotificationChannelRecord) (*route, error) {
+	cfg, err := ConfigFromRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newRoute(cfg)
+}
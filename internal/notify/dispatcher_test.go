@@ -0,0 +1,204 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/database"
+	"github.com/rahulgh33/wirescope/internal/webhook"
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// fakeStore records deliveries in memory
+type fakeStore struct {
+	mu         sync.Mutex
+	channels   []database.NotificationChannelRecord
+	deliveries map[int64]database.DeliveryRecord
+	updated    chan database.DeliveryRecord
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		deliveries: make(map[int64]database.DeliveryRecord),
+		updated:    make(chan database.DeliveryRecord, 16),
+	}
+}
+
+func (s *fakeStore) ListNotificationChannels(ctx context.Context, enabledOnly bool) ([]database.NotificationChannelRecord, error) {
+	return s.channels, nil
+}
+
+func (s *fakeStore) CreateDelivery(ctx context.Context, d *database.DeliveryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.ID = int64(len(s.deliveries) + 1)
+	s.deliveries[d.ID] = *d
+	return nil
+}
+
+func (s *fakeStore) UpdateDelivery(ctx context.Context, d *database.DeliveryRecord) error {
+	s.mu.Lock()
+	s.deliveries[d.ID] = *d
+	s.mu.Unlock()
+	s.updated <- *d
+	return nil
+}
+
+// waitFinal returns the first delivery update that is not pending
+func (s *fakeStore) waitFinal(t *testing.T) database.DeliveryRecord {
+	t.Helper()
+	for {
+		select {
+		case d := <-s.updated:
+			if d.Status != database.DeliveryPending {
+				return d
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for delivery")
+		}
+	}
+}
+
+// flakyChannel fails with errs in turn, then succeeds
+type flakyChannel struct {
+	mu   sync.Mutex
+	errs []error
+	sent []plugin.Notification
+}
+
+func (c *flakyChannel) Name() string {
+	return "flaky"
+}
+
+func (c *flakyChannel) Send(ctx context.Context, n *plugin.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	c.sent = append(c.sent, *n)
+	return nil
+}
+
+func startDispatcher(t *testing.T, store Store, channel plugin.NotificationChannel) *Dispatcher {
+	t.Helper()
+	registry := plugin.NewRegistry()
+	registry.RegisterChannel(channel)
+
+	d := NewDispatcher(store, RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}, registry)
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx, 1)
+	t.Cleanup(func() {
+		cancel()
+		d.Wait()
+	})
+	return d
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	store := newFakeStore()
+	channel := &flakyChannel{errs: []error{
+		errors.New("connection refused"),
+		&webhook.StatusError{URL: "http://hooks.example", StatusCode: http.StatusBadGateway},
+	}}
+	d := startDispatcher(t, store, channel)
+
+	d.Dispatch(context.Background(), &plugin.Notification{AlertID: 7, Event: "firing", Summary: "down"}, []string{"flaky", "missing"})
+
+	got := store.waitFinal(t)
+	if got.Status != database.DeliverySent || got.Attempts != 3 || got.LastError != "" {
+		t.Errorf("delivery = %+v, want sent after 3 attempts", got)
+	}
+	if got.DeliveredAt != nil || got.AlertID != 7 || got.Channel != "flaky" || got.Event != "firing" {
+		t.Errorf("delivery = %+v", got)
+	}
+	if len(channel.sent) != 1 || channel.sent[0].Title == "" {
+		t.Errorf("sent = %+v, want one rendered notification", channel.sent)
+	}
+	if len(store.deliveries) != 1 {
+		t.Errorf("recorded %d deliveries, want 1 (unknown channels are skipped)", len(store.deliveries))
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+	}{
+		{"not retryable", []error{&webhook.StatusError{URL: "http://hooks.example", StatusCode: http.StatusForbidden}}, 1},
+		{"max attempts", []error{errors.New("a"), errors.New("b"), errors.New("c"), errors.New("d")}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			d := startDispatcher(t, store, &flakyChannel{errs: tt.errs})
+
+			d.Dispatch(context.Background(), &plugin.Notification{AlertID: 1, Event: "firing"}, []string{"flaky"})
+
+			got := store.waitFinal(t)
+			if got.Status != database.DeliveryFailed || got.Attempts != tt.attempts || got.LastError == "" {
+				t.Errorf("delivery = %+v, want failed after %d attempt(s)", got, tt.attempts)
+			}
+		})
+	}
+}
+
+// namedChannel is a flakyChannel with its own name
+type namedChannel struct {
+	flakyChannel
+	name string
+}
+
+func (c *namedChannel) Name() string {
+	return c.name
+}
+
+func TestDispatcherRetryFreesWorker(t *testing.T) {
+	registry := plugin.NewRegistry()
+	failing := &namedChannel{name: "failing", flakyChannel: flakyChannel{errs: []error{errors.New("connection refused")}}}
+	healthy := &namedChannel{name: "healthy"}
+	registry.RegisterChannel(failing)
+	registry.RegisterChannel(healthy)
+
+	// One worker and a backoff far longer than the test waits for the
+	// healthy channel
+	store := newFakeStore()
+	d := NewDispatcher(store, RetryConfig{MaxAttempts: 2, InitialBackoff: time.Hour, MaxBackoff: time.Hour}, registry)
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx, 1)
+	defer func() {
+		cancel()
+		d.Wait()
+	}()
+
+	d.Dispatch(ctx, &plugin.Notification{AlertID: 1, Event: "firing"}, []string{"failing", "healthy"})
+
+	got := store.waitFinal(t)
+	if got.Channel != "healthy" || got.Status != database.DeliverySent {
+		t.Errorf("delivery = %+v, want healthy sent while failing waits to retry", got)
+	}
+	store.mu.Lock()
+	pending := store.deliveries[1]
+	store.mu.Unlock()
+	if pending.Channel != "failing" || pending.Status != database.DeliveryPending || pending.Attempts != 1 {
+		t.Errorf("delivery = %+v, want failing pending after 1 attempt", pending)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	retry := DefaultRetryConfig()
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := retry.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// Default templates. Templates are Go text/templates executed on the
+// plugin.Notification, with the upper, lower and date functions.
+const (
+	DefaultTitleTemplate = `{{if eq .Event "resolved"}}[RESOLVED]{{else}}[{{upper .Severity}}]{{end}} {{.Summary}}`
+
+	DefaultBodyTemplate = `{{.Summary}}
+
+Event: {{.Event}}
+Severity: {{.Severity}}
+Started: {{date .StartedAt}}
+{{range $name, $value := .Labels}}{{$name}}: {{$value}}
+{{end}}`
+)
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+// Template renders the title and text of notifications
+type Template struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// NewTemplate parses title and body templates; empty ones use the defaults
+func NewTemplate(title, body string) (*Template, error) {
+	if title == "" {
+		title = DefaultTitleTemplate
+	}
+	if body == "" {
+		body = DefaultBodyTemplate
+	}
+
+	t := &Template{}
+	var err error
+	if t.title, err = template.New("title").Funcs(templateFuncs).Parse(title); err != nil {
+		return nil, fmt.Errorf("invalid title template: %w", err)
+	}
+	if t.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	return t, nil
+}
+
+// Render sets the notification's Title and Text
+func (t *Template) Render(n *plugin.Notification) error {
+	var buf bytes.Buffer
+	if err := t.title.Execute(&buf, n); err != nil {
+		return fmt.Errorf("failed to render title: %w", err)
+	}
+	n.Title = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := t.body.Execute(&buf, n); err != nil {
+		return fmt.Errorf("failed to render body: %w", err)
+	}
+	n.Text = strings.TrimSpace(buf.String())
+	return nil
+}
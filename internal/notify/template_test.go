@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+func TestTemplateRender(t *testing.T) {
+	n := &plugin.Notification{
+		AlertType: "rule",
+		Event:     "firing",
+		Severity:  "critical",
+		Summary:   "latency-threshold on example.com",
+		Labels:    map[string]string{"target": "https://example.com", "client_id": "probe-1"},
+		StartedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tmpl, err := NewTemplate("", "")
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	if err := tmpl.Render(n); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if n.Title != "[CRITICAL] latency-threshold on example.com" {
+		t.Errorf("Title = %q", n.Title)
+	}
+	for _, want := range []string{"Started: 2024-05-01T12:00:00Z", "client_id: probe-1\ntarget: https://example.com"} {
+		if !strings.Contains(n.Text, want) {
+			t.Errorf("Text = %q, want it to contain %q", n.Text, want)
+		}
+	}
+
+	n.Event = "resolved"
+	tmpl, err = NewTemplate("", `{{lower .Severity}} alert on {{index .Labels "target"}}`)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	if err := tmpl.Render(n); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if n.Title != "[RESOLVED] latency-threshold on example.com" {
+		t.Errorf("Title = %q", n.Title)
+	}
+	if n.Text != "critical alert on https://example.com" {
+		t.Errorf("Text = %q", n.Text)
+	}
+}
+
+func TestTemplateInvalid(t *testing.T) {
+	if _, err := NewTemplate("{{.Summary", ""); err == nil {
+		t.Error("NewTemplate() with an unterminated action succeeded")
+	}
+	if _, err := NewTemplate("", "{{nosuchfunc .Summary}}"); err == nil {
+		t.Error("NewTemplate() with an unknown function succeeded")
+	}
+
+	tmpl, err := NewTemplate("{{.Missing}}", "")
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	if err := tmpl.Render(&plugin.Notification{}); err == nil {
+		t.Error("Render() of an unknown field succeeded")
+	}
+}
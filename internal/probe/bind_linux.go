@@ -0,0 +1,14 @@
+//go:build linux
+
+package probe
+
+import "syscall"
+
+// bindToDeviceSupported reports whether sockets can be bound to an interface
+// with SO_BINDTODEVICE
+const bindToDeviceSupported = true
+
+// bindToDevice binds a socket to a network interface before it connects
+func bindToDevice(fd uintptr, name string) error {
+	return syscall.BindToDevice(int(fd), name)
+}
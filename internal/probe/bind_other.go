@@ -0,0 +1,12 @@
+//go:build !linux
+
+package probe
+
+// bindToDeviceSupported is false where sockets are bound to an interface by
+// binding to one of its addresses instead
+const bindToDeviceSupported = false
+
+// bindToDevice is not used on this platform
+func bindToDevice(fd uintptr, name string) error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// ClockEstimate is an NTP-style estimate of the ingest server's clock
+// relative to the probe's
+type ClockEstimate struct {
+	// OffsetMs is the server clock minus the probe clock
+	OffsetMs float64
+
+	// RTTMs is the round trip of the sample the offset was taken from; the
+	// offset is accurate to within half of it
+	RTTMs float64
+
+	// Samples is the number of exchanges that succeeded
+	Samples int
+
+	MeasuredAt time.Time
+}
+
+// EstimateClockOffset runs several exchanges against the ingest time endpoint
+// and keeps the one with the lowest round trip, which is the least affected
+// by asymmetric queuing. Cancelling ctx stops the remaining exchanges.
+func EstimateClockOffset(ctx context.Context, timeURL string, samples int) (*ClockEstimate, error) {
+	if samples <= 0 {
+		samples = 1
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	var best *ClockEstimate
+	var lastErr error
+	for i := 0; i < samples && ctx.Err() == nil; i++ {
+		offset, rtt, err := clockExchange(ctx, client, timeURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil {
+			best = &ClockEstimate{}
+		}
+		best.Samples++
+		if best.Samples == 1 || rtt < best.RTTMs {
+			best.OffsetMs = offset
+			best.RTTMs = rtt
+		}
+	}
+	if best == nil {
+		if lastErr == nil {
+			lastErr = ctx.Err()
+		}
+		return nil, fmt.Errorf("clock sync failed: %w", lastErr)
+	}
+	best.MeasuredAt = time.Now()
+	return best, nil
+}
+
+// clockExchange performs one request to the time endpoint
+func clockExchange(ctx context.Context, client *http.Client, timeURL string) (offsetMs, rttMs float64, err error) {
+	parsed, err := url.Parse(timeURL)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time URL: %w", err)
+	}
+
+	t0 := models.UnixMillis(time.Now())
+	query := parsed.Query()
+	query.Set("t0", strconv.FormatFloat(t0, 'f', 3, 64))
+	parsed.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time URL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	t3 := models.UnixMillis(time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("time endpoint returned status %d", resp.StatusCode)
+	}
+
+	var sync models.ClockSyncResponse
+	if err := json.Unmarshal(body, &sync); err != nil {
+		return 0, 0, fmt.Errorf("invalid time response: %w", err)
+	}
+	if sync.ServerRecvMs <= 0 || sync.ServerSendMs < sync.ServerRecvMs {
+		return 0, 0, fmt.Errorf("invalid time response")
+	}
+
+	offsetMs, rttMs = models.ClockOffset(t0, sync.ServerRecvMs, sync.ServerSendMs, t3)
+	return offsetMs, rttMs, nil
+}
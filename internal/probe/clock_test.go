@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+func TestEstimateClockOffset(t *testing.T) {
+	// The server clock runs an hour ahead
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := models.UnixMillis(time.Now().Add(time.Hour))
+		json.NewEncoder(w).Encode(models.ClockSyncResponse{ServerRecvMs: now, ServerSendMs: now})
+	}))
+	defer server.Close()
+
+	estimate, err := EstimateClockOffset(context.Background(), server.URL, 3)
+	if err != nil {
+		t.Fatalf("EstimateClockOffset() error = %v", err)
+	}
+	if estimate.Samples != 3 {
+		t.Errorf("Samples = %d, expected 3", estimate.Samples)
+	}
+	if want := float64(time.Hour.Milliseconds()); estimate.OffsetMs < want-1000 || estimate.OffsetMs > want+1000 {
+		t.Errorf("OffsetMs = %v, expected about %v", estimate.OffsetMs, want)
+	}
+}
+
+func TestEstimateClockOffsetCancelled(t *testing.T) {
+	// Never answers, so only cancellation ends the exchange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := EstimateClockOffset(ctx, server.URL, 5); err == nil {
+		t.Fatal("EstimateClockOffset() expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("EstimateClockOffset() took %v after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,422 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+// Collector types
+const (
+	// CollectorWiFi reports signal, noise and link quality of the wireless
+	// interface
+	CollectorWiFi = "wifi"
+
+	// CollectorCPU reports load averages and CPU utilization of the host
+	CollectorCPU = "cpu"
+
+	// CollectorGatewayPing reports ICMP echo round-trip time and loss to the
+	// default gateway
+	CollectorGatewayPing = "gateway_ping"
+
+	// CollectorExec runs an external command printing a JSON object of
+	// metric names to numbers
+	CollectorExec = "exec"
+)
+
+// Defaults for collector settings left unset
+const (
+	defaultCollectorTimeout = 5 * time.Second
+	defaultGatewayPings     = 3
+	maxGatewayPingWait      = time.Second
+)
+
+// collectorNameRe matches collector names, which prefix their metric names
+var collectorNameRe = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// CollectorConfig configures one custom metric collector. Its metrics are
+// attached to every event of a probe cycle as "<name>.<metric>".
+type CollectorConfig struct {
+	// Type is wifi, cpu, gateway_ping or exec
+	Type string `json:"type"`
+
+	// Name prefixes the collector's metrics; defaults to the type and is
+	// required for exec collectors
+	Name string `json:"name,omitempty"`
+
+	// Command is the program and arguments run by an exec collector
+	Command []string `json:"command,omitempty"`
+
+	// TimeoutMs bounds one collection (default 5000, 10000 for exec)
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+
+	// Interface selects the wireless interface read by the wifi collector;
+	// empty means the first one listed
+	Interface string `json:"interface,omitempty"`
+
+	// Address overrides the gateway pinged by gateway_ping, which is
+	// otherwise taken from the default route (Linux only)
+	Address string `json:"address,omitempty"`
+
+	// Count is the number of echo requests sent by gateway_ping (default 3)
+	Count int `json:"count,omitempty"`
+}
+
+// Validate checks the collector configuration and fills in its name
+func (c *CollectorConfig) Validate() error {
+	switch c.Type {
+	case CollectorWiFi, CollectorCPU, CollectorGatewayPing:
+		if len(c.Command) > 0 {
+			return fmt.Errorf("command is only valid for exec collectors")
+		}
+		if c.Name == "" {
+			c.Name = c.Type
+		}
+	case CollectorExec:
+		if c.Name == "" {
+			return fmt.Errorf("exec collectors require a name")
+		}
+		if len(c.Command) == 0 || c.Command[0] == "" {
+			return fmt.Errorf("exec collector %s requires a command", c.Name)
+		}
+	case "":
+		return fmt.Errorf("collector type is required")
+	default:
+		return fmt.Errorf("unsupported collector type: %s", c.Type)
+	}
+
+	if !collectorNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid collector name %q: use up to 32 lower-case letters, digits or underscores", c.Name)
+	}
+	if c.TimeoutMs < 0 {
+		return fmt.Errorf("timeout_ms must be non-negative")
+	}
+	if c.Count < 0 || c.Count > 20 {
+		return fmt.Errorf("count must be between 0 and 20")
+	}
+	if c.Address != "" && net.ParseIP(c.Address) == nil {
+		return fmt.Errorf("address must be an IP address: %s", c.Address)
+	}
+	return nil
+}
+
+// ParseCollectorList parses a comma-separated list of built-in collector
+// types, as given on the command line
+func ParseCollectorList(list string) ([]CollectorConfig, error) {
+	var configs []CollectorConfig
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == CollectorExec {
+			return nil, fmt.Errorf("exec collectors must be configured in a collectors file")
+		}
+		cfg := CollectorConfig{Type: name}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// LoadCollectors reads collector configurations from a JSON file holding an
+// array of collectors
+func LoadCollectors(path string) ([]CollectorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collectors file: %w", err)
+	}
+
+	var configs []CollectorConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse collectors file: %w", err)
+	}
+
+	for i := range configs {
+		if err := configs[i].Validate(); err != nil {
+			return nil, fmt.Errorf("collector %d: %w", i, err)
+		}
+	}
+	return configs, nil
+}
+
+// NewCollectorRegistry creates the collectors described by configs and
+// registers them. Collector names must be unique.
+func NewCollectorRegistry(configs []CollectorConfig) (*plugin.Registry, error) {
+	registry := plugin.NewRegistry()
+	for i := range configs {
+		cfg := configs[i]
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := registry.GetCollector(cfg.Name); exists {
+			return nil, fmt.Errorf("duplicate collector name: %s", cfg.Name)
+		}
+		collector, err := NewCollector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		registry.RegisterCollector(collector)
+	}
+	return registry, nil
+}
+
+// NewCollector creates a collector from a validated configuration
+func NewCollector(cfg CollectorConfig) (plugin.MetricCollector, error) {
+	timeout := msOr(cfg.TimeoutMs, defaultCollectorTimeout)
+	switch cfg.Type {
+	case CollectorWiFi:
+		return &wifiCollector{name: cfg.Name, iface: cfg.Interface}, nil
+	case CollectorCPU:
+		return &cpuCollector{name: cfg.Name}, nil
+	case CollectorGatewayPing:
+		count := cfg.Count
+		if count == 0 {
+			count = defaultGatewayPings
+		}
+		return &gatewayPingCollector{
+			name:    cfg.Name,
+			address: cfg.Address,
+			count:   count,
+			timeout: timeout,
+			id:      os.Getpid() & 0xffff,
+		}, nil
+	case CollectorExec:
+		return plugin.NewExecCollector(cfg.Name, cfg.Command, msOr(cfg.TimeoutMs, plugin.DefaultExecTimeout))
+	default:
+		return nil, fmt.Errorf("unsupported collector type: %s", cfg.Type)
+	}
+}
+
+// wifiCollector reads the wireless statistics of one interface
+type wifiCollector struct {
+	name  string
+	iface string
+}
+
+func (c *wifiCollector) Name() string {
+	return c.name
+}
+
+func (c *wifiCollector) Collect(ctx context.Context) (map[string]float64, error) {
+	return readWiFi(c.iface)
+}
+
+// cpuCollector reports load averages and the CPU utilization since its
+// previous collection
+type cpuCollector struct {
+	name string
+
+	mu        sync.Mutex
+	prevIdle  uint64
+	prevTotal uint64
+}
+
+func (c *cpuCollector) Name() string {
+	return c.name
+}
+
+func (c *cpuCollector) Collect(ctx context.Context) (map[string]float64, error) {
+	load, err := readLoadAvg()
+	if err != nil {
+		return nil, err
+	}
+	metrics := map[string]float64{
+		"load1":  load[0],
+		"load5":  load[1],
+		"load15": load[2],
+		"cores":  float64(runtime.NumCPU()),
+	}
+
+	// Utilization needs two samples, so the first collection has none
+	idle, total, err := readCPUTimes()
+	if err != nil {
+		return metrics, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prevTotal > 0 && total > c.prevTotal && idle >= c.prevIdle {
+		metrics["busy_pct"] = 100 * (1 - float64(idle-c.prevIdle)/float64(total-c.prevTotal))
+	}
+	c.prevIdle, c.prevTotal = idle, total
+	return metrics, nil
+}
+
+// gatewayPingCollector pings the default gateway, separating local network
+// trouble from problems further along the path
+type gatewayPingCollector struct {
+	name    string
+	address string
+	count   int
+	timeout time.Duration
+	id      int
+}
+
+func (c *gatewayPingCollector) Name() string {
+	return c.name
+}
+
+func (c *gatewayPingCollector) Collect(ctx context.Context) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	gateway, err := c.gateway()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, dst, privileged, err := listenEcho(gateway)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	wait := min(c.timeout/time.Duration(c.count), maxGatewayPingWait)
+	var rtts []float64
+	for seq := 0; seq < c.count && ctx.Err() == nil; seq++ {
+		rtt, err := c.echo(conn, dst, gateway, privileged, seq, deadlineWithin(ctx, wait))
+		if err == nil {
+			rtts = append(rtts, rtt)
+		}
+	}
+	if ctx.Err() != nil && len(rtts) == 0 {
+		return nil, fmt.Errorf("gateway ping timed out")
+	}
+
+	// Loss is a result in itself, so a silent gateway is not an error
+	metrics := map[string]float64{
+		"loss_rate": 1 - float64(len(rtts))/float64(c.count),
+	}
+	if len(rtts) > 0 {
+		var sum, maxRTT float64
+		for _, rtt := range rtts {
+			sum += rtt
+			maxRTT = max(maxRTT, rtt)
+		}
+		metrics["rtt_ms"] = sum / float64(len(rtts))
+		metrics["rtt_max_ms"] = maxRTT
+	}
+	return metrics, nil
+}
+
+// gateway returns the configured address or the default route's gateway
+func (c *gatewayPingCollector) gateway() (*net.IPAddr, error) {
+	if c.address != "" {
+		return &net.IPAddr{IP: net.ParseIP(c.address)}, nil
+	}
+	for _, ipv6 := range []bool{false, true} {
+		route := defaultRoute(ipv6)
+		if route == nil || route.gateway == "" {
+			continue
+		}
+		if ip := net.ParseIP(route.gateway); ip != nil {
+			// Link-local IPv6 gateways need the interface as zone
+			return &net.IPAddr{IP: ip, Zone: route.iface}, nil
+		}
+	}
+	return nil, fmt.Errorf("no default gateway found")
+}
+
+// listenEcho opens an ICMP socket for pinging dst, preferring unprivileged
+// ping sockets over raw ones. privileged reports a raw socket, where replies
+// to other processes' pings are seen too.
+func listenEcho(dst *net.IPAddr) (*icmp.PacketConn, net.Addr, bool, error) {
+	network, raw, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if dst.IP.To4() == nil {
+		network, raw, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, &net.UDPAddr{IP: dst.IP, Zone: dst.Zone}, false, nil
+	}
+	if rawConn, rawErr := icmp.ListenPacket(raw, address); rawErr == nil {
+		return rawConn, dst, true, nil
+	}
+	return nil, nil, false, err
+}
+
+// echo sends one echo request and waits for its reply until deadline,
+// returning the round-trip time in milliseconds
+func (c *gatewayPingCollector) echo(conn *icmp.PacketConn, dst net.Addr, gateway *net.IPAddr, privileged bool, seq int, deadline time.Time) (float64, error) {
+	var request, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1
+	if gateway.IP.To4() == nil {
+		request, reply, proto = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+
+	msg := icmp.Message{
+		Type: request,
+		Body: &icmp.Echo{ID: c.id, Seq: seq, Data: []byte("wirescope")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+
+		if !gateway.IP.Equal(peerIP(peer)) {
+			continue
+		}
+		parsed, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || parsed.Type != reply {
+			continue
+		}
+		// Ping sockets rewrite the ID, so only raw sockets can match on it
+		body, ok := parsed.Body.(*icmp.Echo)
+		if !ok || body.Seq != seq || (privileged && body.ID != c.id) {
+			continue
+		}
+		return float64(rtt.Microseconds()) / 1000, nil
+	}
+}
+
+// peerIP returns the IP of an ICMP peer address
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// errCollectorUnsupported is returned by collectors that need a platform
+// facility this probe build lacks
+var errCollectorUnsupported = fmt.Errorf("not supported on %s: %w", runtime.GOOS, errors.ErrUnsupported)
@@ -0,0 +1,131 @@
+//go:build linux
+
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procNetWireless lists wireless interfaces and their signal statistics
+const procNetWireless = "/proc/net/wireless"
+
+// readWiFi returns the link quality, signal and noise of the named wireless
+// interface, or of the first one listed when iface is empty
+func readWiFi(iface string) (map[string]float64, error) {
+	data, err := os.ReadFile(procNetWireless)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wireless statistics: %w", err)
+	}
+	return parseWireless(data, iface)
+}
+
+// parseWireless parses /proc/net/wireless, which after two header lines has
+// one line per interface:
+//
+//	wlan0: 0000   70.  -40.  -256        0      0      0      0      0        0
+func parseWireless(data []byte, iface string) (map[string]float64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; scanner.Scan(); line++ {
+		if line < 2 {
+			continue
+		}
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		name = strings.TrimSpace(name)
+		if !ok || (iface != "" && name != iface) {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("malformed wireless statistics for %s", name)
+		}
+		// Values end with "." when the driver reports them as updated
+		value := func(i int) (float64, error) {
+			return strconv.ParseFloat(strings.TrimSuffix(fields[i], "."), 64)
+		}
+		quality, err := value(1)
+		if err != nil {
+			return nil, fmt.Errorf("malformed link quality for %s: %w", name, err)
+		}
+		level, err := value(2)
+		if err != nil {
+			return nil, fmt.Errorf("malformed signal level for %s: %w", name, err)
+		}
+		// Some drivers report dBm as an unsigned byte
+		if level > 63 {
+			level -= 256
+		}
+		metrics := map[string]float64{
+			"link_quality": quality,
+			"signal_dbm":   level,
+		}
+		// -256 (or 0 as unsigned) means the driver has no noise reading
+		if noise, err := value(3); err == nil && noise != 0 && noise > -256 {
+			if noise > 63 {
+				noise -= 256
+			}
+			metrics["noise_dbm"] = noise
+		}
+		return metrics, nil
+	}
+	if iface != "" {
+		return nil, fmt.Errorf("wireless interface %s not found", iface)
+	}
+	return nil, fmt.Errorf("no wireless interface found")
+}
+
+// readLoadAvg returns the 1, 5 and 15 minute load averages
+func readLoadAvg() ([3]float64, error) {
+	var load [3]float64
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, fmt.Errorf("failed to read load average: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed load average")
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("malformed load average: %w", err)
+		}
+	}
+	return load, nil
+}
+
+// readCPUTimes returns the idle (including iowait) and total CPU time across
+// all CPUs, in clock ticks
+func readCPUTimes() (idle, total uint64, err error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already included in user and nice
+		for i, field := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("malformed cpu times: %w", err)
+			}
+			total += v
+			if i == 3 || i == 4 {
+				idle += v
+			}
+		}
+		return idle, total, nil
+	}
+	return 0, 0, fmt.Errorf("cpu times not found")
+}
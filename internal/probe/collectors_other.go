@@ -0,0 +1,18 @@
+//go:build !linux
+
+package probe
+
+// readWiFi needs /proc/net/wireless
+func readWiFi(iface string) (map[string]float64, error) {
+	return nil, errCollectorUnsupported
+}
+
+// readLoadAvg needs /proc/loadavg
+func readLoadAvg() ([3]float64, error) {
+	return [3]float64{}, errCollectorUnsupported
+}
+
+// readCPUTimes needs /proc/stat
+func readCPUTimes() (idle, total uint64, err error) {
+	return 0, 0, errCollectorUnsupported
+}
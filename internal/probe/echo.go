@@ -0,0 +1,319 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Echo packets are a fixed header followed by padding. The responder
+// returns them verbatim, so the send timestamp is the probe's own clock and
+// no clock synchronization is needed.
+//
+//	0..3   magic "WSE1"
+//	4..7   sequence number (big endian)
+//	8..15  send time in Unix nanoseconds (big endian)
+//	16..   padding
+const (
+	EchoHeaderSize    = 16
+	EchoMaxPacketSize = 1400
+)
+
+// EchoMagic identifies WireScope echo packets
+var EchoMagic = []byte("WSE1")
+
+// Defaults for the packet train sent by an echo check
+const (
+	defaultEchoCount        = 50
+	defaultEchoIntervalMs   = 20
+	defaultEchoPayloadBytes = 64
+	defaultEchoWaitMs       = 1000
+)
+
+// EchoConfig configures a loss/jitter check against a UDP echo responder
+type EchoConfig struct {
+	// Count is the number of packets in the train (default 50)
+	Count int `json:"count,omitempty"`
+
+	// IntervalMs is the pacing between packets (default 20ms)
+	IntervalMs int `json:"interval_ms,omitempty"`
+
+	// PayloadBytes is the total packet size (default 64)
+	PayloadBytes int `json:"payload_bytes,omitempty"`
+
+	// WaitMs is how long to wait for late replies after the last packet
+	// is sent; replies arriving later count as lost (default 1000ms)
+	WaitMs int `json:"wait_ms,omitempty"`
+}
+
+// EchoResult holds the statistics of a packet train
+type EchoResult struct {
+	PacketsSent     int
+	PacketsReceived int
+	LossRate        float64
+	ReorderedCount  int
+	DuplicateCount  int
+	RTTP50Ms        float64
+	RTTP95Ms        float64
+	RTTMaxMs        float64
+
+	// ICMPErrors counts the read errors (typically ICMP unreachable) seen
+	// while waiting for replies
+	ICMPErrors int
+
+	// JitterMs is the RFC 3550 interarrival jitter estimate
+	JitterMs float64
+}
+
+// Validate checks the echo configuration
+func (c *EchoConfig) Validate() error {
+	if c.Count < 0 || c.IntervalMs < 0 || c.WaitMs < 0 {
+		return fmt.Errorf("echo count, interval_ms and wait_ms must be non-negative")
+	}
+	if c.PayloadBytes != 0 && (c.PayloadBytes < EchoHeaderSize || c.PayloadBytes > EchoMaxPacketSize) {
+		return fmt.Errorf("echo payload_bytes must be between %d and %d", EchoHeaderSize, EchoMaxPacketSize)
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the configuration with defaults applied
+func (c *EchoConfig) withDefaults() EchoConfig {
+	out := EchoConfig{}
+	if c != nil {
+		out = *c
+	}
+	if out.Count == 0 {
+		out.Count = defaultEchoCount
+	}
+	if out.IntervalMs == 0 {
+		out.IntervalMs = defaultEchoIntervalMs
+	}
+	if out.PayloadBytes == 0 {
+		out.PayloadBytes = defaultEchoPayloadBytes
+	}
+	if out.WaitMs == 0 {
+		out.WaitMs = defaultEchoWaitMs
+	}
+	return out
+}
+
+// IsEchoPacket reports whether data is a well-formed echo packet
+func IsEchoPacket(data []byte) bool {
+	return len(data) >= EchoHeaderSize && len(data) <= EchoMaxPacketSize && bytes.Equal(data[:4], EchoMagic)
+}
+
+// encodeEchoPacket fills buf with an echo packet header
+func encodeEchoPacket(buf []byte, seq uint32, sent time.Time) {
+	copy(buf[:4], EchoMagic)
+	binary.BigEndian.PutUint32(buf[4:8], seq)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(sent.UnixNano()))
+}
+
+// echoArrival is a reply as seen by the probe
+type echoArrival struct {
+	seq uint32
+	rtt time.Duration
+}
+
+// MeasureEcho sends a paced train of timestamped packets to a UDP echo
+// responder and computes RTT percentiles, loss, reordering and jitter. DNS
+// timing is reported as usual and the median RTT as the TTFB stage; a train
+// with no replies at all is reported with the "UDP" error stage, as is a
+// train cut short by ctx.
+func MeasureEcho(ctx context.Context, target string, cfg *EchoConfig, family string, egress *EgressConfig, timeouts *TimeoutConfig) (*Measurement, error) {
+	settings := cfg.withDefaults()
+	result := &EchoResult{}
+	measurement := &Measurement{
+		Target:        target,
+		AddressFamily: family,
+		Echo:          result,
+		Timestamp:     time.Now(),
+	}
+
+	fail := func(stage string, err error) (*Measurement, error) {
+		return measurement.fail(stageError(stage, err))
+	}
+
+	if !ValidAddressFamily(family) {
+		return fail("parse", fmt.Errorf("unsupported address family %q", family))
+	}
+
+	host, port, err := SplitSocketTarget(target)
+	if err != nil {
+		return fail("parse", err)
+	}
+
+	ip, err := resolveSocketTarget(ctx, measurement, host, family, timeouts)
+	if err != nil {
+		return fail("DNS", err)
+	}
+
+	network := "udp"
+	switch family {
+	case AddressFamilyIPv4:
+		network = "udp4"
+	case AddressFamilyIPv6:
+		network = "udp6"
+	}
+
+	dialer, err := egress.dialer("udp", family, timeouts.connect())
+	if err != nil {
+		return fail("UDP", err)
+	}
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return fail("UDP", err)
+	}
+	defer conn.Close()
+	measurement.RemoteAddr = conn.RemoteAddr().String()
+	measurement.LocalIP = localIP(conn.LocalAddr())
+	measurement.EgressInterface = egressInterface(conn.LocalAddr())
+	defer watchConn(ctx, conn)()
+
+	var mu sync.Mutex
+	var arrivals []echoArrival
+	done := make(chan struct{})
+
+	// Receive replies until the read deadline set after the last send
+	go func() {
+		defer close(done)
+		buf := make([]byte, EchoMaxPacketSize)
+		for {
+			n, err := conn.Read(buf)
+			now := time.Now()
+			if err != nil {
+				if ne, ok := err.(net.Error); (ok && ne.Timeout()) || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				// ICMP unreachable surfaces as a read error on a connected
+				// socket; keep listening for the rest of the train, unless
+				// there are more errors than packets could have caused
+				mu.Lock()
+				result.ICMPErrors++
+				exhausted := result.ICMPErrors > settings.Count
+				mu.Unlock()
+				if exhausted {
+					return
+				}
+				continue
+			}
+			if !IsEchoPacket(buf[:n]) {
+				continue
+			}
+			seq := binary.BigEndian.Uint32(buf[4:8])
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:16])))
+			mu.Lock()
+			arrivals = append(arrivals, echoArrival{seq: seq, rtt: now.Sub(sent)})
+			mu.Unlock()
+		}
+	}()
+
+	packet := make([]byte, settings.PayloadBytes)
+	interval := time.Duration(settings.IntervalMs) * time.Millisecond
+	for i := 0; i < settings.Count; i++ {
+		encodeEchoPacket(packet, uint32(i), time.Now())
+		if _, err := conn.Write(packet); err == nil {
+			result.PacketsSent++
+		}
+		if i < settings.Count-1 && sleepContext(ctx, interval) != nil {
+			break
+		}
+	}
+
+	conn.SetReadDeadline(deadlineWithin(ctx, time.Duration(settings.WaitMs)*time.Millisecond))
+	<-done
+
+	mu.Lock()
+	summarizeEcho(result, arrivals)
+	mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return fail("UDP", fmt.Errorf("train cut short after %d packets: %w", result.PacketsSent, err))
+	}
+	if result.PacketsSent == 0 {
+		return fail("UDP", fmt.Errorf("failed to send any packets"))
+	}
+	if result.PacketsReceived == 0 {
+		if result.ICMPErrors > 0 {
+			return fail("UDP", fmt.Errorf("no replies to %d packets (%d ICMP errors)", result.PacketsSent, result.ICMPErrors))
+		}
+		return fail("UDP", fmt.Errorf("no replies to %d packets", result.PacketsSent))
+	}
+
+	measurement.HTTPTTFBMs = result.RTTP50Ms
+	return measurement, nil
+}
+
+// summarizeEcho computes train statistics from replies in arrival order
+func summarizeEcho(result *EchoResult, arrivals []echoArrival) {
+	seen := make(map[uint32]bool, len(arrivals))
+	var rtts []float64
+	var maxSeq int64 = -1
+	var jitter float64
+	var prevTransit float64
+	havePrev := false
+
+	for _, a := range arrivals {
+		if seen[a.seq] {
+			result.DuplicateCount++
+			continue
+		}
+		seen[a.seq] = true
+
+		if int64(a.seq) < maxSeq {
+			result.ReorderedCount++
+		} else {
+			maxSeq = int64(a.seq)
+		}
+
+		// RFC 3550 section 6.4.1: J += (|D(i-1,i)| - J) / 16, where D is the
+		// difference in transit time. With echo packets both timestamps come
+		// from the probe clock, so the transit time is the RTT.
+		transit := float64(a.rtt.Microseconds()) / 1000.0
+		if havePrev {
+			jitter += (math.Abs(transit-prevTransit) - jitter) / 16
+		}
+		prevTransit = transit
+		havePrev = true
+
+		rtts = append(rtts, transit)
+	}
+
+	result.PacketsReceived = len(rtts)
+	if result.PacketsSent > 0 {
+		lost := result.PacketsSent - result.PacketsReceived
+		if lost < 0 {
+			lost = 0
+		}
+		result.LossRate = float64(lost) / float64(result.PacketsSent)
+	}
+	result.JitterMs = jitter
+
+	if len(rtts) > 0 {
+		sort.Float64s(rtts)
+		result.RTTP50Ms = percentileSorted(rtts, 50)
+		result.RTTP95Ms = percentileSorted(rtts, 95)
+		result.RTTMaxMs = rtts[len(rtts)-1]
+	}
+}
+
+// percentileSorted returns the linearly interpolated percentile of sorted data
+func percentileSorted(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
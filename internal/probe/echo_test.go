@@ -0,0 +1,164 @@
+package probe
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSummarizeEcho(t *testing.T) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+
+	tests := []struct {
+		name         string
+		sent         int
+		arrivals     []echoArrival
+		wantReceived int
+		wantLoss     float64
+		wantReorder  int
+		wantDup      int
+		wantP50      float64
+		wantMax      float64
+		wantJitter   float64
+	}{
+		{
+			name:     "no replies",
+			sent:     4,
+			wantLoss: 1,
+		},
+		{
+			name: "in order with constant rtt",
+			sent: 4,
+			arrivals: []echoArrival{
+				{seq: 0, rtt: ms(10)}, {seq: 1, rtt: ms(10)}, {seq: 2, rtt: ms(10)}, {seq: 3, rtt: ms(10)},
+			},
+			wantReceived: 4,
+			wantP50:      10,
+			wantMax:      10,
+		},
+		{
+			name: "loss",
+			sent: 4,
+			arrivals: []echoArrival{
+				{seq: 0, rtt: ms(10)}, {seq: 2, rtt: ms(20)},
+			},
+			wantReceived: 2,
+			wantLoss:     0.5,
+			wantP50:      15,
+			wantMax:      20,
+			wantJitter:   10.0 / 16,
+		},
+		{
+			name: "reordered and duplicated",
+			sent: 3,
+			arrivals: []echoArrival{
+				{seq: 1, rtt: ms(10)}, {seq: 0, rtt: ms(10)}, {seq: 0, rtt: ms(10)}, {seq: 2, rtt: ms(10)},
+			},
+			wantReceived: 3,
+			wantReorder:  1,
+			wantDup:      1,
+			wantP50:      10,
+			wantMax:      10,
+		},
+		{
+			name: "jitter follows rtt changes",
+			sent: 3,
+			arrivals: []echoArrival{
+				{seq: 0, rtt: ms(10)}, {seq: 1, rtt: ms(26)}, {seq: 2, rtt: ms(10)},
+			},
+			wantReceived: 3,
+			wantP50:      10,
+			wantMax:      26,
+			wantJitter:   1 + (16-1)/16.0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &EchoResult{PacketsSent: tt.sent}
+			summarizeEcho(result, tt.arrivals)
+
+			if result.PacketsReceived != tt.wantReceived {
+				t.Errorf("PacketsReceived = %d, expected %d", result.PacketsReceived, tt.wantReceived)
+			}
+			if math.Abs(result.LossRate-tt.wantLoss) > 1e-9 {
+				t.Errorf("LossRate = %v, expected %v", result.LossRate, tt.wantLoss)
+			}
+			if result.ReorderedCount != tt.wantReorder {
+				t.Errorf("ReorderedCount = %d, expected %d", result.ReorderedCount, tt.wantReorder)
+			}
+			if result.DuplicateCount != tt.wantDup {
+				t.Errorf("DuplicateCount = %d, expected %d", result.DuplicateCount, tt.wantDup)
+			}
+			if math.Abs(result.RTTP50Ms-tt.wantP50) > 1e-9 {
+				t.Errorf("RTTP50Ms = %v, expected %v", result.RTTP50Ms, tt.wantP50)
+			}
+			if math.Abs(result.RTTMaxMs-tt.wantMax) > 1e-9 {
+				t.Errorf("RTTMaxMs = %v, expected %v", result.RTTMaxMs, tt.wantMax)
+			}
+			if math.Abs(result.JitterMs-tt.wantJitter) > 1e-9 {
+				t.Errorf("JitterMs = %v, expected %v", result.JitterMs, tt.wantJitter)
+			}
+		})
+	}
+}
+
+func TestMeasureEcho(t *testing.T) {
+	responder, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer responder.Close()
+	go func() {
+		buf := make([]byte, EchoMaxPacketSize)
+		for {
+			n, addr, err := responder.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if IsEchoPacket(buf[:n]) {
+				responder.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+
+	cfg := &EchoConfig{Count: 10, IntervalMs: 1, WaitMs: 200}
+	m, err := MeasureEcho(context.Background(), responder.LocalAddr().String(), cfg, AddressFamilyIPv4, nil, nil)
+	if err != nil {
+		t.Fatalf("MeasureEcho() error = %v", err)
+	}
+	if m.Echo.PacketsSent != 10 || m.Echo.PacketsReceived != 10 {
+		t.Errorf("Expected 10 packets sent and received, got %d and %d", m.Echo.PacketsSent, m.Echo.PacketsReceived)
+	}
+	if m.Echo.LossRate != 0 {
+		t.Errorf("LossRate = %v, expected 0", m.Echo.LossRate)
+	}
+}
+
+func TestMeasureEchoUnreachable(t *testing.T) {
+	// Nothing listens on the port, so every packet bounces with an ICMP
+	// port unreachable and the reader must not spin on the errors
+	closed, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	target := closed.LocalAddr().String()
+	closed.Close()
+
+	cfg := &EchoConfig{Count: 5, IntervalMs: 1, WaitMs: 200}
+	m, err := MeasureEcho(context.Background(), target, cfg, AddressFamilyIPv4, nil, nil)
+	if err == nil {
+		t.Fatal("MeasureEcho() expected an error")
+	}
+	if m.ErrorStage == nil || *m.ErrorStage != "UDP" {
+		t.Errorf("ErrorStage = %v, expected UDP", m.ErrorStage)
+	}
+	if m.Echo.PacketsReceived != 0 {
+		t.Errorf("PacketsReceived = %d, expected 0", m.Echo.PacketsReceived)
+	}
+	if m.Echo.ICMPErrors > cfg.Count+1 {
+		t.Errorf("ICMPErrors = %d, expected at most %d", m.Echo.ICMPErrors, cfg.Count+1)
+	}
+}
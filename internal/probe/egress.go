@@ -0,0 +1,384 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Proxy URL schemes accepted in EgressConfig.Proxy
+const (
+	ProxySchemeHTTP    = "http"
+	ProxySchemeHTTPS   = "https"
+	ProxySchemeSOCKS5  = "socks5"
+	ProxySchemeSOCKS5H = "socks5h"
+)
+
+// EgressConfig controls how a target's measurement traffic leaves the probe
+// host. It is embedded in TargetConfig, so its fields sit at the top level of
+// a target in the targets file.
+type EgressConfig struct {
+	// Proxy routes HTTP measurements through an HTTP CONNECT proxy
+	// ("http://host:port", "https://host:port") or a SOCKS5 proxy
+	// ("socks5://host:port"). Credentials may be given as user:pass@.
+	Proxy string `json:"proxy,omitempty"`
+
+	// SourceInterface binds measurement sockets to an interface (e.g.
+	// "wwan0") so each uplink of a multi-homed host can be measured
+	SourceInterface string `json:"source_interface,omitempty"`
+
+	// SourceAddress binds measurement sockets to a local address
+	SourceAddress string `json:"source_address,omitempty"`
+}
+
+// Validate checks the egress configuration
+func (e *EgressConfig) Validate() error {
+	if e.Proxy != "" {
+		if _, err := e.proxyURL(); err != nil {
+			return err
+		}
+	}
+	if e.SourceAddress != "" && net.ParseIP(e.SourceAddress) == nil {
+		return fmt.Errorf("source_address is not a valid IP address: %s", e.SourceAddress)
+	}
+	if e.SourceInterface != "" && e.SourceAddress != "" {
+		return fmt.Errorf("source_interface and source_address are mutually exclusive")
+	}
+	return nil
+}
+
+// proxyURL parses the proxy URL, or returns nil when no proxy is configured
+func (e *EgressConfig) proxyURL() (*url.URL, error) {
+	if e == nil || e.Proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(e.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	switch u.Scheme {
+	case ProxySchemeHTTP, ProxySchemeHTTPS, ProxySchemeSOCKS5, ProxySchemeSOCKS5H:
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy host is required")
+	}
+	return u, nil
+}
+
+// ProxyDisplay returns the proxy URL without credentials, for reporting
+func (e *EgressConfig) ProxyDisplay() string {
+	u, err := e.proxyURL()
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.Scheme + "://" + proxyAddr(u)
+}
+
+// proxyAddr returns the host:port of a proxy, defaulting the port by scheme
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case ProxySchemeHTTPS:
+		return net.JoinHostPort(u.Hostname(), "443")
+	case ProxySchemeSOCKS5, ProxySchemeSOCKS5H:
+		return net.JoinHostPort(u.Hostname(), "1080")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// dialer returns a dialer for an address family mode, bound to the
+// configured source interface or address. network is "tcp" or "udp".
+func (e *EgressConfig) dialer(network, family string, timeout time.Duration) (*net.Dialer, error) {
+	dialer := newDialer(family, timeout)
+	if e == nil {
+		return dialer, nil
+	}
+
+	var localIP net.IP
+	switch {
+	case e.SourceAddress != "":
+		localIP = net.ParseIP(e.SourceAddress)
+	case e.SourceInterface != "":
+		iface, err := net.InterfaceByName(e.SourceInterface)
+		if err != nil {
+			return nil, fmt.Errorf("source interface: %w", err)
+		}
+		if bindToDeviceSupported {
+			// Binding the socket to the device keeps the kernel's source
+			// address selection and both address families
+			name := iface.Name
+			dialer.Control = func(_, _ string, c syscall.RawConn) error {
+				var bindErr error
+				if err := c.Control(func(fd uintptr) { bindErr = bindToDevice(fd, name) }); err != nil {
+					return err
+				}
+				return bindErr
+			}
+			return dialer, nil
+		}
+		localIP, err = interfaceAddr(iface, family)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return dialer, nil
+	}
+
+	if network == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{IP: localIP}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+	return dialer, nil
+}
+
+// interfaceAddr picks the address of an interface to bind to for an address
+// family mode, preferring IPv4 unless IPv6 was requested
+func interfaceAddr(iface *net.Interface, family string) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("source interface %s: %w", iface.Name, err)
+	}
+	var v4, v6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			if v4 == nil {
+				v4 = ipNet.IP
+			}
+		} else if v6 == nil {
+			v6 = ipNet.IP
+		}
+	}
+	switch {
+	case family == AddressFamilyIPv6 && v6 != nil:
+		return v6, nil
+	case family != AddressFamilyIPv6 && v4 != nil:
+		return v4, nil
+	case family != AddressFamilyIPv4 && family != AddressFamilyIPv6 && v6 != nil:
+		return v6, nil
+	}
+	return nil, fmt.Errorf("source interface %s has no usable %s address", iface.Name, lookupNetwork(family))
+}
+
+// transport returns an HTTP transport that dials through the configured
+// source binding and proxy, with the connect, TLS and TTFB timeouts applied
+func (e *EgressConfig) transport(family string, timeouts *TimeoutConfig) (*http.Transport, error) {
+	dialer, err := e.dialer("tcp", family, timeouts.connect())
+	if err != nil {
+		return nil, err
+	}
+	network := dialNetwork(family)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   timeouts.tls(),
+		ResponseHeaderTimeout: timeouts.ttfb(),
+	}
+	proxyURL, err := e.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport, nil
+}
+
+// proxyTimings splits connection setup through a proxy into the TCP connect
+// to the proxy and the proxy handshake (HTTP CONNECT or SOCKS5 negotiation)
+type proxyTimings struct {
+	tcp     time.Duration
+	connect time.Duration
+}
+
+// dialProxy opens a tunnel to addr through the proxy, connecting to the
+// proxy at proxyDialAddr. Failures to reach the proxy are reported with the
+// "TCP" stage and handshake failures with the "proxy" stage. The dialer
+// timeout bounds the time until the tunnel is ready.
+func dialProxy(ctx context.Context, dialer *net.Dialer, network string, proxyURL *url.URL, proxyDialAddr, addr string, timings *proxyTimings) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case ProxySchemeSOCKS5, ProxySchemeSOCKS5H:
+		return dialSOCKS5(ctx, dialer, network, proxyURL, proxyDialAddr, addr, timings)
+	}
+	return dialHTTPConnect(ctx, dialer, network, proxyURL, proxyDialAddr, addr, timings)
+}
+
+// dialHTTPConnect opens a tunnel with an HTTP CONNECT request
+func dialHTTPConnect(ctx context.Context, dialer *net.Dialer, network string, proxyURL *url.URL, proxyDialAddr, addr string, timings *proxyTimings) (net.Conn, error) {
+	tcpStart := time.Now()
+	conn, err := dialer.DialContext(ctx, network, proxyDialAddr)
+	timings.tcp = time.Since(tcpStart)
+	if err != nil {
+		return nil, stageError("TCP", err)
+	}
+
+	connectStart := time.Now()
+	defer func() { timings.connect = time.Since(connectStart) }()
+	fail := func(err error) (net.Conn, error) {
+		conn.Close()
+		return nil, stageError("proxy", err)
+	}
+
+	conn.SetDeadline(tcpStart.Add(dialer.Timeout))
+	stop := watchConn(ctx, conn)
+	defer stop()
+	if proxyURL.Scheme == ProxySchemeHTTPS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fail(fmt.Errorf("proxy TLS handshake failed: %w", err))
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return fail(fmt.Errorf("failed to send CONNECT: %w", err))
+	}
+
+	// As in net/http, the response body is not read: after a successful
+	// CONNECT the stream belongs to the tunnel
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read CONNECT response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("proxy CONNECT returned %s", resp.Status))
+	}
+	if !stop() {
+		return fail(ctx.Err())
+	}
+	conn.SetDeadline(time.Time{})
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// dialSOCKS5 opens a tunnel through a SOCKS5 proxy. The proxy resolves the
+// target host name.
+func dialSOCKS5(ctx context.Context, dialer *net.Dialer, network string, proxyURL *url.URL, proxyDialAddr, addr string, timings *proxyTimings) (net.Conn, error) {
+	var auth *proxy.Auth
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+
+	forward := &timedDialer{dialer: dialer, network: network}
+	socks, err := proxy.SOCKS5("tcp", proxyDialAddr, auth, forward)
+	if err != nil {
+		return nil, stageError("proxy", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dialer.Timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	total := time.Since(start)
+	timings.tcp = forward.elapsed
+	timings.connect = total - forward.elapsed
+	if err != nil {
+		if !forward.connected {
+			return nil, stageError("TCP", err)
+		}
+		return nil, stageError("proxy", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// timedDialer times the TCP connect to a SOCKS5 proxy
+type timedDialer struct {
+	dialer  *net.Dialer
+	network string
+
+	elapsed   time.Duration
+	connected bool
+}
+
+// Dial implements proxy.Dialer
+func (d *timedDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext implements proxy.ContextDialer
+func (d *timedDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.dialer.DialContext(ctx, d.network, addr)
+	d.elapsed = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	d.connected = true
+	return conn, nil
+}
+
+// bufferedConn is a tunnel whose first bytes were read along with the
+// proxy's CONNECT response
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// egressInterface returns the name of the interface holding a connection's
+// local address, or "" if none does
+func egressInterface(addr net.Addr) string {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return ""
+	}
+	iface, err := interfaceForAddr(ip)
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
+
+// localIP returns the IP of a connection's local address
+func localIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	return ""
+}
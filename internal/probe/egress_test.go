@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// connectProxy is an HTTP CONNECT proxy requiring the given credentials
+// (none if empty). It counts the tunnels it opened.
+func connectProxy(credentials string) (*httptest.Server, *int32) {
+	var tunnels int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if credentials != "" {
+			want := "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+			if r.Header.Get("Proxy-Authorization") != want {
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return
+			}
+		}
+
+		upstream, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		atomic.AddInt32(&tunnels, 1)
+		client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		go func() {
+			io.Copy(upstream, client)
+			upstream.Close()
+		}()
+		io.Copy(client, upstream)
+		client.Close()
+	}))
+	return server, &tunnels
+}
+
+func TestMeasureTargetThroughConnectProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	open, openTunnels := connectProxy("")
+	defer open.Close()
+	authenticated, authTunnels := connectProxy("probe:secret")
+	defer authenticated.Close()
+
+	unreachable, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	unreachableURL := "http://" + unreachable.Addr().String()
+	unreachable.Close()
+
+	withUser := func(proxyURL, user string) string {
+		return strings.Replace(proxyURL, "http://", "http://"+user+"@", 1)
+	}
+
+	tests := []struct {
+		name        string
+		proxy       string
+		tunnels     *int32
+		wantStage   string
+		wantTunnels int32
+	}{
+		{name: "open proxy", proxy: open.URL, tunnels: openTunnels, wantTunnels: 1},
+		{name: "proxy credentials", proxy: withUser(authenticated.URL, "probe:secret"), tunnels: authTunnels, wantTunnels: 1},
+		{name: "missing credentials", proxy: authenticated.URL, tunnels: authTunnels, wantStage: models.ErrorStageProxy},
+		{name: "wrong credentials", proxy: withUser(authenticated.URL, "probe:wrong"), tunnels: authTunnels, wantStage: models.ErrorStageProxy},
+		{name: "proxy unreachable", proxy: unreachableURL, wantStage: models.ErrorStageTCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before int32
+			if tt.tunnels != nil {
+				before = atomic.LoadInt32(tt.tunnels)
+			}
+			cfg := &TargetConfig{
+				URL:          target.URL,
+				EgressConfig: EgressConfig{Proxy: tt.proxy},
+			}
+			if err := cfg.EgressConfig.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			m, err := MeasureTargetConfig(ctx, cfg, AddressFamilyAny)
+
+			if tt.wantStage != "" {
+				if err == nil {
+					t.Fatal("MeasureTargetConfig() expected an error")
+				}
+				if m.ErrorStage == nil || *m.ErrorStage != tt.wantStage {
+					t.Errorf("ErrorStage = %v, expected %s", m.ErrorStage, tt.wantStage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MeasureTargetConfig() error = %v", err)
+			}
+			if m.HTTPStatusCode != http.StatusOK {
+				t.Errorf("HTTPStatusCode = %d, expected 200", m.HTTPStatusCode)
+			}
+			if m.ProxyConnectMs <= 0 {
+				t.Errorf("ProxyConnectMs = %v, expected the CONNECT to be timed", m.ProxyConnectMs)
+			}
+			if got := atomic.LoadInt32(tt.tunnels) - before; got != tt.wantTunnels {
+				t.Errorf("Proxy opened %d tunnels, expected %d", got, tt.wantTunnels)
+			}
+		})
+	}
+}
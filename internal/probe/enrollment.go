@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+const (
+	enrollmentFile = ".telemetry_enrollment.json"
+)
+
+// Enrollment is what a probe keeps after enrolling: its identity, ingest
+// credentials and the initial configuration issued by the server
+type Enrollment struct {
+	EnrollmentID    string          `json:"enrollment_id"`
+	Server          string          `json:"server"`
+	ClientID        string          `json:"client_id"`
+	APIToken        string          `json:"api_token"`
+	IngestURL       string          `json:"ingest_url"`
+	IntervalSeconds int             `json:"interval_seconds,omitempty"`
+	Targets         json.RawMessage `json:"targets,omitempty"`
+	EnrolledAt      time.Time       `json:"enrolled_at"`
+}
+
+// Enroll exchanges an enrollment code with the admin server at server for
+// the probe's client ID, ingest token and initial configuration
+func Enroll(ctx context.Context, server string, req *models.EnrollRequest) (*Enrollment, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal enrollment request: %w", err)
+	}
+
+	server = strings.TrimRight(server, "/")
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", server+"/api/v1/enroll", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enrollment request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact enrollment server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrollment response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("enrollment rejected: %s", apiErr.Error)
+		}
+		return nil, fmt.Errorf("enrollment rejected: HTTP %d", resp.StatusCode)
+	}
+
+	var enrolled models.EnrollResponse
+	if err := json.Unmarshal(data, &enrolled); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment response: %w", err)
+	}
+	if enrolled.ClientID == "" || enrolled.APIToken == "" {
+		return nil, fmt.Errorf("enrollment response is missing credentials")
+	}
+	if err := enrolled.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("enrollment response has an invalid config: %w", err)
+	}
+
+	return &Enrollment{
+		EnrollmentID:    enrolled.EnrollmentID,
+		Server:          server,
+		ClientID:        enrolled.ClientID,
+		APIToken:        enrolled.APIToken,
+		IngestURL:       enrolled.Config.IngestURL,
+		IntervalSeconds: enrolled.Config.IntervalSeconds,
+		Targets:         enrolled.Config.Targets,
+		EnrolledAt:      time.Now().UTC(),
+	}, nil
+}
+
+// enrollmentPath returns where the enrollment is stored, next to the client
+// ID file
+func enrollmentPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, enrollmentFile), nil
+}
+
+// SaveEnrollment stores the enrollment and makes its client ID the one
+// GetOrCreateClientID returns
+func SaveEnrollment(e *Enrollment) error {
+	path, err := enrollmentPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal enrollment: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save enrollment: %w", err)
+	}
+
+	clientIDPath := filepath.Join(filepath.Dir(path), clientIDFile)
+	if err := os.WriteFile(clientIDPath, []byte(e.ClientID), 0600); err != nil {
+		return fmt.Errorf("failed to save client ID: %w", err)
+	}
+	return nil
+}
+
+// LoadEnrollment returns the stored enrollment, or nil if the probe has not
+// been enrolled
+func LoadEnrollment() (*Enrollment, error) {
+	path, err := enrollmentPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrollment: %w", err)
+	}
+
+	var e Enrollment
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment %s: %w", path, err)
+	}
+	return &e, nil
+}
@@ -1,52 +1,267 @@
 package probe
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// Address family modes a target can be measured with. AddressFamilyAny keeps
+// the system resolver/dialer behavior and leaves events untagged.
+const (
+	AddressFamilyAny           = ""
+	AddressFamilyIPv4          = "ipv4"
+	AddressFamilyIPv6          = "ipv6"
+	AddressFamilyHappyEyeballs = "happy-eyeballs"
 )
 
+// happyEyeballsFallbackDelay is the head start given to the preferred family
+// before racing the other one (RFC 8305 recommends 250ms)
+const happyEyeballsFallbackDelay = 250 * time.Millisecond
+
 // Measurement represents a single network measurement result
 type Measurement struct {
 	Target         string
+	AddressFamily  string
+	RemoteAddr     string
 	DNSMs          float64
 	TCPMs          float64
 	TLSMs          float64
 	HTTPTTFBMs     float64
+	ProxyConnectMs float64
+	HTTPStatusCode int
 	ThroughputKbps float64
+	UploadKbps     float64
+	Streams        int
+	Echo           *EchoResult
 	ErrorStage     *string
 	Timestamp      time.Time
+
+	// TimedOut is set when the failing stage ran out of time rather than
+	// failing outright
+	TimedOut bool
+
+	// LocalIP and EgressInterface describe the local end of the measured
+	// connection, so bound measurements record the uplink they used
+	LocalIP         string
+	EgressInterface string
+
+	// ConnectedFamily is the address family of the direct connection to the
+	// target ("ipv4" or "ipv6"), which in happy-eyeballs mode is the family
+	// that won the race. It is empty through a proxy.
+	ConnectedFamily string
 }
 
 // MeasurementError represents an error at a specific stage
 type MeasurementError struct {
 	Stage   string
 	Message string
+
+	// Timeout is set when the stage ran out of time
+	Timeout bool
 }
 
 func (e *MeasurementError) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("%s timeout: %s", e.Stage, e.Message)
+	}
 	return fmt.Sprintf("%s error: %s", e.Stage, e.Message)
 }
 
+// fail records a failed stage on the measurement
+func (m *Measurement) fail(err *MeasurementError) (*Measurement, error) {
+	m.ErrorStage = &err.Stage
+	m.TimedOut = err.Timeout
+	return m, err
+}
+
+// ValidAddressFamily reports whether family is a supported address family mode
+func ValidAddressFamily(family string) bool {
+	switch family {
+	case AddressFamilyAny, AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyHappyEyeballs:
+		return true
+	}
+	return false
+}
+
+// lookupNetwork returns the resolver network for an address family mode
+func lookupNetwork(family string) string {
+	switch family {
+	case AddressFamilyIPv4:
+		return "ip4"
+	case AddressFamilyIPv6:
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// dialNetwork returns the dialer network for an address family mode
+func dialNetwork(family string) string {
+	switch family {
+	case AddressFamilyIPv4:
+		return "tcp4"
+	case AddressFamilyIPv6:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// newDialer returns a dialer configured for an address family mode.
+// Single-family modes disable the fallback so a broken family surfaces as a
+// TCP error instead of being hidden; measured connections in happy-eyeballs
+// mode race the families with dialHappyEyeballs, and other connections (such
+// as throughput downloads) with the dialer's own fallback.
+func newDialer(family string, timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	switch family {
+	case AddressFamilyHappyEyeballs:
+		dialer.FallbackDelay = happyEyeballsFallbackDelay
+	case AddressFamilyIPv4, AddressFamilyIPv6:
+		dialer.FallbackDelay = -1
+	}
+	return dialer
+}
+
+// addressFamilyOf returns the address family of a TCP address, or "" for
+// other addresses
+func addressFamilyOf(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	if tcpAddr.IP.To4() != nil {
+		return AddressFamilyIPv4
+	}
+	return AddressFamilyIPv6
+}
+
+// dialHappyEyeballs races TCP connections to the resolved addresses of both
+// families (RFC 8305). The family of the first address is tried first and the
+// other one after happyEyeballsFallbackDelay, or as soon as the first attempt
+// fails; the first connection established wins and the other is closed.
+func dialHappyEyeballs(ctx context.Context, dialer *net.Dialer, ips []net.IP, port string) (net.Conn, error) {
+	primary := ips[0]
+	var fallback net.IP
+	for _, ip := range ips[1:] {
+		if (ip.To4() == nil) != (primary.To4() == nil) {
+			fallback = ip
+			break
+		}
+	}
+	if fallback == nil {
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(primary.String(), port))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan attempt, 2)
+	dial := func(ip net.IP) {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		results <- attempt{conn: conn, err: err}
+	}
+	go dial(primary)
+	pending, fallbackStarted := 1, false
+	startFallback := func() {
+		if !fallbackStarted {
+			fallbackStarted = true
+			pending++
+			go dial(fallback)
+		}
+	}
+
+	timer := time.NewTimer(happyEyeballsFallbackDelay)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			startFallback()
+		case a := <-results:
+			pending--
+			if a.err == nil {
+				if pending > 0 {
+					// The losing attempt is cancelled; close it should it
+					// still connect
+					go func() {
+						if lost := <-results; lost.conn != nil {
+							lost.conn.Close()
+						}
+					}()
+				}
+				return a.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = a.err
+			}
+			if !fallbackStarted {
+				startFallback()
+				continue
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
 // MeasureTarget performs a complete network measurement for a target URL
+// using the system default address family selection
 //
 // Requirements: 1.1, 1.2, 1.3, 1.4, 1.5
 func MeasureTarget(targetURL string) (*Measurement, error) {
+	return MeasureTargetFamily(targetURL, AddressFamilyAny)
+}
+
+// MeasureTargetFamily performs a complete network measurement for a target URL
+// restricted to the given address family mode. In ipv4/ipv6 mode only records
+// of that family are resolved and dialed, so dual-stack targets can be
+// compared family by family.
+func MeasureTargetFamily(targetURL, family string) (*Measurement, error) {
+	return MeasureTargetConfig(context.Background(), &TargetConfig{URL: targetURL}, family)
+}
+
+// MeasureTargetConfig performs a complete network measurement for a configured
+// target. The configured request (method, headers, body, auth) is sent for the
+// TTFB stage and any response assertions are checked afterwards; a failed
+// assertion is reported with the "assertion" error stage. Each stage is bounded
+// by the target timeouts and the whole measurement by ctx and the total timeout.
+func MeasureTargetConfig(ctx context.Context, cfg *TargetConfig, family string) (*Measurement, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeouts.Total())
+	defer cancel()
+
+	targetURL := cfg.URL
 	measurement := &Measurement{
-		Target:    targetURL,
-		Timestamp: time.Now(),
+		Target:        targetURL,
+		AddressFamily: family,
+		Timestamp:     time.Now(),
+	}
+	fail := func(stage string, err error) (*Measurement, error) {
+		return measurement.fail(stageError(stage, err))
+	}
+
+	if !ValidAddressFamily(family) {
+		return fail("parse", fmt.Errorf("unsupported address family %q", family))
 	}
 
 	// Parse URL
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
-		errorStage := "parse"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "parse", Message: err.Error()}
+		return fail("parse", err)
 	}
 
 	// Ensure scheme is present
@@ -63,31 +278,82 @@ func MeasureTarget(targetURL string) (*Measurement, error) {
 		}
 	}
 
+	proxyURL, err := cfg.proxyURL()
+	if err != nil {
+		return fail("parse", err)
+	}
+	dialer, err := cfg.dialer("tcp", family, cfg.Timeouts.connect())
+	if err != nil {
+		return fail("TCP", err)
+	}
+
+	// Through a proxy, the proxy resolves the target, so the DNS stage
+	// times resolving the proxy itself
+	resolveHost, dialHost := parsedURL.Hostname(), host
+	if proxyURL != nil {
+		resolveHost, dialHost = proxyURL.Hostname(), proxyAddr(proxyURL)
+	}
+
 	// Measure DNS resolution time
+	dnsCtx, dnsCancel := context.WithTimeout(ctx, cfg.Timeouts.dns())
 	dnsStart := time.Now()
-	ips, err := net.LookupIP(parsedURL.Hostname())
+	ips, err := net.DefaultResolver.LookupIP(dnsCtx, lookupNetwork(family), resolveHost)
 	measurement.DNSMs = float64(time.Since(dnsStart).Microseconds()) / 1000.0
+	dnsCancel()
 	if err != nil {
-		errorStage := "DNS"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "DNS", Message: err.Error()}
+		return fail("DNS", err)
 	}
 	if len(ips) == 0 {
-		errorStage := "DNS"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "DNS", Message: "no IP addresses found"}
+		return fail("DNS", fmt.Errorf("no IP addresses found"))
 	}
 
-	// Measure TCP connection time
-	tcpStart := time.Now()
-	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
-	measurement.TCPMs = float64(time.Since(tcpStart).Microseconds()) / 1000.0
-	if err != nil {
-		errorStage := "TCP"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "TCP", Message: err.Error()}
+	// Single-family modes dial the resolved address directly so the
+	// dialer cannot silently fall back to the other family
+	dialAddr := dialHost
+	if family == AddressFamilyIPv4 || family == AddressFamilyIPv6 {
+		_, port, _ := net.SplitHostPort(dialHost)
+		dialAddr = net.JoinHostPort(ips[0].String(), port)
+	}
+
+	// Measure TCP connection time, and the proxy handshake separately
+	var conn net.Conn
+	if proxyURL != nil {
+		var timings proxyTimings
+		conn, err = dialProxy(ctx, dialer, dialNetwork(family), proxyURL, dialAddr, host, &timings)
+		measurement.TCPMs = float64(timings.tcp.Microseconds()) / 1000.0
+		measurement.ProxyConnectMs = float64(timings.connect.Microseconds()) / 1000.0
+		if err != nil {
+			// The proxy dialers report the failing stage; anything else is
+			// attributed to the proxy
+			var stageErr *MeasurementError
+			if !errors.As(err, &stageErr) {
+				stageErr = stageError("proxy", err)
+			}
+			return measurement.fail(stageErr)
+		}
+	} else if family == AddressFamilyHappyEyeballs {
+		_, port, _ := net.SplitHostPort(dialHost)
+		tcpStart := time.Now()
+		conn, err = dialHappyEyeballs(ctx, dialer, ips, port)
+		measurement.TCPMs = float64(time.Since(tcpStart).Microseconds()) / 1000.0
+		if err != nil {
+			return fail("TCP", err)
+		}
+	} else {
+		tcpStart := time.Now()
+		conn, err = dialer.DialContext(ctx, dialNetwork(family), dialAddr)
+		measurement.TCPMs = float64(time.Since(tcpStart).Microseconds()) / 1000.0
+		if err != nil {
+			return fail("TCP", err)
+		}
 	}
 	defer conn.Close()
+	measurement.RemoteAddr = conn.RemoteAddr().String()
+	measurement.LocalIP = localIP(conn.LocalAddr())
+	measurement.EgressInterface = egressInterface(conn.LocalAddr())
+	if proxyURL == nil {
+		measurement.ConnectedFamily = addressFamilyOf(conn.RemoteAddr())
+	}
 
 	// Measure TLS handshake time (if HTTPS)
 	var httpConn net.Conn = conn
@@ -98,12 +364,12 @@ func MeasureTarget(targetURL string) (*Measurement, error) {
 			InsecureSkipVerify: false,
 		}
 		tlsConn := tls.Client(conn, tlsConfig)
-		err = tlsConn.Handshake()
+		tlsCtx, tlsCancel := context.WithTimeout(ctx, cfg.Timeouts.tls())
+		err = tlsConn.HandshakeContext(tlsCtx)
 		measurement.TLSMs = float64(time.Since(tlsStart).Microseconds()) / 1000.0
+		tlsCancel()
 		if err != nil {
-			errorStage := "TLS"
-			measurement.ErrorStage = &errorStage
-			return measurement, &MeasurementError{Stage: "TLS", Message: err.Error()}
+			return fail("TLS", err)
 		}
 		httpConn = tlsConn
 	} else {
@@ -112,42 +378,54 @@ func MeasureTarget(targetURL string) (*Measurement, error) {
 
 	// Measure HTTP TTFB (time to first byte)
 	// Create HTTP request
-	req, err := http.NewRequest("GET", targetURL, nil)
+	req, err := cfg.newRequest(targetURL)
 	if err != nil {
-		errorStage := "HTTP"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "HTTP", Message: err.Error()}
+		return fail("HTTP", err)
 	}
+	req = req.WithContext(ctx)
 
 	// Send request and measure TTFB
 	httpStart := time.Now()
 
-	// Create custom transport to use our existing connection
+	// Create custom transport to use our existing connection; the request
+	// context bounds the whole exchange
 	client := &http.Client{
 		Transport: &http.Transport{
 			Dial: func(network, addr string) (net.Conn, error) {
 				return httpConn, nil
 			},
-			DisableKeepAlives: true,
+			DisableKeepAlives:     true,
+			ResponseHeaderTimeout: cfg.Timeouts.ttfb(),
 		},
-		Timeout: 30 * time.Second,
 	}
 
 	resp, err := client.Do(req)
 	measurement.HTTPTTFBMs = float64(time.Since(httpStart).Microseconds()) / 1000.0
 	if err != nil {
-		errorStage := "HTTP"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "HTTP", Message: err.Error()}
+		return fail("HTTP", err)
 	}
 	defer resp.Body.Close()
+	measurement.HTTPStatusCode = resp.StatusCode
 
-	// Read response body to completion (needed for accurate timing)
-	_, err = io.Copy(io.Discard, resp.Body)
+	// Buffer as much of the body as the assertions need, then read the
+	// remainder to completion (needed for accurate timing)
+	var body []byte
+	assertions := cfg.Assertions
+	if assertions != nil && assertions.needsBody() {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, assertions.bodyLimit()))
+		if err != nil {
+			return fail("HTTP", err)
+		}
+	}
+	remaining, err := io.Copy(io.Discard, resp.Body)
 	if err != nil {
-		errorStage := "HTTP"
-		measurement.ErrorStage = &errorStage
-		return measurement, &MeasurementError{Stage: "HTTP", Message: err.Error()}
+		return fail("HTTP", err)
+	}
+
+	if assertions != nil {
+		if err := assertions.Check(resp.StatusCode, body, remaining > 0); err != nil {
+			return fail(models.ErrorStageAssertion, err)
+		}
 	}
 
 	return measurement, nil
@@ -157,19 +435,33 @@ func MeasureTarget(targetURL string) (*Measurement, error) {
 //
 // Requirement: 4.3 - Download 1MB fixed-size objects over HTTPS with fresh connections
 func MeasureThroughput(targetURL string) (float64, error) {
+	return MeasureThroughputFamily(targetURL, AddressFamilyAny)
+}
+
+// MeasureThroughputFamily measures download throughput over the given address family mode
+func MeasureThroughputFamily(targetURL, family string) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultThroughputTimeout)
+	defer cancel()
+	return measureThroughput(ctx, targetURL, family, nil, nil)
+}
+
+// measureThroughput measures download throughput over the given address
+// family mode, source binding and proxy. The download is bounded by ctx.
+func measureThroughput(ctx context.Context, targetURL, family string, egress *EgressConfig, timeouts *TimeoutConfig) (float64, error) {
+	transport, err := egress.transport(family, timeouts)
+	if err != nil {
+		return 0, err
+	}
+
 	// Create HTTP client with no keep-alive to force fresh connections
+	transport.DisableKeepAlives = true
+	transport.DisableCompression = true
 	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			DisableKeepAlives:   true,
-			DisableCompression:  true,
-			MaxIdleConns:        0,
-			MaxIdleConnsPerHost: 0,
-		},
+		Transport: transport,
 	}
 
 	// Create request with cache-busting headers
-	req, err := http.NewRequest("GET", targetURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -204,20 +496,60 @@ func MeasureThroughput(targetURL string) (float64, error) {
 
 // MeasureTargetWithThroughput performs a complete measurement including throughput
 func MeasureTargetWithThroughput(baseURL, throughputURL string) (*Measurement, error) {
+	return MeasureTargetWithThroughputFamily(baseURL, throughputURL, AddressFamilyAny)
+}
+
+// MeasureTargetWithThroughputFamily performs a complete measurement including
+// throughput, with both phases restricted to the given address family mode
+func MeasureTargetWithThroughputFamily(baseURL, throughputURL, family string) (*Measurement, error) {
+	return MeasureTargetConfigWithThroughput(context.Background(), &TargetConfig{URL: baseURL, ThroughputURL: throughputURL}, family)
+}
+
+// MeasureTargetConfigWithThroughput performs a complete measurement of a
+// configured target, followed by a throughput download unless disabled.
+// TCP, UDP and UDP echo targets are dispatched to their own checks. The total
+// timeout covers both phases; cancelling ctx abandons the measurement.
+func MeasureTargetConfigWithThroughput(ctx context.Context, cfg *TargetConfig, family string) (*Measurement, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeouts.Total())
+	defer cancel()
+
+	switch cfg.GetCheckType() {
+	case models.CheckTypeTCP:
+		return MeasureTCP(ctx, cfg.URL, cfg.Socket, family, &cfg.EgressConfig, cfg.Timeouts)
+	case models.CheckTypeUDP:
+		return MeasureUDP(ctx, cfg.URL, cfg.Socket, family, &cfg.EgressConfig, cfg.Timeouts)
+	case models.CheckTypeUDPEcho:
+		return MeasureEcho(ctx, cfg.URL, cfg.Echo, family, &cfg.EgressConfig, cfg.Timeouts)
+	}
+
 	// First measure timing
-	measurement, err := MeasureTarget(baseURL)
-	if err != nil {
+	measurement, err := MeasureTargetConfig(ctx, cfg, family)
+	if err != nil || cfg.DisableThroughput {
 		return measurement, err
 	}
+	throughputURL := cfg.GetThroughputURL()
+
+	if cfg.Throughput != nil {
+		uploadURL := cfg.Throughput.UploadURL
+		if uploadURL == "" {
+			uploadURL = DefaultUploadURL(cfg.URL)
+		}
+		result, err := MeasureThroughputConfig(ctx, throughputURL, uploadURL, cfg.Throughput, family, &cfg.EgressConfig, cfg.Timeouts)
+		measurement.ThroughputKbps = result.DownloadKbps
+		measurement.UploadKbps = result.UploadKbps
+		measurement.Streams = result.Streams
+		if err != nil {
+			return measurement.fail(stageError("throughput", err))
+		}
+		return measurement, nil
+	}
 
 	// Then measure throughput separately
-	throughput, err := MeasureThroughput(throughputURL)
+	throughput, err := measureThroughput(ctx, throughputURL, family, &cfg.EgressConfig, cfg.Timeouts)
 	if err != nil {
 		// Set error stage but don't fail the entire measurement
-		errorStage := "throughput"
-		measurement.ErrorStage = &errorStage
 		measurement.ThroughputKbps = 0
-		return measurement, &MeasurementError{Stage: "throughput", Message: err.Error()}
+		return measurement.fail(stageError("throughput", err))
 	}
 
 	measurement.ThroughputKbps = throughput
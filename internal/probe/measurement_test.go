@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDialHappyEyeballsFallsBack(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// Nothing listens on the IPv6 loopback port, so the IPv4 attempt wins
+	ips := []net.IP{net.ParseIP("::1"), net.ParseIP("127.0.0.1")}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dialHappyEyeballs(ctx, &net.Dialer{}, ips, port)
+	if err != nil {
+		t.Fatalf("dialHappyEyeballs() error = %v", err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().(*net.TCPAddr).IP; !got.Equal(ips[1]) {
+		t.Errorf("Expected a connection to %s, got %s", ips[1], got)
+	}
+	if got := addressFamilyOf(conn.RemoteAddr()); got != AddressFamilyIPv4 {
+		t.Errorf("addressFamilyOf() = %q, expected %q", got, AddressFamilyIPv4)
+	}
+}
+
+func TestMeasureTargetConnectedFamily(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	m, err := MeasureTargetConfig(context.Background(), &TargetConfig{URL: server.URL}, AddressFamilyHappyEyeballs)
+	if err != nil {
+		t.Fatalf("MeasureTargetConfig() error = %v", err)
+	}
+	if m.AddressFamily != AddressFamilyHappyEyeballs {
+		t.Errorf("AddressFamily = %q, expected %q", m.AddressFamily, AddressFamilyHappyEyeballs)
+	}
+	if m.ConnectedFamily != AddressFamilyIPv4 {
+		t.Errorf("ConnectedFamily = %q, expected %q", m.ConnectedFamily, AddressFamilyIPv4)
+	}
+}
+
+func TestDialHappyEyeballsFails(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	if conn, err := dialHappyEyeballs(context.Background(), &net.Dialer{Timeout: time.Second}, ips, port); err == nil {
+		conn.Close()
+		t.Fatal("Expected an error when both families refuse")
+	}
+}
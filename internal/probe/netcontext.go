@@ -0,0 +1,355 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interface types reported in the network context
+const (
+	InterfaceTypeWiFi     = "wifi"
+	InterfaceTypeEthernet = "ethernet"
+	InterfaceTypeCellular = "cellular"
+	InterfaceTypeUnknown  = "unknown"
+)
+
+// routeProbeAddrs are used to find the egress address of each family. Dialing
+// UDP only consults the routing table; no packet is sent.
+var routeProbeAddrs = map[string]string{
+	"udp4": "8.8.8.8:53",
+	"udp6": "[2001:4860:4860::8888]:53",
+}
+
+// defaultPublicIPTTL bounds how long a public IP lookup is reused while the
+// local interface, address and gateway stay the same
+const defaultPublicIPTTL = 10 * time.Minute
+
+// routeInfo summarizes the default routes of one address family
+type routeInfo struct {
+	// iface and gateway are the preferred default route over a physical
+	// interface
+	iface   string
+	gateway string
+
+	// tunnel is set when a tunnel interface carries a default route
+	tunnel string
+}
+
+// NetworkInfo describes the network the probe is measuring from
+type NetworkInfo struct {
+	// InterfaceName and InterfaceType describe the egress interface; when a
+	// VPN is up they describe the physical interface beneath it
+	InterfaceName string
+	InterfaceType string
+
+	// LocalIP is the source address used towards the internet
+	LocalIP string
+
+	// Gateway is the next hop of the default route, if known
+	Gateway string
+
+	// VPN reports whether a tunnel interface carries the default route
+	VPN          bool
+	VPNInterface string
+
+	// PublicIP, ASN and ASOrg come from the public IP echo endpoint
+	PublicIP string
+	ASN      int
+	ASOrg    string
+}
+
+// publicIPInfo is a cached public IP lookup
+type publicIPInfo struct {
+	key       string
+	fetchedAt time.Time
+	ip        string
+	asn       int
+	org       string
+}
+
+// NetworkDetector detects the network context before each measurement.
+// Local details are read every time so interface, VPN and address changes
+// show up in the next event; the public IP lookup is cached until the local
+// context changes or the TTL passes.
+type NetworkDetector struct {
+	publicIPURL string
+	publicIPTTL time.Duration
+	client      *http.Client
+
+	mu     sync.Mutex
+	public *publicIPInfo
+}
+
+// NewNetworkDetector creates a detector. publicIPURL is an endpoint returning
+// the caller's address as JSON (e.g. https://ipinfo.io/json); empty disables
+// the public IP and ASN lookup.
+func NewNetworkDetector(publicIPURL string) *NetworkDetector {
+	return &NetworkDetector{
+		publicIPURL: publicIPURL,
+		publicIPTTL: defaultPublicIPTTL,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Detect returns the current network context for an address family mode.
+// Details that cannot be determined are left empty; the interface type falls
+// back to "unknown".
+func (d *NetworkDetector) Detect(family string) (*NetworkInfo, error) {
+	info := &NetworkInfo{InterfaceType: InterfaceTypeUnknown}
+
+	network := "udp4"
+	if family == AddressFamilyIPv6 {
+		network = "udp6"
+	}
+	localIP, err := egressAddress(network)
+	if err != nil && family != AddressFamilyIPv4 && family != AddressFamilyIPv6 {
+		// Default and happy-eyeballs modes can use either family
+		network = "udp6"
+		localIP, err = egressAddress(network)
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to determine egress address: %w", err)
+	}
+	info.LocalIP = localIP.String()
+
+	if iface, err := interfaceForAddr(localIP); err == nil {
+		info.InterfaceName = iface.Name
+		if isTunnelInterface(iface) {
+			info.VPN = true
+			info.VPNInterface = iface.Name
+		}
+	}
+
+	if route := defaultRoute(network == "udp6"); route != nil {
+		info.Gateway = route.gateway
+		if route.tunnel != "" && !info.VPN {
+			info.VPN = true
+			info.VPNInterface = route.tunnel
+		}
+		// With a VPN up, report the physical interface the tunnel runs over
+		if info.VPN && route.iface != "" {
+			info.InterfaceName = route.iface
+		}
+	}
+
+	if info.InterfaceName != "" {
+		if iface, err := net.InterfaceByName(info.InterfaceName); err == nil {
+			info.InterfaceType = detectInterfaceType(iface)
+		}
+	}
+
+	if d.publicIPURL != "" {
+		key := strings.Join([]string{network, info.InterfaceName, info.LocalIP, info.Gateway}, "|")
+		if public, err := d.lookupPublicIP(key, network); err == nil {
+			info.PublicIP = public.ip
+			info.ASN = public.asn
+			info.ASOrg = public.org
+		}
+	}
+
+	return info, nil
+}
+
+// egressAddress returns the local address the kernel would use to reach the
+// internet over the given UDP network
+func egressAddress(network string) (net.IP, error) {
+	conn, err := net.Dial(network, routeProbeAddrs[network])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP.IsUnspecified() {
+		return nil, fmt.Errorf("no route")
+	}
+	return addr.IP, nil
+}
+
+// interfaceForAddr returns the interface holding a local address
+func interfaceForAddr(ip net.IP) (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has address %s", ip)
+}
+
+// InterfaceTypeOf classifies the named interface, e.g. the source interface
+// a measurement was bound to
+func InterfaceTypeOf(name string) string {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return interfaceTypeFromName(name)
+	}
+	return detectInterfaceType(iface)
+}
+
+// tunnelNamePrefixes are common names of VPN and tunnel interfaces
+var tunnelNamePrefixes = []string{"tun", "tap", "wg", "utun", "ppp", "ipsec", "gpd", "zt", "tailscale", "nordlynx", "proton"}
+
+// isTunnelName reports whether an interface name looks like a tunnel
+func isTunnelName(name string) bool {
+	for _, prefix := range tunnelNamePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceTypeFromName guesses the interface type from its name
+func interfaceTypeFromName(name string) string {
+	switch {
+	case strings.HasPrefix(name, "wl"), strings.HasPrefix(name, "wifi"), strings.HasPrefix(name, "ath"):
+		return InterfaceTypeWiFi
+	case strings.HasPrefix(name, "wwan"), strings.HasPrefix(name, "rmnet"), strings.HasPrefix(name, "ccmni"),
+		strings.HasPrefix(name, "pdp_ip"):
+		return InterfaceTypeCellular
+	case strings.HasPrefix(name, "eth"), strings.HasPrefix(name, "en"), strings.HasPrefix(name, "em"):
+		return InterfaceTypeEthernet
+	}
+	return InterfaceTypeUnknown
+}
+
+// lookupPublicIP queries the public IP echo endpoint, reusing the previous
+// answer while the local context key is unchanged and the TTL has not passed
+func (d *NetworkDetector) lookupPublicIP(key, network string) (*publicIPInfo, error) {
+	d.mu.Lock()
+	cached := d.public
+	d.mu.Unlock()
+	if cached != nil && cached.key == key && time.Since(cached.fetchedAt) < d.publicIPTTL {
+		return cached, nil
+	}
+
+	// Query over the same family as the measurement
+	dialNet := "tcp4"
+	if network == "udp6" {
+		dialNet = "tcp6"
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, dialNet, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	client := *d.client
+	client.Transport = transport
+
+	req, err := http.NewRequest(http.MethodGet, d.publicIPURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("public IP endpoint returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	public, err := parsePublicIPResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	public.key = key
+	public.fetchedAt = time.Now()
+
+	d.mu.Lock()
+	d.public = public
+	d.mu.Unlock()
+	return public, nil
+}
+
+// parsePublicIPResponse extracts the address and ASN from a public IP echo
+// response. It understands the common JSON shapes: {"ip": ..., "org":
+// "AS15169 Google LLC"} (ipinfo), {"ip": ..., "asn": "AS15169", "org": ...}
+// (ipapi), {"query": ..., "as": "AS15169 Google LLC"} (ip-api), and a
+// plain-text body holding just the address.
+func parsePublicIPResponse(body []byte) (*publicIPInfo, error) {
+	text := strings.TrimSpace(string(body))
+	if ip := net.ParseIP(text); ip != nil {
+		return &publicIPInfo{ip: ip.String()}, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("unrecognized public IP response: %w", err)
+	}
+
+	str := func(keys ...string) string {
+		for _, key := range keys {
+			if value, ok := fields[key].(string); ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	info := &publicIPInfo{ip: str("ip", "query", "ip_addr", "address")}
+	if net.ParseIP(info.ip) == nil {
+		return nil, fmt.Errorf("public IP response has no address")
+	}
+
+	// The ASN may be a number, "AS123", or the prefix of an org string
+	switch asn := fields["asn"].(type) {
+	case float64:
+		info.asn = int(asn)
+	case string:
+		info.asn, _ = parseASN(asn)
+	}
+	org := str("as_org", "asn_org", "org", "as", "isp")
+	if asn, rest := parseASN(org); asn > 0 {
+		if info.asn == 0 {
+			info.asn = asn
+		}
+		org = rest
+	}
+	info.org = org
+
+	return info, nil
+}
+
+// parseASN parses "AS15169 Google LLC" into 15169 and "Google LLC"
+func parseASN(value string) (int, string) {
+	value = strings.TrimSpace(value)
+	if len(value) < 3 || !strings.EqualFold(value[:2], "AS") {
+		return 0, value
+	}
+	digits := value[2:]
+	rest := ""
+	if i := strings.IndexByte(digits, ' '); i >= 0 {
+		digits, rest = digits[:i], strings.TrimSpace(digits[i+1:])
+	}
+	asn, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, value
+	}
+	return asn, rest
+}
@@ -0,0 +1,271 @@
+//go:build linux
+
+package probe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysClassNet is where the kernel describes network interfaces
+const sysClassNet = "/sys/class/net"
+
+// ARP hardware types from /sys/class/net/<iface>/type
+const (
+	arphrdEther = 1
+	arphrdPPP   = 512
+	arphrdNone  = 65534
+)
+
+// readSysfs returns the trimmed contents of an interface attribute
+func readSysfs(name, attr string) string {
+	data, err := os.ReadFile(filepath.Join(sysClassNet, name, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// sysfsExists reports whether an interface attribute exists
+func sysfsExists(name, attr string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNet, name, attr))
+	return err == nil
+}
+
+// devType returns the DEVTYPE reported in the interface's uevent file
+func devType(name string) string {
+	for _, line := range strings.Split(readSysfs(name, "uevent"), "\n") {
+		if value, ok := strings.CutPrefix(line, "DEVTYPE="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// detectInterfaceType classifies an interface from sysfs, falling back to
+// its name
+func detectInterfaceType(iface *net.Interface) string {
+	switch devType(iface.Name) {
+	case "wlan":
+		return InterfaceTypeWiFi
+	case "wwan":
+		return InterfaceTypeCellular
+	}
+	if sysfsExists(iface.Name, "wireless") || sysfsExists(iface.Name, "phy80211") {
+		return InterfaceTypeWiFi
+	}
+
+	// Cellular modems often present as raw-IP or ethernet devices, so trust
+	// the driver's naming before the hardware type
+	if nameType := interfaceTypeFromName(iface.Name); nameType == InterfaceTypeCellular {
+		return nameType
+	}
+	if hwType, err := strconv.Atoi(readSysfs(iface.Name, "type")); err == nil && hwType == arphrdEther &&
+		!isTunnelInterface(iface) {
+		return InterfaceTypeEthernet
+	}
+	return interfaceTypeFromName(iface.Name)
+}
+
+// isTunnelInterface reports whether an interface is a VPN or tunnel device
+func isTunnelInterface(iface *net.Interface) bool {
+	if sysfsExists(iface.Name, "tun_flags") {
+		return true
+	}
+	if devType(iface.Name) == "wireguard" {
+		return true
+	}
+	if hwType, err := strconv.Atoi(readSysfs(iface.Name, "type")); err == nil {
+		switch hwType {
+		case arphrdNone, arphrdPPP:
+			return true
+		}
+	}
+	return isTunnelName(iface.Name)
+}
+
+// isTunnelNamed reports whether the named interface is a tunnel
+func isTunnelNamed(name string) bool {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return isTunnelName(name)
+	}
+	return isTunnelInterface(iface)
+}
+
+// defaultRoute reads the main routing table from procfs. OpenVPN-style split
+// routes (0.0.0.0/1 and 128.0.0.0/1) count as a tunnel default route.
+func defaultRoute(ipv6 bool) *routeInfo {
+	var routes []kernelRoute
+	if ipv6 {
+		routes = readIPv6Routes("/proc/net/ipv6_route")
+	} else {
+		routes = readIPv4Routes("/proc/net/route")
+	}
+	return summarizeRoutes(routes, isTunnelNamed)
+}
+
+// kernelRoute is a default or split-default route from procfs
+type kernelRoute struct {
+	iface   string
+	gateway net.IP
+	prefix  int
+	metric  uint32
+}
+
+// summarizeRoutes picks the preferred physical default route and notes any
+// tunnel carrying a default route
+func summarizeRoutes(routes []kernelRoute, isTunnel func(string) bool) *routeInfo {
+	var info routeInfo
+	var best, bestTunnel *kernelRoute
+	for i := range routes {
+		route := &routes[i]
+		if isTunnel(route.iface) {
+			if bestTunnel == nil || route.metric < bestTunnel.metric {
+				bestTunnel = route
+			}
+			continue
+		}
+		if route.prefix == 0 && (best == nil || route.metric < best.metric) {
+			best = route
+		}
+	}
+
+	switch {
+	case best != nil:
+		info.iface = best.iface
+		if best.gateway != nil {
+			info.gateway = best.gateway.String()
+		}
+	case bestTunnel != nil && bestTunnel.gateway != nil:
+		info.gateway = bestTunnel.gateway.String()
+	}
+	if bestTunnel != nil {
+		info.tunnel = bestTunnel.iface
+	}
+
+	if best == nil && bestTunnel == nil {
+		return nil
+	}
+	return &info
+}
+
+// readIPv4Routes parses /proc/net/route, whose addresses are hex in host
+// byte order
+func readIPv4Routes(path string) []kernelRoute {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var routes []kernelRoute
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		dest, err1 := strconv.ParseUint(fields[1], 16, 32)
+		gw, err2 := strconv.ParseUint(fields[2], 16, 32)
+		flags, err3 := strconv.ParseUint(fields[3], 16, 32)
+		metric, err4 := strconv.ParseUint(fields[6], 10, 32)
+		mask, err5 := strconv.ParseUint(fields[7], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+			continue
+		}
+		if flags&0x1 == 0 || flags&0x200 != 0 { // RTF_UP, RTF_REJECT
+			continue
+		}
+
+		destIP, maskIP := hostOrderIPv4(uint32(dest)), hostOrderIPv4(uint32(mask))
+		prefix, _ := net.IPMask(maskIP).Size()
+		if !isDefaultSplit(destIP, prefix) {
+			continue
+		}
+
+		route := kernelRoute{iface: fields[0], prefix: prefix, metric: uint32(metric)}
+		if flags&0x2 != 0 { // RTF_GATEWAY
+			route.gateway = hostOrderIPv4(uint32(gw))
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// hostOrderIPv4 converts a /proc/net/route address to an IP
+func hostOrderIPv4(value uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.NativeEndian.PutUint32(ip, value)
+	return ip
+}
+
+// isDefaultSplit reports whether dest/prefix is 0/0 or one half of it
+func isDefaultSplit(dest net.IP, prefix int) bool {
+	switch prefix {
+	case 0:
+		return true
+	case 1:
+		// 0.0.0.0/1, 128.0.0.0/1, ::/1 and 8000::/1
+		rest := dest.To16()
+		if v4 := dest.To4(); v4 != nil {
+			rest = v4
+		}
+		for i, b := range rest {
+			if (i == 0 && b&0x7f != 0) || (i > 0 && b != 0) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// readIPv6Routes parses /proc/net/ipv6_route
+func readIPv6Routes(path string) []kernelRoute {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var routes []kernelRoute
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// dest dest_len src src_len next_hop metric refcnt use flags iface
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		dest, err1 := hex.DecodeString(fields[0])
+		prefix, err2 := strconv.ParseUint(fields[1], 16, 8)
+		nextHop, err3 := hex.DecodeString(fields[4])
+		metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+		flags, err5 := strconv.ParseUint(fields[8], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil ||
+			len(dest) != net.IPv6len || len(nextHop) != net.IPv6len {
+			continue
+		}
+		if flags&0x1 == 0 || flags&0x200 != 0 || fields[9] == "lo" {
+			continue
+		}
+		if !isDefaultSplit(net.IP(dest), int(prefix)) {
+			continue
+		}
+
+		route := kernelRoute{iface: fields[9], prefix: int(prefix), metric: uint32(metric)}
+		if gw := net.IP(nextHop); !gw.IsUnspecified() {
+			route.gateway = gw
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
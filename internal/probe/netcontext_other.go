@@ -0,0 +1,21 @@
+//go:build !linux
+
+package probe
+
+import "net"
+
+// detectInterfaceType classifies an interface by its name
+func detectInterfaceType(iface *net.Interface) string {
+	return interfaceTypeFromName(iface.Name)
+}
+
+// isTunnelInterface reports whether an interface looks like a VPN or tunnel
+// device. Point-to-point links are treated as tunnels.
+func isTunnelInterface(iface *net.Interface) bool {
+	return iface.Flags&net.FlagPointToPoint != 0 || isTunnelName(iface.Name)
+}
+
+// defaultRoute is not available without platform routing APIs
+func defaultRoute(ipv6 bool) *routeInfo {
+	return nil
+}
@@ -0,0 +1,92 @@
+package probe
+
+import "testing"
+
+func TestParsePublicIPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantIP  string
+		wantASN int
+		wantOrg string
+		wantErr bool
+	}{
+		{name: "plain ipv4", body: "203.0.113.7\n", wantIP: "203.0.113.7"},
+		{name: "plain ipv6", body: "2001:db8::7", wantIP: "2001:db8::7"},
+		{
+			name:    "ipinfo style org",
+			body:    `{"ip":"203.0.113.7","org":"AS15169 Google LLC"}`,
+			wantIP:  "203.0.113.7",
+			wantASN: 15169,
+			wantOrg: "Google LLC",
+		},
+		{
+			name:    "numeric asn",
+			body:    `{"ip":"203.0.113.7","asn":64500,"asn_org":"Example Net"}`,
+			wantIP:  "203.0.113.7",
+			wantASN: 64500,
+			wantOrg: "Example Net",
+		},
+		{
+			name:    "string asn wins over org prefix",
+			body:    `{"query":"203.0.113.7","asn":"AS64500","as":"AS64501 Example Net"}`,
+			wantIP:  "203.0.113.7",
+			wantASN: 64500,
+			wantOrg: "Example Net",
+		},
+		{
+			name:    "org without asn",
+			body:    `{"ip_addr":"203.0.113.7","isp":"Example ISP"}`,
+			wantIP:  "203.0.113.7",
+			wantOrg: "Example ISP",
+		},
+		{name: "json without address", body: `{"org":"AS1 Example"}`, wantErr: true},
+		{name: "json with invalid address", body: `{"ip":"not-an-ip"}`, wantErr: true},
+		{name: "unrecognized text", body: "<html>blocked</html>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parsePublicIPResponse([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePublicIPResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if info.ip != tt.wantIP || info.asn != tt.wantASN || info.org != tt.wantOrg {
+				t.Errorf("parsePublicIPResponse() = %s, AS%d %q, expected %s, AS%d %q",
+					info.ip, info.asn, info.org, tt.wantIP, tt.wantASN, tt.wantOrg)
+			}
+		})
+	}
+}
+
+func TestInterfaceTypeFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "wlan0", want: InterfaceTypeWiFi},
+		{name: "wlp3s0", want: InterfaceTypeWiFi},
+		{name: "ath0", want: InterfaceTypeWiFi},
+		{name: "wwan0", want: InterfaceTypeCellular},
+		{name: "rmnet_data0", want: InterfaceTypeCellular},
+		{name: "pdp_ip0", want: InterfaceTypeCellular},
+		{name: "eth0", want: InterfaceTypeEthernet},
+		{name: "enp0s31f6", want: InterfaceTypeEthernet},
+		{name: "en0", want: InterfaceTypeEthernet},
+		{name: "em1", want: InterfaceTypeEthernet},
+		{name: "lo", want: InterfaceTypeUnknown},
+		{name: "tun0", want: InterfaceTypeUnknown},
+		{name: "", want: InterfaceTypeUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interfaceTypeFromName(tt.name); got != tt.want {
+				t.Errorf("interfaceTypeFromName(%q) = %s, expected %s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,658 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// Path trace protocols
+const (
+	PathTraceTCP = "tcp"
+	PathTraceUDP = "udp"
+)
+
+// Path trace methods; see TracePath
+const (
+	PathTraceMethodTTL     = "ttl"
+	PathTraceMethodConnect = "connect"
+)
+
+// Defaults for path traces
+const (
+	defaultTraceMaxHops      = 30
+	defaultTraceProbes       = 3
+	defaultTraceTimeoutMs    = 1000
+	defaultTraceCooldownMs   = 5 * 60 * 1000
+	defaultTraceUDPPort      = 33434
+	maxTraceHops             = 64
+	maxTraceProbesPerHop     = 10
+	maxConsecutiveSilentHops = 5
+)
+
+// TCP probes are sent from their own source port each, taken from this range
+// starting at a random offset, and retried from the next port when one is
+// in use
+const (
+	traceSourcePortBase  = 50000
+	traceSourcePortRange = 10000
+	maxTraceBindAttempts = 3
+)
+
+// PathTraceConfig configures hop-by-hop path traces for a target. Traces run
+// on a schedule, when the handshake latency of a measurement exceeds a
+// threshold, and/or when a measurement fails at the DNS, TCP or TLS stage.
+type PathTraceConfig struct {
+	// Protocol is the probe packet protocol: tcp (default) or udp
+	Protocol string `json:"protocol,omitempty"`
+
+	// Port is the destination port (default: the target port for tcp,
+	// 33434 and up for udp)
+	Port int `json:"port,omitempty"`
+
+	// MaxHops bounds the trace length (default 30)
+	MaxHops int `json:"max_hops,omitempty"`
+
+	// ProbesPerHop is the number of probes sent per TTL (default 3)
+	ProbesPerHop int `json:"probes_per_hop,omitempty"`
+
+	// TimeoutMs bounds the wait for each probe reply (default 1000)
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+
+	// IntervalMs runs a trace on a schedule; 0 disables scheduled traces
+	IntervalMs int `json:"interval_ms,omitempty"`
+
+	// LatencyThresholdMs triggers a trace when TCP connect plus TLS
+	// handshake time exceeds it; 0 disables the trigger
+	LatencyThresholdMs float64 `json:"latency_threshold_ms,omitempty"`
+
+	// OnError triggers a trace when a measurement fails at the DNS, TCP or
+	// TLS stage
+	OnError bool `json:"on_error,omitempty"`
+
+	// CooldownMs is the minimum spacing between triggered traces of the
+	// same target (default 5 minutes)
+	CooldownMs int `json:"cooldown_ms,omitempty"`
+}
+
+// PathHopResult is a single hop of a path trace
+type PathHopResult struct {
+	// TTL is the hop distance; 0 for connect traces, where it is unknown
+	TTL   int
+	Addr  string
+	RTTMs []float64
+	Sent  int
+	Lost  int
+}
+
+// PathTraceResult holds the outcome of a path trace
+type PathTraceResult struct {
+	Protocol      string
+	Port          int
+	Method        string
+	DestinationIP string
+	Reached       bool
+	Hops          []PathHopResult
+	Duration      time.Duration
+}
+
+// Validate checks the path trace configuration
+func (c *PathTraceConfig) Validate() error {
+	switch c.Protocol {
+	case "", PathTraceTCP, PathTraceUDP:
+	default:
+		return fmt.Errorf("unsupported path_trace protocol %q", c.Protocol)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("path_trace port must be between 0 and 65535")
+	}
+	if c.MaxHops < 0 || c.MaxHops > maxTraceHops {
+		return fmt.Errorf("path_trace max_hops must be between 0 and %d", maxTraceHops)
+	}
+	if c.ProbesPerHop < 0 || c.ProbesPerHop > maxTraceProbesPerHop {
+		return fmt.Errorf("path_trace probes_per_hop must be between 0 and %d", maxTraceProbesPerHop)
+	}
+	if c.TimeoutMs < 0 || c.IntervalMs < 0 || c.CooldownMs < 0 || c.LatencyThresholdMs < 0 {
+		return fmt.Errorf("path_trace timeout_ms, interval_ms, cooldown_ms and latency_threshold_ms must be non-negative")
+	}
+	if c.IntervalMs == 0 && c.LatencyThresholdMs == 0 && !c.OnError {
+		return fmt.Errorf("path_trace requires interval_ms, latency_threshold_ms or on_error")
+	}
+	return nil
+}
+
+// protocol returns the probe packet protocol
+func (c *PathTraceConfig) protocol() string {
+	if c.Protocol != "" {
+		return c.Protocol
+	}
+	return PathTraceTCP
+}
+
+// maxHops returns the trace length limit
+func (c *PathTraceConfig) maxHops() int {
+	if c.MaxHops > 0 {
+		return c.MaxHops
+	}
+	return defaultTraceMaxHops
+}
+
+// probesPerHop returns the number of probes per TTL
+func (c *PathTraceConfig) probesPerHop() int {
+	if c.ProbesPerHop > 0 {
+		return c.ProbesPerHop
+	}
+	return defaultTraceProbes
+}
+
+// timeout returns the per-probe reply timeout
+func (c *PathTraceConfig) timeout() time.Duration {
+	if c.TimeoutMs > 0 {
+		return time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	return defaultTraceTimeoutMs * time.Millisecond
+}
+
+// Cooldown returns the minimum spacing between triggered traces
+func (c *PathTraceConfig) Cooldown() time.Duration {
+	if c.CooldownMs > 0 {
+		return time.Duration(c.CooldownMs) * time.Millisecond
+	}
+	return defaultTraceCooldownMs * time.Millisecond
+}
+
+// Interval returns the schedule interval, zero when traces are not scheduled
+func (c *PathTraceConfig) Interval() time.Duration {
+	return time.Duration(c.IntervalMs) * time.Millisecond
+}
+
+// traceDestination returns the host and port a target's trace is aimed at
+func traceDestination(cfg *TargetConfig) (string, int, error) {
+	if cfg.GetCheckType() != models.CheckTypeHTTP {
+		host, port, err := SplitSocketTarget(cfg.URL)
+		if err != nil {
+			return "", 0, err
+		}
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port %q", port)
+		}
+		return host, portNum, nil
+	}
+
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil {
+		return "", 0, err
+	}
+	if parsed.Hostname() == "" {
+		return "", 0, fmt.Errorf("target %q has no host", cfg.URL)
+	}
+	if parsed.Port() != "" {
+		portNum, err := strconv.Atoi(parsed.Port())
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port %q", parsed.Port())
+		}
+		return parsed.Hostname(), portNum, nil
+	}
+	if parsed.Scheme == "http" {
+		return parsed.Hostname(), 80, nil
+	}
+	return parsed.Hostname(), 443, nil
+}
+
+// TracePath runs a path trace towards a target. It sends TTL-limited TCP SYN
+// or UDP probes and collects the ICMP time-exceeded replies of each hop,
+// stopping when the destination answers, after max_hops, or after several
+// consecutive silent hops. Reading ICMP needs raw socket privileges (root or
+// CAP_NET_RAW); without them the trace falls back to timed TCP connects to
+// the destination, which report a single hop of unknown distance. Cancelling
+// ctx abandons the trace between probes.
+func TracePath(ctx context.Context, cfg *TargetConfig, family string) (*PathTraceResult, error) {
+	traceCfg := cfg.PathTrace
+	if traceCfg == nil {
+		traceCfg = &PathTraceConfig{}
+	}
+	if !ValidAddressFamily(family) {
+		return nil, fmt.Errorf("unsupported address family %q", family)
+	}
+
+	host, targetPort, err := traceDestination(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := resolveSocketTarget(ctx, &Measurement{}, host, family, cfg.Timeouts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	start := time.Now()
+	result := &PathTraceResult{
+		Protocol:      traceCfg.protocol(),
+		Port:          traceCfg.Port,
+		Method:        PathTraceMethodTTL,
+		DestinationIP: ip.String(),
+	}
+	if result.Port == 0 {
+		result.Port = targetPort
+		if result.Protocol == PathTraceUDP {
+			result.Port = defaultTraceUDPPort
+		}
+	}
+
+	listener, err := newICMPListener(ip)
+	if err == nil && result.Protocol == PathTraceTCP && !socketTTLSupported {
+		listener.close()
+		err = errors.ErrUnsupported
+	}
+	if err != nil {
+		// No raw socket access, so no hop-level detail
+		result.Protocol = PathTraceTCP
+		result.Method = PathTraceMethodConnect
+		if traceCfg.Port == 0 || traceCfg.protocol() == PathTraceUDP {
+			result.Port = targetPort
+		}
+		connectTrace(result, ip, traceCfg)
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+	defer listener.close()
+
+	ports := newTracePorts()
+	silent := 0
+	for ttl := 1; ttl <= traceCfg.maxHops(); ttl++ {
+		hop := PathHopResult{TTL: ttl}
+		reached := false
+
+		for i := 0; i < traceCfg.probesPerHop(); i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var reply *icmpReply
+			var rtt time.Duration
+			var done bool
+			if result.Protocol == PathTraceUDP {
+				// Vary the destination port per probe, as traceroute does,
+				// so replies can be matched to probes
+				port := result.Port + (ttl-1)*traceCfg.probesPerHop() + i
+				reply, rtt, done = sendUDPProbe(listener, ip, port%65536, ttl, traceCfg.timeout())
+			} else {
+				reply, rtt, done = sendTCPProbe(listener, ip, result.Port, ttl, traceCfg.timeout(), ports)
+			}
+
+			hop.Sent++
+			switch {
+			case done:
+				// The destination completed or refused the TCP handshake
+				hop.Addr = ip.String()
+				hop.RTTMs = append(hop.RTTMs, float64(rtt.Microseconds())/1000.0)
+				reached = true
+			case reply != nil:
+				hop.Addr = reply.from.String()
+				hop.RTTMs = append(hop.RTTMs, float64(rtt.Microseconds())/1000.0)
+				if reply.from.Equal(ip) {
+					reached = true
+				}
+			default:
+				hop.Lost++
+			}
+		}
+
+		result.Hops = append(result.Hops, hop)
+		if reached {
+			result.Reached = true
+			break
+		}
+		if hop.Addr == "" {
+			silent++
+			if silent >= maxConsecutiveSilentHops {
+				break
+			}
+		} else {
+			silent = 0
+		}
+	}
+
+	// Drop the trailing run of silent hops that ended the trace
+	for len(result.Hops) > 0 && result.Hops[len(result.Hops)-1].Addr == "" && !result.Reached {
+		result.Hops = result.Hops[:len(result.Hops)-1]
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// connectTrace times TCP connects to the destination
+func connectTrace(result *PathTraceResult, ip net.IP, cfg *PathTraceConfig) {
+	hop := PathHopResult{}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(result.Port))
+	for i := 0; i < cfg.probesPerHop(); i++ {
+		hop.Sent++
+		connStart := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, cfg.timeout())
+		rtt := time.Since(connStart)
+		if err == nil {
+			conn.Close()
+		}
+		if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+			hop.Addr = ip.String()
+			hop.RTTMs = append(hop.RTTMs, float64(rtt.Microseconds())/1000.0)
+			result.Reached = true
+			continue
+		}
+		hop.Lost++
+	}
+	result.Hops = []PathHopResult{hop}
+}
+
+// icmpReply is an ICMP error matched to an outstanding probe
+type icmpReply struct {
+	from      net.IP
+	at        time.Time
+	protocol  int
+	dst       net.IP
+	srcPort   int
+	dstPort   int
+	unreached bool
+}
+
+// icmpListener receives ICMP errors quoting the trace's probes
+type icmpListener struct {
+	conn    *icmp.PacketConn
+	proto   int
+	replies chan *icmpReply
+}
+
+// newICMPListener opens a raw ICMP socket for the destination's family
+func newICMPListener(dst net.IP) (*icmpListener, error) {
+	network, address, proto := "ip4:icmp", "0.0.0.0", 1
+	if dst.To4() == nil {
+		network, address, proto = "ip6:ipv6-icmp", "::", 58
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &icmpListener{conn: conn, proto: proto, replies: make(chan *icmpReply, 64)}
+	go l.read()
+	return l, nil
+}
+
+// read parses incoming ICMP errors until the socket is closed
+func (l *icmpListener) read() {
+	defer close(l.replies)
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		at := time.Now()
+
+		msg, err := icmp.ParseMessage(l.proto, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		var quoted []byte
+		unreached := false
+		switch body := msg.Body.(type) {
+		case *icmp.TimeExceeded:
+			if msg.Type != ipv4.ICMPTypeTimeExceeded && msg.Type != ipv6.ICMPTypeTimeExceeded {
+				continue
+			}
+			quoted = body.Data
+		case *icmp.DstUnreach:
+			quoted = body.Data
+			unreached = true
+		default:
+			continue
+		}
+
+		reply := parseQuotedProbe(quoted)
+		if reply == nil {
+			continue
+		}
+		reply.at = at
+		reply.unreached = unreached
+		if ipAddr, ok := peer.(*net.IPAddr); ok {
+			reply.from = ipAddr.IP
+		}
+
+		select {
+		case l.replies <- reply:
+		default:
+		}
+	}
+}
+
+// parseQuotedProbe extracts the ports and destination of the probe quoted in
+// an ICMP error: the original IP header followed by the first bytes of the
+// TCP or UDP header, whose ports are at the same offsets for both protocols
+func parseQuotedProbe(data []byte) *icmpReply {
+	if len(data) < 1 {
+		return nil
+	}
+
+	var proto, headerLen int
+	var dst net.IP
+	switch data[0] >> 4 {
+	case 4:
+		headerLen = int(data[0]&0x0f) * 4
+		if headerLen < 20 || len(data) < headerLen+4 {
+			return nil
+		}
+		proto = int(data[9])
+		dst = net.IP(data[16:20])
+	case 6:
+		headerLen = 40
+		if len(data) < headerLen+4 {
+			return nil
+		}
+		proto = int(data[6])
+		dst = net.IP(data[24:40])
+	default:
+		return nil
+	}
+
+	transport := data[headerLen:]
+	return &icmpReply{
+		protocol: proto,
+		dst:      append(net.IP(nil), dst...),
+		srcPort:  int(transport[0])<<8 | int(transport[1]),
+		dstPort:  int(transport[2])<<8 | int(transport[3]),
+	}
+}
+
+// wait returns the first reply quoting a probe from srcPort to dst:port sent
+// with the given protocol, or nil when the deadline passes
+func (l *icmpListener) wait(protocol int, srcPort int, dst net.IP, port int, deadline time.Time, cancel <-chan struct{}) *icmpReply {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case reply, ok := <-l.replies:
+			if !ok {
+				return nil
+			}
+			if reply.protocol == protocol && reply.srcPort == srcPort && reply.dst.Equal(dst) && reply.dstPort == port {
+				return reply
+			}
+		case <-timer.C:
+			return nil
+		case <-cancel:
+			return nil
+		}
+	}
+}
+
+// drain discards replies left over from earlier probes
+func (l *icmpListener) drain() {
+	for {
+		select {
+		case <-l.replies:
+		default:
+			return
+		}
+	}
+}
+
+func (l *icmpListener) close() {
+	l.conn.Close()
+}
+
+// sendUDPProbe sends one TTL-limited UDP datagram and waits for the ICMP
+// reply. The destination answers with port unreachable.
+func sendUDPProbe(l *icmpListener, dst net.IP, port, ttl int, timeout time.Duration) (*icmpReply, time.Duration, bool) {
+	network := "udp4"
+	if dst.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return nil, 0, false
+	}
+	defer conn.Close()
+
+	if network == "udp4" {
+		err = ipv4.NewPacketConn(conn).SetTTL(ttl)
+	} else {
+		err = ipv6.NewPacketConn(conn).SetHopLimit(ttl)
+	}
+	if err != nil {
+		return nil, 0, false
+	}
+
+	l.drain()
+	sent := time.Now()
+	if _, err := conn.WriteTo(make([]byte, 32), &net.UDPAddr{IP: dst, Port: port}); err != nil {
+		return nil, 0, false
+	}
+
+	srcPort := conn.LocalAddr().(*net.UDPAddr).Port
+	reply := l.wait(syscall.IPPROTO_UDP, srcPort, dst, port, sent.Add(timeout), nil)
+	if reply == nil {
+		return nil, 0, false
+	}
+	return reply, reply.at.Sub(sent), false
+}
+
+// tracePorts hands out the source ports of a trace's TCP probes
+type tracePorts struct {
+	next int
+}
+
+// newTracePorts starts at a random port of the source port range
+func newTracePorts() *tracePorts {
+	return &tracePorts{next: traceSourcePortBase + rand.IntN(traceSourcePortRange)}
+}
+
+// take returns the next source port, wrapping around within the range
+func (p *tracePorts) take() int {
+	port := p.next
+	p.next++
+	if p.next >= traceSourcePortBase+traceSourcePortRange {
+		p.next = traceSourcePortBase
+	}
+	return port
+}
+
+// sendTCPProbe starts a TCP connect with the given TTL from a source port of
+// its own and waits for either an ICMP reply from a router or the handshake
+// outcome. ICMP replies are matched on the source port, so a late reply to
+// an earlier probe is not taken for this one. A completed or refused connect
+// means the destination was reached.
+func sendTCPProbe(l *icmpListener, dst net.IP, port, ttl int, timeout time.Duration, ports *tracePorts) (*icmpReply, time.Duration, bool) {
+	for attempt := 0; attempt < maxTraceBindAttempts; attempt++ {
+		reply, rtt, done, inUse := tcpProbe(l, dst, ports.take(), port, ttl, timeout)
+		if !inUse {
+			return reply, rtt, done
+		}
+	}
+	return nil, 0, false
+}
+
+// tcpProbe sends one TCP probe from srcPort, like sendTCPProbe. The last
+// result reports that the source port was in use and nothing was sent.
+func tcpProbe(l *icmpListener, dst net.IP, srcPort, port, ttl int, timeout time.Duration) (*icmpReply, time.Duration, bool, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{
+		LocalAddr: &net.TCPAddr{Port: srcPort},
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = setSocketTTL(fd, ttl, dst.To4() == nil)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	type dialResult struct {
+		at  time.Time
+		err error
+	}
+	dialed := make(chan dialResult, 1)
+
+	l.drain()
+	sent := time.Now()
+	go func() {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(dst.String(), strconv.Itoa(port)))
+		at := time.Now()
+		if err == nil {
+			conn.Close()
+		}
+		dialed <- dialResult{at: at, err: err}
+	}()
+
+	waitDone := make(chan struct{})
+	replyCh := make(chan *icmpReply, 1)
+	go func() {
+		replyCh <- l.wait(syscall.IPPROTO_TCP, srcPort, dst, port, sent.Add(timeout), waitDone)
+	}()
+
+	select {
+	case reply := <-replyCh:
+		cancel()
+		<-dialed
+		if reply == nil {
+			return nil, 0, false, false
+		}
+		return reply, reply.at.Sub(sent), false, false
+	case res := <-dialed:
+		close(waitDone)
+		reply := <-replyCh
+		if errors.Is(res.err, syscall.EADDRINUSE) {
+			return nil, 0, false, true
+		}
+		if res.err == nil || errors.Is(res.err, syscall.ECONNREFUSED) {
+			return nil, res.at.Sub(sent), true, false
+		}
+		// The connect failed on an ICMP error; report the router that sent it
+		if reply != nil {
+			return reply, reply.at.Sub(sent), false, false
+		}
+		return nil, 0, false, false
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package probe
+
+import "syscall"
+
+// socketTTLSupported reports whether TCP probes can set a per-socket TTL
+const socketTTLSupported = true
+
+// setSocketTTL sets the unicast TTL (IPv4) or hop limit (IPv6) of a socket
+// before it connects
+func setSocketTTL(fd uintptr, ttl int, ipv6 bool) error {
+	if ipv6 {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package probe
+
+import "errors"
+
+// socketTTLSupported reports whether TCP probes can set a per-socket TTL
+const socketTTLSupported = false
+
+// setSocketTTL is not supported on this platform; TCP path traces fall back
+// to connect traces
+func setSocketTTL(fd uintptr, ttl int, ipv6 bool) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// quotedIPv4 builds the quoted part of an ICMP error: an IPv4 header and the
+// first bytes of a TCP or UDP header
+func quotedIPv4(proto byte, dst net.IP, srcPort, dstPort int) []byte {
+	data := make([]byte, 28)
+	data[0] = 0x45
+	data[9] = proto
+	copy(data[16:20], dst.To4())
+	data[20], data[21] = byte(srcPort>>8), byte(srcPort)
+	data[22], data[23] = byte(dstPort>>8), byte(dstPort)
+	return data
+}
+
+func TestParseQuotedProbe(t *testing.T) {
+	dst := net.ParseIP("192.0.2.10")
+	ipv6 := make([]byte, 48)
+	ipv6[0] = 0x60
+	ipv6[6] = syscall.IPPROTO_TCP
+	copy(ipv6[24:40], net.ParseIP("2001:db8::1"))
+	ipv6[40], ipv6[41], ipv6[42], ipv6[43] = 0xc3, 0x50, 0x01, 0xbb
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantNil     bool
+		wantProto   int
+		wantDst     string
+		wantSrcPort int
+		wantDstPort int
+	}{
+		{
+			name:        "ipv4 tcp",
+			data:        quotedIPv4(syscall.IPPROTO_TCP, dst, 50123, 443),
+			wantProto:   syscall.IPPROTO_TCP,
+			wantDst:     "192.0.2.10",
+			wantSrcPort: 50123,
+			wantDstPort: 443,
+		},
+		{
+			name:        "ipv4 udp",
+			data:        quotedIPv4(syscall.IPPROTO_UDP, dst, 41000, 33434),
+			wantProto:   syscall.IPPROTO_UDP,
+			wantDst:     "192.0.2.10",
+			wantSrcPort: 41000,
+			wantDstPort: 33434,
+		},
+		{
+			name:        "ipv6 tcp",
+			data:        ipv6,
+			wantProto:   syscall.IPPROTO_TCP,
+			wantDst:     "2001:db8::1",
+			wantSrcPort: 50000,
+			wantDstPort: 443,
+		},
+		{name: "empty", data: nil, wantNil: true},
+		{name: "truncated ipv4", data: quotedIPv4(syscall.IPPROTO_TCP, dst, 1, 2)[:22], wantNil: true},
+		{name: "truncated ipv6", data: ipv6[:42], wantNil: true},
+		{name: "unknown version", data: []byte{0x15, 0, 0, 0}, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := parseQuotedProbe(tt.data)
+			if tt.wantNil {
+				if reply != nil {
+					t.Errorf("parseQuotedProbe() = %+v, expected nil", reply)
+				}
+				return
+			}
+			if reply == nil {
+				t.Fatal("parseQuotedProbe() = nil")
+			}
+			if reply.protocol != tt.wantProto || reply.dst.String() != tt.wantDst ||
+				reply.srcPort != tt.wantSrcPort || reply.dstPort != tt.wantDstPort {
+				t.Errorf("parseQuotedProbe() = proto %d %d -> %s:%d, expected proto %d %d -> %s:%d",
+					reply.protocol, reply.srcPort, reply.dst, reply.dstPort,
+					tt.wantProto, tt.wantSrcPort, tt.wantDst, tt.wantDstPort)
+			}
+		})
+	}
+}
+
+func TestICMPListenerWaitMatchesSourcePort(t *testing.T) {
+	dst := net.ParseIP("192.0.2.10")
+	l := &icmpListener{replies: make(chan *icmpReply, 4)}
+
+	// A late reply to an earlier probe to the same destination port
+	stale := parseQuotedProbe(quotedIPv4(syscall.IPPROTO_TCP, dst, 50001, 443))
+	stale.from = net.ParseIP("198.51.100.1")
+	current := parseQuotedProbe(quotedIPv4(syscall.IPPROTO_TCP, dst, 50002, 443))
+	current.from = net.ParseIP("198.51.100.2")
+	l.replies <- stale
+	l.replies <- current
+
+	reply := l.wait(syscall.IPPROTO_TCP, 50002, dst, 443, time.Now().Add(time.Second), nil)
+	if reply == nil || !reply.from.Equal(current.from) {
+		t.Fatalf("wait() = %+v, expected the reply from %s", reply, current.from)
+	}
+
+	if reply := l.wait(syscall.IPPROTO_TCP, 50003, dst, 443, time.Now().Add(10*time.Millisecond), nil); reply != nil {
+		t.Errorf("wait() = %+v, expected nil for a port without replies", reply)
+	}
+}
+
+func TestTracePortsDistinct(t *testing.T) {
+	ports := newTracePorts()
+	seen := make(map[int]bool)
+	for i := 0; i < traceSourcePortRange; i++ {
+		port := ports.take()
+		if port < traceSourcePortBase || port >= traceSourcePortBase+traceSourcePortRange {
+			t.Fatalf("take() = %d, outside the source port range", port)
+		}
+		if seen[port] {
+			t.Fatalf("take() returned port %d twice within one cycle", port)
+		}
+		seen[port] = true
+	}
+}
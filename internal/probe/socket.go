@@ -0,0 +1,317 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// defaultSocketReadTimeout bounds how long a banner or UDP reply is awaited
+const defaultSocketReadTimeout = 5 * time.Second
+
+// maxSocketReadBytes caps how much of a banner or UDP reply is read
+const maxSocketReadBytes = 64 * 1024
+
+// SocketCheckConfig configures TCP and UDP checks. For TCP, Send is written
+// after connecting and a banner is read when ReadBanner or Expect is set.
+// For UDP, Send (or SendHex) is the request datagram and a reply is always
+// awaited. Expect/ExpectHex must appear in the banner or reply.
+type SocketCheckConfig struct {
+	Send       string `json:"send,omitempty"`
+	SendHex    string `json:"send_hex,omitempty"`
+	Expect     string `json:"expect,omitempty"`
+	ExpectHex  string `json:"expect_hex,omitempty"`
+	ReadBanner bool   `json:"read_banner,omitempty"`
+
+	// ReadTimeoutMs bounds the wait for a banner or reply (default 5000)
+	ReadTimeoutMs int `json:"read_timeout_ms,omitempty"`
+}
+
+// ValidCheckType reports whether checkType is a supported check type
+func ValidCheckType(checkType string) bool {
+	switch checkType {
+	case "", models.CheckTypeHTTP, models.CheckTypeTCP, models.CheckTypeUDP, models.CheckTypeUDPEcho:
+		return true
+	}
+	return false
+}
+
+// Validate checks the socket configuration
+func (s *SocketCheckConfig) Validate() error {
+	if s.Send != "" && s.SendHex != "" {
+		return fmt.Errorf("send and send_hex are mutually exclusive")
+	}
+	if s.Expect != "" && s.ExpectHex != "" {
+		return fmt.Errorf("expect and expect_hex are mutually exclusive")
+	}
+	if _, err := hex.DecodeString(s.SendHex); err != nil {
+		return fmt.Errorf("invalid send_hex: %w", err)
+	}
+	if _, err := hex.DecodeString(s.ExpectHex); err != nil {
+		return fmt.Errorf("invalid expect_hex: %w", err)
+	}
+	if s.ReadTimeoutMs < 0 {
+		return fmt.Errorf("read_timeout_ms must be non-negative")
+	}
+	return nil
+}
+
+// payload returns the bytes to send
+func (s *SocketCheckConfig) payload() []byte {
+	if s.SendHex != "" {
+		data, _ := hex.DecodeString(s.SendHex)
+		return data
+	}
+	return []byte(s.Send)
+}
+
+// expected returns the bytes that must appear in the response
+func (s *SocketCheckConfig) expected() []byte {
+	if s.ExpectHex != "" {
+		data, _ := hex.DecodeString(s.ExpectHex)
+		return data
+	}
+	return []byte(s.Expect)
+}
+
+// readTimeout returns the banner/reply read timeout
+func (s *SocketCheckConfig) readTimeout() time.Duration {
+	if s.ReadTimeoutMs > 0 {
+		return time.Duration(s.ReadTimeoutMs) * time.Millisecond
+	}
+	return defaultSocketReadTimeout
+}
+
+// SplitSocketTarget extracts host and port from a socket target, which may
+// be written as "tcp://host:port", "udp://host:port" or plain "host:port"
+func SplitSocketTarget(target string) (host, port string, err error) {
+	address := target
+	if strings.Contains(target, "://") {
+		parsed, err := url.Parse(target)
+		if err != nil {
+			return "", "", err
+		}
+		address = parsed.Host
+	}
+	host, port, err = net.SplitHostPort(address)
+	if err != nil {
+		return "", "", err
+	}
+	if host == "" || port == "" {
+		return "", "", fmt.Errorf("target %q requires host and port", target)
+	}
+	return host, port, nil
+}
+
+// resolveSocketTarget resolves the target host within the DNS timeout and
+// records the DNS timing
+func resolveSocketTarget(ctx context.Context, measurement *Measurement, host, family string, timeouts *TimeoutConfig) (net.IP, error) {
+	ips, err := resolveSocketTargets(ctx, measurement, host, family, timeouts)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// resolveSocketTargets is resolveSocketTarget returning every address
+func resolveSocketTargets(ctx context.Context, measurement *Measurement, host, family string, timeouts *TimeoutConfig) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeouts.dns())
+	defer cancel()
+	dnsStart := time.Now()
+	ips, err := net.DefaultResolver.LookupIP(ctx, lookupNetwork(family), host)
+	measurement.DNSMs = float64(time.Since(dnsStart).Microseconds()) / 1000.0
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses found")
+	}
+	return ips, nil
+}
+
+// MeasureTCP performs a TCP connect check. DNS and TCP connect timings are
+// reported in the usual stages; when a banner is read, the time from connect
+// to the first banner bytes is reported as the TTFB stage.
+func MeasureTCP(ctx context.Context, target string, cfg *SocketCheckConfig, family string, egress *EgressConfig, timeouts *TimeoutConfig) (*Measurement, error) {
+	if cfg == nil {
+		cfg = &SocketCheckConfig{}
+	}
+	measurement := &Measurement{
+		Target:        target,
+		AddressFamily: family,
+		Timestamp:     time.Now(),
+	}
+
+	fail := func(stage string, err error) (*Measurement, error) {
+		return measurement.fail(stageError(stage, err))
+	}
+
+	if !ValidAddressFamily(family) {
+		return fail("parse", fmt.Errorf("unsupported address family %q", family))
+	}
+
+	host, port, err := SplitSocketTarget(target)
+	if err != nil {
+		return fail("parse", err)
+	}
+
+	ips, err := resolveSocketTargets(ctx, measurement, host, family, timeouts)
+	if err != nil {
+		return fail("DNS", err)
+	}
+
+	// As with HTTP targets, single-family modes dial the resolved address
+	// directly, happy-eyeballs mode races the resolved addresses of both
+	// families and the default mode lets the dialer choose
+	dialAddr := net.JoinHostPort(host, port)
+	if family == AddressFamilyIPv4 || family == AddressFamilyIPv6 {
+		dialAddr = net.JoinHostPort(ips[0].String(), port)
+	}
+
+	dialer, err := egress.dialer("tcp", family, timeouts.connect())
+	if err != nil {
+		return fail("TCP", err)
+	}
+	tcpStart := time.Now()
+	var conn net.Conn
+	if family == AddressFamilyHappyEyeballs {
+		conn, err = dialHappyEyeballs(ctx, dialer, ips, port)
+	} else {
+		conn, err = dialer.DialContext(ctx, dialNetwork(family), dialAddr)
+	}
+	measurement.TCPMs = float64(time.Since(tcpStart).Microseconds()) / 1000.0
+	if err != nil {
+		return fail("TCP", err)
+	}
+	defer conn.Close()
+	measurement.RemoteAddr = conn.RemoteAddr().String()
+	measurement.LocalIP = localIP(conn.LocalAddr())
+	measurement.EgressInterface = egressInterface(conn.LocalAddr())
+	defer watchConn(ctx, conn)()
+
+	expect := cfg.expected()
+	if payload := cfg.payload(); len(payload) > 0 {
+		conn.SetWriteDeadline(deadlineWithin(ctx, cfg.readTimeout()))
+		if _, err := conn.Write(payload); err != nil {
+			return fail("TCP", err)
+		}
+	}
+	if !cfg.ReadBanner && len(expect) == 0 {
+		return measurement, nil
+	}
+
+	readStart := time.Now()
+	response, err := readSocketResponse(conn, expect, deadlineWithin(ctx, cfg.readTimeout()))
+	measurement.HTTPTTFBMs = float64(time.Since(readStart).Microseconds()) / 1000.0
+	if err != nil && len(response) == 0 {
+		return fail("TCP", fmt.Errorf("failed to read banner: %w", err))
+	}
+	if len(expect) > 0 && !bytes.Contains(response, expect) {
+		return fail(models.ErrorStageAssertion, fmt.Errorf("banner does not contain %q", expect))
+	}
+
+	return measurement, nil
+}
+
+// MeasureUDP performs a UDP request/response check. DNS timing is reported
+// as usual and the request round-trip time as the TTFB stage. A missing
+// reply is reported with the "UDP" error stage.
+func MeasureUDP(ctx context.Context, target string, cfg *SocketCheckConfig, family string, egress *EgressConfig, timeouts *TimeoutConfig) (*Measurement, error) {
+	if cfg == nil {
+		cfg = &SocketCheckConfig{}
+	}
+	measurement := &Measurement{
+		Target:        target,
+		AddressFamily: family,
+		Timestamp:     time.Now(),
+	}
+
+	fail := func(stage string, err error) (*Measurement, error) {
+		return measurement.fail(stageError(stage, err))
+	}
+
+	if !ValidAddressFamily(family) {
+		return fail("parse", fmt.Errorf("unsupported address family %q", family))
+	}
+
+	host, port, err := SplitSocketTarget(target)
+	if err != nil {
+		return fail("parse", err)
+	}
+
+	ip, err := resolveSocketTarget(ctx, measurement, host, family, timeouts)
+	if err != nil {
+		return fail("DNS", err)
+	}
+
+	network := "udp"
+	switch family {
+	case AddressFamilyIPv4:
+		network = "udp4"
+	case AddressFamilyIPv6:
+		network = "udp6"
+	}
+
+	dialer, err := egress.dialer("udp", family, timeouts.connect())
+	if err != nil {
+		return fail("UDP", err)
+	}
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return fail("UDP", err)
+	}
+	defer conn.Close()
+	measurement.RemoteAddr = conn.RemoteAddr().String()
+	measurement.LocalIP = localIP(conn.LocalAddr())
+	measurement.EgressInterface = egressInterface(conn.LocalAddr())
+	defer watchConn(ctx, conn)()
+
+	rttStart := time.Now()
+	if _, err := conn.Write(cfg.payload()); err != nil {
+		return fail("UDP", err)
+	}
+
+	expect := cfg.expected()
+	conn.SetReadDeadline(deadlineWithin(ctx, cfg.readTimeout()))
+	buf := make([]byte, maxSocketReadBytes)
+	n, err := conn.Read(buf)
+	measurement.HTTPTTFBMs = float64(time.Since(rttStart).Microseconds()) / 1000.0
+	if err != nil {
+		return fail("UDP", fmt.Errorf("no reply: %w", err))
+	}
+	if len(expect) > 0 && !bytes.Contains(buf[:n], expect) {
+		return fail(models.ErrorStageAssertion, fmt.Errorf("reply does not contain %q", expect))
+	}
+
+	return measurement, nil
+}
+
+// readSocketResponse reads from conn until expect is seen, the read limit is
+// reached, or the deadline passes. Without expect, the first read is returned.
+func readSocketResponse(conn net.Conn, expect []byte, deadline time.Time) ([]byte, error) {
+	conn.SetReadDeadline(deadline)
+	var response []byte
+	buf := make([]byte, 4096)
+	for len(response) < maxSocketReadBytes {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if err != nil {
+			return response, err
+		}
+		if len(expect) == 0 || bytes.Contains(response, expect) {
+			return response, nil
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+func TestSplitSocketTarget(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantHost string
+		wantPort string
+		wantErr  bool
+	}{
+		{target: "example.com:25", wantHost: "example.com", wantPort: "25"},
+		{target: "tcp://example.com:5432", wantHost: "example.com", wantPort: "5432"},
+		{target: "udp://192.0.2.1:53", wantHost: "192.0.2.1", wantPort: "53"},
+		{target: "[2001:db8::1]:443", wantHost: "2001:db8::1", wantPort: "443"},
+		{target: "tcp://[2001:db8::1]:22", wantHost: "2001:db8::1", wantPort: "22"},
+		{target: "example.com", wantErr: true},
+		{target: "tcp://example.com", wantErr: true},
+		{target: ":80", wantErr: true},
+		{target: "example.com:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			host, port, err := SplitSocketTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitSocketTarget(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("SplitSocketTarget(%q) = %q, %q, expected %q, %q", tt.target, host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+// bannerServer accepts connections on a local listener, writes banner and
+// echoes back the first line it reads
+func bannerServer(t *testing.T, banner string) net.Listener {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte(banner))
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if line, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+					conn.Write([]byte(line))
+				}
+			}(conn)
+		}
+	}()
+	return ln
+}
+
+func TestMeasureTCP(t *testing.T) {
+	ln := bannerServer(t, "220 ready\r\n")
+	defer ln.Close()
+	target := "tcp://" + ln.Addr().String()
+
+	closed, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedTarget := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		target    string
+		cfg       *SocketCheckConfig
+		family    string
+		wantStage string
+		wantTTFB  bool
+	}{
+		{name: "connect only", target: target, family: AddressFamilyAny},
+		{name: "connect over ipv4", target: target, family: AddressFamilyIPv4},
+		{name: "happy eyeballs", target: target, family: AddressFamilyHappyEyeballs},
+		{name: "read banner", target: target, cfg: &SocketCheckConfig{ReadBanner: true}, wantTTFB: true},
+		{name: "expected banner", target: target, cfg: &SocketCheckConfig{Expect: "220"}, wantTTFB: true},
+		{name: "expected echo", target: target, cfg: &SocketCheckConfig{Send: "PING\n", Expect: "PING"}, wantTTFB: true},
+		{name: "unexpected banner", target: target, cfg: &SocketCheckConfig{Expect: "SSH-2.0", ReadTimeoutMs: 200}, wantStage: models.ErrorStageAssertion},
+		{name: "connection refused", target: closedTarget, wantStage: models.ErrorStageTCP},
+		{name: "missing port", target: "127.0.0.1", wantStage: "parse"},
+		{name: "unsupported family", target: target, family: "ipv5", wantStage: "parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			m, err := MeasureTCP(ctx, tt.target, tt.cfg, tt.family, nil, nil)
+			if tt.wantStage != "" {
+				if err == nil {
+					t.Fatal("MeasureTCP() expected an error")
+				}
+				if m.ErrorStage == nil || *m.ErrorStage != tt.wantStage {
+					t.Errorf("ErrorStage = %v, expected %s", m.ErrorStage, tt.wantStage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MeasureTCP() error = %v", err)
+			}
+			if m.RemoteAddr != ln.Addr().String() {
+				t.Errorf("RemoteAddr = %s, expected %s", m.RemoteAddr, ln.Addr())
+			}
+			if m.LocalIP != "127.0.0.1" {
+				t.Errorf("LocalIP = %s, expected 127.0.0.1", m.LocalIP)
+			}
+			if tt.wantTTFB != (m.HTTPTTFBMs > 0) {
+				t.Errorf("HTTPTTFBMs = %v, expected a banner read: %v", m.HTTPTTFBMs, tt.wantTTFB)
+			}
+		})
+	}
+}
@@ -0,0 +1,492 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// TargetConfig describes how a single target is measured by the probe.
+// A list of these is loaded from the file passed to -targets-file.
+type TargetConfig struct {
+	// URL is the endpoint being measured. TCP and UDP checks take
+	// "tcp://host:port", "udp://host:port" or plain "host:port".
+	URL string `json:"url"`
+
+	// CheckType selects the check: http (default), tcp, udp or udp-echo.
+	// It is inferred from a tcp:// or udp:// URL scheme when unset.
+	CheckType string `json:"check_type,omitempty"`
+
+	// Socket configures banner/payload handling for tcp and udp checks
+	Socket *SocketCheckConfig `json:"socket,omitempty"`
+
+	// Echo configures the packet train of udp-echo loss/jitter checks
+	Echo *EchoConfig `json:"echo,omitempty"`
+
+	// ThroughputURL is the object downloaded for throughput testing
+	// (defaults to URL + "/fixed/1mb.bin")
+	ThroughputURL string `json:"throughput_url,omitempty"`
+
+	// DisableThroughput skips the throughput phase, e.g. for API endpoints
+	DisableThroughput bool `json:"disable_throughput,omitempty"`
+
+	// Throughput configures multi-stream, upload and duration-bounded
+	// throughput tests; nil keeps the single-stream 1MB download
+	Throughput *ThroughputConfig `json:"throughput,omitempty"`
+
+	// AddressFamilies lists the address family modes to measure separately
+	AddressFamilies []string `json:"address_families,omitempty"`
+
+	// Request customizes the HTTP request issued for the TTFB stage
+	Request RequestConfig `json:"request"`
+
+	// Assertions are checked against the response; a failure is reported
+	// with the "assertion" error stage
+	Assertions *ResponseAssertions `json:"assertions,omitempty"`
+
+	// Transaction replaces the single request with a scripted multi-step
+	// flow; URL, Request and Assertions are ignored when set
+	Transaction *TransactionConfig `json:"transaction,omitempty"`
+
+	// PathTrace runs hop-by-hop path traces towards the target on a
+	// schedule or when measurements degrade
+	PathTrace *PathTraceConfig `json:"path_trace,omitempty"`
+
+	// Timeouts bounds each measurement stage and the whole measurement;
+	// nil keeps the defaults
+	Timeouts *TimeoutConfig `json:"timeouts,omitempty"`
+
+	// EgressConfig routes the measurement through a proxy or binds it to a
+	// source interface or address
+	EgressConfig
+}
+
+// RequestConfig customizes the HTTP request sent to a target
+type RequestConfig struct {
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Auth    *AuthConfig       `json:"auth,omitempty"`
+}
+
+// AuthConfig adds an authentication header whose value is read from an
+// environment variable or a secret file, so credentials never live in the
+// targets file itself
+type AuthConfig struct {
+	// Header is the header name (defaults to Authorization)
+	Header string `json:"header,omitempty"`
+
+	// Prefix is prepended to the secret value (e.g. "Bearer ")
+	Prefix string `json:"prefix,omitempty"`
+
+	// ValueEnv names the environment variable holding the secret
+	ValueEnv string `json:"value_env,omitempty"`
+
+	// ValueFile is a path to a file holding the secret
+	ValueFile string `json:"value_file,omitempty"`
+}
+
+// ResponseAssertions are checks applied to the target response
+type ResponseAssertions struct {
+	// StatusCodes lists accepted status codes (any status if empty)
+	StatusCodes []int `json:"status_codes,omitempty"`
+
+	// BodyContains requires the body to contain this substring
+	BodyContains string `json:"body_contains,omitempty"`
+
+	// BodyRegex requires the body to match this regular expression
+	BodyRegex string `json:"body_regex,omitempty"`
+
+	// JSONPaths are checked against the body decoded as JSON
+	JSONPaths []JSONPathAssertion `json:"json_paths,omitempty"`
+
+	// MaxBodyBytes fails the check when the body is larger (0 = unlimited)
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	bodyRegex *regexp.Regexp
+}
+
+// JSONPathAssertion checks a value in a JSON response body. Path uses dot
+// notation with numeric segments for array indices (e.g. "data.items.0.id").
+type JSONPathAssertion struct {
+	Path string `json:"path"`
+
+	// Equals is compared against the decoded value when set
+	Equals interface{} `json:"equals,omitempty"`
+
+	// Exists only requires the path to be present when Equals is unset
+	Exists bool `json:"exists,omitempty"`
+}
+
+// maxAssertionBodyBytes caps how much of a body is buffered for assertions
+// when no explicit MaxBodyBytes is configured
+const maxAssertionBodyBytes = 1 << 20
+
+// LoadTargets reads a JSON array of target configurations from path
+func LoadTargets(path string) ([]TargetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	return ParseTargets(data, "targets file "+path)
+}
+
+// ParseTargets parses and validates a JSON list of targets; source names
+// where the list came from in errors
+func ParseTargets(data []byte, source string) ([]TargetConfig, error) {
+	var targets []TargetConfig
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s defines no targets", source)
+	}
+
+	for i := range targets {
+		if err := targets[i].Validate(); err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+	}
+
+	return targets, nil
+}
+
+// Validate checks the target configuration and compiles its assertions
+func (c *TargetConfig) Validate() error {
+	if err := c.EgressConfig.Validate(); err != nil {
+		return err
+	}
+
+	if c.Timeouts != nil {
+		if err := c.Timeouts.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.PathTrace != nil {
+		if c.Transaction != nil {
+			return fmt.Errorf("path_trace is not supported for transactions")
+		}
+		if err := c.PathTrace.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Transaction != nil {
+		c.DisableThroughput = true
+		for _, family := range c.AddressFamilies {
+			if !ValidAddressFamily(family) {
+				return fmt.Errorf("unsupported address family %q", family)
+			}
+		}
+		return c.Transaction.Validate()
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+
+	for _, family := range c.AddressFamilies {
+		if !ValidAddressFamily(family) {
+			return fmt.Errorf("unsupported address family %q", family)
+		}
+	}
+
+	if !ValidCheckType(c.CheckType) {
+		return fmt.Errorf("unsupported check_type %q", c.CheckType)
+	}
+	c.CheckType = c.GetCheckType()
+	if c.CheckType != models.CheckTypeHTTP {
+		if c.Proxy != "" {
+			return fmt.Errorf("proxy is only supported for http checks and transactions")
+		}
+		c.DisableThroughput = true
+		if _, _, err := SplitSocketTarget(c.URL); err != nil {
+			return fmt.Errorf("invalid %s target: %w", c.CheckType, err)
+		}
+		if c.Echo != nil {
+			if err := c.Echo.Validate(); err != nil {
+				return err
+			}
+		}
+		if c.CheckType == models.CheckTypeUDPEcho {
+			echo := c.Echo.withDefaults()
+			train := time.Duration((echo.Count-1)*echo.IntervalMs+echo.WaitMs) * time.Millisecond
+			if train >= c.Timeouts.Total() {
+				return fmt.Errorf("echo train of %v does not fit in the total timeout of %v", train, c.Timeouts.Total())
+			}
+		}
+		if c.Socket != nil {
+			return c.Socket.Validate()
+		}
+		return nil
+	}
+
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	if err := c.Request.Validate(); err != nil {
+		return err
+	}
+
+	if c.Throughput != nil {
+		if err := c.Throughput.Validate(); err != nil {
+			return err
+		}
+		if duration := time.Duration(c.Throughput.DurationMs) * time.Millisecond; duration >= c.Timeouts.Total() {
+			return fmt.Errorf("throughput duration_ms must be shorter than the total timeout of %v", c.Timeouts.Total())
+		}
+	}
+
+	if c.Assertions != nil {
+		return c.Assertions.Validate()
+	}
+
+	return nil
+}
+
+// Validate checks the request configuration
+func (rc *RequestConfig) Validate() error {
+	if rc.Method != "" && strings.ToUpper(rc.Method) != rc.Method {
+		return fmt.Errorf("method must be upper case: %s", rc.Method)
+	}
+
+	if auth := rc.Auth; auth != nil && auth.ValueEnv == "" && auth.ValueFile == "" {
+		return fmt.Errorf("auth requires value_env or value_file")
+	}
+
+	return nil
+}
+
+// Validate checks the assertions and compiles the body regex
+func (a *ResponseAssertions) Validate() error {
+	if a.BodyRegex != "" {
+		re, err := regexp.Compile(a.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body_regex: %w", err)
+		}
+		a.bodyRegex = re
+	}
+	for _, jp := range a.JSONPaths {
+		if jp.Path == "" {
+			return fmt.Errorf("json_paths entries require a path")
+		}
+	}
+	if a.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes must be non-negative")
+	}
+	return nil
+}
+
+// GetCheckType returns the check type, inferring tcp and udp from the URL
+// scheme and defaulting to http
+func (c *TargetConfig) GetCheckType() string {
+	if c.CheckType != "" {
+		return c.CheckType
+	}
+	switch {
+	case strings.HasPrefix(c.URL, "tcp://"):
+		return models.CheckTypeTCP
+	case strings.HasPrefix(c.URL, "udp://"):
+		return models.CheckTypeUDP
+	}
+	return models.CheckTypeHTTP
+}
+
+// GetThroughputURL returns the throughput URL, defaulting to the fixed 1MB
+// object served next to the target
+func (c *TargetConfig) GetThroughputURL() string {
+	if c.ThroughputURL != "" {
+		return c.ThroughputURL
+	}
+	return strings.TrimSuffix(c.URL, "/") + "/fixed/1mb.bin"
+}
+
+// GetAddressFamilies returns the configured address families, falling back
+// to the given defaults
+func (c *TargetConfig) GetAddressFamilies(defaults []string) []string {
+	if len(c.AddressFamilies) > 0 {
+		return c.AddressFamilies
+	}
+	return defaults
+}
+
+// newRequest builds the HTTP request described by the configuration
+func (c *TargetConfig) newRequest(targetURL string) (*http.Request, error) {
+	return c.Request.newRequest(targetURL, nil)
+}
+
+// newRequest builds an HTTP request, expanding {{name}} placeholders in the
+// URL, header values and body from vars
+func (rc *RequestConfig) newRequest(targetURL string, vars map[string]string) (*http.Request, error) {
+	expand := func(s string) string { return s }
+	if len(vars) > 0 {
+		pairs := make([]string, 0, len(vars)*2)
+		for name, value := range vars {
+			pairs = append(pairs, "{{"+name+"}}", value)
+		}
+		expand = strings.NewReplacer(pairs...).Replace
+	}
+
+	method := rc.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if rc.Body != "" {
+		body = strings.NewReader(expand(rc.Body))
+	}
+
+	req, err := http.NewRequest(method, expand(targetURL), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range rc.Headers {
+		req.Header.Set(name, expand(value))
+	}
+
+	if auth := rc.Auth; auth != nil {
+		value, err := auth.resolve()
+		if err != nil {
+			return nil, err
+		}
+		header := auth.Header
+		if header == "" {
+			header = "Authorization"
+		}
+		req.Header.Set(header, auth.Prefix+value)
+	}
+
+	return req, nil
+}
+
+// resolve reads the secret value from the environment or secret file
+func (a *AuthConfig) resolve() (string, error) {
+	if a.ValueEnv != "" {
+		if value := os.Getenv(a.ValueEnv); value != "" {
+			return value, nil
+		}
+		if a.ValueFile == "" {
+			return "", fmt.Errorf("auth environment variable %s is not set", a.ValueEnv)
+		}
+	}
+
+	data, err := os.ReadFile(a.ValueFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read auth secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// bodyLimit returns how many body bytes to buffer for assertion checks
+func (a *ResponseAssertions) bodyLimit() int64 {
+	if a.MaxBodyBytes > 0 {
+		return a.MaxBodyBytes
+	}
+	return maxAssertionBodyBytes
+}
+
+// needsBody reports whether any assertion inspects the response body
+func (a *ResponseAssertions) needsBody() bool {
+	return a.BodyContains != "" || a.BodyRegex != "" || len(a.JSONPaths) > 0 || a.MaxBodyBytes > 0
+}
+
+// Check validates a response status and body against the assertions.
+// truncated reports that the body was larger than the buffered limit.
+func (a *ResponseAssertions) Check(statusCode int, body []byte, truncated bool) error {
+	if len(a.StatusCodes) > 0 {
+		matched := false
+		for _, code := range a.StatusCodes {
+			if code == statusCode {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("unexpected status code %d (expected %v)", statusCode, a.StatusCodes)
+		}
+	}
+
+	if a.MaxBodyBytes > 0 && truncated {
+		return fmt.Errorf("response body exceeds %d bytes", a.MaxBodyBytes)
+	}
+
+	if a.BodyContains != "" && !strings.Contains(string(body), a.BodyContains) {
+		return fmt.Errorf("response body does not contain %q", a.BodyContains)
+	}
+
+	if a.BodyRegex != "" {
+		re := a.bodyRegex
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(a.BodyRegex); err != nil {
+				return fmt.Errorf("invalid body_regex: %w", err)
+			}
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("response body does not match %q", a.BodyRegex)
+		}
+	}
+
+	if len(a.JSONPaths) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("response body is not valid JSON: %v", err)
+		}
+		for _, jp := range a.JSONPaths {
+			if err := jp.check(doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// check evaluates a single JSON path assertion against a decoded document
+func (jp JSONPathAssertion) check(doc interface{}) error {
+	value, ok := LookupJSONPath(doc, jp.Path)
+	if !ok {
+		return fmt.Errorf("json path %s not found", jp.Path)
+	}
+	if jp.Equals != nil && fmt.Sprint(value) != fmt.Sprint(jp.Equals) {
+		return fmt.Errorf("json path %s = %v (expected %v)", jp.Path, value, jp.Equals)
+	}
+	return nil
+}
+
+// LookupJSONPath resolves a dot-notation path in a decoded JSON document
+func LookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(segment, "%d", &index); err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,173 @@
+package probe
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResponseAssertionsCheck(t *testing.T) {
+	body := []byte(`{"status":"ok","data":{"items":[{"id":7,"name":"a"}],"count":1}}`)
+
+	tests := []struct {
+		name       string
+		assertions ResponseAssertions
+		status     int
+		body       []byte
+		truncated  bool
+		wantErr    string
+	}{
+		{
+			name:       "no assertions",
+			assertions: ResponseAssertions{},
+			status:     500,
+			body:       body,
+		},
+		{
+			name:       "accepted status",
+			assertions: ResponseAssertions{StatusCodes: []int{200, 204}},
+			status:     204,
+			body:       body,
+		},
+		{
+			name:       "unexpected status",
+			assertions: ResponseAssertions{StatusCodes: []int{200}},
+			status:     503,
+			body:       body,
+			wantErr:    "unexpected status code 503",
+		},
+		{
+			name:       "body contains",
+			assertions: ResponseAssertions{BodyContains: `"status":"ok"`},
+			status:     200,
+			body:       body,
+		},
+		{
+			name:       "body missing substring",
+			assertions: ResponseAssertions{BodyContains: "error"},
+			status:     200,
+			body:       body,
+			wantErr:    "does not contain",
+		},
+		{
+			name:       "body regex",
+			assertions: ResponseAssertions{BodyRegex: `"count":\d+`},
+			status:     200,
+			body:       body,
+		},
+		{
+			name:       "body regex mismatch",
+			assertions: ResponseAssertions{BodyRegex: `"count":[2-9]`},
+			status:     200,
+			body:       body,
+			wantErr:    "does not match",
+		},
+		{
+			name:       "invalid body regex",
+			assertions: ResponseAssertions{BodyRegex: `(`},
+			status:     200,
+			body:       body,
+			wantErr:    "invalid body_regex",
+		},
+		{
+			name:       "body within limit",
+			assertions: ResponseAssertions{MaxBodyBytes: 1024},
+			status:     200,
+			body:       body,
+		},
+		{
+			name:       "body over limit",
+			assertions: ResponseAssertions{MaxBodyBytes: 16},
+			status:     200,
+			body:       body[:16],
+			truncated:  true,
+			wantErr:    "exceeds 16 bytes",
+		},
+		{
+			name: "json path equals",
+			assertions: ResponseAssertions{JSONPaths: []JSONPathAssertion{
+				{Path: "status", Equals: "ok"},
+				{Path: "data.items.0.id", Equals: 7},
+			}},
+			status: 200,
+			body:   body,
+		},
+		{
+			name:       "json path exists",
+			assertions: ResponseAssertions{JSONPaths: []JSONPathAssertion{{Path: "data.count", Exists: true}}},
+			status:     200,
+			body:       body,
+		},
+		{
+			name:       "json path not equal",
+			assertions: ResponseAssertions{JSONPaths: []JSONPathAssertion{{Path: "data.items.0.name", Equals: "b"}}},
+			status:     200,
+			body:       body,
+			wantErr:    "json path data.items.0.name = a (expected b)",
+		},
+		{
+			name:       "json path missing",
+			assertions: ResponseAssertions{JSONPaths: []JSONPathAssertion{{Path: "data.items.1.id", Exists: true}}},
+			status:     200,
+			body:       body,
+			wantErr:    "json path data.items.1.id not found",
+		},
+		{
+			name:       "body not json",
+			assertions: ResponseAssertions{JSONPaths: []JSONPathAssertion{{Path: "status", Exists: true}}},
+			status:     200,
+			body:       []byte("<html></html>"),
+			wantErr:    "not valid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.assertions.Check(tt.status, tt.body, tt.truncated)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check() error = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, expected it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookupJSONPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"a":{"b":[10,{"c":"x"}],"n":null},"top":true}`), &doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{path: "top", want: true, wantOK: true},
+		{path: "a.b.0", want: float64(10), wantOK: true},
+		{path: "a.b.1.c", want: "x", wantOK: true},
+		{path: "a.n", want: nil, wantOK: true},
+		{path: "a.missing", wantOK: false},
+		{path: "a.b.2", wantOK: false},
+		{path: "a.b.-1", wantOK: false},
+		{path: "a.b.x", wantOK: false},
+		{path: "top.deeper", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := LookupJSONPath(doc, tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("LookupJSONPath(%q) found = %v, expected %v", tt.path, ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("LookupJSONPath(%q) = %v, expected %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package probe
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throughput test directions
+const (
+	ThroughputDownload = "download"
+	ThroughputUpload   = "upload"
+	ThroughputBoth     = "both"
+)
+
+// defaultUploadBytes is the generated payload size per upload request
+const defaultUploadBytes = 1 << 20
+
+// defaultThroughputTimeout bounds size-bounded transfers
+const defaultThroughputTimeout = 30 * time.Second
+
+// ThroughputConfig configures multi-stream download and upload tests. With
+// DurationMs set, each stream repeats its transfer until the duration ends;
+// otherwise each stream transfers once, bounded by SizeBytes.
+type ThroughputConfig struct {
+	// Streams is the number of parallel connections (default 1)
+	Streams int `json:"streams,omitempty"`
+
+	// Direction is download (default), upload or both
+	Direction string `json:"direction,omitempty"`
+
+	// SizeBytes bounds each download stream and sets the upload payload
+	// size per request (default 1MB for uploads, whole object for downloads)
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+
+	// DurationMs switches to duration-bounded mode
+	DurationMs int `json:"duration_ms,omitempty"`
+
+	// RampUpMs excludes the first part of the transfer (TCP slow start)
+	// from the rate calculation
+	RampUpMs int `json:"ramp_up_ms,omitempty"`
+
+	// UploadURL receives upload POSTs (defaults to target + "/upload")
+	UploadURL string `json:"upload_url,omitempty"`
+}
+
+// ThroughputResult holds the outcome of a throughput test
+type ThroughputResult struct {
+	Streams       int
+	DownloadKbps  float64
+	UploadKbps    float64
+	DownloadBytes int64
+	UploadBytes   int64
+}
+
+// Validate checks the throughput configuration
+func (c *ThroughputConfig) Validate() error {
+	switch c.Direction {
+	case "", ThroughputDownload, ThroughputUpload, ThroughputBoth:
+	default:
+		return fmt.Errorf("unsupported throughput direction %q", c.Direction)
+	}
+	if c.Streams < 0 || c.SizeBytes < 0 || c.DurationMs < 0 || c.RampUpMs < 0 {
+		return fmt.Errorf("throughput streams, size_bytes, duration_ms and ramp_up_ms must be non-negative")
+	}
+	if c.DurationMs > 0 && c.RampUpMs >= c.DurationMs {
+		return fmt.Errorf("ramp_up_ms must be shorter than duration_ms")
+	}
+	return nil
+}
+
+// streams returns the number of parallel streams
+func (c *ThroughputConfig) streams() int {
+	if c.Streams > 0 {
+		return c.Streams
+	}
+	return 1
+}
+
+// direction returns the test direction
+func (c *ThroughputConfig) direction() string {
+	if c.Direction != "" {
+		return c.Direction
+	}
+	return ThroughputDownload
+}
+
+// uploadBytes returns the generated payload size per upload request
+func (c *ThroughputConfig) uploadBytes() int64 {
+	if c.SizeBytes > 0 {
+		return c.SizeBytes
+	}
+	return defaultUploadBytes
+}
+
+// MeasureThroughputConfig runs the configured download and/or upload tests.
+// Download and upload run one after the other so they do not compete, and
+// both end when ctx does.
+func MeasureThroughputConfig(ctx context.Context, downloadURL, uploadURL string, cfg *ThroughputConfig, family string, egress *EgressConfig, timeouts *TimeoutConfig) (*ThroughputResult, error) {
+	result := &ThroughputResult{Streams: cfg.streams()}
+	client, err := newThroughputClient(family, cfg.streams(), egress, timeouts)
+	if err != nil {
+		return result, err
+	}
+	defer client.CloseIdleConnections()
+
+	direction := cfg.direction()
+	if direction == ThroughputDownload || direction == ThroughputBoth {
+		kbps, bytes, err := runStreams(ctx, cfg, func(ctx context.Context, counter *int64) error {
+			return downloadStream(ctx, client, downloadURL, cfg, counter)
+		})
+		result.DownloadKbps, result.DownloadBytes = kbps, bytes
+		if err != nil {
+			return result, fmt.Errorf("download failed: %w", err)
+		}
+	}
+
+	if direction == ThroughputUpload || direction == ThroughputBoth {
+		kbps, bytes, err := runStreams(ctx, cfg, func(ctx context.Context, counter *int64) error {
+			return uploadStream(ctx, client, uploadURL, cfg, counter)
+		})
+		result.UploadKbps, result.UploadBytes = kbps, bytes
+		if err != nil {
+			return result, fmt.Errorf("upload failed: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// newThroughputClient returns a client with one connection per stream
+func newThroughputClient(family string, streams int, egress *EgressConfig, timeouts *TimeoutConfig) (*http.Client, error) {
+	transport, err := egress.transport(family, timeouts)
+	if err != nil {
+		return nil, err
+	}
+	transport.DisableCompression = true
+	transport.MaxConnsPerHost = streams
+	transport.MaxIdleConnsPerHost = streams
+	return &http.Client{Transport: transport}, nil
+}
+
+// runStreams runs fn on the configured number of parallel streams and
+// returns the aggregate rate in kbps, excluding bytes moved during ramp-up.
+// If the transfer ends before ramp-up does, the whole transfer is used.
+func runStreams(parent context.Context, cfg *ThroughputConfig, fn func(ctx context.Context, counter *int64) error) (float64, int64, error) {
+	// Size-bounded transfers get the same budget as MeasureThroughput
+	timeout := defaultThroughputTimeout
+	if cfg.DurationMs > 0 {
+		timeout = time.Duration(cfg.DurationMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	var total int64
+	var mu sync.Mutex
+	var rampBytes int64
+	var rampTime time.Time
+
+	start := time.Now()
+	if cfg.RampUpMs > 0 {
+		timer := time.AfterFunc(time.Duration(cfg.RampUpMs)*time.Millisecond, func() {
+			mu.Lock()
+			rampBytes = atomic.LoadInt64(&total)
+			rampTime = time.Now()
+			mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, cfg.streams())
+	for i := 0; i < cfg.streams(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx, &total); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	end := time.Now()
+	close(errs)
+
+	bytesMoved := atomic.LoadInt64(&total)
+
+	// In duration mode the deadline ending in-flight transfers is expected,
+	// unless it was the parent context that ended them
+	var err error
+	for streamErr := range errs {
+		if cfg.DurationMs > 0 && parent.Err() == nil && errors.Is(streamErr, context.DeadlineExceeded) {
+			continue
+		}
+		err = streamErr
+		break
+	}
+
+	mu.Lock()
+	measuredBytes, measuredStart := bytesMoved, start
+	if !rampTime.IsZero() && end.After(rampTime) && bytesMoved > rampBytes {
+		measuredBytes, measuredStart = bytesMoved-rampBytes, rampTime
+	}
+	mu.Unlock()
+
+	seconds := end.Sub(measuredStart).Seconds()
+	if seconds <= 0 {
+		return 0, bytesMoved, err
+	}
+	return float64(measuredBytes*8) / seconds / 1000.0, bytesMoved, err
+}
+
+// downloadStream fetches the download URL, repeating until the context ends
+// in duration mode
+func downloadStream(ctx context.Context, client *http.Client, downloadURL string, cfg *ThroughputConfig, counter *int64) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		req.Header.Set("Pragma", "no-cache")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		var body io.Reader = resp.Body
+		if cfg.SizeBytes > 0 {
+			body = io.LimitReader(resp.Body, cfg.SizeBytes)
+		}
+		_, err = io.Copy(io.Discard, &countingReader{r: body, counter: counter})
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("download returned status %d", resp.StatusCode)
+		}
+
+		if cfg.DurationMs == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// uploadStream POSTs generated payloads, repeating until the context ends
+// in duration mode
+func uploadStream(ctx context.Context, client *http.Client, uploadURL string, cfg *ThroughputConfig, counter *int64) error {
+	for {
+		body := &countingReader{r: newRandomReader(cfg.uploadBytes()), counter: counter}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, body)
+		if err != nil {
+			return err
+		}
+		req.ContentLength = cfg.uploadBytes()
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("upload returned status %d", resp.StatusCode)
+		}
+
+		if cfg.DurationMs == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// DefaultUploadURL returns the test-server upload endpoint next to a target
+func DefaultUploadURL(targetURL string) string {
+	return strings.TrimSuffix(targetURL, "/") + "/upload"
+}
+
+// countingReader adds the bytes read to a shared counter
+type countingReader struct {
+	r       io.Reader
+	counter *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.counter, int64(n))
+	return n, err
+}
+
+// randomReader generates a payload of the given size. The bytes are random
+// so compression anywhere on the path cannot shrink the upload.
+type randomReader struct {
+	remaining int64
+	src       *rand.ChaCha8
+}
+
+// newRandomReader returns a randomReader with a random seed
+func newRandomReader(size int64) *randomReader {
+	var seed [32]byte
+	cryptorand.Read(seed[:])
+	return &randomReader{remaining: size, src: rand.NewChaCha8(seed)}
+}
+
+func (r *randomReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	r.src.Read(p)
+	r.remaining -= int64(len(p))
+	return len(p), nil
+}
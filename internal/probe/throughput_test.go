@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunStreams(t *testing.T) {
+	errStream := errors.New("stream failed")
+
+	tests := []struct {
+		name      string
+		cfg       ThroughputConfig
+		fn        func(ctx context.Context, counter *int64) error
+		wantBytes int64
+		wantErr   error
+	}{
+		{
+			name: "size bounded streams add up",
+			cfg:  ThroughputConfig{Streams: 4},
+			fn: func(ctx context.Context, counter *int64) error {
+				atomic.AddInt64(counter, 1000)
+				return nil
+			},
+			wantBytes: 4000,
+		},
+		{
+			name: "duration deadline is expected",
+			cfg:  ThroughputConfig{Streams: 2, DurationMs: 50},
+			fn: func(ctx context.Context, counter *int64) error {
+				atomic.AddInt64(counter, 500)
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			wantBytes: 1000,
+		},
+		{
+			name: "stream error is returned",
+			cfg:  ThroughputConfig{Streams: 2},
+			fn: func(ctx context.Context, counter *int64) error {
+				atomic.AddInt64(counter, 100)
+				return errStream
+			},
+			wantBytes: 200,
+			wantErr:   errStream,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kbps, moved, err := runStreams(context.Background(), &tt.cfg, tt.fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runStreams() error = %v, expected %v", err, tt.wantErr)
+			}
+			if moved != tt.wantBytes {
+				t.Errorf("runStreams() bytes = %d, expected %d", moved, tt.wantBytes)
+			}
+			if kbps <= 0 {
+				t.Errorf("runStreams() kbps = %v, expected a positive rate", kbps)
+			}
+		})
+	}
+}
+
+func TestRunStreamsParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := &ThroughputConfig{DurationMs: 1000}
+	_, _, err := runStreams(ctx, cfg, func(ctx context.Context, counter *int64) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runStreams() error = %v, expected context.Canceled", err)
+	}
+}
+
+func TestRunStreamsExcludesRampUp(t *testing.T) {
+	// Each stream moves a burst during ramp-up and then a steady trickle;
+	// only the bytes after ramp-up count towards the rate
+	cfg := &ThroughputConfig{DurationMs: 300, RampUpMs: 100}
+	kbps, moved, err := runStreams(context.Background(), cfg, func(ctx context.Context, counter *int64) error {
+		atomic.AddInt64(counter, 1_000_000)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				atomic.AddInt64(counter, 100)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("runStreams() error = %v", err)
+	}
+	if moved < 1_000_000 {
+		t.Errorf("runStreams() bytes = %d, expected the ramp-up burst to be counted as moved", moved)
+	}
+	// The burst alone would be over 26000 kbps over the whole 300ms
+	if kbps > 1000 {
+		t.Errorf("runStreams() kbps = %v, expected the ramp-up burst to be excluded", kbps)
+	}
+}
+
+func TestRandomReaderIsIncompressible(t *testing.T) {
+	const size = 256 * 1024
+	payload, err := io.ReadAll(newRandomReader(size))
+	if err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	if len(payload) != size {
+		t.Fatalf("Expected %d bytes, got %d", size, len(payload))
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(payload)
+	zw.Close()
+	if compressed.Len() < size {
+		t.Errorf("Payload compressed from %d to %d bytes", size, compressed.Len())
+	}
+}
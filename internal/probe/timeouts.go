@@ -0,0 +1,143 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Default stage and overall timeouts, used when a target leaves them unset
+const (
+	defaultDNSTimeout     = 10 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	defaultTLSTimeout     = 10 * time.Second
+	defaultTTFBTimeout    = 30 * time.Second
+	defaultTotalTimeout   = 60 * time.Second
+)
+
+// TimeoutConfig bounds each measurement stage and the measurement as a
+// whole. Zero fields keep the defaults. A stage that runs out of time fails
+// with its own error stage and is marked as a timeout.
+type TimeoutConfig struct {
+	// DNSMs bounds name resolution (default 10000)
+	DNSMs int `json:"dns_ms,omitempty"`
+
+	// ConnectMs bounds the TCP connect; through a proxy it bounds the
+	// connect to the proxy and the proxy handshake together (default 10000)
+	ConnectMs int `json:"connect_ms,omitempty"`
+
+	// TLSMs bounds the TLS handshake (default 10000)
+	TLSMs int `json:"tls_ms,omitempty"`
+
+	// TTFBMs bounds the wait for response headers after the request was
+	// sent (default 30000)
+	TTFBMs int `json:"ttfb_ms,omitempty"`
+
+	// TotalMs bounds the whole measurement, including the throughput phase
+	// and every step of a transaction (default 60000)
+	TotalMs int `json:"total_ms,omitempty"`
+}
+
+// Validate checks the timeout configuration
+func (t *TimeoutConfig) Validate() error {
+	if t.DNSMs < 0 || t.ConnectMs < 0 || t.TLSMs < 0 || t.TTFBMs < 0 || t.TotalMs < 0 {
+		return fmt.Errorf("timeouts must be non-negative")
+	}
+	return nil
+}
+
+// msOr returns ms as a duration, or def when ms is unset
+func msOr(ms int, def time.Duration) time.Duration {
+	if ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return def
+}
+
+// dns returns the DNS stage timeout
+func (t *TimeoutConfig) dns() time.Duration {
+	if t == nil {
+		return defaultDNSTimeout
+	}
+	return msOr(t.DNSMs, defaultDNSTimeout)
+}
+
+// connect returns the TCP connect (and proxy handshake) timeout
+func (t *TimeoutConfig) connect() time.Duration {
+	if t == nil {
+		return defaultConnectTimeout
+	}
+	return msOr(t.ConnectMs, defaultConnectTimeout)
+}
+
+// tls returns the TLS handshake timeout
+func (t *TimeoutConfig) tls() time.Duration {
+	if t == nil {
+		return defaultTLSTimeout
+	}
+	return msOr(t.TLSMs, defaultTLSTimeout)
+}
+
+// ttfb returns the response header timeout
+func (t *TimeoutConfig) ttfb() time.Duration {
+	if t == nil {
+		return defaultTTFBTimeout
+	}
+	return msOr(t.TTFBMs, defaultTTFBTimeout)
+}
+
+// Total returns the overall measurement timeout
+func (t *TimeoutConfig) Total() time.Duration {
+	if t == nil {
+		return defaultTotalTimeout
+	}
+	return msOr(t.TotalMs, defaultTotalTimeout)
+}
+
+// isTimeout reports whether err means a stage ran out of time, either its
+// own timeout or the overall measurement deadline
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// stageError builds the error of a failed stage
+func stageError(stage string, err error) *MeasurementError {
+	return &MeasurementError{Stage: stage, Message: err.Error(), Timeout: isTimeout(err)}
+}
+
+// deadlineWithin returns the time d from now, or the ctx deadline if that
+// comes first
+func deadlineWithin(ctx context.Context, d time.Duration) time.Time {
+	deadline := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// watchConn interrupts blocking I/O on conn once ctx is done, so deadlines
+// and shutdown also end reads and writes that do not take a context. The
+// returned function stops watching.
+func watchConn(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+}
+
+// sleepContext sleeps for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
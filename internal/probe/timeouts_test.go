@@ -0,0 +1,133 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "wrapped deadline exceeded", err: fmt.Errorf("dial: %w", context.DeadlineExceeded), want: true},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, want: true},
+		{name: "wrapped net timeout", err: fmt.Errorf("handshake: %w", &net.DNSError{Err: "timeout", IsTimeout: true}), want: true},
+		{name: "cancelled", err: context.Canceled},
+		{name: "net error without timeout", err: &net.DNSError{Err: "no such host", IsNotFound: true}},
+		{name: "plain error", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTimeout(tt.err); got != tt.want {
+				t.Errorf("isTimeout(%v) = %v, expected %v", tt.err, got, tt.want)
+			}
+			if got := stageError(models.ErrorStageTCP, tt.err).Timeout; got != tt.want {
+				t.Errorf("stageError().Timeout = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeasureTargetStageTimeouts(t *testing.T) {
+	// Accepts connections but never answers, so a TLS handshake stalls
+	silent, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	closed, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedURL := "http://" + closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		timeouts     TimeoutConfig
+		wantStage    string
+		wantTimedOut bool
+	}{
+		{
+			name:         "tls handshake",
+			url:          "https://" + silent.Addr().String(),
+			timeouts:     TimeoutConfig{TLSMs: 100},
+			wantStage:    models.ErrorStageTLS,
+			wantTimedOut: true,
+		},
+		{
+			name:         "response headers",
+			url:          slow.URL,
+			timeouts:     TimeoutConfig{TTFBMs: 100},
+			wantStage:    models.ErrorStageHTTP,
+			wantTimedOut: true,
+		},
+		{
+			name:         "overall deadline",
+			url:          slow.URL,
+			timeouts:     TimeoutConfig{TotalMs: 100},
+			wantStage:    models.ErrorStageHTTP,
+			wantTimedOut: true,
+		},
+		{
+			name:      "connection refused",
+			url:       closedURL,
+			wantStage: models.ErrorStageTCP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &TargetConfig{URL: tt.url, Timeouts: &tt.timeouts}
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Total())
+			defer cancel()
+
+			m, err := MeasureTargetConfig(ctx, cfg, AddressFamilyAny)
+			if err == nil {
+				t.Fatal("MeasureTargetConfig() expected an error")
+			}
+			if m.ErrorStage == nil || *m.ErrorStage != tt.wantStage {
+				t.Errorf("ErrorStage = %v, expected %s (%v)", m.ErrorStage, tt.wantStage, err)
+			}
+			if m.TimedOut != tt.wantTimedOut {
+				t.Errorf("TimedOut = %v, expected %v (%v)", m.TimedOut, tt.wantTimedOut, err)
+			}
+		})
+	}
+}
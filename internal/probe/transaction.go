@@ -0,0 +1,355 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// TransactionConfig describes a scripted multi-step flow (e.g. login, list,
+// fetch). Steps run in order over a shared cookie jar and connection pool;
+// values extracted from one response can be used in later steps as {{name}}.
+type TransactionConfig struct {
+	Name  string            `json:"name"`
+	Steps []TransactionStep `json:"steps"`
+
+	// Variables seeds the variable set before the first step
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// TransactionStep is a single request within a transaction
+type TransactionStep struct {
+	Name       string              `json:"name"`
+	URL        string              `json:"url"`
+	Request    RequestConfig       `json:"request"`
+	Assertions *ResponseAssertions `json:"assertions,omitempty"`
+	Extract    []Extraction        `json:"extract,omitempty"`
+}
+
+// Extraction captures a value from a step response into a variable. Exactly
+// one source must be set: a JSON path, a response header, or a regular
+// expression whose first capture group (or whole match) is used.
+type Extraction struct {
+	Var      string `json:"var"`
+	JSONPath string `json:"json_path,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// StepResult is the measurement of one executed transaction step
+type StepResult struct {
+	Name        string
+	Index       int
+	Measurement *Measurement
+	Duration    time.Duration
+}
+
+// TransactionResult is the outcome of running a transaction. Steps holds
+// only the steps that were executed; a failing step stops the transaction.
+type TransactionResult struct {
+	Name       string
+	StepCount  int
+	Steps      []*StepResult
+	Duration   time.Duration
+	ErrorStage *string
+	TimedOut   bool
+	FailedStep string
+	Timestamp  time.Time
+}
+
+// Validate checks the transaction definition and compiles its patterns
+func (t *TransactionConfig) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("transaction name is required")
+	}
+	if strings.Contains(t.Name, "#") {
+		return fmt.Errorf("transaction name must not contain '#'")
+	}
+	if len(t.Steps) == 0 {
+		return fmt.Errorf("transaction %s has no steps", t.Name)
+	}
+
+	seen := make(map[string]bool)
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		if step.Name == "" {
+			return fmt.Errorf("step %d: name is required", i)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("duplicate step name %q", step.Name)
+		}
+		seen[step.Name] = true
+
+		if step.URL == "" {
+			return fmt.Errorf("step %s: url is required", step.Name)
+		}
+		if err := step.Request.Validate(); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if step.Assertions != nil {
+			if err := step.Assertions.Validate(); err != nil {
+				return fmt.Errorf("step %s: %w", step.Name, err)
+			}
+		}
+
+		for j := range step.Extract {
+			ex := &step.Extract[j]
+			if ex.Var == "" {
+				return fmt.Errorf("step %s: extract entries require a var", step.Name)
+			}
+			sources := 0
+			for _, src := range []string{ex.JSONPath, ex.Header, ex.Regex} {
+				if src != "" {
+					sources++
+				}
+			}
+			if sources != 1 {
+				return fmt.Errorf("step %s: extract %s needs exactly one of json_path, header or regex", step.Name, ex.Var)
+			}
+			if ex.Regex != "" {
+				re, err := regexp.Compile(ex.Regex)
+				if err != nil {
+					return fmt.Errorf("step %s: invalid extract regex: %w", step.Name, err)
+				}
+				ex.regex = re
+			}
+		}
+	}
+
+	return nil
+}
+
+// RunTransaction executes the steps of a transaction in order over the
+// given address family mode. Connection timings come from httptrace, so a
+// step reusing a kept-alive connection reports zero DNS/TCP/TLS time. The
+// total timeout bounds the whole transaction, not each step.
+func RunTransaction(ctx context.Context, cfg *TransactionConfig, family string, egress *EgressConfig, timeouts *TimeoutConfig) (*TransactionResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.Total())
+	defer cancel()
+
+	result := &TransactionResult{
+		Name:      cfg.Name,
+		StepCount: len(cfg.Steps),
+		Timestamp: time.Now(),
+	}
+
+	fail := func(step string, err *MeasurementError) (*TransactionResult, error) {
+		result.ErrorStage = &err.Stage
+		result.TimedOut = err.Timeout
+		result.FailedStep = step
+		return result, err
+	}
+
+	if !ValidAddressFamily(family) {
+		return fail("", stageError("parse", fmt.Errorf("unsupported address family %q", family)))
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fail("", stageError("parse", err))
+	}
+
+	transport, err := egress.transport(family, timeouts)
+	if err != nil {
+		return fail("", stageError("TCP", err))
+	}
+	defer transport.CloseIdleConnections()
+	proxied := egress != nil && egress.Proxy != ""
+
+	client := &http.Client{
+		Transport: transport,
+		Jar:       jar,
+	}
+
+	vars := make(map[string]string, len(cfg.Variables))
+	for name, value := range cfg.Variables {
+		vars[name] = value
+	}
+
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	for i := range cfg.Steps {
+		step := &cfg.Steps[i]
+		stepResult, body, header, err := runStep(ctx, client, step, i, family, vars, proxied)
+		result.Steps = append(result.Steps, stepResult)
+		if err != nil {
+			return fail(step.Name, err.(*MeasurementError))
+		}
+
+		for _, ex := range step.Extract {
+			value, err := ex.extract(body, header)
+			if err != nil {
+				stageErr := stageError(models.ErrorStageAssertion, err)
+				stepResult.Measurement.fail(stageErr)
+				return fail(step.Name, stageErr)
+			}
+			vars[ex.Var] = value
+		}
+	}
+
+	return result, nil
+}
+
+// runStep executes a single step and returns its measurement together with
+// the buffered body and headers used for extraction. Through a proxy, the
+// time between connecting to the proxy and the tunnel being ready is
+// reported as the proxy connect stage.
+func runStep(ctx context.Context, client *http.Client, step *TransactionStep, index int, family string, vars map[string]string, proxied bool) (*StepResult, []byte, http.Header, error) {
+	measurement := &Measurement{
+		Target:        step.URL,
+		AddressFamily: family,
+		Timestamp:     time.Now(),
+	}
+	stepResult := &StepResult{Name: step.Name, Index: index, Measurement: measurement}
+	stepStart := time.Now()
+	defer func() { stepResult.Duration = time.Since(stepStart) }()
+
+	fail := func(stage string, err error) (*StepResult, []byte, http.Header, error) {
+		_, stageErr := measurement.fail(stageError(stage, err))
+		return stepResult, nil, nil, stageErr
+	}
+
+	req, err := step.Request.newRequest(step.URL, vars)
+	if err != nil {
+		return fail("HTTP", err)
+	}
+	measurement.Target = req.URL.String()
+
+	var dnsStart, connectStart, connectDone, tlsStart, wroteRequest time.Time
+	var dnsErr, connectErr, tlsErr error
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			measurement.DNSMs = float64(time.Since(dnsStart).Microseconds()) / 1000.0
+			dnsErr = info.Err
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(_, addr string, err error) {
+			connectDone = time.Now()
+			measurement.TCPMs = float64(connectDone.Sub(connectStart).Microseconds()) / 1000.0
+			connectErr = err
+			if err == nil {
+				measurement.RemoteAddr = addr
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+			if proxied && !connectDone.IsZero() {
+				measurement.ProxyConnectMs = float64(tlsStart.Sub(connectDone).Microseconds()) / 1000.0
+			}
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			measurement.TLSMs = float64(time.Since(tlsStart).Microseconds()) / 1000.0
+			tlsErr = err
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn == nil {
+				return
+			}
+			if info.Reused {
+				measurement.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+			measurement.LocalIP = localIP(info.Conn.LocalAddr())
+			measurement.EgressInterface = egressInterface(info.Conn.LocalAddr())
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { measurement.HTTPTTFBMs = float64(time.Since(wroteRequest).Microseconds()) / 1000.0 },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		switch {
+		case dnsErr != nil:
+			return fail("DNS", dnsErr)
+		case connectErr != nil:
+			return fail("TCP", connectErr)
+		case proxied && !connectDone.IsZero() && tlsStart.IsZero() && req.URL.Scheme == "https":
+			return fail("proxy", err)
+		case tlsErr != nil:
+			return fail("TLS", tlsErr)
+		default:
+			return fail("HTTP", err)
+		}
+	}
+	defer resp.Body.Close()
+	measurement.HTTPStatusCode = resp.StatusCode
+
+	limit := int64(maxAssertionBodyBytes)
+	if step.Assertions != nil {
+		limit = step.Assertions.bodyLimit()
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return fail("HTTP", err)
+	}
+	remaining, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return fail("HTTP", err)
+	}
+
+	if step.Assertions != nil {
+		if err := step.Assertions.Check(resp.StatusCode, body, remaining > 0); err != nil {
+			return fail(models.ErrorStageAssertion, err)
+		}
+	}
+
+	return stepResult, body, resp.Header, nil
+}
+
+// extract reads the variable value from a step response
+func (ex Extraction) extract(body []byte, header http.Header) (string, error) {
+	switch {
+	case ex.Header != "":
+		value := header.Get(ex.Header)
+		if value == "" {
+			return "", fmt.Errorf("extract %s: header %s not present", ex.Var, ex.Header)
+		}
+		return value, nil
+
+	case ex.JSONPath != "":
+		// Decode numbers as json.Number so IDs keep their exact text form
+		var doc interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return "", fmt.Errorf("extract %s: response body is not valid JSON: %v", ex.Var, err)
+		}
+		value, ok := LookupJSONPath(doc, ex.JSONPath)
+		if !ok {
+			return "", fmt.Errorf("extract %s: json path %s not found", ex.Var, ex.JSONPath)
+		}
+		return fmt.Sprint(value), nil
+
+	default:
+		re := ex.regex
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(ex.Regex); err != nil {
+				return "", fmt.Errorf("extract %s: invalid regex: %w", ex.Var, err)
+			}
+		}
+		match := re.FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("extract %s: regex %q did not match", ex.Var, ex.Regex)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	}
+}
@@ -0,0 +1,187 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+// transactionServer serves a login, list and fetch flow. The token comes
+// from a header, the item ID from the JSON list, and the fetch requires both.
+func transactionServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Token", "secret-"+r.URL.Query().Get("user"))
+		fmt.Fprint(w, `session=abc123;`)
+	})
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-alice" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"items":[{"id":12345678901234567890,"name":"first"}]}`)
+	})
+	mux.HandleFunc("/items/12345678901234567890", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("session") != "abc123" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"name":"first"}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRunTransactionExtraction(t *testing.T) {
+	server := transactionServer()
+	defer server.Close()
+
+	ok := &ResponseAssertions{StatusCodes: []int{200}}
+	tests := []struct {
+		name       string
+		fetch      TransactionStep
+		steps      int
+		failedStep string
+		errorStage string
+	}{
+		{
+			name: "variables flow through every step",
+			fetch: TransactionStep{
+				Name:       "fetch",
+				URL:        server.URL + "/items/{{id}}?session={{session}}",
+				Assertions: &ResponseAssertions{JSONPaths: []JSONPathAssertion{{Path: "name", Equals: "first"}}},
+			},
+			steps: 3,
+		},
+		{
+			name: "missing json path fails the step",
+			fetch: TransactionStep{
+				Name:    "fetch",
+				URL:     server.URL + "/items/{{id}}?session={{session}}",
+				Extract: []Extraction{{Var: "owner", JSONPath: "owner.id"}},
+			},
+			steps:      3,
+			failedStep: "fetch",
+			errorStage: models.ErrorStageAssertion,
+		},
+		{
+			name: "missing header fails the step",
+			fetch: TransactionStep{
+				Name:    "fetch",
+				URL:     server.URL + "/items/{{id}}?session={{session}}",
+				Extract: []Extraction{{Var: "etag", Header: "ETag"}},
+			},
+			steps:      3,
+			failedStep: "fetch",
+			errorStage: models.ErrorStageAssertion,
+		},
+		{
+			name: "unmatched regex fails the step",
+			fetch: TransactionStep{
+				Name:    "fetch",
+				URL:     server.URL + "/items/{{id}}?session={{session}}",
+				Extract: []Extraction{{Var: "n", Regex: `"count":(\d+)`}},
+			},
+			steps:      3,
+			failedStep: "fetch",
+			errorStage: models.ErrorStageAssertion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &TransactionConfig{
+				Name:      "flow",
+				Variables: map[string]string{"user": "alice"},
+				Steps: []TransactionStep{
+					{
+						Name:       "login",
+						URL:        server.URL + "/login?user={{user}}",
+						Assertions: ok,
+						Extract: []Extraction{
+							{Var: "token", Header: "X-Token"},
+							{Var: "session", Regex: `session=(\w+);`},
+						},
+					},
+					{
+						Name:       "list",
+						URL:        server.URL + "/items",
+						Request:    RequestConfig{Headers: map[string]string{"Authorization": "Bearer {{token}}"}},
+						Assertions: ok,
+						Extract:    []Extraction{{Var: "id", JSONPath: "items.0.id"}},
+					},
+					tt.fetch,
+				},
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			result, err := RunTransaction(context.Background(), cfg, AddressFamilyAny, nil, nil)
+			if len(result.Steps) != tt.steps {
+				t.Fatalf("Expected %d executed steps, got %d", tt.steps, len(result.Steps))
+			}
+			if tt.errorStage == "" {
+				if err != nil {
+					t.Fatalf("RunTransaction() error = %v", err)
+				}
+				if code := result.Steps[2].Measurement.HTTPStatusCode; code != http.StatusOK {
+					t.Errorf("Expected the fetch step to get status 200, got %d", code)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("RunTransaction() expected an error")
+			}
+			if result.FailedStep != tt.failedStep {
+				t.Errorf("FailedStep = %q, expected %q", result.FailedStep, tt.failedStep)
+			}
+			if result.ErrorStage == nil || *result.ErrorStage != tt.errorStage {
+				t.Errorf("ErrorStage = %v, expected %s", result.ErrorStage, tt.errorStage)
+			}
+		})
+	}
+}
+
+func TestExtractionExtract(t *testing.T) {
+	header := http.Header{"X-Request-Id": []string{"req-1"}}
+	body := []byte("session token=xyz")
+
+	tests := []struct {
+		name    string
+		ex      Extraction
+		want    string
+		wantErr bool
+	}{
+		{name: "header", ex: Extraction{Var: "v", Header: "X-Request-Id"}, want: "req-1"},
+		{name: "missing header", ex: Extraction{Var: "v", Header: "X-Other"}, wantErr: true},
+		{name: "regex capture group", ex: Extraction{Var: "v", Regex: `token=(\w+)`}, want: "xyz"},
+		{name: "regex whole match", ex: Extraction{Var: "v", Regex: `token=\w+`}, want: "token=xyz"},
+		{name: "regex no match", ex: Extraction{Var: "v", Regex: `secret=(\w+)`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ex.extract(body, header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("extract() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+
+	// Large JSON numbers keep their exact text form
+	jsonBody := []byte(`{"user":{"id":9007199254740993}}`)
+	got, err := Extraction{Var: "v", JSONPath: "user.id"}.extract(jsonBody, nil)
+	if err != nil || got != "9007199254740993" {
+		t.Errorf("extract() = %q, %v, expected 9007199254740993", got, err)
+	}
+	if _, err := (Extraction{Var: "v", JSONPath: "user.id"}).extract([]byte("not json"), nil); err == nil {
+		t.Error("extract() expected an error for a body that is not JSON")
+	}
+}
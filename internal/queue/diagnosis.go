@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/rahulgh33/wirescope/internal/models"
+)
+
+const (
+	// StreamNameDiagnoses holds diagnosis results. Unlike the events stream
+	// it keeps messages until they age out, so every external subscriber
+	// sees every result.
+	StreamNameDiagnoses = "telemetry-diagnoses"
+
+	// SubjectWindowsFlushed carries flushed-window notifications on the
+	// events stream
+	SubjectWindowsFlushed = "telemetry.windows_flushed"
+	SubjectDiagnoses      = "telemetry.diagnoses"
+
+	// SubjectCorrelations carries correlated incidents on the diagnoses
+	// stream
+	SubjectCorrelations = "telemetry.correlations"
+
+	// ConsumerNameDiagnoser is shared by all diagnoser instances
+	ConsumerNameDiagnoser = "diagnoser"
+
+	// DiagnosesRetention bounds how long diagnosis results are kept
+	DiagnosesRetention = 24 * time.Hour
+)
+
+// createDiagnosesStream creates the diagnosis results stream
+func (p *NATSEventProcessor) createDiagnosesStream() error {
+	diagnosesStream := jetstream.StreamConfig{
+		Name:        StreamNameDiagnoses,
+		Subjects:    []string{SubjectDiagnoses, SubjectCorrelations},
+		Storage:     jetstream.FileStorage,
+		Retention:   jetstream.LimitsPolicy,
+		MaxAge:      DiagnosesRetention,
+		Replicas:    1,
+		Discard:     jetstream.DiscardOld,
+		Description: "Diagnosis results and correlated incidents for alerting",
+	}
+
+	if _, err := p.js.CreateOrUpdateStream(p.ctx, diagnosesStream); err != nil {
+		return fmt.Errorf("failed to create diagnoses stream: %w", err)
+	}
+	return nil
+}
+
+// PublishWindowFlushed publishes a flushed-window notification for the
+// diagnoser
+func (p *NATSEventProcessor) PublishWindowFlushed(notification *models.WindowFlushed) error {
+	if err := notification.Validate(); err != nil {
+		return fmt.Errorf("invalid window notification: %w", err)
+	}
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal window notification: %w", err)
+	}
+
+	if _, err := p.js.Publish(p.ctx, SubjectWindowsFlushed, data); err != nil {
+		return fmt.Errorf("failed to publish window notification: %w", err)
+	}
+	return nil
+}
+
+// ConsumeWindowsFlushed starts consuming flushed-window notifications with
+// the shared diagnoser consumer. A notification that still fails on its last
+// delivery is dropped; the window is diagnosed again if it is flushed again.
+func (p *NATSEventProcessor) ConsumeWindowsFlushed(handler func(*models.WindowFlushed) error) error {
+	consumerConfig := jetstream.ConsumerConfig{
+		Name:          ConsumerNameDiagnoser,
+		Durable:       ConsumerNameDiagnoser,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    p.config.MaxDeliver,
+		AckWait:       p.config.AckWait,
+		MaxAckPending: p.config.MaxAckPending,
+		FilterSubject: SubjectWindowsFlushed,
+		Description:   "Diagnoser consumer of flushed-window notifications",
+	}
+
+	consumer, err := p.js.CreateOrUpdateConsumer(p.ctx, StreamNameEvents, consumerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create diagnoser consumer: %w", err)
+	}
+
+	_, err = consumer.Consume(func(msg jetstream.Msg) {
+		lastAttempt := false
+		if metadata, _ := msg.Metadata(); metadata != nil && metadata.NumDelivered >= uint64(p.config.MaxDeliver) {
+			lastAttempt = true
+		}
+
+		var notification models.WindowFlushed
+		if err := json.Unmarshal(msg.Data(), &notification); err != nil {
+			log.Printf("Failed to unmarshal window notification, dropping: %v", err)
+			msg.Ack()
+			return
+		}
+
+		start := time.Now()
+		status := "success"
+		defer func() {
+			queueProcessingDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+		}()
+
+		if err := handler(&notification); err != nil {
+			status = "error"
+			log.Printf("Failed to diagnose window %s of %s/%s: %v",
+				notification.WindowStartTs.Format(time.RFC3339), notification.ClientID, notification.Target, err)
+			if lastAttempt {
+				msg.Ack()
+				return
+			}
+			msg.Nak()
+			return
+		}
+
+		msg.Ack()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start consuming window notifications: %w", err)
+	}
+
+	return nil
+}
+
+// PublishDiagnosis publishes a diagnosis result
+func (p *NATSEventProcessor) PublishDiagnosis(event *models.DiagnosisEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal diagnosis: %w", err)
+	}
+
+	if _, err := p.js.Publish(p.ctx, SubjectDiagnoses, data); err != nil {
+		return fmt.Errorf("failed to publish diagnosis: %w", err)
+	}
+	return nil
+}
+
+// PublishCorrelatedIncident publishes a correlated incident
+func (p *NATSEventProcessor) PublishCorrelatedIncident(incident *models.CorrelatedIncident) error {
+	data, err := json.Marshal(incident)
+	if err != nil {
+		return fmt.Errorf("failed to marshal correlated incident: %w", err)
+	}
+
+	if _, err := p.js.Publish(p.ctx, SubjectCorrelations, data); err != nil {
+		return fmt.Errorf("failed to publish correlated incident: %w", err)
+	}
+	return nil
+}
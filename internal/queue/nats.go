@@ -21,11 +21,15 @@ const (
 	StreamNameDLQ    = "telemetry-events-dlq"
 
 	// Subject names
-	SubjectEvents = "telemetry.events"
-	SubjectDLQ    = "telemetry.dlq"
+	SubjectEvents     = "telemetry.events"
+	SubjectPathTraces = "telemetry.path_traces"
+	SubjectHeartbeats = "telemetry.heartbeats"
+	SubjectDLQ        = "telemetry.dlq"
 
 	// Consumer names
 	ConsumerNameAggregator = "aggregator"
+	ConsumerNamePathTraces = "path-traces"
+	ConsumerNameHeartbeats = "heartbeats"
 
 	// Configuration defaults
 	DefaultMaxDeliver      = 5
@@ -174,7 +178,7 @@ func (p *NATSEventProcessor) createStreams() error {
 	// Create main telemetry events stream
 	eventsStream := jetstream.StreamConfig{
 		Name:        StreamNameEvents,
-		Subjects:    []string{SubjectEvents},
+		Subjects:    []string{SubjectEvents, SubjectPathTraces, SubjectHeartbeats, SubjectWindowsFlushed},
 		Storage:     jetstream.FileStorage,
 		Retention:   jetstream.WorkQueuePolicy,
 		MaxAge:      p.config.StreamRetention,
@@ -206,7 +210,7 @@ func (p *NATSEventProcessor) createStreams() error {
 		}
 	}
 
-	return nil
+	return p.createDiagnosesStream()
 }
 
 // PublishEvent publishes a telemetry event to the message queue
@@ -323,6 +327,164 @@ func (p *NATSEventProcessor) ConsumeEvents(handler func(*models.TelemetryEvent)
 	return nil
 }
 
+// PublishPathTrace publishes a path trace to the message queue. Path traces
+// share the events stream under their own subject.
+func (p *NATSEventProcessor) PublishPathTrace(trace *models.PathTraceEvent) error {
+	if err := trace.Validate(); err != nil {
+		return fmt.Errorf("invalid path trace: %w", err)
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return fmt.Errorf("failed to marshal path trace: %w", err)
+	}
+
+	_, err = p.js.Publish(p.ctx, SubjectPathTraces, data)
+	if err != nil {
+		return fmt.Errorf("failed to publish path trace: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumePathTraces starts consuming path traces with a dedicated consumer.
+// Unlike events, which are acknowledged once their window is committed,
+// path traces are stored individually, so each message is acknowledged as
+// soon as the handler succeeds.
+func (p *NATSEventProcessor) ConsumePathTraces(handler func(*models.PathTraceEvent) error) error {
+	consumerConfig := jetstream.ConsumerConfig{
+		Name:          ConsumerNamePathTraces,
+		Durable:       ConsumerNamePathTraces,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    p.config.MaxDeliver,
+		AckWait:       p.config.AckWait,
+		MaxAckPending: p.config.MaxAckPending,
+		FilterSubject: SubjectPathTraces,
+		Description:   "Path trace consumer with explicit acknowledgment",
+	}
+
+	consumer, err := p.js.CreateOrUpdateConsumer(p.ctx, StreamNameEvents, consumerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create path trace consumer: %w", err)
+	}
+
+	_, err = consumer.Consume(func(msg jetstream.Msg) {
+		lastAttempt := false
+		if metadata, _ := msg.Metadata(); metadata != nil && metadata.NumDelivered >= uint64(p.config.MaxDeliver) {
+			lastAttempt = true
+		}
+
+		var trace models.PathTraceEvent
+		if err := json.Unmarshal(msg.Data(), &trace); err != nil {
+			log.Printf("Failed to unmarshal path trace: %v", err)
+			if lastAttempt {
+				p.sendToDLQ(msg.Data(), fmt.Sprintf("unmarshal error: %v", err))
+				msg.Ack()
+				return
+			}
+			msg.Nak()
+			return
+		}
+
+		start := time.Now()
+		status := "success"
+		defer func() {
+			queueProcessingDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+		}()
+
+		if err := handler(&trace); err != nil {
+			status = "error"
+			log.Printf("Failed to process path trace %s: %v", trace.EventID, err)
+			if lastAttempt {
+				p.sendToDLQ(msg.Data(), fmt.Sprintf("processing failed after %d attempts: %v", p.config.MaxDeliver, err))
+				msg.Ack()
+				return
+			}
+			msg.Nak()
+			return
+		}
+
+		msg.Ack()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start consuming path traces: %w", err)
+	}
+
+	return nil
+}
+
+// PublishHeartbeat publishes a probe heartbeat to the message queue.
+// Heartbeats share the events stream under their own subject.
+func (p *NATSEventProcessor) PublishHeartbeat(heartbeat *models.Heartbeat) error {
+	if err := heartbeat.Validate(); err != nil {
+		return fmt.Errorf("invalid heartbeat: %w", err)
+	}
+
+	data, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	_, err = p.js.Publish(p.ctx, SubjectHeartbeats, data)
+	if err != nil {
+		return fmt.Errorf("failed to publish heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeHeartbeats starts consuming heartbeats with a dedicated consumer.
+// A heartbeat that still fails on its last delivery is dropped rather than
+// sent to the DLQ, since the probe's next heartbeat supersedes it.
+func (p *NATSEventProcessor) ConsumeHeartbeats(handler func(*models.Heartbeat) error) error {
+	consumerConfig := jetstream.ConsumerConfig{
+		Name:          ConsumerNameHeartbeats,
+		Durable:       ConsumerNameHeartbeats,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    p.config.MaxDeliver,
+		AckWait:       p.config.AckWait,
+		MaxAckPending: p.config.MaxAckPending,
+		FilterSubject: SubjectHeartbeats,
+		Description:   "Probe heartbeat consumer with explicit acknowledgment",
+	}
+
+	consumer, err := p.js.CreateOrUpdateConsumer(p.ctx, StreamNameEvents, consumerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create heartbeat consumer: %w", err)
+	}
+
+	_, err = consumer.Consume(func(msg jetstream.Msg) {
+		lastAttempt := false
+		if metadata, _ := msg.Metadata(); metadata != nil && metadata.NumDelivered >= uint64(p.config.MaxDeliver) {
+			lastAttempt = true
+		}
+
+		var heartbeat models.Heartbeat
+		if err := json.Unmarshal(msg.Data(), &heartbeat); err != nil {
+			log.Printf("Failed to unmarshal heartbeat, dropping: %v", err)
+			msg.Ack()
+			return
+		}
+
+		if err := handler(&heartbeat); err != nil {
+			log.Printf("Failed to process heartbeat from %s: %v", heartbeat.ClientID, err)
+			if lastAttempt {
+				msg.Ack()
+				return
+			}
+			msg.Nak()
+			return
+		}
+
+		msg.Ack()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start consuming heartbeats: %w", err)
+	}
+
+	return nil
+}
+
 // AckEvent acknowledges successful processing of an event
 //
 // Requirement: 3.3 - Transactional consistency (only ACK after DB commit)
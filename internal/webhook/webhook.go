@@ -1,43 +1,145 @@
+// Package webhook posts JSON events to HTTP endpoints, signing them with
+// HMAC-SHA256 when a secret is configured
 package webhook
-package webhook
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
 
-}	return nil	}		}(endpoint)			w.client.Post(url, "application/json", bytes.NewReader(data))		go func(url string) {	for _, endpoint := range w.endpoints {	}		return err	if err != nil {	data, err := json.Marshal(event)func (w *WebhookService) Send(event *Event) error {}	}		client:    &http.Client{Timeout: 5 * time.Second},		endpoints: endpoints,	return &WebhookService{func NewWebhookService(endpoints []string) *WebhookService {}	client    *http.Client	endpoints []stringtype WebhookService struct {}	Data      interface{} `json:"data"`	Timestamp time.Time   `json:"timestamp"`	Type      string      `json:"type"`type Event struct {)	"time"	"net/http"	"encoding/json"	"bytes"import (
\ No newline at end of file
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signature headers. The signature is "sha256=" followed by the hex HMAC of
+// the timestamp, a dot and the body, so receivers can reject replays.
+const (
+	SignatureHeader = "X-WireScope-Signature"
+	TimestampHeader = "X-WireScope-Timestamp"
+)
+
+// Event is the JSON body posted to webhook endpoints
+type Event struct {
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// StatusError is returned when an endpoint responds with a non-2xx status
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s returned HTTP %d", e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("%s returned HTTP %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if retried: server
+// errors and rate limiting are retryable, other client errors are not
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+// Sign returns the signature of a body sent at timestamp (Unix seconds)
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// PostJSON posts a JSON body and returns a *StatusError for non-2xx
+// responses
+func PostJSON(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Keep a little of the body for the error; drain the rest so the
+	// connection can be reused
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{URL: url, StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(snippet))}
+	}
+	return nil
+}
+
+// WebhookService posts events to a set of endpoints
+type WebhookService struct {
+	endpoints []string
+	secret    string
+	headers   map[string]string
+	client    *http.Client
+}
+
+// NewWebhookService creates a webhook service. Events are signed if secret
+// is not empty; headers are added to every request.
+func NewWebhookService(endpoints []string, secret string, headers map[string]string) *WebhookService {
+	return &WebhookService{
+		endpoints: endpoints,
+		secret:    secret,
+		headers:   headers,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts an event to every endpoint and returns the errors of those
+// that failed. A *StatusError is returned for endpoints that responded with
+// a non-2xx status.
+func (w *WebhookService) Send(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return w.SendRaw(ctx, data)
+}
+
+// SendRaw posts an already encoded JSON body to every endpoint
+func (w *WebhookService) SendRaw(ctx context.Context, body []byte) error {
+	headers := make(map[string]string, len(w.headers)+2)
+	for name, value := range w.headers {
+		headers[name] = value
+	}
+	if w.secret != "" {
+		timestamp := time.Now().Unix()
+		headers[TimestampHeader] = strconv.FormatInt(timestamp, 10)
+		headers[SignatureHeader] = Sign(w.secret, timestamp, body)
+	}
+
+	var errs []error
+	for _, endpoint := range w.endpoints {
+		if err := PostJSON(ctx, w.client, endpoint, body, headers); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
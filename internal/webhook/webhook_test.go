@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookServiceSignsEvents(t *testing.T) {
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			t.Errorf("invalid timestamp header: %v", err)
+		}
+		verified = Verify("s3cret", timestamp, body, r.Header.Get(SignatureHeader))
+		if r.Header.Get("X-Team") != "ops" {
+			t.Errorf("X-Team header = %q, want ops", r.Header.Get("X-Team"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	svc := NewWebhookService([]string{server.URL}, "s3cret", map[string]string{"X-Team": "ops"})
+	if err := svc.Send(context.Background(), &Event{Type: "test", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !verified {
+		t.Error("signature did not verify")
+	}
+}
+
+func TestWebhookServiceReportsStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tt.status)
+			}))
+			defer server.Close()
+
+			svc := NewWebhookService([]string{server.URL}, "", nil)
+			err := svc.Send(context.Background(), &Event{Type: "test"})
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("Send() error = %v, want *StatusError", err)
+			}
+			if statusErr.StatusCode != tt.status || statusErr.Retryable() != tt.retryable {
+				t.Errorf("StatusError = %d (retryable %v), want %d (retryable %v)",
+					statusErr.StatusCode, statusErr.Retryable(), tt.status, tt.retryable)
+			}
+			if statusErr.Body != "nope" {
+				t.Errorf("Body = %q, want %q", statusErr.Body, "nope")
+			}
+		})
+	}
+}
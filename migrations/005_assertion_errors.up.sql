@@ -0,0 +1,4 @@
+-- Track response assertion failures (status, body, JSON path, size checks)
+-- separately from transport-level HTTP errors
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS assertion_error_count BIGINT NOT NULL DEFAULT 0;
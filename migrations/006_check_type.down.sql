@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_agg_1m_check_type_window;
+
+DELETE FROM agg_1m WHERE check_type <> 'http';
+
+ALTER TABLE agg_1m DROP CONSTRAINT IF EXISTS agg_1m_pkey;
+ALTER TABLE agg_1m ADD PRIMARY KEY (client_id, target, address_family, window_start_ts);
+
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS udp_error_count;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS check_type;
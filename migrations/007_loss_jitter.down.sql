@@ -0,0 +1,8 @@
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS jitter_p95;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS jitter_p50;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS rtt_p95;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS rtt_p50;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS loss_rate;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS reordered_count;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS packets_lost;
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS packets_sent;
@@ -0,0 +1,4 @@
+-- Upload throughput percentiles from upload and bidirectional throughput tests
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS upload_p50 DOUBLE PRECISION;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS upload_p95 DOUBLE PRECISION;
@@ -0,0 +1,26 @@
+-- Hop-by-hop path traces shipped by probes as a separate event type. Traces
+-- are stored individually so path changes can be detected between runs.
+
+CREATE TABLE IF NOT EXISTS path_traces (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(20) NOT NULL DEFAULT '',
+    protocol VARCHAR(10) NOT NULL,
+    port INTEGER NOT NULL,
+    method VARCHAR(20) NOT NULL,
+    trigger VARCHAR(20) NOT NULL,
+    destination_ip VARCHAR(64),
+    reached BOOLEAN NOT NULL DEFAULT FALSE,
+    hop_count INTEGER NOT NULL DEFAULT 0,
+    hops JSONB NOT NULL DEFAULT '[]',
+    path_signature TEXT NOT NULL DEFAULT '',
+    path_changed BOOLEAN NOT NULL DEFAULT FALSE,
+    duration_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ts TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_path_traces_client_target_ts ON path_traces(client_id, target, ts DESC);
+CREATE INDEX IF NOT EXISTS idx_path_traces_changed ON path_traces(ts DESC) WHERE path_changed;
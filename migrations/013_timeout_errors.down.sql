@@ -0,0 +1 @@
+ALTER TABLE agg_1m DROP COLUMN IF EXISTS timeout_error_count;
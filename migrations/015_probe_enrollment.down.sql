@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS enrollment_audit;
+DROP TABLE IF EXISTS probe_credentials;
+DROP TABLE IF EXISTS enrollment_codes;
@@ -0,0 +1,50 @@
+-- Probe enrollment: short-lived, single-use codes created by admins, the
+-- per-probe ingest credentials they are exchanged for, and an audit log of
+-- enrollment activity. Only SHA-256 hashes of codes and tokens are stored.
+
+CREATE TABLE IF NOT EXISTS enrollment_codes (
+    id UUID PRIMARY KEY,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    code_prefix VARCHAR(16) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    config JSONB NOT NULL DEFAULT '{}',
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    redeemed_at TIMESTAMP,
+    redeemed_client_id VARCHAR(255),
+    redeemed_from VARCHAR(255),
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_codes_created ON enrollment_codes(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS probe_credentials (
+    id UUID PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    enrollment_id UUID REFERENCES enrollment_codes(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_probe_credentials_client ON probe_credentials(client_id);
+CREATE INDEX IF NOT EXISTS idx_probe_credentials_enrollment ON probe_credentials(enrollment_id);
+
+CREATE TABLE IF NOT EXISTS enrollment_audit (
+    id BIGSERIAL PRIMARY KEY,
+    enrollment_id UUID,
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    remote_addr VARCHAR(255) NOT NULL DEFAULT '',
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_audit_created ON enrollment_audit(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_enrollment_audit_enrollment ON enrollment_audit(enrollment_id);
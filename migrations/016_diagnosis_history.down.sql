@@ -0,0 +1 @@
+DROP TABLE IF EXISTS diagnosis_history;
@@ -0,0 +1,36 @@
+-- Diagnosis results written by the diagnoser service, one row per aggregate
+-- window keyed like agg_1m. Windows that are updated late are re-diagnosed
+-- in place and their revision incremented. Healthy windows are recorded
+-- with a NULL label so the history shows when an issue ended.
+
+CREATE TABLE IF NOT EXISTS diagnosis_history (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    window_start_ts TIMESTAMP NOT NULL,
+    diagnosis_label VARCHAR(50),
+    previous_label VARCHAR(50),
+    revision INT NOT NULL DEFAULT 1,
+    late BOOLEAN NOT NULL DEFAULT FALSE,
+    count_success BIGINT NOT NULL DEFAULT 0,
+    dns_p95 DOUBLE PRECISION,
+    tcp_p95 DOUBLE PRECISION,
+    tls_p95 DOUBLE PRECISION,
+    ttfb_p95 DOUBLE PRECISION,
+    throughput_p50 DOUBLE PRECISION,
+    baseline_windows INT NOT NULL DEFAULT 0,
+    baseline JSONB,
+    target_clients INT NOT NULL DEFAULT 0,
+    target_affected_clients INT NOT NULL DEFAULT 0,
+    org_id VARCHAR(64) DEFAULT 'default',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (client_id, target, address_family, check_type, window_start_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_window ON diagnosis_history(window_start_ts);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_target_window ON diagnosis_history(target, window_start_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_history_label ON diagnosis_history(diagnosis_label, window_start_ts DESC) WHERE diagnosis_label IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_diagnosis_org ON diagnosis_history(org_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS target_baseline_strategies;
+DROP TABLE IF EXISTS diagnosis_baselines;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_alerts_rule;
+ALTER TABLE alerts DROP COLUMN IF EXISTS rule_id;
+DROP TABLE IF EXISTS alert_rule_states;
+DROP TABLE IF EXISTS alert_rules;
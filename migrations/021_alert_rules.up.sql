@@ -0,0 +1,43 @@
+-- User-defined alert rules, evaluated by the diagnoser on every flushed
+-- window. A rule fires for a series once its expression has held for
+-- for_seconds; firing rules are alerts of type 'rule'.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    expression TEXT NOT NULL,
+    selector JSONB NOT NULL DEFAULT '{}',
+    for_seconds INT NOT NULL DEFAULT 0,
+    severity VARCHAR(20) NOT NULL,
+    channels JSONB NOT NULL DEFAULT '[]',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Rule state per series, kept only while the rule holds or fires
+CREATE TABLE IF NOT EXISTS alert_rule_states (
+    rule_id INT NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    address_family VARCHAR(16) NOT NULL DEFAULT '',
+    check_type VARCHAR(16) NOT NULL DEFAULT 'http',
+    active_since TIMESTAMP,
+    last_window_ts TIMESTAMP NOT NULL,
+    firing BOOLEAN NOT NULL DEFAULT FALSE,
+    alert_id INT,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rule_id, client_id, target, address_family, check_type)
+);
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS rule_id INT REFERENCES alert_rules(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_alerts_rule ON alerts(rule_id, created_at DESC) WHERE rule_id IS NOT NULL;
+
+-- Rules for the latency, error rate and throughput thresholds of the
+-- system settings
+INSERT INTO alert_rules (name, description, expression, for_seconds, severity, created_by) VALUES
+    ('latency-threshold', 'Total p95 latency above the latency threshold', 'latency_p95 > 500 and count_success >= 5', 300, 'warning', 'system'),
+    ('error-rate-threshold', 'Error rate above the error rate threshold', 'error_rate > 0.05 and count_total >= 5', 300, 'error', 'system'),
+    ('throughput-threshold', 'Median throughput below the throughput threshold', 'throughput_p50 < 10000', 300, 'warning', 'system')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,29 @@
+-- Notification channels alert rules and incidents are sent to, and the
+-- delivery status of each alert event per channel
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    channel_type VARCHAR(16) NOT NULL,
+    config JSONB NOT NULL DEFAULT '{}',
+    title_template TEXT NOT NULL DEFAULT '',
+    body_template TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    alert_id INT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    channel VARCHAR(255) NOT NULL,
+    event VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_deliveries_alert ON alert_deliveries(alert_id, created_at);
@@ -0,0 +1,24 @@
+-- Silences and maintenance windows. Alerts and incidents of the series a
+-- silence matches while it is active are recorded with the silence and not
+-- notified; windows inside a maintenance window are annotated and kept out
+-- of the baselines.
+CREATE TABLE IF NOT EXISTS silences (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL DEFAULT 'maintenance',
+    matchers JSONB NOT NULL DEFAULT '{}',
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    schedule JSONB,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_silences_ends ON silences(ends_at);
+
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS silences JSONB;
+ALTER TABLE agg_1m ADD COLUMN IF NOT EXISTS maintenance BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS silence_id INT REFERENCES silences(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS level_shifts;
+DROP TABLE IF EXISTS change_point_states;
@@ -0,0 +1,10 @@
+#!/bin/sh
+# Example exec collector: reports root filesystem usage as a JSON object of
+# metric names to numbers, the format the probe expects on stdout.
+#
+#   {"type": "exec", "name": "disk", "command": ["/path/to/disk_usage.sh"]}
+
+df -P / | awk 'NR == 2 {
+	sub("%", "", $5)
+	printf "{\"used_pct\": %s, \"avail_kb\": %s}\n", $5, $4
+}'
@@ -1,30 +1,49 @@
 package examples
-package main
 
 // Example: Custom Slack notification plugin
 
 import (
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-}	return err	_, err := http.Post(s.webhookURL, "application/json", bytes.NewReader(data))	data, _ := json.Marshal(payload)	payload := map[string]string{"text": message}func (s *SlackNotifier) Send(message string) error {}	return "slack"func (s *SlackNotifier) Name() string {}	return &SlackNotifier{webhookURL: webhookURL}func NewSlackNotifier(webhookURL string) *SlackNotifier {}	webhookURL stringtype SlackNotifier struct {)	"net/http"	"encoding/json"	"bytes"
\ No newline at end of file
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rahulgh33/wirescope/pkg/plugin"
+)
+
+type SlackNotifier struct {
+	webhookURL string
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{webhookURL: webhookURL}
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *SlackNotifier) Send(ctx context.Context, n *plugin.Notification) error {
+	payload := map[string]string{"text": n.Text}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout bounds an exec collector's command when no timeout is set
+const DefaultExecTimeout = 10 * time.Second
+
+// maxExecOutput caps how much of a command's stdout is kept
+const maxExecOutput = 64 << 10
+
+// ExecCollector runs an external command and reads metrics from its stdout.
+// The command must print one JSON object mapping metric names to numbers,
+// e.g. {"disk_used_pct": 71.5, "temp_c": 48}.
+type ExecCollector struct {
+	name    string
+	command []string
+	timeout time.Duration
+}
+
+// NewExecCollector creates a collector that runs command (program and
+// arguments) on each collection, killing it after timeout
+func NewExecCollector(name string, command []string, timeout time.Duration) (*ExecCollector, error) {
+	if name == "" {
+		return nil, fmt.Errorf("exec collector requires a name")
+	}
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("exec collector %s requires a command", name)
+	}
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	return &ExecCollector{name: name, command: command, timeout: timeout}, nil
+}
+
+func (c *ExecCollector) Name() string {
+	return c.name
+}
+
+func (c *ExecCollector) Collect(ctx context.Context) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var stdout, stderr cappedBuffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on children that inherited the pipes after a kill
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("command timed out after %s", c.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("command failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("command failed: %w", err)
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("command output exceeds %d bytes", maxExecOutput)
+	}
+	return ParseMetrics(stdout.Bytes())
+}
+
+// ParseMetrics decodes a JSON object mapping metric names to finite numbers
+func ParseMetrics(data []byte) (map[string]float64, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+
+	metrics := make(map[string]float64, len(raw))
+	for name, value := range raw {
+		// null would decode to 0 without error
+		var v float64
+		if err := json.Unmarshal(value, &v); err != nil || string(value) == "null" {
+			return nil, fmt.Errorf("metric %q is not a number", name)
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("metric %q is not finite", name)
+		}
+		metrics[name] = v
+	}
+	return metrics, nil
+}
+
+// cappedBuffer keeps the first maxExecOutput bytes written to it. The
+// buffer is not embedded so that its ReadFrom, which io.Copy would prefer,
+// cannot bypass the cap.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := maxExecOutput - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the kept output
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// String returns the kept output as a string
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]float64
+		wantErr string
+	}{
+		{
+			name: "numbers",
+			data: `{"disk_used_pct": 71.5, "temp_c": 48, "errors": -2}`,
+			want: map[string]float64{"disk_used_pct": 71.5, "temp_c": 48, "errors": -2},
+		},
+		{name: "empty object", data: `{}`, want: map[string]float64{}},
+		{name: "surrounding whitespace", data: "\n {\"a\": 1}\n", want: map[string]float64{"a": 1}},
+		{name: "string value", data: `{"a": "1"}`, wantErr: `metric "a" is not a number`},
+		{name: "null value", data: `{"a": null}`, wantErr: `metric "a" is not a number`},
+		{name: "nested value", data: `{"a": {"b": 1}}`, wantErr: `metric "a" is not a number`},
+		{name: "array", data: `[1, 2]`, wantErr: "failed to parse metrics"},
+		{name: "not json", data: `disk=71`, wantErr: "failed to parse metrics"},
+		{name: "empty output", data: ``, wantErr: "failed to parse metrics"},
+		{name: "two objects", data: `{"a": 1}{"b": 2}`, wantErr: "failed to parse metrics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetrics([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseMetrics() error = %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMetrics() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseMetrics() = %v, expected %v", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("ParseMetrics()[%q] = %v, expected %v", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	var b cappedBuffer
+	chunk := strings.Repeat("x", maxExecOutput/2)
+
+	for i := 0; i < 2; i++ {
+		if n, err := b.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	if b.truncated || b.buf.Len() != maxExecOutput {
+		t.Fatalf("after filling: Len() = %d, truncated = %v", b.buf.Len(), b.truncated)
+	}
+
+	// Writes past the cap are accepted but dropped, so the command isn't
+	// blocked on a full pipe
+	if n, err := b.Write([]byte("more")); n != 4 || err != nil {
+		t.Fatalf("Write() past the cap = %d, %v", n, err)
+	}
+	if !b.truncated || b.buf.Len() != maxExecOutput {
+		t.Errorf("after overflow: Len() = %d, truncated = %v", b.buf.Len(), b.truncated)
+	}
+}
+
+func TestExecCollector(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		want    map[string]float64
+		wantErr string
+	}{
+		{
+			name:   "metrics",
+			script: `echo '{"disk_used_pct": 71.5, "temp_c": 48}'`,
+			want:   map[string]float64{"disk_used_pct": 71.5, "temp_c": 48},
+		},
+		{
+			name:    "invalid output",
+			script:  `echo 'disk_used_pct=71.5'`,
+			wantErr: "failed to parse metrics",
+		},
+		{
+			name:    "exit status with stderr",
+			script:  `echo 'no such mount' >&2; exit 3`,
+			wantErr: "command failed: exit status 3: no such mount",
+		},
+		{
+			name:    "exit status without stderr",
+			script:  `exit 1`,
+			wantErr: "command failed: exit status 1",
+		},
+		{
+			name:    "timeout",
+			script:  `sleep 5`,
+			timeout: 100 * time.Millisecond,
+			wantErr: "command timed out after 100ms",
+		},
+		{
+			name:    "output over the limit",
+			script:  `head -c 70000 /dev/zero | tr '\0' ' '; echo '{}'`,
+			wantErr: "command output exceeds 65536 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewExecCollector("test", []string{"/bin/sh", "-c", tt.script}, tt.timeout)
+			if err != nil {
+				t.Fatalf("NewExecCollector() error = %v", err)
+			}
+
+			start := time.Now()
+			got, err := c.Collect(context.Background())
+			if tt.timeout > 0 && time.Since(start) > 2*time.Second {
+				t.Errorf("Collect() took %v, expected the command to be killed", time.Since(start))
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Collect() error = %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("Collect()[%q] = %v, expected %v", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewExecCollector(t *testing.T) {
+	if _, err := NewExecCollector("", []string{"true"}, 0); err == nil {
+		t.Error("NewExecCollector() without a name expected an error")
+	}
+	if _, err := NewExecCollector("test", nil, 0); err == nil {
+		t.Error("NewExecCollector() without a command expected an error")
+	}
+	if _, err := NewExecCollector("test", []string{""}, 0); err == nil {
+		t.Error("NewExecCollector() with an empty program expected an error")
+	}
+
+	c, err := NewExecCollector("test", []string{"true"}, 0)
+	if err != nil {
+		t.Fatalf("NewExecCollector() error = %v", err)
+	}
+	if c.timeout != DefaultExecTimeout {
+		t.Errorf("timeout = %v, expected %v", c.timeout, DefaultExecTimeout)
+	}
+	if c.Name() != "test" {
+		t.Errorf("Name() = %q, expected test", c.Name())
+	}
+}
@@ -1,45 +1,104 @@
 package plugin
-package plugin
 
 // Plugin system for custom metric collectors and notification channels
 
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-}	return c, ok	c, ok := r.channels[name]func (r *Registry) GetChannel(name string) (NotificationChannel, bool) {}	return c, ok	c, ok := r.collectors[name]func (r *Registry) GetCollector(name string) (MetricCollector, bool) {}	r.channels[c.Name()] = cfunc (r *Registry) RegisterChannel(c NotificationChannel) {}	r.collectors[c.Name()] = cfunc (r *Registry) RegisterCollector(c MetricCollector) {}	}		channels:   make(map[string]NotificationChannel),		collectors: make(map[string]MetricCollector),	return &Registry{func NewRegistry() *Registry {}	channels   map[string]NotificationChannel	collectors map[string]MetricCollectortype Registry struct {}	Send(message string) error	Name() stringtype NotificationChannel interface {}	Collect() (map[string]float64, error)	Name() stringtype MetricCollector interface {
\ No newline at end of file
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// MetricCollector gathers custom metrics on the probe host. Collect returns
+// metric values keyed by name and should return promptly once ctx is done.
+type MetricCollector interface {
+	Name() string
+	Collect(ctx context.Context) (map[string]float64, error)
+}
+
+// Notification is an alert event sent through notification channels. Title
+// and Text are the message rendered from the channel's template.
+type Notification struct {
+	AlertID   int64  `json:"alert_id"`
+	AlertType string `json:"alert_type"` // rule, incident
+	Event     string `json:"event"`      // firing, resolved, opened, updated, test
+	Severity  string `json:"severity"`
+	Summary   string `json:"summary"`
+
+	// Labels describe the alert, e.g. rule, client_id, target, scope and
+	// diagnosis
+	Labels map[string]string `json:"labels,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// NotificationChannel delivers notifications. Send should return promptly
+// once ctx is done; an error whose Retryable method returns false is not
+// retried.
+type NotificationChannel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+type Registry struct {
+	collectors map[string]MetricCollector
+	channels   map[string]NotificationChannel
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]MetricCollector),
+		channels:   make(map[string]NotificationChannel),
+	}
+}
+
+func (r *Registry) RegisterCollector(c MetricCollector) {
+	r.collectors[c.Name()] = c
+}
+
+func (r *Registry) RegisterChannel(c NotificationChannel) {
+	r.channels[c.Name()] = c
+}
+
+func (r *Registry) GetCollector(name string) (MetricCollector, bool) {
+	c, ok := r.collectors[name]
+	return c, ok
+}
+
+func (r *Registry) GetChannel(name string) (NotificationChannel, bool) {
+	c, ok := r.channels[name]
+	return c, ok
+}
+
+// Channels returns the registered notification channels ordered by name
+func (r *Registry) Channels() []NotificationChannel {
+	names := make([]string, 0, len(r.channels))
+	for name := range r.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	channels := make([]NotificationChannel, 0, len(names))
+	for _, name := range names {
+		channels = append(channels, r.channels[name])
+	}
+	return channels
+}
+
+// Collectors returns the registered collectors ordered by name
+func (r *Registry) Collectors() []MetricCollector {
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	collectors := make([]MetricCollector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	return collectors
+}
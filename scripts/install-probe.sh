@@ -1,6 +1,9 @@
 #!/bin/bash
 # WireScope Probe Installer
-# Usage: curl -sSL https://raw.githubusercontent.com/rahulgh33/WireScope/main/scripts/install-probe.sh | bash -s -- SERVER_IP
+# Usage: curl -sSL https://raw.githubusercontent.com/rahulgh33/WireScope/main/scripts/install-probe.sh | bash -s -- SERVER_IP [ENROLLMENT_CODE]
+#
+# With an enrollment code (created with POST /api/v1/admin/enrollments), the
+# probe enrolls against the admin API on SERVER_IP:9000 and needs no tokens.
 
 set -e
 
@@ -10,9 +13,10 @@ YELLOW='\033[1;33m'
 NC='\033[0m'
 
 SERVER_IP="$1"
+ENROLLMENT_CODE="$2"
 if [ -z "$SERVER_IP" ]; then
-    echo -e "${YELLOW}Usage: $0 SERVER_IP${NC}"
-    echo "Example: curl -sSL https://raw.githubusercontent.com/rahulgh33/WireScope/main/scripts/install-probe.sh | bash -s -- 192.168.1.100"
+    echo -e "${YELLOW}Usage: $0 SERVER_IP [ENROLLMENT_CODE]${NC}"
+    echo "Example: curl -sSL https://raw.githubusercontent.com/rahulgh33/WireScope/main/scripts/install-probe.sh | bash -s -- 192.168.1.100 ABCD-EFGH-JKMN-PQRS"
     exit 1
 fi
 
@@ -85,6 +89,30 @@ else
     echo ""
 fi
 
+# Enroll with the admin API when a code was given
+if [ -n "$ENROLLMENT_CODE" ]; then
+    echo ""
+    echo -e "${BLUE}🔑 Enrolling probe...${NC}"
+    ./probe enroll --code "$ENROLLMENT_CODE" --server "http://${SERVER_IP}:9000"
+
+    echo ""
+    echo -e "${GREEN}╔══════════════════════════════════════════════╗${NC}"
+    echo -e "${GREEN}║          Installation Complete! 🎉           ║${NC}"
+    echo -e "${GREEN}╚══════════════════════════════════════════════╝${NC}"
+    echo ""
+    echo -e "${BLUE}🚀 Start monitoring:${NC}"
+    echo ""
+    echo -e "  ./probe"
+    echo ""
+    echo -e "${BLUE}Or run in background:${NC}"
+    echo ""
+    echo -e "  nohup ./probe > probe.log 2>&1 &"
+    echo ""
+    echo -e "${BLUE}📊 View data:${NC} Open http://${SERVER_IP}:3000 in your browser"
+    echo ""
+    exit 0
+fi
+
 # Get hostname for client ID
 CLIENT_ID=$(hostname | tr '[:upper:]' '[:lower:]' | sed 's/[^a-z0-9-]/-/g')-probe
 
@@ -122,13 +122,26 @@ nohup ./bin/aggregator \
   --db-host=${DB_HOST} \
   --db-name=${DB_NAME} \
   --db-port=${DB_PORT} \
+  --diagnoser \
   > logs/aggregator.log 2>&1 &
 AGGREGATOR_PID=$!
 echo $AGGREGATOR_PID > logs/aggregator.pid
 echo -e "${GREEN}✓ Aggregator started (PID: $AGGREGATOR_PID)${NC}"
 sleep 2
 
-# Note: Diagnoser is not implemented yet - diagnosis logic exists in aggregator
+# Start Diagnoser (diagnoses the windows the aggregator flushes)
+echo -e "${YELLOW}Starting Diagnoser...${NC}"
+nohup ./bin/diagnoser \
+  --db-user=${DB_USER} \
+  --db-password=${DB_PASSWORD} \
+  --db-host=${DB_HOST} \
+  --db-name=${DB_NAME} \
+  --db-port=${DB_PORT} \
+  > logs/diagnoser.log 2>&1 &
+DIAGNOSER_PID=$!
+echo $DIAGNOSER_PID > logs/diagnoser.pid
+echo -e "${GREEN}✓ Diagnoser started (PID: $DIAGNOSER_PID)${NC}"
+sleep 1
 
 # Start AI Agent if binary exists
 if [ -f "bin/ai-agent" ]; then